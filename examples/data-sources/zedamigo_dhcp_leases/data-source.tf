@@ -0,0 +1,30 @@
+resource "zedamigo_dhcp_server" "lab" {
+  interface  = "br-lab"
+  server_id  = "172.27.244.254"
+  nameserver = "172.27.244.254"
+  router     = "172.27.244.254"
+  netmask    = "255.255.255.0"
+  pool {
+    start = "172.27.244.100"
+    end   = "172.27.244.199"
+  }
+}
+
+# All the current leases of the DHCP server.
+data "zedamigo_dhcp_leases" "lab" {
+  leases_file = zedamigo_dhcp_server.lab.leases_file
+}
+
+# The lease of the first NIC of an edge node.
+data "zedamigo_dhcp_leases" "edge_node" {
+  leases_file = zedamigo_dhcp_server.lab.leases_file
+  mac         = "52:54:00:12:34:01"
+}
+
+output "lab_leases" {
+  value = { for l in data.zedamigo_dhcp_leases.lab.leases : l.mac => "${l.ip} (${l.hostname}) until ${l.expiry}" }
+}
+
+output "edge_node_ip" {
+  value = data.zedamigo_dhcp_leases.edge_node.ip_by_mac["52:54:00:12:34:01"]
+}
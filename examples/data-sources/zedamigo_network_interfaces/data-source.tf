@@ -0,0 +1,15 @@
+# All the interfaces of the target.
+data "zedamigo_network_interfaces" "host" {}
+
+# The interfaces of a lab network namespace.
+data "zedamigo_network_interfaces" "lab" {
+  netns = "lab"
+}
+
+output "host_bridges" {
+  value = [for i in data.zedamigo_network_interfaces.host.interfaces : i.name if i.kind == "bridge"]
+}
+
+output "lab_addresses" {
+  value = { for i in data.zedamigo_network_interfaces.lab.interfaces : i.name => i.ipv4_addresses }
+}
@@ -35,5 +35,11 @@ resource "zedamigo_dhcp6_server" "dhcpv6_server_01" {
     start = "2001:db8:113::baad:0"
     end   = "2001:db8:113::baad:ff"
   }
+  # Delegate a /56 to each client asking for a prefix (IA_PD), e.g. EVE for
+  # its app instance networks.
+  prefix_delegation {
+    prefix = "2001:db8:200::/48"
+    length = 56
+  }
 }
 
@@ -0,0 +1,43 @@
+# A single VLAN-aware bridge carrying VLANs 506, 507 and 508: trunked to one VM
+# NIC, with 506 as its native VLAN, and access-mode to another.
+resource "zedamigo_bridge" "vlans" {
+  name           = "test-br-vlans"
+  state          = "up"
+  vlan_filtering = true
+  default_pvid   = 0 # Ports are not in any VLAN until configured.
+}
+
+resource "zedamigo_tap" "trunk" {
+  name   = "test-tap-trunk"
+  state  = "up"
+  master = zedamigo_bridge.vlans.name
+}
+
+resource "zedamigo_tap" "access" {
+  name   = "test-tap-507"
+  state  = "up"
+  master = zedamigo_bridge.vlans.name
+}
+
+resource "zedamigo_bridge_vlan" "trunk" {
+  bridge    = zedamigo_bridge.vlans.name
+  interface = zedamigo_tap.trunk.name
+  tagged    = [507, 508]
+  untagged  = [506]
+  pvid      = 506
+}
+
+resource "zedamigo_bridge_vlan" "access" {
+  bridge    = zedamigo_bridge.vlans.name
+  interface = zedamigo_tap.access.name
+  untagged  = [507]
+  pvid      = 507
+}
+
+# The bridge interface itself, to reach VLAN 508 from the host.
+resource "zedamigo_bridge_vlan" "host" {
+  bridge    = zedamigo_bridge.vlans.name
+  interface = zedamigo_bridge.vlans.name
+  untagged  = [508]
+  pvid      = 508
+}
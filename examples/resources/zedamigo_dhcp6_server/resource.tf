@@ -4,13 +4,46 @@ variable "intf_to_run_dhcp6" {
   default   = "eth1"
 }
 
+# Stateful: leases addresses from the pool (pair it with a zedamigo_radv with
+# `managed_config = true`) and delegates /56 prefixes to the routers asking
+# for them, e.g. EVE.
 resource "zedamigo_dhcp6_server" "test" {
-  interface  = var.intf_to_run_dhcp6
-  server_id  = "aa:bb:cc:dd:ee:ff"
-  nameserver = "2606:4700:4700::1111"
+  interface     = var.intf_to_run_dhcp6
+  server_id     = "aa:bb:cc:dd:ee:ff"
+  nameserver    = "2606:4700:4700::1111"
+  domain_search = ["lab.local"]         # Optional: DHCPv6 option 24
+  sntp_servers  = ["fd00:abcd:1234::1"] # Optional: DHCPv6 option 31
   pool {
     start = "fd00:abcd:1234::100"
     end   = "fd00:abcd:1234::199"
   }
+  prefix_delegation {
+    prefix = "fd00:abcd:2000::/48"
+    length = 56
+  }
   lease_time = 3600 # Optional: lease time in seconds (default: 3600)
 }
+
+variable "intf_to_run_dhcp6_stateless" {
+  sensitive = false
+  type      = string
+  default   = "eth2"
+}
+
+# Stateless: the clients get their addresses with SLAAC and only the options
+# with DHCPv6.
+resource "zedamigo_radv" "slaac" {
+  interface         = var.intf_to_run_dhcp6_stateless
+  prefix            = "fd00:abcd:5678::/64"
+  prefix_autonomous = true  # Allow SLAAC.
+  managed_config    = false # Don't require DHCPv6 for addresses.
+  other_config      = true  # Require DHCPv6 for other config.
+}
+
+resource "zedamigo_dhcp6_server" "stateless" {
+  interface     = var.intf_to_run_dhcp6_stateless
+  server_id     = "aa:bb:cc:dd:ee:fe"
+  mode          = "stateless"
+  nameserver    = "2606:4700:4700::1111"
+  domain_search = ["lab.local"]
+}
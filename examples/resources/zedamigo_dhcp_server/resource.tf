@@ -5,11 +5,16 @@ variable "intf_to_run_dhcp" {
 }
 
 resource "zedamigo_dhcp_server" "test" {
-  interface  = var.intf_to_run_dhcp
-  server_id  = "172.27.244.254"
-  nameserver = "9.9.9.9"
-  router     = "172.27.244.254"
-  netmask    = "255.255.255.0"
+  interface      = var.intf_to_run_dhcp
+  server_id      = "172.27.244.254"
+  nameserver     = "9.9.9.9"
+  ntp_servers    = ["172.27.244.254"] # Optional: DHCP option 42
+  router         = "172.27.244.254"
+  netmask        = "255.255.255.0"
+  domain_name    = "lab.local"         # Optional: DHCP option 15
+  domain_search  = ["lab.local"]       # Optional: DHCP option 119
+  mtu            = 1500                # Optional: DHCP option 26
+  vendor_options = "01:04:ac:1b:f4:fe" # Optional: DHCP option 43, hex bytes
   pool {
     start = "172.27.244.100"
     end   = "172.27.244.199"
@@ -22,5 +27,22 @@ resource "zedamigo_dhcp_server" "test" {
     to  = "11.11.11.0/24"
     via = "172.27.244.254"
   }
+  # Static leases, e.g. for the NICs of edge nodes. The addresses should be
+  # outside of the pool.
+  host {
+    mac      = "52:54:00:12:34:01"
+    ip       = "172.27.244.11"
+    hostname = "edge-node-1"
+  }
+  host {
+    mac = "52:54:00:12:34:02"
+    ip  = "172.27.244.12"
+  }
+  # Any other option, sent in every reply.
+  option {
+    code  = 66 # TFTP server name
+    type  = "string"
+    value = "172.27.244.254"
+  }
   lease_time = 3600 # Optional: lease time in seconds (default: 3600)
 }
@@ -0,0 +1,38 @@
+resource "zedamigo_bridge" "lab" {
+  name         = "br-lab"
+  ipv4_address = "172.27.245.1/24"
+}
+
+# Edge nodes on br-lab get 172.27.245.1 as their nameserver (e.g. from a
+# zedamigo_dhcp_server) and resolve the fake controller name to the lab host.
+resource "zedamigo_dns_server" "lab" {
+  interface      = zedamigo_bridge.lab.name
+  listen_address = "172.27.245.1"
+
+  record {
+    name  = "zedcloud.lab.local"
+    type  = "A"
+    value = "172.27.245.1"
+  }
+  record {
+    name  = "*.zedcloud.lab.local"
+    type  = "CNAME"
+    value = "zedcloud.lab.local"
+  }
+  record {
+    name  = "_https._tcp.zedcloud.lab.local"
+    type  = "SRV"
+    ttl   = 60
+    value = "10 5 443 zedcloud.lab.local"
+  }
+
+  # Everything else goes to a public resolver.
+  upstreams = ["9.9.9.9", "149.112.112.112"]
+
+  # Simulate an outage of the NTP pool and a very slow CDN.
+  nxdomain = ["pool.ntp.org", "*.pool.ntp.org"]
+  delay {
+    name  = "*.cloudfront.net"
+    delay = "4s"
+  }
+}
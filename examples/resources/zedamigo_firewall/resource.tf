@@ -0,0 +1,33 @@
+# A customer site that only allows HTTPS out: the edge nodes on the site
+# bridge can reach port 443 and nothing else. The traffic to the host itself
+# (e.g. DHCP) is not filtered.
+resource "zedamigo_bridge" "site" {
+  name         = "br-site"
+  state        = "up"
+  ipv4_address = "10.20.0.1/24"
+}
+
+resource "zedamigo_nat" "site" {
+  name              = "site"
+  egress_interface  = "eth0"
+  source_interfaces = [zedamigo_bridge.site.name]
+}
+
+resource "zedamigo_firewall" "site" {
+  name           = "site"
+  interface      = zedamigo_bridge.site.name
+  default_action = "drop"
+
+  rule {
+    action   = "accept"
+    protocol = "tcp"
+    port     = "443"
+    comment  = "HTTPS, e.g. the controller"
+  }
+
+  rule {
+    action   = "accept"
+    protocol = "icmp"
+    comment  = "ping"
+  }
+}
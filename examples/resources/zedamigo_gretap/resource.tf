@@ -0,0 +1,17 @@
+# Stretch a lab bridge to a second host (192.0.2.2), which runs the same
+# configuration with `remote` and `local` swapped.
+resource "zedamigo_bridge" "lab" {
+  name  = "br-lab"
+  mtu   = 1462
+  state = "up"
+}
+
+resource "zedamigo_gretap" "lab" {
+  name   = "gt-lab"
+  remote = "192.0.2.2"
+  local  = "192.0.2.1"
+  key    = 1000
+  master = zedamigo_bridge.lab.name
+  mtu    = 1462
+  state  = "up"
+}
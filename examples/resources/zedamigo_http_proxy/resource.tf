@@ -0,0 +1,32 @@
+resource "zedamigo_bridge" "lab" {
+  name         = "br-lab"
+  ipv4_address = "172.27.245.1/24"
+}
+
+# A "MITM" proxy like the ones of some customer sites: basic auth, only the
+# controller reachable, TLS intercepted with a generated CA.
+resource "zedamigo_http_proxy" "site" {
+  interface      = zedamigo_bridge.lab.name
+  listen_address = "172.27.245.1"
+  port           = 3128
+  username       = "eve"
+  password       = "lab-proxy-password"
+
+  allow = ["zedcloud.local.zededa.net", "*.zededa.net"]
+  deny  = ["*.tracking.example.com"]
+
+  tls_intercept        = true
+  tls_intercept_bypass = ["*.docker.io"]
+}
+
+# The edge nodes must trust the interception CA.
+resource "zedamigo_eve_installer" "proxied" {
+  name    = "EVE-OS_behind_proxy"
+  tag     = "16.0.1-lts-kvm-amd64"
+  cluster = "zedcloud.local.zededa.net"
+  tls_ca  = zedamigo_http_proxy.site.ca_certificate
+}
+
+output "proxy_access_log" {
+  value = zedamigo_http_proxy.site.access_log
+}
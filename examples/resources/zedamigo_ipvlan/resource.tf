@@ -0,0 +1,14 @@
+# A namespace on the network of a Wi-Fi uplink, which accepts only the MAC
+# address of the host.
+resource "zedamigo_netns" "wlan" {
+  name = "wlan"
+}
+
+resource "zedamigo_ipvlan" "wlan" {
+  name         = "ipv-wlan"
+  parent       = "wlan0"
+  mode         = "l2"
+  netns        = zedamigo_netns.wlan.name
+  state        = "up"
+  ipv4_address = "192.168.50.250/24"
+}
@@ -0,0 +1,76 @@
+variable "eve_tag" {
+  type    = string
+  default = "14.5.1-lts-kvm-amd64"
+}
+
+resource "zedamigo_bridge" "lab" {
+  name         = "br-lab"
+  ipv4_address = "172.27.246.1/24"
+}
+
+resource "zedamigo_tap" "edge0" {
+  name   = "tap-edge0"
+  state  = "up"
+  master = zedamigo_bridge.lab.name
+}
+
+resource "zedamigo_local_datastore" "lab" {
+  static_dir = "/var/lib/zedamigo-ds"
+  listen     = "172.27.246.1:8080"
+}
+
+# Only needed for plain PXE clients, the NIC option ROMs of QEMU are iPXE
+# already.
+resource "zedamigo_tftp_server" "lab" {
+  interface      = zedamigo_bridge.lab.name
+  listen_address = "172.27.246.1"
+}
+
+# The EVE-OS network installer, served by the local datastore.
+resource "zedamigo_ipxe_boot" "eve" {
+  tag           = var.eve_tag
+  cluster       = "zedcloud.local.zededa.net"
+  datastore_dir = zedamigo_local_datastore.lab.static_dir
+  datastore_url = "http://${zedamigo_local_datastore.lab.listen}"
+  kernel_args   = "eve_install_disk=sda" # Optional: e.g. the disk to install to.
+  tftp_root     = zedamigo_tftp_server.lab.root_dir
+  ipxe_efi      = "/usr/lib/ipxe/ipxe.efi"
+}
+
+resource "zedamigo_dhcp_server" "lab" {
+  interface  = zedamigo_bridge.lab.name
+  server_id  = "172.27.246.1"
+  nameserver = "172.27.246.1"
+  router     = "172.27.246.1"
+  netmask    = "255.255.255.0"
+  pool {
+    start = "172.27.246.100"
+    end   = "172.27.246.199"
+  }
+  # Plain PXE clients chainload iPXE over TFTP, iPXE clients get the script.
+  netboot {
+    next_server     = zedamigo_tftp_server.lab.listen_address
+    boot_file       = zedamigo_ipxe_boot.eve.boot_file
+    ipxe_script_url = zedamigo_ipxe_boot.eve.script_url
+  }
+}
+
+resource "zedamigo_disk_image" "edge0" {
+  name    = "edge0"
+  size_mb = 16384
+}
+
+# Installs EVE-OS over iPXE on its first boot, then boots the installed EVE-OS
+# from the disk.
+resource "zedamigo_edge_node" "edge0" {
+  name      = "edge0"
+  serial_no = "EDGE0SN"
+  nic0      = "tap,id=vmnet0,ifname=${zedamigo_tap.edge0.name},script=no,downscript=no,model=virtio,mac=52:54:00:12:34:01"
+  boot_once = "network"
+
+  disk {
+    source = zedamigo_disk_image.edge0.filename
+  }
+
+  depends_on = [zedamigo_dhcp_server.lab]
+}
@@ -0,0 +1,36 @@
+# A namespace with its own MAC address on the lab LAN, e.g. to run a DHCP
+# client or a test service there.
+resource "zedamigo_netns" "lab" {
+  name = "lab"
+}
+
+resource "zedamigo_macvlan" "lab" {
+  name         = "mv-lab"
+  parent       = "eth0"
+  netns        = zedamigo_netns.lab.name
+  state        = "up"
+  ipv4_address = "192.168.1.250/24"
+}
+
+# A nested EVE-OS edge node directly on the lab LAN, through a macvtap.
+resource "zedamigo_macvlan" "edge_lan" {
+  name        = "mvt-edge0"
+  parent      = "eth0"
+  macvtap     = true
+  mac_address = "8c:84:74:11:02:01"
+  state       = "up"
+}
+
+resource "zedamigo_edge_node" "edge0" {
+  name      = "edge0"
+  serial_no = "EDGE0SN"
+
+  disk {
+    source = "/var/lib/images/eve.qcow2"
+  }
+
+  macvtap_nic {
+    tap_device  = zedamigo_macvlan.edge_lan.tap_device
+    mac_address = zedamigo_macvlan.edge_lan.mac_address
+  }
+}
@@ -0,0 +1,21 @@
+# Internet access for the edge nodes on a lab bridge, which get their
+# addresses from a zedamigo_dhcp_server on 10.10.0.0/24.
+resource "zedamigo_bridge" "lab" {
+  name         = "br-lab"
+  state        = "up"
+  ipv4_address = "10.10.0.1/24"
+}
+
+resource "zedamigo_nat" "lab" {
+  name              = "lab"
+  egress_interface  = "eth0"
+  source_interfaces = [zedamigo_bridge.lab.name]
+  source_cidrs      = ["10.10.0.0/24"]
+
+  # SSH to the edge node at 10.10.0.10 through port 8022 of the host.
+  port_forward {
+    port       = 8022
+    to_address = "10.10.0.10"
+    to_port    = 22
+  }
+}
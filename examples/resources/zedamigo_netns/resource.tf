@@ -0,0 +1,28 @@
+# A namespace used as a simulated ISP router: forwarding on, no router
+# advertisements accepted on its links, loose reverse path filtering, and its
+# own resolver configuration for the commands run in it.
+resource "zedamigo_netns" "isp" {
+  name = "isp"
+
+  sysctls = {
+    "net.ipv4.ip_forward"             = "1"
+    "net.ipv6.conf.all.forwarding"    = "1"
+    "net.ipv6.conf.default.accept_ra" = "0"
+    "net.ipv4.conf.all.rp_filter"     = "2"
+    "net.ipv4.conf.default.rp_filter" = "2"
+  }
+
+  resolv_conf = <<-EOT
+    nameserver 198.51.100.1
+    search isp.internal
+  EOT
+
+  hosts = <<-EOT
+    127.0.0.1 localhost
+    198.51.100.2 router.isp.internal
+  EOT
+}
+
+output "isp_interfaces" {
+  value = zedamigo_netns.isp.interfaces
+}
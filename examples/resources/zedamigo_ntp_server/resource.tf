@@ -0,0 +1,31 @@
+resource "zedamigo_bridge" "lab" {
+  name         = "br-lab"
+  ipv4_address = "172.27.245.1/24"
+}
+
+# An NTP server that is 3 years ahead, to reproduce the certificate validation
+# failures of an edge node with a wrong clock.
+resource "zedamigo_ntp_server" "skewed" {
+  interface      = zedamigo_bridge.lab.name
+  listen_address = "172.27.245.1"
+  offset         = "+3y"
+  stratum        = 2
+
+  # Or tell the clients to go away:
+  # mode      = "kiss_of_death"
+  # kiss_code = "DENY"
+}
+
+# Advertise it to the edge nodes on br-lab (DHCP option 42).
+resource "zedamigo_dhcp_server" "lab" {
+  interface   = zedamigo_bridge.lab.name
+  server_id   = "172.27.245.1"
+  nameserver  = "172.27.245.1"
+  ntp_servers = [zedamigo_ntp_server.skewed.listen_address]
+  router      = "172.27.245.1"
+  netmask     = "255.255.255.0"
+  pool {
+    start = "172.27.245.100"
+    end   = "172.27.245.199"
+  }
+}
@@ -0,0 +1,11 @@
+terraform {
+  required_providers {
+    zedamigo = {
+      source = "andrei-zededa/zedamigo"
+    }
+  }
+}
+
+provider "zedamigo" {
+  target = "localhost"
+}
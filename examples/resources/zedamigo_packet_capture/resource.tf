@@ -0,0 +1,24 @@
+# Capture the controller traffic of an edge node on its TAP interface.
+resource "zedamigo_packet_capture" "onboarding" {
+  interface = zedamigo_tap.TAP_101.name
+  snaplen   = 2048
+
+  # Only IPv4, the output of `tcpdump -y EN10MB -ddd ip`. Longer filters are
+  # easier to keep in a file: bpf = file("${path.module}/onboarding.bpf").
+  bpf = <<-EOT
+    4
+    40 0 0 12
+    21 0 1 2048
+    6 0 0 262144
+    6 0 0 0
+  EOT
+
+  rotate_size_mb = 100
+  rotate_files   = 5
+}
+
+# Capture nic0 of an edge node that uses gvproxy, through QMP.
+resource "zedamigo_packet_capture" "nic0" {
+  qmp_socket = zedamigo_edge_node.node1.qmp_socket
+  netdev     = "usernet0"
+}
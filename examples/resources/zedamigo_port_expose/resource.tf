@@ -0,0 +1,9 @@
+# Open a new app-instance port on an already running edge node that uses
+# gvproxy networking, without restarting the VM.
+resource "zedamigo_port_expose" "app_http" {
+  control_socket = zedamigo_edge_node.node1.gvproxy_control_socket
+
+  host_addr  = "127.0.0.1"
+  host_port  = 18080
+  guest_port = 8080
+}
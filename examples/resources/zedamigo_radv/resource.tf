@@ -28,3 +28,24 @@ resource "zedamigo_radv" "dhcpv6_only" {
   managed_config    = true  # Use DHCPv6 for addresses.
   other_config      = true  # Use DHCPv6 for other config.
 }
+
+# Dual prefix with RDNSS, DNSSL, MTU and NAT64 (PREF64). Any change here is
+# applied in place, the clients keep their SLAAC addresses.
+resource "zedamigo_radv" "nat64" {
+  interface         = "eth102"
+  prefix            = "fd00:6464:1::/64"
+  dns_servers       = "fd00:6464:1::53"
+  rdnss_lifetime    = 1800
+  dns_search        = ["lab.local"]
+  mtu               = 1400
+  pref64            = "64:ff9b::/96"
+  router_preference = "high"
+  extra_prefix {
+    prefix     = "fd00:6464:2::/64"
+    autonomous = false # On-link only.
+  }
+  extra_prefix {
+    prefix             = "fd00:6464:3::/64"
+    preferred_lifetime = 0 # Deprecated, renumbering away from it.
+  }
+}
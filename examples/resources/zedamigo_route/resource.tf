@@ -0,0 +1,20 @@
+# Route the traffic of a LAN namespace through a simulated ISP router
+# namespace (see the zedamigo_veth example for the links between them).
+resource "zedamigo_route" "lan_default" {
+  netns       = "lan"
+  destination = "default"
+  gateway     = "192.0.2.1"
+}
+
+resource "zedamigo_route" "isp_default" {
+  netns       = "isp"
+  destination = "default"
+  gateway     = "198.51.100.1"
+}
+
+# The way back from the host to the LAN, through the ISP router.
+resource "zedamigo_route" "host_to_lan" {
+  destination = "192.0.2.0/24"
+  gateway     = "198.51.100.2"
+  device      = "br-upstream"
+}
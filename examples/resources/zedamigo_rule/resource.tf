@@ -0,0 +1,15 @@
+# Send the traffic of the edge nodes on a lab bridge through a second uplink,
+# with its own routing table, while the host keeps using the main one.
+resource "zedamigo_route" "uplink2_default" {
+  destination = "default"
+  gateway     = "203.0.113.1"
+  device      = "eth1"
+  table       = 100
+}
+
+resource "zedamigo_rule" "lab_via_uplink2" {
+  priority = 1000
+  from     = "10.10.0.0/24"
+  iif      = "br-lab"
+  table    = zedamigo_route.uplink2_default.table
+}
@@ -0,0 +1,33 @@
+resource "zedamigo_bridge" "lab" {
+  name         = "br-lab"
+  ipv4_address = "172.27.246.1/24"
+}
+
+# Serves the files of its root_dir, by default an empty directory created by
+# the provider, e.g. the iPXE binary copied there by a zedamigo_ipxe_boot.
+resource "zedamigo_tftp_server" "lab" {
+  interface      = zedamigo_bridge.lab.name
+  listen_address = "172.27.246.1"
+  block_size     = 1468 # Optional: larger blocks, fewer round trips.
+}
+
+# PXE clients on br-lab download ipxe.efi from it.
+resource "zedamigo_dhcp_server" "lab" {
+  interface  = zedamigo_bridge.lab.name
+  server_id  = "172.27.246.1"
+  nameserver = "172.27.246.1"
+  router     = "172.27.246.1"
+  netmask    = "255.255.255.0"
+  pool {
+    start = "172.27.246.100"
+    end   = "172.27.246.199"
+  }
+  netboot {
+    next_server = zedamigo_tftp_server.lab.listen_address
+    boot_file   = "ipxe.efi"
+  }
+}
+
+output "tftp_root" {
+  value = zedamigo_tftp_server.lab.root_dir
+}
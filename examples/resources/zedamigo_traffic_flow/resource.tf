@@ -0,0 +1,61 @@
+# A sink in its own network namespace, reachable from the host over a veth.
+resource "zedamigo_netns" "sink" {
+  name = "sink"
+}
+
+resource "zedamigo_veth" "sink" {
+  name         = "v-host-sink"
+  state        = "up"
+  ipv4_address = "192.0.2.1/24"
+
+  peer_name         = "v-sink-host"
+  peer_netns        = zedamigo_netns.sink.name
+  peer_state        = "up"
+  peer_ipv4_address = "192.0.2.2/24"
+}
+
+# The sink outlives the flow, its results are available once it is finished
+# (after a `terraform refresh`).
+resource "zedamigo_traffic_flow" "sink" {
+  mode     = "receive"
+  protocol = "udp"
+  netns    = zedamigo_netns.sink.name
+  port     = 5201
+  duration = "45s"
+
+  depends_on = [zedamigo_veth.sink]
+}
+
+# 50 Mbit/s of 1400 bytes UDP packets marked EF for 30 seconds.
+resource "zedamigo_traffic_flow" "ef" {
+  mode           = "send"
+  protocol       = "udp"
+  target_address = "192.0.2.2"
+  port           = zedamigo_traffic_flow.sink.port
+  rate           = "50M"
+  packet_size    = 1400
+  duration       = "30s"
+  dscp           = 46
+}
+
+# Toward the forwarded port of an app instance running a UDP echo server, e.g.
+# `socat UDP-LISTEN:5000,fork PIPE`, measuring the round-trip loss, jitter and
+# time through the EVE-OS data-plane:
+#
+# resource "zedamigo_traffic_flow" "app_echo" {
+#   mode           = "send"
+#   target_address = "127.0.0.1"
+#   port           = zedamigo_edge_node.node.port_forwards["udp/5000"].host_port
+#   rate           = "5M"
+#   duration       = "60s"
+#   echo           = true
+# }
+
+output "sink" {
+  value = {
+    throughput_bps = zedamigo_traffic_flow.sink.throughput_bps
+    loss_percent   = zedamigo_traffic_flow.sink.loss_percent
+    jitter_ms      = zedamigo_traffic_flow.sink.jitter_ms
+    output_file    = zedamigo_traffic_flow.sink.output_file
+  }
+}
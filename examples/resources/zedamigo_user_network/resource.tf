@@ -0,0 +1,35 @@
+resource "zedamigo_user_network" "lab" {
+  subnet = "192.168.127.0/24"
+
+  static_lease {
+    mac = "52:54:00:00:00:01"
+    ip  = "192.168.127.11"
+  }
+
+  static_lease {
+    mac = "52:54:00:00:00:02"
+    ip  = "192.168.127.12"
+  }
+
+  dns_zone {
+    name = "lab.internal."
+    records = {
+      "node1" = "192.168.127.11"
+      "node2" = "192.168.127.12"
+    }
+  }
+
+  # SSH to node1 through localhost:2201.
+  forward {
+    host_addr  = "127.0.0.1"
+    host_port  = 2201
+    guest_ip   = "192.168.127.11"
+    guest_port = 22
+  }
+}
+
+# resource "zedamigo_edge_node" "node1" {
+#   ...
+#   user_network_socket = zedamigo_user_network.lab.socket
+#   nic0_mac            = "52:54:00:00:00:01"
+# }
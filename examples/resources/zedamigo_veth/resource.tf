@@ -0,0 +1,41 @@
+# A simulated ISP router in its own network namespace, with its uplink to a
+# host bridge and its downlink to a LAN namespace.
+resource "zedamigo_netns" "isp" {
+  name = "isp"
+}
+
+resource "zedamigo_netns" "lan" {
+  name = "lan"
+}
+
+resource "zedamigo_bridge" "upstream" {
+  name  = "br-upstream"
+  state = "up"
+}
+
+# Host bridge <-> ISP namespace.
+resource "zedamigo_veth" "isp_uplink" {
+  name   = "v-up-host"
+  master = zedamigo_bridge.upstream.name
+  state  = "up"
+
+  peer_name         = "v-up-isp"
+  peer_netns        = zedamigo_netns.isp.name
+  peer_state        = "up"
+  peer_ipv4_address = "198.51.100.2/24"
+}
+
+# ISP namespace <-> LAN namespace.
+resource "zedamigo_veth" "isp_lan" {
+  name         = "v-isp-lan"
+  netns        = zedamigo_netns.isp.name
+  mtu          = 1400
+  state        = "up"
+  ipv4_address = "192.0.2.1/24"
+
+  peer_name         = "v-lan-isp"
+  peer_netns        = zedamigo_netns.lan.name
+  peer_mtu          = 1400
+  peer_state        = "up"
+  peer_ipv4_address = "192.0.2.2/24"
+}
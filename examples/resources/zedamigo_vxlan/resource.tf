@@ -0,0 +1,27 @@
+# Stretch a lab bridge to a second host (192.0.2.2), which runs the same
+# configuration with `remote` and `local` swapped.
+resource "zedamigo_bridge" "lab" {
+  name  = "br-lab"
+  mtu   = 1450
+  state = "up"
+}
+
+resource "zedamigo_vxlan" "lab" {
+  name   = "vx-lab"
+  vni    = 1000
+  remote = "192.0.2.2"
+  local  = "192.0.2.1"
+  parent = "eth0"
+  master = zedamigo_bridge.lab.name
+  mtu    = 1450
+  state  = "up"
+}
+
+# All the hosts of a multicast group share the segment.
+resource "zedamigo_vxlan" "shared" {
+  name   = "vx-shared"
+  vni    = 2000
+  group  = "239.1.1.1"
+  parent = "eth0"
+  state  = "up"
+}
@@ -0,0 +1,40 @@
+# An encrypted link between two hosts. The other one (203.0.113.2) runs the
+# same configuration with the addresses swapped and the public_key output below
+# in its peer block.
+resource "zedamigo_wireguard" "wg" {
+  name         = "wg-lab"
+  listen_port  = 51820
+  ipv4_address = "10.99.0.1/30"
+  state        = "up"
+
+  peer {
+    public_key           = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+    endpoint             = "203.0.113.2:51820"
+    allowed_ips          = ["10.99.0.2/32"]
+    persistent_keepalive = 25
+  }
+}
+
+output "wireguard_public_key" {
+  value = zedamigo_wireguard.wg.public_key
+}
+
+# WireGuard is layer 3: stretch a lab bridge over it with a VXLAN between the
+# tunnel addresses.
+resource "zedamigo_bridge" "lab" {
+  name  = "br-lab"
+  mtu   = 1370
+  state = "up"
+}
+
+resource "zedamigo_vxlan" "lab" {
+  name   = "vx-lab"
+  vni    = 1000
+  remote = "10.99.0.2"
+  local  = "10.99.0.1"
+  master = zedamigo_bridge.lab.name
+  mtu    = 1370
+  state  = "up"
+
+  depends_on = [zedamigo_wireguard.wg]
+}
@@ -4,9 +4,27 @@ package hypervisor
 
 import (
 	"fmt"
+	"net"
 	"strings"
 )
 
+const (
+	// SLIRPIPv6Net is the IPv6 prefix QEMU SLIRP advertises to the guest when
+	// nic0 IPv6 is enabled. A ULA prefix is used instead of QEMU's default
+	// (deprecated site-local) fec0::/64. gvproxy ("-gp.ipv6") serves the same
+	// prefix and gateway address.
+	SLIRPIPv6Net = "fd00:7a65:6461::/64"
+	// SLIRPIPv6Host is the SLIRP gateway address inside SLIRPIPv6Net.
+	SLIRPIPv6Host = "fd00:7a65:6461::2"
+
+	// GvproxyGuestIP is the address the per-VM gvproxy hands out to the VM.
+	GvproxyGuestIP = "192.168.127.2"
+	// GvproxyControlSocket is the name, inside the VM resource directory, of
+	// the UNIX socket serving the gvproxy HTTP control API. Forwards can be
+	// added and removed there while the VM runs (zedamigo_port_expose).
+	GvproxyControlSocket = "gvproxy-control.sock"
+)
+
 // StandardForward describes one of the standard host->guest TCP port forwards
 // configured for an edge node's first NIC (nic0). The host port is the base SSH
 // port plus HostOffset; GuestPort is the port inside the guest (EVE-OS).
@@ -26,15 +44,101 @@ var StandardForwards = []StandardForward{
 	{HostOffset: 2, GuestPort: 10080},
 }
 
+// PortForward is a user-defined host->guest port forward for nic0, added on
+// top of the StandardForwards. Protocol is "tcp" or "udp". An empty HostAddr
+// binds on all host addresses; it may also be an IPv4 or IPv6 literal.
+// HostPort must already be resolved (non-zero).
+type PortForward struct {
+	Protocol  string
+	HostAddr  string
+	HostPort  int
+	GuestPort int
+}
+
+// protocol returns the forward protocol, defaulting to "tcp".
+func (f PortForward) protocol() string {
+	if f.Protocol == "" {
+		return "tcp"
+	}
+	return f.Protocol
+}
+
+// isIPv6Literal reports whether addr is an IPv6 address literal.
+func isIPv6Literal(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() == nil
+}
+
+// bracketHost wraps an IPv6 literal in square brackets for use in host:port
+// strings; other addresses are returned unchanged.
+func bracketHost(addr string) string {
+	if isIPv6Literal(addr) {
+		return "[" + addr + "]"
+	}
+	return addr
+}
+
+// slirpHostFwds renders the forward as QEMU SLIRP "hostfwd=" options. With
+// ipv6 enabled a forward bound on all host addresses gets a second rule
+// listening on the IPv6 wildcard address.
+func (f PortForward) slirpHostFwds(ipv6 bool) []string {
+	fwds := []string{fmt.Sprintf("hostfwd=%s:%s:%d-:%d", f.protocol(), bracketHost(f.HostAddr), f.HostPort, f.GuestPort)}
+	if ipv6 && f.HostAddr == "" {
+		fwds = append(fwds, fmt.Sprintf("hostfwd=%s:[::]:%d-:%d", f.protocol(), f.HostPort, f.GuestPort))
+	}
+	return fwds
+}
+
+// gvproxyForward renders the forward as one "-gp.forwards" entry. gvproxy
+// treats a "udp:" prefix on the local address as a UDP forward. With ipv6
+// enabled a forward bound on all host addresses listens on the dual-stack
+// "[::]" wildcard instead of "0.0.0.0".
+func (f PortForward) gvproxyForward(guestIP string, ipv6 bool) string {
+	hostAddr := bracketHost(f.HostAddr)
+	if hostAddr == "" {
+		hostAddr = gvproxyWildcard(ipv6)
+	}
+	prefix := ""
+	if f.protocol() == "udp" {
+		prefix = "udp:"
+	}
+	return fmt.Sprintf("%s%s:%d/%s:%d", prefix, hostAddr, f.HostPort, guestIP, f.GuestPort)
+}
+
+// gvproxyWildcard returns the host address gvproxy forwards bind on by
+// default. gvproxy listens with Go's "tcp"/"udp" networks, so "[::]" yields a
+// single dual-stack listener that accepts both IPv4 and IPv6 connections.
+func gvproxyWildcard(ipv6 bool) string {
+	if ipv6 {
+		return "[::]"
+	}
+	return "0.0.0.0"
+}
+
+// slirpNic0Prefix returns the leading "-nic user" options, with SLIRP IPv6
+// either disabled or enabled on SLIRPIPv6Net.
+func slirpNic0Prefix(ipv6 bool) string {
+	if ipv6 {
+		return fmt.Sprintf("user,id=usernet0,ipv6=on,ipv6-net=%s,ipv6-host=%s,", SLIRPIPv6Net, SLIRPIPv6Host)
+	}
+	return "user,id=usernet0,ipv6=off,"
+}
+
 // SLIRPNic0 builds the default QEMU "-nic" user-mode networking string for the
-// given base SSH port, including the StandardForwards host forwards. It is the
+// given base SSH port, including the StandardForwards host forwards followed by
+// any extra user-defined forwards. With ipv6 enabled SLIRP also provides IPv6
+// on SLIRPIPv6Net and every forward is reachable over IPv6 on the host too
+// (this needs a QEMU whose SLIRP hostfwd accepts IPv6 addresses). It is the
 // single source for what was previously the nic0Fmt constant.
-func SLIRPNic0(sshPort int32) string {
-	parts := make([]string, 0, len(StandardForwards))
+func SLIRPNic0(sshPort int32, ipv6 bool, extra ...PortForward) string {
+	parts := make([]string, 0, 2*(len(StandardForwards)+len(extra)))
 	for _, f := range StandardForwards {
-		parts = append(parts, fmt.Sprintf("hostfwd=tcp::%d-:%d", int(sshPort)+f.HostOffset, f.GuestPort))
+		parts = append(parts, PortForward{HostPort: int(sshPort) + f.HostOffset, GuestPort: f.GuestPort}.slirpHostFwds(ipv6)...)
 	}
-	return "user,id=usernet0,ipv6=off," + strings.Join(parts, ",") + ",model=virtio"
+	for _, f := range extra {
+		parts = append(parts, f.slirpHostFwds(ipv6)...)
+	}
+	return slirpNic0Prefix(ipv6) + strings.Join(parts, ",") + ",model=virtio"
 }
 
 // SLIRPNic0Doc renders the default nic0 string with symbolic host ports
@@ -53,32 +157,45 @@ func SLIRPNic0Doc() string {
 }
 
 // GvproxyForwards builds the comma-separated value for gvproxy's "-gp.forwards"
-// flag, mapping host 0.0.0.0:<port> to <guestIP>:<guestPort> for each standard
-// forward derived from the base SSH port.
-func GvproxyForwards(sshPort int32, guestIP string) string {
-	parts := make([]string, 0, len(StandardForwards))
+// flag, mapping host 0.0.0.0:<port> (or the dual-stack [::]:<port> with ipv6
+// enabled) to <guestIP>:<guestPort> for each standard forward derived from the
+// base SSH port, followed by any extra user-defined forwards. The guest side
+// of the forwards stays on IPv4.
+func GvproxyForwards(sshPort int32, guestIP string, ipv6 bool, extra ...PortForward) string {
+	parts := make([]string, 0, len(StandardForwards)+len(extra))
 	for _, f := range StandardForwards {
-		parts = append(parts, fmt.Sprintf("0.0.0.0:%d/%s:%d", int(sshPort)+f.HostOffset, guestIP, f.GuestPort))
+		parts = append(parts, PortForward{HostPort: int(sshPort) + f.HostOffset, GuestPort: f.GuestPort}.gvproxyForward(guestIP, ipv6))
+	}
+	for _, f := range extra {
+		parts = append(parts, f.gvproxyForward(guestIP, ipv6))
 	}
 	return strings.Join(parts, ",")
 }
 
 // DescribePortForwards returns a human-readable, one-line description of the
 // standard host->guest TCP port forwards configured for the default nic0, e.g.
-// "tcp/127.0.0.1:50277->:22, tcp/127.0.0.1:50278->:10022, tcp/127.0.0.1:50279->:10080".
-// host is the address at which the forwards are reachable: for a local target
+// "tcp/127.0.0.1:50277->:22, tcp/127.0.0.1:50278->:10022, tcp/127.0.0.1:50279->:10080",
+// followed by any extra user-defined forwards (shown at their own HostAddr
+// when it is a specific address). host is the address at which the forwards are reachable: for a local target
 // that is 127.0.0.1; for a remote (SSH) target the forwards bind on the remote
 // host, so its address is shown (reach them at <host>:<port> from elsewhere, or
 // tunnel with your own `ssh -L`). The guest IP is omitted because it differs by
 // networking backend (SLIRP DHCP vs gvproxy 192.168.127.2) and is irrelevant
 // from the host's point of view.
-func DescribePortForwards(host string, sshPort int32) string {
+func DescribePortForwards(host string, sshPort int32, extra ...PortForward) string {
 	if host == "" || host == "localhost" {
 		host = "127.0.0.1"
 	}
-	parts := make([]string, 0, len(StandardForwards))
+	parts := make([]string, 0, len(StandardForwards)+len(extra))
 	for _, f := range StandardForwards {
 		parts = append(parts, fmt.Sprintf("tcp/%s:%d->:%d", host, int(sshPort)+f.HostOffset, f.GuestPort))
 	}
+	for _, f := range extra {
+		addr := host
+		if f.HostAddr != "" && f.HostAddr != "0.0.0.0" {
+			addr = f.HostAddr
+		}
+		parts = append(parts, fmt.Sprintf("%s/%s:%d->:%d", f.protocol(), bracketHost(addr), f.HostPort, f.GuestPort))
+	}
 	return strings.Join(parts, ", ")
 }
@@ -22,7 +22,7 @@ func TestStandardForwards(t *testing.T) {
 func TestSLIRPNic0(t *testing.T) {
 	is := is.New(t)
 	// Must reproduce the historical nic0Fmt output byte-for-byte.
-	is.Equal(SLIRPNic0(50277),
+	is.Equal(SLIRPNic0(50277, false),
 		"user,id=usernet0,ipv6=off,hostfwd=tcp::50277-:22,hostfwd=tcp::50278-:10022,hostfwd=tcp::50279-:10080,model=virtio")
 }
 
@@ -35,7 +35,7 @@ func TestSLIRPNic0Doc(t *testing.T) {
 func TestGvproxyForwards(t *testing.T) {
 	is := is.New(t)
 	// Must reproduce the historical inline gvproxy forwards from qemu.go / vfkit.go.
-	is.Equal(GvproxyForwards(50277, "192.168.127.2"),
+	is.Equal(GvproxyForwards(50277, "192.168.127.2", false),
 		"0.0.0.0:50277/192.168.127.2:22,0.0.0.0:50278/192.168.127.2:10022,0.0.0.0:50279/192.168.127.2:10080")
 }
 
@@ -48,3 +48,38 @@ func TestDescribePortForwards(t *testing.T) {
 	is.Equal(DescribePortForwards("192.168.1.10", 50277),
 		"tcp/192.168.1.10:50277->:22, tcp/192.168.1.10:50278->:10022, tcp/192.168.1.10:50279->:10080")
 }
+
+func TestExtraPortForwards(t *testing.T) {
+	is := is.New(t)
+	extra := []PortForward{
+		{Protocol: "tcp", HostPort: 18080, GuestPort: 8080},
+		{Protocol: "udp", HostAddr: "127.0.0.1", HostPort: 15000, GuestPort: 5000},
+	}
+	is.Equal(SLIRPNic0(50277, false, extra...),
+		"user,id=usernet0,ipv6=off,hostfwd=tcp::50277-:22,hostfwd=tcp::50278-:10022,hostfwd=tcp::50279-:10080,"+
+			"hostfwd=tcp::18080-:8080,hostfwd=udp:127.0.0.1:15000-:5000,model=virtio")
+	is.Equal(GvproxyForwards(50277, "192.168.127.2", false, extra...),
+		"0.0.0.0:50277/192.168.127.2:22,0.0.0.0:50278/192.168.127.2:10022,0.0.0.0:50279/192.168.127.2:10080,"+
+			"0.0.0.0:18080/192.168.127.2:8080,udp:127.0.0.1:15000/192.168.127.2:5000")
+	is.Equal(DescribePortForwards("", 50277, extra...),
+		"tcp/127.0.0.1:50277->:22, tcp/127.0.0.1:50278->:10022, tcp/127.0.0.1:50279->:10080, "+
+			"tcp/127.0.0.1:18080->:8080, udp/127.0.0.1:15000->:5000")
+}
+
+func TestNic0IPv6(t *testing.T) {
+	is := is.New(t)
+	extra := []PortForward{
+		{Protocol: "udp", HostPort: 15000, GuestPort: 5000},
+		{Protocol: "tcp", HostAddr: "::1", HostPort: 18080, GuestPort: 8080},
+	}
+	is.Equal(SLIRPNic0(50277, true, extra...),
+		"user,id=usernet0,ipv6=on,ipv6-net=fd00:7a65:6461::/64,ipv6-host=fd00:7a65:6461::2,"+
+			"hostfwd=tcp::50277-:22,hostfwd=tcp:[::]:50277-:22,"+
+			"hostfwd=tcp::50278-:10022,hostfwd=tcp:[::]:50278-:10022,"+
+			"hostfwd=tcp::50279-:10080,hostfwd=tcp:[::]:50279-:10080,"+
+			"hostfwd=udp::15000-:5000,hostfwd=udp:[::]:15000-:5000,"+
+			"hostfwd=tcp:[::1]:18080-:8080,model=virtio")
+	is.Equal(GvproxyForwards(50277, "192.168.127.2", true, extra...),
+		"[::]:50277/192.168.127.2:22,[::]:50278/192.168.127.2:10022,[::]:50279/192.168.127.2:10080,"+
+			"udp:[::]:15000/192.168.127.2:5000,[::1]:18080/192.168.127.2:8080")
+}
@@ -35,6 +35,12 @@ type DiskConfig struct {
 	Options []string
 }
 
+// VMConfig.BootNetwork values.
+const (
+	BootNetworkAlways = "always"
+	BootNetworkOnce   = "once"
+)
+
 // VMConfig contains all configuration needed to prepare and start a VM.
 type VMConfig struct {
 	Name        string
@@ -52,20 +58,47 @@ type VMConfig struct {
 
 	Nic0 string
 
+	// MacvtapNics are NICs on macvtap interfaces, added after nic0. QEMU-only.
+	MacvtapNics []MacvtapNic
+
 	SSHPort int32
 
+	// PortForwards are user-defined nic0 forwards added after the
+	// StandardForwards, for both SLIRP and gvproxy networking.
+	PortForwards []PortForward
+
+	// Nic0IPv6 enables IPv6 on the default nic0: SLIRP and gvproxy both serve
+	// SLIRPIPv6Net to the guest and make the host forwards listen on IPv6 too.
+	Nic0IPv6 bool
+
 	SwTPMSocket string
 
 	SerialToFile   string // file path for serial output
 	SerialToSocket string // socket path for serial server
 	SerialType     string // "virtio" (default) or "serial" (emulated ISA)
 
+	// RTCBase is the QEMU `-rtc base=` value, e.g. "utc" or
+	// "2029-01-02T03:04:05", empty for the QEMU default. QEMU-only.
+	RTCBase string
+
+	// BootNetwork makes nic0 the first boot device, of every boot
+	// (BootNetworkAlways) or of the first one only (BootNetworkOnce). Empty
+	// for the default order, the disks first. QEMU-only.
+	BootNetwork string
+
 	ExtraArgs []string
 	CPUPins   []int64
 
 	// Use embedded gvproxy instead of QEMU SLIRP for networking.
 	UseGvproxy bool
 
+	// UserNetworkSocket connects nic0 to an already running, shared gvproxy
+	// (zedamigo_user_network) instead of starting a per-VM one. QEMU-only.
+	UserNetworkSocket string
+	// Nic0MAC is the nic0 MAC address used on a shared user network, where
+	// every VM needs its own.
+	Nic0MAC string
+
 	// For installed_edge_node:
 	InstallerISO   string
 	InstallerRaw   string
@@ -104,4 +137,9 @@ type Hypervisor interface {
 	// ApplyCPUPins pins vCPU threads to host CPUs. Must be called after the VM
 	// process is fully started (i.e., after serial socket clients have connected).
 	ApplyCPUPins(ctx context.Context, conf VMConfig) error
+
+	// ApplyBootOrder makes nic0 the first boot device and lets the guest run
+	// when the VM was started for a network boot. Must be called after the VM
+	// process is fully started, like ApplyCPUPins.
+	ApplyBootOrder(ctx context.Context, conf VMConfig) error
 }
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package hypervisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MacvtapNic is a VM NIC on a macvtap interface. QEMU can't open a macvtap
+// by name like a TAP, it needs the tap character device of the interface
+// (/dev/tap<ifindex>) opened on a file descriptor it inherits.
+type MacvtapNic struct {
+	// Device is the tap character device, e.g. "/dev/tap12".
+	Device string
+	// MAC must be the MAC address of the macvtap interface, the kernel only
+	// passes the frames for that address to the VM.
+	MAC string
+	// Model is the QEMU NIC model, "virtio" when empty.
+	Model string
+}
+
+// macvtapFirstFD is the file descriptor of the first macvtap NIC, the next
+// ones follow in order.
+const macvtapFirstFD = 3
+
+// macvtapNicArgs returns the QEMU "-nic" arguments of nics, using the file
+// descriptors opened by macvtapRedirects.
+func macvtapNicArgs(nics []MacvtapNic) []string {
+	var args []string
+	for i, n := range nics {
+		model := n.Model
+		if model == "" {
+			model = "virtio"
+		}
+		args = append(args, "-nic", fmt.Sprintf("tap,id=macvtap%d,fd=%d,model=%s,mac=%s", i, macvtapFirstFD+i, model, n.MAC))
+	}
+	return args
+}
+
+// macvtapRedirects returns the shell redirections opening the tap devices of
+// nics read-write on their file descriptors.
+func macvtapRedirects(nics []MacvtapNic) []string {
+	var redirs []string
+	for i, n := range nics {
+		redirs = append(redirs, fmt.Sprintf("%d<>%s", macvtapFirstFD+i, n.Device))
+	}
+	return redirs
+}
+
+// macvtapCommand returns the command starting qemuPath with qemuArgs. With
+// macvtap NICs it goes through `sh`, which opens the tap devices and then
+// execs QEMU, so the PID (file) is still the one of QEMU.
+func macvtapCommand(qemuPath string, qemuArgs []string, nics []MacvtapNic) (string, []string) {
+	if len(nics) == 0 {
+		return qemuPath, qemuArgs
+	}
+	script := `exec "$0" "$@" ` + strings.Join(macvtapRedirects(nics), " ")
+	return "/bin/sh", append([]string{"-c", script, qemuPath}, qemuArgs...)
+}
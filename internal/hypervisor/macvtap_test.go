@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package hypervisor
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestMacvtapNicArgs(t *testing.T) {
+	is := is.New(t)
+
+	nics := []MacvtapNic{
+		{Device: "/dev/tap12", MAC: "02:00:00:00:00:01"},
+		{Device: "/dev/tap13", MAC: "02:00:00:00:00:02", Model: "e1000"},
+	}
+	is.Equal(macvtapNicArgs(nics), []string{
+		"-nic", "tap,id=macvtap0,fd=3,model=virtio,mac=02:00:00:00:00:01",
+		"-nic", "tap,id=macvtap1,fd=4,model=e1000,mac=02:00:00:00:00:02",
+	})
+	is.Equal(macvtapRedirects(nics), []string{"3<>/dev/tap12", "4<>/dev/tap13"})
+
+	cmd, args := macvtapCommand("/usr/bin/qemu-system-x86_64", []string{"-m", "4G"}, nics)
+	is.Equal(cmd, "/bin/sh")
+	is.Equal(args, []string{"-c", `exec "$0" "$@" 3<>/dev/tap12 4<>/dev/tap13`, "/usr/bin/qemu-system-x86_64", "-m", "4G"})
+
+	// Without macvtap NICs QEMU is started directly.
+	cmd, args = macvtapCommand("/usr/bin/qemu-system-x86_64", []string{"-m", "4G"}, nil)
+	is.Equal(cmd, "/usr/bin/qemu-system-x86_64")
+	is.Equal(args, []string{"-m", "4G"})
+}
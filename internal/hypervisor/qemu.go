@@ -41,19 +41,41 @@ func (h *QEMUHypervisor) qmpDialer(timeout time.Duration) qmp.DialFunc {
 	}
 }
 
+// QMPExecute runs a single QMP command on the QEMU monitor socket at
+// socketPath (dialed through the executor) and returns the raw response.
+func QMPExecute(ctx context.Context, ex exec.Executor, socketPath string, cmd qmp.Command) ([]byte, error) {
+	mon, err := qmp.NewSocketMonitorWithDialer(ctx, "unix", socketPath,
+		func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return ex.Dial(ctx, network, addr, 2*time.Second)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("can't create QMP monitor: %w", err)
+	}
+	if err := mon.Connect(); err != nil {
+		return nil, fmt.Errorf("can't QMP connect: %w", err)
+	}
+	defer mon.Disconnect()
+
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return mon.Run(raw)
+}
+
 const (
-	qemuGvproxyGuestIP      = "192.168.127.2"
+	qemuGvproxyGuestIP      = GvproxyGuestIP
 	qemuGvproxyMAC          = "5a:94:ef:e4:0c:ee"
 	qemuGvproxyPollInterval = 100 * time.Millisecond
 	qemuGvproxyPollTimeout  = 3 * time.Second
 
 	// swtpmSocketWaitTimeout caps how long Start waits for the swtpm control
 	// socket to accept a connection before launching QEMU. The swtpm process
-	// exits every time an attached VM shuts down and its process monitor only
+	// exits every time an attached VM shuts down and its supervisor only
 	// restarts it about a second later, so a VM started right after another
 	// one released the same vTPM (the installer -> installed node sequence)
 	// would otherwise race the restart. The timeout is generous because the
-	// monitor backs off after repeated swtpm failures.
+	// supervisor backs off after repeated swtpm failures.
 	swtpmSocketWaitTimeout  = 30 * time.Second
 	swtpmSocketWaitInterval = 200 * time.Millisecond
 )
@@ -94,13 +116,17 @@ func (h *QEMUHypervisor) startGvproxy(ctx context.Context, conf VMConfig) (strin
 	pidFile := filepath.Join(d, "gvproxy.pid")
 
 	// Build comma-separated forwards string from the shared definition.
-	forwardStr := GvproxyForwards(conf.SSHPort, qemuGvproxyGuestIP)
+	forwardStr := GvproxyForwards(conf.SSHPort, qemuGvproxyGuestIP, conf.Nic0IPv6, conf.PortForwards...)
 
 	args := []string{
 		"-pid-file", pidFile,
 		"-gvproxy",
 		"-gp.listen-qemu", fmt.Sprintf("unix://%s", socketPath),
 		"-gp.forwards", forwardStr,
+		"-gp.control", filepath.Join(d, GvproxyControlSocket),
+	}
+	if conf.Nic0IPv6 {
+		args = append(args, "-gp.ipv6")
 	}
 
 	tflog.Debug(ctx, "Starting gvproxy for QEMU (self-invoke)", map[string]any{"args": args})
@@ -248,6 +274,13 @@ func (h *QEMUHypervisor) Start(ctx context.Context, conf VMConfig, paths VMPaths
 		"-device", "intel-iommu,intremap=on,caching-mode=on,device-iotlb=on",
 		"-smbios", fmt.Sprintf("type=1,serial=%s,manufacturer=Dell Inc.,product=ProLiant 100 with 2 disks", conf.SerialNo),
 	)
+	if conf.RTCBase != "" {
+		qemuArgs = append(qemuArgs, "-rtc", "base="+conf.RTCBase)
+	}
+	if conf.BootNetwork != "" && !conf.IsInstallation {
+		// Paused until ApplyBootOrder has set the bootindex of nic0.
+		qemuArgs = append(qemuArgs, "-S")
+	}
 
 	// Serial console.
 	if conf.SerialType == "serial" {
@@ -280,8 +313,16 @@ func (h *QEMUHypervisor) Start(ctx context.Context, conf VMConfig, paths VMPaths
 		"-drive", fmt.Sprintf("if=pflash,format=raw,file=%s", paths.OVMFVars),
 	)
 
-	// NIC: use gvproxy stream transport when enabled, otherwise SLIRP.
-	if conf.UseGvproxy && !conf.IsInstallation && conf.SSHPort != 0 {
+	// NIC: use gvproxy stream transport when enabled, otherwise SLIRP. A
+	// shared user network is the same stream transport, to a gvproxy that is
+	// managed outside of this VM.
+	if conf.UserNetworkSocket != "" && !conf.IsInstallation {
+		qemuArgs = append(qemuArgs,
+			"-netdev", fmt.Sprintf("stream,id=usernet0,addr.type=unix,addr.path=%s", conf.UserNetworkSocket),
+			"-netdev", "hubport,id=usernet0hub,hubid=0,netdev=usernet0",
+			"-nic", fmt.Sprintf("hubport,hubid=0,model=virtio,mac=%s", conf.Nic0MAC),
+		)
+	} else if conf.UseGvproxy && !conf.IsInstallation && conf.SSHPort != 0 {
 		gvSocketPath, gvErr := h.startGvproxy(ctx, conf)
 		if gvErr != nil {
 			return fmt.Errorf("start gvproxy: %w", gvErr)
@@ -304,6 +345,14 @@ func (h *QEMUHypervisor) Start(ctx context.Context, conf VMConfig, paths VMPaths
 		qemuArgs = append(qemuArgs, "-nic", conf.Nic0)
 	}
 
+	// NICs on macvtap interfaces, right after nic0. The tap devices are
+	// opened by the launching shell, see macvtapCommand.
+	var macvtapNics []MacvtapNic
+	if !conf.IsInstallation {
+		macvtapNics = conf.MacvtapNics
+		qemuArgs = append(qemuArgs, macvtapNicArgs(macvtapNics)...)
+	}
+
 	// Disk drives (slot order: disk0, disk1, ...).
 	for i, disk := range conf.Disks {
 		driveParts := []string{
@@ -362,7 +411,8 @@ set -eu;
 
 %s %s
 `
-	blob := []byte(fmt.Sprintf(startVMscript, qemuArgs, h.QemuPath, strings.Join(qemuArgs, " ")))
+	scriptArgs := append(append([]string{}, qemuArgs...), macvtapRedirects(macvtapNics)...)
+	blob := []byte(fmt.Sprintf(startVMscript, qemuArgs, h.QemuPath, strings.Join(scriptArgs, " ")))
 	if err := h.Exec.WriteFile(ctx, paths.DebugScript, blob, 0o755); err != nil {
 		tflog.Debug(ctx, "Failed to write start VM script", map[string]any{"error": err})
 	}
@@ -375,7 +425,8 @@ set -eu;
 			return fmt.Errorf("failed to run QEMU VM for installing EVE-OS: %w; %s", err, res.Stderr)
 		}
 	} else {
-		res, err := h.Exec.RunDetached(ctx, d, h.QemuPath, qemuArgs...)
+		qemuCmd, args := macvtapCommand(h.QemuPath, qemuArgs, macvtapNics)
+		res, err := h.Exec.RunDetached(ctx, d, qemuCmd, args...)
 		if err != nil {
 			return fmt.Errorf("failed to start QEMU VM: %w; %s", err, res.Stderr)
 		}
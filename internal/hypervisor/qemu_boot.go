@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package hypervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/qmp"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// OVMF ignores the QEMU `-boot order=/once=` options (they only set the CMOS
+// of the legacy BIOS), it follows the fw_cfg "bootorder" file built from the
+// `bootindex` device properties instead, and moves the listed devices to the
+// front of the BootOrder variable that it keeps in its NVRAM. A `-nic` can't
+// have a bootindex, so with a network boot QEMU starts paused and the
+// bootindex of nic0 is set through QMP. QEMU rebuilds the bootorder file on
+// every reset, a `system_reset` before the guest runs makes it effective.
+
+// qemuBlockDrivers are the QEMU disk device types that get a bootindex after a
+// network boot once.
+var qemuBlockDrivers = map[string]bool{
+	"ide-hd":         true,
+	"scsi-hd":        true,
+	"virtio-blk-pci": true,
+	"nvme":           true,
+}
+
+// qemuQOMDeviceContainers are the QOM containers of the devices created by
+// -nic and -drive, which have no id.
+var qemuQOMDeviceContainers = []string{"/machine/unattached", "/machine/peripheral-anon"}
+
+// qemuNICDriver returns the QEMU device type of a NIC of the given `-nic`
+// model, the q35 default when empty.
+func qemuNICDriver(model string) string {
+	switch model {
+	case "":
+		return "e1000e"
+	case "virtio":
+		return "virtio-net-pci"
+	}
+	return model
+}
+
+// qemuNic0Driver returns the QEMU device type of nic0.
+func qemuNic0Driver(conf VMConfig) string {
+	if conf.UserNetworkSocket != "" || (conf.UseGvproxy && conf.SSHPort != 0) {
+		return qemuNICDriver("virtio")
+	}
+	for _, opt := range strings.Split(conf.Nic0, ",") {
+		if v, ok := strings.CutPrefix(opt, "model="); ok {
+			return qemuNICDriver(v)
+		}
+	}
+	return qemuNICDriver("")
+}
+
+// qomDevice is a device found in a QOM container.
+type qomDevice struct {
+	Path   string
+	Driver string
+	index  int
+}
+
+// qomDevices returns the `device[N]` children of the QOM container from its
+// `qom-list` response, in creation (N) order.
+func qomDevices(container string, raw []byte) ([]qomDevice, error) {
+	var resp struct {
+		Return []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("can't parse qom-list response: %w", err)
+	}
+
+	var devs []qomDevice
+	for _, p := range resp.Return {
+		n, ok := strings.CutPrefix(p.Name, "device[")
+		if !ok || !strings.HasSuffix(n, "]") {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimSuffix(n, "]"))
+		if err != nil {
+			continue
+		}
+		drv, ok := strings.CutPrefix(p.Type, "child<")
+		if !ok {
+			continue
+		}
+		devs = append(devs, qomDevice{
+			Path:   container + "/" + p.Name,
+			Driver: strings.TrimSuffix(drv, ">"),
+			index:  idx,
+		})
+	}
+	sort.Slice(devs, func(i, j int) bool { return devs[i].index < devs[j].index })
+	return devs, nil
+}
+
+// qemuBootDevices returns the QOM path of nic0, the first NIC of its type
+// since the `-nic` devices are created in command line order, and the paths
+// of the disks.
+func qemuBootDevices(devs []qomDevice, nic0Driver string) (string, []string) {
+	nic0 := ""
+	var disks []string
+	for _, d := range devs {
+		if d.Driver == nic0Driver && nic0 == "" {
+			nic0 = d.Path
+		}
+		if qemuBlockDrivers[d.Driver] {
+			disks = append(disks, d.Path)
+		}
+	}
+	return nic0, disks
+}
+
+func (h *QEMUHypervisor) ApplyBootOrder(ctx context.Context, conf VMConfig) (err error) {
+	if conf.IsInstallation || conf.BootNetwork == "" {
+		return nil
+	}
+
+	mon, err := qmp.NewSocketMonitorWithDialer(ctx, "unix", filepath.Join(conf.ResourceDir, "qmp.socket"), h.qmpDialer(2*time.Second))
+	if err != nil {
+		return fmt.Errorf("can't create QMP monitor: %w", err)
+	}
+	if err := mon.Connect(); err != nil {
+		return fmt.Errorf("can't QMP connect: %w", err)
+	}
+	defer mon.Disconnect()
+
+	run := func(cmd qmp.Command) ([]byte, error) {
+		raw, err := json.Marshal(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		res, err := mon.Run(raw)
+		if err != nil {
+			return nil, fmt.Errorf("QMP %s: %w", cmd.Execute, err)
+		}
+		return res, nil
+	}
+	setBootIndex := func(path string, idx int) error {
+		_, err := run(qmp.Command{Execute: "qom-set", Args: map[string]any{
+			"path": path, "property": "bootindex", "value": idx,
+		}})
+		return err
+	}
+
+	// The guest must run even if the boot order can't be changed, it then
+	// boots from the disks as usual.
+	defer func() {
+		if _, cerr := run(qmp.Command{Execute: "cont"}); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	var devs []qomDevice
+	for _, c := range qemuQOMDeviceContainers {
+		raw, err := run(qmp.Command{Execute: "qom-list", Args: map[string]any{"path": c}})
+		if err != nil {
+			return err
+		}
+		d, err := qomDevices(c, raw)
+		if err != nil {
+			return err
+		}
+		devs = append(devs, d...)
+	}
+	driver := qemuNic0Driver(conf)
+	nic0, disks := qemuBootDevices(devs, driver)
+	if nic0 == "" {
+		return fmt.Errorf("can't find the nic0 (%s) device", driver)
+	}
+
+	if err := setBootIndex(nic0, 0); err != nil {
+		return err
+	}
+	if _, err := run(qmp.Command{Execute: "system_reset"}); err != nil {
+		return err
+	}
+	tflog.Debug(ctx, "nic0 is the first boot device", map[string]any{"device": nic0, "boot_network": conf.BootNetwork})
+
+	if conf.BootNetwork == BootNetworkOnce {
+		// The bootorder file of the first boot is already built, the next
+		// one lists the disks only. Without any bootindex OVMF would keep the
+		// BootOrder of the first boot, nic0 first.
+		if err := setBootIndex(nic0, -1); err != nil {
+			return err
+		}
+		for i, d := range disks {
+			if err := setBootIndex(d, i+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
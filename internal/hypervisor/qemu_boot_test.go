@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package hypervisor
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestQemuNic0Driver(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(qemuNic0Driver(VMConfig{Nic0: SLIRPNic0(2222, false)}), "virtio-net-pci")
+	is.Equal(qemuNic0Driver(VMConfig{Nic0: "tap,ifname=tap0,script=no,downscript=no,model=e1000"}), "e1000")
+	is.Equal(qemuNic0Driver(VMConfig{Nic0: "tap,ifname=tap0,script=no,downscript=no"}), "e1000e")
+	is.Equal(qemuNic0Driver(VMConfig{Nic0: "tap,model=e1000", UserNetworkSocket: "/run/gv.sock"}), "virtio-net-pci")
+	is.Equal(qemuNic0Driver(VMConfig{Nic0: "tap,model=e1000", UseGvproxy: true, SSHPort: 2222}), "virtio-net-pci")
+}
+
+func TestQemuBootDevices(t *testing.T) {
+	is := is.New(t)
+
+	unattached := []byte(`{"return": [
+		{"name": "type", "type": "string"},
+		{"name": "device[12]", "type": "child<virtio-net-pci>"},
+		{"name": "device[3]", "type": "child<ide-hd>"},
+		{"name": "device[10]", "type": "child<virtio-net-pci>"},
+		{"name": "device[4]", "type": "child<ide-hd>"},
+		{"name": "sysbus", "type": "child<System>"},
+		{"name": "device[0]", "type": "child<host-x86_64-cpu>"}
+	]}`)
+	anon := []byte(`{"return": [
+		{"name": "device[0]", "type": "child<virtio-blk-pci>"},
+		{"name": "device[1]", "type": "child<tpm-crb>"}
+	]}`)
+
+	devs, err := qomDevices("/machine/unattached", unattached)
+	is.NoErr(err)
+	is.Equal(len(devs), 5)
+	is.Equal(devs[0], qomDevice{Path: "/machine/unattached/device[0]", Driver: "host-x86_64-cpu", index: 0})
+	more, err := qomDevices("/machine/peripheral-anon", anon)
+	is.NoErr(err)
+	devs = append(devs, more...)
+
+	// nic0 is the first NIC, the macvtap NICs come after it.
+	nic0, disks := qemuBootDevices(devs, "virtio-net-pci")
+	is.Equal(nic0, "/machine/unattached/device[10]")
+	is.Equal(disks, []string{"/machine/unattached/device[3]", "/machine/unattached/device[4]",
+		"/machine/peripheral-anon/device[0]"})
+
+	nic0, _ = qemuBootDevices(devs, "e1000e")
+	is.Equal(nic0, "")
+
+	_, err = qomDevices("/machine/unattached", []byte(`{"error": `))
+	is.True(err != nil)
+}
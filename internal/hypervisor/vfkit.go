@@ -51,7 +51,7 @@ func SupportsNestedVirtualization(ctx context.Context, ex exec.Executor, logDir
 }
 
 const (
-	gvproxyGuestIP      = "192.168.127.2"     // gvproxy default DHCP lease
+	gvproxyGuestIP      = GvproxyGuestIP      // gvproxy default DHCP lease
 	gvproxyMAC          = "5a:94:ef:e4:0c:ee" // MAC tied to that DHCP lease
 	gvproxyPollInterval = 100 * time.Millisecond
 	gvproxyPollTimeout  = 3 * time.Second
@@ -158,13 +158,17 @@ func (h *VFKitHypervisor) startGvproxy(ctx context.Context, conf VMConfig) (stri
 	pidFile := filepath.Join(d, "gvproxy.pid")
 
 	// Build comma-separated forwards string from the shared definition.
-	forwardStr := GvproxyForwards(conf.SSHPort, gvproxyGuestIP)
+	forwardStr := GvproxyForwards(conf.SSHPort, gvproxyGuestIP, conf.Nic0IPv6, conf.PortForwards...)
 
 	args := []string{
 		"-pid-file", pidFile,
 		"-gvproxy",
 		"-gp.listen-vfkit", fmt.Sprintf("unixgram://%s", socketPath),
 		"-gp.forwards", forwardStr,
+		"-gp.control", filepath.Join(d, GvproxyControlSocket),
+	}
+	if conf.Nic0IPv6 {
+		args = append(args, "-gp.ipv6")
 	}
 
 	tflog.Debug(ctx, "Starting gvproxy (self-invoke)", map[string]any{"args": args})
@@ -262,6 +266,10 @@ func (h *VFKitHypervisor) Start(ctx context.Context, conf VMConfig, paths VMPath
 		}
 	}
 
+	if conf.UserNetworkSocket != "" {
+		return fmt.Errorf("shared user networks are not supported with vfkit")
+	}
+
 	// Networking: use gvproxy with port forwarding for running VMs,
 	// simple NAT for installation VMs.
 	var socketPath string
@@ -388,6 +396,10 @@ func (h *VFKitHypervisor) ApplyCPUPins(_ context.Context, _ VMConfig) error {
 	return nil
 }
 
+func (h *VFKitHypervisor) ApplyBootOrder(_ context.Context, _ VMConfig) error {
+	return nil
+}
+
 func (h *VFKitHypervisor) Status(ctx context.Context, resourceDir string) (bool, error) {
 	pidFile := filepath.Join(resourceDir, "vfkit.pid")
 	pidBytes, err := h.Exec.ReadFile(ctx, pidFile)
@@ -0,0 +1,355 @@
+// SPDX-License-Identifier: MPL-2.0
+
+// Package nlops describes the link, address, route, rule and network
+// namespace operations of the networking resources as plain data, so that they can be executed
+// with netlink either in-process (Do) or by the provider binary running in
+// `-netlink` mode on the target, which reads a JSON Request and writes back a
+// JSON Response.
+//
+// The operations of a Request are applied in order. When one fails the ones
+// already applied are undone in reverse order (as far as they can be, a
+// deleted link can't be brought back), so a Request is all-or-nothing.
+// Failures carry the kernel errno, which callers match with errors.Is against
+// ErrExist, ErrBusy, ErrNotFound and ErrAddrNotAvail.
+package nlops
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Operation kinds.
+const (
+	// OpLinkAdd creates link Name of type Type.
+	OpLinkAdd = "link_add"
+	// OpLinkDel deletes link Name. Deleting a missing link is not an error.
+	OpLinkDel = "link_del"
+	// OpLinkSet changes the MTU, MAC, Master/NoMaster, the bridge VLAN
+	// options and State of link Name, in that order; zero values are left
+	// alone. Releasing (only NoMaster) a missing link is not an error.
+	OpLinkSet = "link_set"
+	// OpAddrAdd adds address Addr (CIDR) to link Name. Adding an address that
+	// is already configured is not an error.
+	OpAddrAdd = "addr_add"
+	// OpAddrDel removes address Addr (CIDR) from link Name. Removing an
+	// address that isn't configured, or from a missing link, is not an error.
+	OpAddrDel = "addr_del"
+	// OpBridgeVlanAdd adds the VLANs Vlans to bridge port Name, or to the
+	// bridge itself with Self, like `bridge vlan add`. The flags of a VLAN
+	// that is already there are replaced.
+	OpBridgeVlanAdd = "bridge_vlan_add"
+	// OpBridgeVlanDel removes the VLANs Vlans (only their VID matters) from
+	// bridge port Name, or from the bridge itself with Self. Removing a VLAN
+	// that isn't configured, or from a missing link, is not an error.
+	OpBridgeVlanDel = "bridge_vlan_del"
+	// OpWireguardSet configures the WireGuard link Name from the wg(8)
+	// configuration file Config on the target, like `wg setconf`: peers that
+	// aren't in the file are removed. It can't be undone.
+	OpWireguardSet = "wireguard_set"
+	// OpRouteAdd adds route Route, or replaces the route with the same
+	// destination, table and metric, like `ip route replace`. Name only
+	// labels the op in errors, as for the other route and rule ops.
+	OpRouteAdd = "route_add"
+	// OpRouteDel deletes the route with the destination, table and metric
+	// of Route. Deleting a missing route is not an error.
+	OpRouteDel = "route_del"
+	// OpRuleAdd adds the routing policy rule Rule, like `ip rule add`.
+	// Adding a rule that is already there is not an error.
+	OpRuleAdd = "rule_add"
+	// OpRuleDel deletes the routing policy rule Rule. Deleting a missing
+	// rule is not an error.
+	OpRuleDel = "rule_del"
+	// OpNetNSAdd creates the named network namespace Name, like `ip netns
+	// add`. Request.NetNS does not apply to it.
+	OpNetNSAdd = "netns_add"
+	// OpNetNSDel deletes the named network namespace Name. Deleting a
+	// missing namespace is not an error.
+	OpNetNSDel = "netns_del"
+)
+
+// Link types for OpLinkAdd.
+const (
+	TypeBridge  = "bridge"
+	TypeVLAN    = "vlan"
+	TypeBond    = "bond"
+	TypeTAP     = "tap"
+	TypeVeth    = "veth"
+	TypeMacvlan = "macvlan"
+	TypeMacvtap = "macvtap"
+	TypeIPVlan  = "ipvlan"
+	// TypeVXLAN and TypeGretap take their options from Op.Tunnel.
+	TypeVXLAN  = "vxlan"
+	TypeGretap = "gretap"
+	// TypeWireguard links are configured with OpWireguardSet.
+	TypeWireguard = "wireguard"
+)
+
+// Modes of TypeMacvlan and TypeMacvtap links, see ip-link(8).
+var MacvlanModes = []string{"bridge", "vepa", "private", "passthru"}
+
+// Modes of TypeIPVlan links.
+var IPVlanModes = []string{"l2", "l3", "l3s"}
+
+// Bond holds the bonding options of an OpLinkAdd of TypeBond. Empty/zero
+// values keep the kernel defaults.
+type Bond struct {
+	Mode           string `json:"mode,omitempty"`
+	MIIMon         int    `json:"miimon,omitempty"`
+	LACPRate       string `json:"lacp_rate,omitempty"`
+	XmitHashPolicy string `json:"xmit_hash_policy,omitempty"`
+}
+
+// Tunnel holds the options of an OpLinkAdd of TypeVXLAN or TypeGretap. Local
+// and Remote are IP addresses of the underlay, both of the same family.
+type Tunnel struct {
+	// ID is the VNI of a VXLAN, or the key of a gretap (none when 0).
+	ID     int    `json:"id,omitempty"`
+	Remote string `json:"remote,omitempty"`
+	// Group is the multicast group of a VXLAN without a Remote, joined on
+	// Op.Parent.
+	Group string `json:"group,omitempty"`
+	Local string `json:"local,omitempty"`
+	// DstPort is the UDP port of a VXLAN, the kernel default (8472) when 0.
+	DstPort int `json:"dstport,omitempty"`
+	TTL     int `json:"ttl,omitempty"`
+}
+
+// Route is a route of OpRouteAdd and OpRouteDel, and the reported state of
+// one. Dst is a prefix in CIDR format ("0.0.0.0/0" or "::/0" for a default
+// route), which also gives the family of the route.
+type Route struct {
+	Dst     string `json:"dst"`
+	Gateway string `json:"gateway,omitempty"`
+	Dev     string `json:"dev,omitempty"`
+	// Src is the preferred source address.
+	Src    string `json:"src,omitempty"`
+	Metric int    `json:"metric,omitempty"`
+	// Table is the routing table, the main one (254) when 0.
+	Table int `json:"table,omitempty"`
+}
+
+// Rule is a routing policy rule of OpRuleAdd and OpRuleDel, and the reported
+// state of one: packets matching all the selectors are looked up in Table.
+// Empty/zero selectors match anything.
+type Rule struct {
+	// Family is 4 or 6, 4 when 0.
+	Family int `json:"family,omitempty"`
+	// Priority orders the rules, the kernel picks one when negative.
+	Priority int `json:"priority"`
+	// From and To are prefixes in CIDR format.
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	IIF    string `json:"iif,omitempty"`
+	OIF    string `json:"oif,omitempty"`
+	FwMark uint32 `json:"fwmark,omitempty"`
+	// FwMask is the mask of FwMark, all ones when 0.
+	FwMask uint32 `json:"fwmask,omitempty"`
+	Table  int    `json:"table"`
+}
+
+// BridgeVlan is the membership of a bridge port (or of the bridge itself) in
+// a VLAN. PVID marks the VLAN untagged ingress frames are assigned to (at
+// most one per port), Untagged that the VLAN egresses untagged.
+type BridgeVlan struct {
+	VID      int  `json:"vid"`
+	PVID     bool `json:"pvid,omitempty"`
+	Untagged bool `json:"untagged,omitempty"`
+}
+
+// Op is a single operation.
+type Op struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// NetNS is the network namespace of the op, when it differs from the
+	// one of the Request. OpNetNSAdd and OpNetNSDel ignore it.
+	NetNS string `json:"netns,omitempty"`
+
+	// OpLinkAdd.
+	Type string `json:"type,omitempty"`
+	// The parent of TypeVLAN, TypeMacvlan, TypeMacvtap and TypeIPVlan links,
+	// the underlay device of TypeVXLAN and TypeGretap ones.
+	Parent string `json:"parent,omitempty"`
+	// TypeMacvlan, TypeMacvtap, TypeIPVlan, the network namespace of Parent
+	// (the default one when empty). The link is created there and moved into
+	// the namespace of the op.
+	ParentNetNS string  `json:"parent_netns,omitempty"`
+	Mode        string  `json:"mode,omitempty"` // TypeMacvlan, TypeMacvtap, TypeIPVlan
+	VlanID      int     `json:"vlan_id,omitempty"`
+	Bond        *Bond   `json:"bond,omitempty"`
+	Tunnel      *Tunnel `json:"tunnel,omitempty"`
+	Owner       string  `json:"owner,omitempty"` // TypeTAP, user name or UID
+	Group       string  `json:"group,omitempty"` // TypeTAP, group name or GID
+	// TypeVeth, the other end and its network namespace (the default one
+	// when empty).
+	Peer      string `json:"peer,omitempty"`
+	PeerNetNS string `json:"peer_netns,omitempty"`
+
+	// OpLinkSet.
+	MTU      int    `json:"mtu,omitempty"`
+	MAC      string `json:"mac,omitempty"`
+	Master   string `json:"master,omitempty"`
+	NoMaster bool   `json:"no_master,omitempty"`
+	State    string `json:"state,omitempty"` // "up" or "down"
+
+	// OpLinkAdd of TypeBridge, OpLinkSet of a bridge. A DefaultPVID of 0
+	// disables the default PVID.
+	VlanFiltering *bool `json:"vlan_filtering,omitempty"`
+	DefaultPVID   *int  `json:"default_pvid,omitempty"`
+
+	// OpAddrAdd, OpAddrDel.
+	Addr string `json:"addr,omitempty"`
+
+	// OpRouteAdd, OpRouteDel.
+	Route *Route `json:"route,omitempty"`
+	// OpRuleAdd, OpRuleDel.
+	Rule *Rule `json:"rule,omitempty"`
+
+	// OpWireguardSet, the path of the configuration file.
+	Config string `json:"config,omitempty"`
+
+	// OpBridgeVlanAdd, OpBridgeVlanDel.
+	Vlans []BridgeVlan `json:"vlans,omitempty"`
+	Self  bool         `json:"self,omitempty"`
+}
+
+// IsRelease reports whether op only releases link Name from its master, the
+// one OpLinkSet that tolerates a missing link.
+func (op Op) IsRelease() bool {
+	return reflect.DeepEqual(op, Op{Kind: OpLinkSet, Name: op.Name, NoMaster: true})
+}
+
+// InParentNetNS reports whether op adds a link that is created in ParentNetNS,
+// next to its parent.
+func (op Op) InParentNetNS() bool {
+	return op.Kind == OpLinkAdd && (op.Type == TypeMacvlan || op.Type == TypeMacvtap || op.Type == TypeIPVlan)
+}
+
+// Request is a batch of operations, applied in the network namespace NetNS
+// (the current one when empty) unless an Op names its own, followed by an
+// optional report of links in NetNS.
+type Request struct {
+	NetNS string `json:"netns,omitempty"`
+	Ops   []Op   `json:"ops,omitempty"`
+	// Show lists the links to report in Response.Links, after Ops were
+	// applied. A missing link fails the request with ErrNotFound.
+	Show []string `json:"show,omitempty"`
+	// ShowAll reports all the links of NetNS instead, ordered by index.
+	ShowAll bool `json:"show_all,omitempty"`
+	// ShowRoutes reports the routes of all the tables, but the local one,
+	// in Response.Routes; ShowRules the routing policy rules in
+	// Response.Rules. Both families are reported.
+	ShowRoutes bool `json:"show_routes,omitempty"`
+	ShowRules  bool `json:"show_rules,omitempty"`
+}
+
+// Link is the reported state of a link.
+type Link struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	// Type is the kind of the link, e.g. "bridge", "vlan", "bond", "veth",
+	// "tap", or "device" for a physical one (and lo).
+	Type string `json:"type"`
+	MTU  int    `json:"mtu"`
+	// Up is the administrative UP flag.
+	Up bool `json:"up"`
+	// OperState is the operational state, in lower case as `ip` reports
+	// it: "up", "down", "lowerlayerdown", "unknown", ...
+	OperState string `json:"operstate,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+	Master    string `json:"master,omitempty"`
+	// Parent is the link this one is on top of (e.g. of a VLAN), or the
+	// peer of a veth, when it is in the same namespace.
+	Parent string `json:"parent,omitempty"`
+	// VlanID is the VLAN ID of a link of TypeVLAN.
+	VlanID int `json:"vlan_id,omitempty"`
+	// Members are the links enslaved to this one (bridge ports, bond slaves).
+	Members []string `json:"members,omitempty"`
+	// Addrs4 and Addrs6 are the configured addresses in CIDR format; IPv6
+	// link-local addresses are left out.
+	Addrs4 []string `json:"addrs4,omitempty"`
+	Addrs6 []string `json:"addrs6,omitempty"`
+	// VlanFiltering and DefaultPVID are reported for bridges.
+	VlanFiltering *bool `json:"vlan_filtering,omitempty"`
+	DefaultPVID   *int  `json:"default_pvid,omitempty"`
+	// Vlans is the VLAN membership of a bridge port, or of a bridge itself,
+	// ordered by VID.
+	Vlans []BridgeVlan `json:"vlans,omitempty"`
+}
+
+// Response is the result of a Request.
+type Response struct {
+	Links  []Link  `json:"links,omitempty"`
+	Routes []Route `json:"routes,omitempty"`
+	Rules  []Rule  `json:"rules,omitempty"`
+	Error  *Error  `json:"error,omitempty"`
+}
+
+// Err returns the failure of the request, if any.
+func (r Response) Err() error {
+	if r.Error == nil {
+		return nil
+	}
+	return r.Error
+}
+
+// Sentinel errors matched by an *Error.
+var (
+	ErrExist        = errors.New("already exists")
+	ErrBusy         = errors.New("resource busy")
+	ErrNotFound     = errors.New("not found")
+	ErrAddrNotAvail = errors.New("address not available")
+	ErrUnsupported  = errors.New("not supported")
+)
+
+// Error is the failure of the Op at index Op (-1 when it isn't specific to
+// one, e.g. a missing namespace). Errno is the symbolic kernel error, e.g.
+// "EEXIST", when there is one.
+type Error struct {
+	Op    int    `json:"op"`
+	Errno string `json:"errno,omitempty"`
+	Msg   string `json:"msg"`
+}
+
+func (e *Error) Error() string {
+	if e.Errno != "" {
+		return fmt.Sprintf("%s (%s)", e.Msg, e.Errno)
+	}
+	return e.Msg
+}
+
+// Is matches the sentinel errors by errno.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrExist:
+		return e.Errno == "EEXIST"
+	case ErrBusy:
+		return e.Errno == "EBUSY"
+	case ErrNotFound:
+		return e.Errno == "ENODEV" || e.Errno == "ENOENT" || e.Errno == "ESRCH"
+	case ErrAddrNotAvail:
+		return e.Errno == "EADDRNOTAVAIL"
+	case ErrUnsupported:
+		return e.Errno == "EOPNOTSUPP" || e.Errno == "ENOTSUP" || e.Errno == "ENOSYS"
+	}
+	return false
+}
+
+// Marshal encodes a Request for the `-nl.request` flag.
+func (r Request) Marshal() (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("can't encode netlink request: %w", err)
+	}
+	return string(b), nil
+}
+
+// ParseResponse decodes the output of the `-netlink` mode.
+func ParseResponse(out []byte) (Response, error) {
+	var resp Response
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return Response{}, fmt.Errorf("can't decode netlink response %q: %w", string(out), err)
+	}
+	return resp, nil
+}
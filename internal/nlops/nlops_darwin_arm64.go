@@ -0,0 +1,9 @@
+//go:build darwin && arm64
+// +build darwin,arm64
+
+package nlops
+
+// Do always fails: netlink is Linux only.
+func Do(req Request) Response {
+	return Response{Error: &Error{Op: -1, Errno: "EOPNOTSUPP", Msg: "netlink is not supported on macOS (darwin / arm64)"}}
+}
@@ -0,0 +1,1121 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package nlops
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// netnsDir is where named network namespaces are mounted, see ip-netns(8).
+const netnsDir = "/var/run/netns"
+
+// Do executes req with netlink in the current process. It needs
+// CAP_NET_ADMIN (and CAP_SYS_ADMIN for the namespace operations).
+func Do(req Request) Response {
+	handles := make(map[string]*netlink.Handle)
+	handle := func(name string) (*netlink.Handle, error) {
+		if h, ok := handles[name]; ok {
+			return h, nil
+		}
+		var h *netlink.Handle
+		var err error
+		if name == "" {
+			h, err = netlink.NewHandle()
+		} else {
+			var ns netns.NsHandle
+			if ns, err = netns.GetFromName(name); err != nil {
+				return nil, fmt.Errorf("can't open network namespace '%s': %w", name, err)
+			}
+			defer ns.Close()
+			h, err = netlink.NewHandleAt(ns)
+		}
+		if err != nil {
+			return nil, err
+		}
+		handles[name] = h
+		return h, nil
+	}
+	defer func() {
+		for _, h := range handles {
+			h.Close()
+		}
+	}()
+
+	var undo []func() error
+	for i, op := range req.Ops {
+		var u []func() error
+		var err error
+		switch op.Kind {
+		case OpNetNSAdd:
+			u, err = netnsAdd(op.Name)
+		case OpNetNSDel:
+			err = netnsDel(op.Name)
+		default:
+			nsName := req.NetNS
+			if op.NetNS != "" {
+				nsName = op.NetNS
+			}
+			var h *netlink.Handle
+			if h, err = handle(nsName); err == nil {
+				u, err = apply(h, nsName, op, handle)
+			}
+		}
+		undo = append(undo, u...)
+		if err != nil {
+			// Undo what was already applied, including the part of a
+			// failed link_set that went through, the most recent first.
+			for j := len(undo) - 1; j >= 0; j-- {
+				_ = undo[j]()
+			}
+			return Response{Error: newError(i, fmt.Errorf("%s '%s': %w", op.Kind, op.Name, err))}
+		}
+	}
+
+	var resp Response
+	if len(req.Show) == 0 && !req.ShowAll && !req.ShowRoutes && !req.ShowRules {
+		return resp
+	}
+	h, err := handle(req.NetNS)
+	if err != nil {
+		return Response{Error: newError(-1, err)}
+	}
+	names := req.Show
+	if req.ShowAll {
+		if names, err = linkNames(h); err != nil {
+			return Response{Error: newError(-1, err)}
+		}
+	}
+	if len(names) > 0 {
+		if resp.Links, err = show(h, names); err != nil {
+			return Response{Error: newError(-1, err)}
+		}
+	}
+	if req.ShowRoutes {
+		if resp.Routes, err = showRoutes(h); err != nil {
+			return Response{Error: newError(-1, err)}
+		}
+	}
+	if req.ShowRules {
+		if resp.Rules, err = showRules(h); err != nil {
+			return Response{Error: newError(-1, err)}
+		}
+	}
+	return resp
+}
+
+// apply applies a single link or address op, in the network namespace nsName
+// of h, and returns how to undo it. handle opens the other namespaces an op
+// may involve.
+func apply(h *netlink.Handle, nsName string, op Op, handle func(string) (*netlink.Handle, error)) ([]func() error, error) {
+	switch op.Kind {
+	case OpLinkAdd:
+		if op.Type == TypeTAP {
+			if err := inNetNS(nsName, func() error { return tapAdd(op) }); err != nil {
+				return nil, err
+			}
+			return []func() error{func() error { return delLink(h, op.Name) }}, nil
+		}
+		// A link on top of a parent is created in the namespace of the
+		// parent, and moved into nsName right away.
+		addH := h
+		if op.InParentNetNS() && op.ParentNetNS != nsName {
+			var err error
+			if addH, err = handle(op.ParentNetNS); err != nil {
+				return nil, err
+			}
+		}
+		l, err := newLink(addH, op)
+		if err != nil {
+			return nil, err
+		}
+		if addH != h {
+			ns, err := openNetNS(nsName)
+			if err != nil {
+				return nil, err
+			}
+			defer ns.Close()
+			l.Attrs().Namespace = netlink.NsFd(ns)
+		}
+		if veth, ok := l.(*netlink.Veth); ok && op.PeerNetNS != nsName {
+			peerNS, err := openNetNS(op.PeerNetNS)
+			if err != nil {
+				return nil, err
+			}
+			defer peerNS.Close()
+			veth.PeerNamespace = netlink.NsFd(peerNS)
+		}
+		if err := addH.LinkAdd(l); err != nil {
+			return nil, err
+		}
+		return []func() error{func() error { return delLink(h, op.Name) }}, nil
+
+	case OpLinkDel:
+		return nil, delLink(h, op.Name)
+
+	case OpLinkSet:
+		return setLink(h, op)
+
+	case OpBridgeVlanAdd, OpBridgeVlanDel:
+		return bridgeVlans(h, op)
+
+	case OpWireguardSet:
+		return nil, wireguardSet(h, nsName, op)
+
+	case OpRouteAdd, OpRouteDel:
+		return routeOp(h, op)
+
+	case OpRuleAdd, OpRuleDel:
+		return ruleOp(h, op)
+
+	case OpAddrAdd, OpAddrDel:
+		addr, err := netlink.ParseAddr(op.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address '%s': %w", op.Addr, err)
+		}
+		l, err := h.LinkByName(op.Name)
+		if err != nil {
+			if op.Kind == OpAddrDel && isLinkNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if op.Kind == OpAddrAdd {
+			if err := h.AddrAdd(l, addr); err != nil {
+				if errors.Is(err, unix.EEXIST) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			return []func() error{func() error { return h.AddrDel(l, addr) }}, nil
+		}
+		if err := h.AddrDel(l, addr); err != nil {
+			if errors.Is(err, unix.EADDRNOTAVAIL) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []func() error{func() error { return h.AddrAdd(l, addr) }}, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation %q", op.Kind)
+}
+
+func newLink(h *netlink.Handle, op Op) (netlink.Link, error) {
+	attrs := netlink.LinkAttrs{Name: op.Name}
+	switch op.Type {
+	case TypeBridge:
+		br := &netlink.Bridge{LinkAttrs: attrs, VlanFiltering: op.VlanFiltering}
+		if op.DefaultPVID != nil {
+			pvid := uint16(*op.DefaultPVID)
+			br.VlanDefaultPVID = &pvid
+		}
+		return br, nil
+
+	case TypeVLAN:
+		parent, err := h.LinkByName(op.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("parent '%s': %w", op.Parent, err)
+		}
+		attrs.ParentIndex = parent.Attrs().Index
+		return &netlink.Vlan{LinkAttrs: attrs, VlanId: op.VlanID}, nil
+
+	case TypeMacvlan, TypeMacvtap, TypeIPVlan:
+		parent, err := h.LinkByName(op.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("parent '%s': %w", op.Parent, err)
+		}
+		attrs.ParentIndex = parent.Attrs().Index
+		if op.Type == TypeIPVlan {
+			mode, ok := ipvlanModes[op.Mode]
+			if !ok {
+				return nil, fmt.Errorf("unknown ipvlan mode '%s': %w", op.Mode, unix.EINVAL)
+			}
+			return &netlink.IPVlan{LinkAttrs: attrs, Mode: mode}, nil
+		}
+		mode, ok := macvlanModes[op.Mode]
+		if !ok {
+			return nil, fmt.Errorf("unknown %s mode '%s': %w", op.Type, op.Mode, unix.EINVAL)
+		}
+		mv := netlink.Macvlan{LinkAttrs: attrs, Mode: mode}
+		if op.Type == TypeMacvtap {
+			return &netlink.Macvtap{Macvlan: mv}, nil
+		}
+		return &mv, nil
+
+	case TypeVXLAN, TypeGretap:
+		t := Tunnel{}
+		if op.Tunnel != nil {
+			t = *op.Tunnel
+		}
+		parentIndex := 0
+		if op.Parent != "" {
+			parent, err := h.LinkByName(op.Parent)
+			if err != nil {
+				return nil, fmt.Errorf("parent '%s': %w", op.Parent, err)
+			}
+			parentIndex = parent.Attrs().Index
+		}
+		local, err := parseTunnelIP("local", t.Local)
+		if err != nil {
+			return nil, err
+		}
+		remote, err := parseTunnelIP("remote", t.Remote)
+		if err != nil {
+			return nil, err
+		}
+		if op.Type == TypeGretap {
+			if remote == nil {
+				return nil, fmt.Errorf("gretap without a remote: %w", unix.EINVAL)
+			}
+			return &netlink.Gretap{
+				LinkAttrs: attrs, Local: local, Remote: remote, Link: uint32(parentIndex),
+				IKey: uint32(t.ID), OKey: uint32(t.ID), Ttl: uint8(t.TTL), PMtuDisc: 1,
+			}, nil
+		}
+		group, err := parseTunnelIP("group", t.Group)
+		if err != nil {
+			return nil, err
+		}
+		if remote != nil {
+			// The kernel tells the remote from a group by the address.
+			group = remote
+		}
+		return &netlink.Vxlan{
+			LinkAttrs: attrs, VxlanId: t.ID, VtepDevIndex: parentIndex, SrcAddr: local, Group: group,
+			Port: t.DstPort, TTL: t.TTL, Learning: true,
+		}, nil
+
+	case TypeWireguard:
+		return &netlink.Wireguard{LinkAttrs: attrs}, nil
+
+	case TypeVeth:
+		if op.Peer == "" {
+			return nil, fmt.Errorf("veth without a peer name: %w", unix.EINVAL)
+		}
+		return &netlink.Veth{LinkAttrs: attrs, PeerName: op.Peer}, nil
+
+	case TypeBond:
+		b := netlink.NewLinkBond(attrs)
+		if op.Bond != nil {
+			if op.Bond.Mode != "" {
+				if b.Mode = netlink.StringToBondMode(op.Bond.Mode); b.Mode == netlink.BOND_MODE_UNKNOWN {
+					return nil, fmt.Errorf("unknown bond mode '%s': %w", op.Bond.Mode, unix.EINVAL)
+				}
+			}
+			if op.Bond.MIIMon > 0 {
+				b.Miimon = op.Bond.MIIMon
+			}
+			if op.Bond.LACPRate != "" {
+				if b.LacpRate = netlink.StringToBondLacpRate(op.Bond.LACPRate); b.LacpRate == netlink.BOND_LACP_RATE_UNKNOWN {
+					return nil, fmt.Errorf("unknown bond lacp_rate '%s': %w", op.Bond.LACPRate, unix.EINVAL)
+				}
+			}
+			if op.Bond.XmitHashPolicy != "" {
+				if b.XmitHashPolicy = netlink.StringToBondXmitHashPolicy(op.Bond.XmitHashPolicy); b.XmitHashPolicy == netlink.BOND_XMIT_HASH_POLICY_UNKNOWN {
+					return nil, fmt.Errorf("unknown bond xmit_hash_policy '%s': %w", op.Bond.XmitHashPolicy, unix.EINVAL)
+				}
+			}
+		}
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unknown link type %q", op.Type)
+}
+
+// parseTunnelIP parses an optional address of a Tunnel.
+func parseTunnelIP(what, s string) (net.IP, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid %s address '%s': %w", what, s, unix.EINVAL)
+	}
+	return ip, nil
+}
+
+// wireguardSet configures the WireGuard link op.Name of the network namespace
+// nsName from the file op.Config, with a WG_CMD_SET_DEVICE generic netlink
+// request that replaces all the peers, see wg(8) setconf.
+func wireguardSet(h *netlink.Handle, nsName string, op Op) error {
+	text, err := os.ReadFile(op.Config)
+	if err != nil {
+		return fmt.Errorf("can't read WireGuard configuration: %w", err)
+	}
+	conf, err := ParseWireguardConfig(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid WireGuard configuration '%s': %w", op.Config, err)
+	}
+	fam, err := h.GenlFamilyGet(unix.WG_GENL_NAME)
+	if err != nil {
+		return fmt.Errorf("WireGuard generic netlink family: %w", err)
+	}
+
+	req := nl.NewNetlinkRequest(int(fam.ID), unix.NLM_F_ACK)
+	req.AddData(&nl.Genlmsg{Command: unix.WG_CMD_SET_DEVICE, Version: unix.WG_GENL_VERSION})
+	req.AddData(nl.NewRtAttr(unix.WGDEVICE_A_IFNAME, nl.ZeroTerminated(op.Name)))
+	req.AddData(nl.NewRtAttr(unix.WGDEVICE_A_FLAGS, nl.Uint32Attr(unix.WGDEVICE_F_REPLACE_PEERS)))
+	req.AddData(nl.NewRtAttr(unix.WGDEVICE_A_PRIVATE_KEY, wireguardKey(conf.PrivateKey)))
+	if conf.ListenPort > 0 {
+		req.AddData(nl.NewRtAttr(unix.WGDEVICE_A_LISTEN_PORT, nl.Uint16Attr(uint16(conf.ListenPort))))
+	}
+	if len(conf.Peers) > 0 {
+		peers := nl.NewRtAttr(unix.NLA_F_NESTED|unix.WGDEVICE_A_PEERS, nil)
+		for i, p := range conf.Peers {
+			pa := peers.AddRtAttr(unix.NLA_F_NESTED|i, nil)
+			pa.AddRtAttr(unix.WGPEER_A_PUBLIC_KEY, wireguardKey(p.PublicKey))
+			pa.AddRtAttr(unix.WGPEER_A_FLAGS, nl.Uint32Attr(unix.WGPEER_F_REPLACE_ALLOWEDIPS))
+			if p.PresharedKey != "" {
+				pa.AddRtAttr(unix.WGPEER_A_PRESHARED_KEY, wireguardKey(p.PresharedKey))
+			}
+			if p.Endpoint != "" {
+				sa, err := wireguardEndpoint(p.Endpoint)
+				if err != nil {
+					return err
+				}
+				pa.AddRtAttr(unix.WGPEER_A_ENDPOINT, sa)
+			}
+			if p.PersistentKeepalive > 0 {
+				pa.AddRtAttr(unix.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL, nl.Uint16Attr(uint16(p.PersistentKeepalive)))
+			}
+			ips := pa.AddRtAttr(unix.NLA_F_NESTED|unix.WGPEER_A_ALLOWEDIPS, nil)
+			for j, cidr := range p.AllowedIPs {
+				_, ipNet, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return err
+				}
+				family, ip := uint16(unix.AF_INET6), ipNet.IP.To16()
+				if ip4 := ipNet.IP.To4(); ip4 != nil {
+					family, ip = unix.AF_INET, ip4
+				}
+				ones, _ := ipNet.Mask.Size()
+				ia := ips.AddRtAttr(unix.NLA_F_NESTED|j, nil)
+				ia.AddRtAttr(unix.WGALLOWEDIP_A_FAMILY, nl.Uint16Attr(family))
+				ia.AddRtAttr(unix.WGALLOWEDIP_A_IPADDR, ip)
+				ia.AddRtAttr(unix.WGALLOWEDIP_A_CIDR_MASK, nl.Uint8Attr(uint8(ones)))
+			}
+		}
+		req.AddData(peers)
+	}
+
+	// The request applies to the namespace of the socket.
+	return inNetNS(nsName, func() error {
+		_, err := req.Execute(unix.NETLINK_GENERIC, 0)
+		return err
+	})
+}
+
+// wireguardKey decodes a key validated by ParseWireguardConfig.
+func wireguardKey(s string) []byte {
+	k, _ := base64.StdEncoding.DecodeString(s)
+	return k
+}
+
+// wireguardEndpoint resolves a "host:port" endpoint into the struct
+// sockaddr_in or sockaddr_in6 WireGuard expects.
+func wireguardEndpoint(endpoint string) ([]byte, error) {
+	addr, err := net.ResolveUDPAddr("udp", endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint '%s': %w", endpoint, err)
+	}
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, uint16(addr.Port))
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa := make([]byte, unix.SizeofSockaddrInet4)
+		nl.NativeEndian().PutUint16(sa[0:2], unix.AF_INET)
+		copy(sa[2:4], port)
+		copy(sa[4:8], ip4)
+		return sa, nil
+	}
+	sa := make([]byte, unix.SizeofSockaddrInet6)
+	nl.NativeEndian().PutUint16(sa[0:2], unix.AF_INET6)
+	copy(sa[2:4], port)
+	copy(sa[8:24], addr.IP.To16())
+	return sa, nil
+}
+
+// macvlanModes and ipvlanModes map the Op modes, an empty one keeps the
+// kernel default.
+var (
+	macvlanModes = map[string]netlink.MacvlanMode{
+		"":         netlink.MACVLAN_MODE_DEFAULT,
+		"bridge":   netlink.MACVLAN_MODE_BRIDGE,
+		"vepa":     netlink.MACVLAN_MODE_VEPA,
+		"private":  netlink.MACVLAN_MODE_PRIVATE,
+		"passthru": netlink.MACVLAN_MODE_PASSTHRU,
+	}
+	ipvlanModes = map[string]netlink.IPVlanMode{
+		"":    netlink.IPVLAN_MODE_L2,
+		"l2":  netlink.IPVLAN_MODE_L2,
+		"l3":  netlink.IPVLAN_MODE_L3,
+		"l3s": netlink.IPVLAN_MODE_L3S,
+	}
+)
+
+// tapAdd creates a persistent TAP like `ip tuntap add`. netlink's Tuntap
+// always sets an owner and a group, there is no way to leave them unset (only
+// CAP_NET_ADMIN can attach) with it.
+func tapAdd(op Op) error {
+	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("can't open /dev/net/tun: %w", err)
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(op.Name)
+	if err != nil {
+		return err
+	}
+	ifr.SetUint16(unix.IFF_TAP | unix.IFF_NO_PI)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		return fmt.Errorf("TUNSETIFF: %w", err)
+	}
+	// From here on a failure deletes the TAP, it isn't persistent yet.
+
+	if op.Owner != "" {
+		uid, err := lookupID(op.Owner, func(s string) (string, error) {
+			u, err := user.Lookup(s)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("owner '%s': %w", op.Owner, err)
+		}
+		if err := unix.IoctlSetInt(fd, unix.TUNSETOWNER, int(uid)); err != nil {
+			return fmt.Errorf("TUNSETOWNER: %w", err)
+		}
+	}
+	if op.Group != "" {
+		gid, err := lookupID(op.Group, func(s string) (string, error) {
+			g, err := user.LookupGroup(s)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("group '%s': %w", op.Group, err)
+		}
+		if err := unix.IoctlSetInt(fd, unix.TUNSETGROUP, int(gid)); err != nil {
+			return fmt.Errorf("TUNSETGROUP: %w", err)
+		}
+	}
+
+	if err := unix.IoctlSetInt(fd, unix.TUNSETPERSIST, 1); err != nil {
+		return fmt.Errorf("TUNSETPERSIST: %w", err)
+	}
+	return nil
+}
+
+// lookupID resolves a numeric ID or a name.
+func lookupID(s string, byName func(string) (string, error)) (uint32, error) {
+	if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	id, err := byName(s)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err
+}
+
+func isLinkNotFound(err error) bool {
+	var nf netlink.LinkNotFoundError
+	return errors.As(err, &nf)
+}
+
+func delLink(h *netlink.Handle, name string) error {
+	l, err := h.LinkByName(name)
+	if err != nil {
+		if isLinkNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return h.LinkDel(l)
+}
+
+func setLink(h *netlink.Handle, op Op) ([]func() error, error) {
+	l, err := h.LinkByName(op.Name)
+	if err != nil {
+		if isLinkNotFound(err) && op.IsRelease() {
+			return nil, nil
+		}
+		return nil, err
+	}
+	old := *l.Attrs()
+	var undo []func() error
+
+	if op.MTU > 0 && op.MTU != old.MTU {
+		if err := h.LinkSetMTU(l, op.MTU); err != nil {
+			return undo, err
+		}
+		undo = append(undo, func() error { return h.LinkSetMTU(l, old.MTU) })
+	}
+
+	if op.MAC != "" {
+		mac, err := net.ParseMAC(op.MAC)
+		if err != nil {
+			return undo, fmt.Errorf("invalid MAC address '%s': %w", op.MAC, err)
+		}
+		if mac.String() != old.HardwareAddr.String() {
+			if err := h.LinkSetHardwareAddr(l, mac); err != nil {
+				return undo, err
+			}
+			undo = append(undo, func() error { return h.LinkSetHardwareAddr(l, old.HardwareAddr) })
+		}
+	}
+
+	restoreMaster := func() error {
+		if old.MasterIndex == 0 {
+			return h.LinkSetNoMaster(l)
+		}
+		return h.LinkSetMasterByIndex(l, old.MasterIndex)
+	}
+	if op.Master != "" {
+		m, err := h.LinkByName(op.Master)
+		if err != nil {
+			return undo, fmt.Errorf("master '%s': %w", op.Master, err)
+		}
+		if m.Attrs().Index != old.MasterIndex {
+			if err := h.LinkSetMaster(l, m); err != nil {
+				return undo, err
+			}
+			undo = append(undo, restoreMaster)
+		}
+	} else if op.NoMaster && old.MasterIndex != 0 {
+		if err := h.LinkSetNoMaster(l); err != nil {
+			return undo, err
+		}
+		undo = append(undo, restoreMaster)
+	}
+
+	if op.VlanFiltering != nil || op.DefaultPVID != nil {
+		br, ok := l.(*netlink.Bridge)
+		if !ok {
+			return undo, fmt.Errorf("VLAN options on a %s link: %w", l.Type(), unix.EINVAL)
+		}
+		if v := op.VlanFiltering; v != nil && (br.VlanFiltering == nil || *v != *br.VlanFiltering) {
+			if err := h.BridgeSetVlanFiltering(l, *v); err != nil {
+				return undo, err
+			}
+			undo = append(undo, func() error { return h.BridgeSetVlanFiltering(l, !*v) })
+		}
+		if v := op.DefaultPVID; v != nil && (br.VlanDefaultPVID == nil || *v != int(*br.VlanDefaultPVID)) {
+			if err := h.BridgeSetVlanDefaultPVID(l, uint16(*v)); err != nil {
+				return undo, err
+			}
+			if oldPVID := br.VlanDefaultPVID; oldPVID != nil {
+				undo = append(undo, func() error { return h.BridgeSetVlanDefaultPVID(l, *oldPVID) })
+			}
+		}
+	}
+
+	wasUp := old.Flags&net.FlagUp != 0
+	switch op.State {
+	case "up":
+		if !wasUp {
+			if err := h.LinkSetUp(l); err != nil {
+				return undo, err
+			}
+			undo = append(undo, func() error { return h.LinkSetDown(l) })
+		}
+	case "down":
+		if wasUp {
+			if err := h.LinkSetDown(l); err != nil {
+				return undo, err
+			}
+			undo = append(undo, func() error { return h.LinkSetUp(l) })
+		}
+	case "":
+	default:
+		return undo, fmt.Errorf("invalid state '%s': %w", op.State, unix.EINVAL)
+	}
+
+	return undo, nil
+}
+
+// bridgeVlans adds or removes the VLANs of a bridge port. The undo puts back
+// the whole previous membership, which also covers a PVID that moved to
+// another VLAN.
+func bridgeVlans(h *netlink.Handle, op Op) ([]func() error, error) {
+	l, err := h.LinkByName(op.Name)
+	if err != nil {
+		if op.Kind == OpBridgeVlanDel && isLinkNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	prev, err := linkVlans(h, l.Attrs().Index)
+	if err != nil {
+		return nil, err
+	}
+	had := make(map[int]bool, len(prev))
+	for _, v := range prev {
+		had[v.VID] = true
+	}
+	add := func(v BridgeVlan) error {
+		return h.BridgeVlanAdd(l, uint16(v.VID), v.PVID, v.Untagged, op.Self, false)
+	}
+	del := func(vid int) error {
+		return h.BridgeVlanDel(l, uint16(vid), false, false, op.Self, false)
+	}
+
+	var changed []int
+	for _, v := range op.Vlans {
+		if v.VID < 1 || v.VID > 4094 {
+			return nil, fmt.Errorf("invalid VLAN ID %d: %w", v.VID, unix.EINVAL)
+		}
+		if op.Kind == OpBridgeVlanAdd {
+			err = add(v)
+		} else if had[v.VID] {
+			err = del(v.VID)
+		} else {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		changed = append(changed, v.VID)
+	}
+
+	undo := func() error {
+		for _, vid := range changed {
+			if !had[vid] {
+				_ = del(vid)
+			}
+		}
+		var errs []error
+		for _, v := range prev {
+			errs = append(errs, add(v))
+		}
+		return errors.Join(errs...)
+	}
+	if len(changed) == 0 {
+		return nil, err
+	}
+	return []func() error{undo}, err
+}
+
+// linkVlans returns the VLAN membership of the link with index.
+func linkVlans(h *netlink.Handle, index int) ([]BridgeVlan, error) {
+	all, err := h.BridgeVlanList()
+	if err != nil {
+		return nil, fmt.Errorf("can't list bridge VLANs: %w", err)
+	}
+	var vlans []BridgeVlan
+	for _, info := range all[int32(index)] {
+		vlans = append(vlans, BridgeVlan{VID: int(info.Vid), PVID: info.PortVID(), Untagged: info.EngressUntag()})
+	}
+	sort.Slice(vlans, func(i, j int) bool { return vlans[i].VID < vlans[j].VID })
+	return vlans, nil
+}
+
+// onLockedThread runs f on a dedicated locked OS thread, which is thrown
+// away (not unlocked) when f fails to restore the network namespace of the
+// thread, so that no goroutine runs in the wrong namespace afterwards.
+func onLockedThread(f func() (restored bool, err error)) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		restored, err := f()
+		if restored {
+			runtime.UnlockOSThread()
+		}
+		errc <- err
+	}()
+	return <-errc
+}
+
+// inNetNS runs f in the named network namespace (the current one when
+// empty), for the operations that work on the namespace of the thread
+// rather than through a netlink handle.
+func inNetNS(name string, f func() error) error {
+	if name == "" {
+		return f()
+	}
+	return onLockedThread(func() (bool, error) {
+		orig, err := netns.Get()
+		if err != nil {
+			return true, err
+		}
+		defer orig.Close()
+		ns, err := netns.GetFromName(name)
+		if err != nil {
+			return true, fmt.Errorf("can't open network namespace '%s': %w", name, err)
+		}
+		defer ns.Close()
+		if err := netns.Set(ns); err != nil {
+			return netns.Set(orig) == nil, err
+		}
+		err = f()
+		if serr := netns.Set(orig); serr != nil {
+			return false, fmt.Errorf("can't switch back from network namespace '%s': %w", name, serr)
+		}
+		return true, err
+	})
+}
+
+// openNetNS opens the named network namespace, or the default one (the one
+// of the process) when name is empty.
+func openNetNS(name string) (netns.NsHandle, error) {
+	if name == "" {
+		return netns.GetFromPid(os.Getpid())
+	}
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return ns, fmt.Errorf("can't open network namespace '%s': %w", name, err)
+	}
+	return ns, nil
+}
+
+// netnsAdd creates a named network namespace. netns.NewNamed switches the
+// calling thread into the new namespace, so this runs on a dedicated locked
+// thread.
+func netnsAdd(name string) ([]func() error, error) {
+	err := onLockedThread(func() (bool, error) {
+		orig, err := netns.Get()
+		if err != nil {
+			return true, err
+		}
+		defer orig.Close()
+
+		ns, err := netns.NewNamed(name)
+		if err != nil {
+			return netns.Set(orig) == nil, err
+		}
+		ns.Close()
+		if err := netns.Set(orig); err != nil {
+			return false, fmt.Errorf("can't switch back from network namespace '%s': %w", name, err)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []func() error{func() error { return netnsDel(name) }}, nil
+}
+
+func netnsDel(name string) error {
+	if _, err := os.Stat(filepath.Join(netnsDir, name)); os.IsNotExist(err) {
+		return nil
+	}
+	return netns.DeleteNamed(name)
+}
+
+// linkNames returns the names of all the links, ordered by index.
+func linkNames(h *netlink.Handle) ([]string, error) {
+	all, err := h.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Attrs().Index < all[j].Attrs().Index })
+	names := make([]string, 0, len(all))
+	for _, l := range all {
+		names = append(names, l.Attrs().Name)
+	}
+	return names, nil
+}
+
+func show(h *netlink.Handle, names []string) ([]Link, error) {
+	all, err := h.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	byIndex := make(map[int]netlink.Link, len(all))
+	byName := make(map[string]netlink.Link, len(all))
+	for _, l := range all {
+		byIndex[l.Attrs().Index] = l
+		byName[l.Attrs().Name] = l
+	}
+
+	out := make([]Link, 0, len(names))
+	for _, name := range names {
+		l, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("link '%s': %w", name, unix.ENODEV)
+		}
+		a := l.Attrs()
+		link := Link{
+			Name:  a.Name,
+			Index: a.Index,
+			Type:  l.Type(),
+			MTU:   a.MTU,
+			Up:    a.Flags&net.FlagUp != 0,
+			// E.g. "lower-layer-down" as `ip` reports it.
+			OperState: strings.ReplaceAll(a.OperState.String(), "-", ""),
+		}
+		switch l := l.(type) {
+		case *netlink.Tuntap:
+			link.Type = TypeTAP
+			if l.Mode == netlink.TUNTAP_MODE_TUN {
+				link.Type = "tun"
+			}
+		case *netlink.Vlan:
+			link.VlanID = l.VlanId
+		}
+		if len(a.HardwareAddr) > 0 {
+			link.MAC = a.HardwareAddr.String()
+		}
+		if m, ok := byIndex[a.MasterIndex]; ok && a.MasterIndex != 0 {
+			link.Master = m.Attrs().Name
+		}
+		if p, ok := byIndex[a.ParentIndex]; ok && a.ParentIndex != 0 && a.NetNsID < 0 {
+			link.Parent = p.Attrs().Name
+		}
+		br, isBridge := l.(*netlink.Bridge)
+		if isBridge {
+			link.VlanFiltering = br.VlanFiltering
+			if br.VlanDefaultPVID != nil {
+				pvid := int(*br.VlanDefaultPVID)
+				link.DefaultPVID = &pvid
+			}
+		}
+		if _, portOf := byIndex[a.MasterIndex].(*netlink.Bridge); isBridge || portOf {
+			if link.Vlans, err = linkVlans(h, a.Index); err != nil {
+				return nil, fmt.Errorf("link '%s': %w", name, err)
+			}
+		}
+		for _, o := range all {
+			if o.Attrs().MasterIndex == a.Index {
+				link.Members = append(link.Members, o.Attrs().Name)
+			}
+		}
+
+		addrs, err := h.AddrList(l, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, fmt.Errorf("link '%s' addresses: %w", name, err)
+		}
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				link.Addrs4 = append(link.Addrs4, addr.IPNet.String())
+			} else if !addr.IP.IsLinkLocalUnicast() {
+				link.Addrs6 = append(link.Addrs6, addr.IPNet.String())
+			}
+		}
+		out = append(out, link)
+	}
+	return out, nil
+}
+
+// routeOp applies an OpRouteAdd or OpRouteDel.
+func routeOp(h *netlink.Handle, op Op) ([]func() error, error) {
+	if op.Route == nil {
+		return nil, fmt.Errorf("no route: %w", unix.EINVAL)
+	}
+	_, dst, err := net.ParseCIDR(op.Route.Dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination '%s': %w", op.Route.Dst, unix.EINVAL)
+	}
+	r := &netlink.Route{Dst: dst, Priority: op.Route.Metric, Table: op.Route.Table}
+	if r.Table == 0 {
+		r.Table = unix.RT_TABLE_MAIN
+	}
+
+	if op.Kind == OpRouteDel {
+		if err := h.RouteDel(r); err != nil {
+			if errors.Is(err, unix.ESRCH) || errors.Is(err, unix.ENOENT) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if op.Route.Gateway != "" {
+		if r.Gw = net.ParseIP(op.Route.Gateway); r.Gw == nil {
+			return nil, fmt.Errorf("invalid gateway '%s': %w", op.Route.Gateway, unix.EINVAL)
+		}
+	}
+	if op.Route.Src != "" {
+		if r.Src = net.ParseIP(op.Route.Src); r.Src == nil {
+			return nil, fmt.Errorf("invalid source address '%s': %w", op.Route.Src, unix.EINVAL)
+		}
+	}
+	if op.Route.Dev != "" {
+		l, err := h.LinkByName(op.Route.Dev)
+		if err != nil {
+			return nil, err
+		}
+		r.LinkIndex = l.Attrs().Index
+	}
+	// Without a gateway the destination is on the link, as `ip route`
+	// does.
+	if r.Gw == nil {
+		r.Scope = netlink.SCOPE_LINK
+	}
+	if err := h.RouteReplace(r); err != nil {
+		return nil, err
+	}
+	del := &netlink.Route{Dst: dst, Priority: r.Priority, Table: r.Table}
+	return []func() error{func() error { return h.RouteDel(del) }}, nil
+}
+
+// ruleOp applies an OpRuleAdd or OpRuleDel.
+func ruleOp(h *netlink.Handle, op Op) ([]func() error, error) {
+	if op.Rule == nil {
+		return nil, fmt.Errorf("no rule: %w", unix.EINVAL)
+	}
+	r := netlink.NewRule()
+	r.Family = unix.AF_INET
+	if op.Rule.Family == 6 {
+		r.Family = unix.AF_INET6
+	}
+	r.Priority = op.Rule.Priority
+	r.Table = op.Rule.Table
+	r.IifName = op.Rule.IIF
+	r.OifName = op.Rule.OIF
+	if op.Rule.FwMark != 0 || op.Rule.FwMask != 0 {
+		r.Mark = op.Rule.FwMark
+		if op.Rule.FwMask != 0 {
+			mask := op.Rule.FwMask
+			r.Mask = &mask
+		}
+	}
+	for _, p := range []struct {
+		what, s string
+		n       **net.IPNet
+	}{{"from", op.Rule.From, &r.Src}, {"to", op.Rule.To, &r.Dst}} {
+		if p.s == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(p.s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s prefix '%s': %w", p.what, p.s, unix.EINVAL)
+		}
+		*p.n = n
+	}
+
+	if op.Kind == OpRuleDel {
+		if err := h.RuleDel(r); err != nil {
+			if errors.Is(err, unix.ENOENT) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return nil, nil
+	}
+	if err := h.RuleAdd(r); err != nil {
+		if errors.Is(err, unix.EEXIST) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return []func() error{func() error { return h.RuleDel(r) }}, nil
+}
+
+// showRoutes reports the routes of all the tables but the local one.
+func showRoutes(h *netlink.Handle) ([]Route, error) {
+	all, err := h.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_UNSPEC}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("can't list routes: %w", err)
+	}
+	links, err := h.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(links))
+	for _, l := range links {
+		names[l.Attrs().Index] = l.Attrs().Name
+	}
+
+	var routes []Route
+	for _, r := range all {
+		if r.Table == unix.RT_TABLE_LOCAL {
+			continue
+		}
+		route := Route{Dev: names[r.LinkIndex], Metric: r.Priority, Table: r.Table}
+		switch {
+		case r.Dst != nil:
+			route.Dst = r.Dst.String()
+		case r.Family == unix.AF_INET6:
+			route.Dst = "::/0"
+		default:
+			route.Dst = "0.0.0.0/0"
+		}
+		if r.Gw != nil {
+			route.Gateway = r.Gw.String()
+		}
+		if r.Src != nil {
+			route.Src = r.Src.String()
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// showRules reports the routing policy rules.
+func showRules(h *netlink.Handle) ([]Rule, error) {
+	var rules []Rule
+	// Not netlink.FAMILY_ALL, which includes the multicast routing rules.
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		all, err := h.RuleList(family)
+		if err != nil {
+			return nil, fmt.Errorf("can't list routing policy rules: %w", err)
+		}
+		for _, r := range all {
+			rules = append(rules, newRule(family, r))
+		}
+	}
+	return rules, nil
+}
+
+func newRule(family int, r netlink.Rule) Rule {
+	rule := Rule{Family: 4, Priority: r.Priority, IIF: r.IifName, OIF: r.OifName, FwMark: r.Mark, Table: r.Table}
+	if family == netlink.FAMILY_V6 {
+		rule.Family = 6
+	}
+	if r.Mask != nil && *r.Mask != 0xffffffff {
+		rule.FwMask = *r.Mask
+	}
+	if r.Src != nil {
+		rule.From = r.Src.String()
+	}
+	if r.Dst != nil {
+		rule.To = r.Dst.String()
+	}
+	return rule
+}
+
+// knownErrnos are matched by message when an error doesn't wrap its errno.
+var knownErrnos = []syscall.Errno{unix.EEXIST, unix.EBUSY, unix.ENODEV, unix.ENOENT, unix.EADDRNOTAVAIL, unix.EOPNOTSUPP}
+
+func newError(op int, err error) *Error {
+	e := &Error{Op: op, Msg: err.Error()}
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		e.Errno = unix.ErrnoName(errno)
+	case isLinkNotFound(err):
+		e.Errno = "ENODEV"
+	default:
+		for _, n := range knownErrnos {
+			if strings.Contains(e.Msg, n.Error()) {
+				e.Errno = unix.ErrnoName(n)
+				break
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package nlops
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestErrorIs(t *testing.T) {
+	is := is.New(t)
+
+	err := fmt.Errorf("can't create bridge: %w", &Error{Op: 0, Errno: "EEXIST", Msg: "link_add 'br0': file exists"})
+	is.True(errors.Is(err, ErrExist))
+	is.True(!errors.Is(err, ErrNotFound))
+
+	is.True(errors.Is(&Error{Errno: "ENODEV"}, ErrNotFound))
+	is.True(errors.Is(&Error{Errno: "ENOENT"}, ErrNotFound))
+	is.True(errors.Is(&Error{Errno: "ESRCH"}, ErrNotFound))
+	is.True(errors.Is(&Error{Errno: "EBUSY"}, ErrBusy))
+	is.True(errors.Is(&Error{Errno: "EADDRNOTAVAIL"}, ErrAddrNotAvail))
+	is.True(errors.Is(&Error{Errno: "EOPNOTSUPP"}, ErrUnsupported))
+	is.True(errors.Is(&Error{Errno: "ENOTSUP"}, ErrUnsupported))
+	is.True(!errors.Is(&Error{Msg: "no errno"}, ErrNotFound))
+
+	is.Equal((&Error{Errno: "EBUSY", Msg: "busy"}).Error(), "busy (EBUSY)")
+}
+
+func TestRequestResponseJSON(t *testing.T) {
+	is := is.New(t)
+
+	req := Request{
+		NetNS: "ns1",
+		Ops: []Op{
+			{Kind: OpLinkAdd, Name: "bond0", Type: TypeBond, Bond: &Bond{Mode: "802.3ad", MIIMon: 100}},
+			{Kind: OpLinkSet, Name: "eth1", Master: "bond0", State: "up"},
+		},
+		Show: []string{"bond0"},
+	}
+	js, err := req.Marshal()
+	is.NoErr(err)
+	is.Equal(js, `{"netns":"ns1","ops":[{"kind":"link_add","name":"bond0","type":"bond","bond":{"mode":"802.3ad","miimon":100}},`+
+		`{"kind":"link_set","name":"eth1","master":"bond0","state":"up"}],"show":["bond0"]}`)
+
+	resp, err := ParseResponse([]byte(`{"error":{"op":1,"errno":"EBUSY","msg":"busy"}}` + "\n"))
+	is.NoErr(err)
+	is.True(errors.Is(resp.Err(), ErrBusy))
+	is.Equal(resp.Error.Op, 1)
+
+	resp, err = ParseResponse([]byte(`{"links":[{"name":"bond0","index":5,"type":"bond","mtu":1500,"up":true,"members":["eth1"]}]}`))
+	is.NoErr(err)
+	is.NoErr(resp.Err())
+	is.Equal(resp.Links[0].Members, []string{"eth1"})
+
+	_, err = ParseResponse([]byte("flag provided but not defined: -netlink"))
+	is.True(err != nil)
+}
+
+func TestOpIsRelease(t *testing.T) {
+	is := is.New(t)
+	is.True(Op{Kind: OpLinkSet, Name: "tap0", NoMaster: true}.IsRelease())
+	is.True(!Op{Kind: OpLinkSet, Name: "tap0", NoMaster: true, State: "down"}.IsRelease())
+	on := true
+	is.True(!Op{Kind: OpLinkSet, Name: "br0", NoMaster: true, VlanFiltering: &on}.IsRelease())
+	is.True(!Op{Kind: OpLinkDel, Name: "tap0", NoMaster: true}.IsRelease())
+}
+
+func TestOpInParentNetNS(t *testing.T) {
+	is := is.New(t)
+	is.True(Op{Kind: OpLinkAdd, Name: "mv0", Type: TypeMacvlan, Parent: "eth0"}.InParentNetNS())
+	is.True(Op{Kind: OpLinkAdd, Name: "mvt0", Type: TypeMacvtap, Parent: "eth0"}.InParentNetNS())
+	is.True(Op{Kind: OpLinkAdd, Name: "ipv0", Type: TypeIPVlan, Parent: "eth0"}.InParentNetNS())
+	is.True(!Op{Kind: OpLinkAdd, Name: "eth0.10", Type: TypeVLAN, Parent: "eth0"}.InParentNetNS())
+	is.True(!Op{Kind: OpLinkDel, Name: "mv0", Type: TypeMacvlan}.InParentNetNS())
+}
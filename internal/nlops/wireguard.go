@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package nlops
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// WireguardKeyLen is the length of WireGuard keys, which are written in
+// base64.
+const WireguardKeyLen = 32
+
+// WireguardConfig is the configuration of a WireGuard link, in the file
+// format of wg(8) (the one of `wg setconf`, not the wg-quick extensions).
+type WireguardConfig struct {
+	PrivateKey string
+	ListenPort int
+	Peers      []WireguardPeer
+}
+
+// WireguardPeer is a [Peer] section of a WireguardConfig.
+type WireguardPeer struct {
+	PublicKey    string
+	PresharedKey string
+	// Endpoint is "host:port", the host may be a name.
+	Endpoint            string
+	AllowedIPs          []string
+	PersistentKeepalive int
+}
+
+// Marshal returns c in the wg(8) file format.
+func (c WireguardConfig) Marshal() string {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", c.PrivateKey)
+	if c.ListenPort > 0 {
+		fmt.Fprintf(&b, "ListenPort = %d\n", c.ListenPort)
+	}
+	for _, p := range c.Peers {
+		b.WriteString("\n[Peer]\n")
+		fmt.Fprintf(&b, "PublicKey = %s\n", p.PublicKey)
+		if p.PresharedKey != "" {
+			fmt.Fprintf(&b, "PresharedKey = %s\n", p.PresharedKey)
+		}
+		if p.Endpoint != "" {
+			fmt.Fprintf(&b, "Endpoint = %s\n", p.Endpoint)
+		}
+		if len(p.AllowedIPs) > 0 {
+			fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(p.AllowedIPs, ", "))
+		}
+		if p.PersistentKeepalive > 0 {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", p.PersistentKeepalive)
+		}
+	}
+	return b.String()
+}
+
+// ParseWireguardConfig parses a configuration in the wg(8) file format and
+// validates the keys and addresses.
+func ParseWireguardConfig(text string) (WireguardConfig, error) {
+	var c WireguardConfig
+	var peer *WireguardPeer
+	section := ""
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(line)
+			switch section {
+			case "[interface]":
+			case "[peer]":
+				c.Peers = append(c.Peers, WireguardPeer{})
+				peer = &c.Peers[len(c.Peers)-1]
+			default:
+				return c, fmt.Errorf("line %d: unknown section %s", n, line)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return c, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		var err error
+		switch {
+		case section == "[interface]" && key == "privatekey":
+			c.PrivateKey, err = value, CheckWireguardKey(value)
+		case section == "[interface]" && key == "listenport":
+			c.ListenPort, err = strconv.Atoi(value)
+		case section == "[peer]" && key == "publickey":
+			peer.PublicKey, err = value, CheckWireguardKey(value)
+		case section == "[peer]" && key == "presharedkey":
+			peer.PresharedKey, err = value, CheckWireguardKey(value)
+		case section == "[peer]" && key == "endpoint":
+			peer.Endpoint = value
+			_, _, err = net.SplitHostPort(value)
+		case section == "[peer]" && key == "allowedips":
+			for _, a := range strings.Split(value, ",") {
+				a = strings.TrimSpace(a)
+				if _, _, err = net.ParseCIDR(a); err != nil {
+					break
+				}
+				peer.AllowedIPs = append(peer.AllowedIPs, a)
+			}
+		case section == "[peer]" && key == "persistentkeepalive":
+			peer.PersistentKeepalive, err = strconv.Atoi(value)
+		default:
+			return c, fmt.Errorf("line %d: unknown key %q", n, key)
+		}
+		if err != nil {
+			return c, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if c.PrivateKey == "" {
+		return c, fmt.Errorf("no private key")
+	}
+	for i, p := range c.Peers {
+		if p.PublicKey == "" {
+			return c, fmt.Errorf("peer %d without a public key", i)
+		}
+	}
+	return c, nil
+}
+
+// GenerateWireguardKey returns a new base64 private key, like `wg genkey`.
+func GenerateWireguardKey() (string, error) {
+	k := make([]byte, WireguardKeyLen)
+	if _, err := rand.Read(k); err != nil {
+		return "", err
+	}
+	// Clamp it as a Curve25519 private key.
+	k[0] &= 248
+	k[31] = (k[31] & 127) | 64
+	return base64.StdEncoding.EncodeToString(k), nil
+}
+
+// WireguardPublicKey returns the base64 public key of the base64 private key
+// priv, like `wg pubkey`.
+func WireguardPublicKey(priv string) (string, error) {
+	if err := CheckWireguardKey(priv); err != nil {
+		return "", err
+	}
+	k, _ := base64.StdEncoding.DecodeString(priv)
+	pub, err := curve25519.X25519(k, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// CheckWireguardKey validates a base64 WireGuard key (private, public or
+// preshared).
+func CheckWireguardKey(s string) error {
+	k, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(k) != WireguardKeyLen {
+		return fmt.Errorf("invalid key, expected %d bytes in base64", WireguardKeyLen)
+	}
+	return nil
+}
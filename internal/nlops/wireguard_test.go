@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package nlops
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestWireguardConfig(t *testing.T) {
+	is := is.New(t)
+
+	priv, err := GenerateWireguardKey()
+	is.NoErr(err)
+	pub, err := WireguardPublicKey(priv)
+	is.NoErr(err)
+
+	c := WireguardConfig{
+		PrivateKey: priv,
+		ListenPort: 51820,
+		Peers: []WireguardPeer{
+			{PublicKey: pub, Endpoint: "[2001:db8::2]:51820", AllowedIPs: []string{"10.99.0.2/32", "fd99::2/128"}, PersistentKeepalive: 25},
+			{PublicKey: pub, PresharedKey: priv},
+		},
+	}
+	got, err := ParseWireguardConfig(c.Marshal())
+	is.NoErr(err)
+	is.Equal(got, c)
+
+	_, err = ParseWireguardConfig("[Interface]\nListenPort = 51820\n")
+	is.True(err != nil) // no private key
+
+	_, err = ParseWireguardConfig(c.Marshal() + "[Peer]\nPublicKey = c2hvcnQ=\n")
+	is.True(err != nil) // not 32 bytes
+
+	_, err = ParseWireguardConfig(c.Marshal() + "[Peer]\nPublicKey = " + pub + "\nAllowedIPs = 10.0.0.1\n")
+	is.True(err != nil) // not a CIDR
+}
+
+func TestWireguardPublicKey(t *testing.T) {
+	is := is.New(t)
+
+	// RFC 7748, section 6.1.
+	priv, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	pub, err := WireguardPublicKey(base64.StdEncoding.EncodeToString(priv))
+	is.NoErr(err)
+	want, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	is.Equal(pub, base64.StdEncoding.EncodeToString(want))
+}
@@ -4,24 +4,20 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
 
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/errchecker"
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/lladdr"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
 	"github.com/davecgh/go-spew/spew"
-	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/setplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
@@ -55,6 +51,10 @@ type BridgeModel struct {
 	IPv4Address types.String `tfsdk:"ipv4_address"`
 	IPv6Address types.String `tfsdk:"ipv6_address"`
 	NetNS       types.String `tfsdk:"netns"`
+	// VlanFiltering and DefaultPVID make this a VLAN-aware bridge, the
+	// per-port VLANs are set by zedamigo_bridge_vlan.
+	VlanFiltering types.Bool  `tfsdk:"vlan_filtering"`
+	DefaultPVID   types.Int64 `tfsdk:"default_pvid"`
 	// EnslavedInterfaces is the set of existing interfaces to attach as
 	// members (slaves) of this bridge.
 	EnslavedInterfaces types.Set `tfsdk:"enslaved_interfaces"`
@@ -72,7 +72,9 @@ func (r *Bridge) Schema(ctx context.Context, req resource.SchemaRequest, resp *r
 	resp.Schema = schema.Schema{
 		Description: "Bridge",
 		// This description is used by the documentation generator and the language server.
-		MarkdownDescription: "Create and manage a Linux network bridge interface using iproute2 commands.",
+		MarkdownDescription: "Create and manage a Linux network bridge interface through netlink or iproute2 commands (see the provider `network_backend`). " +
+			"`mtu`, `state`, `mac_address`, the addresses, the VLAN options and `enslaved_interfaces` are changed in place, " +
+			"and settings changed outside of Terraform are restored on refresh.",
 
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
@@ -120,19 +122,33 @@ func (r *Bridge) Schema(ctx context.Context, req resource.SchemaRequest, resp *r
 					stringplanmodifier.RequiresReplace(),
 				},
 			},
+			"vlan_filtering": schema.BoolAttribute{
+				MarkdownDescription: "Make this a VLAN-aware bridge: frames are only forwarded between ports that are members " +
+					"of their VLAN, see `zedamigo_bridge_vlan` for the membership of each port. Optional and if not " +
+					"specified the kernel default (disabled) is kept.",
+				Optional: true,
+				Computed: true,
+			},
+			"default_pvid": schema.Int64Attribute{
+				MarkdownDescription: "VLAN that ports (and the bridge itself) join untagged, as their PVID, when they are " +
+					"attached to the bridge. `0` disables it, so a new port is not a member of any VLAN until " +
+					"configured. Optional and if not specified the kernel default (`1`) is kept.",
+				Optional: true,
+				Computed: true,
+				Validators: []validator.Int64{
+					int64validator.Between(0, 4094),
+				},
+			},
 			"enslaved_interfaces": schema.SetAttribute{
 				Description: "Names of existing interfaces to enslave (attach as members) to this bridge. " +
 					"Each interface is attached with `ip link set dev <interface> master <bridge>` and brought up. " +
 					"The interfaces must already exist in the same network namespace as the bridge. " +
-					"Changing this set requires the bridge to be re-created. " +
+					"Changing this set adds or releases the members in place. " +
 					"Only list interfaces that are not otherwise managed as bridge members: do not include " +
 					"interfaces (such as `zedamigo_tap` resources) that attach themselves via their own `master` " +
 					"attribute, as those are owned by the other resource and are deliberately ignored here.",
 				Optional:    true,
 				ElementType: types.StringType,
-				PlanModifiers: []planmodifier.Set{
-					setplanmodifier.RequiresReplace(),
-				},
 			},
 		},
 	}
@@ -199,101 +215,37 @@ func (r *Bridge) Create(ctx context.Context, req resource.CreateRequest, resp *r
 	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
 		netns = data.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
 
-	// Create the bridge.
-	moreArgs := []string{"link", "add", br, "type", "bridge"}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		resp.Diagnostics.AddError("Bridge Resource Error",
-			"Unable to create a new bridge.")
-		resp.Diagnostics.Append(res.Diagnostics()...)
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// Set the MTU if specified.
-	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
-		mtu := fmt.Sprintf("%d", data.MTU.ValueInt64())
-		moreArgs := []string{"link", "set", "dev", br, "mtu", mtu}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("Bridge Resource Error",
-				"Unable to create a new bridge.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	// Create and configure the bridge in one batch, with the netlink backend
+	// a failure part way leaves nothing behind.
+	add := nlops.Op{Kind: nlops.OpLinkAdd, Name: br, Type: nlops.TypeBridge}
+	if !data.VlanFiltering.IsNull() && !data.VlanFiltering.IsUnknown() {
+		on := data.VlanFiltering.ValueBool()
+		add.VlanFiltering = &on
 	}
-
-	// Set the state if specified.
-	if !data.State.IsNull() && !data.State.IsUnknown() {
-		state := data.State.ValueString()
-		moreArgs := []string{"link", "set", "dev", br, state}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("Bridge Resource Error",
-				"Unable to create a new bridge.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	if !data.DefaultPVID.IsNull() && !data.DefaultPVID.IsUnknown() {
+		pvid := int(data.DefaultPVID.ValueInt64())
+		add.DefaultPVID = &pvid
 	}
-
-	// Set the MAC address if specified.
-	if !data.MACAddress.IsNull() && !data.MACAddress.IsUnknown() {
-		macAddr := data.MACAddress.ValueString()
-		moreArgs := []string{"link", "set", "dev", br, "address", macAddr}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("Bridge Resource Error",
-				"Unable to set MAC address for bridge.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	ops := []nlops.Op{add}
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: br}
+	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
+		set.MTU = int(data.MTU.ValueInt64())
 	}
-
-	// Configure an IPv4 address if specified.
-	if !data.IPv4Address.IsNull() && !data.IPv4Address.IsUnknown() {
-		addr := data.IPv4Address.ValueString()
-
-		// Validate the CIDR format
-		_, _, err := net.ParseCIDR(addr)
-		if err != nil {
-			resp.Diagnostics.AddError("Invalid IPv4 address format",
-				fmt.Sprintf("IPv4 address must be in CIDR format (e.g., '192.168.1.1/24'): %s", err.Error()))
-			return
-		}
-
-		moreArgs := []string{"addr", "add", addr, "dev", br}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("Bridge Resource Error",
-				"Unable to create a new bridge.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
-
+	if !data.MACAddress.IsNull() && !data.MACAddress.IsUnknown() {
+		set.MAC = data.MACAddress.ValueString()
 	}
-
-	// Configure an IPv6 address if specified.
-	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
-		addr := data.IPv6Address.ValueString()
-
-		// Validate the CIDR format
-		_, _, err := net.ParseCIDR(addr)
-		if err != nil {
-			resp.Diagnostics.AddError("Invalid IPv6 address format",
-				fmt.Sprintf("IPv6 address must be in CIDR format (e.g., 'fd00::1/64'): %s", err.Error()))
-			return
-		}
-
-		moreArgs := []string{"addr", "add", addr, "dev", br}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("Bridge Resource Error",
-				"Unable to create a new bridge.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
+	ops = append(ops, set)
+	for _, addr := range []types.String{data.IPv4Address, data.IPv6Address} {
+		if !addr.IsNull() && !addr.IsUnknown() {
+			ops = append(ops, nlops.Op{Kind: nlops.OpAddrAdd, Name: br, Addr: addr.ValueString()})
 		}
-
 	}
 
 	// Enslave any existing interfaces specified, attaching them as members
@@ -304,33 +256,25 @@ func (r *Bridge) Create(ctx context.Context, req resource.CreateRequest, resp *r
 		if resp.Diagnostics.HasError() {
 			return
 		}
-
 		for _, intf := range ifaces {
-			// Attach the interface as a member of the bridge.
-			moreArgs := []string{"link", "set", "dev", intf, "master", br}
-			res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-			if err != nil {
-				resp.Diagnostics.AddError("Bridge Resource Error",
-					fmt.Sprintf("Unable to enslave interface '%s' to bridge '%s'.", intf, br))
-				resp.Diagnostics.Append(res.Diagnostics()...)
-				return
-			}
-
-			// Bring the enslaved interface up. NOTE: this MUST be done after
-			// setting the master.
-			moreArgs = []string{"link", "set", "dev", intf, "up"}
-			res, err = r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-			if err != nil {
-				resp.Diagnostics.AddError("Bridge Resource Error",
-					fmt.Sprintf("Unable to bring enslaved interface '%s' up.", intf))
-				resp.Diagnostics.Append(res.Diagnostics()...)
-				return
-			}
+			ops = append(ops, bridgeMemberOp(br, intf))
 		}
 	}
 
+	// Set the state if specified, after the members are attached.
+	if !data.State.IsNull() && !data.State.IsUnknown() {
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: br, State: data.State.ValueString()})
+	}
+
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("Bridge Resource Error",
+			fmt.Sprintf("Unable to create a new bridge: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
 	// Read the bridge current state.
-	if diags, err := r.readBridge(ctx, d, ipCmd, ipArgs, &data); err != nil {
+	if diags, err := r.readBridge(ctx, d, nl, &data); err != nil {
 		resp.Diagnostics.AddError("Failed to read bridge state", err.Error())
 		resp.Diagnostics.Append(diags...)
 		return
@@ -349,18 +293,16 @@ func (r *Bridge) Create(ctx context.Context, req resource.CreateRequest, resp *r
 		// on other resources (like VMs starting) might only happen much
 		// later. At the same time other resources like RADV depend only
 		// the interface having a link-local address sooner.
-		ll, err := lladdr.LinkLocalIPv6FromMACString(data.MACAddress.ValueString())
+		llOps, err := linkLocalOps(br, "", data.MACAddress.ValueString())
 		if err != nil {
 			resp.Diagnostics.AddError("Bridge Resource Error",
-				fmt.Sprintf("Can't configure link-local address '%s' on bridge interface: %v", ll.String(), err))
+				fmt.Sprintf("Can't configure link-local address on bridge interface: %v", err))
 			return
 		}
-		moreArgs := []string{"addr", "add", fmt.Sprintf("%s/64", ll.String()), "scope", "link", "dev", br}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
 			resp.Diagnostics.AddError("Bridge Resource Error",
-				"Unable to create a new bridge.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
+				fmt.Sprintf("Unable to configure bridge link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
 			return
 		}
 	}
@@ -386,12 +328,12 @@ func (r *Bridge) Read(ctx context.Context, req resource.ReadRequest, resp *resou
 	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
 		netns = data.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
 
 	// Read the bridge current state.
-	if diags, err := r.readBridge(ctx, d, ipCmd, ipArgs, &data); err != nil {
-		// Check for various error messages that indicate the device doesn't exist.
-		if errchecker.ContainsAny(err, intfNotFoundStrs) || errchecker.DiagsAny(diags, intfNotFoundStrs) {
+	prior := data
+	if diags, err := r.readBridge(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
 			// Resource was deleted outside Terraform: remove from state.
 			resp.State.RemoveResource(ctx)
 			return
@@ -402,22 +344,64 @@ func (r *Bridge) Read(ctx context.Context, req resource.ReadRequest, resp *resou
 		return
 	}
 
+	// Self-heal drift: settings changed behind our back (e.g. `ip link set`
+	// by hand, or a member released when its TAP was re-created) are put back
+	// to the last applied ones. If that fails the actual values are kept, so
+	// the drift shows up in the next plan instead.
+	if want, drift := bridgeHealTarget(prior, data); drift {
+		tflog.Info(ctx, "Bridge settings drifted, restoring them", map[string]any{"bridge": data.Name.ValueString()})
+		if diags, err := r.applyBridge(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("Bridge Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of bridge '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readBridge(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read bridge state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
 	// Save updated data into Terraform state
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
 func (r *Bridge) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var data BridgeModel
+	var plan BridgeModel
+	var state BridgeModel
 
-	// Read Terraform plan data into the model
-	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// TODO: What to do here ?
+	d := r.getResourceDir(state.ID.ValueString())
+
+	// name/netns are RequiresReplace, so they cannot reach Update changed.
+	netns := ""
+	if !plan.NetNS.IsNull() && !plan.NetNS.IsUnknown() {
+		netns = plan.NetNS.ValueString()
+	}
+	nl := newNetLinks(r.providerConf, netns)
+
+	if diags, err := r.applyBridge(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("Bridge Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes (and the reconciled
+	// member set) are concrete before we save.
+	if diags, err := r.readBridge(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read bridge state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
 
-	resp.Diagnostics.AddError("Bridge Resource Update Error", "Update is not supported.")
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 }
 
 func (r *Bridge) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
@@ -436,25 +420,14 @@ func (r *Bridge) Delete(ctx context.Context, req resource.DeleteRequest, resp *r
 	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
 		netns = data.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
 
-	// Delete an existing bridge.
-	moreArgs := []string{"link", "delete", br, "type", "bridge"}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		errMsg := err.Error()
-		// Check for various error messages that indicate the device doesn't exist.
-		// If the device doesn't exist, the delete is successful (idempotent),
-		// otherwise we need to treat it like an error.
-		if !strings.Contains(errMsg, "does not exist") &&
-			!strings.Contains(errMsg, "Cannot find device") &&
-			!strings.Contains(errMsg, "cannot find device") &&
-			!strings.Contains(errMsg, "No such device") &&
-			!strings.Contains(errMsg, "no such device") {
-			resp.Diagnostics.AddError("Failed to delete bridge", err.Error())
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	// Delete an existing bridge. If it doesn't exist the delete is successful
+	// (idempotent).
+	if diags, err := nl.apply(ctx, d, nlops.Op{Kind: nlops.OpLinkDel, Name: br, Type: nlops.TypeBridge}); err != nil {
+		resp.Diagnostics.AddError("Failed to delete bridge", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
 	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
@@ -468,139 +441,169 @@ func (r *Bridge) ImportState(ctx context.Context, req resource.ImportStateReques
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *Bridge) readBridge(ctx context.Context, resPath string, ipCmd string, ipArgs []string, model *BridgeModel) (diag.Diagnostics, error) {
+func (r *Bridge) readBridge(ctx context.Context, resPath string, nl netLinks, model *BridgeModel) (diag.Diagnostics, error) {
 	br := model.Name.ValueString()
 
-	// Check if bridge exists and get info.
-	moreArgs := []string{"link", "show", br}
-	res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
+	link, diags, err := nl.show(ctx, resPath, br)
 	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve bridge '%s' details: %w", br, err)
-	}
-
-	// Parse output for MTU, state, and MAC address.
-	lines := strings.Split(res.Stdout, "\n")
-	// A real `ip link show` line always contains the flags section "<...>".
-	// If it doesn't, the output is empty or unparseable: fail loudly with the
-	// raw output instead of fabricating a "down" state.
-	if len(lines) == 0 || !strings.Contains(lines[0], "<") {
-		return res.Diagnostics(),
-			fmt.Errorf("can't parse bridge '%s' link details, unexpected output: %q", br, res.Stdout)
-	}
-	// Parse first line: "2: br0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 ..."
-	mtuRegex := regexp.MustCompile(`mtu (\d+)`)
-	if matches := mtuRegex.FindStringSubmatch(lines[0]); len(matches) > 1 {
-		x, err := strconv.ParseInt(matches[1], 10, 64)
-		if err != nil {
-			e := fmt.Errorf("invalid bridge '%s' MTU value '%s': %w", br, matches[1], err)
-			d := diag.Diagnostics{}
-			d.AddError("Can't find bridge interface MTU value", e.Error())
-			return d, e
-		}
-		model.MTU = types.Int64Value(x)
+		return diags, fmt.Errorf("can't retrieve bridge '%s' details: %w", br, err)
 	}
 
-	// Determine state from the administrative UP flag inside "<...>".
-	if linkFlagUp(lines[0]) {
-		model.State = types.StringValue("up")
-	} else {
-		model.State = types.StringValue("down")
+	model.MTU = types.Int64Value(int64(link.MTU))
+	model.State = linkState(link)
+	if link.MAC != "" {
+		model.MACAddress = types.StringValue(link.MAC)
+	}
+	if link.VlanFiltering != nil {
+		model.VlanFiltering = types.BoolValue(*link.VlanFiltering)
+	} else if model.VlanFiltering.IsUnknown() {
+		model.VlanFiltering = types.BoolNull()
+	}
+	if link.DefaultPVID != nil {
+		model.DefaultPVID = types.Int64Value(int64(*link.DefaultPVID))
+	} else if model.DefaultPVID.IsUnknown() {
+		model.DefaultPVID = types.Int64Null()
 	}
 
-	// Parse MAC address from second line: "    link/ether 00:11:22:33:44:55 brd ff:ff:ff:ff:ff:ff"
-	if len(lines) > 1 {
-		macRegex := regexp.MustCompile(`link/ether\s+([0-9a-fA-F:]+)`)
-		if matches := macRegex.FindStringSubmatch(lines[1]); len(matches) > 1 {
-			model.MACAddress = types.StringValue(matches[1])
-		}
+	// Report the configured IPv4/IPv6 address while it is still present,
+	// link-local addresses are not reported.
+	model.IPv4Address = pickIntfAddr(model.IPv4Address, link.Addrs4)
+	model.IPv6Address = pickIntfAddr(model.IPv6Address, link.Addrs6)
+
+	// Reconcile the set of interfaces this resource explicitly enslaved.
+	members, diags := managedMembers(model.EnslavedInterfaces, link)
+	if diags.HasError() {
+		return diags, fmt.Errorf("can't build bridge '%s' members set", br)
 	}
+	model.EnslavedInterfaces = members
 
-	// Get IP address(es) of bridge.
-	moreArgs = []string{"addr", "show", br}
-	res, err = r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve bridge '%s' addreses: %w", br, err)
-	}
-	// Look for IPv4 address in CIDR format: inet 192.168.1.1/24 brd ...
-	addrRegex := regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+/\d+)`)
-	if matches := addrRegex.FindStringSubmatch(res.Stdout); len(matches) > 1 {
-		// Validate using net.ParseCIDR to ensure it's properly formatted
-		if _, _, err := net.ParseCIDR(matches[1]); err == nil {
-			model.IPv4Address = types.StringValue(matches[1])
+	return nil, nil
+}
+
+// applyBridge reconciles the in-place settings of the bridge from old to new.
+// It is used both by Update (state -> plan) and by the drift self-heal in Read
+// (actual -> prior state). Unknown values in new are left alone. All changes
+// are applied as one batch.
+func (r *Bridge) applyBridge(ctx context.Context, resPath string, nl netLinks, old, new *BridgeModel) (diag.Diagnostics, error) {
+	br := new.Name.ValueString()
+	var ops []nlops.Op
+
+	// MTU, MAC address and the VLAN options.
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: br}
+	if !new.MTU.Equal(old.MTU) && !new.MTU.IsNull() && !new.MTU.IsUnknown() {
+		set.MTU = int(new.MTU.ValueInt64())
+	}
+	mac := old.MACAddress
+	if !new.MACAddress.Equal(old.MACAddress) && !new.MACAddress.IsNull() && !new.MACAddress.IsUnknown() {
+		set.MAC = new.MACAddress.ValueString()
+		mac = new.MACAddress
+	}
+	if !new.VlanFiltering.Equal(old.VlanFiltering) && !new.VlanFiltering.IsNull() && !new.VlanFiltering.IsUnknown() {
+		on := new.VlanFiltering.ValueBool()
+		set.VlanFiltering = &on
+	}
+	if !new.DefaultPVID.Equal(old.DefaultPVID) && !new.DefaultPVID.IsNull() && !new.DefaultPVID.IsUnknown() {
+		pvid := int(new.DefaultPVID.ValueInt64())
+		set.DefaultPVID = &pvid
+	}
+	if set.MTU > 0 || set.MAC != "" || set.VlanFiltering != nil || set.DefaultPVID != nil {
+		ops = append(ops, set)
+	}
+
+	// IPv4 / IPv6 addresses (del old, add new).
+	if !new.IPv4Address.Equal(old.IPv4Address) {
+		addrOps, err := intfAddrOps(br, old.IPv4Address, new.IPv4Address)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, addrOps...)
+	}
+	if !new.IPv6Address.Equal(old.IPv6Address) {
+		addrOps, err := intfAddrOps(br, old.IPv6Address, new.IPv6Address)
+		if err != nil {
+			return nil, err
 		}
+		ops = append(ops, addrOps...)
 	}
 
-	// Look for IPv6 address in CIDR format: inet6 fd00::1/64 scope ...
-	// Skip link-local addresses (fe80::/10) as these are auto-configured
-	addr6Regex := regexp.MustCompile(`inet6 ([0-9a-fA-F:]+/\d+)`)
-	matches := addr6Regex.FindAllStringSubmatch(res.Stdout, -1)
-	for _, match := range matches {
-		if len(match) > 1 {
-			// Parse and validate the address
-			ip, _, err := net.ParseCIDR(match[1])
+	// With an IPv6 address the bridge must also carry the link-local address
+	// derived from its MAC (see Create): add it when the IPv6 address was just
+	// configured, move it when the MAC changed.
+	if !new.IPv6Address.IsNull() && !mac.IsNull() && !mac.IsUnknown() {
+		oldMAC := ""
+		if !old.IPv6Address.IsNull() && !old.MACAddress.IsUnknown() {
+			oldMAC = old.MACAddress.ValueString()
+		}
+		if oldMAC != mac.ValueString() {
+			llOps, err := linkLocalOps(br, oldMAC, mac.ValueString())
 			if err != nil {
-				continue
-			}
-			// Skip link-local addresses (fe80::/10)
-			if !ip.IsLinkLocalUnicast() {
-				model.IPv6Address = types.StringValue(match[1])
-				break
+				return nil, err
 			}
+			ops = append(ops, llOps...)
 		}
 	}
 
-	// Reconcile the set of interfaces this resource explicitly enslaved.
-	//
-	// `ip link show master <br>` lists EVERY interface whose master is this
-	// bridge, but other resources may attach members on their own (e.g. a
-	// zedamigo_tap with its own `master` set). Those foreign members must not
-	// land in `enslaved_interfaces`: this attribute is RequiresReplace, so
-	// reporting them would force a spurious destroy/recreate of the bridge.
-	//
-	// Instead we reconcile only against the interfaces already recorded in the
-	// incoming model (prior state on Read, the configured set on Create): keep
-	// the ones we manage that are still members (so real drift is detected),
-	// drop everything else, and stay null when we manage none.
-	if model.EnslavedInterfaces.IsNull() || model.EnslavedInterfaces.IsUnknown() {
-		model.EnslavedInterfaces = types.SetNull(types.StringType)
-	} else {
-		moreArgs = []string{"link", "show", "master", br}
-		res, err = r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			return res.Diagnostics(), fmt.Errorf("can't retrieve bridge '%s' members: %w", br, err)
+	// Members: add/remove the delta in place.
+	if !new.EnslavedInterfaces.IsUnknown() {
+		newMembers, diags := lagMembersSlice(ctx, new.EnslavedInterfaces)
+		if diags.HasError() {
+			return diags, fmt.Errorf("can't read bridge '%s' members", br)
 		}
-		// Capture the interface name from each index line, stopping at ':'
-		// (plain names) or '@' (e.g. VLAN sub-interfaces like "eth1.10@eth1").
-		memberRegex := regexp.MustCompile(`(?m)^\s*\d+:\s+([^:@\s]+)`)
-		current := make(map[string]bool)
-		for _, m := range memberRegex.FindAllStringSubmatch(res.Stdout, -1) {
-			if len(m) > 1 {
-				current[m[1]] = true
-			}
+		oldMembers, diags := lagMembersSlice(ctx, old.EnslavedInterfaces)
+		if diags.HasError() {
+			return diags, fmt.Errorf("can't read bridge '%s' members", br)
 		}
 
-		// Keep only managed interfaces that are still members of the bridge.
-		kept := make([]attr.Value, 0, len(model.EnslavedInterfaces.Elements()))
-		for _, e := range model.EnslavedInterfaces.Elements() {
-			s, ok := e.(types.String)
-			if !ok || s.IsNull() || s.IsUnknown() {
-				continue
-			}
-			if current[s.ValueString()] {
-				kept = append(kept, s)
-			}
+		// Release first, then enslave, so an interface moving between bridges
+		// doesn't fail with "already has a master".
+		for _, intf := range stringsDifference(oldMembers, newMembers) {
+			ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: intf, NoMaster: true})
 		}
-		if len(kept) > 0 {
-			members, diags := types.SetValue(types.StringType, kept)
-			if diags.HasError() {
-				return diags, fmt.Errorf("can't build bridge '%s' members set", br)
-			}
-			model.EnslavedInterfaces = members
-		} else {
-			// Nothing we manage remains: keep null to match an unconfigured plan.
-			model.EnslavedInterfaces = types.SetNull(types.StringType)
+		for _, intf := range stringsDifference(newMembers, oldMembers) {
+			ops = append(ops, bridgeMemberOp(br, intf))
 		}
 	}
 
+	// State last, after members are attached.
+	if !new.State.Equal(old.State) && !new.State.IsNull() && !new.State.IsUnknown() {
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: br, State: new.State.ValueString()})
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply bridge '%s' settings: %w", br, err)
+	}
 	return nil, nil
 }
+
+// bridgeMemberOp attaches intf as a member of br and brings it up. NOTE: the
+// member MUST be brought up after setting the master, which is the order of
+// an OpLinkSet.
+func bridgeMemberOp(br, intf string) nlops.Op {
+	return nlops.Op{Kind: nlops.OpLinkSet, Name: intf, Master: br, State: "up"}
+}
+
+// bridgeHealTarget returns the settings Read restores when the actual bridge
+// drifted from the prior state, and whether it did. An address that was never
+// configured is not a drift: whatever else put one there is left alone.
+func bridgeHealTarget(prior, actual BridgeModel) (BridgeModel, bool) {
+	want := prior
+	if want.IPv4Address.IsNull() {
+		want.IPv4Address = actual.IPv4Address
+	}
+	if want.IPv6Address.IsNull() {
+		want.IPv6Address = actual.IPv6Address
+	}
+
+	drift := !want.MTU.Equal(actual.MTU) ||
+		!want.State.Equal(actual.State) ||
+		!want.MACAddress.Equal(actual.MACAddress) ||
+		!want.VlanFiltering.Equal(actual.VlanFiltering) ||
+		!want.DefaultPVID.Equal(actual.DefaultPVID) ||
+		!want.IPv4Address.Equal(actual.IPv4Address) ||
+		!want.IPv6Address.Equal(actual.IPv6Address) ||
+		!want.EnslavedInterfaces.Equal(actual.EnslavedInterfaces)
+	return want, drift
+}
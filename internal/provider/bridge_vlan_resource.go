@@ -0,0 +1,533 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/setvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	bridgeVlansDir = "bridge_vlans"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &BridgeVlan{}
+	_ resource.ResourceWithImportState    = &BridgeVlan{}
+	_ resource.ResourceWithValidateConfig = &BridgeVlan{}
+)
+
+func NewBridgeVlan() resource.Resource {
+	return &BridgeVlan{}
+}
+
+// BridgeVlan defines the resource implementation.
+type BridgeVlan struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// BridgeVlanModel describes the resource data model.
+type BridgeVlanModel struct {
+	ID        types.String `tfsdk:"id"`
+	Bridge    types.String `tfsdk:"bridge"`
+	Interface types.String `tfsdk:"interface"`
+	NetNS     types.String `tfsdk:"netns"`
+	// Tagged and Untagged are the VLAN IDs the port is a member of, egressing
+	// tagged and untagged respectively. Together they are the whole VLAN
+	// membership of the port.
+	Tagged   types.Set   `tfsdk:"tagged"`
+	Untagged types.Set   `tfsdk:"untagged"`
+	PVID     types.Int64 `tfsdk:"pvid"`
+}
+
+func (r *BridgeVlan) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, bridgeVlansDir, id)
+}
+
+func (r *BridgeVlan) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_bridge_vlan"
+}
+
+func (r *BridgeVlan) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	vidValidators := []validator.Set{
+		setvalidator.ValueInt64sAre(int64validator.Between(1, 4094)),
+	}
+
+	resp.Schema = schema.Schema{
+		Description: "Bridge VLAN membership",
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Set the VLAN membership of a port of a VLAN-aware `zedamigo_bridge` (see its " +
+			"`vlan_filtering`), like `bridge vlan add`, through netlink or iproute2 commands (see the provider " +
+			"`network_backend`). The resource owns the whole membership of the port: VLANs not listed, like " +
+			"the one of the bridge `default_pvid` the port joined when it was attached, are removed, and a " +
+			"membership changed outside of Terraform shows up as a difference in the next plan. On delete the " +
+			"port goes back to the bridge `default_pvid`.",
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Bridge VLAN membership identifier",
+				MarkdownDescription: "Bridge VLAN membership identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"bridge": schema.StringAttribute{
+				Description: "Name of the bridge",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				MarkdownDescription: "Name of the port: an interface (a TAP, VLAN or LAG) attached to `bridge`, " +
+					"or `bridge` itself for the VLANs of the bridge interface on the host.",
+				Required: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace of the bridge",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"tagged": schema.SetAttribute{
+				MarkdownDescription: "VLAN IDs carried tagged on the port, e.g. the VLANs of a trunk.",
+				Optional:            true,
+				ElementType:         types.Int64Type,
+				Validators:          vidValidators,
+			},
+			"untagged": schema.SetAttribute{
+				MarkdownDescription: "VLAN IDs that egress the port untagged, usually only the access VLAN " +
+					"(also set as `pvid`) or the native VLAN of a trunk.",
+				Optional:    true,
+				ElementType: types.Int64Type,
+				Validators:  vidValidators,
+			},
+			"pvid": schema.Int64Attribute{
+				MarkdownDescription: "VLAN ID untagged frames received on the port are assigned to. It must be " +
+					"one of `tagged` or `untagged`. Optional and if not specified untagged frames are dropped.",
+				Optional: true,
+				Validators: []validator.Int64{
+					int64validator.Between(1, 4094),
+				},
+			},
+		},
+	}
+}
+
+func (r *BridgeVlan) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_bridge_vlan", &resp.Diagnostics)
+	if conf.NetworkBackend == networkBackendIPRoute2 && conf.Bridge == "" {
+		resp.Diagnostics.AddError("zedamigo_bridge_vlan requires the `bridge` command.",
+			"With the `iproute2` network backend the zedamigo_bridge_vlan resource runs the `bridge` command "+
+				"of iproute2, which was not found on the target.")
+	}
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "BridgeVlan resource configure debugging", traceData)
+}
+
+// ValidateConfig rejects a membership the kernel would silently accept
+// differently: a VLAN can't be both tagged and untagged, and the PVID must be
+// one of the port's VLANs.
+func (r *BridgeVlan) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data BridgeVlanModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if data.Tagged.IsUnknown() || data.Untagged.IsUnknown() || data.PVID.IsUnknown() {
+		return
+	}
+
+	var tagged, untagged []int64
+	if !data.Tagged.IsNull() {
+		resp.Diagnostics.Append(data.Tagged.ElementsAs(ctx, &tagged, false)...)
+	}
+	if !data.Untagged.IsNull() {
+		resp.Diagnostics.Append(data.Untagged.ElementsAs(ctx, &untagged, false)...)
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for _, vid := range tagged {
+		if slices.Contains(untagged, vid) {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("untagged"),
+				"Invalid untagged usage",
+				fmt.Sprintf("VLAN %d can't be both in \"tagged\" and \"untagged\".", vid),
+			)
+		}
+	}
+
+	if !data.PVID.IsNull() {
+		pvid := data.PVID.ValueInt64()
+		if !slices.Contains(tagged, pvid) && !slices.Contains(untagged, pvid) {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("pvid"),
+				"Invalid pvid usage",
+				fmt.Sprintf("\"pvid\" %d must also be in \"tagged\" or \"untagged\".", pvid),
+			)
+		}
+	}
+}
+
+func (r *BridgeVlan) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data BridgeVlanModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	// The current membership, to replace it, e.g. the default PVID the port
+	// joined when it was attached to the bridge.
+	link, diags, err := nl.show(ctx, d, data.Interface.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Error",
+			fmt.Sprintf("Can't retrieve port '%s' details: %v", data.Interface.ValueString(), err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	if !isBridgePort(data, link) {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Error",
+			fmt.Sprintf("Interface '%s' is not attached to bridge '%s'.", data.Interface.ValueString(), data.Bridge.ValueString()))
+		return
+	}
+
+	want, diags := bridgeVlansWanted(ctx, data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if diags, err := r.applyBridgeVlans(ctx, d, nl, data, link.Vlans, want); err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Error",
+			fmt.Sprintf("Unable to set the VLANs of port '%s': %v", data.Interface.ValueString(), err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readBridgeVlan(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read bridge VLAN state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "Bridge VLAN Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *BridgeVlan) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data BridgeVlanModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	if diags, err := r.readBridgeVlan(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// The port was deleted outside Terraform, and its VLANs with
+			// it: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read bridge VLAN state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *BridgeVlan) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan BridgeVlanModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(plan.ID.ValueString())
+	nl := newNetLinks(r.providerConf, plan.NetNS.ValueString())
+
+	// Reconcile from the actual membership rather than the prior state, Read
+	// only reports a drift.
+	link, diags, err := nl.show(ctx, d, plan.Interface.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Update Error",
+			fmt.Sprintf("Can't retrieve port '%s' details: %v", plan.Interface.ValueString(), err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	if !isBridgePort(plan, link) {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Update Error",
+			fmt.Sprintf("Interface '%s' is not attached to bridge '%s'.", plan.Interface.ValueString(), plan.Bridge.ValueString()))
+		return
+	}
+
+	want, diags := bridgeVlansWanted(ctx, plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if diags, err := r.applyBridgeVlans(ctx, d, nl, plan, link.Vlans, want); err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Update Error",
+			fmt.Sprintf("Unable to set the VLANs of port '%s': %v", plan.Interface.ValueString(), err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readBridgeVlan(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read bridge VLAN state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *BridgeVlan) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data BridgeVlanModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	// Put the port back to the bridge default PVID. A port (or bridge) that
+	// is already gone has nothing left to clean up.
+	port, _, err := nl.show(ctx, d, data.Interface.ValueString())
+	if err == nil && isBridgePort(data, port) {
+		var want []nlops.BridgeVlan
+		br, diags, err := nl.show(ctx, d, data.Bridge.ValueString())
+		if err != nil && !errors.Is(err, nlops.ErrNotFound) {
+			resp.Diagnostics.AddError("Failed to delete bridge VLANs",
+				fmt.Sprintf("Can't retrieve bridge '%s' details: %v", data.Bridge.ValueString(), err))
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err == nil && br.DefaultPVID != nil && *br.DefaultPVID > 0 {
+			want = []nlops.BridgeVlan{{VID: *br.DefaultPVID, PVID: true, Untagged: true}}
+		}
+		if diags, err := r.applyBridgeVlans(ctx, d, nl, data, port.Vlans, want); err != nil {
+			resp.Diagnostics.AddError("Failed to delete bridge VLANs", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	} else if err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete bridge VLANs",
+			fmt.Sprintf("Can't retrieve port '%s' details: %v", data.Interface.ValueString(), err))
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Bridge VLAN Resource Delete Error",
+			fmt.Sprintf("Can't delete bridge VLAN resource directory: %v", err))
+		return
+	}
+}
+
+func (r *BridgeVlan) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+func (r *BridgeVlan) readBridgeVlan(ctx context.Context, resPath string, nl netLinks, model *BridgeVlanModel) (diag.Diagnostics, error) {
+	intf := model.Interface.ValueString()
+
+	link, diags, err := nl.show(ctx, resPath, intf)
+	if err != nil {
+		return diags, fmt.Errorf("can't retrieve port '%s' details: %w", intf, err)
+	}
+
+	// A port released from the bridge lost its VLANs.
+	vlans := link.Vlans
+	if !isBridgePort(*model, link) {
+		vlans = nil
+	}
+	if diags := setBridgeVlans(ctx, model, vlans); diags.HasError() {
+		return diags, fmt.Errorf("can't build port '%s' VLAN sets", intf)
+	}
+	return nil, nil
+}
+
+// applyBridgeVlans changes the VLAN membership of the port of model from cur
+// to want, in one batch.
+func (r *BridgeVlan) applyBridgeVlans(ctx context.Context, resPath string, nl netLinks, model BridgeVlanModel, cur, want []nlops.BridgeVlan) (diag.Diagnostics, error) {
+	ops := bridgeVlanOps(model.Interface.ValueString(), model.Interface.Equal(model.Bridge), cur, want)
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	return nl.apply(ctx, resPath, ops...)
+}
+
+// isBridgePort reports whether link is a port of the bridge of model, or the
+// bridge itself.
+func isBridgePort(model BridgeVlanModel, link nlops.Link) bool {
+	br := model.Bridge.ValueString()
+	return link.Name == br || link.Master == br
+}
+
+// bridgeVlansWanted returns the VLAN membership configured in model.
+func bridgeVlansWanted(ctx context.Context, model BridgeVlanModel) ([]nlops.BridgeVlan, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	var tagged, untagged []int64
+	if !model.Tagged.IsNull() {
+		diags.Append(model.Tagged.ElementsAs(ctx, &tagged, false)...)
+	}
+	if !model.Untagged.IsNull() {
+		diags.Append(model.Untagged.ElementsAs(ctx, &untagged, false)...)
+	}
+	if diags.HasError() {
+		return nil, diags
+	}
+
+	var want []nlops.BridgeVlan
+	for _, vids := range []struct {
+		vids     []int64
+		untagged bool
+	}{{tagged, false}, {untagged, true}} {
+		for _, vid := range vids.vids {
+			want = append(want, nlops.BridgeVlan{
+				VID:      int(vid),
+				PVID:     !model.PVID.IsNull() && model.PVID.ValueInt64() == vid,
+				Untagged: vids.untagged,
+			})
+		}
+	}
+	slices.SortFunc(want, func(a, b nlops.BridgeVlan) int { return a.VID - b.VID })
+	return want, nil
+}
+
+// bridgeVlanOps returns the ops that change the VLAN membership of port from
+// cur to want: VLANs that are not wanted are removed, the ones that are new
+// or have different flags are (re-)added.
+func bridgeVlanOps(port string, self bool, cur, want []nlops.BridgeVlan) []nlops.Op {
+	del := nlops.Op{Kind: nlops.OpBridgeVlanDel, Name: port, Self: self}
+	for _, c := range cur {
+		if !slices.ContainsFunc(want, func(w nlops.BridgeVlan) bool { return w.VID == c.VID }) {
+			del.Vlans = append(del.Vlans, nlops.BridgeVlan{VID: c.VID})
+		}
+	}
+	add := nlops.Op{Kind: nlops.OpBridgeVlanAdd, Name: port, Self: self}
+	for _, w := range want {
+		if !slices.Contains(cur, w) {
+			add.Vlans = append(add.Vlans, w)
+		}
+	}
+
+	var ops []nlops.Op
+	if len(del.Vlans) > 0 {
+		ops = append(ops, del)
+	}
+	if len(add.Vlans) > 0 {
+		ops = append(ops, add)
+	}
+	return ops
+}
+
+// setBridgeVlans reports the membership vlans in model. An empty set that
+// was not configured stays null.
+func setBridgeVlans(ctx context.Context, model *BridgeVlanModel, vlans []nlops.BridgeVlan) diag.Diagnostics {
+	var diags diag.Diagnostics
+	tagged, untagged := []int64{}, []int64{}
+	model.PVID = types.Int64Null()
+	for _, v := range vlans {
+		if v.Untagged {
+			untagged = append(untagged, int64(v.VID))
+		} else {
+			tagged = append(tagged, int64(v.VID))
+		}
+		if v.PVID {
+			model.PVID = types.Int64Value(int64(v.VID))
+		}
+	}
+
+	vidSet := func(prior types.Set, vids []int64) types.Set {
+		if len(vids) == 0 && prior.IsNull() {
+			return prior
+		}
+		s, d := types.SetValueFrom(ctx, types.Int64Type, vids)
+		diags.Append(d...)
+		return s
+	}
+	model.Tagged = vidSet(model.Tagged, tagged)
+	model.Untagged = vidSet(model.Untagged, untagged)
+	return diags
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+func TestBridgeVlansWanted(t *testing.T) {
+	is := is.New(t)
+	tagged, _ := types.SetValueFrom(t.Context(), types.Int64Type, []int64{30, 20})
+	untagged, _ := types.SetValueFrom(t.Context(), types.Int64Type, []int64{10})
+
+	// A trunk with a native VLAN.
+	want, diags := bridgeVlansWanted(t.Context(), BridgeVlanModel{
+		Tagged:   tagged,
+		Untagged: untagged,
+		PVID:     types.Int64Value(10),
+	})
+	is.True(!diags.HasError())
+	is.Equal(want, []nlops.BridgeVlan{
+		{VID: 10, PVID: true, Untagged: true},
+		{VID: 20},
+		{VID: 30},
+	})
+
+	want, diags = bridgeVlansWanted(t.Context(), BridgeVlanModel{
+		Tagged:   types.SetNull(types.Int64Type),
+		Untagged: types.SetNull(types.Int64Type),
+		PVID:     types.Int64Null(),
+	})
+	is.True(!diags.HasError())
+	is.Equal(len(want), 0)
+}
+
+func TestBridgeVlanOps(t *testing.T) {
+	is := is.New(t)
+
+	// An access port replacing the default PVID the port joined.
+	cur := []nlops.BridgeVlan{{VID: 1, PVID: true, Untagged: true}}
+	want := []nlops.BridgeVlan{{VID: 10, PVID: true, Untagged: true}}
+	is.Equal(bridgeVlanOps("tap0", false, cur, want), []nlops.Op{
+		{Kind: nlops.OpBridgeVlanDel, Name: "tap0", Vlans: []nlops.BridgeVlan{{VID: 1}}},
+		{Kind: nlops.OpBridgeVlanAdd, Name: "tap0", Vlans: want},
+	})
+
+	// Only changed flags are re-added, nothing to do when in sync.
+	cur = []nlops.BridgeVlan{{VID: 10, PVID: true, Untagged: true}, {VID: 20}}
+	want = []nlops.BridgeVlan{{VID: 10}, {VID: 20}}
+	is.Equal(bridgeVlanOps("br0", true, cur, want), []nlops.Op{
+		{Kind: nlops.OpBridgeVlanAdd, Name: "br0", Self: true, Vlans: []nlops.BridgeVlan{{VID: 10}}},
+	})
+	is.Equal(len(bridgeVlanOps("tap0", false, want, want)), 0)
+}
+
+func TestSetBridgeVlans(t *testing.T) {
+	is := is.New(t)
+	m := BridgeVlanModel{
+		Tagged:   types.SetNull(types.Int64Type),
+		Untagged: types.SetNull(types.Int64Type),
+		PVID:     types.Int64Value(10),
+	}
+
+	// Not configured and empty stays null.
+	diags := setBridgeVlans(t.Context(), &m, []nlops.BridgeVlan{{VID: 10, PVID: true, Untagged: true}})
+	is.True(!diags.HasError())
+	is.True(m.Tagged.IsNull())
+	wantUntagged, _ := types.SetValueFrom(t.Context(), types.Int64Type, []int64{10})
+	is.True(m.Untagged.Equal(wantUntagged))
+	is.Equal(m.PVID, types.Int64Value(10))
+
+	// The membership was dropped, e.g. the port was released: a drift.
+	diags = setBridgeVlans(t.Context(), &m, nil)
+	is.True(!diags.HasError())
+	is.Equal(len(m.Untagged.Elements()), 0)
+	is.True(m.PVID.IsNull())
+}
@@ -6,21 +6,27 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
 	"github.com/davecgh/go-spew/spew"
-	"github.com/hashicorp/terraform-plugin-framework-validators/objectvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
@@ -28,8 +34,10 @@ import (
 )
 
 const (
-	dhcp6SrvsDir        = "dhcp6_servers"
-	dhcp6ConfigTemplate = `# CoreDHCP config for simple DHCP v6 server for a specific interface.
+	dhcp6SrvsDir           = "dhcp6_servers"
+	dhcp6ServerStopPoll    = 100 * time.Millisecond
+	dhcp6ServerStopTimeout = 5 * time.Second
+	dhcp6ConfigTemplate    = `# CoreDHCP config for simple DHCP v6 server for a specific interface.
 server6:
   listen:
     - "[ff02::1:2%{{ .Interface }}]"
@@ -39,15 +47,26 @@ server6:
     # The supported DUID formats are LL and LLT
     - server_id: LL {{ .ServerID }}
     - dns: {{ .NameServer }}
+{{- if .DomainSearch }}
+    - searchdomains: {{ .DomainSearch }}
+{{- end }}
+{{- if .SNTPServers }}
+    - sntp: {{ .SNTPServers }}
+{{- end }}
+{{- if .Stateful }}
     - range: {{ .LeasesFile }} {{ .PoolStart }} {{ .PoolEnd }} {{ .LeaseTime }}s
-{{ if .Prefix }}    - prefix: "{{ .Prefix }}"{{ end }}
+{{- end }}
+{{- if .Prefix }}
+    - prefix: "{{ .Prefix }}"
+{{- end }}
 `
 )
 
 // Ensure provider defined types fully satisfy framework interfaces.
 var (
-	_ resource.Resource                = &DHCP6Server{}
-	_ resource.ResourceWithImportState = &DHCP6Server{}
+	_ resource.Resource                   = &DHCP6Server{}
+	_ resource.ResourceWithImportState    = &DHCP6Server{}
+	_ resource.ResourceWithValidateConfig = &DHCP6Server{}
 )
 
 func NewDHCP6Server() resource.Resource {
@@ -65,19 +84,31 @@ type DHCP6PoolModel struct {
 	End   types.String `tfsdk:"end"`
 }
 
+// DHCP6PrefixDelegationModel describes the delegated prefixes pool.
+type DHCP6PrefixDelegationModel struct {
+	Prefix types.String `tfsdk:"prefix"`
+	Length types.Int64  `tfsdk:"length"`
+}
+
 // DHCP6ServerModel describes the resource data model.
 type DHCP6ServerModel struct {
-	ID         types.String    `tfsdk:"id"`
-	Interface  types.String    `tfsdk:"interface"`
-	ServerID   types.String    `tfsdk:"server_id"`
-	Prefix     types.String    `tfsdk:"prefix"`
-	NameServer types.String    `tfsdk:"nameserver"`
-	Pool       *DHCP6PoolModel `tfsdk:"pool"`
-	LeaseTime  types.Int64     `tfsdk:"lease_time"`
-	LeasesFile types.String    `tfsdk:"leases_file"`
-	ConfigFile types.String    `tfsdk:"config_file"`
-	PIDFile    types.String    `tfsdk:"pid_file"`
-	State      types.String    `tfsdk:"state"`
+	ID               types.String                `tfsdk:"id"`
+	Interface        types.String                `tfsdk:"interface"`
+	ServerID         types.String                `tfsdk:"server_id"`
+	Mode             types.String                `tfsdk:"mode"`
+	Prefix           types.String                `tfsdk:"prefix"`
+	PrefixDelegation *DHCP6PrefixDelegationModel `tfsdk:"prefix_delegation"`
+	NameServer       types.String                `tfsdk:"nameserver"`
+	DomainSearch     types.List                  `tfsdk:"domain_search"`
+	SNTPServers      types.List                  `tfsdk:"sntp_servers"`
+	Pool             *DHCP6PoolModel             `tfsdk:"pool"`
+	LeaseTime        types.Int64                 `tfsdk:"lease_time"`
+	LeasesFile       types.String                `tfsdk:"leases_file"`
+	ConfigFile       types.String                `tfsdk:"config_file"`
+	PIDFile          types.String                `tfsdk:"pid_file"`
+	State            types.String                `tfsdk:"state"`
+	Restarts         types.Int64                 `tfsdk:"restarts"`
+	LastExit         types.String                `tfsdk:"last_exit"`
 }
 
 func (r *DHCP6Server) getResourceDir(id string) string {
@@ -93,6 +124,12 @@ func (r *DHCP6Server) Schema(ctx context.Context, req resource.SchemaRequest, re
 		Description: "Simple DHCP v6 server for a specific interface",
 		MarkdownDescription: undent.Md(`Create and manage a DHCP v6 server instance with a simple configuration
 		that listens on a specific interface. Uses an embedded instance of CoreDHCP (https://github.com/coredhcp/coredhcp).
+		In the |stateful| mode it leases addresses (IA_NA) from the |pool|, to be paired with a |zedamigo_radv| with
+		|managed_config|. In the |stateless| mode it only answers with options (DNS, domain search, SNTP), to be paired
+		with a |zedamigo_radv| with |other_config| and SLAAC. In both modes it can also delegate prefixes (IA_PD) to
+		routers, e.g. to EVE, with |prefix_delegation|.
+		Changing the configuration rewrites it and restarts the daemon in place. The address leases are kept, the
+		delegated prefixes are only kept in memory and the clients get them again when they renew.
 		NOTE: Static routes are not supported for DHCPv6.
 		NOTE: If the host has a firewall configuration that might drop incoming UDP port 547 packets. Double check that.
 		This resource DOES NOT manage the host firewall configuration.`),
@@ -116,11 +153,22 @@ func (r *DHCP6Server) Schema(ctx context.Context, req resource.SchemaRequest, re
 				Optional:    false,
 				Required:    true,
 			},
+			"mode": schema.StringAttribute{
+				Description: "`stateful` (default) to lease addresses from the `pool`, or `stateless` to only " +
+					"answer with options",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("stateful"),
+				Validators: []validator.String{
+					stringvalidator.OneOf("stateful", "stateless"),
+				},
+			},
 			"prefix": schema.StringAttribute{
 				Description:         "Prefix delegation",
-				MarkdownDescription: undent.Md(`Prefix delegation`),
+				MarkdownDescription: undent.Md(`Prefix delegation, the prefixes pool and the delegated prefix length, e.g. |2001:db8:200::/48 56|.`),
 				Optional:            true,
 				Required:            false,
+				DeprecationMessage:  "Use the prefix_delegation block instead.",
 			},
 			"nameserver": schema.StringAttribute{
 				Description: "Nameserver (DNS) IPv6 address",
@@ -130,6 +178,22 @@ func (r *DHCP6Server) Schema(ctx context.Context, req resource.SchemaRequest, re
 				Optional: false,
 				Required: true,
 			},
+			"domain_search": schema.ListAttribute{
+				Description: "Domain search list (option 24) of the clients",
+				ElementType: types.StringType,
+				Optional:    true,
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(
+						stringvalidator.RegexMatches(dhcpHostnameRegex, "must be a valid domain name"),
+					),
+				},
+			},
+			"sntp_servers": schema.ListAttribute{
+				Description: "IPv6 addresses of SNTP servers (option 31), sent to the clients that request them, " +
+					"e.g. the address of a `zedamigo_ntp_server`",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
 			"lease_time": schema.Int64Attribute{
 				Description: "DHCPv6 lease time in seconds",
 				MarkdownDescription: undent.Md(`DHCPv6 lease time in seconds. This determines how long a client can use an assigned IPv6 address before needing to renew the lease.
@@ -140,15 +204,26 @@ func (r *DHCP6Server) Schema(ctx context.Context, req resource.SchemaRequest, re
 			"leases_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "The sqlite3 leases file used by this instance of CoreDHCP",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"config_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "The auto-generated CoreDHCP configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"pid_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 			"state": schema.StringAttribute{
 				Optional:    true,
 				Computed:    true,
@@ -159,10 +234,8 @@ func (r *DHCP6Server) Schema(ctx context.Context, req resource.SchemaRequest, re
 		},
 		Blocks: map[string]schema.Block{
 			"pool": schema.SingleNestedBlock{
-				Description: "DHCP v6 address pool configuration for dynamic allocation",
-				Validators: []validator.Object{
-					objectvalidator.IsRequired(),
-				},
+				Description: "DHCP v6 address pool configuration for dynamic allocation, required in the `stateful` " +
+					"mode and not allowed in the `stateless` one",
 				Attributes: map[string]schema.Attribute{
 					"start": schema.StringAttribute{
 						Description: "DHCP v6 pool first IPv6 address for dynamic allocation",
@@ -174,10 +247,72 @@ func (r *DHCP6Server) Schema(ctx context.Context, req resource.SchemaRequest, re
 					},
 				},
 			},
+			"prefix_delegation": schema.SingleNestedBlock{
+				Description: "Prefix delegation (IA_PD): the pool from which prefixes of `length` are delegated to the " +
+					"clients that ask for them.",
+				Attributes: map[string]schema.Attribute{
+					"prefix": schema.StringAttribute{
+						Description: "Pool of the delegated prefixes, e.g. `2001:db8:200::/48`",
+						Required:    true,
+					},
+					"length": schema.Int64Attribute{
+						Description: "Length of the delegated prefixes, e.g. `56` for 256 of them out of a /48",
+						Required:    true,
+						Validators: []validator.Int64{
+							int64validator.Between(1, 128),
+						},
+					},
+				},
+			},
 		},
 	}
 }
 
+func (r *DHCP6Server) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data DHCP6ServerModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.Mode.IsUnknown() {
+		stateless := data.Mode.ValueString() == "stateless"
+		if !stateless && data.Pool == nil {
+			resp.Diagnostics.AddAttributeError(path.Root("pool"), "Missing pool",
+				"The pool block is required in the stateful mode.")
+		}
+		if stateless && data.Pool != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("pool"), "Unexpected pool",
+				"The pool block is not used in the stateless mode, no addresses are leased.")
+		}
+	}
+
+	if !data.Prefix.IsNull() && data.PrefixDelegation != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("prefix"), "Conflicting prefix delegation",
+			"Only one of prefix and prefix_delegation can be set.")
+	}
+	if pd := data.PrefixDelegation; pd != nil && !pd.Prefix.IsUnknown() && !pd.Length.IsUnknown() {
+		if _, err := dhcp6PrefixDelegation(pd.Prefix.ValueString(), pd.Length.ValueInt64()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("prefix_delegation"), "Invalid prefix delegation", err.Error())
+		}
+	}
+
+	if !data.SNTPServers.IsUnknown() {
+		var servers []types.String
+		resp.Diagnostics.Append(data.SNTPServers.ElementsAs(ctx, &servers, false)...)
+		for i, srv := range servers {
+			if srv.IsUnknown() {
+				continue
+			}
+			if ip := net.ParseIP(srv.ValueString()); ip == nil || ip.To4() != nil {
+				resp.Diagnostics.AddAttributeError(path.Root("sntp_servers").AtListIndex(i), "Invalid SNTP server",
+					fmt.Sprintf("%q is not an IPv6 address.", srv.ValueString()))
+			}
+		}
+	}
+}
+
 func (r *DHCP6Server) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
 	// Prevent panic if the provider has not been configured.
 	if req.ProviderData == nil {
@@ -233,62 +368,16 @@ func (r *DHCP6Server) Create(ctx context.Context, req resource.CreateRequest, re
 		return
 	}
 
-	tmpl, err := template.New("config").Parse(dhcp6ConfigTemplate)
-	if err != nil {
-		resp.Diagnostics.AddError("DHCP6Server Resource Error",
-			fmt.Sprintf("Unable to parse config template: %s", err))
-		return
-	}
-
-	leasesPath := filepath.Join(d, "leases.sqlite3")
-	confPath := filepath.Join(d, "config.yaml")
-	confFile, err := r.providerConf.Exec.OpenWrite(ctx, confPath, 0o644)
-	if err != nil {
-		resp.Diagnostics.AddError("DHCP6Server Resource Error",
-			fmt.Sprintf("Can't create file '%s': %s", confPath, err))
-		return
-	}
-	defer confFile.Close()
-	data.ConfigFile = types.StringValue(confPath)
-	data.LeasesFile = types.StringValue(leasesPath)
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.LeasesFile = types.StringValue(filepath.Join(d, "leases.sqlite3"))
 
 	// Set default lease time if not specified.
 	if data.LeaseTime.IsNull() || data.LeaseTime.IsUnknown() {
 		data.LeaseTime = types.Int64Value(3600)
 	}
 
-	// Validate pool is not nil
-	if data.Pool == nil {
-		resp.Diagnostics.AddError("DHCP6Server Resource Error",
-			"Pool configuration is required but was not provided")
-		return
-	}
-
-	// If we don't do this mapping and try to directly pass `data` to
-	// template.Execute then that will call field.String() which returns
-	// the value double-quoted.
-	td := struct {
-		Interface  string
-		ServerID   string
-		Prefix     string
-		NameServer string
-		PoolStart  string
-		PoolEnd    string
-		LeaseTime  int64
-		LeasesFile string
-	}{
-		Interface:  data.Interface.ValueString(),
-		ServerID:   data.ServerID.ValueString(),
-		Prefix:     data.Prefix.ValueString(),
-		NameServer: data.NameServer.ValueString(),
-		PoolStart:  data.Pool.Start.ValueString(),
-		PoolEnd:    data.Pool.End.ValueString(),
-		LeaseTime:  data.LeaseTime.ValueInt64(),
-		LeasesFile: data.LeasesFile.ValueString(),
-	}
-	if err := tmpl.Execute(confFile, td); err != nil {
-		resp.Diagnostics.AddError("DHCP6Server Resource Error",
-			fmt.Sprintf("Can't write templated config file '%s': %s", confPath, err))
+	if diags := writeDHCP6ServerConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
 		return
 	}
 
@@ -362,35 +451,45 @@ func (r *DHCP6Server) Update(ctx context.Context, req resource.UpdateRequest, re
 
 	d := r.getResourceDir(state.ID.ValueString())
 
-	// Validate pool is not nil
-	if plan.Pool == nil || state.Pool == nil {
-		resp.Diagnostics.AddError("DHCP6Server Resource Update Error",
-			"Pool configuration is required but was not provided")
-		return
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+	plan.LeasesFile = state.LeasesFile
+	if plan.LeaseTime.IsNull() || plan.LeaseTime.IsUnknown() {
+		plan.LeaseTime = types.Int64Value(3600)
 	}
 
-	// Check if only the state field changed
-	stateChanged := !plan.State.Equal(state.State)
-	poolChanged := !plan.Pool.Start.Equal(state.Pool.Start) || !plan.Pool.End.Equal(state.Pool.End)
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file,
+	// CoreDHCP reads it only on start.
 	configChanged := !plan.Interface.Equal(state.Interface) ||
 		!plan.ServerID.Equal(state.ServerID) ||
+		!plan.Mode.Equal(state.Mode) ||
 		!plan.Prefix.Equal(state.Prefix) ||
+		!equalDHCP6PrefixDelegation(plan.PrefixDelegation, state.PrefixDelegation) ||
 		!plan.NameServer.Equal(state.NameServer) ||
-		poolChanged ||
+		!plan.DomainSearch.Equal(state.DomainSearch) ||
+		!plan.SNTPServers.Equal(state.SNTPServers) ||
+		!equalDHCP6Pool(plan.Pool, state.Pool) ||
 		!plan.LeaseTime.Equal(state.LeaseTime)
-
 	if configChanged {
-		resp.Diagnostics.AddError("DHCP6Server Resource Update Error",
-			"Configuration changes require resource recreation. Only the 'state' field can be updated in-place.")
-		return
-	}
-
-	if stateChanged {
-		desiredState := plan.State.ValueString()
-		if desiredState == "" {
-			desiredState = "running"
+		if diags := writeDHCP6ServerConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopDHCP6Server(ctx, d); err != nil {
+			resp.Diagnostics.AddError("DHCP6Server Resource Update Error",
+				fmt.Sprintf("Failed to stop DHCPv6 server: %v", err))
+			return
 		}
+		tflog.Info(ctx, "DHCPv6 server configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
 
+	if configChanged || !plan.State.Equal(state.State) {
 		tflog.Info(ctx, "DHCPv6 server state change requested", map[string]any{
 			"from": state.State.ValueString(),
 			"to":   desiredState,
@@ -455,20 +554,17 @@ func (r *DHCP6Server) ImportState(ctx context.Context, req resource.ImportStateR
 // startDHCP6Server starts the DHCPv6 server daemon for the given resource
 func (r *DHCP6Server) startDHCP6Server(ctx context.Context, d string, data *DHCP6ServerModel) error {
 	self := r.providerConf.Exec.SelfPath()
-	srvCmd := self
-	srvArgs := []string{}
-	if r.providerConf.UseSudo {
-		srvCmd = r.providerConf.Sudo
-		srvArgs = []string{"-n", self}
-	}
-	moreArgs := []string{"-pid-file", data.PIDFile.ValueString(), "-dhcp6-server", "-d6s.config", data.ConfigFile.ValueString()}
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, "", self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-dhcp6-server", "-d6s.config", data.ConfigFile.ValueString())
 	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
 		return fmt.Errorf("failed to start DHCPv6 server: %w, diagnostics: %v", err, res.Diagnostics())
 	}
 	return nil
 }
 
-// stopDHCP6Server stops the DHCPv6 server daemon for the given resource
+// stopDHCP6Server stops the DHCPv6 server daemon for the given resource and
+// waits for it to exit, so that a new one can bind the same port right away.
 func (r *DHCP6Server) stopDHCP6Server(ctx context.Context, d string) error {
 	running, pid, err := readDHCP6ServerPID(ctx, r.providerConf.Exec, d)
 	if err != nil {
@@ -478,10 +574,18 @@ func (r *DHCP6Server) stopDHCP6Server(ctx context.Context, d string) error {
 		return nil // Already stopped
 	}
 
-	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGKILL); err != nil {
+	// SIGTERM, which the supervisor forwards to the daemon and then waits
+	// for it, so the port is free once the supervisor is gone.
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
 		return fmt.Errorf("can't kill DHCPv6 server process: %w", err)
 	}
-	return nil
+	for deadline := time.Now().Add(dhcp6ServerStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(dhcp6ServerStopPoll)
+	}
+	return fmt.Errorf("DHCPv6 server process %d did not exit within %s", pid, dhcp6ServerStopTimeout)
 }
 
 func (r *DHCP6Server) readDHCP6Server(ctx context.Context, resPath string, model *DHCP6ServerModel) (diag.Diagnostics, error) {
@@ -522,6 +626,7 @@ func (r *DHCP6Server) readDHCP6Server(ctx context.Context, resPath string, model
 
 	// Update state to match actual state
 	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
 
 	return nil, nil
 }
@@ -545,3 +650,124 @@ func readDHCP6ServerPID(ctx context.Context, ex exec.Executor, path string) (boo
 
 	return running, int(pid), nil
 }
+
+func equalDHCP6Pool(a, b *DHCP6PoolModel) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Start.Equal(b.Start) && a.End.Equal(b.End)
+}
+
+func equalDHCP6PrefixDelegation(a, b *DHCP6PrefixDelegationModel) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Prefix.Equal(b.Prefix) && a.Length.Equal(b.Length)
+}
+
+// dhcp6PrefixDelegation returns the args of the CoreDHCP prefix plugin,
+// `<pool> <length>`, checking that prefixes of length fit in the pool.
+func dhcp6PrefixDelegation(prefix string, length int64) (string, error) {
+	ip, pool, err := net.ParseCIDR(prefix)
+	if err != nil || ip.To4() != nil {
+		return "", fmt.Errorf("%q is not an IPv6 prefix", prefix)
+	}
+	ones, _ := pool.Mask.Size()
+	if length < int64(ones) || length > 128 {
+		return "", fmt.Errorf("the delegated prefix length %d must be between the pool length %d and 128", length, ones)
+	}
+	return fmt.Sprintf("%s %d", pool, length), nil
+}
+
+// dhcp6ServerConfig is the data of the DHCPv6 server config file template.
+type dhcp6ServerConfig struct {
+	Interface    string
+	ServerID     string
+	NameServer   string
+	DomainSearch string
+	SNTPServers  string
+	// Stateful is set in the stateful mode, when the range plugin leases
+	// addresses from the pool.
+	Stateful   bool
+	LeasesFile string
+	PoolStart  string
+	PoolEnd    string
+	LeaseTime  int64
+	// Prefix are the args of the prefix plugin, `<pool> <length>`.
+	Prefix string
+}
+
+// newDHCP6ServerConfig returns the config file data of a resource model.
+func newDHCP6ServerConfig(ctx context.Context, data *DHCP6ServerModel) (dhcp6ServerConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	cfg := dhcp6ServerConfig{
+		Interface:  data.Interface.ValueString(),
+		ServerID:   data.ServerID.ValueString(),
+		NameServer: data.NameServer.ValueString(),
+		Stateful:   data.Mode.ValueString() != "stateless",
+		LeasesFile: data.LeasesFile.ValueString(),
+		LeaseTime:  data.LeaseTime.ValueInt64(),
+		Prefix:     data.Prefix.ValueString(),
+	}
+	if cfg.Stateful {
+		if data.Pool == nil {
+			diags.AddError("DHCP6Server Resource Error", "Pool configuration is required in the stateful mode")
+			return cfg, diags
+		}
+		cfg.PoolStart = data.Pool.Start.ValueString()
+		cfg.PoolEnd = data.Pool.End.ValueString()
+	}
+	if pd := data.PrefixDelegation; pd != nil {
+		prefix, err := dhcp6PrefixDelegation(pd.Prefix.ValueString(), pd.Length.ValueInt64())
+		if err != nil {
+			diags.AddAttributeError(path.Root("prefix_delegation"), "Invalid prefix delegation", err.Error())
+		}
+		cfg.Prefix = prefix
+	}
+	for _, l := range []struct {
+		list types.List
+		dst  *string
+	}{
+		{data.DomainSearch, &cfg.DomainSearch},
+		{data.SNTPServers, &cfg.SNTPServers},
+	} {
+		if l.list.IsNull() || l.list.IsUnknown() {
+			continue
+		}
+		var elems []string
+		diags.Append(l.list.ElementsAs(ctx, &elems, false)...)
+		*l.dst = strings.Join(elems, " ")
+	}
+	return cfg, diags
+}
+
+// renderDHCP6ServerConfig writes the DHCPv6 server config file of cfg to w.
+func renderDHCP6ServerConfig(w io.Writer, cfg dhcp6ServerConfig) error {
+	tmpl, err := template.New("config").Parse(dhcp6ConfigTemplate)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// writeDHCP6ServerConfig writes the `config_file` of data.
+func writeDHCP6ServerConfig(ctx context.Context, ex exec.Executor, data *DHCP6ServerModel) diag.Diagnostics {
+	cfg, diags := newDHCP6ServerConfig(ctx, data)
+	if diags.HasError() {
+		return diags
+	}
+
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		diags.AddError("DHCP6Server Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderDHCP6ServerConfig(confFile, cfg); err != nil {
+		diags.AddError("DHCP6Server Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
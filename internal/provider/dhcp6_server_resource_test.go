@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDHCP6PrefixDelegation(t *testing.T) {
+	is := is.New(t)
+
+	got, err := dhcp6PrefixDelegation("2001:db8:200:1::/48", 56)
+	is.NoErr(err)
+	is.Equal(got, "2001:db8:200::/48 56") // the pool is masked
+
+	for _, tc := range []struct {
+		prefix string
+		length int64
+	}{
+		{"2001:db8:200::/48", 40},  // shorter than the pool
+		{"2001:db8:200::/48", 129}, // too long
+		{"10.0.0.0/8", 16},         // IPv4
+		{"2001:db8:200::", 56},     // not a prefix
+	} {
+		_, err := dhcp6PrefixDelegation(tc.prefix, tc.length)
+		is.True(err != nil)
+	}
+}
+
+// dhcp6Plugins returns the plugins of a rendered DHCPv6 server config file,
+// in order.
+func dhcp6Plugins(is *is.I, cfg dhcp6ServerConfig) ([]string, map[string]string) {
+	var buf bytes.Buffer
+	is.NoErr(renderDHCP6ServerConfig(&buf, cfg))
+
+	var got struct {
+		Server6 struct {
+			Listen  []string            `yaml:"listen"`
+			Plugins []map[string]string `yaml:"plugins"`
+		} `yaml:"server6"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Server6.Listen, []string{"[ff02::1:2%br0]"})
+
+	var names []string
+	args := map[string]string{}
+	for _, p := range got.Server6.Plugins {
+		for k, v := range p {
+			names = append(names, k)
+			args[k] = v
+		}
+	}
+	return names, args
+}
+
+func TestRenderDHCP6ServerConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := DHCP6ServerModel{
+		Interface:  types.StringValue("br0"),
+		ServerID:   types.StringValue("aa:bb:cc:dd:ee:ff"),
+		Mode:       types.StringValue("stateful"),
+		Prefix:     types.StringNull(),
+		NameServer: types.StringValue("2001:db8::53"),
+		DomainSearch: types.ListValueMust(types.StringType,
+			[]attr.Value{types.StringValue("lab.local"), types.StringValue("local")}),
+		SNTPServers: types.ListValueMust(types.StringType, []attr.Value{types.StringValue("2001:db8::123")}),
+		Pool:        &DHCP6PoolModel{Start: types.StringValue("2001:db8::100"), End: types.StringValue("2001:db8::1ff")},
+		PrefixDelegation: &DHCP6PrefixDelegationModel{
+			Prefix: types.StringValue("2001:db8:200::/48"),
+			Length: types.Int64Value(56),
+		},
+		LeaseTime:  types.Int64Value(600),
+		LeasesFile: types.StringValue("/lib/leases.sqlite3"),
+	}
+	cfg, diags := newDHCP6ServerConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+	names, args := dhcp6Plugins(is, cfg)
+	is.Equal(names, []string{"server_id", "dns", "searchdomains", "sntp", "range", "prefix"})
+	is.Equal(args["server_id"], "LL aa:bb:cc:dd:ee:ff")
+	is.Equal(args["searchdomains"], "lab.local local")
+	is.Equal(args["sntp"], "2001:db8::123")
+	is.Equal(args["range"], "/lib/leases.sqlite3 2001:db8::100 2001:db8::1ff 600s")
+	is.Equal(args["prefix"], "2001:db8:200::/48 56")
+
+	// Stateless: options only, no addresses are leased.
+	data.Mode = types.StringValue("stateless")
+	data.Pool = nil
+	data.PrefixDelegation = nil
+	data.DomainSearch = types.ListNull(types.StringType)
+	data.SNTPServers = types.ListNull(types.StringType)
+	cfg, diags = newDHCP6ServerConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+	names, _ = dhcp6Plugins(is, cfg)
+	is.Equal(names, []string{"server_id", "dns"})
+
+	// The stateful mode needs a pool.
+	data.Mode = types.StringValue("stateful")
+	_, diags = newDHCP6ServerConfig(context.Background(), &data)
+	is.True(diags.HasError())
+}
@@ -0,0 +1,352 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	// The sqlite driver also used by CoreDHCP for the leases file.
+	_ "modernc.org/sqlite"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &DHCPLeasesDS{}
+
+func NewDHCPLeasesDataSource() datasource.DataSource {
+	return &DHCPLeasesDS{}
+}
+
+// DHCPLeasesDS defines the data source implementation.
+type DHCPLeasesDS struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// DHCPLeasesDSModel describes the data source data model.
+type DHCPLeasesDSModel struct {
+	ID             types.String      `tfsdk:"id"`
+	LeasesFile     types.String      `tfsdk:"leases_file"`
+	MAC            types.String      `tfsdk:"mac"`
+	IncludeExpired types.Bool        `tfsdk:"include_expired"`
+	Leases         []DHCPLeaseModel  `tfsdk:"leases"`
+	Leases6        []DHCPLease6Model `tfsdk:"leases6"`
+	IPByMAC        map[string]string `tfsdk:"ip_by_mac"`
+	IPByDUID       map[string]string `tfsdk:"ip_by_duid"`
+}
+
+// DHCPLeaseModel describes an element of `leases`.
+type DHCPLeaseModel struct {
+	MAC      types.String `tfsdk:"mac"`
+	IP       types.String `tfsdk:"ip"`
+	Hostname types.String `tfsdk:"hostname"`
+	Expiry   types.String `tfsdk:"expiry"`
+	Expired  types.Bool   `tfsdk:"expired"`
+}
+
+// DHCPLease6Model describes an element of `leases6`.
+type DHCPLease6Model struct {
+	DUID     types.String `tfsdk:"duid"`
+	IP       types.String `tfsdk:"ip"`
+	Hostname types.String `tfsdk:"hostname"`
+	Expiry   types.String `tfsdk:"expiry"`
+	Expired  types.Bool   `tfsdk:"expired"`
+}
+
+// dhcpLease is a row of one of the lease tables of the CoreDHCP range
+// plugin. ID is the MAC address of a v4 lease or the DUID of a v6 one.
+type dhcpLease struct {
+	ID       string
+	IP       net.IP
+	Hostname string
+	Expiry   time.Time
+}
+
+func (d *DHCPLeasesDS) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_dhcp_leases"
+}
+
+func (d *DHCPLeasesDS) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	leaseAttrs := func(id, idDesc string) map[string]schema.Attribute {
+		return map[string]schema.Attribute{
+			id: schema.StringAttribute{
+				Description: idDesc,
+				Computed:    true,
+			},
+			"ip": schema.StringAttribute{
+				Description: "Leased IP address",
+				Computed:    true,
+			},
+			"hostname": schema.StringAttribute{
+				Description: "Host name sent by the client, empty if none",
+				Computed:    true,
+			},
+			"expiry": schema.StringAttribute{
+				Description: "When the lease expires, in RFC 3339 format",
+				Computed:    true,
+			},
+			"expired": schema.BoolAttribute{
+				Description: "Whether the lease had already expired when the data source was read",
+				Computed:    true,
+			},
+		}
+	}
+
+	resp.Schema = schema.Schema{
+		Description: "Leases of a zedamigo_dhcp_server or zedamigo_dhcp6_server",
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: undent.Md(`
+		The DHCP leases data source reads the |leases_file| of a |zedamigo_dhcp_server| or of a
+		|zedamigo_dhcp6_server| on the target and returns the addresses leased from the pool, e.g.
+		to find the address an EVE uplink or an app instance got and use it in a |zedamigo_wait_until|
+		script or in an output. The static leases (the |host| blocks) are not stored in the leases
+		file, their addresses are already known. Clients get a lease only after the first DHCP exchange,
+		until then an empty result is returned; a leases file that does not exist yet is not an error.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "DHCP leases data source identifier, the leases file",
+				Computed:    true,
+			},
+			"leases_file": schema.StringAttribute{
+				Description: "The `leases_file` of a `zedamigo_dhcp_server` or `zedamigo_dhcp6_server`",
+				Required:    true,
+			},
+			"mac": schema.StringAttribute{
+				Description: "Only return the DHCP v4 lease of this MAC address",
+				Optional:    true,
+			},
+			"include_expired": schema.BoolAttribute{
+				Description: "Also return the expired leases, default false",
+				Optional:    true,
+			},
+			"leases": schema.ListNestedAttribute{
+				Description: "The DHCP v4 leases, ordered by IP address",
+				Computed:    true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: leaseAttrs("mac", "MAC address of the client"),
+				},
+			},
+			"leases6": schema.ListNestedAttribute{
+				Description: "The DHCP v6 leases, ordered by IP address",
+				Computed:    true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: leaseAttrs("duid", "DUID of the client, as colon separated hex bytes"),
+				},
+			},
+			"ip_by_mac": schema.MapAttribute{
+				Description: "The IP address of each MAC address in `leases`",
+				ElementType: types.StringType,
+				Computed:    true,
+			},
+			"ip_by_duid": schema.MapAttribute{
+				Description: "The IP address of each DUID in `leases6`",
+				ElementType: types.StringType,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func (d *DHCPLeasesDS) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	d.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_dhcp_leases", &resp.Diagnostics)
+}
+
+func (d *DHCPLeasesDS) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data DHCPLeasesDSModel
+
+	// Read Terraform configuration data into the model
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	mac := ""
+	if !data.MAC.IsNull() && data.MAC.ValueString() != "" {
+		hw, err := net.ParseMAC(data.MAC.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("mac"), "Invalid MAC address",
+				fmt.Sprintf("%q is not a MAC address.", data.MAC.ValueString()))
+			return
+		}
+		mac = hw.String()
+	}
+
+	leasesFile := data.LeasesFile.ValueString()
+	var leases, leases6 []dhcpLease
+	db, err := d.providerConf.Exec.ReadFile(ctx, leasesFile)
+	if exec.IsNotExist(err) {
+		tflog.Debug(ctx, "DHCP leases file does not exist yet", map[string]any{"leases_file": leasesFile})
+	} else if err != nil {
+		resp.Diagnostics.AddError("DHCP Leases Data Source Error",
+			fmt.Sprintf("Unable to read the leases file '%s': %s", leasesFile, err))
+		return
+	} else if leases, leases6, err = parseDHCPLeases(db); err != nil {
+		resp.Diagnostics.AddError("DHCP Leases Data Source Error",
+			fmt.Sprintf("Unable to parse the leases file '%s': %s", leasesFile, err))
+		return
+	}
+
+	now := time.Now()
+	includeExpired := data.IncludeExpired.ValueBool()
+	data.ID = types.StringValue(leasesFile)
+	data.Leases = []DHCPLeaseModel{}
+	data.Leases6 = []DHCPLease6Model{}
+	data.IPByMAC = map[string]string{}
+	data.IPByDUID = map[string]string{}
+	for _, l := range leases {
+		expired := l.Expiry.Before(now)
+		if (expired && !includeExpired) || (mac != "" && l.ID != mac) {
+			continue
+		}
+		data.Leases = append(data.Leases, DHCPLeaseModel{
+			MAC:      types.StringValue(l.ID),
+			IP:       types.StringValue(l.IP.String()),
+			Hostname: types.StringValue(l.Hostname),
+			Expiry:   types.StringValue(l.Expiry.UTC().Format(time.RFC3339)),
+			Expired:  types.BoolValue(expired),
+		})
+		data.IPByMAC[l.ID] = l.IP.String()
+	}
+	for _, l := range leases6 {
+		expired := l.Expiry.Before(now)
+		if expired && !includeExpired {
+			continue
+		}
+		data.Leases6 = append(data.Leases6, DHCPLease6Model{
+			DUID:     types.StringValue(l.ID),
+			IP:       types.StringValue(l.IP.String()),
+			Hostname: types.StringValue(l.Hostname),
+			Expiry:   types.StringValue(l.Expiry.UTC().Format(time.RFC3339)),
+			Expired:  types.BoolValue(expired),
+		})
+		data.IPByDUID[l.ID] = l.IP.String()
+	}
+
+	tflog.Trace(ctx, "read DHCP leases data source", map[string]any{
+		"leases_file": leasesFile, "leases": len(data.Leases), "leases6": len(data.Leases6),
+	})
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// parseDHCPLeases returns the v4 and v6 leases of the contents of a CoreDHCP
+// range plugin sqlite leases file, ordered by IP address. The file is copied
+// locally since it can come from an SSH target.
+func parseDHCPLeases(db []byte) ([]dhcpLease, []dhcpLease, error) {
+	f, err := os.CreateTemp("", "zedamigo-leases-*.sqlite3")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(db)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := sql.Open("sqlite", "file:"+f.Name()+"?mode=ro")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	leases, err := queryDHCPLeases(conn, "select mac, ip, expiry, hostname from leases4", func(id []byte) string {
+		if hw, err := net.ParseMAC(string(id)); err == nil {
+			return hw.String()
+		}
+		return string(id)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// The range plugin stores the DUID as raw bytes.
+	leases6, err := queryDHCPLeases(conn, "select duid, ip, expiry, hostname from leases6", func(id []byte) string {
+		hx := make([]string, len(id))
+		for i, b := range id {
+			hx[i] = fmt.Sprintf("%02x", b)
+		}
+		return strings.Join(hx, ":")
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return leases, leases6, nil
+}
+
+// queryDHCPLeases runs query, which selects the id, ip, expiry and hostname
+// columns of a lease table. A missing table has no leases.
+func queryDHCPLeases(conn *sql.DB, query string, idString func([]byte) string) ([]dhcpLease, error) {
+	rows, err := conn.Query(query)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leases []dhcpLease
+	for rows.Next() {
+		var (
+			id       []byte
+			ip       string
+			expiry   int64
+			hostname sql.NullString
+		)
+		if err := rows.Scan(&id, &ip, &expiry, &hostname); err != nil {
+			return nil, err
+		}
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return nil, fmt.Errorf("invalid IP address %q", ip)
+		}
+		leases = append(leases, dhcpLease{
+			ID:       idString(id),
+			IP:       addr,
+			Hostname: hostname.String,
+			Expiry:   time.Unix(expiry, 0),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(leases, func(i, j int) bool {
+		return bytes.Compare(leases[i].IP.To16(), leases[j].IP.To16()) < 0
+	})
+	return leases, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseDHCPLeases(t *testing.T) {
+	is := is.New(t)
+
+	// Same tables as the CoreDHCP range plugin.
+	p := filepath.Join(t.TempDir(), "leases.sqlite3")
+	conn, err := sql.Open("sqlite", "file:"+p)
+	is.NoErr(err)
+	for _, stmt := range []string{
+		"create table leases4 (mac string not null, ip string not null, expiry int, hostname string not null, primary key (mac, ip))",
+		"create table leases6 (duid string not null, ip string not null, expiry int, hostname string not null, primary key (duid, ip))",
+		"insert into leases4 values ('52:54:00:00:00:02', '10.1.0.101', 2000000000, 'eve')",
+		"insert into leases4 values ('52:54:00:00:00:01', '10.1.0.100', 1000000000, '')",
+	} {
+		_, err := conn.Exec(stmt)
+		is.NoErr(err)
+	}
+	_, err = conn.Exec("insert into leases6 values (?, 'fd00::100', 2000000000, 'app')", string([]byte{0, 3, 0, 1, 0x52, 0x54}))
+	is.NoErr(err)
+	is.NoErr(conn.Close())
+
+	db, err := os.ReadFile(p)
+	is.NoErr(err)
+	leases, leases6, err := parseDHCPLeases(db)
+	is.NoErr(err)
+
+	is.Equal(len(leases), 2)
+	is.Equal(leases[0].ID, "52:54:00:00:00:01") // ordered by IP
+	is.Equal(leases[0].IP.String(), "10.1.0.100")
+	is.Equal(leases[0].Expiry.Unix(), int64(1000000000))
+	is.Equal(leases[1].Hostname, "eve")
+
+	is.Equal(len(leases6), 1)
+	is.Equal(leases6[0].ID, "00:03:00:01:52:54")
+	is.Equal(leases6[0].IP.String(), "fd00::100")
+
+	_, _, err = parseDHCPLeases([]byte("not a sqlite file"))
+	is.True(err != nil)
+}
@@ -5,17 +5,25 @@ package provider
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"net"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
 	"github.com/hashicorp/terraform-plugin-framework-validators/objectvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -28,27 +36,56 @@ import (
 )
 
 const (
-	dhcpSrvsDir        = "dhcp_servers"
-	dhcpConfigTemplate = `# CoreDHCP config for simple DHCP v4 server for a specific interface.
+	dhcpSrvsDir           = "dhcp_servers"
+	dhcpServerStopPoll    = 100 * time.Millisecond
+	dhcpServerStopTimeout = 5 * time.Second
+	dhcpConfigTemplate    = `# CoreDHCP config for simple DHCP v4 server for a specific interface.
 server4:
   listen:
     - "%{{ .Interface }}:67"
   plugins:
     - server_id: {{ .ServerID }}
     - dns: {{ .NameServer }}
+{{- if .NTPServers }}
+    - ntp: {{ .NTPServers }}
+{{- end }}
     - router: {{ .Router }}
     - netmask: {{ .Netmask }}
-    - range: {{ .LeasesFile }} {{ .PoolStart }} {{ .PoolEnd }} {{ .LeaseTime }}s
+{{- if .DomainSearch }}
+    - searchdomains: {{ .DomainSearch }}
+{{- end }}
+{{- if .MTU }}
+    - mtu: {{ .MTU }}
+{{- end }}
 {{- range .StaticRoutes }}
-    - staticroute: {{ .To.ValueString }},{{ .Via.ValueString }}
+    - staticroute: {{ .To }},{{ .Via }}
+{{- end }}
+{{- if .Netboot }}
+    - netboot: {{ .Netboot }}
+{{- end }}
+{{- if .Hostnames }}
+    - hostname: {{ .Hostnames }}
+{{- end }}
+{{- if .Options }}
+    - options: {{ .Options }}
 {{- end }}
+{{- if .HostsFile }}
+    - lease_time: {{ .LeaseTime }}s
+    - file: {{ .HostsFile }}
+{{- end }}
+    - range: {{ .LeasesFile }} {{ .PoolStart }} {{ .PoolEnd }} {{ .LeaseTime }}s
 `
 )
 
+// dhcpHostnameRegex matches the host and domain names that can be given to
+// the DHCP clients.
+var dhcpHostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]{0,251}[a-zA-Z0-9])?$`)
+
 // Ensure provider defined types fully satisfy framework interfaces.
 var (
-	_ resource.Resource                = &DHCPServer{}
-	_ resource.ResourceWithImportState = &DHCPServer{}
+	_ resource.Resource                   = &DHCPServer{}
+	_ resource.ResourceWithImportState    = &DHCPServer{}
+	_ resource.ResourceWithValidateConfig = &DHCPServer{}
 )
 
 func NewDHCPServer() resource.Resource {
@@ -72,22 +109,54 @@ type DHCPStaticRouteModel struct {
 	Via types.String `tfsdk:"via"`
 }
 
+// DHCPHostModel describes a static lease.
+type DHCPHostModel struct {
+	MAC      types.String `tfsdk:"mac"`
+	IP       types.String `tfsdk:"ip"`
+	Hostname types.String `tfsdk:"hostname"`
+}
+
+// DHCPOptionModel describes a raw DHCP option.
+type DHCPOptionModel struct {
+	Code  types.Int64  `tfsdk:"code"`
+	Type  types.String `tfsdk:"type"`
+	Value types.String `tfsdk:"value"`
+}
+
+// DHCPNetbootModel describes the network boot options.
+type DHCPNetbootModel struct {
+	NextServer    types.String `tfsdk:"next_server"`
+	BootFile      types.String `tfsdk:"boot_file"`
+	IPXEScriptURL types.String `tfsdk:"ipxe_script_url"`
+}
+
 // DHCPServerModel describes the resource data model.
 type DHCPServerModel struct {
-	ID           types.String           `tfsdk:"id"`
-	Interface    types.String           `tfsdk:"interface"`
-	ServerID     types.String           `tfsdk:"server_id"`
-	NameServer   types.String           `tfsdk:"nameserver"`
-	Router       types.String           `tfsdk:"router"`
-	Netmask      types.String           `tfsdk:"netmask"`
-	Pool         *DHCPPoolModel         `tfsdk:"pool"`
-	LeaseTime    types.Int64            `tfsdk:"lease_time"`
-	StaticRoutes []DHCPStaticRouteModel `tfsdk:"static_route"`
-	LeasesFile   types.String           `tfsdk:"leases_file"`
-	ConfigFile   types.String           `tfsdk:"config_file"`
-	PIDFile      types.String           `tfsdk:"pid_file"`
-	State        types.String           `tfsdk:"state"`
-	NetNS        types.String           `tfsdk:"netns"`
+	ID            types.String           `tfsdk:"id"`
+	Interface     types.String           `tfsdk:"interface"`
+	ServerID      types.String           `tfsdk:"server_id"`
+	NameServer    types.String           `tfsdk:"nameserver"`
+	NTPServers    types.List             `tfsdk:"ntp_servers"`
+	Router        types.String           `tfsdk:"router"`
+	Netmask       types.String           `tfsdk:"netmask"`
+	DomainName    types.String           `tfsdk:"domain_name"`
+	DomainSearch  types.List             `tfsdk:"domain_search"`
+	MTU           types.Int64            `tfsdk:"mtu"`
+	VendorOptions types.String           `tfsdk:"vendor_options"`
+	Pool          *DHCPPoolModel         `tfsdk:"pool"`
+	LeaseTime     types.Int64            `tfsdk:"lease_time"`
+	StaticRoutes  []DHCPStaticRouteModel `tfsdk:"static_route"`
+	Hosts         []DHCPHostModel        `tfsdk:"host"`
+	Options       []DHCPOptionModel      `tfsdk:"option"`
+	Netboot       *DHCPNetbootModel      `tfsdk:"netboot"`
+	LeasesFile    types.String           `tfsdk:"leases_file"`
+	HostsFile     types.String           `tfsdk:"hosts_file"`
+	ConfigFile    types.String           `tfsdk:"config_file"`
+	PIDFile       types.String           `tfsdk:"pid_file"`
+	State         types.String           `tfsdk:"state"`
+	Restarts      types.Int64            `tfsdk:"restarts"`
+	LastExit      types.String           `tfsdk:"last_exit"`
+	NetNS         types.String           `tfsdk:"netns"`
 }
 
 func (r *DHCPServer) getResourceDir(id string) string {
@@ -103,6 +172,10 @@ func (r *DHCPServer) Schema(ctx context.Context, req resource.SchemaRequest, res
 		Description: "Simple DHCP v4 server for a specific interface",
 		MarkdownDescription: undent.Md(`Create and manage a DHCP v4 server instance with a simple configuration
 		that listens on a specific interface. Uses an embedded instance of CoreDHCP (https://github.com/coredhcp/coredhcp).
+		|host| blocks give fixed addresses (and host names) to known MAC addresses, e.g. to the NICs of edge
+		nodes, with the CoreDHCP file plugin; the other clients get an address from the |pool|.
+		The |netboot| block makes PXE clients boot from the network, e.g. with the outputs of a |zedamigo_ipxe_boot|.
+		Changing the configuration rewrites it and restarts the daemon in place, the leases are kept.
 		NOTE: If the host has a firewall configuration that might drop incoming UDP port 67 packets. Double check that.
 		This resource DOES NOT manage the host firewall configuration.`),
 
@@ -133,6 +206,13 @@ func (r *DHCPServer) Schema(ctx context.Context, req resource.SchemaRequest, res
 				Optional: false,
 				Required: true,
 			},
+			"ntp_servers": schema.ListAttribute{
+				Description: "NTP server IPv4 addresses",
+				MarkdownDescription: undent.Md(`IPv4 addresses advertised as NTP servers (option 42) to the clients that request
+				them, e.g. the address of a |zedamigo_ntp_server|.`),
+				ElementType: types.StringType,
+				Optional:    true,
+			},
 			"router": schema.StringAttribute{
 				Description: "Router (gateway) IPv4 address",
 				MarkdownDescription: undent.Md(`IPv4 address which will be used as the value for the router option in the DHCP offer.
@@ -146,6 +226,34 @@ func (r *DHCPServer) Schema(ctx context.Context, req resource.SchemaRequest, res
 				Optional:    false,
 				Required:    true,
 			},
+			"domain_name": schema.StringAttribute{
+				Description: "Domain name (option 15) of the clients, e.g. `lab.local`",
+				Optional:    true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(dhcpHostnameRegex, "must be a valid domain name"),
+				},
+			},
+			"domain_search": schema.ListAttribute{
+				Description: "Domain search list (option 119) of the clients",
+				ElementType: types.StringType,
+				Optional:    true,
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(
+						stringvalidator.RegexMatches(dhcpHostnameRegex, "must be a valid domain name"),
+					),
+				},
+			},
+			"mtu": schema.Int64Attribute{
+				Description: "Interface MTU (option 26), sent to the clients that request it",
+				Optional:    true,
+				Validators: []validator.Int64{
+					int64validator.Between(68, 65535),
+				},
+			},
+			"vendor_options": schema.StringAttribute{
+				Description: "Vendor specific information (option 43) as hex bytes, e.g. `01:04:0a:01:00:01`",
+				Optional:    true,
+			},
 			"lease_time": schema.Int64Attribute{
 				Description: "DHCP lease time in seconds",
 				MarkdownDescription: undent.Md(`DHCP lease time in seconds. This determines how long a client can use an assigned IP address before needing to renew the lease.
@@ -156,15 +264,33 @@ func (r *DHCPServer) Schema(ctx context.Context, req resource.SchemaRequest, res
 			"leases_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "The sqlite3 leases file used by this instance of CoreDHCP",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"hosts_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The MAC to IPv4 address file of the static leases (the |host| blocks) used by the CoreDHCP file plugin",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"config_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "The auto-generated CoreDHCP configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"pid_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 			"state": schema.StringAttribute{
 				Optional:    true,
 				Computed:    true,
@@ -197,6 +323,80 @@ func (r *DHCPServer) Schema(ctx context.Context, req resource.SchemaRequest, res
 					},
 				},
 			},
+			"host": schema.ListNestedBlock{
+				Description: "Static lease: a fixed IPv4 address (and host name) for a MAC address.",
+				MarkdownDescription: undent.Md(`Static lease: a fixed IPv4 address (and host name, option 12) for a MAC
+				address, e.g. the |nic0_mac| of a |zedamigo_edge_node|. The address should be outside of the |pool|.`),
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"mac": schema.StringAttribute{
+							Description: "MAC address of the client, e.g. `52:54:00:12:34:56`.",
+							Required:    true,
+						},
+						"ip": schema.StringAttribute{
+							Description: "IPv4 address given to the client.",
+							Required:    true,
+						},
+						"hostname": schema.StringAttribute{
+							Description: "Host name (option 12) given to the client.",
+							Optional:    true,
+							Validators: []validator.String{
+								stringvalidator.RegexMatches(dhcpHostnameRegex, "must be a valid host name"),
+							},
+						},
+					},
+				},
+			},
+			"option": schema.ListNestedBlock{
+				Description: "Raw DHCP option sent in every reply, overriding the ones set by the other attributes " +
+					"(except the lease time).",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"code": schema.Int64Attribute{
+							Description: "Option code.",
+							Required:    true,
+							Validators: []validator.Int64{
+								int64validator.Between(1, 254),
+							},
+						},
+						"type": schema.StringAttribute{
+							Description: "How `value` is encoded: `hex` (default, e.g. `01:02:0a` or `01020a`), `string`, " +
+								"`ip` (a comma separated list of IPv4 addresses), `uint8`, `uint16` or `uint32`.",
+							Optional: true,
+							Validators: []validator.String{
+								stringvalidator.OneOf("hex", "string", "ip", "uint8", "uint16", "uint32"),
+							},
+						},
+						"value": schema.StringAttribute{
+							Description: "Option value.",
+							Required:    true,
+						},
+					},
+				},
+			},
+			"netboot": schema.SingleNestedBlock{
+				Description: "Network boot (PXE / iPXE) options sent in every reply.",
+				MarkdownDescription: undent.Md(`Network boot (PXE / iPXE) options sent in every reply. PXE ROMs download
+				|boot_file| from the TFTP server |next_server|, e.g. an iPXE binary served by a |zedamigo_tftp_server|.
+				Clients identifying themselves as iPXE (user class option 77) get |ipxe_script_url| as boot file
+				instead, so that the chainloaded iPXE boots that script rather than itself again.`),
+				Attributes: map[string]schema.Attribute{
+					"next_server": schema.StringAttribute{
+						Description: "IPv4 address of the TFTP server (siaddr and option 66).",
+						Optional:    true,
+					},
+					"boot_file": schema.StringAttribute{
+						Description: "Boot file name (file field and option 67), e.g. `ipxe.efi`.",
+						Optional:    true,
+					},
+					"ipxe_script_url": schema.StringAttribute{
+						Description: "URL of the iPXE script given as boot file to iPXE clients.",
+						MarkdownDescription: undent.Md(`URL of the iPXE script given as boot file to iPXE clients, e.g. the
+						|script_url| of a |zedamigo_ipxe_boot|.`),
+						Optional: true,
+					},
+				},
+			},
 			"static_route": schema.ListNestedBlock{
 				Description: "List of static routes to be advertised to DHCP clients.",
 				NestedObject: schema.NestedBlockObject{
@@ -216,6 +416,80 @@ func (r *DHCPServer) Schema(ctx context.Context, req resource.SchemaRequest, res
 	}
 }
 
+func (r *DHCPServer) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data DHCPServerModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var poolStart, poolEnd net.IP
+	if data.Pool != nil {
+		poolStart = net.ParseIP(data.Pool.Start.ValueString()).To4()
+		poolEnd = net.ParseIP(data.Pool.End.ValueString()).To4()
+	}
+	macs := map[string]int{}
+	ips := map[string]int{}
+	for i, h := range data.Hosts {
+		if h.MAC.IsUnknown() || h.IP.IsUnknown() {
+			continue
+		}
+		mac, ip, err := dhcpHost(h)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("host").AtListIndex(i), "Invalid static lease", err.Error())
+			continue
+		}
+		if j, ok := macs[mac]; ok {
+			resp.Diagnostics.AddAttributeError(path.Root("host").AtListIndex(i).AtName("mac"), "Duplicate static lease",
+				fmt.Sprintf("MAC address %s is also used by host %d.", mac, j))
+		}
+		if j, ok := ips[ip]; ok {
+			resp.Diagnostics.AddAttributeError(path.Root("host").AtListIndex(i).AtName("ip"), "Duplicate static lease",
+				fmt.Sprintf("IP address %s is also used by host %d.", ip, j))
+		}
+		macs[mac], ips[ip] = i, i
+		if a := net.ParseIP(ip).To4(); poolStart != nil && poolEnd != nil &&
+			bytes.Compare(a, poolStart) >= 0 && bytes.Compare(a, poolEnd) <= 0 {
+			resp.Diagnostics.AddAttributeError(path.Root("host").AtListIndex(i).AtName("ip"), "Invalid static lease",
+				fmt.Sprintf("IP address %s is inside the pool %s - %s, it could also be leased to another client.",
+					ip, poolStart, poolEnd))
+		}
+	}
+
+	if !data.VendorOptions.IsNull() && !data.VendorOptions.IsUnknown() {
+		if _, err := dhcpOptionBytes("hex", data.VendorOptions.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("vendor_options"), "Invalid vendor options", err.Error())
+		}
+	}
+
+	for i, o := range data.Options {
+		if o.Type.IsUnknown() || o.Value.IsUnknown() {
+			continue
+		}
+		if _, err := dhcpOptionBytes(o.Type.ValueString(), o.Value.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("option").AtListIndex(i).AtName("value"),
+				"Invalid DHCP option", err.Error())
+		}
+	}
+
+	if nb := data.Netboot; nb != nil {
+		if !nb.NextServer.IsNull() && !nb.NextServer.IsUnknown() && net.ParseIP(nb.NextServer.ValueString()).To4() == nil {
+			resp.Diagnostics.AddAttributeError(path.Root("netboot").AtName("next_server"), "Invalid next server",
+				fmt.Sprintf("Expected an IPv4 address, got: %s", nb.NextServer.ValueString()))
+		}
+		for _, a := range []struct {
+			name  string
+			value types.String
+		}{{"boot_file", nb.BootFile}, {"ipxe_script_url", nb.IPXEScriptURL}} {
+			if strings.ContainsAny(a.value.ValueString(), " \t\n") {
+				resp.Diagnostics.AddAttributeError(path.Root("netboot").AtName(a.name), "Invalid network boot option",
+					"Must not contain white space.")
+			}
+		}
+	}
+}
+
 func (r *DHCPServer) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
 	// Prevent panic if the provider has not been configured.
 	if req.ProviderData == nil {
@@ -271,24 +545,9 @@ func (r *DHCPServer) Create(ctx context.Context, req resource.CreateRequest, res
 		return
 	}
 
-	tmpl, err := template.New("config").Parse(dhcpConfigTemplate)
-	if err != nil {
-		resp.Diagnostics.AddError("DHCPServer Resource Error",
-			fmt.Sprintf("Unable to parse config template: %s", err))
-		return
-	}
-
-	leasesPath := filepath.Join(d, "leases.sqlite3")
-	confPath := filepath.Join(d, "config.yaml")
-	confFile, err := r.providerConf.Exec.OpenWrite(ctx, confPath, 0o644)
-	if err != nil {
-		resp.Diagnostics.AddError("DHCPServer Resource Error",
-			fmt.Sprintf("Can't create file '%s': %s", confPath, err))
-		return
-	}
-	defer confFile.Close()
-	data.ConfigFile = types.StringValue(confPath)
-	data.LeasesFile = types.StringValue(leasesPath)
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.LeasesFile = types.StringValue(filepath.Join(d, "leases.sqlite3"))
+	data.HostsFile = types.StringValue(filepath.Join(d, "hosts.txt"))
 
 	// Set default lease time if not specified.
 	if data.LeaseTime.IsNull() || data.LeaseTime.IsUnknown() {
@@ -302,35 +561,8 @@ func (r *DHCPServer) Create(ctx context.Context, req resource.CreateRequest, res
 		return
 	}
 
-	// If we don't do this mapping and try to directly pass `data` to
-	// template.Execute then that will call field.String() which returns
-	// the value double-quoted.
-	td := struct {
-		Interface    string
-		ServerID     string
-		NameServer   string
-		Router       string
-		Netmask      string
-		PoolStart    string
-		PoolEnd      string
-		LeaseTime    int64
-		StaticRoutes []DHCPStaticRouteModel
-		LeasesFile   string
-	}{
-		Interface:    data.Interface.ValueString(),
-		ServerID:     data.ServerID.ValueString(),
-		NameServer:   data.NameServer.ValueString(),
-		Router:       data.Router.ValueString(),
-		Netmask:      data.Netmask.ValueString(),
-		PoolStart:    data.Pool.Start.ValueString(),
-		PoolEnd:      data.Pool.End.ValueString(),
-		LeaseTime:    data.LeaseTime.ValueInt64(),
-		StaticRoutes: data.StaticRoutes,
-		LeasesFile:   data.LeasesFile.ValueString(),
-	}
-	if err := tmpl.Execute(confFile, td); err != nil {
-		resp.Diagnostics.AddError("DHCPServer Resource Error",
-			fmt.Sprintf("Can't write templated config file '%s': %s", confPath, err))
+	if diags := writeDHCPServerConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
 		return
 	}
 
@@ -411,30 +643,58 @@ func (r *DHCPServer) Update(ctx context.Context, req resource.UpdateRequest, res
 		return
 	}
 
-	// Check if only the state field changed
-	stateChanged := !plan.State.Equal(state.State)
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+	plan.LeasesFile = state.LeasesFile
+	plan.HostsFile = state.HostsFile
+	if plan.HostsFile.IsNull() || plan.HostsFile.IsUnknown() {
+		// State written by a provider version without static leases.
+		plan.HostsFile = types.StringValue(filepath.Join(d, "hosts.txt"))
+	}
+	if plan.LeaseTime.IsNull() || plan.LeaseTime.IsUnknown() {
+		plan.LeaseTime = types.Int64Value(3600)
+	}
+
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file,
+	// CoreDHCP reads it only on start. The leases file is kept so the
+	// clients get the same addresses after the restart.
 	poolChanged := !plan.Pool.Start.Equal(state.Pool.Start) || !plan.Pool.End.Equal(state.Pool.End)
 	configChanged := !plan.Interface.Equal(state.Interface) ||
 		!plan.ServerID.Equal(state.ServerID) ||
 		!plan.NameServer.Equal(state.NameServer) ||
+		!plan.NTPServers.Equal(state.NTPServers) ||
 		!plan.Router.Equal(state.Router) ||
 		!plan.Netmask.Equal(state.Netmask) ||
+		!plan.DomainName.Equal(state.DomainName) ||
+		!plan.DomainSearch.Equal(state.DomainSearch) ||
+		!plan.MTU.Equal(state.MTU) ||
+		!plan.VendorOptions.Equal(state.VendorOptions) ||
 		poolChanged ||
 		!plan.LeaseTime.Equal(state.LeaseTime) ||
-		!equalStaticRoutes(plan.StaticRoutes, state.StaticRoutes)
-
+		!equalStaticRoutes(plan.StaticRoutes, state.StaticRoutes) ||
+		!equalDHCPHosts(plan.Hosts, state.Hosts) ||
+		!equalDHCPOptions(plan.Options, state.Options) ||
+		!equalDHCPNetboot(plan.Netboot, state.Netboot)
 	if configChanged {
-		resp.Diagnostics.AddError("DHCPServer Resource Update Error",
-			"Configuration changes require resource recreation. Only the 'state' field can be updated in-place.")
-		return
-	}
-
-	if stateChanged {
-		desiredState := plan.State.ValueString()
-		if desiredState == "" {
-			desiredState = "running"
+		if diags := writeDHCPServerConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopDHCPServer(ctx, d); err != nil {
+			resp.Diagnostics.AddError("DHCPServer Resource Update Error",
+				fmt.Sprintf("Failed to stop DHCP server: %v", err))
+			return
 		}
+		tflog.Info(ctx, "DHCP server configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
 
+	if configChanged || !plan.State.Equal(state.State) {
 		tflog.Info(ctx, "DHCP server state change requested", map[string]any{
 			"from": state.State.ValueString(),
 			"to":   desiredState,
@@ -506,30 +766,17 @@ func (r *DHCPServer) startDHCPServer(ctx context.Context, d string, data *DHCPSe
 	}
 
 	self := r.providerConf.Exec.SelfPath()
-	srvCmd := self
-	srvArgs := []string{}
-	if netns != "" {
-		// Wrap with: ip netns exec <ns> <binary> ...
-		// or: sudo -n ip netns exec <ns> <binary> ...
-		if r.providerConf.UseSudo {
-			srvCmd = r.providerConf.Sudo
-			srvArgs = []string{"-n", r.providerConf.IP, "netns", "exec", netns, self}
-		} else {
-			srvCmd = r.providerConf.IP
-			srvArgs = []string{"netns", "exec", netns, self}
-		}
-	} else if r.providerConf.UseSudo {
-		srvCmd = r.providerConf.Sudo
-		srvArgs = []string{"-n", self}
-	}
-	moreArgs := []string{"-pid-file", data.PIDFile.ValueString(), "-dhcp-server", "-ds.config", data.ConfigFile.ValueString()}
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-dhcp-server", "-ds.config", data.ConfigFile.ValueString())
 	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
 		return fmt.Errorf("failed to start DHCP server: %w, diagnostics: %v", err, res.Diagnostics())
 	}
 	return nil
 }
 
-// stopDHCPServer stops the DHCP server daemon for the given resource
+// stopDHCPServer stops the DHCP server daemon for the given resource and waits
+// for it to exit, so that a new one can bind the same port right away.
 func (r *DHCPServer) stopDHCPServer(ctx context.Context, d string) error {
 	running, pid, err := readDHCPServerPID(ctx, r.providerConf.Exec, d)
 	if err != nil {
@@ -539,10 +786,18 @@ func (r *DHCPServer) stopDHCPServer(ctx context.Context, d string) error {
 		return nil // Already stopped
 	}
 
-	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGKILL); err != nil {
+	// SIGTERM, which the supervisor forwards to the daemon and then waits
+	// for it, so the port is free once the supervisor is gone.
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
 		return fmt.Errorf("can't kill DHCP server process: %w", err)
 	}
-	return nil
+	for deadline := time.Now().Add(dhcpServerStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(dhcpServerStopPoll)
+	}
+	return fmt.Errorf("DHCP server process %d did not exit within %s", pid, dhcpServerStopTimeout)
 }
 
 func (r *DHCPServer) readDHCPServer(ctx context.Context, resPath string, model *DHCPServerModel) (diag.Diagnostics, error) {
@@ -583,6 +838,7 @@ func (r *DHCPServer) readDHCPServer(ctx context.Context, resPath string, model *
 
 	// Update state to match actual state
 	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
 
 	return nil, nil
 }
@@ -618,3 +874,278 @@ func equalStaticRoutes(a, b []DHCPStaticRouteModel) bool {
 	}
 	return true
 }
+
+// dhcpNTPServers returns the `ntp_servers` of a DHCP server, checking that
+// they are IPv4 addresses.
+func dhcpNTPServers(ctx context.Context, l types.List) ([]string, diag.Diagnostics) {
+	if l.IsNull() || l.IsUnknown() {
+		return nil, nil
+	}
+	servers, diags := extractStringList(ctx, l)
+	for i, srv := range servers {
+		if ip := net.ParseIP(srv); ip == nil || ip.To4() == nil {
+			diags.AddAttributeError(path.Root("ntp_servers").AtListIndex(i), "Invalid NTP server",
+				fmt.Sprintf("%q is not an IPv4 address.", srv))
+		}
+	}
+	return servers, diags
+}
+
+func equalDHCPHosts(a, b []DHCPHostModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].MAC.Equal(b[i].MAC) || !a[i].IP.Equal(b[i].IP) || !a[i].Hostname.Equal(b[i].Hostname) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalDHCPOptions(a, b []DHCPOptionModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Code.Equal(b[i].Code) || !a[i].Type.Equal(b[i].Type) || !a[i].Value.Equal(b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalDHCPNetboot(a, b *DHCPNetbootModel) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.NextServer.Equal(b.NextServer) && a.BootFile.Equal(b.BootFile) && a.IPXEScriptURL.Equal(b.IPXEScriptURL)
+}
+
+// dhcpHost returns the normalized MAC and IPv4 address of a static lease.
+func dhcpHost(h DHCPHostModel) (string, string, error) {
+	mac, err := net.ParseMAC(h.MAC.ValueString())
+	if err != nil || len(mac) != 6 {
+		return "", "", fmt.Errorf("%q is not an Ethernet MAC address", h.MAC.ValueString())
+	}
+	ip := net.ParseIP(h.IP.ValueString()).To4()
+	if ip == nil {
+		return "", "", fmt.Errorf("%q is not an IPv4 address", h.IP.ValueString())
+	}
+	return mac.String(), ip.String(), nil
+}
+
+// dhcpOptionBytes returns the value of an `option` block encoded as `typ`,
+// see the schema. An empty type is hex.
+func dhcpOptionBytes(typ, value string) ([]byte, error) {
+	switch typ {
+	case "", "hex":
+		b, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("%q is not a list of hex bytes", value)
+		}
+		return b, nil
+	case "string":
+		if value == "" {
+			return nil, fmt.Errorf("empty string option")
+		}
+		return []byte(value), nil
+	case "ip":
+		var b []byte
+		for _, s := range strings.Split(value, ",") {
+			ip := net.ParseIP(strings.TrimSpace(s)).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IPv4 address", s)
+			}
+			b = append(b, ip...)
+		}
+		return b, nil
+	case "uint8", "uint16", "uint32":
+		bits, _ := strconv.Atoi(strings.TrimPrefix(typ, "uint"))
+		n, err := strconv.ParseUint(value, 0, bits)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a %s", value, typ)
+		}
+		b := make([]byte, bits/8)
+		for i := range b {
+			b[len(b)-1-i] = byte(n >> (8 * i))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown option type %q", typ)
+}
+
+// dhcpServerRoute is a static route of the DHCP server config file.
+type dhcpServerRoute struct {
+	To  string
+	Via string
+}
+
+// dhcpServerHost is a static lease of the DHCP server hosts file.
+type dhcpServerHost struct {
+	MAC string
+	IP  string
+}
+
+// dhcpServerConfig is the data of the DHCP server config file template. If
+// we would pass the model directly then the template would call String()
+// on the fields which returns the values double-quoted.
+type dhcpServerConfig struct {
+	Interface    string
+	ServerID     string
+	NameServer   string
+	NTPServers   string
+	Router       string
+	Netmask      string
+	DomainSearch string
+	MTU          int64
+	// Options are the args of the options plugin, `<code>:<hex> ...`.
+	Options      string
+	StaticRoutes []dhcpServerRoute
+	// Netboot are the args of the netboot plugin, `<key>=<value> ...`.
+	Netboot string
+	// Hostnames are the args of the hostname plugin, `<mac>=<name> ...`.
+	Hostnames string
+	// HostsFile is set only when there are static leases.
+	HostsFile  string
+	Hosts      []dhcpServerHost
+	LeasesFile string
+	PoolStart  string
+	PoolEnd    string
+	LeaseTime  int64
+}
+
+// newDHCPServerConfig returns the config file data of a resource model.
+func newDHCPServerConfig(ctx context.Context, data *DHCPServerModel) (dhcpServerConfig, diag.Diagnostics) {
+	cfg := dhcpServerConfig{
+		Interface:  data.Interface.ValueString(),
+		ServerID:   data.ServerID.ValueString(),
+		NameServer: data.NameServer.ValueString(),
+		Router:     data.Router.ValueString(),
+		Netmask:    data.Netmask.ValueString(),
+		MTU:        data.MTU.ValueInt64(),
+		LeasesFile: data.LeasesFile.ValueString(),
+		LeaseTime:  data.LeaseTime.ValueInt64(),
+	}
+	if data.Pool != nil {
+		cfg.PoolStart = data.Pool.Start.ValueString()
+		cfg.PoolEnd = data.Pool.End.ValueString()
+	}
+
+	ntpServers, diags := dhcpNTPServers(ctx, data.NTPServers)
+	cfg.NTPServers = strings.Join(ntpServers, " ")
+
+	if !data.DomainSearch.IsNull() && !data.DomainSearch.IsUnknown() {
+		var domains []string
+		diags.Append(data.DomainSearch.ElementsAs(ctx, &domains, false)...)
+		cfg.DomainSearch = strings.Join(domains, " ")
+	}
+
+	for _, sr := range data.StaticRoutes {
+		cfg.StaticRoutes = append(cfg.StaticRoutes, dhcpServerRoute{To: sr.To.ValueString(), Via: sr.Via.ValueString()})
+	}
+
+	// The options plugin applies them in order, a later one with the same
+	// code wins.
+	var opts []string
+	if !data.DomainName.IsNull() && data.DomainName.ValueString() != "" {
+		opts = append(opts, fmt.Sprintf("15:%x", data.DomainName.ValueString()))
+	}
+	if !data.VendorOptions.IsNull() && data.VendorOptions.ValueString() != "" {
+		b, err := dhcpOptionBytes("hex", data.VendorOptions.ValueString())
+		if err != nil {
+			diags.AddAttributeError(path.Root("vendor_options"), "Invalid vendor options", err.Error())
+		}
+		opts = append(opts, fmt.Sprintf("43:%x", b))
+	}
+	for i, o := range data.Options {
+		b, err := dhcpOptionBytes(o.Type.ValueString(), o.Value.ValueString())
+		if err != nil {
+			diags.AddAttributeError(path.Root("option").AtListIndex(i).AtName("value"), "Invalid DHCP option", err.Error())
+		}
+		opts = append(opts, fmt.Sprintf("%d:%x", o.Code.ValueInt64(), b))
+	}
+	cfg.Options = strings.Join(opts, " ")
+
+	if nb := data.Netboot; nb != nil {
+		var args []string
+		for _, a := range []struct {
+			key   string
+			value types.String
+		}{{"next_server", nb.NextServer}, {"boot_file", nb.BootFile}, {"ipxe_url", nb.IPXEScriptURL}} {
+			if a.value.ValueString() != "" {
+				args = append(args, a.key+"="+a.value.ValueString())
+			}
+		}
+		cfg.Netboot = strings.Join(args, " ")
+	}
+
+	var hostnames []string
+	for i, h := range data.Hosts {
+		mac, ip, err := dhcpHost(h)
+		if err != nil {
+			diags.AddAttributeError(path.Root("host").AtListIndex(i), "Invalid static lease", err.Error())
+			continue
+		}
+		cfg.Hosts = append(cfg.Hosts, dhcpServerHost{MAC: mac, IP: ip})
+		if !h.Hostname.IsNull() && h.Hostname.ValueString() != "" {
+			hostnames = append(hostnames, mac+"="+h.Hostname.ValueString())
+		}
+	}
+	cfg.Hostnames = strings.Join(hostnames, " ")
+	if len(cfg.Hosts) > 0 {
+		cfg.HostsFile = data.HostsFile.ValueString()
+	}
+	return cfg, diags
+}
+
+// renderDHCPServerConfig writes the DHCP server config file of cfg to w.
+func renderDHCPServerConfig(w io.Writer, cfg dhcpServerConfig) error {
+	tmpl, err := template.New("config").Parse(dhcpConfigTemplate)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// renderDHCPHostsFile writes the static leases of cfg to w in the format of
+// the CoreDHCP file plugin.
+func renderDHCPHostsFile(w io.Writer, cfg dhcpServerConfig) error {
+	for _, h := range cfg.Hosts {
+		if _, err := fmt.Fprintf(w, "%s %s\n", h.MAC, h.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDHCPServerConfig writes the `config_file` and the `hosts_file` of data.
+func writeDHCPServerConfig(ctx context.Context, ex exec.Executor, data *DHCPServerModel) diag.Diagnostics {
+	cfg, diags := newDHCPServerConfig(ctx, data)
+	if diags.HasError() {
+		return diags
+	}
+
+	for _, f := range []struct {
+		path   string
+		render func(io.Writer, dhcpServerConfig) error
+	}{
+		{data.HostsFile.ValueString(), renderDHCPHostsFile},
+		{data.ConfigFile.ValueString(), renderDHCPServerConfig},
+	} {
+		w, err := ex.OpenWrite(ctx, f.path, 0o644)
+		if err != nil {
+			diags.AddError("DHCPServer Resource Error", fmt.Sprintf("Can't create file '%s': %s", f.path, err))
+			return diags
+		}
+		err = f.render(w, cfg)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			diags.AddError("DHCPServer Resource Error", fmt.Sprintf("Can't write file '%s': %s", f.path, err))
+			return diags
+		}
+	}
+	return diags
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDHCPOptionBytes(t *testing.T) {
+	is := is.New(t)
+
+	for _, tc := range []struct {
+		typ, value string
+		want       []byte
+	}{
+		{"", "01:04:0a", []byte{1, 4, 10}},
+		{"hex", "01040A", []byte{1, 4, 10}},
+		{"string", "lab", []byte("lab")},
+		{"ip", "10.0.0.1, 10.0.0.2", []byte{10, 0, 0, 1, 10, 0, 0, 2}},
+		{"uint8", "7", []byte{7}},
+		{"uint16", "1500", []byte{0x05, 0xdc}},
+		{"uint32", "0x01020304", []byte{1, 2, 3, 4}},
+	} {
+		got, err := dhcpOptionBytes(tc.typ, tc.value)
+		is.NoErr(err)
+		is.Equal(got, tc.want)
+	}
+	for _, tc := range [][2]string{
+		{"hex", "0g"}, {"hex", ""}, {"string", ""}, {"ip", "fd00::1"}, {"uint8", "256"}, {"uint16", "-1"}, {"bool", "1"},
+	} {
+		_, err := dhcpOptionBytes(tc[0], tc[1])
+		is.True(err != nil)
+	}
+}
+
+func TestDHCPHost(t *testing.T) {
+	is := is.New(t)
+
+	host := func(mac, ip string) DHCPHostModel {
+		return DHCPHostModel{MAC: types.StringValue(mac), IP: types.StringValue(ip), Hostname: types.StringNull()}
+	}
+
+	mac, ip, err := dhcpHost(host("52:54:00:AB:CD:EF", "10.1.0.10"))
+	is.NoErr(err)
+	is.Equal(mac, "52:54:00:ab:cd:ef") // normalized like the file plugin does
+	is.Equal(ip, "10.1.0.10")
+
+	_, _, err = dhcpHost(host("52:54:00:ab:cd", "10.1.0.10"))
+	is.True(err != nil)
+	_, _, err = dhcpHost(host("52:54:00:ab:cd:ef", "fd00::10"))
+	is.True(err != nil)
+}
+
+func TestRenderDHCPServerConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := DHCPServerModel{
+		Interface:     types.StringValue("br0"),
+		ServerID:      types.StringValue("10.1.0.1"),
+		NameServer:    types.StringValue("10.1.0.1"),
+		NTPServers:    types.ListNull(types.StringType),
+		Router:        types.StringValue("10.1.0.1"),
+		Netmask:       types.StringValue("255.255.255.0"),
+		DomainName:    types.StringValue("lab"),
+		DomainSearch:  types.ListValueMust(types.StringType, []attr.Value{types.StringValue("lab.local")}),
+		MTU:           types.Int64Value(1400),
+		VendorOptions: types.StringValue("01:01:ff"),
+		Pool:          &DHCPPoolModel{Start: types.StringValue("10.1.0.100"), End: types.StringValue("10.1.0.200")},
+		LeaseTime:     types.Int64Value(600),
+		StaticRoutes:  []DHCPStaticRouteModel{{To: types.StringValue("10.2.0.0/16"), Via: types.StringValue("10.1.0.254")}},
+		Hosts: []DHCPHostModel{
+			{MAC: types.StringValue("52:54:00:AB:CD:EF"), IP: types.StringValue("10.1.0.10"),
+				Hostname: types.StringValue("edge-1")},
+			{MAC: types.StringValue("52:54:00:ab:cd:01"), IP: types.StringValue("10.1.0.11"),
+				Hostname: types.StringNull()},
+		},
+		Options: []DHCPOptionModel{
+			{Code: types.Int64Value(15), Type: types.StringValue("string"), Value: types.StringValue("other")},
+		},
+		Netboot: &DHCPNetbootModel{NextServer: types.StringValue("10.1.0.1"), BootFile: types.StringValue("ipxe.efi"),
+			IPXEScriptURL: types.StringNull()},
+		LeasesFile: types.StringValue("/lib/leases.sqlite3"),
+		HostsFile:  types.StringValue("/lib/hosts.txt"),
+	}
+	cfg, diags := newDHCPServerConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+
+	var buf bytes.Buffer
+	is.NoErr(renderDHCPServerConfig(&buf, cfg))
+
+	var got struct {
+		Server4 struct {
+			Listen  []string            `yaml:"listen"`
+			Plugins []map[string]string `yaml:"plugins"`
+		} `yaml:"server4"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Server4.Listen, []string{"%br0:67"})
+
+	var names []string
+	args := map[string]string{}
+	for _, p := range got.Server4.Plugins {
+		for k, v := range p {
+			names = append(names, k)
+			args[k] = v
+		}
+	}
+	// The file plugin ends the chain for the static leases, everything they
+	// need comes before it.
+	is.Equal(names, []string{"server_id", "dns", "router", "netmask", "searchdomains", "mtu",
+		"staticroute", "netboot", "hostname", "options", "lease_time", "file", "range"})
+	is.Equal(args["staticroute"], "10.2.0.0/16,10.1.0.254")
+	is.Equal(args["netboot"], "next_server=10.1.0.1 boot_file=ipxe.efi")
+	is.Equal(args["hostname"], "52:54:00:ab:cd:ef=edge-1")
+	is.Equal(args["options"], "15:6c6162 43:0101ff 15:6f74686572") // the option block comes last and wins
+	is.Equal(args["file"], "/lib/hosts.txt")
+	is.Equal(args["range"], "/lib/leases.sqlite3 10.1.0.100 10.1.0.200 600s")
+
+	buf.Reset()
+	is.NoErr(renderDHCPHostsFile(&buf, cfg))
+	is.Equal(buf.String(), "52:54:00:ab:cd:ef 10.1.0.10\n52:54:00:ab:cd:01 10.1.0.11\n")
+
+	// Without static leases neither the file plugin nor a second lease time
+	// are configured.
+	data.Hosts = nil
+	cfg, diags = newDHCPServerConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+	buf.Reset()
+	is.NoErr(renderDHCPServerConfig(&buf, cfg))
+	is.True(!bytes.Contains(buf.Bytes(), []byte("file:")))
+	is.True(!bytes.Contains(buf.Bytes(), []byte("lease_time:")))
+}
@@ -0,0 +1,785 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/miekg/dns"
+)
+
+const (
+	dnsServersDir            = "dns_servers"
+	dnsServerDefaultTTL      = 300
+	dnsServerStopPoll        = 100 * time.Millisecond
+	dnsServerStopTimeout     = 5 * time.Second
+	dnsServerConfigTemplText = `# DNS server configuration (auto-generated)
+listen: {{ printf "%q" .Listen }}
+interface: {{ printf "%q" .Interface }}
+upstream_timeout: {{ printf "%q" .UpstreamTimeout }}
+records:
+{{- range .Records }}
+  - name: {{ printf "%q" .Name }}
+    type: {{ printf "%q" .Type }}
+    ttl: {{ .TTL }}
+    value: {{ printf "%q" .Value }}
+{{- end }}
+upstreams:
+{{- range .Upstreams }}
+  - {{ printf "%q" . }}
+{{- end }}
+nxdomain:
+{{- range .NXDomain }}
+  - {{ printf "%q" . }}
+{{- end }}
+delays:
+{{- range .Delays }}
+  - name: {{ printf "%q" .Name }}
+    delay: {{ printf "%q" .Delay }}
+{{- end }}
+`
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &DNSServer{}
+	_ resource.ResourceWithImportState    = &DNSServer{}
+	_ resource.ResourceWithValidateConfig = &DNSServer{}
+)
+
+func NewDNSServer() resource.Resource {
+	return &DNSServer{}
+}
+
+// DNSServer defines the resource implementation.
+type DNSServer struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// DNSRecordModel describes a static record served by the DNS server.
+type DNSRecordModel struct {
+	Name  types.String `tfsdk:"name"`
+	Type  types.String `tfsdk:"type"`
+	TTL   types.Int64  `tfsdk:"ttl"`
+	Value types.String `tfsdk:"value"`
+}
+
+// DNSDelayModel describes a delay injected for the queries of a name.
+type DNSDelayModel struct {
+	Name  types.String `tfsdk:"name"`
+	Delay types.String `tfsdk:"delay"`
+}
+
+// DNSServerModel describes the resource data model.
+type DNSServerModel struct {
+	ID              types.String     `tfsdk:"id"`
+	Interface       types.String     `tfsdk:"interface"`
+	NetNS           types.String     `tfsdk:"netns"`
+	ListenAddress   types.String     `tfsdk:"listen_address"`
+	Port            types.Int64      `tfsdk:"port"`
+	Records         []DNSRecordModel `tfsdk:"record"`
+	Upstreams       types.List       `tfsdk:"upstreams"`
+	UpstreamTimeout types.String     `tfsdk:"upstream_timeout"`
+	NXDomain        types.List       `tfsdk:"nxdomain"`
+	Delays          []DNSDelayModel  `tfsdk:"delay"`
+	ConfigFile      types.String     `tfsdk:"config_file"`
+	PIDFile         types.String     `tfsdk:"pid_file"`
+	State           types.String     `tfsdk:"state"`
+	Restarts        types.Int64      `tfsdk:"restarts"`
+	LastExit        types.String     `tfsdk:"last_exit"`
+}
+
+func (r *DNSServer) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, dnsServersDir, id)
+}
+
+func (r *DNSServer) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_dns_server"
+}
+
+func (r *DNSServer) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Embedded authoritative/forwarding DNS server",
+		MarkdownDescription: undent.Md(`
+		Run a small DNS server (UDP and TCP), the provider binary in |-dns-server| mode built on
+		github.com/miekg/dns, optionally bound to an |interface| and/or inside a |netns|. For example
+		to point EVE-OS edge nodes at a fake |zedcloud.*| name, to test split-horizon setups or to
+		simulate DNS outages for specific hosts.
+
+		Queries are answered in this order:
+		  * A |delay| matching the name holds the answer back first.
+		  * A name in |nxdomain| gets an authoritative NXDOMAIN.
+		  * A name with |record| blocks is answered from them (CNAMEs are followed), an authoritative
+		    empty answer if none has the queried type.
+		  * Everything else is forwarded to the |upstreams|, or REFUSED when there are none.
+
+		Names are case-insensitive, a leading |*.| matches any name below it (e.g. |*.example.com|).
+		Changing the records, |upstreams| or the injected faults restarts the daemon in place.
+		NOTE: This resource DOES NOT manage the host firewall configuration (UDP and TCP port 53).`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "DNS server resource identifier",
+				MarkdownDescription: "DNS server resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Only answer queries received on this interface (SO_BINDTODEVICE). Default: all interfaces.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace in which to run the DNS server",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"listen_address": schema.StringAttribute{
+				Description: "IP address to listen on. Default: all addresses (IPv4 and IPv6).",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"port": schema.Int64Attribute{
+				Description: "UDP and TCP port to listen on. Default: 53.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(53),
+				Validators: []validator.Int64{
+					int64validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"upstreams": schema.ListAttribute{
+				Description: "Upstream resolvers (`IP` or `IP:port`) to forward the names without local records to, " +
+					"tried in order. Without upstreams those queries are REFUSED.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"upstream_timeout": schema.StringAttribute{
+				Description: "Timeout of a query to one upstream, as a Go duration string. Default: `2s`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("2s"),
+				Validators: []validator.String{
+					positiveDurationValidator{},
+				},
+			},
+			"nxdomain": schema.ListAttribute{
+				Description: "Names answered with NXDOMAIN, taking precedence over the records and the upstreams.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated DNS server configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the DNS server daemon",
+				MarkdownDescription: undent.Md(`Desired state of the DNS server daemon. Can be "running" or "stopped".
+				Defaults to "running". The provider will automatically start or stop the daemon to match this state.
+				Stopping it is an easy way of simulating a DNS outage.`),
+				Validators: []validator.String{
+					stringvalidator.OneOf("running", "stopped"),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"record": schema.ListNestedBlock{
+				Description: "Static record served by the DNS server.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Description: "Owner name of the record, e.g. `zedcloud.lab.local` or `*.lab.local`.",
+							Required:    true,
+						},
+						"type": schema.StringAttribute{
+							Description: "Record type: `A`, `AAAA`, `CNAME`, `SRV` or `TXT`.",
+							Required:    true,
+							Validators: []validator.String{
+								stringvalidator.OneOf("A", "AAAA", "CNAME", "SRV", "TXT"),
+							},
+						},
+						"ttl": schema.Int64Attribute{
+							Description: "TTL of the record in seconds. Default: 300.",
+							Optional:    true,
+							Validators: []validator.Int64{
+								int64validator.AtLeast(0),
+							},
+						},
+						"value": schema.StringAttribute{
+							Description: "Record data in zone file format: an address for `A`/`AAAA`, a name for `CNAME`, " +
+								"`priority weight port target` for `SRV` (e.g. `10 5 443 zedcloud.lab.local`), the text for `TXT`.",
+							Required: true,
+						},
+					},
+				},
+			},
+			"delay": schema.ListNestedBlock{
+				Description: "Delay injected before answering the queries of a name (the first matching block applies).",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Description: "Name to delay, e.g. `zedcloud.lab.local` or `*.lab.local`.",
+							Required:    true,
+						},
+						"delay": schema.StringAttribute{
+							Description: "Delay as a Go duration string, e.g. `3s`. Longer than the client timeout simulates " +
+								"an unresponsive server for that name.",
+							Required: true,
+							Validators: []validator.String{
+								positiveDurationValidator{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *DNSServer) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data DNSServerModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for i, rec := range data.Records {
+		if rec.Name.IsUnknown() || rec.Type.IsUnknown() || rec.Value.IsUnknown() {
+			continue
+		}
+		if _, err := dnsServerRR(rec); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("record").AtListIndex(i).AtName("value"),
+				"Invalid DNS record", err.Error())
+		}
+	}
+
+	if !data.ListenAddress.IsNull() && !data.ListenAddress.IsUnknown() &&
+		net.ParseIP(data.ListenAddress.ValueString()) == nil {
+		resp.Diagnostics.AddAttributeError(path.Root("listen_address"), "Invalid listen address",
+			fmt.Sprintf("%q is not an IP address.", data.ListenAddress.ValueString()))
+	}
+
+	if !data.Upstreams.IsUnknown() {
+		var upstreams []types.String
+		resp.Diagnostics.Append(data.Upstreams.ElementsAs(ctx, &upstreams, false)...)
+		for i, u := range upstreams {
+			if u.IsUnknown() {
+				continue
+			}
+			if _, err := dnsServerUpstream(u.ValueString()); err != nil {
+				resp.Diagnostics.AddAttributeError(path.Root("upstreams").AtListIndex(i),
+					"Invalid upstream", err.Error())
+			}
+		}
+	}
+}
+
+func (r *DNSServer) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_dns_server", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "DNS server resource configure debugging", traceData)
+}
+
+func (r *DNSServer) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data DNSServerModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("DNSServer Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("DNSServer Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("DNSServer Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+	if diags := writeDNSServerConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if data.State.IsNull() || data.State.IsUnknown() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startDNSServer(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("DNSServer Resource Error",
+				fmt.Sprintf("Failed to start DNS server: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readDNSServer(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read DNSServer state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "DNSServer Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *DNSServer) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data DNSServerModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readDNSServer(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read DNSServer state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *DNSServer) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan DNSServerModel
+	var state DNSServerModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file, the
+	// daemon reads it only on start.
+	configChanged := !equalDNSRecords(plan.Records, state.Records) ||
+		!plan.Upstreams.Equal(state.Upstreams) ||
+		!plan.UpstreamTimeout.Equal(state.UpstreamTimeout) ||
+		!plan.NXDomain.Equal(state.NXDomain) ||
+		!equalDNSDelays(plan.Delays, state.Delays)
+	if configChanged {
+		if diags := writeDNSServerConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopDNSServer(ctx, d); err != nil {
+			resp.Diagnostics.AddError("DNSServer Resource Update Error",
+				fmt.Sprintf("Failed to stop DNS server: %v", err))
+			return
+		}
+		tflog.Info(ctx, "DNS server configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
+
+	if configChanged || !plan.State.Equal(state.State) {
+		tflog.Info(ctx, "DNS server state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startDNSServer(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("DNSServer Resource Update Error",
+					fmt.Sprintf("Failed to start DNS server: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopDNSServer(ctx, d); err != nil {
+				resp.Diagnostics.AddError("DNSServer Resource Update Error",
+					fmt.Sprintf("Failed to stop DNS server: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readDNSServer(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read DNSServer state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *DNSServer) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data DNSServerModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopDNSServer(ctx, d); err != nil {
+		tflog.Warn(ctx, "Failed to stop DNS server during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("DNSServer Resource Delete Error",
+			fmt.Sprintf("Can't delete DNSServer resource directory: %v", err))
+		return
+	}
+}
+
+func (r *DNSServer) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// startDNSServer starts the DNS server daemon for the given resource, inside
+// its network namespace if any.
+func (r *DNSServer) startDNSServer(ctx context.Context, d string, data *DNSServerModel) error {
+	netns := ""
+	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
+		netns = data.NetNS.ValueString()
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-dns-server", "-dns.config", data.ConfigFile.ValueString())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
+		return fmt.Errorf("failed to start DNS server: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+	return nil
+}
+
+// stopDNSServer stops the DNS server daemon for the given resource and waits
+// for it to exit, so that a new one can bind the same port right away.
+func (r *DNSServer) stopDNSServer(ctx context.Context, d string) error {
+	running, pid, err := readDNSServerPID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find DNS server process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill DNS server process: %w", err)
+	}
+	for deadline := time.Now().Add(dnsServerStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(dnsServerStopPoll)
+	}
+	return fmt.Errorf("DNS server process %d did not exit within %s", pid, dnsServerStopTimeout)
+}
+
+func (r *DNSServer) readDNSServer(ctx context.Context, resPath string, model *DNSServerModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	running, _, _ := readDNSServerPID(ctx, r.providerConf.Exec, resPath)
+	actualState := "stopped"
+	if running {
+		actualState = "running"
+	}
+
+	// Self-healing: reconcile actual state with desired state.
+	if desiredState == "running" && actualState == "stopped" {
+		tflog.Info(ctx, "DNS server daemon is stopped but should be running, restarting...")
+		if err := r.startDNSServer(ctx, resPath, model); err != nil {
+			return nil, fmt.Errorf("failed to restart DNS server: %w", err)
+		}
+		actualState = "running"
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "DNS server daemon is running but should be stopped, stopping...")
+		if err := r.stopDNSServer(ctx, resPath); err != nil {
+			return nil, fmt.Errorf("failed to stop DNS server: %w", err)
+		}
+		actualState = "stopped"
+	}
+
+	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+
+	return nil, nil
+}
+
+func readDNSServerPID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
+
+// dnsServerRecord is a record of the DNS server config file.
+type dnsServerRecord struct {
+	Name  string
+	Type  string
+	TTL   int64
+	Value string
+}
+
+// dnsServerDelay is a delay of the DNS server config file.
+type dnsServerDelay struct {
+	Name  string
+	Delay string
+}
+
+// dnsServerConfig is the data of the DNS server config file template.
+type dnsServerConfig struct {
+	Listen          string
+	Interface       string
+	UpstreamTimeout string
+	Records         []dnsServerRecord
+	Upstreams       []string
+	NXDomain        []string
+	Delays          []dnsServerDelay
+}
+
+// newDNSServerConfig returns the config file data of a resource model.
+func newDNSServerConfig(ctx context.Context, data *DNSServerModel) (dnsServerConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	port := data.Port.ValueInt64()
+	if port == 0 {
+		port = 53
+	}
+	cfg := dnsServerConfig{
+		Listen:          net.JoinHostPort(data.ListenAddress.ValueString(), strconv.FormatInt(port, 10)),
+		Interface:       data.Interface.ValueString(),
+		UpstreamTimeout: data.UpstreamTimeout.ValueString(),
+	}
+	for _, rec := range data.Records {
+		ttl := int64(dnsServerDefaultTTL)
+		if !rec.TTL.IsNull() && !rec.TTL.IsUnknown() {
+			ttl = rec.TTL.ValueInt64()
+		}
+		cfg.Records = append(cfg.Records, dnsServerRecord{
+			Name:  rec.Name.ValueString(),
+			Type:  rec.Type.ValueString(),
+			TTL:   ttl,
+			Value: rec.Value.ValueString(),
+		})
+	}
+	if !data.Upstreams.IsNull() && !data.Upstreams.IsUnknown() {
+		var upstreams []string
+		diags.Append(data.Upstreams.ElementsAs(ctx, &upstreams, false)...)
+		for _, u := range upstreams {
+			hp, err := dnsServerUpstream(u)
+			if err != nil {
+				diags.AddError("Invalid upstream", err.Error())
+				continue
+			}
+			cfg.Upstreams = append(cfg.Upstreams, hp)
+		}
+	}
+	if !data.NXDomain.IsNull() && !data.NXDomain.IsUnknown() {
+		diags.Append(data.NXDomain.ElementsAs(ctx, &cfg.NXDomain, false)...)
+	}
+	for _, dl := range data.Delays {
+		cfg.Delays = append(cfg.Delays, dnsServerDelay{Name: dl.Name.ValueString(), Delay: dl.Delay.ValueString()})
+	}
+	return cfg, diags
+}
+
+// renderDNSServerConfig writes the DNS server config file of cfg to w.
+func renderDNSServerConfig(w io.Writer, cfg dnsServerConfig) error {
+	tmpl, err := template.New("dns-config").Parse(dnsServerConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// writeDNSServerConfig writes the `config_file` of data.
+func writeDNSServerConfig(ctx context.Context, ex exec.Executor, data *DNSServerModel) diag.Diagnostics {
+	cfg, diags := newDNSServerConfig(ctx, data)
+	if diags.HasError() {
+		return diags
+	}
+
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		diags.AddError("DNSServer Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderDNSServerConfig(confFile, cfg); err != nil {
+		diags.AddError("DNSServer Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
+
+// dnsServerRR parses a record block the way the DNS server daemon does.
+func dnsServerRR(rec DNSRecordModel) (dns.RR, error) {
+	name := strings.TrimPrefix(rec.Name.ValueString(), "*.")
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		return nil, fmt.Errorf("%q is not a valid domain name", rec.Name.ValueString())
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(rec.Name.ValueString()), dnsServerDefaultTTL,
+		rec.Type.ValueString(), rec.Value.ValueString()))
+	if err != nil {
+		return nil, fmt.Errorf("%s record %q: %w", rec.Type.ValueString(), rec.Value.ValueString(), err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("%s record of %q has no data", rec.Type.ValueString(), rec.Name.ValueString())
+	}
+	return rr, nil
+}
+
+// dnsServerUpstream returns the host:port of an upstream given as `IP` or
+// `IP:port`.
+func dnsServerUpstream(s string) (string, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return net.JoinHostPort(ip.String(), "53"), nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || net.ParseIP(host) == nil {
+		return "", fmt.Errorf("%q is not an IP address or IP:port", s)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("%q has an invalid port", s)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func equalDNSRecords(a, b []DNSRecordModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Name.Equal(b[i].Name) || !a[i].Type.Equal(b[i].Type) ||
+			!a[i].TTL.Equal(b[i].TTL) || !a[i].Value.Equal(b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalDNSDelays(a, b []DNSDelayModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Name.Equal(b[i].Name) || !a[i].Delay.Equal(b[i].Delay) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDNSServerRR(t *testing.T) {
+	is := is.New(t)
+
+	rec := func(name, typ, value string) DNSRecordModel {
+		return DNSRecordModel{Name: types.StringValue(name), Type: types.StringValue(typ),
+			TTL: types.Int64Null(), Value: types.StringValue(value)}
+	}
+
+	rr, err := dnsServerRR(rec("zedcloud.lab.local", "A", "10.1.0.1"))
+	is.NoErr(err)
+	is.Equal(rr.String(), "zedcloud.lab.local.\t300\tIN\tA\t10.1.0.1")
+
+	_, err = dnsServerRR(rec("*.lab.local", "AAAA", "fd00::1"))
+	is.NoErr(err)
+	_, err = dnsServerRR(rec("_https._tcp.lab.local", "SRV", "10 5 443 zedcloud.lab.local"))
+	is.NoErr(err)
+
+	_, err = dnsServerRR(rec("zedcloud.lab.local", "A", "fd00::1"))
+	is.True(err != nil) // wrong family
+	_, err = dnsServerRR(rec("zedcloud.lab.local", "SRV", "10 5 zedcloud.lab.local"))
+	is.True(err != nil) // missing port
+	_, err = dnsServerRR(rec("bad name..", "A", "10.1.0.1"))
+	is.True(err != nil)
+}
+
+func TestDNSServerUpstream(t *testing.T) {
+	is := is.New(t)
+
+	for in, want := range map[string]string{
+		"1.1.1.1":            "1.1.1.1:53",
+		"10.0.0.1:5353":      "10.0.0.1:5353",
+		"2606:4700::1111":    "[2606:4700::1111]:53",
+		"[2606:4700::1]:853": "[2606:4700::1]:853",
+	} {
+		got, err := dnsServerUpstream(in)
+		is.NoErr(err)
+		is.Equal(got, want)
+	}
+	for _, in := range []string{"dns.google", "1.1.1.1:0", "1.1.1.1:x", ""} {
+		_, err := dnsServerUpstream(in)
+		is.True(err != nil)
+	}
+}
+
+func TestRenderDNSServerConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := DNSServerModel{
+		Interface:       types.StringValue("br0"),
+		ListenAddress:   types.StringNull(),
+		Port:            types.Int64Value(53),
+		UpstreamTimeout: types.StringValue("2s"),
+		Records: []DNSRecordModel{
+			{Name: types.StringValue("zedcloud.lab.local"), Type: types.StringValue("A"),
+				TTL: types.Int64Null(), Value: types.StringValue("10.1.0.1")},
+			{Name: types.StringValue("lab.local"), Type: types.StringValue("TXT"),
+				TTL: types.Int64Value(60), Value: types.StringValue(`"v=spf1 -all"`)},
+		},
+		Upstreams: types.ListValueMust(types.StringType, []attr.Value{types.StringValue("1.1.1.1")}),
+		NXDomain:  types.ListNull(types.StringType),
+		Delays:    []DNSDelayModel{{Name: types.StringValue("*.slow.local"), Delay: types.StringValue("3s")}},
+	}
+	cfg, diags := newDNSServerConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+
+	var buf bytes.Buffer
+	is.NoErr(renderDNSServerConfig(&buf, cfg))
+
+	var got struct {
+		Listen    string `yaml:"listen"`
+		Interface string `yaml:"interface"`
+		Records   []struct {
+			Name  string `yaml:"name"`
+			TTL   int    `yaml:"ttl"`
+			Value string `yaml:"value"`
+		} `yaml:"records"`
+		Upstreams []string `yaml:"upstreams"`
+		NXDomain  []string `yaml:"nxdomain"`
+		Delays    []struct {
+			Name  string `yaml:"name"`
+			Delay string `yaml:"delay"`
+		} `yaml:"delays"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Listen, ":53") // all addresses
+	is.Equal(got.Interface, "br0")
+	is.Equal(len(got.Records), 2)
+	is.Equal(got.Records[0].TTL, dnsServerDefaultTTL)
+	is.Equal(got.Records[1].Value, `"v=spf1 -all"`) // quotes survive the YAML round trip
+	is.Equal(got.Upstreams, []string{"1.1.1.1:53"})
+	is.Equal(len(got.NXDomain), 0)
+	is.Equal(got.Delays[0].Name, "*.slow.local")
+}
@@ -5,6 +5,9 @@ package provider
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
@@ -55,3 +58,81 @@ func (v positiveDurationValidator) ValidateString(ctx context.Context, req valid
 			fmt.Sprintf("%q must be a positive duration, got %s.", s, d))
 	}
 }
+
+// clockOffsetMaxYears bounds a clock offset well below the ~292 years a
+// time.Duration can hold.
+const clockOffsetMaxYears = 100
+
+// clockOffsetDaysRegex matches a leading year or day part of a clock offset.
+var clockOffsetDaysRegex = regexp.MustCompile(`^(\d+)([yd])`)
+
+// parseClockOffset parses a clock offset: an optionally signed Go duration
+// string that may start with years ("y", 365 days) and days ("d"), e.g.
+// "+3y", "-90d" or "1d12h".
+func parseClockOffset(s string) (time.Duration, error) {
+	rest := strings.TrimSpace(s)
+	neg := strings.HasPrefix(rest, "-")
+	if neg || strings.HasPrefix(rest, "+") {
+		rest = rest[1:]
+	}
+	if rest == "" || rest[0] < '0' || rest[0] > '9' {
+		return 0, fmt.Errorf("%q is not a valid clock offset", s)
+	}
+
+	var d time.Duration
+	for {
+		m := clockOffsetDaysRegex.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n > clockOffsetMaxYears*365 {
+			return 0, fmt.Errorf("%q is too large a clock offset", s)
+		}
+		if m[2] == "y" {
+			n *= 365
+		}
+		d += time.Duration(n) * 24 * time.Hour
+		rest = rest[len(m[0]):]
+	}
+	if rest != "" {
+		x, err := time.ParseDuration(rest)
+		if err != nil || x < 0 {
+			return 0, fmt.Errorf("%q is not a valid clock offset", s)
+		}
+		d += x
+	}
+	if d > clockOffsetMaxYears*365*24*time.Hour {
+		return 0, fmt.Errorf("%q is too large a clock offset, at most %d years", s, clockOffsetMaxYears)
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// clockOffsetValidator validates that a string attribute holds a clock
+// offset, see parseClockOffset.
+type clockOffsetValidator struct{}
+
+var _ validator.String = clockOffsetValidator{}
+
+func (v clockOffsetValidator) Description(_ context.Context) string {
+	return "must be a clock offset, a Go duration string optionally signed and starting with years (\"y\") " +
+		"and days (\"d\"), e.g. \"+3y\", \"-90d\", \"1d12h\""
+}
+
+func (v clockOffsetValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v clockOffsetValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, err := parseClockOffset(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid Clock Offset",
+			fmt.Sprintf("%s; %s.", err, v.Description(ctx)))
+	}
+}
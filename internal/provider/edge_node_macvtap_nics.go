@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"regexp"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// MacvtapNicBlockModel backs a single `macvtap_nic` block on the edge node
+// resource.
+type MacvtapNicBlockModel struct {
+	TapDevice  types.String `tfsdk:"tap_device"`
+	MACAddress types.String `tfsdk:"mac_address"`
+	Model      types.String `tfsdk:"model"`
+}
+
+// macvtapNicSchemaBlock returns the `macvtap_nic` ListNestedBlock.
+func macvtapNicSchemaBlock() schema.ListNestedBlock {
+	return schema.ListNestedBlock{
+		Description: "NIC of the VM on a macvtap interface (a `zedamigo_macvlan` with `macvtap = true`), " +
+			"which puts the VM directly on the network of the macvtap parent without a bridge. Linux (QEMU) only.",
+		MarkdownDescription: undent.Md(`
+		NIC of the VM on a macvtap interface, a |zedamigo_macvlan| with |macvtap = true|. This puts the
+		VM directly on the network of the macvtap parent (e.g. the lab LAN), without a bridge. Repeat
+		the block for more NICs, they come right after |nic0| and before the NICs of |extra_qemu_args|:
+		      macvtap_nic {
+		        tap_device  = zedamigo_macvlan.lan.tap_device
+		        mac_address = zedamigo_macvlan.lan.mac_address
+		      }
+		QEMU inherits the tap device opened read-write, so the user running QEMU needs access to it
+		(the device is created by udev, root only by default). Linux (QEMU) only.`),
+		PlanModifiers: []planmodifier.List{
+			listplanmodifier.RequiresReplace(),
+		},
+		NestedObject: schema.NestedBlockObject{
+			Attributes: map[string]schema.Attribute{
+				"tap_device": schema.StringAttribute{
+					Description: "The `tap_device` of the macvtap interface, e.g. `/dev/tap12`.",
+					Required:    true,
+					Validators: []validator.String{
+						stringvalidator.RegexMatches(macvtapDeviceRegex, "must be a macvtap device, /dev/tap<ifindex>"),
+					},
+				},
+				"mac_address": schema.StringAttribute{
+					Description: "MAC address of the NIC, which must be the `mac_address` of the macvtap interface: " +
+						"the kernel only passes the frames for that address to the VM.",
+					Required: true,
+				},
+				"model": schema.StringAttribute{
+					Description: "QEMU NIC model, e.g. `virtio` or `e1000`. Default: `virtio`.",
+					Optional:    true,
+				},
+			},
+		},
+	}
+}
+
+// macvtapDeviceRegex matches the tap character device of a macvtap interface.
+var macvtapDeviceRegex = regexp.MustCompile(`^/dev/tap\d+$`)
+
+// buildMacvtapNics translates the `macvtap_nic` blocks into the NICs consumed
+// by the hypervisor layer.
+func buildMacvtapNics(blocks []MacvtapNicBlockModel) []hypervisor.MacvtapNic {
+	var nics []hypervisor.MacvtapNic
+	for _, b := range blocks {
+		nics = append(nics, hypervisor.MacvtapNic{
+			Device: b.TapDevice.ValueString(),
+			MAC:    b.MACAddress.ValueString(),
+			Model:  b.Model.ValueString(),
+		})
+	}
+	return nics
+}
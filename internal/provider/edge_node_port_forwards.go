@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int32validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+const (
+	// Range used for ssh_port and for auto-allocated port_forward host ports.
+	autoPortBase  = 10000
+	autoPortRange = 55534
+)
+
+// PortForwardBlockModel backs a single `port_forward` block on the edge node
+// resource.
+type PortForwardBlockModel struct {
+	Protocol  types.String `tfsdk:"protocol"`
+	HostAddr  types.String `tfsdk:"host_addr"`
+	HostPort  types.Int32  `tfsdk:"host_port"`
+	GuestPort types.Int32  `tfsdk:"guest_port"`
+}
+
+// portForwardAttrTypes are the attribute types of one element of the computed
+// `port_forwards` map.
+var portForwardAttrTypes = map[string]attr.Type{
+	"protocol":   types.StringType,
+	"host_addr":  types.StringType,
+	"host_port":  types.Int32Type,
+	"guest_port": types.Int32Type,
+}
+
+// portForwardSchemaBlock returns the `port_forward` ListNestedBlock.
+func portForwardSchemaBlock() schema.ListNestedBlock {
+	return schema.ListNestedBlock{
+		Description: "Additional host->guest port forward for the default nic0, on top of the standard " +
+			"forwards to guest TCP ports 22, 10022 and 10080. Applied to both QEMU SLIRP and gvproxy networking. " +
+			"Not supported together with a custom nic0 unless use_gvproxy is enabled.",
+		MarkdownDescription: undent.Md(`
+		Additional host→guest port forward for the default |nic0|, on top of the standard
+		forwards to guest TCP ports 22, 10022 and 10080. Repeat the block for more forwards.
+		Applied to both QEMU SLIRP (as a |hostfwd=| option) and gvproxy (as a |-gp.forwards|
+		entry) networking. Not supported together with a custom |nic0| unless |use_gvproxy|
+		is enabled. The resolved mappings are exported in |port_forwards|.
+
+		A guest port (per protocol) can only be forwarded once, i.e. it can't be reachable at
+		two host addresses or ports.`),
+		PlanModifiers: []planmodifier.List{
+			listplanmodifier.RequiresReplace(),
+		},
+		NestedObject: schema.NestedBlockObject{
+			Attributes: map[string]schema.Attribute{
+				"protocol": schema.StringAttribute{
+					Description: `Transport protocol: "tcp" (default) or "udp".`,
+					Optional:    true,
+					Validators: []validator.String{
+						stringvalidator.OneOf("tcp", "udp"),
+					},
+				},
+				"host_addr": schema.StringAttribute{
+					Description: "Host IPv4 or IPv6 address to bind the forward on. Default: all host addresses.",
+					Optional:    true,
+					Validators: []validator.String{
+						ipAddressValidator{},
+					},
+				},
+				"host_port": schema.Int32Attribute{
+					Description: "Host port of the forward. If not set a random free-range port is allocated " +
+						"(the same way as `ssh_port`); see `port_forwards` for the resolved value.",
+					Optional: true,
+					Validators: []validator.Int32{
+						int32validator.Between(1, 65535),
+					},
+				},
+				"guest_port": schema.Int32Attribute{
+					Description: "Port inside the guest (EVE-OS) that the forward targets.",
+					Required:    true,
+					Validators: []validator.Int32{
+						int32validator.Between(1, 65535),
+					},
+				},
+			},
+		},
+	}
+}
+
+// portForwardsSchemaAttribute returns the computed `port_forwards` attribute.
+func portForwardsSchemaAttribute() schema.MapNestedAttribute {
+	return schema.MapNestedAttribute{
+		Description: "Resolved host->guest port forwards of nic0, keyed by `<protocol>/<guest_port>` " +
+			"(e.g. `tcp/22`, `udp/5000`), so there is one forward per guest port. Includes the standard " +
+			"forwards and every `port_forward` block. " +
+			"Null when a custom `nic0` is used on Linux without gvproxy.",
+		MarkdownDescription: "Resolved host→guest port forwards of `nic0`, keyed by `<protocol>/<guest_port>` " +
+			"(e.g. `tcp/22`, `udp/5000`), so there is one forward per guest port. Includes the standard " +
+			"forwards and every `port_forward` block.\n\n" +
+			"Null when a custom `nic0` is used on Linux without gvproxy.",
+		Computed: true,
+		NestedObject: schema.NestedAttributeObject{
+			Attributes: map[string]schema.Attribute{
+				"protocol": schema.StringAttribute{
+					Description: "Transport protocol, tcp or udp.",
+					Computed:    true,
+				},
+				"host_addr": schema.StringAttribute{
+					Description: "Host address at which the forward is reachable.",
+					Computed:    true,
+				},
+				"host_port": schema.Int32Attribute{
+					Description: "Resolved host port.",
+					Computed:    true,
+				},
+				"guest_port": schema.Int32Attribute{
+					Description: "Guest port.",
+					Computed:    true,
+				},
+			},
+		},
+	}
+}
+
+// ipAddressValidator validates that a string attribute holds an IPv4 or IPv6
+// address (not a hostname), so that a typo fails the plan and not the start
+// of QEMU or gvproxy. An empty string is left to the attribute's semantics.
+type ipAddressValidator struct{}
+
+var _ validator.String = ipAddressValidator{}
+
+func (v ipAddressValidator) Description(_ context.Context) string {
+	return "must be an IPv4 or IPv6 address"
+}
+
+func (v ipAddressValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v ipAddressValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() || req.ConfigValue.ValueString() == "" {
+		return
+	}
+
+	if s := req.ConfigValue.ValueString(); net.ParseIP(s) == nil {
+		resp.Diagnostics.AddAttributeError(req.Path,
+			"Invalid IP Address",
+			fmt.Sprintf("%q is not an IPv4 or IPv6 address, e.g. \"127.0.0.1\" or \"::1\" (without brackets).", s))
+	}
+}
+
+// portForwardKey returns the `port_forwards` map key for a forward.
+func portForwardKey(protocol string, guestPort int) string {
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return fmt.Sprintf("%s/%d", protocol, guestPort)
+}
+
+// buildPortForwards validates the `port_forward` blocks and resolves them into
+// hypervisor.PortForward values, allocating a random host port for blocks
+// without one. Host ports already taken by the standard forwards (derived from
+// sshPort) or by other blocks are never handed out twice.
+func buildPortForwards(blocks []PortForwardBlockModel, sshPort int32) ([]hypervisor.PortForward, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	used := make(map[string]bool)
+	keys := make(map[string]bool)
+	for _, f := range hypervisor.StandardForwards {
+		used[fmt.Sprintf("tcp/%d", int(sshPort)+f.HostOffset)] = true
+		keys[portForwardKey("tcp", f.GuestPort)] = true
+	}
+
+	// First pass: explicit host ports, so that auto-allocation can avoid them.
+	forwards := make([]hypervisor.PortForward, len(blocks))
+	for i, b := range blocks {
+		pf := hypervisor.PortForward{
+			Protocol:  "tcp",
+			HostAddr:  b.HostAddr.ValueString(),
+			GuestPort: int(b.GuestPort.ValueInt32()),
+		}
+		if !b.Protocol.IsNull() && b.Protocol.ValueString() != "" {
+			pf.Protocol = b.Protocol.ValueString()
+		}
+
+		k := portForwardKey(pf.Protocol, pf.GuestPort)
+		if keys[k] {
+			diags.AddError("Invalid port_forward configuration",
+				fmt.Sprintf("port_forward %d: guest port %s is already forwarded, a guest port can only be "+
+					"forwarded once.", i, k))
+			continue
+		}
+		keys[k] = true
+
+		if !b.HostPort.IsNull() && !b.HostPort.IsUnknown() {
+			pf.HostPort = int(b.HostPort.ValueInt32())
+			hk := fmt.Sprintf("%s/%d", pf.Protocol, pf.HostPort)
+			if used[hk] {
+				diags.AddError("Invalid port_forward configuration",
+					fmt.Sprintf("port_forward %d: host port %s is already in use by another forward.", i, hk))
+				continue
+			}
+			used[hk] = true
+		}
+		forwards[i] = pf
+	}
+	if diags.HasError() {
+		return nil, diags
+	}
+
+	// Second pass: auto-allocate the remaining host ports.
+	for i := range forwards {
+		if forwards[i].HostPort != 0 {
+			continue
+		}
+		for {
+			p := autoPortBase + int(rand.Uint32N(autoPortRange))
+			hk := fmt.Sprintf("%s/%d", forwards[i].Protocol, p)
+			if !used[hk] {
+				used[hk] = true
+				forwards[i].HostPort = p
+				break
+			}
+		}
+	}
+
+	return forwards, diags
+}
+
+// portForwardsValue builds the computed `port_forwards` map from the standard
+// forwards and the resolved extra forwards. host is the target address, as for
+// hypervisor.DescribePortForwards.
+func portForwardsValue(host string, sshPort int32, extra []hypervisor.PortForward) (types.Map, diag.Diagnostics) {
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	}
+	elems := make(map[string]attr.Value, len(hypervisor.StandardForwards)+len(extra))
+	add := func(protocol, hostAddr string, hostPort, guestPort int) diag.Diagnostics {
+		obj, diags := types.ObjectValue(portForwardAttrTypes, map[string]attr.Value{
+			"protocol":   types.StringValue(protocol),
+			"host_addr":  types.StringValue(hostAddr),
+			"host_port":  types.Int32Value(int32(hostPort)),
+			"guest_port": types.Int32Value(int32(guestPort)),
+		})
+		elems[portForwardKey(protocol, guestPort)] = obj
+		return diags
+	}
+
+	var diags diag.Diagnostics
+	for _, f := range hypervisor.StandardForwards {
+		diags.Append(add("tcp", host, int(sshPort)+f.HostOffset, f.GuestPort)...)
+	}
+	for _, f := range extra {
+		addr := host
+		if f.HostAddr != "" && f.HostAddr != "0.0.0.0" {
+			addr = f.HostAddr
+		}
+		diags.Append(add(f.Protocol, addr, f.HostPort, f.GuestPort)...)
+	}
+	if diags.HasError() {
+		return types.MapNull(types.ObjectType{AttrTypes: portForwardAttrTypes}), diags
+	}
+
+	m, mDiags := types.MapValue(types.ObjectType{AttrTypes: portForwardAttrTypes}, elems)
+	diags.Append(mDiags...)
+	return m, diags
+}
+
+// validateUserNetworkNic0 checks that nothing else configures nic0 when the
+// edge node joins a shared zedamigo_user_network.
+func validateUserNetworkNic0(data *EdgeNodeModel, targetOS string) diag.Diagnostics {
+	var diags diag.Diagnostics
+	conflict := func(attr string) {
+		diags.AddError("Invalid user_network_socket configuration",
+			fmt.Sprintf("%s can't be used together with user_network_socket: nic0 is connected to the "+
+				"shared user network, which owns its port forwards.", attr))
+	}
+
+	if targetOS == "darwin" {
+		diags.AddError("Invalid user_network_socket configuration",
+			"Shared user networks are only supported with the QEMU hypervisor (Linux targets).")
+	}
+	if !data.Nic0.IsNull() && data.Nic0.ValueString() != "" {
+		conflict("nic0")
+	}
+	if !data.UseGvproxy.IsNull() && data.UseGvproxy.ValueBool() {
+		conflict("use_gvproxy")
+	}
+	if !data.Nic0IPv6.IsNull() && data.Nic0IPv6.ValueBool() {
+		conflict("nic0_ipv6")
+	}
+	if len(data.PortForward) > 0 {
+		conflict("port_forward")
+	}
+	if !data.Nic0MAC.IsNull() && !data.Nic0MAC.IsUnknown() {
+		if _, err := net.ParseMAC(data.Nic0MAC.ValueString()); err != nil {
+			diags.AddError("Invalid nic0_mac configuration", fmt.Sprintf("nic0_mac: %v", err))
+		}
+	}
+
+	return diags
+}
+
+// randomNic0MAC returns a random MAC address in the QEMU 52:54:00 OUI, so that
+// several edge nodes on one shared user network don't collide.
+func randomNic0MAC() string {
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", rand.Uint32N(256), rand.Uint32N(256), rand.Uint32N(256))
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+func TestBuildPortForwards_ExplicitAndAuto(t *testing.T) {
+	is := is.New(t)
+	blocks := []PortForwardBlockModel{
+		{Protocol: types.StringNull(), HostAddr: types.StringNull(), HostPort: types.Int32Value(18080), GuestPort: types.Int32Value(8080)},
+		{Protocol: types.StringValue("udp"), HostAddr: types.StringValue("127.0.0.1"), HostPort: types.Int32Null(), GuestPort: types.Int32Value(5000)},
+	}
+	fwds, diags := buildPortForwards(blocks, 50277)
+	is.True(!diags.HasError())
+	is.Equal(len(fwds), 2)
+	is.Equal(fwds[0].Protocol, "tcp")
+	is.Equal(fwds[0].HostPort, 18080)
+	is.Equal(fwds[1].Protocol, "udp")
+	is.Equal(fwds[1].HostAddr, "127.0.0.1")
+	is.True(fwds[1].HostPort >= autoPortBase && fwds[1].HostPort < autoPortBase+autoPortRange)
+}
+
+func TestBuildPortForwards_Conflicts(t *testing.T) {
+	is := is.New(t)
+
+	// Guest TCP port 22 is already covered by the standard forwards.
+	_, diags := buildPortForwards([]PortForwardBlockModel{
+		{GuestPort: types.Int32Value(22)},
+	}, 50277)
+	is.True(diags.HasError())
+
+	// Host port 50278 is ssh_port+1, used by the standard 10022 forward.
+	_, diags = buildPortForwards([]PortForwardBlockModel{
+		{HostPort: types.Int32Value(50278), GuestPort: types.Int32Value(8080)},
+	}, 50277)
+	is.True(diags.HasError())
+
+	// The same host port is fine for different protocols.
+	_, diags = buildPortForwards([]PortForwardBlockModel{
+		{HostPort: types.Int32Value(15000), GuestPort: types.Int32Value(5000)},
+		{Protocol: types.StringValue("udp"), HostPort: types.Int32Value(15000), GuestPort: types.Int32Value(5000)},
+	}, 50277)
+	is.True(!diags.HasError())
+}
+
+func TestPortForwardsValue(t *testing.T) {
+	is := is.New(t)
+	fwds, diags := buildPortForwards([]PortForwardBlockModel{
+		{Protocol: types.StringValue("udp"), HostPort: types.Int32Value(15000), GuestPort: types.Int32Value(5000)},
+	}, 50277)
+	is.True(!diags.HasError())
+	m, diags := portForwardsValue("localhost", 50277, fwds)
+	is.True(!diags.HasError())
+	is.Equal(len(m.Elements()), 4)
+	_, ok := m.Elements()["tcp/22"]
+	is.True(ok)
+	_, ok = m.Elements()["udp/5000"]
+	is.True(ok)
+}
+
+func TestIPAddressValidator(t *testing.T) {
+	is := is.New(t)
+
+	for s, ok := range map[string]bool{
+		"":             true, // all host addresses
+		"127.0.0.1":    true,
+		"::1":          true,
+		"fd00::10":     true,
+		"0.0.0.300":    false,
+		"localhost":    false,
+		"[::1]":        false,
+		"127.0.0.1:80": false,
+	} {
+		resp := &validator.StringResponse{}
+		ipAddressValidator{}.ValidateString(context.Background(), validator.StringRequest{
+			Path:        path.Root("host_addr"),
+			ConfigValue: types.StringValue(s),
+		}, resp)
+		is.Equal(!resp.Diagnostics.HasError(), ok) // host_addr validation
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math/rand/v2"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
@@ -15,6 +16,7 @@ import (
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
@@ -44,33 +46,43 @@ type EdgeNode struct {
 
 // EdgeNodeModel describes the resource data model.
 type EdgeNodeModel struct {
-	ID               types.String     `tfsdk:"id"`
-	Name             types.String     `tfsdk:"name"`
-	Mem              types.String     `tfsdk:"mem"`
-	CPUs             types.Int64      `tfsdk:"cpus"`
-	SerialNo         types.String     `tfsdk:"serial_no"`
-	Nic0             types.String     `tfsdk:"nic0"`
-	SerialPortServer types.Bool       `tfsdk:"serial_port_server"`
-	SerialPortSocket types.String     `tfsdk:"serial_port_socket"`
-	DiskImgBase      types.String     `tfsdk:"disk_image_base"`
-	Disk1ImgBase     types.String     `tfsdk:"disk_1_image_base"`
-	DiskSizeMB       types.Int64      `tfsdk:"disk_size_mb"`
-	DriveIf          types.String     `tfsdk:"drive_if"`
-	SwTPMSock        types.String     `tfsdk:"swtpm_socket"`
-	DiskImg          types.String     `tfsdk:"disk_image"`
-	Disk1Img         types.String     `tfsdk:"disk_1_image"`
-	SerialConsoleLog types.String     `tfsdk:"serial_console_log"`
-	SerialType       types.String     `tfsdk:"serial_type"`
-	OvmfVarsSrc      types.String     `tfsdk:"ovmf_vars_src"`
-	OvmfVars         types.String     `tfsdk:"ovmf_vars"`
-	QmpSocket        types.String     `tfsdk:"qmp_socket"`
-	VMRunning        types.Bool       `tfsdk:"vm_running"`
-	SSHPort          types.Int32      `tfsdk:"ssh_port"`
-	Nic0PortForwards types.String     `tfsdk:"nic0_port_forwards"`
-	ExtraArgs        types.List       `tfsdk:"extra_qemu_args"`
-	CPUPins          types.List       `tfsdk:"cpu_pins"`
-	UseGvproxy       types.Bool       `tfsdk:"use_gvproxy"`
-	Disks            []DiskBlockModel `tfsdk:"disk"`
+	ID               types.String            `tfsdk:"id"`
+	Name             types.String            `tfsdk:"name"`
+	Mem              types.String            `tfsdk:"mem"`
+	CPUs             types.Int64             `tfsdk:"cpus"`
+	SerialNo         types.String            `tfsdk:"serial_no"`
+	Nic0             types.String            `tfsdk:"nic0"`
+	Nic0IPv6         types.Bool              `tfsdk:"nic0_ipv6"`
+	SerialPortServer types.Bool              `tfsdk:"serial_port_server"`
+	SerialPortSocket types.String            `tfsdk:"serial_port_socket"`
+	DiskImgBase      types.String            `tfsdk:"disk_image_base"`
+	Disk1ImgBase     types.String            `tfsdk:"disk_1_image_base"`
+	DiskSizeMB       types.Int64             `tfsdk:"disk_size_mb"`
+	DriveIf          types.String            `tfsdk:"drive_if"`
+	SwTPMSock        types.String            `tfsdk:"swtpm_socket"`
+	DiskImg          types.String            `tfsdk:"disk_image"`
+	Disk1Img         types.String            `tfsdk:"disk_1_image"`
+	SerialConsoleLog types.String            `tfsdk:"serial_console_log"`
+	SerialType       types.String            `tfsdk:"serial_type"`
+	RTCBase          types.String            `tfsdk:"rtc_base"`
+	BootOrder        types.String            `tfsdk:"boot_order"`
+	BootOnce         types.String            `tfsdk:"boot_once"`
+	OvmfVarsSrc      types.String            `tfsdk:"ovmf_vars_src"`
+	OvmfVars         types.String            `tfsdk:"ovmf_vars"`
+	QmpSocket        types.String            `tfsdk:"qmp_socket"`
+	VMRunning        types.Bool              `tfsdk:"vm_running"`
+	SSHPort          types.Int32             `tfsdk:"ssh_port"`
+	Nic0PortForwards types.String            `tfsdk:"nic0_port_forwards"`
+	ExtraArgs        types.List              `tfsdk:"extra_qemu_args"`
+	CPUPins          types.List              `tfsdk:"cpu_pins"`
+	UseGvproxy       types.Bool              `tfsdk:"use_gvproxy"`
+	UserNetworkSock  types.String            `tfsdk:"user_network_socket"`
+	Nic0MAC          types.String            `tfsdk:"nic0_mac"`
+	GvproxyControl   types.String            `tfsdk:"gvproxy_control_socket"`
+	Disks            []DiskBlockModel        `tfsdk:"disk"`
+	PortForward      []PortForwardBlockModel `tfsdk:"port_forward"`
+	PortForwards     types.Map               `tfsdk:"port_forwards"`
+	MacvtapNic       []MacvtapNicBlockModel  `tfsdk:"macvtap_nic"`
 }
 
 func (r *EdgeNode) getResourceDir(id string) string {
@@ -132,10 +144,36 @@ func (r *EdgeNode) Schema(ctx context.Context, req resource.SchemaRequest, resp
 				forward to the VM port 22. Two addtional ports forwards are set up: $random + 1 to 10022 and $random + 2 to 10080
 				of the VM. These might be useful if the an edge-app-instance is configured with an inbound rule that maps ports
 				10022 or 10080 of the edge node (EVE-OS) to ports of the edge-app-instance. Note that in this case to access an
-				edge-app-instance from the host 2 levels of port forwards are involved.`),
+				edge-app-instance from the host 2 levels of port forwards are involved. Further forwards (TCP or UDP) can
+				be added with |port_forward| blocks.`),
 				Optional: true,
 				Required: false,
 			},
+			"nic0_ipv6": schema.BoolAttribute{
+				Description: "Enable dual-stack IPv6 on the default nic0: the VM gets IPv6 connectivity on the " +
+					hypervisor.SLIRPIPv6Net + " prefix and every port forward is also reachable over IPv6 on the host. " +
+					"With QEMU SLIRP this requires a QEMU version whose SLIRP hostfwd accepts IPv6 addresses; with gvproxy " +
+					"(`use_gvproxy = true`, always on macOS) the same prefix is advertised by gvproxy's IPv6 router. " +
+					"Not supported together with a custom nic0. Default: `false`.",
+				MarkdownDescription: undent.Md(`
+				Enable dual-stack IPv6 on the default |nic0|. Default: |false|.
+
+				The VM gets IPv6 connectivity (SLAAC) on the |` + hypervisor.SLIRPIPv6Net + `| prefix, the
+				host is reachable at |` + hypervisor.SLIRPIPv6Host + `|, and every port forward is also reachable
+				over IPv6 on the host.
+
+				- **QEMU SLIRP:** uses the |ipv6-net| / |ipv6-host| SLIRP options. Requires a QEMU version whose
+				  SLIRP |hostfwd| accepts IPv6 addresses.
+				- **gvproxy** (|use_gvproxy = true|, always on macOS): gvproxy's IPv6 router advertises the
+				  prefix and forwards the VM's IPv6 TCP and UDP connections through the host. The port forwards
+				  listen on the dual-stack |[::]| and still reach the VM over IPv4.
+
+				Not supported together with a custom |nic0|.`),
+				Optional: true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
 			"serial_port_server": schema.BoolAttribute{
 				Description: `Configure the edge-node serial port as a UNIX socket server. ` +
 					`On Linux (QEMU), when true the serial port is exposed as a UNIX socket server and a socket tailer process ` +
@@ -191,6 +229,55 @@ func (r *EdgeNode) Schema(ctx context.Context, req resource.SchemaRequest, resp
 					stringplanmodifier.RequiresReplace(),
 				},
 			},
+			"rtc_base": schema.StringAttribute{
+				Description: `Start value of the RTC of the edge node VM (QEMU "-rtc base="): "utc" (the QEMU default), ` +
+					`"localtime", a date like "2029-01-02" or "2029-01-02T03:04:05", or a clock offset from the ` +
+					`current time like "+3y" or "-90d". QEMU-only.`,
+				MarkdownDescription: undent.Md(`
+				Start value of the RTC of the edge node VM (QEMU |-rtc base=|): |utc| (the QEMU default),
+				|localtime|, a UTC date like |2029-01-02| or |2029-01-02T03:04:05|, or a clock offset from
+				the current time like |+3y| or |-90d| (see the |offset| of |zedamigo_ntp_server|). An offset
+				is computed when the VM is created. Together with a skewed |zedamigo_ntp_server| it
+				reproduces an edge node with a wrong clock. QEMU-only.`),
+				Optional: true,
+				Validators: []validator.String{
+					rtcBaseValidator{},
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"boot_order": schema.StringAttribute{
+				Description: `First boot device of the edge node VM: "disk" (default) or "network" (a PXE / iPXE ` +
+					`boot from nic0, on every boot). QEMU-only.`,
+				MarkdownDescription: undent.Md(`
+				First boot device of the edge node VM: |disk| (default) or |network|, a PXE / iPXE boot from
+				nic0 on every boot, e.g. with the |netboot| block of a |zedamigo_dhcp_server| and a
+				|zedamigo_ipxe_boot|. The UEFI firmware then tries the disks. A VM with empty disks falls back
+				to the network anyway. QEMU-only.`),
+				Optional: true,
+				Validators: []validator.String{
+					stringvalidator.OneOf("disk", "network"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"boot_once": schema.StringAttribute{
+				Description: `Set to "network" to boot the edge node VM from nic0 for its first boot only, e.g. to ` +
+					`install EVE-OS over iPXE, the next (guest) reboots boot from the disks. QEMU-only.`,
+				MarkdownDescription: undent.Md(`
+				Set to |network| to boot the edge node VM from nic0 for its first boot only, e.g. to install
+				EVE-OS over iPXE with a |zedamigo_ipxe_boot|: the next reboots, done by the guest, boot from
+				the disks, with the installed EVE-OS. QEMU-only.`),
+				Optional: true,
+				Validators: []validator.String{
+					stringvalidator.OneOf("network"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
 			"disk_image_base": schema.StringAttribute{
 				Description:         "Legacy disk0 backing file: a qcow2 overlay is created from it (qemu-img backing file). Alternative to the `disk` block (mutually exclusive). Either this or a `disk` block is required.",
 				MarkdownDescription: "Legacy disk0 backing file: a qcow2 overlay is created from it (qemu-img backing file). Alternative to the `disk` block (mutually exclusive). Either this or a `disk` block is required.",
@@ -276,6 +363,7 @@ func (r *EdgeNode) Schema(ctx context.Context, req resource.SchemaRequest, resp
 					"defined entirely by your `nic0` string and the provider does not interpret them.",
 				Computed: true,
 			},
+			"port_forwards": portForwardsSchemaAttribute(),
 			"extra_qemu_args": schema.ListAttribute{
 				Description: "Extra CLI arguments for the QEMU command used to start the edge node VM. Passed verbatim to QEMU.",
 				MarkdownDescription: undent.Md(`
@@ -296,6 +384,35 @@ func (r *EdgeNode) Schema(ctx context.Context, req resource.SchemaRequest, resp
 				MarkdownDescription: "Use embedded gvproxy for networking instead of QEMU SLIRP. Requires QEMU 7.2+. Default: `false` on Linux but `true` on MacOS since there we have to use it since we use `vfkit` instead of `qemu`.",
 				Optional:            true,
 			},
+			"user_network_socket": schema.StringAttribute{
+				Description: "Connect nic0 to a shared gvproxy network, the `socket` of a `zedamigo_user_network`, " +
+					"instead of QEMU SLIRP or a per-VM gvproxy. Linux (QEMU) only.",
+				MarkdownDescription: undent.Md(`
+				Connect |nic0| to a shared gvproxy network: the |socket| of a |zedamigo_user_network| resource.
+				All edge nodes using the same network share one L2 segment and can reach each other. The
+				network's own |forward| blocks replace the per-VM port forwards, so |ssh_port|,
+				|nic0_port_forwards| and |port_forwards| are null and |port_forward|, |nic0_ipv6|,
+				|use_gvproxy| and a custom |nic0| can't be used. Linux (QEMU) only.`),
+				Optional: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"nic0_mac": schema.StringAttribute{
+				Description: "MAC address of nic0 when `user_network_socket` is set. If not set a random " +
+					"`52:54:00:xx:xx:xx` address is generated. Use it in a `static_lease` of the user network to pin the VM IP.",
+				Optional: true,
+				Computed: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"gvproxy_control_socket": schema.StringAttribute{
+				Description: "UNIX socket of the per-VM gvproxy HTTP control API. Use it as the `control_socket` of " +
+					"`zedamigo_port_expose` to add port forwards to the running VM. Null unless gvproxy is used.",
+				Computed: true,
+			},
 			"cpu_pins": schema.ListAttribute{
 				Description: "List of host CPU IDs to pin VM vCPUs to. Must match CPU count.",
 				MarkdownDescription: undent.Md(`
@@ -309,7 +426,9 @@ func (r *EdgeNode) Schema(ctx context.Context, req resource.SchemaRequest, resp
 			},
 		},
 		Blocks: map[string]schema.Block{
-			"disk": diskSchemaBlock(),
+			"disk":         diskSchemaBlock(),
+			"port_forward": portForwardSchemaBlock(),
+			"macvtap_nic":  macvtapNicSchemaBlock(),
 		},
 	}
 }
@@ -353,7 +472,7 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 		return
 	}
 
-	data.SSHPort = types.Int32Value(10000 + int32(rand.Uint32N(55534)))
+	data.SSHPort = types.Int32Value(autoPortBase + int32(rand.Uint32N(autoPortRange)))
 
 	d := r.getResourceDir(data.ID.ValueString())
 	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
@@ -367,17 +486,49 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 		return
 	}
 
+	portForwards, pfDiags := buildPortForwards(data.PortForward, data.SSHPort.ValueInt32())
+	resp.Diagnostics.Append(pfDiags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	userNetwork := !data.UserNetworkSock.IsNull() && data.UserNetworkSock.ValueString() != ""
+	if userNetwork {
+		resp.Diagnostics.Append(validateUserNetworkNic0(&data, r.providerConf.TargetOS)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		if data.Nic0MAC.IsNull() || data.Nic0MAC.IsUnknown() || data.Nic0MAC.ValueString() == "" {
+			data.Nic0MAC = types.StringValue(randomNic0MAC())
+		}
+	} else {
+		if !data.Nic0MAC.IsNull() && !data.Nic0MAC.IsUnknown() {
+			resp.Diagnostics.AddError("Invalid nic0_mac configuration",
+				"nic0_mac is only used together with user_network_socket.")
+			return
+		}
+		data.Nic0MAC = types.StringNull()
+	}
+
 	// Build VMConfig for the hypervisor.
 	customNic0 := !data.Nic0.IsNull() && strings.TrimSpace(data.Nic0.ValueString()) != ""
-	nic0 := hypervisor.SLIRPNic0(data.SSHPort.ValueInt32())
+	nic0IPv6 := !data.Nic0IPv6.IsNull() && data.Nic0IPv6.ValueBool()
+	nic0 := hypervisor.SLIRPNic0(data.SSHPort.ValueInt32(), nic0IPv6, portForwards...)
 	if customNic0 {
 		nic0 = data.Nic0.ValueString()
 	}
 
 	// gvproxy (and the macOS vfkit backend, which always uses gvproxy) provides
-	// networking itself with a fixed set of port forwards and ignores the nic0
-	// string entirely. Warn when a custom nic0 would be silently dropped.
+	// networking itself with the standard plus port_forward forwards and ignores
+	// the nic0 string entirely. Warn when a custom nic0 would be silently dropped.
 	gvproxyActive := (!data.UseGvproxy.IsNull() && data.UseGvproxy.ValueBool()) || r.providerConf.TargetOS == "darwin"
+	if customNic0 && !gvproxyActive && len(portForwards) > 0 {
+		resp.Diagnostics.AddError("Invalid port_forward configuration",
+			"port_forward blocks are only applied to the default nic0 or to gvproxy networking. "+
+				"With a custom nic0 add the forwards as hostfwd= options to the nic0 string instead, "+
+				"or set use_gvproxy = true.")
+		return
+	}
 	if customNic0 && gvproxyActive {
 		reason := "use_gvproxy is set to true"
 		if r.providerConf.TargetOS == "darwin" {
@@ -386,12 +537,18 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 		resp.Diagnostics.AddWarning(
 			"Custom nic0 ignored: gvproxy is active",
 			fmt.Sprintf("The nic0 attribute is set to a custom value, but %s, so the custom nic0 "+
-				"value is ignored. gvproxy provides networking with a fixed set of host port "+
-				"forwards (to guest TCP ports 22, 10022 and 10080) and does not use the QEMU "+
-				"-nic configuration. To use the custom nic0, set use_gvproxy = false (not "+
+				"value is ignored. gvproxy provides networking with the standard host port "+
+				"forwards (to guest TCP ports 22, 10022 and 10080) plus any port_forward blocks and "+
+				"does not use the QEMU -nic configuration. To use the custom nic0, set use_gvproxy = false (not "+
 				"supported on macOS); otherwise remove the nic0 attribute to silence this warning.", reason),
 		)
 	}
+	if customNic0 && !gvproxyActive && nic0IPv6 {
+		resp.Diagnostics.AddError("Invalid nic0_ipv6 configuration",
+			"nic0_ipv6 only applies to the default nic0 or to gvproxy networking. "+
+				"With a custom nic0 set the SLIRP ipv6 options in the nic0 string instead.")
+		return
+	}
 
 	var extraArgs []string
 	if !data.ExtraArgs.IsNull() {
@@ -430,12 +587,44 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 		}
 	}
 
+	if r.providerConf.TargetOS == "darwin" && len(data.MacvtapNic) > 0 {
+		resp.Diagnostics.AddError("Invalid macvtap_nic configuration",
+			"macvtap_nic blocks are only supported on Linux (QEMU).")
+		return
+	}
+
 	if r.providerConf.TargetOS == "darwin" && data.SerialType.ValueString() == "serial" {
 		resp.Diagnostics.AddError("Invalid serial_type for macOS",
 			`On macOS (vfkit), only serial_type = "virtio" is supported.`)
 		return
 	}
 
+	if r.providerConf.TargetOS == "darwin" && !data.RTCBase.IsNull() {
+		resp.Diagnostics.AddError("Invalid rtc_base configuration",
+			"rtc_base is only supported on Linux (QEMU).")
+		return
+	}
+	bootNetwork := ""
+	if data.BootOnce.ValueString() == "network" {
+		bootNetwork = hypervisor.BootNetworkOnce
+	}
+	if data.BootOrder.ValueString() == "network" {
+		bootNetwork = hypervisor.BootNetworkAlways
+	}
+	if r.providerConf.TargetOS == "darwin" && bootNetwork != "" {
+		resp.Diagnostics.AddError("Invalid boot configuration",
+			`boot_order = "network" and boot_once are only supported on Linux (QEMU).`)
+		return
+	}
+	var rtcBase string
+	if !data.RTCBase.IsNull() {
+		var err error
+		if rtcBase, err = qemuRTCBase(data.RTCBase.ValueString(), time.Now()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("rtc_base"), "Invalid rtc_base configuration", err.Error())
+			return
+		}
+	}
+
 	disks, diskDiags := buildDisks(ctx, r.providerConf.Exec, data.Disks, legacyDiskAttrs{
 		DiskImageBase:  data.DiskImgBase,
 		Disk1ImageBase: data.Disk1ImgBase,
@@ -448,21 +637,30 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 	}
 
 	vmConf := hypervisor.VMConfig{
-		Name:        data.Name.ValueString(),
-		ID:          data.ID.ValueString(),
-		SerialNo:    data.SerialNo.ValueString(),
-		ResourceDir: d,
-		MemoryMB:    data.Mem.ValueString(),
-		CPUs:        data.CPUs.ValueInt64(),
-		Disks:       disks,
-		OVMFVarsSrc: data.OvmfVarsSrc.ValueString(),
-		Nic0:        nic0,
-		SSHPort:     data.SSHPort.ValueInt32(),
-		SwTPMSocket: data.SwTPMSock.ValueString(),
-		ExtraArgs:   extraArgs,
-		CPUPins:     cpuPins,
-		UseGvproxy:  !data.UseGvproxy.IsNull() && data.UseGvproxy.ValueBool(),
-		SerialType:  data.SerialType.ValueString(),
+		Name:         data.Name.ValueString(),
+		ID:           data.ID.ValueString(),
+		SerialNo:     data.SerialNo.ValueString(),
+		ResourceDir:  d,
+		MemoryMB:     data.Mem.ValueString(),
+		CPUs:         data.CPUs.ValueInt64(),
+		Disks:        disks,
+		OVMFVarsSrc:  data.OvmfVarsSrc.ValueString(),
+		Nic0:         nic0,
+		MacvtapNics:  buildMacvtapNics(data.MacvtapNic),
+		SSHPort:      data.SSHPort.ValueInt32(),
+		PortForwards: portForwards,
+		Nic0IPv6:     nic0IPv6,
+		SwTPMSocket:  data.SwTPMSock.ValueString(),
+		ExtraArgs:    extraArgs,
+		CPUPins:      cpuPins,
+		UseGvproxy:   !data.UseGvproxy.IsNull() && data.UseGvproxy.ValueBool(),
+		SerialType:   data.SerialType.ValueString(),
+		RTCBase:      rtcBase,
+		BootNetwork:  bootNetwork,
+	}
+	if userNetwork {
+		vmConf.UserNetworkSocket = data.UserNetworkSock.ValueString()
+		vmConf.Nic0MAC = data.Nic0MAC.ValueString()
 	}
 
 	// Handle serial console config.
@@ -539,6 +737,12 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 		}
 	}
 
+	if err := r.providerConf.Hypervisor.ApplyBootOrder(ctx, vmConf); err != nil {
+		resp.Diagnostics.AddError("Edge Node Resource Error",
+			fmt.Sprintf("Failed to boot from the network: %v", err))
+		return
+	}
+
 	if err := r.providerConf.Hypervisor.ApplyCPUPins(ctx, vmConf); err != nil {
 		resp.Diagnostics.AddError("Edge Node Resource Error",
 			fmt.Sprintf("Failed to apply CPU pinning: %v", err))
@@ -559,11 +763,24 @@ func (r *EdgeNode) Create(ctx context.Context, req resource.CreateRequest, resp
 	// and vfkit on macOS always uses gvproxy). With a custom nic0 on Linux without
 	// gvproxy the nic0 string is used verbatim and ssh_port maps to nothing, so we
 	// null both attributes rather than advertise a misleading port.
-	if !customNic0 || gvproxyActive {
-		data.Nic0PortForwards = types.StringValue(hypervisor.DescribePortForwards(r.providerConf.Target, data.SSHPort.ValueInt32()))
+	data.GvproxyControl = types.StringNull()
+	if gvproxyActive && !userNetwork {
+		data.GvproxyControl = types.StringValue(filepath.Join(d, hypervisor.GvproxyControlSocket))
+	}
+	if userNetwork {
+		// The forwards belong to the shared zedamigo_user_network.
+		data.SSHPort = types.Int32Null()
+		data.Nic0PortForwards = types.StringNull()
+		data.PortForwards = types.MapNull(types.ObjectType{AttrTypes: portForwardAttrTypes})
+	} else if !customNic0 || gvproxyActive {
+		data.Nic0PortForwards = types.StringValue(hypervisor.DescribePortForwards(r.providerConf.Target, data.SSHPort.ValueInt32(), portForwards...))
+		pfMap, diags := portForwardsValue(r.providerConf.Target, data.SSHPort.ValueInt32(), portForwards)
+		resp.Diagnostics.Append(diags...)
+		data.PortForwards = pfMap
 	} else {
 		data.SSHPort = types.Int32Null()
 		data.Nic0PortForwards = types.StringNull()
+		data.PortForwards = types.MapNull(types.ObjectType{AttrTypes: portForwardAttrTypes})
 	}
 
 	// Save data into Terraform state
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/matryer/is"
+)
+
+// hasRequiresReplace reports whether one of the plan modifiers is a
+// RequiresReplace, recognized by its description.
+func hasRequiresReplace[M interface {
+	Description(context.Context) string
+}](ctx context.Context, mods []M) bool {
+	replace := listplanmodifier.RequiresReplace().Description(ctx)
+	for _, m := range mods {
+		if m.Description(ctx) == replace {
+			return true
+		}
+	}
+	return false
+}
+
+// TestEdgeNodeRequiresReplace checks that attributes and blocks force a new
+// edge node, Update isn't supported.
+func TestEdgeNodeRequiresReplace(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	var resp resource.SchemaResponse
+	(&EdgeNode{}).Schema(ctx, resource.SchemaRequest{}, &resp)
+	is.True(!resp.Diagnostics.HasError())
+
+	for _, name := range []string{"port_forward", "macvtap_nic"} {
+		b, ok := resp.Schema.Blocks[name].(schema.ListNestedBlock)
+		is.True(ok)                                       // A list block.
+		is.True(hasRequiresReplace(ctx, b.PlanModifiers)) // The block requires replacement.
+	}
+
+	for _, name := range []string{"nic0_ipv6", "user_network_socket", "nic0_mac"} {
+		replace := false
+		switch a := resp.Schema.Attributes[name].(type) {
+		case schema.BoolAttribute:
+			replace = hasRequiresReplace(ctx, a.PlanModifiers)
+		case schema.StringAttribute:
+			replace = hasRequiresReplace(ctx, a.PlanModifiers)
+		}
+		if !replace {
+			t.Errorf("%s doesn't require replacement", name)
+		}
+	}
+}
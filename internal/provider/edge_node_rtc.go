@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+)
+
+// qemuRTCBaseFormat is the date format of the QEMU `-rtc base=` option.
+const qemuRTCBaseFormat = "2006-01-02T15:04:05"
+
+// qemuRTCBase returns the QEMU `-rtc base=` value of an `rtc_base`: "utc",
+// "localtime" and dates are used as they are, a clock offset (see
+// parseClockOffset) is added to now.
+func qemuRTCBase(s string, now time.Time) (string, error) {
+	switch s {
+	case "utc", "localtime":
+		return s, nil
+	}
+	for _, layout := range []string{"2006-01-02", qemuRTCBaseFormat} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return s, nil
+		}
+	}
+
+	off, err := parseClockOffset(s)
+	if err != nil {
+		return "", fmt.Errorf("%q is neither utc, localtime, a date nor a clock offset", s)
+	}
+	return now.UTC().Add(off).Format(qemuRTCBaseFormat), nil
+}
+
+// rtcBaseValidator validates an `rtc_base`, see qemuRTCBase.
+type rtcBaseValidator struct{}
+
+var _ validator.String = rtcBaseValidator{}
+
+func (v rtcBaseValidator) Description(_ context.Context) string {
+	return "must be \"utc\", \"localtime\", a date like \"2029-01-02\" or \"2029-01-02T03:04:05\", " +
+		"or a clock offset like \"+3y\" or \"-90d\""
+}
+
+func (v rtcBaseValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v rtcBaseValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, err := qemuRTCBase(req.ConfigValue.ValueString(), time.Now()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid RTC Base",
+			fmt.Sprintf("%s; %s.", err, v.Description(ctx)))
+	}
+}
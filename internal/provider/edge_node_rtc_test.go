@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestParseClockOffset(t *testing.T) {
+	is := is.New(t)
+
+	for s, want := range map[string]time.Duration{
+		"0s":      0,
+		"+3y":     3 * 365 * 24 * time.Hour,
+		"-90d":    -90 * 24 * time.Hour,
+		"1d12h":   36 * time.Hour,
+		"1y2d3h":  (365+2)*24*time.Hour + 3*time.Hour,
+		"-1h30m":  -90 * time.Minute,
+		" +500ms": 500 * time.Millisecond,
+	} {
+		got, err := parseClockOffset(s)
+		is.NoErr(err)
+		is.Equal(got, want) // offset of s
+	}
+
+	for _, s := range []string{"", "+", "3", "3w", "2h1d", "1.5y", "101y", "--1h", "-+1h"} {
+		_, err := parseClockOffset(s)
+		is.True(err != nil) // invalid offset
+	}
+}
+
+func TestQEMURTCBase(t *testing.T) {
+	is := is.New(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for s, want := range map[string]string{
+		"utc":                 "utc",
+		"localtime":           "localtime",
+		"2029-01-02":          "2029-01-02",
+		"2029-01-02T03:04:05": "2029-01-02T03:04:05",
+		"+3y":                 "2029-01-01T03:04:05", // 2028 is a leap year
+		"-1d1h":               "2026-01-01T02:04:05",
+	} {
+		got, err := qemuRTCBase(s, now)
+		is.NoErr(err)
+		is.Equal(got, want) // rtc base of s
+	}
+
+	_, err := qemuRTCBase("tomorrow", now)
+	is.True(err != nil)
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"path/filepath"
 
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/cmd/result"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -213,87 +215,17 @@ func (r *EveInstaller) Create(ctx context.Context, req resource.CreateRequest, r
 			fmt.Sprintf("Unable to create resource specific file: %s", err))
 		return
 	}
-	if err := r.providerConf.Exec.MkdirAll(ctx, filepath.Join(d, "config"), 0o700); err != nil {
+	if err := writeEveConfig(ctx, r.providerConf.Exec, filepath.Join(d, "config"), eveConfigOf(&data)); err != nil {
 		resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+			fmt.Sprintf("Unable to write the installer config: %s", err))
 		return
 	}
-	if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "server"), []byte(data.Cluster.ValueString()), 0o600); err != nil {
-		resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-			fmt.Sprintf("Can't write /config/server file: %s", err))
-		return
-	}
-	tlsCA := data.TLSCA.ValueString()
-	if len(tlsCA) > 0 {
-		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "v2tlsbaseroot-certificates.pem"), []byte(tlsCA), 0o600); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Can't write /config/v2tlsbaseroot-certificates.pem file: %s", err))
-			return
-		}
-	}
-	objCA := data.ObjCA.ValueString()
-	if len(objCA) > 0 {
-		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "root-certificate.pem"), []byte(objCA), 0o600); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Can't write /config/root-certificate.pem file: %s", err))
-			return
-		}
-	}
-	hosts := data.Hosts.ValueString()
-	if len(hosts) > 0 {
-		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "hosts"), []byte(hosts), 0o600); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Can't write /config/hosts file: %s", err))
-			return
-		}
-	}
-	sshKey := data.SSHKey.ValueString()
-	if len(sshKey) > 0 {
-		// Ensure that the result file has at least one newline, otherwise
-		// it is not processed correctly.
-		b := []byte(sshKey + "\n")
-		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "authorized_keys"), b, 0o600); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Can't write /config/authorized_keys file: %s", err))
-			return
-		}
-	}
-	grubCfg := data.GrubCfg.ValueString()
-	if len(grubCfg) > 0 {
-		// Ensure that the result file has at least one newline.
-		b := []byte(grubCfg + "\n")
-		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "grub.cfg"), b, 0o600); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Can't write /config/grub.cfg file: %s", err))
-			return
-		}
-	}
-	dpcOver := data.DPCOver.ValueString()
-	if len(dpcOver) > 0 {
-		if err := r.providerConf.Exec.MkdirAll(ctx, filepath.Join(d, "config", "DevicePortConfig"), 0o700); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Unable to create resource specific directory: %s", err))
-			return
-		}
-		// Ensure that the result file has at least one newline.
-		b := []byte(dpcOver + "\n")
-		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "config", "DevicePortConfig", "override.json"), b, 0o600); err != nil {
-			resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
-				fmt.Sprintf("Can't write /config/DevicePortConfig/override.json file: %s", err))
-			return
-		}
-	}
 	if err := r.providerConf.Exec.MkdirAll(ctx, filepath.Join(d, "out"), 0o700); err != nil {
 		resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
 			fmt.Sprintf("Unable to create resource specific directory: %s", err))
 		return
 	}
-	res, err := r.providerConf.Exec.Run(ctx, d, r.providerConf.Docker, "run",
-		"--network", "none", "--rm",
-		"-v", fmt.Sprintf("%s:/in", filepath.Join(d, "config")),
-		"-v", fmt.Sprintf("%s:/out", filepath.Join(d, "out")),
-		fmt.Sprintf("docker.io/lfedge/eve:%s", data.Tag.ValueString()),
-		"-f", "raw", fmt.Sprintf("installer_%s", format))
+	res, err := runEveImage(ctx, r.providerConf, d, data.Tag.ValueString(), fmt.Sprintf("installer_%s", format))
 	if err != nil {
 		resp.Diagnostics.AddError("EVE-OS Installer Resource Error",
 			fmt.Sprintf("Unable to create a new installer %s", format))
@@ -322,6 +254,76 @@ func (r *EveInstaller) Create(ctx context.Context, req resource.CreateRequest, r
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
+// eveConfig is the content of the config partition of an EVE-OS installer,
+// see https://github.com/lf-edge/eve/blob/master/docs/CONFIG.md .
+type eveConfig struct {
+	Cluster string
+	TLSCA   string
+	ObjCA   string
+	Hosts   string
+	SSHKey  string
+	GrubCfg string
+	DPCOver string
+}
+
+func eveConfigOf(data *EveInstallerModel) eveConfig {
+	return eveConfig{
+		Cluster: data.Cluster.ValueString(),
+		TLSCA:   data.TLSCA.ValueString(),
+		ObjCA:   data.ObjCA.ValueString(),
+		Hosts:   data.Hosts.ValueString(),
+		SSHKey:  data.SSHKey.ValueString(),
+		GrubCfg: data.GrubCfg.ValueString(),
+		DPCOver: data.DPCOver.ValueString(),
+	}
+}
+
+// files returns the config files of c by their path relative to the config
+// directory, the empty ones are left out.
+func (c eveConfig) files() map[string][]byte {
+	files := map[string][]byte{"server": []byte(c.Cluster)}
+	add := func(name, content, suffix string) {
+		if len(content) > 0 {
+			files[name] = []byte(content + suffix)
+		}
+	}
+	add("v2tlsbaseroot-certificates.pem", c.TLSCA, "")
+	add("root-certificate.pem", c.ObjCA, "")
+	add("hosts", c.Hosts, "")
+	// Ensure that these files have at least one newline, otherwise they are
+	// not processed correctly.
+	add("authorized_keys", c.SSHKey, "\n")
+	add("grub.cfg", c.GrubCfg, "\n")
+	add(filepath.Join("DevicePortConfig", "override.json"), c.DPCOver, "\n")
+	return files
+}
+
+// writeEveConfig writes the config files of c to the directory dir, which is
+// created if needed.
+func writeEveConfig(ctx context.Context, ex exec.Executor, dir string, c eveConfig) error {
+	for name, content := range c.files() {
+		if err := ex.MkdirAll(ctx, filepath.Dir(filepath.Join(dir, name)), 0o700); err != nil {
+			return fmt.Errorf("can't create config directory: %w", err)
+		}
+		if err := ex.WriteFile(ctx, filepath.Join(dir, name), content, 0o600); err != nil {
+			return fmt.Errorf("can't write /config/%s file: %w", filepath.ToSlash(name), err)
+		}
+	}
+	return nil
+}
+
+// runEveImage runs the lfedge/eve container image with the given tag and
+// command, with the `config` directory of d as its input and the `out`
+// directory of d as its output.
+func runEveImage(ctx context.Context, conf *ZedAmigoProviderConfig, d, tag, command string) (result.Result, error) {
+	return conf.Exec.Run(ctx, d, conf.Docker, "run",
+		"--network", "none", "--rm",
+		"-v", fmt.Sprintf("%s:/in", filepath.Join(d, "config")),
+		"-v", fmt.Sprintf("%s:/out", filepath.Join(d, "out")),
+		fmt.Sprintf("docker.io/lfedge/eve:%s", tag),
+		"-f", "raw", command)
+}
+
 func readEveInstaller(_ *ZedAmigoProviderConfig, path, name, format string) (string, error) {
 	i := fmt.Sprintf("%s.custom_installer.%s", filepath.Join(path, name), format)
 
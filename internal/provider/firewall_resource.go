@@ -0,0 +1,502 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	firewallsDir = "firewalls"
+
+	// firewallTablePrefix prefixes the name of the nftables table of a
+	// firewall resource.
+	firewallTablePrefix = "zedamigo_fw_"
+)
+
+// firewallActions are the actions of a firewall rule, in nftables terms.
+var firewallActions = []string{"accept", "drop", "reject"}
+
+// firewallProtocols maps the protocol of a firewall rule to its nftables
+// name.
+var firewallProtocols = map[string]string{
+	"tcp":    "tcp",
+	"udp":    "udp",
+	"icmp":   "icmp",
+	"icmpv6": "ipv6-icmp",
+}
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &Firewall{}
+	_ resource.ResourceWithImportState    = &Firewall{}
+	_ resource.ResourceWithValidateConfig = &Firewall{}
+)
+
+func NewFirewall() resource.Resource {
+	return &Firewall{}
+}
+
+// Firewall defines the resource implementation.
+type Firewall struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// FirewallModel describes the resource data model.
+type FirewallModel struct {
+	ID               types.String        `tfsdk:"id"`
+	Name             types.String        `tfsdk:"name"`
+	NetNS            types.String        `tfsdk:"netns"`
+	Table            types.String        `tfsdk:"table"`
+	Interface        types.String        `tfsdk:"interface"`
+	FilterInput      types.Bool          `tfsdk:"filter_input"`
+	AllowEstablished types.Bool          `tfsdk:"allow_established"`
+	DefaultAction    types.String        `tfsdk:"default_action"`
+	Rules            []FirewallRuleModel `tfsdk:"rule"`
+}
+
+// FirewallRuleModel describes a `rule` block.
+type FirewallRuleModel struct {
+	Action      types.String `tfsdk:"action"`
+	Protocol    types.String `tfsdk:"protocol"`
+	Source      types.String `tfsdk:"source"`
+	Destination types.String `tfsdk:"destination"`
+	Port        types.String `tfsdk:"port"`
+	Comment     types.String `tfsdk:"comment"`
+}
+
+func (r *Firewall) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, firewallsDir, id)
+}
+
+func (r *Firewall) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_firewall"
+}
+
+func (r *Firewall) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Firewall (ordered allow/deny rules) for an interface, with nftables",
+		MarkdownDescription: undent.Md(`
+		Filter the traffic arriving on |interface| with an ordered list of |rule| blocks: the first
+		rule that matches a packet decides, the packets no rule matches get the |default_action|.
+		E.g. to simulate a customer site that only allows HTTPS to the controller, put the edge
+		nodes on a bridge and allow TCP port 443 from it, with |default_action = "drop"|:
+
+		    rule {
+		      action   = "accept"
+		      protocol = "tcp"
+		      port     = "443"
+		    }
+
+		By default only the forwarded traffic is filtered (e.g. from a bridge towards the uplink),
+		so that the DHCP and DNS servers of the host on the interface keep working; set
+		|filter_input| to also filter the traffic to the host itself.
+
+		The rules live in an nftables table owned by the resource (|table|, of the |inet| family),
+		in the default network namespace or in |netns|. The table is replaced atomically on every
+		change and deleted with the resource; a table deleted outside of Terraform is created
+		again on the next apply. Requires the |nft| command on the target. Other tables (e.g. of
+		another firewall) may still drop a packet accepted by this one.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Firewall resource identifier",
+				MarkdownDescription: "Firewall resource identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Description: "Name of the firewall, used to name its nftables `table`",
+				Required:    true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(nftNameRegex, "must start with a letter and contain only letters, digits, `_` and `-`"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace of the interface, the default one if not specified",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"table": schema.StringAttribute{
+				Computed:    true,
+				Description: "Name of the nftables table of the firewall, of the `inet` family",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Interface whose incoming traffic is filtered, e.g. a bridge",
+				Required:    true,
+			},
+			"filter_input": schema.BoolAttribute{
+				Description: "Also filter the traffic to the host itself, not only the forwarded one. Default: `false`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+			},
+			"allow_established": schema.BoolAttribute{
+				Description: "Accept the packets of the connections already accepted (and the related ones, e.g. " +
+					"ICMP errors) before the rules. Default: `true`.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(true),
+			},
+			"default_action": schema.StringAttribute{
+				Description: "Action for the packets no rule matches: `accept`, `drop` or `reject`. Default: `accept`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("accept"),
+				Validators: []validator.String{
+					stringvalidator.OneOf(firewallActions...),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"rule": schema.ListNestedBlock{
+				Description: "Rule of the firewall, in order. All the set matches must match.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"action": schema.StringAttribute{
+							Description: "Action for the matching packets: `accept`, `drop` or `reject` (drop and " +
+								"answer with an error).",
+							Required: true,
+							Validators: []validator.String{
+								stringvalidator.OneOf(firewallActions...),
+							},
+						},
+						"protocol": schema.StringAttribute{
+							Description: "Protocol to match: `tcp`, `udp`, `icmp` or `icmpv6`. Default: any.",
+							Optional:    true,
+							Validators: []validator.String{
+								stringvalidator.OneOf("tcp", "udp", "icmp", "icmpv6"),
+							},
+						},
+						"source": schema.StringAttribute{
+							Description: "Source address or prefix (CIDR) to match. Default: any.",
+							Optional:    true,
+						},
+						"destination": schema.StringAttribute{
+							Description: "Destination address or prefix (CIDR) to match, e.g. the controller. Default: any.",
+							Optional:    true,
+						},
+						"port": schema.StringAttribute{
+							Description: "Destination port (e.g. `443`) or port range (e.g. `8000-8100`) to match, " +
+								"with protocol `tcp` or `udp`. Default: any.",
+							Optional: true,
+							Validators: []validator.String{
+								stringvalidator.RegexMatches(nftPortRegex, "must be a port or a port range, e.g. 443 or 8000-8100"),
+							},
+						},
+						"comment": schema.StringAttribute{
+							Description: "Comment of the rule, shown by `nft list table`",
+							Optional:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks the matches of the rules, so that a typo doesn't
+// surface as an `nft` syntax error.
+func (r *Firewall) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data FirewallModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	for i, rule := range data.Rules {
+		rulePath := path.Root("rule").AtListIndex(i)
+		for name, v := range map[string]types.String{"source": rule.Source, "destination": rule.Destination} {
+			if v.IsNull() || v.IsUnknown() {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(v.ValueString()); err != nil && net.ParseIP(v.ValueString()) == nil {
+				resp.Diagnostics.AddAttributeError(rulePath.AtName(name), "Invalid firewall rule",
+					fmt.Sprintf("'%s' is neither an IP address nor a prefix (CIDR).", v.ValueString()))
+			}
+		}
+		if !firewallRuleFamilyOK(rule) {
+			resp.Diagnostics.AddAttributeError(rulePath, "Invalid firewall rule",
+				"The source and the destination must both be IPv4 or both be IPv6, and match the ICMP version.")
+		}
+		if !rule.Port.IsNull() && !rule.Protocol.IsUnknown() {
+			if p := rule.Protocol.ValueString(); p != "tcp" && p != "udp" {
+				resp.Diagnostics.AddAttributeError(rulePath.AtName("port"), "Invalid firewall rule",
+					"A port can only be matched with protocol `tcp` or `udp`.")
+			}
+		}
+	}
+}
+
+func (r *Firewall) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_firewall", &resp.Diagnostics)
+	requireNft(conf, "zedamigo_firewall", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Firewall resource configure debugging", traceData)
+}
+
+func (r *Firewall) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data FirewallModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Firewall Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+	data.Table = types.StringValue(firewallTablePrefix + data.Name.ValueString())
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Firewall Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Firewall Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	ruleset := nftRuleset(data.Table.ValueString(), firewallChains(&data))
+	if diags, err := nftLoad(ctx, r.providerConf, d, data.NetNS.ValueString(), data.Table.ValueString(), ruleset); err != nil {
+		resp.Diagnostics.AddError("Firewall Resource Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "Firewall Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Firewall) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data FirewallModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	exists, drifted, diags, err := nftTableState(ctx, r.providerConf, d, data.NetNS.ValueString(), data.Table.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read firewall state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	if !exists {
+		// The table (or its namespace) was deleted outside Terraform:
+		// remove from state.
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	// Self-heal drift: rules changed behind our back (e.g. with `nft` by
+	// hand) are put back by reloading the whole table.
+	if drifted {
+		tflog.Info(ctx, "Firewall rules drifted, restoring them", map[string]any{"table": data.Table.ValueString()})
+		ruleset := nftRuleset(data.Table.ValueString(), firewallChains(&data))
+		if diags, err := nftLoad(ctx, r.providerConf, d, data.NetNS.ValueString(), data.Table.ValueString(), ruleset); err != nil {
+			resp.Diagnostics.AddWarning("Firewall Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted rules of nftables table '%s': %v", data.Table.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Firewall) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan FirewallModel
+	var state FirewallModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// name and netns are RequiresReplace, so the table stays the same.
+	d := r.getResourceDir(state.ID.ValueString())
+	plan.Table = state.Table
+
+	ruleset := nftRuleset(plan.Table.ValueString(), firewallChains(&plan))
+	if diags, err := nftLoad(ctx, r.providerConf, d, plan.NetNS.ValueString(), plan.Table.ValueString(), ruleset); err != nil {
+		resp.Diagnostics.AddError("Firewall Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Firewall) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data FirewallModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if diags, err := nftDeleteTable(ctx, r.providerConf, d, data.NetNS.ValueString(), data.Table.ValueString()); err != nil {
+		resp.Diagnostics.AddError("Failed to delete firewall", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Firewall Resource Delete Error",
+			fmt.Sprintf("Can't delete firewall resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Firewall) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// firewallChains returns the chains of the nftables table of model: the
+// rules in a regular chain, jumped to from the forward (and input) hook for
+// the traffic arriving on the interface.
+func firewallChains(model *FirewallModel) string {
+	var b strings.Builder
+
+	b.WriteString("\tchain rules {\n")
+	if model.AllowEstablished.ValueBool() {
+		b.WriteString("\t\tct state established,related accept\n")
+	}
+	for _, rule := range model.Rules {
+		fmt.Fprintf(&b, "\t\t%s\n", firewallRule(rule))
+	}
+	if a := model.DefaultAction.ValueString(); a != "" && a != "accept" {
+		fmt.Fprintf(&b, "\t\t%s\n", a)
+	}
+	b.WriteString("\t}\n")
+
+	hooks := []string{"forward"}
+	if model.FilterInput.ValueBool() {
+		hooks = append(hooks, "input")
+	}
+	for _, hook := range hooks {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %s priority filter; policy accept;\n", hook, hook)
+		fmt.Fprintf(&b, "\t\tiifname %s jump rules\n\t}\n", nftString(model.Interface.ValueString()))
+	}
+	return b.String()
+}
+
+// firewallRule returns the nftables rule of rule.
+func firewallRule(rule FirewallRuleModel) string {
+	var m []string
+	family := firewallRuleFamily(rule)
+	for _, a := range []struct {
+		dir string
+		v   types.String
+	}{{"saddr", rule.Source}, {"daddr", rule.Destination}} {
+		if !a.v.IsNull() && a.v.ValueString() != "" {
+			m = append(m, fmt.Sprintf("%s %s %s", family, a.dir, a.v.ValueString()))
+		}
+	}
+	proto := firewallProtocols[rule.Protocol.ValueString()]
+	if !rule.Port.IsNull() && rule.Port.ValueString() != "" {
+		m = append(m, fmt.Sprintf("%s dport %s", proto, rule.Port.ValueString()))
+	} else if proto != "" {
+		m = append(m, "meta l4proto "+proto)
+	}
+	m = append(m, rule.Action.ValueString())
+	if !rule.Comment.IsNull() && rule.Comment.ValueString() != "" {
+		m = append(m, "comment "+nftString(rule.Comment.ValueString()))
+	}
+	return strings.Join(m, " ")
+}
+
+// firewallRuleFamily returns the nftables family ("ip" or "ip6") of the
+// addresses of rule, "ip" when it has none.
+func firewallRuleFamily(rule FirewallRuleModel) string {
+	for _, v := range []types.String{rule.Source, rule.Destination} {
+		if v.IsNull() || v.IsUnknown() {
+			continue
+		}
+		if strings.Contains(v.ValueString(), ":") {
+			return "ip6"
+		}
+		return "ip"
+	}
+	return "ip"
+}
+
+// firewallRuleFamilyOK reports whether the addresses of rule, and the ICMP
+// version it matches, are of the same family.
+func firewallRuleFamilyOK(rule FirewallRuleModel) bool {
+	families := map[bool]bool{}
+	for _, v := range []types.String{rule.Source, rule.Destination} {
+		if !v.IsNull() && !v.IsUnknown() {
+			families[strings.Contains(v.ValueString(), ":")] = true
+		}
+	}
+	switch rule.Protocol.ValueString() {
+	case "icmp":
+		families[false] = true
+	case "icmpv6":
+		families[true] = true
+	}
+	return len(families) <= 1
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+func testFirewallRule(action, proto, src, dst, port string) FirewallRuleModel {
+	str := func(s string) types.String {
+		if s == "" {
+			return types.StringNull()
+		}
+		return types.StringValue(s)
+	}
+	return FirewallRuleModel{
+		Action: str(action), Protocol: str(proto), Source: str(src), Destination: str(dst), Port: str(port),
+		Comment: types.StringNull(),
+	}
+}
+
+func TestFirewallChains(t *testing.T) {
+	is := is.New(t)
+
+	// A site that only allows HTTPS to the controller.
+	rule := testFirewallRule("accept", "tcp", "", "203.0.113.10", "443")
+	rule.Comment = types.StringValue("controller")
+	m := &FirewallModel{
+		Interface:        types.StringValue("br-site"),
+		FilterInput:      types.BoolValue(false),
+		AllowEstablished: types.BoolValue(true),
+		DefaultAction:    types.StringValue("drop"),
+		Rules:            []FirewallRuleModel{rule},
+	}
+	is.Equal(firewallChains(m), "\tchain rules {\n"+
+		"\t\tct state established,related accept\n"+
+		"\t\tip daddr 203.0.113.10 tcp dport 443 accept comment \"controller\"\n"+
+		"\t\tdrop\n"+
+		"\t}\n"+
+		"\tchain forward {\n"+
+		"\t\ttype filter hook forward priority filter; policy accept;\n"+
+		"\t\tiifname \"br-site\" jump rules\n"+
+		"\t}\n")
+
+	m.FilterInput = types.BoolValue(true)
+	m.AllowEstablished = types.BoolValue(false)
+	m.DefaultAction = types.StringValue("accept")
+	m.Rules = []FirewallRuleModel{testFirewallRule("reject", "icmpv6", "fd00::/64", "", "")}
+	is.Equal(firewallChains(m), "\tchain rules {\n"+
+		"\t\tip6 saddr fd00::/64 meta l4proto ipv6-icmp reject\n"+
+		"\t}\n"+
+		"\tchain forward {\n"+
+		"\t\ttype filter hook forward priority filter; policy accept;\n"+
+		"\t\tiifname \"br-site\" jump rules\n"+
+		"\t}\n"+
+		"\tchain input {\n"+
+		"\t\ttype filter hook input priority filter; policy accept;\n"+
+		"\t\tiifname \"br-site\" jump rules\n"+
+		"\t}\n")
+}
+
+func TestFirewallRuleFamilyOK(t *testing.T) {
+	is := is.New(t)
+
+	is.True(firewallRuleFamilyOK(testFirewallRule("drop", "", "10.0.0.0/8", "192.0.2.1", "")))
+	is.True(firewallRuleFamilyOK(testFirewallRule("drop", "icmpv6", "", "fd00::1", "")))
+	is.True(!firewallRuleFamilyOK(testFirewallRule("drop", "", "10.0.0.0/8", "fd00::1", "")))
+	is.True(!firewallRuleFamilyOK(testFirewallRule("drop", "icmp", "fd00::/64", "", "")))
+}
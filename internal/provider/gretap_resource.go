@@ -0,0 +1,426 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	gretapsDir = "gretaps"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &Gretap{}
+	_ resource.ResourceWithImportState    = &Gretap{}
+	_ resource.ResourceWithValidateConfig = &Gretap{}
+)
+
+func NewGretap() resource.Resource {
+	return &Gretap{}
+}
+
+// Gretap defines the resource implementation.
+type Gretap struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// GretapModel describes the resource data model.
+type GretapModel struct {
+	ID          types.String `tfsdk:"id"`
+	Name        types.String `tfsdk:"name"`
+	Remote      types.String `tfsdk:"remote"`
+	Local       types.String `tfsdk:"local"`
+	Key         types.Int64  `tfsdk:"key"`
+	Parent      types.String `tfsdk:"parent"`
+	TTL         types.Int64  `tfsdk:"ttl"`
+	NetNS       types.String `tfsdk:"netns"`
+	Master      types.String `tfsdk:"master"`
+	MTU         types.Int64  `tfsdk:"mtu"`
+	State       types.String `tfsdk:"state"`
+	MACAddress  types.String `tfsdk:"mac_address"`
+	IPv4Address types.String `tfsdk:"ipv4_address"`
+	IPv6Address types.String `tfsdk:"ipv6_address"`
+}
+
+// end returns the in-place settings of the interface, which are handled like
+// the ones of a veth end.
+func (m *GretapModel) end() vethEnd {
+	return vethEnd{m.Name, m.NetNS, m.Master, m.MTU, m.State, m.MACAddress, m.IPv4Address, m.IPv6Address}
+}
+
+func (m *GretapModel) setEnd(e vethEnd) {
+	m.Master, m.MTU, m.State, m.MACAddress, m.IPv4Address, m.IPv6Address =
+		e.Master, e.MTU, e.State, e.MACAddress, e.IPv4Address, e.IPv6Address
+}
+
+// tunnel returns the GRE options of the link.
+func (m *GretapModel) tunnel() *nlops.Tunnel {
+	return &nlops.Tunnel{
+		ID:     int(m.Key.ValueInt64()),
+		Remote: m.Remote.ValueString(),
+		Local:  m.Local.ValueString(),
+		TTL:    int(m.TTL.ValueInt64()),
+	}
+}
+
+func (r *Gretap) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, gretapsDir, id)
+}
+
+func (r *Gretap) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_gretap"
+}
+
+func (r *Gretap) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	attrs := tunnelIntfAttributes("the GRETAP interface", true)
+	attrs["id"] = schema.StringAttribute{
+		Computed:            true,
+		Description:         "GRETAP resource identifier",
+		MarkdownDescription: "GRETAP resource identifier",
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+		},
+	}
+	attrs["name"] = schema.StringAttribute{
+		Description: "Name of the GRETAP interface",
+		Required:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["remote"] = schema.StringAttribute{
+		Description: "IP address of the remote end of the tunnel. An IPv6 one creates an ip6gretap interface.",
+		Required:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["local"] = schema.StringAttribute{
+		Description: "Source IP address of the encapsulated packets",
+		Optional:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["key"] = schema.Int64Attribute{
+		Description: "GRE key, to run several tunnels between the same addresses. Both ends must use the same one.",
+		Optional:    true,
+		Validators: []validator.Int64{
+			int64validator.Between(1, 1<<32-1),
+		},
+		PlanModifiers: []planmodifier.Int64{
+			int64planmodifier.RequiresReplace(),
+		},
+	}
+	attrs["parent"] = schema.StringAttribute{
+		Description: "Underlay interface, in the same network namespace, to send the encapsulated packets through",
+		Optional:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["ttl"] = schema.Int64Attribute{
+		Description: "TTL of the encapsulated packets, inherited from the inner packet if not specified",
+		Optional:    true,
+		Validators: []validator.Int64{
+			int64validator.Between(1, 255),
+		},
+		PlanModifiers: []planmodifier.Int64{
+			int64planmodifier.RequiresReplace(),
+		},
+	}
+
+	resp.Schema = schema.Schema{
+		Description: "GRETAP interface",
+		MarkdownDescription: undent.Md(`
+		Create and manage a Linux GRETAP (Ethernet over GRE) interface through netlink or iproute2
+		commands (see the provider |network_backend|). It carries Ethernet frames to the |remote|
+		end of a point-to-point tunnel, and can be enslaved to a |zedamigo_bridge| with |master| to
+		stretch the bridge over an IP network. Unlike VXLAN, GRE has no port numbers, so it doesn't
+		cross NATs.
+
+		The tunnel settings require replacing the interface, while |master|, |mtu|, |state|,
+		|mac_address| and the addresses are changed in place, and settings changed outside of
+		Terraform are restored on refresh. Note that the encapsulation takes 38 bytes with a |key|
+		(58 over IPv6), leave room for it in the MTU of the underlay or lower the |mtu| of the bridge.`),
+		Attributes: attrs,
+	}
+}
+
+// ValidateConfig checks the tunnel addresses, so that a typo doesn't surface
+// as an EINVAL from the kernel.
+func (r *Gretap) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data GretapModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ipAttrErrors(&resp.Diagnostics, path.Empty(), map[string]types.String{
+		"remote": data.Remote, "local": data.Local,
+	})
+}
+
+func (r *Gretap) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_gretap", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "GRETAP resource configure debugging", traceData)
+}
+
+func (r *Gretap) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data GretapModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("GRETAP Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("GRETAP Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("GRETAP Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Create and configure the interface in one batch, e.g. the equivalent
+	// of `ip link add gt0 type gretap remote 192.0.2.2 key 42`.
+	ops := []nlops.Op{{
+		Kind:   nlops.OpLinkAdd,
+		Name:   data.Name.ValueString(),
+		Type:   nlops.TypeGretap,
+		Parent: data.Parent.ValueString(),
+		Tunnel: data.tunnel(),
+	}}
+	ops = append(ops, vethEndCreateOps(data.end())...)
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("GRETAP Resource Error",
+			fmt.Sprintf("Unable to create a new GRETAP interface: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readGretap(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read GRETAP state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// With an IPv6 address the interface also gets the link-local address
+	// derived from its MAC right away, see the bridge Create.
+	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
+		llOps, err := linkLocalOps(data.Name.ValueString(), "", data.MACAddress.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("GRETAP Resource Error",
+				fmt.Sprintf("Can't configure link-local address on GRETAP interface: %v", err))
+			return
+		}
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
+			resp.Diagnostics.AddError("GRETAP Resource Error",
+				fmt.Sprintf("Unable to configure GRETAP link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	}
+
+	tflog.Trace(ctx, "GRETAP Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Gretap) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data GretapModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	prior := data
+	if diags, err := r.readGretap(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// The interface (or its namespace) was deleted outside
+			// Terraform: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read GRETAP state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if e, drift := vethEndHealTarget(prior.end(), data.end()); drift {
+		tflog.Info(ctx, "GRETAP settings drifted, restoring them", map[string]any{"gretap": data.Name.ValueString()})
+		want := data
+		want.setEnd(e)
+		if diags, err := r.applyGretap(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("GRETAP Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of GRETAP '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readGretap(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read GRETAP state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Gretap) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan GretapModel
+	var state GretapModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The name, the namespace and the tunnel settings are RequiresReplace,
+	// so they cannot reach Update changed.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.NetNS.ValueString())
+
+	if diags, err := r.applyGretap(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("GRETAP Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readGretap(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read GRETAP state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Gretap) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data GretapModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the interface. If it (or its namespace) doesn't exist the delete
+	// is successful (idempotent).
+	op := nlops.Op{Kind: nlops.OpLinkDel, Name: data.Name.ValueString()}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete GRETAP", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("GRETAP Resource Delete Error",
+			fmt.Sprintf("Can't delete GRETAP resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Gretap) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+func (r *Gretap) readGretap(ctx context.Context, resPath string, nl netLinks, model *GretapModel) (diag.Diagnostics, error) {
+	e := model.end()
+	if diags, err := readTunnelEnd(ctx, resPath, nl, &e); err != nil {
+		return diags, err
+	}
+	model.setEnd(e)
+	return nil, nil
+}
+
+// applyGretap reconciles the in-place settings of the interface from old to
+// new, for Update and for the drift self-heal in Read. Unknown values in new
+// are left alone. All changes are applied as one batch.
+func (r *Gretap) applyGretap(ctx context.Context, resPath string, nl netLinks, old, new *GretapModel) (diag.Diagnostics, error) {
+	ops, err := vethEndApplyOps(old.end(), new.end())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply GRETAP '%s' settings: %w", new.Name.ValueString(), err)
+	}
+	return nil, nil
+}
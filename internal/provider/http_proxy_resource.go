@@ -0,0 +1,731 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	httpProxiesDir           = "http_proxies"
+	httpProxyCAValidity      = 10 * 365 * 24 * time.Hour
+	httpProxyStopPoll        = 100 * time.Millisecond
+	httpProxyStopTimeout     = 5 * time.Second
+	httpProxyConfigTemplText = `# HTTP proxy configuration (auto-generated)
+listen: {{ printf "%q" .Listen }}
+interface: {{ printf "%q" .Interface }}
+username: {{ printf "%q" .Username }}
+password: {{ printf "%q" .Password }}
+access_log: {{ printf "%q" .AccessLog }}
+allow:
+{{- range .Allow }}
+  - {{ printf "%q" . }}
+{{- end }}
+deny:
+{{- range .Deny }}
+  - {{ printf "%q" . }}
+{{- end }}
+tls_intercept: {{ .TLSIntercept }}
+tls_intercept_bypass:
+{{- range .TLSInterceptBypass }}
+  - {{ printf "%q" . }}
+{{- end }}
+tls_intercept_skip_verify: {{ .TLSInterceptSkipVerify }}
+ca_cert: {{ printf "%q" .CACert }}
+ca_key: {{ printf "%q" .CAKey }}
+`
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &HTTPProxy{}
+	_ resource.ResourceWithImportState    = &HTTPProxy{}
+	_ resource.ResourceWithValidateConfig = &HTTPProxy{}
+)
+
+func NewHTTPProxy() resource.Resource {
+	return &HTTPProxy{}
+}
+
+// HTTPProxy defines the resource implementation.
+type HTTPProxy struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// HTTPProxyModel describes the resource data model.
+type HTTPProxyModel struct {
+	ID                     types.String `tfsdk:"id"`
+	Interface              types.String `tfsdk:"interface"`
+	NetNS                  types.String `tfsdk:"netns"`
+	ListenAddress          types.String `tfsdk:"listen_address"`
+	Port                   types.Int64  `tfsdk:"port"`
+	Username               types.String `tfsdk:"username"`
+	Password               types.String `tfsdk:"password"`
+	Allow                  types.List   `tfsdk:"allow"`
+	Deny                   types.List   `tfsdk:"deny"`
+	TLSIntercept           types.Bool   `tfsdk:"tls_intercept"`
+	TLSInterceptBypass     types.List   `tfsdk:"tls_intercept_bypass"`
+	TLSInterceptSkipVerify types.Bool   `tfsdk:"tls_intercept_skip_verify"`
+	CACertificate          types.String `tfsdk:"ca_certificate"`
+	AccessLog              types.String `tfsdk:"access_log"`
+	ConfigFile             types.String `tfsdk:"config_file"`
+	PIDFile                types.String `tfsdk:"pid_file"`
+	State                  types.String `tfsdk:"state"`
+	Restarts               types.Int64  `tfsdk:"restarts"`
+	LastExit               types.String `tfsdk:"last_exit"`
+}
+
+func (r *HTTPProxy) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, httpProxiesDir, id)
+}
+
+func (r *HTTPProxy) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_http_proxy"
+}
+
+func (r *HTTPProxy) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Forward HTTP(S) proxy with basic auth, host filtering and optional TLS interception",
+		MarkdownDescription: undent.Md(`
+		Run a forward HTTP(S) proxy, the provider binary in |-http-proxy| mode, optionally bound to an
+		|interface| and/or inside a |netns|. It proxies plain HTTP requests and tunnels HTTPS (and
+		anything else) with CONNECT, e.g. to reproduce the customer sites that force EVE-OS edge nodes
+		through a proxy.
+
+		  * |username| and |password| require proxy basic auth (|Proxy-Authorization|).
+		  * |deny| and then |allow| filter the target hosts, a leading |*.| matches any name below it.
+		  * Every request is written to the |access_log| file.
+		  * With |tls_intercept| the CONNECTs are terminated with certificates signed by a CA
+		    generated for this resource and exported in |ca_certificate| (a "MITM" proxy), except
+		    for the hosts in |tls_intercept_bypass|. The edge nodes must trust that CA, e.g. with the
+		    |tls_ca| of |zedamigo_eve_installer| or the proxy certificates of a DevicePortConfig.
+
+		Changing the auth or the host lists restarts the daemon in place.
+		NOTE: This resource DOES NOT manage the host firewall configuration.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "HTTP proxy resource identifier",
+				MarkdownDescription: "HTTP proxy resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Only accept connections received on this interface (SO_BINDTODEVICE). Default: all interfaces.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace in which to run the HTTP proxy",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"listen_address": schema.StringAttribute{
+				Description: "IP address to listen on. Default: all addresses (IPv4 and IPv6).",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"port": schema.Int64Attribute{
+				Description: "TCP port to listen on. Default: 3128.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(3128),
+				Validators: []validator.Int64{
+					int64validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"username": schema.StringAttribute{
+				Description: "Username for the proxy basic authentication (empty disables auth)",
+				MarkdownDescription: undent.Md(`Username for the proxy basic authentication. If empty (default),
+				authentication is disabled. If specified, password must also be provided.`),
+				Optional:  true,
+				Sensitive: true,
+				Validators: []validator.String{
+					stringvalidator.AlsoRequires(path.MatchRoot("password")),
+				},
+			},
+			"password": schema.StringAttribute{
+				Description: "Password for the proxy basic authentication",
+				MarkdownDescription: undent.Md(`Password for the proxy basic authentication. Only used when
+				username is also specified.`),
+				Optional:  true,
+				Sensitive: true,
+			},
+			"allow": schema.ListAttribute{
+				Description: "Target hosts allowed through the proxy, e.g. `zedcloud.lab.local` or `*.lab.local`. " +
+					"Default: all hosts.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"deny": schema.ListAttribute{
+				Description: "Target hosts denied (`403 Forbidden`), taking precedence over `allow`.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"tls_intercept": schema.BoolAttribute{
+				Description: "Intercept the TLS connections tunnelled with CONNECT, with certificates signed by the " +
+					"CA in `ca_certificate`. Default: false.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(false),
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"tls_intercept_bypass": schema.ListAttribute{
+				Description: "Target hosts tunnelled as they are with `tls_intercept`, e.g. the ones that pin their certificate.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"tls_intercept_skip_verify": schema.BoolAttribute{
+				Description: "Don't verify the certificates of the intercepted servers, e.g. of a lab controller " +
+					"with a private CA. Default: false.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(false),
+			},
+			"ca_certificate": schema.StringAttribute{
+				Computed:    true,
+				Description: "The generated TLS interception CA (PEM), only with `tls_intercept`",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"access_log": schema.StringAttribute{
+				Computed:    true,
+				Description: "The access log file: time, client, user, method, target, status, bytes, duration and a note",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated HTTP proxy configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the HTTP proxy daemon",
+				MarkdownDescription: undent.Md(`Desired state of the HTTP proxy daemon. Can be "running" or "stopped".
+				Defaults to "running". The provider will automatically start or stop the daemon to match this state.
+				Stopping it is an easy way of simulating a proxy outage.`),
+				Validators: []validator.String{
+					stringvalidator.OneOf("running", "stopped"),
+				},
+			},
+		},
+	}
+}
+
+func (r *HTTPProxy) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data HTTPProxyModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.ListenAddress.IsNull() && !data.ListenAddress.IsUnknown() &&
+		net.ParseIP(data.ListenAddress.ValueString()) == nil {
+		resp.Diagnostics.AddAttributeError(path.Root("listen_address"), "Invalid listen address",
+			fmt.Sprintf("%q is not an IP address.", data.ListenAddress.ValueString()))
+	}
+}
+
+func (r *HTTPProxy) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_http_proxy", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "HTTP proxy resource configure debugging", traceData)
+}
+
+func (r *HTTPProxy) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data HTTPProxyModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("HTTPProxy Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("HTTPProxy Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("HTTPProxy Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+	data.AccessLog = types.StringValue(filepath.Join(d, "access.log"))
+	data.CACertificate = types.StringNull()
+	if data.TLSIntercept.ValueBool() {
+		certPEM, keyPEM, err := newHTTPProxyCA(data.ID.ValueString(), time.Now())
+		if err != nil {
+			resp.Diagnostics.AddError("HTTPProxy Resource Error",
+				fmt.Sprintf("Unable to generate the TLS interception CA: %s", err))
+			return
+		}
+		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "ca.pem"), certPEM, 0o644); err != nil {
+			resp.Diagnostics.AddError("HTTPProxy Resource Error",
+				fmt.Sprintf("Unable to write the TLS interception CA: %s", err))
+			return
+		}
+		if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, "ca-key.pem"), keyPEM, 0o600); err != nil {
+			resp.Diagnostics.AddError("HTTPProxy Resource Error",
+				fmt.Sprintf("Unable to write the TLS interception CA key: %s", err))
+			return
+		}
+		data.CACertificate = types.StringValue(string(certPEM))
+	}
+	if diags := writeHTTPProxyConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if data.State.IsNull() || data.State.IsUnknown() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startHTTPProxy(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("HTTPProxy Resource Error",
+				fmt.Sprintf("Failed to start HTTP proxy: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readHTTPProxy(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read HTTPProxy state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "HTTPProxy Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *HTTPProxy) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data HTTPProxyModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readHTTPProxy(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read HTTPProxy state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *HTTPProxy) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan HTTPProxyModel
+	var state HTTPProxyModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+	plan.AccessLog = state.AccessLog
+	plan.CACertificate = state.CACertificate
+
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file, the
+	// daemon reads it only on start.
+	configChanged := !plan.Username.Equal(state.Username) ||
+		!plan.Password.Equal(state.Password) ||
+		!plan.Allow.Equal(state.Allow) ||
+		!plan.Deny.Equal(state.Deny) ||
+		!plan.TLSInterceptBypass.Equal(state.TLSInterceptBypass) ||
+		!plan.TLSInterceptSkipVerify.Equal(state.TLSInterceptSkipVerify)
+	if configChanged {
+		if diags := writeHTTPProxyConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopHTTPProxy(ctx, d); err != nil {
+			resp.Diagnostics.AddError("HTTPProxy Resource Update Error",
+				fmt.Sprintf("Failed to stop HTTP proxy: %v", err))
+			return
+		}
+		tflog.Info(ctx, "HTTP proxy configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
+
+	if configChanged || !plan.State.Equal(state.State) {
+		tflog.Info(ctx, "HTTP proxy state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startHTTPProxy(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("HTTPProxy Resource Update Error",
+					fmt.Sprintf("Failed to start HTTP proxy: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopHTTPProxy(ctx, d); err != nil {
+				resp.Diagnostics.AddError("HTTPProxy Resource Update Error",
+					fmt.Sprintf("Failed to stop HTTP proxy: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readHTTPProxy(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read HTTPProxy state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *HTTPProxy) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data HTTPProxyModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopHTTPProxy(ctx, d); err != nil {
+		tflog.Warn(ctx, "Failed to stop HTTP proxy during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("HTTPProxy Resource Delete Error",
+			fmt.Sprintf("Can't delete HTTPProxy resource directory: %v", err))
+		return
+	}
+}
+
+func (r *HTTPProxy) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// startHTTPProxy starts the HTTP proxy daemon for the given resource, inside
+// its network namespace if any.
+func (r *HTTPProxy) startHTTPProxy(ctx context.Context, d string, data *HTTPProxyModel) error {
+	netns := ""
+	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
+		netns = data.NetNS.ValueString()
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-http-proxy", "-hp.config", data.ConfigFile.ValueString())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
+		return fmt.Errorf("failed to start HTTP proxy: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+	return nil
+}
+
+// stopHTTPProxy stops the HTTP proxy daemon for the given resource and waits
+// for it to exit, so that a new one can bind the same port right away.
+func (r *HTTPProxy) stopHTTPProxy(ctx context.Context, d string) error {
+	running, pid, err := readHTTPProxyPID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find HTTP proxy process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill HTTP proxy process: %w", err)
+	}
+	for deadline := time.Now().Add(httpProxyStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(httpProxyStopPoll)
+	}
+	return fmt.Errorf("HTTP proxy process %d did not exit within %s", pid, httpProxyStopTimeout)
+}
+
+func (r *HTTPProxy) readHTTPProxy(ctx context.Context, resPath string, model *HTTPProxyModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	running, _, _ := readHTTPProxyPID(ctx, r.providerConf.Exec, resPath)
+	actualState := "stopped"
+	if running {
+		actualState = "running"
+	}
+
+	// Self-healing: reconcile actual state with desired state.
+	if desiredState == "running" && actualState == "stopped" {
+		tflog.Info(ctx, "HTTP proxy daemon is stopped but should be running, restarting...")
+		if err := r.startHTTPProxy(ctx, resPath, model); err != nil {
+			return nil, fmt.Errorf("failed to restart HTTP proxy: %w", err)
+		}
+		actualState = "running"
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "HTTP proxy daemon is running but should be stopped, stopping...")
+		if err := r.stopHTTPProxy(ctx, resPath); err != nil {
+			return nil, fmt.Errorf("failed to stop HTTP proxy: %w", err)
+		}
+		actualState = "stopped"
+	}
+
+	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+
+	return nil, nil
+}
+
+func readHTTPProxyPID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
+
+// httpProxyConfig is the data of the HTTP proxy config file template.
+type httpProxyConfig struct {
+	Listen                 string
+	Interface              string
+	Username               string
+	Password               string
+	AccessLog              string
+	Allow                  []string
+	Deny                   []string
+	TLSIntercept           bool
+	TLSInterceptBypass     []string
+	TLSInterceptSkipVerify bool
+	CACert                 string
+	CAKey                  string
+}
+
+// newHTTPProxyConfig returns the config file data of a resource model.
+func newHTTPProxyConfig(ctx context.Context, data *HTTPProxyModel) (httpProxyConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	port := data.Port.ValueInt64()
+	if port == 0 {
+		port = 3128
+	}
+	d := filepath.Dir(data.ConfigFile.ValueString())
+	cfg := httpProxyConfig{
+		Listen:                 net.JoinHostPort(data.ListenAddress.ValueString(), strconv.FormatInt(port, 10)),
+		Interface:              data.Interface.ValueString(),
+		Username:               data.Username.ValueString(),
+		Password:               data.Password.ValueString(),
+		AccessLog:              data.AccessLog.ValueString(),
+		TLSIntercept:           data.TLSIntercept.ValueBool(),
+		TLSInterceptSkipVerify: data.TLSInterceptSkipVerify.ValueBool(),
+	}
+	if cfg.TLSIntercept {
+		cfg.CACert = filepath.Join(d, "ca.pem")
+		cfg.CAKey = filepath.Join(d, "ca-key.pem")
+	}
+	for _, l := range []struct {
+		list types.List
+		out  *[]string
+	}{
+		{data.Allow, &cfg.Allow},
+		{data.Deny, &cfg.Deny},
+		{data.TLSInterceptBypass, &cfg.TLSInterceptBypass},
+	} {
+		if !l.list.IsNull() && !l.list.IsUnknown() {
+			diags.Append(l.list.ElementsAs(ctx, l.out, false)...)
+		}
+	}
+	return cfg, diags
+}
+
+// renderHTTPProxyConfig writes the HTTP proxy config file of cfg to w.
+func renderHTTPProxyConfig(w io.Writer, cfg httpProxyConfig) error {
+	tmpl, err := template.New("http-proxy-config").Parse(httpProxyConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// writeHTTPProxyConfig writes the `config_file` of data, only readable by the
+// owner as it holds the proxy password.
+func writeHTTPProxyConfig(ctx context.Context, ex exec.Executor, data *HTTPProxyModel) diag.Diagnostics {
+	cfg, diags := newHTTPProxyConfig(ctx, data)
+	if diags.HasError() {
+		return diags
+	}
+
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o600)
+	if err != nil {
+		diags.AddError("HTTPProxy Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderHTTPProxyConfig(confFile, cfg); err != nil {
+		diags.AddError("HTTPProxy Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
+
+// newHTTPProxyCA returns a new TLS interception CA certificate and its
+// private key, both PEM encoded.
+func newHTTPProxyCA(id string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "zedamigo HTTP proxy CA " + id, Organization: []string{"zedamigo"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(httpProxyCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
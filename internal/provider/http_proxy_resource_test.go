@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewHTTPProxyCA(t *testing.T) {
+	is := is.New(t)
+	now := time.Now()
+
+	certPEM, keyPEM, err := newHTTPProxyCA("abc", now)
+	is.NoErr(err)
+	_, err = tls.X509KeyPair(certPEM, keyPEM) // the daemon loads them as a pair
+	is.NoErr(err)
+
+	b, _ := pem.Decode(certPEM)
+	is.True(b != nil)
+	ca, err := x509.ParseCertificate(b.Bytes)
+	is.NoErr(err)
+	is.True(ca.IsCA)
+	is.True(ca.KeyUsage&x509.KeyUsageCertSign != 0)
+	is.Equal(ca.Subject.CommonName, "zedamigo HTTP proxy CA abc")
+	is.True(ca.NotAfter.After(now.Add(9 * 365 * 24 * time.Hour)))
+}
+
+func TestRenderHTTPProxyConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := HTTPProxyModel{
+		ListenAddress:          types.StringValue("10.1.0.1"),
+		Port:                   types.Int64Value(3128),
+		Username:               types.StringValue("eve"),
+		Password:               types.StringValue(`p"ss`),
+		Allow:                  types.ListValueMust(types.StringType, []attr.Value{types.StringValue("*.lab.local")}),
+		Deny:                   types.ListNull(types.StringType),
+		TLSIntercept:           types.BoolValue(true),
+		TLSInterceptBypass:     types.ListNull(types.StringType),
+		TLSInterceptSkipVerify: types.BoolValue(false),
+		AccessLog:              types.StringValue("/lib/http_proxies/x/access.log"),
+		ConfigFile:             types.StringValue("/lib/http_proxies/x/config.yaml"),
+	}
+	cfg, diags := newHTTPProxyConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+
+	var buf bytes.Buffer
+	is.NoErr(renderHTTPProxyConfig(&buf, cfg))
+
+	var got struct {
+		Listen       string   `yaml:"listen"`
+		Username     string   `yaml:"username"`
+		Password     string   `yaml:"password"`
+		Allow        []string `yaml:"allow"`
+		Deny         []string `yaml:"deny"`
+		AccessLog    string   `yaml:"access_log"`
+		TLSIntercept bool     `yaml:"tls_intercept"`
+		CACert       string   `yaml:"ca_cert"`
+		CAKey        string   `yaml:"ca_key"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Listen, "10.1.0.1:3128")
+	is.Equal(got.Username, "eve")
+	is.Equal(got.Password, `p"ss`) // quotes survive the YAML round trip
+	is.Equal(got.Allow, []string{"*.lab.local"})
+	is.Equal(len(got.Deny), 0)
+	is.Equal(got.AccessLog, "/lib/http_proxies/x/access.log")
+	is.True(got.TLSIntercept)
+	is.Equal(got.CACert, "/lib/http_proxies/x/ca.pem")
+	is.Equal(got.CAKey, "/lib/http_proxies/x/ca-key.pem")
+}
@@ -80,6 +80,8 @@ type InternetMonitorModel struct {
 	ConfigFile     types.String `tfsdk:"config_file"`
 	PIDFile        types.String `tfsdk:"pid_file"`
 	State          types.String `tfsdk:"state"`
+	Restarts       types.Int64  `tfsdk:"restarts"`
+	LastExit       types.String `tfsdk:"last_exit"`
 	NetNS          types.String `tfsdk:"netns"`
 }
 
@@ -193,6 +195,8 @@ func (r *InternetMonitor) Schema(ctx context.Context, req resource.SchemaRequest
 				Computed:    true,
 				Description: "Process ID file",
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 			"state": schema.StringAttribute{
 				Optional:    true,
 				Computed:    true,
@@ -433,21 +437,9 @@ func (r *InternetMonitor) startInternetMonitor(ctx context.Context, d string, da
 	}
 
 	self := r.providerConf.Exec.SelfPath()
-	srvCmd := self
-	srvArgs := []string{}
-	if netns != "" {
-		if r.providerConf.UseSudo {
-			srvCmd = r.providerConf.Sudo
-			srvArgs = []string{"-n", r.providerConf.IP, "netns", "exec", netns, self}
-		} else {
-			srvCmd = r.providerConf.IP
-			srvArgs = []string{"netns", "exec", netns, self}
-		}
-	} else if r.providerConf.UseSudo {
-		srvCmd = r.providerConf.Sudo
-		srvArgs = []string{"-n", self}
-	}
-	moreArgs := []string{"-pid-file", data.PIDFile.ValueString(), "-internet-monitor", "-im.config", data.ConfigFile.ValueString()}
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-internet-monitor", "-im.config", data.ConfigFile.ValueString())
 	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
 		return fmt.Errorf("failed to start internet-monitor daemon: %w, diagnostics: %v", err, res.Diagnostics())
 	}
@@ -501,6 +493,7 @@ func (r *InternetMonitor) readInternetMonitor(ctx context.Context, resPath strin
 	}
 
 	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
 
 	return nil, nil
 }
@@ -0,0 +1,439 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	ipvlansDir = "ipvlans"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                = &IPVlan{}
+	_ resource.ResourceWithImportState = &IPVlan{}
+)
+
+func NewIPVlan() resource.Resource {
+	return &IPVlan{}
+}
+
+// IPVlan defines the resource implementation.
+type IPVlan struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// IPVlanModel describes the resource data model.
+type IPVlanModel struct {
+	ID          types.String `tfsdk:"id"`
+	Name        types.String `tfsdk:"name"`
+	Parent      types.String `tfsdk:"parent"`
+	Mode        types.String `tfsdk:"mode"`
+	NetNS       types.String `tfsdk:"netns"`
+	MTU         types.Int64  `tfsdk:"mtu"`
+	State       types.String `tfsdk:"state"`
+	MACAddress  types.String `tfsdk:"mac_address"`
+	IPv4Address types.String `tfsdk:"ipv4_address"`
+	IPv6Address types.String `tfsdk:"ipv6_address"`
+}
+
+// end returns the in-place settings of the interface, which are handled like
+// the ones of a veth end. The MAC address is the one of the parent.
+func (m *IPVlanModel) end() vethEnd {
+	return vethEnd{
+		Name: m.Name, NetNS: m.NetNS, Master: types.StringNull(), MTU: m.MTU, State: m.State,
+		MACAddress: types.StringNull(), IPv4Address: m.IPv4Address, IPv6Address: m.IPv6Address,
+	}
+}
+
+func (r *IPVlan) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, ipvlansDir, id)
+}
+
+func (r *IPVlan) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_ipvlan"
+}
+
+func (r *IPVlan) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "IPVlan interface",
+		MarkdownDescription: undent.Md(`
+		Create and manage a Linux ipvlan interface on top of a |parent| interface, through netlink
+		or iproute2 commands (see the provider |network_backend|). Unlike a |zedamigo_macvlan| the
+		interface shares the MAC address of the parent, for networks (e.g. Wi-Fi, or switch ports
+		limited to one MAC address) that don't accept more. It can be placed in a network namespace
+		(e.g. a |zedamigo_netns|), while the parent stays in the default one.
+
+		|mtu|, |state| and the addresses are changed in place, and settings changed outside of
+		Terraform are restored on refresh.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "IPVlan resource identifier",
+				MarkdownDescription: "IPVlan resource identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Description: "Name of the ipvlan interface",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"parent": schema.StringAttribute{
+				Description: "Parent interface on which to create the ipvlan interface, in the default network namespace",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"mode": schema.StringAttribute{
+				Description: "IPVlan mode: `l2`, `l3` or `l3s`. Default: `l2`.",
+				MarkdownDescription: undent.Md(`
+				IPVlan mode, see ip-link(8). Default: |l2|.
+				- |l2|: the interface switches frames on the parent, including broadcasts and ARP.
+				- |l3|: the parent routes the packets of the interface, no broadcasts nor multicast.
+				- |l3s|: like |l3|, with the packets also going through the netfilter hooks (and
+				  conntrack) of the namespace of the parent.`),
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("l2"),
+				Validators: []validator.String{
+					stringvalidator.OneOf(nlops.IPVlanModes...),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace to place the ipvlan interface in, the default one if not specified",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"mtu": schema.Int64Attribute{
+				Description: "MTU size for the ipvlan interface, at most the one of the parent",
+				Optional:    true,
+				Computed:    true,
+			},
+			"state": schema.StringAttribute{
+				Description: "State of the ipvlan interface (up/down)",
+				Optional:    true,
+				Computed:    true,
+			},
+			"mac_address": schema.StringAttribute{
+				Description: "MAC address of the ipvlan interface, the one of the parent",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"ipv4_address": schema.StringAttribute{
+				Description: "IPv4 address to configure on the ipvlan interface",
+				Optional:    true,
+			},
+			"ipv6_address": schema.StringAttribute{
+				Description: "IPv6 address for the ipvlan interface",
+				Optional:    true,
+			},
+		},
+	}
+}
+
+func (r *IPVlan) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_ipvlan", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "IPVlan resource configure debugging", traceData)
+}
+
+func (r *IPVlan) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data IPVlanModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("IPVlan Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("IPVlan Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("IPVlan Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Create and configure the interface in one batch, e.g. the equivalent
+	// of `ip link add link eth0 name ipv0 netns lab type ipvlan mode l2`.
+	ops := []nlops.Op{{
+		Kind:   nlops.OpLinkAdd,
+		Name:   data.Name.ValueString(),
+		NetNS:  data.NetNS.ValueString(),
+		Type:   nlops.TypeIPVlan,
+		Parent: data.Parent.ValueString(),
+		Mode:   data.Mode.ValueString(),
+	}}
+	ops = append(ops, vethEndCreateOps(data.end())...)
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("IPVlan Resource Error",
+			fmt.Sprintf("Unable to create a new ipvlan: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readIPVlan(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read ipvlan state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// With an IPv6 address the interface also gets the link-local address
+	// derived from its MAC right away, see the bridge Create.
+	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
+		llOps, err := linkLocalOps(data.Name.ValueString(), "", data.MACAddress.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("IPVlan Resource Error",
+				fmt.Sprintf("Can't configure link-local address on ipvlan interface: %v", err))
+			return
+		}
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
+			resp.Diagnostics.AddError("IPVlan Resource Error",
+				fmt.Sprintf("Unable to configure ipvlan link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	}
+
+	tflog.Trace(ctx, "IPVlan Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *IPVlan) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data IPVlanModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	prior := data
+	if diags, err := r.readIPVlan(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// The interface (or its parent, or its namespace) was deleted
+			// outside Terraform: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read ipvlan state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if want, drift := ipvlanHealTarget(prior, data); drift {
+		tflog.Info(ctx, "IPVlan settings drifted, restoring them", map[string]any{"ipvlan": data.Name.ValueString()})
+		if diags, err := r.applyIPVlan(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("IPVlan Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of ipvlan '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readIPVlan(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read ipvlan state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *IPVlan) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan IPVlanModel
+	var state IPVlanModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// name, parent, mode and netns are RequiresReplace, so they
+	// cannot reach Update changed.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.NetNS.ValueString())
+
+	if diags, err := r.applyIPVlan(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("IPVlan Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readIPVlan(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read ipvlan state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *IPVlan) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data IPVlanModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the interface. If it (or its namespace) doesn't exist the delete
+	// is successful (idempotent).
+	op := nlops.Op{Kind: nlops.OpLinkDel, Name: data.Name.ValueString()}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete ipvlan", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("IPVlan Resource Delete Error",
+			fmt.Sprintf("Can't delete ipvlan resource directory: %v", err))
+		return
+	}
+}
+
+func (r *IPVlan) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+func (r *IPVlan) readIPVlan(ctx context.Context, resPath string, nl netLinks, model *IPVlanModel) (diag.Diagnostics, error) {
+	name := model.Name.ValueString()
+
+	link, diags, err := nl.show(ctx, resPath, name)
+	if err != nil {
+		return diags, fmt.Errorf("can't retrieve ipvlan '%s' details: %w", name, err)
+	}
+
+	model.MTU = types.Int64Value(int64(link.MTU))
+	model.State = linkState(link)
+	if link.MAC != "" {
+		model.MACAddress = types.StringValue(link.MAC)
+	}
+
+	// Report the configured IPv4/IPv6 address while it is still present,
+	// link-local addresses are not reported.
+	model.IPv4Address = pickIntfAddr(model.IPv4Address, link.Addrs4)
+	model.IPv6Address = pickIntfAddr(model.IPv6Address, link.Addrs6)
+
+	return nil, nil
+}
+
+// applyIPVlan reconciles the in-place settings of the interface from old to
+// new, for Update and for the drift self-heal in Read. Unknown values in new
+// are left alone. All changes are applied as one batch.
+func (r *IPVlan) applyIPVlan(ctx context.Context, resPath string, nl netLinks, old, new *IPVlanModel) (diag.Diagnostics, error) {
+	ops, err := vethEndApplyOps(old.end(), new.end())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply ipvlan '%s' settings: %w", new.Name.ValueString(), err)
+	}
+	return nil, nil
+}
+
+// ipvlanHealTarget returns the settings Read restores when the actual
+// interface drifted from the prior state, and whether it did.
+func ipvlanHealTarget(prior, actual IPVlanModel) (IPVlanModel, bool) {
+	want := prior
+	if want.IPv4Address.IsNull() {
+		want.IPv4Address = actual.IPv4Address
+	}
+	if want.IPv6Address.IsNull() {
+		want.IPv6Address = actual.IPv6Address
+	}
+
+	drift := !want.MTU.Equal(actual.MTU) ||
+		!want.State.Equal(actual.State) ||
+		!want.IPv4Address.Equal(actual.IPv4Address) ||
+		!want.IPv6Address.Equal(actual.IPv6Address)
+	return want, drift
+}
@@ -0,0 +1,474 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	ipxeBootsDir = "ipxe_boots"
+	// ipxeEveScript is the iPXE script of the lfedge/eve net installer, it
+	// loads the artifacts relative to the `url` variable.
+	ipxeEveScript = "ipxe.efi.cfg"
+	// ipxeScript is the iPXE script rewritten to load the artifacts from the
+	// local datastore.
+	ipxeScript = "zedamigo.ipxe"
+)
+
+// ipxeURLRefRegex matches the files loaded relative to the `url` variable of
+// an iPXE script, e.g. `${url}kernel`.
+var ipxeURLRefRegex = regexp.MustCompile(`\$\{url\}([^\s$]+)`)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &IPXEBoot{}
+	_ resource.ResourceWithImportState    = &IPXEBoot{}
+	_ resource.ResourceWithValidateConfig = &IPXEBoot{}
+)
+
+func NewIPXEBoot() resource.Resource {
+	return &IPXEBoot{}
+}
+
+// IPXEBoot defines the resource implementation.
+type IPXEBoot struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// IPXEBootModel describes the resource data model.
+type IPXEBootModel struct {
+	ID           types.String `tfsdk:"id"`
+	Tag          types.String `tfsdk:"tag"`
+	Cluster      types.String `tfsdk:"cluster"`
+	TLSCA        types.String `tfsdk:"tls_ca"`
+	ObjCA        types.String `tfsdk:"object_signing_ca"`
+	Hosts        types.String `tfsdk:"additional_hosts"`
+	SSHKey       types.String `tfsdk:"authorized_keys"`
+	GrubCfg      types.String `tfsdk:"grub_cfg"`
+	DPCOver      types.String `tfsdk:"device_port_config_override"`
+	DatastoreDir types.String `tfsdk:"datastore_dir"`
+	DatastoreURL types.String `tfsdk:"datastore_url"`
+	KernelArgs   types.String `tfsdk:"kernel_args"`
+	TFTPRoot     types.String `tfsdk:"tftp_root"`
+	IPXEEFI      types.String `tfsdk:"ipxe_efi"`
+	ArtifactsDir types.String `tfsdk:"artifacts_dir"`
+	ScriptURL    types.String `tfsdk:"script_url"`
+	BootFile     types.String `tfsdk:"boot_file"`
+}
+
+func (r *IPXEBoot) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, ipxeBootsDir, id)
+}
+
+func (r *IPXEBoot) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_ipxe_boot"
+}
+
+func (r *IPXEBoot) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	replace := []planmodifier.String{stringplanmodifier.RequiresReplace()}
+
+	resp.Schema = schema.Schema{
+		Description: "EVE-OS network (iPXE) installer served from a local datastore",
+		MarkdownDescription: undent.Md(`
+		Creates a custom EVE-OS network installer by running the |installer_net| command of the
+		corresponding lfedge/eve container image, with the same customizations as a |zedamigo_eve_installer|,
+		and extracts its artifacts (kernel, initrd, installer image, ...) to the |ipxe/<id>| sub-directory
+		of |datastore_dir|. The iPXE script of the installer is rewritten to load them from |datastore_url|,
+		the URL under which a |zedamigo_local_datastore| serves |datastore_dir|, and is served as |script_url|.
+
+		Edge nodes boot it with the |netboot| block of a |zedamigo_dhcp_server|: iPXE clients get |script_url|
+		as boot file. The NIC option ROMs of QEMU are iPXE already, plain PXE clients (e.g. the network stack
+		of the UEFI firmware) first need an iPXE binary: set |ipxe_efi| and |tftp_root|, the |root_dir| of a
+		|zedamigo_tftp_server|, and use |boot_file| as the |boot_file| of the |netboot| block. Boot the edge
+		node from the network with its |boot_order| or |boot_once|.
+
+		Changing |datastore_url| or |kernel_args| rewrites the script in place, everything else creates a
+		new installer.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "iPXE boot resource identifier",
+				MarkdownDescription: "iPXE boot resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"tag": schema.StringAttribute{
+				Description:   "lfedge/eve container image tag to use for generating the EVE-OS network installer",
+				Required:      true,
+				PlanModifiers: replace,
+			},
+			"cluster": schema.StringAttribute{
+				Description:   "Zedcloud cluster hostname",
+				Required:      true,
+				PlanModifiers: replace,
+			},
+			"tls_ca": schema.StringAttribute{
+				Description:   "The CA that signed the TLS server certificate (PEM), see `v2tlsbaseroot-certificates.pem` in https://github.com/lf-edge/eve/blob/master/docs/REGISTRATION.md",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"object_signing_ca": schema.StringAttribute{
+				Description:   "The CA that signed the internal controller certificate, see `root-certificate.pem` in https://github.com/lf-edge/eve/blob/master/docs/REGISTRATION.md",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"additional_hosts": schema.StringAttribute{
+				Description:   "Additional entries that will be appended to /etc/hosts of the installed edge-node",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"authorized_keys": schema.StringAttribute{
+				Description:   "SSH public key that is configured on the installed edge-node for SSH prior to onboarding",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"grub_cfg": schema.StringAttribute{
+				Description:   "grub.cfg",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"device_port_config_override": schema.StringAttribute{
+				Description:   "DevicePortConfig/override.json",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"datastore_dir": schema.StringAttribute{
+				Description: "Directory served by the local datastore, e.g. the `static_dir` of a " +
+					"`zedamigo_local_datastore`. The artifacts are extracted to its `ipxe/<id>` sub-directory.",
+				Required:      true,
+				PlanModifiers: replace,
+			},
+			"datastore_url": schema.StringAttribute{
+				Description: "URL under which the edge nodes reach `datastore_dir`, e.g. `http://10.1.0.1:8080`.",
+				Required:    true,
+			},
+			"kernel_args": schema.StringAttribute{
+				Description: "Additional kernel command line arguments of the installer, e.g. " +
+					"`eve_install_disk=vda`.",
+				Optional: true,
+			},
+			"tftp_root": schema.StringAttribute{
+				Description: "TFTP server root directory, e.g. the `root_dir` of a `zedamigo_tftp_server`, to " +
+					"which `ipxe_efi` is copied.",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"ipxe_efi": schema.StringAttribute{
+				Description: "Path of an iPXE EFI binary, e.g. `/usr/lib/ipxe/ipxe.efi`, chainloaded by plain " +
+					"PXE clients. Requires `tftp_root`.",
+				Optional:      true,
+				PlanModifiers: replace,
+			},
+			"artifacts_dir": schema.StringAttribute{
+				Computed:    true,
+				Description: "Directory of the extracted installer artifacts and of the iPXE script",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"script_url": schema.StringAttribute{
+				Computed:    true,
+				Description: "URL of the iPXE script, for the `ipxe_script_url` of a `zedamigo_dhcp_server`",
+			},
+			"boot_file": schema.StringAttribute{
+				Computed: true,
+				Description: "TFTP path of the iPXE binary, for the `boot_file` of a `zedamigo_dhcp_server`. " +
+					"Empty without `ipxe_efi`.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+	}
+}
+
+func (r *IPXEBoot) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data IPXEBootModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.DatastoreURL.IsNull() && !data.DatastoreURL.IsUnknown() {
+		if u, err := url.Parse(data.DatastoreURL.ValueString()); err != nil ||
+			(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			resp.Diagnostics.AddAttributeError(path.Root("datastore_url"), "Invalid datastore URL",
+				fmt.Sprintf("Expected an http:// or https:// URL, got: %s", data.DatastoreURL.ValueString()))
+		}
+	}
+	if !data.IPXEEFI.IsNull() && data.TFTPRoot.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("tftp_root"), "Missing TFTP root",
+			"`ipxe_efi` is served by TFTP, set `tftp_root` too.")
+	}
+}
+
+func (r *IPXEBoot) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+}
+
+func (r *IPXEBoot) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data IPXEBootModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, filepath.Join(d, "out"), 0o700); err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+	cfg := eveConfig{
+		Cluster: data.Cluster.ValueString(),
+		TLSCA:   data.TLSCA.ValueString(),
+		ObjCA:   data.ObjCA.ValueString(),
+		Hosts:   data.Hosts.ValueString(),
+		SSHKey:  data.SSHKey.ValueString(),
+		GrubCfg: data.GrubCfg.ValueString(),
+		DPCOver: data.DPCOver.ValueString(),
+	}
+	if err := writeEveConfig(ctx, r.providerConf.Exec, filepath.Join(d, "config"), cfg); err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Unable to write the installer config: %s", err))
+		return
+	}
+
+	res, err := runEveImage(ctx, r.providerConf, d, data.Tag.ValueString(), "installer_net")
+	if err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error", "Unable to create a new network installer")
+		resp.Diagnostics.Append(res.Diagnostics()...)
+		return
+	}
+
+	// The network installer is a tarball of the artifacts and of the iPXE
+	// script loading them. It is large, only the extracted copy is kept.
+	tarball := filepath.Join(d, "out", "installer.net")
+	a := filepath.Join(data.DatastoreDir.ValueString(), "ipxe", data.ID.ValueString())
+	data.ArtifactsDir = types.StringValue(a)
+	if err := r.providerConf.Exec.MkdirAll(ctx, a, 0o755); err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Unable to create artifacts directory: %s", err))
+		return
+	}
+	if res, err := r.providerConf.Exec.Run(ctx, d, "tar", "-xf", tarball, "-C", a); err != nil {
+		resp.Diagnostics.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Unable to extract the network installer: %s", err))
+		resp.Diagnostics.Append(res.Diagnostics()...)
+		return
+	}
+	if err := r.providerConf.Exec.Remove(ctx, tarball); err != nil {
+		tflog.Warn(ctx, "Failed to remove the network installer tarball", map[string]any{"error": err.Error()})
+	}
+
+	data.BootFile = types.StringValue("")
+	if !data.IPXEEFI.IsNull() && data.IPXEEFI.ValueString() != "" {
+		bootFile := filepath.Join("ipxe", data.ID.ValueString(), "ipxe.efi")
+		dst := filepath.Join(data.TFTPRoot.ValueString(), bootFile)
+		if err := r.providerConf.Exec.MkdirAll(ctx, filepath.Dir(dst), 0o755); err != nil {
+			resp.Diagnostics.AddError("iPXE Boot Resource Error",
+				fmt.Sprintf("Unable to create TFTP directory: %s", err))
+			return
+		}
+		if _, err := r.providerConf.Exec.CopyFile(ctx, data.IPXEEFI.ValueString(), dst); err != nil {
+			resp.Diagnostics.AddError("iPXE Boot Resource Error",
+				fmt.Sprintf("Unable to copy the iPXE binary to the TFTP root: %s", err))
+			return
+		}
+		data.BootFile = types.StringValue(filepath.ToSlash(bootFile))
+	}
+
+	resp.Diagnostics.Append(writeIPXEScript(ctx, r.providerConf.Exec, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tflog.Trace(ctx, "iPXE Boot Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *IPXEBoot) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data IPXEBootModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	script := filepath.Join(data.ArtifactsDir.ValueString(), ipxeScript)
+	if _, err := r.providerConf.Exec.Stat(ctx, script); exec.IsNotExist(err) {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *IPXEBoot) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan IPXEBootModel
+	var state IPXEBootModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Only datastore_url and kernel_args can change, they are only used by
+	// the iPXE script.
+	plan.ArtifactsDir = state.ArtifactsDir
+	plan.BootFile = state.BootFile
+	resp.Diagnostics.Append(writeIPXEScript(ctx, r.providerConf.Exec, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *IPXEBoot) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data IPXEBootModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	dirs := []string{r.getResourceDir(data.ID.ValueString()), data.ArtifactsDir.ValueString()}
+	if data.BootFile.ValueString() != "" {
+		dirs = append(dirs, filepath.Dir(filepath.Join(data.TFTPRoot.ValueString(), data.BootFile.ValueString())))
+	}
+	for _, d := range dirs {
+		if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+			resp.Diagnostics.AddError("iPXE Boot Resource Delete Error",
+				fmt.Sprintf("Can't delete directory '%s': %v", d, err))
+			return
+		}
+	}
+}
+
+func (r *IPXEBoot) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// writeIPXEScript rewrites the iPXE script of the network installer in the
+// `artifacts_dir` of data to load the artifacts from the local datastore and
+// sets the `script_url` of data. It warns about the artifacts that the script
+// loads but that are not in the installer.
+func writeIPXEScript(ctx context.Context, ex exec.Executor, data *IPXEBootModel) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	a := data.ArtifactsDir.ValueString()
+	orig, err := ex.ReadFile(ctx, filepath.Join(a, ipxeEveScript))
+	if err != nil {
+		diags.AddError("iPXE Boot Resource Error",
+			fmt.Sprintf("Can't read the iPXE script '%s' of the network installer: %s", ipxeEveScript, err))
+		return diags
+	}
+
+	base := strings.TrimSuffix(data.DatastoreURL.ValueString(), "/") + "/ipxe/" + data.ID.ValueString() + "/"
+	script, refs := rewriteIPXEScript(orig, base, data.KernelArgs.ValueString())
+	for _, ref := range refs {
+		if _, err := ex.Stat(ctx, filepath.Join(a, filepath.FromSlash(ref))); err != nil {
+			diags.AddWarning("Missing network installer artifact",
+				fmt.Sprintf("The iPXE script loads '%s' which is not in the network installer: %s", ref, err))
+		}
+	}
+
+	if err := ex.WriteFile(ctx, filepath.Join(a, ipxeScript), script, 0o644); err != nil {
+		diags.AddError("iPXE Boot Resource Error", fmt.Sprintf("Can't write the iPXE script: %s", err))
+		return diags
+	}
+	data.ScriptURL = types.StringValue(base + ipxeScript)
+	return diags
+}
+
+// rewriteIPXEScript returns script with the `url` variable set to base, from
+// which it loads its files, and with kernelArgs appended to the kernel
+// command line. The other unconditional `set url` commands are commented out.
+// It also returns the names of the files loaded relative to `url`.
+func rewriteIPXEScript(script []byte, base, kernelArgs string) ([]byte, []string) {
+	var out bytes.Buffer
+	var refs []string
+	seen := map[string]bool{}
+
+	out.WriteString("#!ipxe\n")
+	out.WriteString("# Rewritten by terraform-provider-zedamigo to load the artifacts from the local datastore.\n")
+	fmt.Fprintf(&out, "set url %s\n", base)
+
+	sc := bufio.NewScanner(bytes.NewReader(script))
+	for first := true; sc.Scan(); first = false {
+		line := sc.Text()
+		if first && strings.HasPrefix(line, "#!") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "set" && fields[1] == "url":
+			line = "# " + line
+		case len(fields) >= 1 && fields[0] == "kernel" && kernelArgs != "":
+			line = line + " " + kernelArgs
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			for _, m := range ipxeURLRefRegex.FindAllStringSubmatch(line, -1) {
+				if !seen[m[1]] {
+					seen[m[1]] = true
+					refs = append(refs, m[1])
+				}
+			}
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), refs
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestRewriteIPXEScript(t *testing.T) {
+	is := is.New(t)
+
+	script := []byte(`#!ipxe
+# set url https://github.com/lf-edge/eve/releases/download/snapshot/amd64.
+set url https://example.com/eve/
+isset ${url} || set url https://example.com/other/
+set console console=ttyS0 console=tty0
+kernel ${url}kernel eve_soft_serial=${ip-hash} ${console} initrd=initrd.img
+initrd ${url}initrd.img
+initrd ${url}installer.img
+# initrd ${url}debug.img
+chain ${url}EFI/BOOT/BOOTX64.EFI || boot
+`)
+	got, refs := rewriteIPXEScript(script, "http://10.1.0.1:8080/ipxe/abc/", "eve_install_disk=vda")
+	is.Equal(string(got), `#!ipxe
+# Rewritten by terraform-provider-zedamigo to load the artifacts from the local datastore.
+set url http://10.1.0.1:8080/ipxe/abc/
+# set url https://github.com/lf-edge/eve/releases/download/snapshot/amd64.
+# set url https://example.com/eve/
+isset ${url} || set url https://example.com/other/
+set console console=ttyS0 console=tty0
+kernel ${url}kernel eve_soft_serial=${ip-hash} ${console} initrd=initrd.img eve_install_disk=vda
+initrd ${url}initrd.img
+initrd ${url}installer.img
+# initrd ${url}debug.img
+chain ${url}EFI/BOOT/BOOTX64.EFI || boot
+`)
+	is.Equal(refs, []string{"kernel", "initrd.img", "installer.img", "EFI/BOOT/BOOTX64.EFI"})
+
+	// A script without the shebang gets one, the kernel line is kept as is
+	// without extra arguments.
+	got, refs = rewriteIPXEScript([]byte("kernel ${url}kernel\n"), "http://h/", "")
+	is.Equal(string(got), "#!ipxe\n"+
+		"# Rewritten by terraform-provider-zedamigo to load the artifacts from the local datastore.\n"+
+		"set url http://h/\nkernel ${url}kernel\n")
+	is.Equal(refs, []string{"kernel"})
+}
+
+func TestEveConfigFiles(t *testing.T) {
+	is := is.New(t)
+
+	files := eveConfig{Cluster: "zedcloud.example.com", SSHKey: "ssh-ed25519 AAAA", DPCOver: "{}"}.files()
+	is.Equal(len(files), 3)
+	is.Equal(string(files["server"]), "zedcloud.example.com")
+	is.Equal(string(files["authorized_keys"]), "ssh-ed25519 AAAA\n")
+	is.Equal(string(files[filepath.Join("DevicePortConfig", "override.json")]), "{}\n")
+}
@@ -4,18 +4,13 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
 
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/errchecker"
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/lladdr"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
-	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -89,7 +84,7 @@ func (r *LAG) Schema(ctx context.Context, req resource.SchemaRequest, resp *reso
 	resp.Schema = schema.Schema{
 		Description: "LAG (Linux bond)",
 		// This description is used by the documentation generator and the language server.
-		MarkdownDescription: "Create and manage a Linux bonding (link-aggregation / LAG) interface using iproute2 commands.",
+		MarkdownDescription: "Create and manage a Linux bonding (link-aggregation / LAG) interface through netlink or iproute2 commands (see the provider `network_backend`).",
 
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
@@ -200,7 +195,7 @@ func (r *LAG) Schema(ctx context.Context, req resource.SchemaRequest, resp *reso
 }
 
 // ValidateConfig rejects combinations the bonding driver would refuse, with a
-// clearer message than the raw iproute2 error.
+// clearer message than the raw kernel error.
 func (r *LAG) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
 	var data LAGModel
 
@@ -295,56 +290,41 @@ func (r *LAG) Create(ctx context.Context, req resource.CreateRequest, resp *reso
 	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
 		netns = data.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
 
-	// Create the bond with its (immutable) bonding options.
-	moreArgs := []string{"link", "add", bond, "type", "bond"}
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Create the bond with its (immutable) bonding options, and configure it
+	// in the same batch.
+	opts := &nlops.Bond{}
 	if !data.Mode.IsNull() && !data.Mode.IsUnknown() {
-		moreArgs = append(moreArgs, "mode", data.Mode.ValueString())
+		opts.Mode = data.Mode.ValueString()
 	}
 	if !data.MIIMon.IsNull() && !data.MIIMon.IsUnknown() {
-		moreArgs = append(moreArgs, "miimon", fmt.Sprintf("%d", data.MIIMon.ValueInt64()))
+		opts.MIIMon = int(data.MIIMon.ValueInt64())
 	}
 	if !data.LACPRate.IsNull() && !data.LACPRate.IsUnknown() {
-		moreArgs = append(moreArgs, "lacp_rate", data.LACPRate.ValueString())
+		opts.LACPRate = data.LACPRate.ValueString()
 	}
 	if !data.XmitHashPolicy.IsNull() && !data.XmitHashPolicy.IsUnknown() {
-		moreArgs = append(moreArgs, "xmit_hash_policy", data.XmitHashPolicy.ValueString())
-	}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		resp.Diagnostics.AddError("LAG Resource Error",
-			"Unable to create a new bond.")
-		resp.Diagnostics.Append(res.Diagnostics()...)
-		return
+		opts.XmitHashPolicy = data.XmitHashPolicy.ValueString()
 	}
+	ops := []nlops.Op{{Kind: nlops.OpLinkAdd, Name: bond, Type: nlops.TypeBond, Bond: opts}}
 
-	// Set the MTU if specified (propagates to members as they are enslaved).
+	// Set the MTU (propagates to members as they are enslaved) and the MAC
+	// address if specified. Doing this before enslaving members means the
+	// explicit address wins over the first member's address.
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: bond}
 	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
-		mtu := fmt.Sprintf("%d", data.MTU.ValueInt64())
-		moreArgs := []string{"link", "set", "dev", bond, "mtu", mtu}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Error",
-				"Unable to set bond MTU.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		set.MTU = int(data.MTU.ValueInt64())
 	}
-
-	// Set the MAC address if specified. Doing this before enslaving members
-	// means the explicit address wins over the first member's address.
 	if !data.MACAddress.IsNull() && !data.MACAddress.IsUnknown() {
-		macAddr := data.MACAddress.ValueString()
-		moreArgs := []string{"link", "set", "dev", bond, "address", macAddr}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Error",
-				"Unable to set MAC address for bond.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		set.MAC = data.MACAddress.ValueString()
 	}
+	ops = append(ops, set)
 
 	// Enslave any specified members, attaching them to the bond.
 	if !data.EnslavedInterfaces.IsNull() && !data.EnslavedInterfaces.IsUnknown() {
@@ -353,74 +333,32 @@ func (r *LAG) Create(ctx context.Context, req resource.CreateRequest, resp *reso
 		if resp.Diagnostics.HasError() {
 			return
 		}
-
 		for _, intf := range ifaces {
-			if diags, err := r.enslaveMember(ctx, d, ipCmd, ipArgs, bond, intf); err != nil {
-				resp.Diagnostics.AddError("LAG Resource Error", err.Error())
-				resp.Diagnostics.Append(diags...)
-				return
-			}
-		}
-	}
-
-	// Configure an IPv4 address if specified.
-	if !data.IPv4Address.IsNull() && !data.IPv4Address.IsUnknown() {
-		addr := data.IPv4Address.ValueString()
-
-		// Validate the CIDR format
-		if _, _, err := net.ParseCIDR(addr); err != nil {
-			resp.Diagnostics.AddError("Invalid IPv4 address format",
-				fmt.Sprintf("IPv4 address must be in CIDR format (e.g., '192.168.1.1/24'): %s", err.Error()))
-			return
-		}
-
-		moreArgs := []string{"addr", "add", addr, "dev", bond}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Error",
-				"Unable to configure bond IPv4 address.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
+			ops = append(ops, lagMemberOps(bond, intf)...)
 		}
 	}
 
-	// Configure an IPv6 address if specified.
-	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
-		addr := data.IPv6Address.ValueString()
-
-		// Validate the CIDR format
-		if _, _, err := net.ParseCIDR(addr); err != nil {
-			resp.Diagnostics.AddError("Invalid IPv6 address format",
-				fmt.Sprintf("IPv6 address must be in CIDR format (e.g., 'fd00::1/64'): %s", err.Error()))
-			return
-		}
-
-		moreArgs := []string{"addr", "add", addr, "dev", bond}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Error",
-				"Unable to configure bond IPv6 address.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
+	for _, addr := range []types.String{data.IPv4Address, data.IPv6Address} {
+		if !addr.IsNull() && !addr.IsUnknown() {
+			ops = append(ops, nlops.Op{Kind: nlops.OpAddrAdd, Name: bond, Addr: addr.ValueString()})
 		}
 	}
 
 	// Set the state if specified. NOTE: this is done after enslaving members so
 	// that bringing the bond up carries its members.
 	if !data.State.IsNull() && !data.State.IsUnknown() {
-		state := data.State.ValueString()
-		moreArgs := []string{"link", "set", "dev", bond, state}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Error",
-				"Unable to set bond state.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: bond, State: data.State.ValueString()})
+	}
+
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("LAG Resource Error",
+			fmt.Sprintf("Unable to create a new bond: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
 	// Read the bond current state.
-	if diags, err := r.readLAG(ctx, d, ipCmd, ipArgs, &data); err != nil {
+	if diags, err := r.readLAG(ctx, d, nl, &data); err != nil {
 		resp.Diagnostics.AddError("Failed to read bond state", err.Error())
 		resp.Diagnostics.Append(diags...)
 		return
@@ -430,18 +368,16 @@ func (r *LAG) Create(ctx context.Context, req resource.CreateRequest, resp *reso
 	// configured or not. If an IPv6 address is configured, ensure the bond has
 	// a link-local address (see the matching note in bridge_resource.go).
 	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
-		ll, err := lladdr.LinkLocalIPv6FromMACString(data.MACAddress.ValueString())
+		llOps, err := linkLocalOps(bond, "", data.MACAddress.ValueString())
 		if err != nil {
 			resp.Diagnostics.AddError("LAG Resource Error",
-				fmt.Sprintf("Can't configure link-local address '%s' on bond interface: %v", ll.String(), err))
+				fmt.Sprintf("Can't configure link-local address on bond interface: %v", err))
 			return
 		}
-		moreArgs := []string{"addr", "add", fmt.Sprintf("%s/64", ll.String()), "scope", "link", "dev", bond}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
 			resp.Diagnostics.AddError("LAG Resource Error",
-				"Unable to configure bond link-local address.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
+				fmt.Sprintf("Unable to configure bond link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
 			return
 		}
 	}
@@ -467,12 +403,11 @@ func (r *LAG) Read(ctx context.Context, req resource.ReadRequest, resp *resource
 	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
 		netns = data.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
 
 	// Read the bond current state.
-	if diags, err := r.readLAG(ctx, d, ipCmd, ipArgs, &data); err != nil {
-		// Check for various error messages that indicate the device doesn't exist.
-		if errchecker.ContainsAny(err, intfNotFoundStrs) || errchecker.DiagsAny(diags, intfNotFoundStrs) {
+	if diags, err := r.readLAG(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
 			// Resource was deleted outside Terraform: remove from state.
 			resp.State.RemoveResource(ctx)
 			return
@@ -507,45 +442,35 @@ func (r *LAG) Update(ctx context.Context, req resource.UpdateRequest, resp *reso
 	if !plan.NetNS.IsNull() && !plan.NetNS.IsUnknown() {
 		netns = plan.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
+	var ops []nlops.Op
 
-	// MTU.
+	// MTU and MAC address.
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: bond}
 	if !plan.MTU.Equal(state.MTU) && !plan.MTU.IsNull() && !plan.MTU.IsUnknown() {
-		mtu := fmt.Sprintf("%d", plan.MTU.ValueInt64())
-		moreArgs := []string{"link", "set", "dev", bond, "mtu", mtu}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Update Error", "Unable to set bond MTU.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		set.MTU = int(plan.MTU.ValueInt64())
 	}
-
-	// MAC address.
 	if !plan.MACAddress.Equal(state.MACAddress) && !plan.MACAddress.IsNull() && !plan.MACAddress.IsUnknown() {
-		moreArgs := []string{"link", "set", "dev", bond, "address", plan.MACAddress.ValueString()}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Update Error", "Unable to set bond MAC address.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		set.MAC = plan.MACAddress.ValueString()
+	}
+	if set.MTU > 0 || set.MAC != "" {
+		ops = append(ops, set)
 	}
 
 	// IPv4 / IPv6 addresses (del old, add new).
-	if !plan.IPv4Address.Equal(state.IPv4Address) {
-		if diags, err := r.reconcileAddr(ctx, d, ipCmd, ipArgs, bond, state.IPv4Address, plan.IPv4Address); err != nil {
-			resp.Diagnostics.AddError("LAG Resource Update Error", err.Error())
-			resp.Diagnostics.Append(diags...)
-			return
-		}
-	}
-	if !plan.IPv6Address.Equal(state.IPv6Address) {
-		if diags, err := r.reconcileAddr(ctx, d, ipCmd, ipArgs, bond, state.IPv6Address, plan.IPv6Address); err != nil {
+	for _, a := range [][2]types.String{
+		{state.IPv4Address, plan.IPv4Address},
+		{state.IPv6Address, plan.IPv6Address},
+	} {
+		if a[1].Equal(a[0]) {
+			continue
+		}
+		addrOps, err := intfAddrOps(bond, a[0], a[1])
+		if err != nil {
 			resp.Diagnostics.AddError("LAG Resource Update Error", err.Error())
-			resp.Diagnostics.Append(diags...)
 			return
 		}
+		ops = append(ops, addrOps...)
 	}
 
 	// Members: add/remove the delta in place.
@@ -561,35 +486,30 @@ func (r *LAG) Update(ctx context.Context, req resource.UpdateRequest, resp *reso
 		// Release members we no longer manage first, then enslave new ones, to
 		// avoid transient "already has a master" errors when an interface moves.
 		for _, intf := range stringsDifference(stateMembers, planMembers) {
-			if diags, err := r.releaseMember(ctx, d, ipCmd, ipArgs, intf); err != nil {
-				resp.Diagnostics.AddError("LAG Resource Update Error", err.Error())
-				resp.Diagnostics.Append(diags...)
-				return
-			}
+			ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: intf, NoMaster: true})
 		}
 		for _, intf := range stringsDifference(planMembers, stateMembers) {
-			if diags, err := r.enslaveMember(ctx, d, ipCmd, ipArgs, bond, intf); err != nil {
-				resp.Diagnostics.AddError("LAG Resource Update Error", err.Error())
-				resp.Diagnostics.Append(diags...)
-				return
-			}
+			ops = append(ops, lagMemberOps(bond, intf)...)
 		}
 	}
 
 	// State last, after members are attached.
 	if !plan.State.Equal(state.State) && !plan.State.IsNull() && !plan.State.IsUnknown() {
-		moreArgs := []string{"link", "set", "dev", bond, plan.State.ValueString()}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("LAG Resource Update Error", "Unable to set bond state.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: bond, State: plan.State.ValueString()})
+	}
+
+	if len(ops) > 0 {
+		if diags, err := nl.apply(ctx, d, ops...); err != nil {
+			resp.Diagnostics.AddError("LAG Resource Update Error",
+				fmt.Sprintf("Unable to update bond '%s': %v", bond, err))
+			resp.Diagnostics.Append(diags...)
 			return
 		}
 	}
 
 	// Read back the current state so all Computed attributes (and the reconciled
 	// member set) are concrete before we save.
-	if diags, err := r.readLAG(ctx, d, ipCmd, ipArgs, &plan); err != nil {
+	if diags, err := r.readLAG(ctx, d, nl, &plan); err != nil {
 		resp.Diagnostics.AddError("Failed to read bond state after update", err.Error())
 		resp.Diagnostics.Append(diags...)
 		return
@@ -614,20 +534,15 @@ func (r *LAG) Delete(ctx context.Context, req resource.DeleteRequest, resp *reso
 	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
 		netns = data.NetNS.ValueString()
 	}
-	ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
+	nl := newNetLinks(r.providerConf, netns)
 
 	// Delete the bond. Deleting the master automatically releases its members,
-	// so there is no need to `nomaster` them first.
-	moreArgs := []string{"link", "delete", bond, "type", "bond"}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		// If the device doesn't exist, the delete is successful (idempotent).
-		if errchecker.ContainsNone(err, intfNotFoundStrs) &&
-			errchecker.DiagsNone(res.Diagnostics(), intfNotFoundStrs) {
-			resp.Diagnostics.AddError("Failed to delete bond", err.Error())
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	// so there is no need to `nomaster` them first. If the device doesn't
+	// exist, the delete is successful (idempotent).
+	if diags, err := nl.apply(ctx, d, nlops.Op{Kind: nlops.OpLinkDel, Name: bond, Type: nlops.TypeBond}); err != nil {
+		resp.Diagnostics.AddError("Failed to delete bond", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
 	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
@@ -641,206 +556,41 @@ func (r *LAG) ImportState(ctx context.Context, req resource.ImportStateRequest,
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-// enslaveMember attaches intf as a member of bond. Bond slaves must be
+// lagMemberOps attaches intf as a member of bond. Bond slaves must be
 // administratively DOWN at the moment they are enslaved, so we force them down
 // first, then bring them back up.
-func (r *LAG) enslaveMember(ctx context.Context, resPath string, ipCmd string, ipArgs []string, bond, intf string) (diag.Diagnostics, error) {
-	moreArgs := []string{"link", "set", "dev", intf, "down"}
-	if res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...); err != nil {
-		return res.Diagnostics(),
-			fmt.Errorf("can't set member '%s' down before enslaving to bond '%s': %w", intf, bond, err)
-	}
-
-	moreArgs = []string{"link", "set", "dev", intf, "master", bond}
-	if res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...); err != nil {
-		return res.Diagnostics(),
-			fmt.Errorf("can't enslave member '%s' to bond '%s': %w", intf, bond, err)
-	}
-
-	moreArgs = []string{"link", "set", "dev", intf, "up"}
-	if res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...); err != nil {
-		return res.Diagnostics(),
-			fmt.Errorf("can't bring enslaved member '%s' up: %w", intf, err)
-	}
-
-	return nil, nil
-}
-
-// releaseMember detaches intf from its bond. A member that has already been
-// removed (e.g. externally) is treated as success.
-func (r *LAG) releaseMember(ctx context.Context, resPath string, ipCmd string, ipArgs []string, intf string) (diag.Diagnostics, error) {
-	moreArgs := []string{"link", "set", "dev", intf, "nomaster"}
-	res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		if errchecker.ContainsNone(err, intfNotFoundStrs) &&
-			errchecker.DiagsNone(res.Diagnostics(), intfNotFoundStrs) {
-			return res.Diagnostics(),
-				fmt.Errorf("can't release member '%s' from bond: %w", intf, err)
-		}
-	}
-	return nil, nil
-}
-
-// reconcileAddr brings the address configured on bond from old to new. There is
-// no iproute2 "replace" verb, so a changed address is removed and re-added;
-// without the explicit delete both addresses would linger.
-func (r *LAG) reconcileAddr(ctx context.Context, resPath string, ipCmd string, ipArgs []string, bond string, old, new types.String) (diag.Diagnostics, error) {
-	if !old.IsNull() && !old.IsUnknown() {
-		moreArgs := []string{"addr", "del", old.ValueString(), "dev", bond}
-		res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			tolerable := append(append([]string{}, intfNotFoundStrs...), addrNotFoundStrs...)
-			if errchecker.ContainsNone(err, tolerable) &&
-				errchecker.DiagsNone(res.Diagnostics(), tolerable) {
-				return res.Diagnostics(),
-					fmt.Errorf("can't remove old address '%s' from bond '%s': %w", old.ValueString(), bond, err)
-			}
-		}
-	}
-
-	if !new.IsNull() && !new.IsUnknown() {
-		addr := new.ValueString()
-		if _, _, err := net.ParseCIDR(addr); err != nil {
-			dgs := diag.Diagnostics{}
-			dgs.AddError("Invalid address format",
-				fmt.Sprintf("address must be in CIDR format: %s", err.Error()))
-			return dgs, fmt.Errorf("invalid address '%s' for bond '%s': %w", addr, bond, err)
-		}
-		moreArgs := []string{"addr", "add", addr, "dev", bond}
-		res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			return res.Diagnostics(),
-				fmt.Errorf("can't add address '%s' to bond '%s': %w", addr, bond, err)
-		}
+func lagMemberOps(bond, intf string) []nlops.Op {
+	return []nlops.Op{
+		{Kind: nlops.OpLinkSet, Name: intf, State: "down"},
+		{Kind: nlops.OpLinkSet, Name: intf, Master: bond, State: "up"},
 	}
-
-	return nil, nil
 }
 
-func (r *LAG) readLAG(ctx context.Context, resPath string, ipCmd string, ipArgs []string, model *LAGModel) (diag.Diagnostics, error) {
+func (r *LAG) readLAG(ctx context.Context, resPath string, nl netLinks, model *LAGModel) (diag.Diagnostics, error) {
 	bond := model.Name.ValueString()
 
-	// Check if the bond exists and get info.
-	moreArgs := []string{"link", "show", bond}
-	res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
+	link, diags, err := nl.show(ctx, resPath, bond)
 	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve bond '%s' details: %w", bond, err)
-	}
-
-	// Parse output for MTU, state, and MAC address.
-	lines := strings.Split(res.Stdout, "\n")
-	// A real `ip link show` line always contains the flags section "<...>".
-	// If it doesn't, the output is empty or unparseable: fail loudly with the
-	// raw output instead of fabricating a "down" state.
-	if len(lines) == 0 || !strings.Contains(lines[0], "<") {
-		return res.Diagnostics(),
-			fmt.Errorf("can't parse bond '%s' link details, unexpected output: %q", bond, res.Stdout)
-	}
-	// Parse first line: "5: bond0: <BROADCAST,MULTICAST,MASTER,UP,LOWER_UP> mtu 1500 ..."
-	mtuRegex := regexp.MustCompile(`mtu (\d+)`)
-	if matches := mtuRegex.FindStringSubmatch(lines[0]); len(matches) > 1 {
-		x, err := strconv.ParseInt(matches[1], 10, 64)
-		if err != nil {
-			e := fmt.Errorf("invalid bond '%s' MTU value '%s': %w", bond, matches[1], err)
-			d := diag.Diagnostics{}
-			d.AddError("Can't find bond interface MTU value", e.Error())
-			return d, e
-		}
-		model.MTU = types.Int64Value(x)
-	}
-
-	// Determine state from the administrative UP flag inside "<...>".
-	if linkFlagUp(lines[0]) {
-		model.State = types.StringValue("up")
-	} else {
-		model.State = types.StringValue("down")
+		return diags, fmt.Errorf("can't retrieve bond '%s' details: %w", bond, err)
 	}
 
-	// Parse MAC address from second line: "    link/ether 00:11:22:33:44:55 brd ..."
-	if len(lines) > 1 {
-		macRegex := regexp.MustCompile(`link/ether\s+([0-9a-fA-F:]+)`)
-		if matches := macRegex.FindStringSubmatch(lines[1]); len(matches) > 1 {
-			model.MACAddress = types.StringValue(matches[1])
-		}
+	model.MTU = types.Int64Value(int64(link.MTU))
+	model.State = linkState(link)
+	if link.MAC != "" {
+		model.MACAddress = types.StringValue(link.MAC)
 	}
 
-	// Get IP address(es) of the bond.
-	moreArgs = []string{"addr", "show", bond}
-	res, err = r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve bond '%s' addresses: %w", bond, err)
-	}
-	// Look for IPv4 address in CIDR format: inet 192.168.1.1/24 brd ...
-	addrRegex := regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+/\d+)`)
-	if matches := addrRegex.FindStringSubmatch(res.Stdout); len(matches) > 1 {
-		if _, _, err := net.ParseCIDR(matches[1]); err == nil {
-			model.IPv4Address = types.StringValue(matches[1])
-		}
-	}
-	// Look for IPv6 address in CIDR format, skipping link-local (fe80::/10).
-	addr6Regex := regexp.MustCompile(`inet6 ([0-9a-fA-F:]+/\d+)`)
-	for _, match := range addr6Regex.FindAllStringSubmatch(res.Stdout, -1) {
-		if len(match) > 1 {
-			ip, _, err := net.ParseCIDR(match[1])
-			if err != nil {
-				continue
-			}
-			if !ip.IsLinkLocalUnicast() {
-				model.IPv6Address = types.StringValue(match[1])
-				break
-			}
-		}
-	}
+	// Report the configured IPv4/IPv6 address while it is still present,
+	// link-local addresses are not reported.
+	model.IPv4Address = pickIntfAddr(model.IPv4Address, link.Addrs4)
+	model.IPv6Address = pickIntfAddr(model.IPv6Address, link.Addrs6)
 
 	// Reconcile the set of interfaces this resource explicitly enslaved.
-	//
-	// `ip link show master <bond>` lists EVERY member, but other resources may
-	// attach members on their own (e.g. a zedamigo_tap with its own `master`).
-	// Those foreign members must not land in `enslaved_interfaces`. We reconcile
-	// only against the interfaces already recorded in the incoming model (prior
-	// state on Read, the configured/plan set on Create/Update): keep the ones we
-	// manage that are still members (so real drift is detected and self-heals on
-	// the next in-place update), drop everything else.
-	//
-	// Unlike zedamigo_bridge we preserve the null-vs-empty distinction: only a
-	// null/unknown incoming set becomes null. A known (even empty) set yields a
-	// (possibly empty) set so that an explicit `enslaved_interfaces = []`
-	// round-trips without a perpetual diff.
-	if model.EnslavedInterfaces.IsNull() || model.EnslavedInterfaces.IsUnknown() {
-		model.EnslavedInterfaces = types.SetNull(types.StringType)
-	} else {
-		moreArgs = []string{"link", "show", "master", bond}
-		res, err = r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			return res.Diagnostics(), fmt.Errorf("can't retrieve bond '%s' members: %w", bond, err)
-		}
-		// Capture the interface name from each index line, stopping at ':'
-		// (plain names) or '@' (e.g. VLAN sub-interfaces like "eth1.10@eth1").
-		memberRegex := regexp.MustCompile(`(?m)^\s*\d+:\s+([^:@\s]+)`)
-		current := make(map[string]bool)
-		for _, m := range memberRegex.FindAllStringSubmatch(res.Stdout, -1) {
-			if len(m) > 1 {
-				current[m[1]] = true
-			}
-		}
-
-		// Keep only managed interfaces that are still members of the bond.
-		kept := make([]attr.Value, 0, len(model.EnslavedInterfaces.Elements()))
-		for _, e := range model.EnslavedInterfaces.Elements() {
-			s, ok := e.(types.String)
-			if !ok || s.IsNull() || s.IsUnknown() {
-				continue
-			}
-			if current[s.ValueString()] {
-				kept = append(kept, s)
-			}
-		}
-		members, diags := types.SetValue(types.StringType, kept)
-		if diags.HasError() {
-			return diags, fmt.Errorf("can't build bond '%s' members set", bond)
-		}
-		model.EnslavedInterfaces = members
+	members, diags := managedMembers(model.EnslavedInterfaces, link)
+	if diags.HasError() {
+		return diags, fmt.Errorf("can't build bond '%s' members set", bond)
 	}
+	model.EnslavedInterfaces = members
 
 	return nil, nil
 }
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/lladdr"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// addrExistsStrs are substrings present in `ip` errors when the address (or
+// link) already exists.
+var addrExistsStrs = []string{
+	"File exists",
+	"file exists",
+}
+
+var (
+	intfAddr4Regex = regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+/\d+)`)
+	intfAddr6Regex = regexp.MustCompile(`inet6 ([0-9a-fA-F:]+/\d+)`)
+)
+
+// parseIntfAddrs returns the IPv4 and the non link-local IPv6 addresses, in
+// CIDR format, found in the output of `ip addr show <intf>`.
+func parseIntfAddrs(out string) ([]string, []string) {
+	var v4, v6 []string
+	for _, m := range intfAddr4Regex.FindAllStringSubmatch(out, -1) {
+		if _, _, err := net.ParseCIDR(m[1]); err == nil {
+			v4 = append(v4, m[1])
+		}
+	}
+	for _, m := range intfAddr6Regex.FindAllStringSubmatch(out, -1) {
+		ip, _, err := net.ParseCIDR(m[1])
+		if err != nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		v6 = append(v6, m[1])
+	}
+	return v4, v6
+}
+
+// pickIntfAddr selects the address reported for a single-address attribute.
+// The current value is kept while it is still configured on the interface, so
+// that additional addresses (e.g. added by a DHCP client) don't show up as
+// drift; otherwise the first address found is reported, or null when the
+// interface has none, so that a removed address is detected.
+func pickIntfAddr(cur types.String, found []string) types.String {
+	if len(found) == 0 {
+		return types.StringNull()
+	}
+	if !cur.IsNull() && !cur.IsUnknown() {
+		for _, a := range found {
+			if a == cur.ValueString() {
+				return cur
+			}
+		}
+	}
+	return types.StringValue(found[0])
+}
+
+// intfAddrOps returns the ops bringing the address configured on intf from
+// old to new. There is no "replace", so a changed address is removed and
+// re-added; without the explicit delete both addresses would linger.
+func intfAddrOps(intf string, old, new types.String) ([]nlops.Op, error) {
+	var ops []nlops.Op
+	if !old.IsNull() && !old.IsUnknown() {
+		ops = append(ops, nlops.Op{Kind: nlops.OpAddrDel, Name: intf, Addr: old.ValueString()})
+	}
+	if !new.IsNull() && !new.IsUnknown() {
+		addr := new.ValueString()
+		if _, _, err := net.ParseCIDR(addr); err != nil {
+			return nil, fmt.Errorf("invalid address '%s' for '%s', must be in CIDR format: %w", addr, intf, err)
+		}
+		ops = append(ops, nlops.Op{Kind: nlops.OpAddrAdd, Name: intf, Addr: addr})
+	}
+	return ops, nil
+}
+
+// linkLocalOps returns the ops moving the EUI-64 link-local address of intf
+// from the one derived from oldMAC to the one derived from newMAC. An empty
+// MAC skips that side. See the bridge Create for why this isn't left to the
+// kernel.
+func linkLocalOps(intf string, oldMAC, newMAC string) ([]nlops.Op, error) {
+	llAddr := func(mac string) (types.String, error) {
+		if mac == "" {
+			return types.StringNull(), nil
+		}
+		ll, err := lladdr.LinkLocalIPv6FromMACString(mac)
+		if err != nil {
+			return types.StringNull(), fmt.Errorf("can't derive link-local address of '%s' from MAC '%s': %w", intf, mac, err)
+		}
+		return types.StringValue(fmt.Sprintf("%s/64", ll.String())), nil
+	}
+
+	old, err := llAddr(oldMAC)
+	if err != nil {
+		return nil, err
+	}
+	new, err := llAddr(newMAC)
+	if err != nil {
+		return nil, err
+	}
+	if old.Equal(new) {
+		old = types.StringNull()
+	}
+
+	return intfAddrOps(intf, old, new)
+}
+
+// cidrAttrErrors adds an error for each of the address attributes that is
+// set and not in CIDR format.
+func cidrAttrErrors(diags *diag.Diagnostics, v4, v6 types.String) {
+	if !v4.IsNull() && !v4.IsUnknown() {
+		if _, _, err := net.ParseCIDR(v4.ValueString()); err != nil {
+			diags.AddError("Invalid IPv4 address format",
+				fmt.Sprintf("IPv4 address must be in CIDR format (e.g., '192.168.1.1/24'): %s", err.Error()))
+		}
+	}
+	if !v6.IsNull() && !v6.IsUnknown() {
+		if _, _, err := net.ParseCIDR(v6.ValueString()); err != nil {
+			diags.AddError("Invalid IPv6 address format",
+				fmt.Sprintf("IPv6 address must be in CIDR format (e.g., 'fd00::1/64'): %s", err.Error()))
+		}
+	}
+}
+
+// ipAttrErrors adds an error for each of the attrs (of parent, path.Empty()
+// for the top level ones) that is set and not an IP address (without prefix
+// length), and when the set ones aren't all of the same family.
+func ipAttrErrors(diags *diag.Diagnostics, parent path.Path, attrs map[string]types.String) {
+	family := ""
+	for name, v := range attrs {
+		if v.IsNull() || v.IsUnknown() {
+			continue
+		}
+		ip := net.ParseIP(v.ValueString())
+		if ip == nil {
+			diags.AddAttributeError(parent.AtName(name), "Invalid IP address",
+				fmt.Sprintf("'%s' is not an IP address (without prefix length).", v.ValueString()))
+			continue
+		}
+		f := "IPv6"
+		if ip.To4() != nil {
+			f = "IPv4"
+		}
+		if family != "" && f != family {
+			diags.AddAttributeError(parent.AtName(name), "Mixed IP address families",
+				"The addresses must all be IPv4 or all be IPv6.")
+		}
+		family = f
+	}
+}
+
+// linkState returns the state attribute value of link.
+func linkState(link nlops.Link) types.String {
+	if link.Up {
+		return types.StringValue("up")
+	}
+	return types.StringValue("down")
+}
+
+// managedMembers reconciles the set of interfaces a bridge or bond resource
+// explicitly enslaved with the actual members of the link. Other resources
+// may attach members on their own (e.g. a zedamigo_tap with its own `master`
+// set), those must not land in the set, otherwise the next Update would
+// release them. So only the interfaces already in cur (prior state on Read,
+// the configured/plan set on Create/Update) that are still members are kept.
+// A null/unknown cur becomes null, so that an explicit empty set round-trips
+// without a perpetual diff.
+func managedMembers(cur types.Set, link nlops.Link) (types.Set, diag.Diagnostics) {
+	if cur.IsNull() || cur.IsUnknown() {
+		return types.SetNull(types.StringType), nil
+	}
+	current := make(map[string]bool, len(link.Members))
+	for _, m := range link.Members {
+		current[m] = true
+	}
+	kept := make([]attr.Value, 0, len(cur.Elements()))
+	for _, e := range cur.Elements() {
+		s, ok := e.(types.String)
+		if !ok || s.IsNull() || s.IsUnknown() {
+			continue
+		}
+		if current[s.ValueString()] {
+			kept = append(kept, s)
+		}
+	}
+	return types.SetValue(types.StringType, kept)
+}
+
+// diagsAsWarnings downgrades diags to warnings, for failures that a Read
+// reports but tolerates (e.g. a failed drift self-heal).
+func diagsAsWarnings(diags diag.Diagnostics) diag.Diagnostics {
+	out := diag.Diagnostics{}
+	for _, d := range diags {
+		out.AddWarning(d.Summary(), d.Detail())
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+const testAddrShow = `7: br0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP group default qlen 1000
+    link/ether 02:00:00:00:00:01 brd ff:ff:ff:ff:ff:ff
+    inet 10.0.0.1/24 brd 10.0.0.255 scope global br0
+       valid_lft forever preferred_lft forever
+    inet 10.0.1.1/24 scope global br0
+       valid_lft forever preferred_lft forever
+    inet6 fd00::1/64 scope global
+       valid_lft forever preferred_lft forever
+    inet6 fe80::ff:fe00:1/64 scope link
+       valid_lft forever preferred_lft forever
+`
+
+func TestParseIntfAddrs(t *testing.T) {
+	is := is.New(t)
+	v4, v6 := parseIntfAddrs(testAddrShow)
+	is.Equal(v4, []string{"10.0.0.1/24", "10.0.1.1/24"})
+	is.Equal(v6, []string{"fd00::1/64"}) // link-local skipped
+
+	v4, v6 = parseIntfAddrs("")
+	is.Equal(len(v4), 0)
+	is.Equal(len(v6), 0)
+}
+
+func TestPickIntfAddr(t *testing.T) {
+	is := is.New(t)
+	found := []string{"10.0.0.1/24", "10.0.1.1/24"}
+
+	// The current address is kept while it is still present.
+	is.Equal(pickIntfAddr(types.StringValue("10.0.1.1/24"), found), types.StringValue("10.0.1.1/24"))
+	// Otherwise the first one is reported.
+	is.Equal(pickIntfAddr(types.StringValue("10.0.2.1/24"), found), types.StringValue("10.0.0.1/24"))
+	is.Equal(pickIntfAddr(types.StringNull(), found), types.StringValue("10.0.0.1/24"))
+	// A removed address becomes null.
+	is.True(pickIntfAddr(types.StringValue("10.0.0.1/24"), nil).IsNull())
+}
+
+func TestBridgeHealTarget(t *testing.T) {
+	is := is.New(t)
+	members := types.SetValueMust(types.StringType, []attr.Value{types.StringValue("eth1")})
+	prior := BridgeModel{
+		MTU:                types.Int64Value(9000),
+		State:              types.StringValue("up"),
+		MACAddress:         types.StringValue("02:00:00:00:00:01"),
+		IPv4Address:        types.StringNull(),
+		IPv6Address:        types.StringValue("fd00::1/64"),
+		EnslavedInterfaces: members,
+	}
+
+	_, drift := bridgeHealTarget(prior, prior)
+	is.True(!drift)
+
+	// An address that was never configured is not a drift.
+	actual := prior
+	actual.IPv4Address = types.StringValue("10.0.0.1/24")
+	want, drift := bridgeHealTarget(prior, actual)
+	is.True(!drift)
+	is.Equal(want.IPv4Address, actual.IPv4Address)
+
+	// MTU, a removed address and a released member are.
+	actual.MTU = types.Int64Value(1500)
+	actual.IPv6Address = types.StringNull()
+	actual.EnslavedInterfaces = types.SetValueMust(types.StringType, []attr.Value{})
+	want, drift = bridgeHealTarget(prior, actual)
+	is.True(drift)
+	is.Equal(want.MTU, prior.MTU)
+	is.Equal(want.IPv6Address, prior.IPv6Address)
+	is.Equal(want.EnslavedInterfaces, members)
+}
+
+func TestTAPHealTarget(t *testing.T) {
+	is := is.New(t)
+	prior := TAPModel{
+		MTU:         types.Int64Value(1500),
+		State:       types.StringValue("up"),
+		Master:      types.StringValue("br0"),
+		IPv4Address: types.StringNull(),
+	}
+
+	// Lost its master, e.g. the bridge was re-created.
+	actual := prior
+	actual.Master = types.StringNull()
+	actual.State = types.StringValue("down")
+	want, drift := tapHealTarget(prior, actual)
+	is.True(drift)
+	is.Equal(want.Master, types.StringValue("br0"))
+	is.Equal(want.State, types.StringValue("up"))
+
+	// A master set by someone else on a TAP without one is left alone.
+	prior.Master = types.StringNull()
+	actual = prior
+	actual.Master = types.StringValue("br1")
+	_, drift = tapHealTarget(prior, actual)
+	is.True(!drift)
+}
@@ -52,6 +52,8 @@ type LocalDatastoreModel struct {
 	Password  types.String `tfsdk:"password"`
 	PIDFile   types.String `tfsdk:"pid_file"`
 	State     types.String `tfsdk:"state"`
+	Restarts  types.Int64  `tfsdk:"restarts"`
+	LastExit  types.String `tfsdk:"last_exit"`
 }
 
 func (r *LocalDatastore) getResourceDir(id string) string {
@@ -114,6 +116,8 @@ func (r *LocalDatastore) Schema(ctx context.Context, req resource.SchemaRequest,
 				Computed:    true,
 				Description: "Process ID file",
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 			"state": schema.StringAttribute{
 				Optional:    true,
 				Computed:    true,
@@ -354,7 +358,7 @@ func (r *LocalDatastore) ImportState(ctx context.Context, req resource.ImportSta
 // startLocalDatastore starts the HTTP server daemon for the given resource
 func (r *LocalDatastore) startLocalDatastore(ctx context.Context, d string, data *LocalDatastoreModel) error {
 	srvCmd := r.providerConf.Exec.SelfPath()
-	args := []string{"-pid-file", data.PIDFile.ValueString(), "-http-server"}
+	args := []string{srvCmd, "-http-server"}
 
 	// Add optional arguments
 	if !data.Listen.IsNull() && data.Listen.ValueString() != "" {
@@ -375,6 +379,7 @@ func (r *LocalDatastore) startLocalDatastore(ctx context.Context, d string, data
 		args = append(args, "-hs.password", data.Password.ValueString())
 	}
 
+	args = supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor, args...)
 	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, args...); err != nil {
 		return fmt.Errorf("failed to start HTTP server: %w, diagnostics: %v", err, res.Diagnostics())
 	}
@@ -391,7 +396,9 @@ func (r *LocalDatastore) stopLocalDatastore(ctx context.Context, d string) error
 		return nil // Already stopped
 	}
 
-	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGKILL); err != nil {
+	// Not SIGKILL: the supervisor must forward the signal, on macOS nothing
+	// stops the HTTP server when its supervisor dies.
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
 		return fmt.Errorf("can't kill HTTP server process: %w", err)
 	}
 	return nil
@@ -435,6 +442,7 @@ func (r *LocalDatastore) readLocalDatastore(ctx context.Context, resPath string,
 
 	// Update state to match actual state
 	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
 
 	return nil, nil
 }
@@ -0,0 +1,496 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	macvlansDir = "macvlans"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &Macvlan{}
+	_ resource.ResourceWithImportState    = &Macvlan{}
+	_ resource.ResourceWithValidateConfig = &Macvlan{}
+)
+
+func NewMacvlan() resource.Resource {
+	return &Macvlan{}
+}
+
+// Macvlan defines the resource implementation.
+type Macvlan struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// MacvlanModel describes the resource data model.
+type MacvlanModel struct {
+	ID          types.String `tfsdk:"id"`
+	Name        types.String `tfsdk:"name"`
+	Parent      types.String `tfsdk:"parent"`
+	Mode        types.String `tfsdk:"mode"`
+	Macvtap     types.Bool   `tfsdk:"macvtap"`
+	NetNS       types.String `tfsdk:"netns"`
+	MTU         types.Int64  `tfsdk:"mtu"`
+	State       types.String `tfsdk:"state"`
+	MACAddress  types.String `tfsdk:"mac_address"`
+	IPv4Address types.String `tfsdk:"ipv4_address"`
+	IPv6Address types.String `tfsdk:"ipv6_address"`
+	TapDevice   types.String `tfsdk:"tap_device"`
+}
+
+// end returns the in-place settings of the interface, which are handled like
+// the ones of a veth end.
+func (m *MacvlanModel) end() vethEnd {
+	return vethEnd{
+		Name: m.Name, NetNS: m.NetNS, Master: types.StringNull(), MTU: m.MTU, State: m.State,
+		MACAddress: m.MACAddress, IPv4Address: m.IPv4Address, IPv6Address: m.IPv6Address,
+	}
+}
+
+func (r *Macvlan) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, macvlansDir, id)
+}
+
+func (r *Macvlan) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_macvlan"
+}
+
+func (r *Macvlan) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Macvlan (or macvtap) interface",
+		MarkdownDescription: undent.Md(`
+		Create and manage a Linux macvlan interface on top of a |parent| interface, through netlink
+		or iproute2 commands (see the provider |network_backend|). The interface has its own MAC
+		address on the network of the parent, without a bridge. It can be placed in a network
+		namespace (e.g. a |zedamigo_netns|), while the parent stays in the default one.
+
+		With |macvtap| a macvtap interface is created instead, whose |tap_device| QEMU can use
+		directly: pass it to the |macvtap_nic| block of a |zedamigo_edge_node| together with the
+		|mac_address| to put the edge node right on the network of the parent. Note that the host
+		can't reach the macvlan/macvtap interfaces of a parent through the parent itself.
+
+		|mtu|, |state|, |mac_address| and the addresses are changed in place, and settings changed
+		outside of Terraform are restored on refresh.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Macvlan resource identifier",
+				MarkdownDescription: "Macvlan resource identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Description: "Name of the macvlan interface",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"parent": schema.StringAttribute{
+				Description: "Parent interface on which to create the macvlan interface, in the default network namespace",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"mode": schema.StringAttribute{
+				Description: "Macvlan mode: `bridge`, `vepa`, `private` or `passthru`. Default: `bridge`.",
+				MarkdownDescription: undent.Md(`
+				Macvlan mode, see ip-link(8). Default: |bridge|.
+				- |bridge|: the macvlan interfaces of the parent can reach each other directly.
+				- |vepa|: all traffic goes out through the parent, to a switch that sends it back (hairpin).
+				- |private|: the macvlan interfaces of the parent can't reach each other at all.
+				- |passthru|: a single macvlan interface takes over the parent, e.g. to give a VM
+				  the whole NIC.`),
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("bridge"),
+				Validators: []validator.String{
+					stringvalidator.OneOf(nlops.MacvlanModes...),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"macvtap": schema.BoolAttribute{
+				Description: "Create a macvtap interface, with a `tap_device` QEMU can use, instead of a macvlan one. " +
+					"Can't be placed in a network namespace. Default: `false`.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(false),
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace to place the macvlan interface in, the default one if not specified",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"mtu": schema.Int64Attribute{
+				Description: "MTU size for the macvlan interface, at most the one of the parent",
+				Optional:    true,
+				Computed:    true,
+			},
+			"state": schema.StringAttribute{
+				Description: "State of the macvlan interface (up/down)",
+				Optional:    true,
+				Computed:    true,
+			},
+			"mac_address": schema.StringAttribute{
+				Description: "MAC address for the macvlan interface. With `macvtap` the VM NIC must use the same one.",
+				Optional:    true,
+				Computed:    true,
+			},
+			"ipv4_address": schema.StringAttribute{
+				Description: "IPv4 address to configure on the macvlan interface",
+				Optional:    true,
+			},
+			"ipv6_address": schema.StringAttribute{
+				Description: "IPv6 address for the macvlan interface",
+				Optional:    true,
+			},
+			"tap_device": schema.StringAttribute{
+				Computed:    true,
+				Description: "With `macvtap`, the character device of the interface (`/dev/tap<ifindex>`) to hand to QEMU. Null otherwise.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig rejects a macvtap in a network namespace: its tap device is
+// named after the interface index in that namespace, which can clash with the
+// ones of the default namespace.
+func (r *Macvlan) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data MacvlanModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if data.Macvtap.ValueBool() && !data.NetNS.IsNull() && !data.NetNS.IsUnknown() && data.NetNS.ValueString() != "" {
+		resp.Diagnostics.AddAttributeError(path.Root("netns"), "Invalid macvlan configuration",
+			"A macvtap interface can't be placed in a network namespace.")
+	}
+}
+
+func (r *Macvlan) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_macvlan", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Macvlan resource configure debugging", traceData)
+}
+
+func (r *Macvlan) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data MacvlanModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Macvlan Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Macvlan Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Macvlan Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Create and configure the interface in one batch, e.g. the equivalent
+	// of `ip link add link eth0 name mv0 netns lab type macvlan mode bridge`.
+	typ := nlops.TypeMacvlan
+	if data.Macvtap.ValueBool() {
+		typ = nlops.TypeMacvtap
+	}
+	ops := []nlops.Op{{
+		Kind:   nlops.OpLinkAdd,
+		Name:   data.Name.ValueString(),
+		NetNS:  data.NetNS.ValueString(),
+		Type:   typ,
+		Parent: data.Parent.ValueString(),
+		Mode:   data.Mode.ValueString(),
+	}}
+	ops = append(ops, vethEndCreateOps(data.end())...)
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("Macvlan Resource Error",
+			fmt.Sprintf("Unable to create a new %s: %v", typ, err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readMacvlan(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read macvlan state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// With an IPv6 address the interface also gets the link-local address
+	// derived from its MAC right away, see the bridge Create.
+	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
+		llOps, err := linkLocalOps(data.Name.ValueString(), "", data.MACAddress.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("Macvlan Resource Error",
+				fmt.Sprintf("Can't configure link-local address on macvlan interface: %v", err))
+			return
+		}
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
+			resp.Diagnostics.AddError("Macvlan Resource Error",
+				fmt.Sprintf("Unable to configure macvlan link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	}
+
+	tflog.Trace(ctx, "Macvlan Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Macvlan) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data MacvlanModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	prior := data
+	if diags, err := r.readMacvlan(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// The interface (or its parent, or its namespace) was deleted
+			// outside Terraform: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read macvlan state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if want, drift := macvlanHealTarget(prior, data); drift {
+		tflog.Info(ctx, "Macvlan settings drifted, restoring them", map[string]any{"macvlan": data.Name.ValueString()})
+		if diags, err := r.applyMacvlan(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("Macvlan Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of macvlan '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readMacvlan(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read macvlan state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Macvlan) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan MacvlanModel
+	var state MacvlanModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// name, parent, mode, macvtap and netns are RequiresReplace, so they
+	// cannot reach Update changed.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.NetNS.ValueString())
+
+	if diags, err := r.applyMacvlan(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("Macvlan Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readMacvlan(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read macvlan state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Macvlan) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data MacvlanModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the interface. If it (or its namespace) doesn't exist the delete
+	// is successful (idempotent).
+	op := nlops.Op{Kind: nlops.OpLinkDel, Name: data.Name.ValueString()}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete macvlan", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Macvlan Resource Delete Error",
+			fmt.Sprintf("Can't delete macvlan resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Macvlan) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+func (r *Macvlan) readMacvlan(ctx context.Context, resPath string, nl netLinks, model *MacvlanModel) (diag.Diagnostics, error) {
+	name := model.Name.ValueString()
+
+	link, diags, err := nl.show(ctx, resPath, name)
+	if err != nil {
+		return diags, fmt.Errorf("can't retrieve macvlan '%s' details: %w", name, err)
+	}
+
+	model.MTU = types.Int64Value(int64(link.MTU))
+	model.State = linkState(link)
+	if link.MAC != "" {
+		model.MACAddress = types.StringValue(link.MAC)
+	}
+	model.TapDevice = types.StringNull()
+	if model.Macvtap.ValueBool() {
+		model.TapDevice = types.StringValue(macvtapDevice(link.Index))
+	}
+
+	// Report the configured IPv4/IPv6 address while it is still present,
+	// link-local addresses are not reported.
+	model.IPv4Address = pickIntfAddr(model.IPv4Address, link.Addrs4)
+	model.IPv6Address = pickIntfAddr(model.IPv6Address, link.Addrs6)
+
+	return nil, nil
+}
+
+// applyMacvlan reconciles the in-place settings of the interface from old to
+// new, for Update and for the drift self-heal in Read. Unknown values in new
+// are left alone. All changes are applied as one batch.
+func (r *Macvlan) applyMacvlan(ctx context.Context, resPath string, nl netLinks, old, new *MacvlanModel) (diag.Diagnostics, error) {
+	ops, err := vethEndApplyOps(old.end(), new.end())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply macvlan '%s' settings: %w", new.Name.ValueString(), err)
+	}
+	return nil, nil
+}
+
+// macvlanHealTarget returns the settings Read restores when the actual
+// interface drifted from the prior state, and whether it did.
+func macvlanHealTarget(prior, actual MacvlanModel) (MacvlanModel, bool) {
+	want := prior
+	if want.IPv4Address.IsNull() {
+		want.IPv4Address = actual.IPv4Address
+	}
+	if want.IPv6Address.IsNull() {
+		want.IPv6Address = actual.IPv6Address
+	}
+	want.TapDevice = actual.TapDevice
+
+	drift := !want.MTU.Equal(actual.MTU) ||
+		!want.State.Equal(actual.State) ||
+		!want.MACAddress.Equal(actual.MACAddress) ||
+		!want.IPv4Address.Equal(actual.IPv4Address) ||
+		!want.IPv6Address.Equal(actual.IPv6Address)
+	return want, drift
+}
+
+// macvtapDevice returns the character device of the macvtap interface with
+// ifindex index, created by udev.
+func macvtapDevice(index int) string {
+	return fmt.Sprintf("/dev/tap%d", index)
+}
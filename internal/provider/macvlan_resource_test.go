@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+func testMacvlanModel() MacvlanModel {
+	return MacvlanModel{
+		ID:          types.StringValue("id"),
+		Name:        types.StringValue("mvt0"),
+		Parent:      types.StringValue("eth0"),
+		Mode:        types.StringValue("bridge"),
+		Macvtap:     types.BoolValue(true),
+		NetNS:       types.StringNull(),
+		MTU:         types.Int64Value(1500),
+		State:       types.StringValue("up"),
+		MACAddress:  types.StringValue("02:00:00:00:00:01"),
+		IPv4Address: types.StringNull(),
+		IPv6Address: types.StringNull(),
+		TapDevice:   types.StringValue("/dev/tap12"),
+	}
+}
+
+func TestMacvlanHealTarget(t *testing.T) {
+	is := is.New(t)
+	prior := testMacvlanModel()
+
+	// An address added outside of Terraform isn't drift.
+	actual := prior
+	actual.IPv4Address = types.StringValue("192.0.2.10/24")
+	_, drift := macvlanHealTarget(prior, actual)
+	is.True(!drift)
+
+	// A changed MAC address is restored, the VM NIC depends on it.
+	actual = prior
+	actual.MACAddress = types.StringValue("02:00:00:00:00:99")
+	actual.State = types.StringValue("down")
+	want, drift := macvlanHealTarget(prior, actual)
+	is.True(drift)
+	is.Equal(want.MACAddress, prior.MACAddress)
+	is.Equal(want.State, prior.State)
+
+	ops, err := vethEndApplyOps(actual.end(), want.end())
+	is.NoErr(err)
+	is.Equal(ops, []nlops.Op{
+		{Kind: nlops.OpLinkSet, Name: "mvt0", MAC: "02:00:00:00:00:01"},
+		{Kind: nlops.OpLinkSet, Name: "mvt0", State: "up"},
+	})
+}
+
+func TestMacvtapDevice(t *testing.T) {
+	is := is.New(t)
+	is.Equal(macvtapDevice(12), "/dev/tap12")
+	is.True(macvtapDeviceRegex.MatchString(macvtapDevice(12)))
+	is.True(!macvtapDeviceRegex.MatchString("/dev/net/tun"))
+}
@@ -67,6 +67,8 @@ type MonitorSystemUsageModel struct {
 	ConfigFile  types.String `tfsdk:"config_file"`
 	PIDFile     types.String `tfsdk:"pid_file"`
 	State       types.String `tfsdk:"state"`
+	Restarts    types.Int64  `tfsdk:"restarts"`
+	LastExit    types.String `tfsdk:"last_exit"`
 	NetNS       types.String `tfsdk:"netns"`
 }
 
@@ -148,6 +150,8 @@ func (r *MonitorSystemUsage) Schema(ctx context.Context, req resource.SchemaRequ
 				Computed:    true,
 				Description: "Process ID file",
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 			"state": schema.StringAttribute{
 				Optional:    true,
 				Computed:    true,
@@ -383,21 +387,9 @@ func (r *MonitorSystemUsage) startMonitorSystemUsage(ctx context.Context, d stri
 	}
 
 	self := r.providerConf.Exec.SelfPath()
-	srvCmd := self
-	srvArgs := []string{}
-	if netns != "" {
-		if r.providerConf.UseSudo {
-			srvCmd = r.providerConf.Sudo
-			srvArgs = []string{"-n", r.providerConf.IP, "netns", "exec", netns, self}
-		} else {
-			srvCmd = r.providerConf.IP
-			srvArgs = []string{"netns", "exec", netns, self}
-		}
-	} else if r.providerConf.UseSudo {
-		srvCmd = r.providerConf.Sudo
-		srvArgs = []string{"-n", self}
-	}
-	moreArgs := []string{"-pid-file", data.PIDFile.ValueString(), "-monitor-system-usage", "-msu.config", data.ConfigFile.ValueString()}
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-monitor-system-usage", "-msu.config", data.ConfigFile.ValueString())
 	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
 		return fmt.Errorf("failed to start monitor-system-usage daemon: %w, diagnostics: %v", err, res.Diagnostics())
 	}
@@ -450,6 +442,7 @@ func (r *MonitorSystemUsage) readMonitorSystemUsage(ctx context.Context, resPath
 	}
 
 	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
 
 	return nil, nil
 }
@@ -0,0 +1,476 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int32validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	natsDir = "nats"
+
+	// natTablePrefix prefixes the name of the nftables table of a nat
+	// resource.
+	natTablePrefix = "zedamigo_nat_"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &NAT{}
+	_ resource.ResourceWithImportState    = &NAT{}
+	_ resource.ResourceWithValidateConfig = &NAT{}
+)
+
+func NewNAT() resource.Resource {
+	return &NAT{}
+}
+
+// NAT defines the resource implementation.
+type NAT struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// NATModel describes the resource data model.
+type NATModel struct {
+	ID               types.String          `tfsdk:"id"`
+	Name             types.String          `tfsdk:"name"`
+	NetNS            types.String          `tfsdk:"netns"`
+	Table            types.String          `tfsdk:"table"`
+	EgressInterface  types.String          `tfsdk:"egress_interface"`
+	SourceInterfaces []types.String        `tfsdk:"source_interfaces"`
+	SourceCIDRs      []types.String        `tfsdk:"source_cidrs"`
+	Masquerade       types.Bool            `tfsdk:"masquerade"`
+	EnableForwarding types.Bool            `tfsdk:"enable_forwarding"`
+	PortForwards     []NATPortForwardModel `tfsdk:"port_forward"`
+}
+
+// NATPortForwardModel describes a `port_forward` block.
+type NATPortForwardModel struct {
+	Protocol  types.String `tfsdk:"protocol"`
+	Address   types.String `tfsdk:"address"`
+	Port      types.Int32  `tfsdk:"port"`
+	ToAddress types.String `tfsdk:"to_address"`
+	ToPort    types.Int32  `tfsdk:"to_port"`
+}
+
+func (r *NAT) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, natsDir, id)
+}
+
+func (r *NAT) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_nat"
+}
+
+func (r *NAT) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "NAT (masquerade and port forwards) with nftables",
+		MarkdownDescription: undent.Md(`
+		Masquerade the traffic leaving through |egress_interface| (e.g. the traffic of the edge
+		nodes on a |zedamigo_bridge| served by a |zedamigo_dhcp_server|, so that they reach the
+		internet), and forward ports arriving on it to internal addresses (DNAT).
+
+		The rules live in an nftables table owned by the resource (|table|, of the |inet| family),
+		in the default network namespace or in |netns|. The table is replaced atomically on every
+		change and deleted with the resource; a table deleted outside of Terraform is created
+		again on the next apply. Requires the |nft| command on the target.
+
+		NAT only applies to forwarded traffic: IP forwarding is enabled in the network namespace
+		unless |enable_forwarding = false| (and left enabled on destroy). Note that a firewall
+		dropping forwarded traffic elsewhere (e.g. Docker sets the iptables |FORWARD| policy to
+		|DROP|) still applies.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "NAT resource identifier",
+				MarkdownDescription: "NAT resource identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Description: "Name of the NAT, used to name its nftables `table`",
+				Required:    true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(nftNameRegex, "must start with a letter and contain only letters, digits, `_` and `-`"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace to NAT in, the default one if not specified",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"table": schema.StringAttribute{
+				Computed:    true,
+				Description: "Name of the nftables table of the NAT, of the `inet` family",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"egress_interface": schema.StringAttribute{
+				Description: "Interface towards the outside, e.g. the uplink of the host",
+				Required:    true,
+			},
+			"source_interfaces": schema.ListAttribute{
+				Description: "Only masquerade the traffic arriving on these interfaces, e.g. a bridge. Default: all.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"source_cidrs": schema.ListAttribute{
+				Description: "Only masquerade the traffic from these prefixes (CIDR), e.g. the subnet of a bridge. Default: all.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"masquerade": schema.BoolAttribute{
+				Description: "Masquerade the traffic leaving through `egress_interface` (source NAT to its address). " +
+					"Set to `false` to only forward ports. Default: `true`.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(true),
+			},
+			"enable_forwarding": schema.BoolAttribute{
+				Description: "Enable IPv4 and IPv6 forwarding in the network namespace. Default: `true`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(true),
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"port_forward": schema.ListNestedBlock{
+				Description: "Port arriving on `egress_interface` to forward (DNAT) to an internal address, " +
+					"repeat the block for more ports",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"protocol": schema.StringAttribute{
+							Description: `Transport protocol: "tcp" (default) or "udp".`,
+							Optional:    true,
+							Validators: []validator.String{
+								stringvalidator.OneOf("tcp", "udp"),
+							},
+						},
+						"address": schema.StringAttribute{
+							Description: "Only forward the port of this destination address. Default: any address of the interface.",
+							Optional:    true,
+						},
+						"port": schema.Int32Attribute{
+							Description: "Port to forward",
+							Required:    true,
+							Validators: []validator.Int32{
+								int32validator.Between(1, 65535),
+							},
+						},
+						"to_address": schema.StringAttribute{
+							Description: "Internal address to forward to, e.g. the address of an edge node",
+							Required:    true,
+						},
+						"to_port": schema.Int32Attribute{
+							Description: "Internal port to forward to. Default: `port`.",
+							Optional:    true,
+							Validators: []validator.Int32{
+								int32validator.Between(1, 65535),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks the prefixes and addresses, so that a typo doesn't
+// surface as an `nft` syntax error.
+func (r *NAT) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data NATModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	for i, c := range data.SourceCIDRs {
+		if c.IsNull() || c.IsUnknown() {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(c.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("source_cidrs").AtListIndex(i), "Invalid NAT configuration", err.Error())
+		}
+	}
+	for i, pf := range data.PortForwards {
+		ipAttrErrors(&resp.Diagnostics, path.Root("port_forward").AtListIndex(i), map[string]types.String{
+			"address": pf.Address, "to_address": pf.ToAddress,
+		})
+	}
+}
+
+func (r *NAT) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_nat", &resp.Diagnostics)
+	requireNft(conf, "zedamigo_nat", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "NAT resource configure debugging", traceData)
+}
+
+func (r *NAT) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data NATModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("NAT Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+	data.Table = types.StringValue(natTablePrefix + data.Name.ValueString())
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("NAT Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("NAT Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	if diags, err := r.applyNAT(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("NAT Resource Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "NAT Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NAT) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data NATModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	exists, drifted, diags, err := nftTableState(ctx, r.providerConf, d, data.NetNS.ValueString(), data.Table.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read NAT state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	if !exists {
+		// The table (or its namespace) was deleted outside Terraform:
+		// remove from state.
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	// Self-heal drift: rules changed behind our back (e.g. with `nft` by
+	// hand) are put back by reloading the whole table.
+	if drifted {
+		tflog.Info(ctx, "NAT rules drifted, restoring them", map[string]any{"table": data.Table.ValueString()})
+		if diags, err := r.applyNAT(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddWarning("NAT Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted rules of nftables table '%s': %v", data.Table.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NAT) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan NATModel
+	var state NATModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// name and netns are RequiresReplace, so the table stays the same.
+	d := r.getResourceDir(state.ID.ValueString())
+	plan.Table = state.Table
+
+	if diags, err := r.applyNAT(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("NAT Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *NAT) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data NATModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if diags, err := nftDeleteTable(ctx, r.providerConf, d, data.NetNS.ValueString(), data.Table.ValueString()); err != nil {
+		resp.Diagnostics.AddError("Failed to delete NAT", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("NAT Resource Delete Error",
+			fmt.Sprintf("Can't delete NAT resource directory: %v", err))
+		return
+	}
+}
+
+func (r *NAT) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// applyNAT enables forwarding if configured and loads the table of model.
+func (r *NAT) applyNAT(ctx context.Context, resPath string, model *NATModel) (diag.Diagnostics, error) {
+	netns := model.NetNS.ValueString()
+	if model.EnableForwarding.ValueBool() {
+		if diags, err := enableForwarding(ctx, r.providerConf, resPath, netns); err != nil {
+			return diags, err
+		}
+	}
+	ruleset := nftRuleset(model.Table.ValueString(), natChains(model))
+	return nftLoad(ctx, r.providerConf, resPath, netns, model.Table.ValueString(), ruleset)
+}
+
+// natChains returns the chains of the nftables table of model.
+func natChains(model *NATModel) string {
+	var b strings.Builder
+	egress := nftString(model.EgressInterface.ValueString())
+
+	b.WriteString("\tchain prerouting {\n\t\ttype nat hook prerouting priority dstnat; policy accept;\n")
+	for _, pf := range model.PortForwards {
+		proto := "tcp"
+		if !pf.Protocol.IsNull() && pf.Protocol.ValueString() != "" {
+			proto = pf.Protocol.ValueString()
+		}
+		toPort := pf.Port.ValueInt32()
+		if !pf.ToPort.IsNull() {
+			toPort = pf.ToPort.ValueInt32()
+		}
+		// An inet table needs the family of the DNAT.
+		family, nfproto, to := "ip", "ipv4", fmt.Sprintf("%s:%d", pf.ToAddress.ValueString(), toPort)
+		if ip := net.ParseIP(pf.ToAddress.ValueString()); ip != nil && ip.To4() == nil {
+			family, nfproto, to = "ip6", "ipv6", fmt.Sprintf("[%s]:%d", pf.ToAddress.ValueString(), toPort)
+		}
+		match := fmt.Sprintf("iifname %s meta nfproto %s", egress, nfproto)
+		if !pf.Address.IsNull() && pf.Address.ValueString() != "" {
+			match += fmt.Sprintf(" %s daddr %s", family, pf.Address.ValueString())
+		}
+		fmt.Fprintf(&b, "\t\t%s %s dport %d dnat %s to %s\n", match, proto, pf.Port.ValueInt32(), family, to)
+	}
+	b.WriteString("\t}\n")
+
+	b.WriteString("\tchain postrouting {\n\t\ttype nat hook postrouting priority srcnat; policy accept;\n")
+	if model.Masquerade.ValueBool() {
+		match := "oifname " + egress
+		if srcIntfs := stringValues(model.SourceInterfaces); len(srcIntfs) > 0 {
+			match += " iifname " + nftSet(srcIntfs)
+		}
+		v4, v6 := nftAddrSets(stringValues(model.SourceCIDRs))
+		if v4 == "" && v6 == "" {
+			fmt.Fprintf(&b, "\t\t%s masquerade\n", match)
+		}
+		if v4 != "" {
+			fmt.Fprintf(&b, "\t\t%s ip saddr %s masquerade\n", match, v4)
+		}
+		if v6 != "" {
+			fmt.Fprintf(&b, "\t\t%s ip6 saddr %s masquerade\n", match, v6)
+		}
+	}
+	b.WriteString("\t}\n")
+	return b.String()
+}
+
+// enableForwarding enables IPv4 and IPv6 forwarding in network namespace
+// netns.
+func enableForwarding(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns string) (diag.Diagnostics, error) {
+	var diags diag.Diagnostics
+	if requireSysctl(conf, "zedamigo_nat", &diags); diags.HasError() {
+		return diags, errors.New("can't enable IP forwarding without `sysctl`")
+	}
+	cmd, args := buildNetNSCommand(conf, netns, conf.Sysctl)
+	args = append(args, "-w", "net.ipv4.ip_forward=1", "net.ipv6.conf.all.forwarding=1")
+	if res, err := conf.Exec.Run(ctx, resPath, cmd, args...); err != nil {
+		return res.Diagnostics(), fmt.Errorf("can't enable IP forwarding: %w", err)
+	}
+	return nil, nil
+}
+
+// requireNft adds an error diagnostic when the `nft` command needed by
+// resourceName wasn't found on the target.
+func requireNft(conf *ZedAmigoProviderConfig, resourceName string, diags *diag.Diagnostics) {
+	if conf.Nft == "" {
+		diags.AddError(fmt.Sprintf("%s requires the `nft` command.", resourceName),
+			fmt.Sprintf("The %s resource loads its rules with the `nft` command of nftables, which was not found on the target.", resourceName))
+	}
+}
+
+// requireSysctl adds an error diagnostic when the `sysctl` command needed by
+// resourceName wasn't found on the target.
+func requireSysctl(conf *ZedAmigoProviderConfig, resourceName string, diags *diag.Diagnostics) {
+	if conf.Sysctl == "" {
+		diags.AddError(fmt.Sprintf("%s requires the `sysctl` command.", resourceName),
+			fmt.Sprintf("The %s resource sets kernel parameters with the `sysctl` command, which was not found on the target.", resourceName))
+	}
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+func TestNATChains(t *testing.T) {
+	is := is.New(t)
+
+	m := &NATModel{
+		EgressInterface:  types.StringValue("eth0"),
+		SourceInterfaces: []types.String{types.StringValue("br-lab")},
+		SourceCIDRs:      []types.String{types.StringValue("10.0.0.0/24"), types.StringValue("fd00::/64")},
+		Masquerade:       types.BoolValue(true),
+		PortForwards: []NATPortForwardModel{
+			{Protocol: types.StringNull(), Address: types.StringNull(), Port: types.Int32Value(8022),
+				ToAddress: types.StringValue("10.0.0.5"), ToPort: types.Int32Value(22)},
+			{Protocol: types.StringValue("udp"), Address: types.StringValue("2001:db8::1"), Port: types.Int32Value(5000),
+				ToAddress: types.StringValue("fd00::5"), ToPort: types.Int32Null()},
+		},
+	}
+	is.Equal(natChains(m), "\tchain prerouting {\n"+
+		"\t\ttype nat hook prerouting priority dstnat; policy accept;\n"+
+		"\t\tiifname \"eth0\" meta nfproto ipv4 tcp dport 8022 dnat ip to 10.0.0.5:22\n"+
+		"\t\tiifname \"eth0\" meta nfproto ipv6 ip6 daddr 2001:db8::1 udp dport 5000 dnat ip6 to [fd00::5]:5000\n"+
+		"\t}\n"+
+		"\tchain postrouting {\n"+
+		"\t\ttype nat hook postrouting priority srcnat; policy accept;\n"+
+		"\t\toifname \"eth0\" iifname \"br-lab\" ip saddr 10.0.0.0/24 masquerade\n"+
+		"\t\toifname \"eth0\" iifname \"br-lab\" ip6 saddr fd00::/64 masquerade\n"+
+		"\t}\n")
+
+	// Without sources everything leaving through the egress interface is
+	// masqueraded.
+	m = &NATModel{EgressInterface: types.StringValue("eth0"), Masquerade: types.BoolValue(true)}
+	is.Equal(natChains(m), "\tchain prerouting {\n"+
+		"\t\ttype nat hook prerouting priority dstnat; policy accept;\n"+
+		"\t}\n"+
+		"\tchain postrouting {\n"+
+		"\t\ttype nat hook postrouting priority srcnat; policy accept;\n"+
+		"\t\toifname \"eth0\" masquerade\n"+
+		"\t}\n")
+}
+
+func TestNftRuleset(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(nftRuleset("zedamigo_nat_lab", "\tchain c {\n\t}\n"),
+		"# Managed by terraform-provider-zedamigo, changes are overwritten.\n"+
+			"table inet zedamigo_nat_lab {}\n"+
+			"delete table inet zedamigo_nat_lab\n"+
+			"table inet zedamigo_nat_lab {\n\tchain c {\n\t}\n}\n")
+
+	v4, v6 := nftAddrSets([]string{"10.0.0.0/24", "192.0.2.1", "fd00::/64"})
+	is.Equal(v4, "{ 10.0.0.0/24, 192.0.2.1 }")
+	is.Equal(v6, "fd00::/64")
+
+	is.Equal(nftSet([]string{"br0", "br1"}), `{ "br0", "br1" }`)
+	is.Equal(nftString(`a "quoted" comment`), `"a quoted comment"`)
+}
+
+// fakeNft is a stand-in for `nft`: -f loads a ruleset file as the table,
+// list prints it back.
+const fakeNft = `#!/bin/sh
+table="$(dirname "$0")/table"
+case "$1" in
+-f) cp "$2" "$table" ;;
+list) cat "$table" 2>/dev/null || { echo "Error: No such file or directory" >&2; exit 1; } ;;
+esac
+`
+
+func TestNftTableState(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	nft := filepath.Join(dir, "nft")
+	is.NoErr(os.WriteFile(nft, []byte(fakeNft), 0o755))
+	conf := &ZedAmigoProviderConfig{Exec: exec.NewLocal(false), Nft: nft}
+
+	exists, _, _, err := nftTableState(ctx, conf, dir, "", "t")
+	is.NoErr(err)
+	is.True(!exists) // Not loaded yet.
+
+	_, err = nftLoad(ctx, conf, dir, "", "t", nftRuleset("t", "\tchain c {\n\t}\n"))
+	is.NoErr(err)
+	exists, drifted, _, err := nftTableState(ctx, conf, dir, "", "t")
+	is.NoErr(err)
+	is.True(exists)
+	is.True(!drifted) // Just loaded.
+
+	// A rule added by hand.
+	f, err := os.OpenFile(filepath.Join(dir, "table"), os.O_APPEND|os.O_WRONLY, 0)
+	is.NoErr(err)
+	_, err = f.WriteString("add rule inet t c accept\n")
+	is.NoErr(err)
+	is.NoErr(f.Close())
+	exists, drifted, _, err = nftTableState(ctx, conf, dir, "", "t")
+	is.NoErr(err)
+	is.True(exists)
+	is.True(drifted)
+}
@@ -0,0 +1,893 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/cmd/result"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/errchecker"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+// Values of the `network_backend` provider attribute.
+const (
+	networkBackendNetlink  = "netlink"
+	networkBackendIPRoute2 = "iproute2"
+)
+
+// netLinks applies link, address, route, rule and network namespace
+// operations, and reports links, routes and rules, in one network namespace
+// of the target (ops may name another one). It is how the bridge, bridge
+// VLAN, TAP, veth, VLAN, macvlan, ipvlan, VXLAN, GRETAP, WireGuard, LAG,
+// route, rule and netns resources change the network configuration, with either backend of the `network_backend` provider
+// attribute. Errors match the nlops sentinels (nlops.ErrNotFound, ...) with
+// errors.Is.
+type netLinks interface {
+	// apply applies ops in order. With the netlink backend a failure undoes
+	// the ops already applied; iproute2 stops at the failed op.
+	apply(ctx context.Context, resPath string, ops ...nlops.Op) (diag.Diagnostics, error)
+	// show reports link name. A missing link is an nlops.ErrNotFound error.
+	show(ctx context.Context, resPath string, name string) (nlops.Link, diag.Diagnostics, error)
+	// links reports all the links, ordered by index. The iproute2 backend
+	// leaves out the bridge VLANs.
+	links(ctx context.Context, resPath string) ([]nlops.Link, diag.Diagnostics, error)
+	// routes reports the routes of all the tables but the local one, of
+	// both families.
+	routes(ctx context.Context, resPath string) ([]nlops.Route, diag.Diagnostics, error)
+	// rules reports the routing policy rules of both families.
+	rules(ctx context.Context, resPath string) ([]nlops.Rule, diag.Diagnostics, error)
+}
+
+// newNetLinks returns the netLinks of the configured backend for netns (the
+// default namespace when empty). The namespace operations always run in the
+// default namespace.
+func newNetLinks(conf *ZedAmigoProviderConfig, netns string) netLinks {
+	if conf.NetworkBackend == networkBackendIPRoute2 {
+		ipCmd, ipArgs := buildIPCommand(conf, netns)
+		return &ipLinks{conf: conf, netns: netns, ipCmd: ipCmd, ipArgs: ipArgs}
+	}
+	return &nlLinks{conf: conf, netns: netns}
+}
+
+// nlLinks is the netlink backend. Locally, without sudo, the requests are
+// executed in-process; otherwise by the provider binary in `-netlink` mode
+// on the target (with sudo if configured), one process per request.
+type nlLinks struct {
+	conf  *ZedAmigoProviderConfig
+	netns string
+}
+
+func (l *nlLinks) apply(ctx context.Context, resPath string, ops ...nlops.Op) (diag.Diagnostics, error) {
+	_, diags, err := l.do(ctx, resPath, nlops.Request{NetNS: l.netns, Ops: ops})
+	return diags, err
+}
+
+func (l *nlLinks) show(ctx context.Context, resPath string, name string) (nlops.Link, diag.Diagnostics, error) {
+	resp, diags, err := l.do(ctx, resPath, nlops.Request{NetNS: l.netns, Show: []string{name}})
+	if err != nil {
+		return nlops.Link{}, diags, err
+	}
+	if len(resp.Links) != 1 {
+		return nlops.Link{}, nil, fmt.Errorf("unexpected netlink response for link '%s': %d links", name, len(resp.Links))
+	}
+	return resp.Links[0], nil, nil
+}
+
+func (l *nlLinks) links(ctx context.Context, resPath string) ([]nlops.Link, diag.Diagnostics, error) {
+	resp, diags, err := l.do(ctx, resPath, nlops.Request{NetNS: l.netns, ShowAll: true})
+	return resp.Links, diags, err
+}
+
+func (l *nlLinks) routes(ctx context.Context, resPath string) ([]nlops.Route, diag.Diagnostics, error) {
+	resp, diags, err := l.do(ctx, resPath, nlops.Request{NetNS: l.netns, ShowRoutes: true})
+	return resp.Routes, diags, err
+}
+
+func (l *nlLinks) rules(ctx context.Context, resPath string) ([]nlops.Rule, diag.Diagnostics, error) {
+	resp, diags, err := l.do(ctx, resPath, nlops.Request{NetNS: l.netns, ShowRules: true})
+	return resp.Rules, diags, err
+}
+
+func (l *nlLinks) do(ctx context.Context, resPath string, req nlops.Request) (nlops.Response, diag.Diagnostics, error) {
+	// The namespace operations don't run inside a namespace.
+	for _, op := range req.Ops {
+		if op.Kind == nlops.OpNetNSAdd || op.Kind == nlops.OpNetNSDel {
+			req.NetNS = ""
+		}
+	}
+
+	if l.conf.Exec.IsLocal() && !l.conf.UseSudo {
+		resp := nlops.Do(req)
+		return resp, nil, resp.Err()
+	}
+
+	js, err := req.Marshal()
+	if err != nil {
+		return nlops.Response{}, nil, err
+	}
+	self := l.conf.Exec.SelfPath()
+	nlCmd := self
+	nlArgs := []string{}
+	if l.conf.UseSudo {
+		nlCmd = l.conf.Sudo
+		nlArgs = []string{"-n", self}
+	}
+	moreArgs := []string{"-netlink", "-nl.request", js}
+	res, err := l.conf.Exec.Run(ctx, resPath, nlCmd, append(nlArgs, moreArgs...)...)
+	if err != nil {
+		return nlops.Response{}, res.Diagnostics(), fmt.Errorf("can't run the netlink helper: %w", err)
+	}
+	resp, err := nlops.ParseResponse([]byte(res.Stdout))
+	if err != nil {
+		return nlops.Response{}, res.Diagnostics(), err
+	}
+	return resp, nil, resp.Err()
+}
+
+// ipLinks is the iproute2 backend, running `ip` (and `bridge` for the bridge
+// VLANs) commands and parsing their output. Failures are mapped to errnos
+// from the error messages.
+type ipLinks struct {
+	conf   *ZedAmigoProviderConfig
+	netns  string
+	ipCmd  string
+	ipArgs []string
+}
+
+// bridgeCommand returns the `bridge` command and its leading arguments, for
+// network namespace netns.
+func (l *ipLinks) bridgeCommand(netns string) (string, []string) {
+	cmd, args := l.conf.Bridge, []string{}
+	if l.conf.UseSudo {
+		cmd, args = l.conf.Sudo, []string{"-n", l.conf.Bridge}
+	}
+	if netns != "" {
+		args = append(args, "-netns", netns)
+	}
+	return cmd, args
+}
+
+// wgCommand returns the `wg` command and its leading arguments, for network
+// namespace netns.
+func (l *ipLinks) wgCommand(netns string) (string, []string) {
+	return buildNetNSCommand(l.conf, netns, l.conf.Wg)
+}
+
+// ipErrnoStrs maps substrings of `ip` error messages to the errno behind
+// them.
+var ipErrnoStrs = []struct {
+	errno string
+	strs  []string
+}{
+	{"ENODEV", intfNotFoundStrs},
+	{"EADDRNOTAVAIL", addrNotFoundStrs},
+	{"EEXIST", addrExistsStrs},
+	{"EBUSY", []string{"Device or resource busy"}},
+	{"ENOENT", []string{"No such file or directory"}},
+	{"ESRCH", []string{"No such process"}},
+	{"EOPNOTSUPP", []string{"Operation not supported", "Unknown device type"}},
+}
+
+func ipError(op int, args []string, res result.Result, err error) error {
+	e := &nlops.Error{Op: op, Msg: fmt.Sprintf("ip %s: %v", strings.Join(args, " "), err)}
+	for _, m := range ipErrnoStrs {
+		if errchecker.ContainsAny(err, m.strs) || errchecker.DiagsAny(res.Diagnostics(), m.strs) {
+			e.Errno = m.errno
+			break
+		}
+	}
+	return e
+}
+
+// ipOpArgs returns the `ip` commands of op.
+func ipOpArgs(op nlops.Op) ([][]string, error) {
+	switch op.Kind {
+	case nlops.OpLinkAdd:
+		switch op.Type {
+		case nlops.TypeBridge:
+			return [][]string{append([]string{"link", "add", op.Name, "type", "bridge"}, bridgeOptArgs(op)...)}, nil
+		case nlops.TypeVLAN:
+			return [][]string{{"link", "add", "link", op.Parent, "name", op.Name,
+				"type", "vlan", "id", strconv.Itoa(op.VlanID)}}, nil
+		case nlops.TypeMacvlan, nlops.TypeMacvtap, nlops.TypeIPVlan:
+			// Run in ParentNetNS, see ipLinks.apply.
+			args := []string{"link", "add", "link", op.Parent, "name", op.Name}
+			if op.NetNS != op.ParentNetNS {
+				if op.NetNS == "" {
+					return nil, fmt.Errorf("can't move %s '%s' into the default network namespace", op.Type, op.Name)
+				}
+				args = append(args, "netns", op.NetNS)
+			}
+			args = append(args, "type", op.Type)
+			if op.Mode != "" {
+				args = append(args, "mode", op.Mode)
+			}
+			return [][]string{args}, nil
+		case nlops.TypeVXLAN, nlops.TypeGretap:
+			return [][]string{tunnelArgs(op)}, nil
+		case nlops.TypeWireguard:
+			return [][]string{{"link", "add", op.Name, "type", "wireguard"}}, nil
+		case nlops.TypeBond:
+			args := []string{"link", "add", op.Name, "type", "bond"}
+			if b := op.Bond; b != nil {
+				if b.Mode != "" {
+					args = append(args, "mode", b.Mode)
+				}
+				if b.MIIMon > 0 {
+					args = append(args, "miimon", strconv.Itoa(b.MIIMon))
+				}
+				if b.LACPRate != "" {
+					args = append(args, "lacp_rate", b.LACPRate)
+				}
+				if b.XmitHashPolicy != "" {
+					args = append(args, "xmit_hash_policy", b.XmitHashPolicy)
+				}
+			}
+			return [][]string{args}, nil
+		case nlops.TypeVeth:
+			// Run in the default namespace, see ipLinks.apply.
+			args := []string{"link", "add", op.Name}
+			if op.NetNS != "" {
+				args = append(args, "netns", op.NetNS)
+			}
+			args = append(args, "type", "veth", "peer", "name", op.Peer)
+			if op.PeerNetNS != "" {
+				args = append(args, "netns", op.PeerNetNS)
+			}
+			return [][]string{args}, nil
+		case nlops.TypeTAP:
+			args := []string{"tuntap", "add", "dev", op.Name, "mode", "tap"}
+			if op.Owner != "" {
+				args = append(args, "user", op.Owner)
+			}
+			if op.Group != "" {
+				args = append(args, "group", op.Group)
+			}
+			return [][]string{args}, nil
+		}
+		return nil, fmt.Errorf("unknown link type %q", op.Type)
+
+	case nlops.OpLinkDel:
+		if op.Type == nlops.TypeTAP {
+			return [][]string{{"tuntap", "delete", "dev", op.Name, "mode", "tap"}}, nil
+		}
+		args := []string{"link", "delete", op.Name}
+		if op.Type != "" {
+			args = append(args, "type", op.Type)
+		}
+		return [][]string{args}, nil
+
+	case nlops.OpLinkSet:
+		var cmds [][]string
+		if op.MTU > 0 {
+			cmds = append(cmds, []string{"link", "set", "dev", op.Name, "mtu", strconv.Itoa(op.MTU)})
+		}
+		if op.MAC != "" {
+			cmds = append(cmds, []string{"link", "set", "dev", op.Name, "address", op.MAC})
+		}
+		if op.Master != "" {
+			cmds = append(cmds, []string{"link", "set", "dev", op.Name, "master", op.Master})
+		} else if op.NoMaster {
+			cmds = append(cmds, []string{"link", "set", "dev", op.Name, "nomaster"})
+		}
+		if brOpts := bridgeOptArgs(op); len(brOpts) > 0 {
+			cmds = append(cmds, append([]string{"link", "set", "dev", op.Name, "type", "bridge"}, brOpts...))
+		}
+		if op.State != "" {
+			cmds = append(cmds, []string{"link", "set", "dev", op.Name, op.State})
+		}
+		return cmds, nil
+
+	case nlops.OpAddrAdd:
+		return [][]string{{"addr", "add", op.Addr, "dev", op.Name}}, nil
+	case nlops.OpAddrDel:
+		return [][]string{{"addr", "del", op.Addr, "dev", op.Name}}, nil
+	case nlops.OpRouteAdd, nlops.OpRouteDel:
+		if op.Route == nil {
+			return nil, errors.New("no route")
+		}
+		return [][]string{routeArgs(op.Kind, *op.Route)}, nil
+	case nlops.OpRuleAdd, nlops.OpRuleDel:
+		if op.Rule == nil {
+			return nil, errors.New("no rule")
+		}
+		return [][]string{ruleArgs(op.Kind, *op.Rule)}, nil
+	case nlops.OpBridgeVlanAdd, nlops.OpBridgeVlanDel:
+		return nil, fmt.Errorf("%s is a `bridge` command", op.Kind)
+	case nlops.OpWireguardSet:
+		return nil, fmt.Errorf("%s is a `wg` command", op.Kind)
+	case nlops.OpNetNSAdd:
+		return [][]string{{"netns", "add", op.Name}}, nil
+	case nlops.OpNetNSDel:
+		return [][]string{{"netns", "delete", op.Name}}, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Kind)
+}
+
+// ipOpDone reports whether the failure err of op means that there was
+// nothing to do, see the nlops operation kinds.
+func ipOpDone(op nlops.Op, err error) bool {
+	switch op.Kind {
+	case nlops.OpLinkDel, nlops.OpNetNSDel, nlops.OpBridgeVlanDel, nlops.OpRouteDel, nlops.OpRuleDel:
+		return errors.Is(err, nlops.ErrNotFound)
+	case nlops.OpLinkSet:
+		return errors.Is(err, nlops.ErrNotFound) && op.IsRelease()
+	case nlops.OpAddrAdd, nlops.OpRuleAdd:
+		return errors.Is(err, nlops.ErrExist)
+	case nlops.OpAddrDel:
+		return errors.Is(err, nlops.ErrAddrNotAvail) || errors.Is(err, nlops.ErrNotFound)
+	}
+	return false
+}
+
+func (l *ipLinks) apply(ctx context.Context, resPath string, ops ...nlops.Op) (diag.Diagnostics, error) {
+	for i, op := range ops {
+		ipCmd, ipArgs := l.ipCmd, l.ipArgs
+		netns := l.netns
+		if op.NetNS != "" {
+			netns = op.NetNS
+			ipCmd, ipArgs = buildIPCommand(l.conf, netns)
+		}
+		var cmds [][]string
+		var err error
+		switch {
+		case op.Kind == nlops.OpBridgeVlanAdd || op.Kind == nlops.OpBridgeVlanDel:
+			ipCmd, ipArgs = l.bridgeCommand(netns)
+			cmds = bridgeVlanArgs(op)
+		case op.Kind == nlops.OpWireguardSet:
+			ipCmd, ipArgs = l.wgCommand(netns)
+			cmds = [][]string{{"setconf", op.Name, op.Config}}
+		case op.Kind == nlops.OpNetNSAdd || op.Kind == nlops.OpNetNSDel:
+			ipCmd, ipArgs = buildIPCommand(l.conf, "")
+			cmds, err = ipOpArgs(op)
+		case op.Kind == nlops.OpLinkAdd && op.Type == nlops.TypeVeth:
+			// Created from the default namespace, naming the namespace
+			// of each end.
+			ipCmd, ipArgs = buildIPCommand(l.conf, "")
+			op.NetNS = netns
+			cmds, err = ipOpArgs(op)
+		case op.InParentNetNS():
+			// Created next to the parent, naming the namespace of the
+			// link.
+			ipCmd, ipArgs = buildIPCommand(l.conf, op.ParentNetNS)
+			op.NetNS = netns
+			cmds, err = ipOpArgs(op)
+		default:
+			cmds, err = ipOpArgs(op)
+		}
+		if err != nil {
+			return nil, &nlops.Error{Op: i, Errno: "EINVAL", Msg: err.Error()}
+		}
+
+		for _, args := range cmds {
+			res, err := l.conf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, args...)...)
+			if err != nil {
+				err = ipError(i, args, res, err)
+				if ipOpDone(op, err) {
+					continue
+				}
+				return res.Diagnostics(), fmt.Errorf("%s '%s': %w", op.Kind, op.Name, err)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (l *ipLinks) show(ctx context.Context, resPath string, name string) (nlops.Link, diag.Diagnostics, error) {
+	// All links, to find the members (bridge ports, bond slaves) and the
+	// master's name. The details carry the bridge VLAN options.
+	args := []string{"-d", "-o", "link", "show"}
+	res, err := l.conf.Exec.Run(ctx, resPath, l.ipCmd, append(l.ipArgs, args...)...)
+	if err != nil {
+		return nlops.Link{}, res.Diagnostics(), ipError(-1, args, res, err)
+	}
+	links, err := parseIPLinks(res.Stdout)
+	if err != nil {
+		return nlops.Link{}, res.Diagnostics(), err
+	}
+	link, ok := links[name]
+	if !ok {
+		return nlops.Link{}, nil, &nlops.Error{Op: -1, Errno: "ENODEV", Msg: fmt.Sprintf("link '%s' does not exist", name)}
+	}
+
+	args = []string{"-o", "addr", "show", "dev", name}
+	res, err = l.conf.Exec.Run(ctx, resPath, l.ipCmd, append(l.ipArgs, args...)...)
+	if err != nil {
+		return nlops.Link{}, res.Diagnostics(), ipError(-1, args, res, err)
+	}
+	link.Addrs4, link.Addrs6 = parseIntfAddrs(res.Stdout)
+
+	// The VLANs of a bridge or of a bridge port, when `bridge` is around.
+	if link.VlanFiltering != nil || links[link.Master].VlanFiltering != nil {
+		if l.conf.Bridge == "" {
+			return link, nil, nil
+		}
+		brCmd, brArgs := l.bridgeCommand(l.netns)
+		args = []string{"-j", "vlan", "show", "dev", name}
+		res, err = l.conf.Exec.Run(ctx, resPath, brCmd, append(brArgs, args...)...)
+		if err != nil {
+			return nlops.Link{}, res.Diagnostics(), ipError(-1, args, res, err)
+		}
+		if link.Vlans, err = parseBridgeVlans(res.Stdout); err != nil {
+			return nlops.Link{}, res.Diagnostics(), err
+		}
+	}
+
+	return link, nil, nil
+}
+
+func (l *ipLinks) links(ctx context.Context, resPath string) ([]nlops.Link, diag.Diagnostics, error) {
+	args := []string{"-d", "-o", "link", "show"}
+	res, err := l.conf.Exec.Run(ctx, resPath, l.ipCmd, append(l.ipArgs, args...)...)
+	if err != nil {
+		return nil, res.Diagnostics(), ipError(-1, args, res, err)
+	}
+	byName, err := parseIPLinks(res.Stdout)
+	if err != nil {
+		return nil, res.Diagnostics(), err
+	}
+
+	args = []string{"-o", "addr", "show"}
+	res, err = l.conf.Exec.Run(ctx, resPath, l.ipCmd, append(l.ipArgs, args...)...)
+	if err != nil {
+		return nil, res.Diagnostics(), ipError(-1, args, res, err)
+	}
+	addrs := splitIPAddrs(res.Stdout)
+
+	links := make([]nlops.Link, 0, len(byName))
+	for name, link := range byName {
+		link.Addrs4, link.Addrs6 = parseIntfAddrs(addrs[name])
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Index < links[j].Index })
+	return links, nil, nil
+}
+
+func (l *ipLinks) routes(ctx context.Context, resPath string) ([]nlops.Route, diag.Diagnostics, error) {
+	var routes []nlops.Route
+	for _, family := range []string{"-4", "-6"} {
+		args := []string{family, "-j", "route", "show", "table", "all"}
+		res, err := l.conf.Exec.Run(ctx, resPath, l.ipCmd, append(l.ipArgs, args...)...)
+		if err != nil {
+			return nil, res.Diagnostics(), ipError(-1, args, res, err)
+		}
+		r, err := parseIPRoutes(res.Stdout, family == "-6")
+		if err != nil {
+			return nil, res.Diagnostics(), err
+		}
+		routes = append(routes, r...)
+	}
+	return routes, nil, nil
+}
+
+func (l *ipLinks) rules(ctx context.Context, resPath string) ([]nlops.Rule, diag.Diagnostics, error) {
+	var rules []nlops.Rule
+	for _, family := range []string{"-4", "-6"} {
+		args := []string{family, "-j", "rule", "show"}
+		res, err := l.conf.Exec.Run(ctx, resPath, l.ipCmd, append(l.ipArgs, args...)...)
+		if err != nil {
+			return nil, res.Diagnostics(), ipError(-1, args, res, err)
+		}
+		r, err := parseIPRules(res.Stdout, family == "-6")
+		if err != nil {
+			return nil, res.Diagnostics(), err
+		}
+		rules = append(rules, r...)
+	}
+	return rules, nil, nil
+}
+
+// ipLinkRegex matches a line of `ip -o link show`, e.g.
+// "7: eth1.10@eth1: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 ... master br0 ...\    link/ether 02:...".
+var (
+	ipLinkRegex       = regexp.MustCompile(`^(\d+):\s+([^:@\s]+)(?:@(\S*))?:\s+<[^>]*>`)
+	ipLinkMTURegex    = regexp.MustCompile(`\smtu (\d+)`)
+	ipLinkMasterRegex = regexp.MustCompile(`\smaster (\S+)`)
+	ipLinkMACRegex    = regexp.MustCompile(`link/ether\s+([0-9a-fA-F:]+)`)
+	ipLinkStateRegex  = regexp.MustCompile(`\sstate ([A-Z]+)`)
+	// Only in the details (`ip -d`), the parent of a veth in another
+	// namespace is reported as "@if<index>".
+	ipLinkParentNSRegex = regexp.MustCompile(`^if\d+$`)
+	ipLinkVlanIDRegex   = regexp.MustCompile(`\svlan protocol \S+ id (\d+)`)
+	// Only in the details (`ip -d`) of a bridge.
+	ipLinkVlanFilteringRegex = regexp.MustCompile(`\svlan_filtering (\d)`)
+	ipLinkDefaultPVIDRegex   = regexp.MustCompile(`\svlan_default_pvid (\d+)`)
+)
+
+// ipAddrLinkRegex matches the link name of a line of `ip -o addr show`, e.g.
+// "4: eth1.10@eth1    inet 10.1.0.1/24 brd 10.1.0.255 scope global eth1.10\ ...".
+var ipAddrLinkRegex = regexp.MustCompile(`^\d+:\s+([^:@\s]+)(?:@\S*)?\s`)
+
+// splitIPAddrs splits the output of `ip -o addr show`, one line per address,
+// by link name, for parseIntfAddrs.
+func splitIPAddrs(out string) map[string]string {
+	byLink := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if m := ipAddrLinkRegex.FindStringSubmatch(line); m != nil {
+			byLink[m[1]] += line + "\n"
+		}
+	}
+	return byLink
+}
+
+// parseIPLinks parses the output of `ip -o link show` into links by name,
+// with their members. Addresses are not part of it.
+func parseIPLinks(out string) (map[string]nlops.Link, error) {
+	links := make(map[string]nlops.Link)
+	var order []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := ipLinkRegex.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("can't parse link details, unexpected output: %q", line)
+		}
+		link := nlops.Link{Name: m[2], Up: linkFlagUp(line)}
+		link.Index, _ = strconv.Atoi(m[1])
+		if m[3] != "" && m[3] != "NONE" && !ipLinkParentNSRegex.MatchString(m[3]) {
+			link.Parent = m[3]
+		}
+		if mm := ipLinkStateRegex.FindStringSubmatch(line); mm != nil {
+			link.OperState = strings.ToLower(mm[1])
+		}
+		link.Type = ipLinkKind(line)
+		if mm := ipLinkVlanIDRegex.FindStringSubmatch(line); mm != nil {
+			link.VlanID, _ = strconv.Atoi(mm[1])
+		}
+		if mm := ipLinkMTURegex.FindStringSubmatch(line); mm != nil {
+			link.MTU, _ = strconv.Atoi(mm[1])
+		}
+		if mm := ipLinkMasterRegex.FindStringSubmatch(line); mm != nil {
+			link.Master = mm[1]
+		}
+		if mm := ipLinkMACRegex.FindStringSubmatch(line); mm != nil {
+			link.MAC = mm[1]
+		}
+		if mm := ipLinkVlanFilteringRegex.FindStringSubmatch(line); mm != nil {
+			on := mm[1] == "1"
+			link.VlanFiltering = &on
+		}
+		if mm := ipLinkDefaultPVIDRegex.FindStringSubmatch(line); mm != nil {
+			pvid, _ := strconv.Atoi(mm[1])
+			link.DefaultPVID = &pvid
+		}
+		links[link.Name] = link
+		order = append(order, link.Name)
+	}
+
+	for _, name := range order {
+		if master := links[name].Master; master != "" {
+			if ml, ok := links[master]; ok {
+				ml.Members = append(ml.Members, name)
+				links[master] = ml
+			}
+		}
+	}
+	return links, nil
+}
+
+// ipLinkKind returns the kind of the link of a line of `ip -d -o link show`,
+// the first word of the details following the link/ line (e.g. "\    veth
+// \    bridge_slave state ..."), "device" when there is none. Without the
+// details it is unknown, "".
+func ipLinkKind(line string) string {
+	if !strings.Contains(line, " promiscuity ") {
+		return ""
+	}
+	segs := strings.Split(line, `\    `)
+	if len(segs) < 3 {
+		return "device"
+	}
+	fields := strings.Fields(segs[2])
+	switch {
+	case len(fields) == 0 || strings.HasSuffix(fields[0], "_slave") || fields[0] == "addrgenmode":
+		return "device"
+	case fields[0] == "tun" && strings.Contains(segs[2], " type tap"):
+		return nlops.TypeTAP
+	}
+	return fields[0]
+}
+
+// tunnelArgs returns the `ip link add` arguments of a vxlan or gretap link.
+func tunnelArgs(op nlops.Op) []string {
+	t := nlops.Tunnel{}
+	if op.Tunnel != nil {
+		t = *op.Tunnel
+	}
+	typ := op.Type
+	if typ == nlops.TypeGretap && strings.Contains(t.Remote, ":") {
+		typ = "ip6gretap"
+	}
+	args := []string{"link", "add", op.Name, "type", typ}
+	if op.Type == nlops.TypeVXLAN {
+		args = append(args, "id", strconv.Itoa(t.ID))
+	} else if t.ID > 0 {
+		args = append(args, "key", strconv.Itoa(t.ID))
+	}
+	if t.Remote != "" {
+		args = append(args, "remote", t.Remote)
+	} else if t.Group != "" {
+		args = append(args, "group", t.Group)
+	}
+	if t.Local != "" {
+		args = append(args, "local", t.Local)
+	}
+	if op.Parent != "" {
+		args = append(args, "dev", op.Parent)
+	}
+	if op.Type == nlops.TypeVXLAN && t.DstPort > 0 {
+		args = append(args, "dstport", strconv.Itoa(t.DstPort))
+	}
+	if t.TTL > 0 {
+		args = append(args, "ttl", strconv.Itoa(t.TTL))
+	}
+	return args
+}
+
+// bridgeOptArgs returns the `ip link ... type bridge` arguments of the bridge
+// VLAN options of op.
+func bridgeOptArgs(op nlops.Op) []string {
+	var args []string
+	if op.VlanFiltering != nil {
+		on := "0"
+		if *op.VlanFiltering {
+			on = "1"
+		}
+		args = append(args, "vlan_filtering", on)
+	}
+	if op.DefaultPVID != nil {
+		args = append(args, "vlan_default_pvid", strconv.Itoa(*op.DefaultPVID))
+	}
+	return args
+}
+
+// bridgeVlanArgs translates a bridge VLAN op into `bridge vlan` commands, one
+// per VLAN.
+func bridgeVlanArgs(op nlops.Op) [][]string {
+	var cmds [][]string
+	for _, v := range op.Vlans {
+		var args []string
+		if op.Kind == nlops.OpBridgeVlanAdd {
+			args = []string{"vlan", "add", "dev", op.Name, "vid", strconv.Itoa(v.VID)}
+			if v.PVID {
+				args = append(args, "pvid")
+			}
+			if v.Untagged {
+				args = append(args, "untagged")
+			}
+		} else {
+			args = []string{"vlan", "del", "dev", op.Name, "vid", strconv.Itoa(v.VID)}
+		}
+		if op.Self {
+			args = append(args, "self")
+		}
+		cmds = append(cmds, args)
+	}
+	return cmds
+}
+
+// parseBridgeVlans parses the output of `bridge -j vlan show dev <intf>`, e.g.
+// `[{"ifname":"tap0","vlans":[{"vlan":10,"flags":["PVID","Egress Untagged"]},{"vlan":20}]}]`.
+// VLAN ranges are expanded.
+func parseBridgeVlans(out string) ([]nlops.BridgeVlan, error) {
+	var devs []struct {
+		Vlans []struct {
+			Vlan    int      `json:"vlan"`
+			VlanEnd int      `json:"vlanEnd"`
+			Flags   []string `json:"flags"`
+		} `json:"vlans"`
+	}
+	if err := json.Unmarshal([]byte(out), &devs); err != nil {
+		return nil, fmt.Errorf("can't parse bridge VLANs, unexpected output %q: %w", out, err)
+	}
+	var vlans []nlops.BridgeVlan
+	for _, dev := range devs {
+		for _, v := range dev.Vlans {
+			bv := nlops.BridgeVlan{VID: v.Vlan, PVID: slices.Contains(v.Flags, "PVID"), Untagged: slices.Contains(v.Flags, "Egress Untagged")}
+			for vid := v.Vlan; vid <= max(v.Vlan, v.VlanEnd); vid++ {
+				bv.VID = vid
+				vlans = append(vlans, bv)
+			}
+		}
+	}
+	sort.Slice(vlans, func(i, j int) bool { return vlans[i].VID < vlans[j].VID })
+	return vlans, nil
+}
+
+// routeArgs returns the `ip route` command of a route op. Adding replaces the
+// route with the same destination, table and metric.
+func routeArgs(kind string, r nlops.Route) []string {
+	args := []string{"route", "replace", r.Dst}
+	if kind == nlops.OpRouteDel {
+		args = []string{"route", "del", r.Dst}
+	} else {
+		if r.Gateway != "" {
+			args = append(args, "via", r.Gateway)
+		}
+		if r.Dev != "" {
+			args = append(args, "dev", r.Dev)
+		}
+		if r.Src != "" {
+			args = append(args, "src", r.Src)
+		}
+	}
+	if r.Metric > 0 {
+		args = append(args, "metric", strconv.Itoa(r.Metric))
+	}
+	if r.Table > 0 {
+		args = append(args, "table", strconv.Itoa(r.Table))
+	}
+	return args
+}
+
+// ruleArgs returns the `ip rule` command of a rule op.
+func ruleArgs(kind string, r nlops.Rule) []string {
+	family := "-4"
+	if r.Family == 6 {
+		family = "-6"
+	}
+	action := "add"
+	if kind == nlops.OpRuleDel {
+		action = "del"
+	}
+	args := []string{family, "rule", action}
+	if r.Priority >= 0 {
+		args = append(args, "priority", strconv.Itoa(r.Priority))
+	}
+	if r.From != "" {
+		args = append(args, "from", r.From)
+	}
+	if r.To != "" {
+		args = append(args, "to", r.To)
+	}
+	if r.IIF != "" {
+		args = append(args, "iif", r.IIF)
+	}
+	if r.OIF != "" {
+		args = append(args, "oif", r.OIF)
+	}
+	if r.FwMark != 0 || r.FwMask != 0 {
+		mark := fmt.Sprintf("0x%x", r.FwMark)
+		if r.FwMask != 0 {
+			mark += fmt.Sprintf("/0x%x", r.FwMask)
+		}
+		args = append(args, "fwmark", mark)
+	}
+	return append(args, "table", strconv.Itoa(r.Table))
+}
+
+// ipTableIDs are the routing tables `ip` reports by name, see
+// /etc/iproute2/rt_tables.
+var ipTableIDs = map[string]int{"": 254, "main": 254, "default": 253, "local": 255}
+
+// ipTableID returns the ID of a routing table reported by `ip`. Names of
+// tables only known to the rt_tables of the target are not.
+func ipTableID(table string) (int, bool) {
+	if id, ok := ipTableIDs[table]; ok {
+		return id, true
+	}
+	id, err := strconv.Atoi(table)
+	return id, err == nil
+}
+
+// ipPrefix returns the prefix dst/dstLen reported by `ip` in CIDR format, a
+// host (no length) or "default" included.
+func ipPrefix(dst string, dstLen int, v6 bool) string {
+	bits := 32
+	if v6 {
+		bits = 128
+	}
+	switch {
+	case dst == "default" || dst == "all":
+		dst, dstLen = "0.0.0.0", 0
+		if v6 {
+			dst = "::"
+		}
+	case strings.Contains(dst, "/"):
+		return dst
+	case dstLen == 0:
+		dstLen = bits
+	}
+	return fmt.Sprintf("%s/%d", dst, dstLen)
+}
+
+// parseIPRoutes parses the output of `ip -4|-6 -j route show table all`, e.g.
+// `[{"dst":"default","gateway":"10.9.0.254","dev":"d0","table":"100","flags":[]}]`.
+// The routes of the local table are left out.
+func parseIPRoutes(out string, v6 bool) ([]nlops.Route, error) {
+	var all []struct {
+		Dst     string `json:"dst"`
+		Gateway string `json:"gateway"`
+		Dev     string `json:"dev"`
+		Prefsrc string `json:"prefsrc"`
+		Metric  int    `json:"metric"`
+		Table   string `json:"table"`
+	}
+	if err := json.Unmarshal([]byte(out), &all); err != nil {
+		return nil, fmt.Errorf("can't parse routes, unexpected output %q: %w", out, err)
+	}
+	var routes []nlops.Route
+	for _, r := range all {
+		table, ok := ipTableID(r.Table)
+		if !ok || table == 255 {
+			continue
+		}
+		routes = append(routes, nlops.Route{
+			Dst:     ipPrefix(r.Dst, 0, v6),
+			Gateway: r.Gateway,
+			Dev:     r.Dev,
+			Src:     r.Prefsrc,
+			Metric:  r.Metric,
+			Table:   table,
+		})
+	}
+	return routes, nil
+}
+
+// parseIPRules parses the output of `ip -4|-6 -j rule show`, e.g.
+// `[{"priority":100,"src":"10.9.0.0","srclen":24,"fwmark":"0x10","iif":"d0","table":"100"}]`.
+// Rules with another action than looking up a table are left out.
+func parseIPRules(out string, v6 bool) ([]nlops.Rule, error) {
+	var all []struct {
+		Priority int    `json:"priority"`
+		Src      string `json:"src"`
+		SrcLen   int    `json:"srclen"`
+		Dst      string `json:"dst"`
+		DstLen   int    `json:"dstlen"`
+		IIF      string `json:"iif"`
+		OIF      string `json:"oif"`
+		FwMark   string `json:"fwmark"`
+		FwMask   string `json:"fwmask"`
+		Table    string `json:"table"`
+	}
+	if err := json.Unmarshal([]byte(out), &all); err != nil {
+		return nil, fmt.Errorf("can't parse routing policy rules, unexpected output %q: %w", out, err)
+	}
+	var rules []nlops.Rule
+	for _, r := range all {
+		if r.Table == "" {
+			continue
+		}
+		table, ok := ipTableID(r.Table)
+		if !ok {
+			continue
+		}
+		rule := nlops.Rule{Family: 4, Priority: r.Priority, IIF: r.IIF, OIF: r.OIF, Table: table}
+		if v6 {
+			rule.Family = 6
+		}
+		if r.Src != "" && r.Src != "all" {
+			rule.From = ipPrefix(r.Src, r.SrcLen, v6)
+		}
+		if r.Dst != "" && r.Dst != "all" {
+			rule.To = ipPrefix(r.Dst, r.DstLen, v6)
+		}
+		if r.FwMark != "" {
+			mark, err := strconv.ParseUint(r.FwMark, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse routing policy rule fwmark %q: %w", r.FwMark, err)
+			}
+			rule.FwMark = uint32(mark)
+		}
+		if r.FwMask != "" && r.FwMask != "0xffffffff" {
+			mask, err := strconv.ParseUint(r.FwMask, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse routing policy rule fwmask %q: %w", r.FwMask, err)
+			}
+			rule.FwMask = uint32(mask)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
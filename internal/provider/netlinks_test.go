@@ -0,0 +1,398 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/cmd/result"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+const testLinkShow = `1: lo: <LOOPBACK> mtu 65536 qdisc noop state DOWN mode DEFAULT group default qlen 1000\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+2: br0: <NO-CARRIER,BROADCAST,MULTICAST,UP> mtu 1400 qdisc noqueue state DOWN mode DEFAULT group default \    link/ether 02:00:00:00:00:01 brd ff:ff:ff:ff:ff:ff
+3: tap0: <NO-CARRIER,BROADCAST,MULTICAST,UP> mtu 1500 qdisc pfifo_fast master br0 state DOWN mode DEFAULT group default qlen 1000\    link/ether f6:8e:de:03:88:9f brd ff:ff:ff:ff:ff:ff
+4: eth1.10@eth1: <BROADCAST,MULTICAST> mtu 1500 qdisc noop master br0 state DOWN mode DEFAULT group default qlen 1000\    link/ether 02:00:00:00:00:02 brd ff:ff:ff:ff:ff:ff
+`
+
+func TestParseIPLinks(t *testing.T) {
+	is := is.New(t)
+	links, err := parseIPLinks(testLinkShow)
+	is.NoErr(err)
+	is.Equal(len(links), 4)
+
+	br := links["br0"]
+	is.Equal(br.Index, 2)
+	is.Equal(br.MTU, 1400)
+	is.True(br.Up) // admin state, regardless of carrier
+	is.Equal(br.MAC, "02:00:00:00:00:01")
+	is.Equal(br.Members, []string{"tap0", "eth1.10"})
+
+	vlan := links["eth1.10"] // the @parent suffix is not part of the name
+	is.Equal(vlan.Master, "br0")
+	is.True(!vlan.Up)
+
+	_, err = parseIPLinks("garbage\n")
+	is.True(err != nil)
+}
+
+func TestIPOpArgs(t *testing.T) {
+	is := is.New(t)
+
+	cmds, err := ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "eth1.10", Type: nlops.TypeVLAN, Parent: "eth1", VlanID: 10})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "link", "eth1", "name", "eth1.10", "type", "vlan", "id", "10"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "tap0", Type: nlops.TypeTAP, Owner: "1000"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"tuntap", "add", "dev", "tap0", "mode", "tap", "user", "1000"}})
+
+	// A link set is split into one command per attribute, in apply order.
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkSet, Name: "eth1", MTU: 9000, Master: "br0", State: "up"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{
+		{"link", "set", "dev", "eth1", "mtu", "9000"},
+		{"link", "set", "dev", "eth1", "master", "br0"},
+		{"link", "set", "dev", "eth1", "up"},
+	})
+
+	_, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "x", Type: "dummy"})
+	is.True(err != nil)
+}
+
+func TestIPError(t *testing.T) {
+	is := is.New(t)
+	args := []string{"link", "add", "br0", "type", "bridge"}
+
+	err := ipError(0, args, result.Result{}, errors.New("RTNETLINK answers: File exists"))
+	is.True(errors.Is(err, nlops.ErrExist))
+
+	err = ipError(0, args, result.Result{}, errors.New(`Cannot find device "br0"`))
+	is.True(errors.Is(err, nlops.ErrNotFound))
+
+	err = ipError(0, args, result.Result{}, errors.New("RTNETLINK answers: Device or resource busy"))
+	is.True(errors.Is(err, nlops.ErrBusy))
+
+	err = ipError(0, args, result.Result{}, errors.New("something else"))
+	is.True(!errors.Is(err, nlops.ErrExist))
+	is.True(!errors.Is(err, nlops.ErrNotFound))
+}
+
+func TestIPOpDone(t *testing.T) {
+	is := is.New(t)
+	notFound := &nlops.Error{Errno: "ENODEV"}
+
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpLinkDel, Name: "br0"}, notFound))
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpLinkSet, Name: "tap0", NoMaster: true}, notFound))
+	// Only a bare release tolerates a missing link.
+	is.True(!ipOpDone(nlops.Op{Kind: nlops.OpLinkSet, Name: "tap0", NoMaster: true, State: "down"}, notFound))
+	is.True(!ipOpDone(nlops.Op{Kind: nlops.OpLinkAdd, Name: "br0"}, &nlops.Error{Errno: "EEXIST"}))
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpAddrAdd, Name: "br0"}, &nlops.Error{Errno: "EEXIST"}))
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpAddrDel, Name: "br0"}, &nlops.Error{Errno: "EADDRNOTAVAIL"}))
+}
+
+func TestIntfAddrOps(t *testing.T) {
+	is := is.New(t)
+
+	ops, err := intfAddrOps("br0", types.StringValue("10.0.0.1/24"), types.StringValue("10.0.1.1/24"))
+	is.NoErr(err)
+	is.Equal(ops, []nlops.Op{
+		{Kind: nlops.OpAddrDel, Name: "br0", Addr: "10.0.0.1/24"},
+		{Kind: nlops.OpAddrAdd, Name: "br0", Addr: "10.0.1.1/24"},
+	})
+
+	ops, err = intfAddrOps("br0", types.StringNull(), types.StringNull())
+	is.NoErr(err)
+	is.Equal(len(ops), 0)
+
+	_, err = intfAddrOps("br0", types.StringNull(), types.StringValue("10.0.0.1"))
+	is.True(err != nil)
+
+	// An unchanged MAC only re-adds its link-local address.
+	ops, err = linkLocalOps("br0", "02:00:00:00:00:01", "02:00:00:00:00:01")
+	is.NoErr(err)
+	is.Equal(ops, []nlops.Op{{Kind: nlops.OpAddrAdd, Name: "br0", Addr: "fe80::ff:fe00:1/64"}})
+}
+
+func TestManagedMembers(t *testing.T) {
+	is := is.New(t)
+	cur, _ := types.SetValueFrom(t.Context(), types.StringType, []string{"eth1", "eth2"})
+
+	// Members released behind our back drop out, foreign ones are not added.
+	got, diags := managedMembers(cur, nlops.Link{Members: []string{"eth1", "eth3"}})
+	is.True(!diags.HasError())
+	want, _ := types.SetValueFrom(t.Context(), types.StringType, []string{"eth1"})
+	is.True(got.Equal(want))
+
+	got, _ = managedMembers(types.SetNull(types.StringType), nlops.Link{Members: []string{"eth1"}})
+	is.True(got.IsNull())
+}
+
+func TestParseIPLinksBridgeDetails(t *testing.T) {
+	is := is.New(t)
+	out := `2: br0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default qlen 1000\    link/ether 02:00:00:00:00:01 brd ff:ff:ff:ff:ff:ff promiscuity 0 \    bridge forward_delay 1500 hello_time 200 max_age 2000 ageing_time 30000 stp_state 0 priority 32768 vlan_filtering 1 vlan_protocol 802.1Q bridge_id 8000.2:0:0:0:0:1 vlan_default_pvid 1 vlan_stats_enabled 0 addrgenmode eui64
+3: tap0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc fq_codel master br0 state UP mode DEFAULT group default qlen 1000\    link/ether f6:8e:de:03:88:9f brd ff:ff:ff:ff:ff:ff promiscuity 1 \    tun type tap pi off vnet_hdr off persist on \    bridge_slave state forwarding priority 32 cost 100 vlan_tunnel off isolated off addrgenmode eui64
+`
+	links, err := parseIPLinks(out)
+	is.NoErr(err)
+	br := links["br0"]
+	is.True(br.VlanFiltering != nil && *br.VlanFiltering)
+	is.True(br.DefaultPVID != nil && *br.DefaultPVID == 1)
+	is.True(links["tap0"].VlanFiltering == nil) // only bridges carry it
+	is.Equal(links["tap0"].Master, "br0")
+}
+
+func TestParseIPLinksKinds(t *testing.T) {
+	is := is.New(t)
+	out := `1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00 promiscuity 0  allmulti 0 minmtu 0 maxmtu 0 addrgenmode eui64 numtxqueues 1
+3: v1@v0: <BROADCAST,MULTICAST,M-DOWN> mtu 1500 qdisc noop state DOWN mode DEFAULT group default qlen 1000\    link/ether 9e:08:45:eb:61:ab brd ff:ff:ff:ff:ff:ff promiscuity 0  allmulti 0 minmtu 68 maxmtu 65535 \    veth addrgenmode eui64 numtxqueues 1
+4: v0@v1: <BROADCAST,MULTICAST,M-DOWN> mtu 1500 qdisc noop master br0 state DOWN mode DEFAULT group default qlen 1000\    link/ether 42:cf:fb:ed:b6:f2 brd ff:ff:ff:ff:ff:ff promiscuity 1  allmulti 1 minmtu 68 maxmtu 65535 \    veth \    bridge_slave state disabled priority 32 cost 2 addrgenmode eui64
+5: tap0: <BROADCAST,MULTICAST> mtu 1500 qdisc noop state DOWN mode DEFAULT group default qlen 1000\    link/ether da:c0:1a:ca:09:20 brd ff:ff:ff:ff:ff:ff promiscuity 0  allmulti 0 minmtu 68 maxmtu 65521 \    tun type tap pi off vnet_hdr off persist on addrgenmode eui64
+6: eth0@if12: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default qlen 1000\    link/ether fa:bc:80:6c:7e:42 brd ff:ff:ff:ff:ff:ff link-netnsid 0 promiscuity 0  allmulti 0 minmtu 68 maxmtu 65535 \    veth addrgenmode eui64
+7: eth0.10@eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state LOWERLAYERDOWN mode DEFAULT group default qlen 1000\    link/ether fa:bc:80:6c:7e:42 brd ff:ff:ff:ff:ff:ff promiscuity 0  allmulti 0 minmtu 0 maxmtu 65535 \    vlan protocol 802.1Q id 10 <REORDER_HDR> addrgenmode eui64
+`
+	links, err := parseIPLinks(out)
+	is.NoErr(err)
+	is.Equal(links["lo"].Type, "device")
+	is.Equal(links["lo"].OperState, "unknown")
+	is.Equal(links["v1"].Type, nlops.TypeVeth)
+	is.Equal(links["v1"].Parent, "v0")         // the peer, in the same netns
+	is.Equal(links["v0"].Type, nlops.TypeVeth) // not the bridge_slave details
+	is.Equal(links["tap0"].Type, nlops.TypeTAP)
+	is.Equal(links["tap0"].OperState, "down")
+	is.Equal(links["eth0"].Parent, "") // the peer is in another netns
+	vlan := links["eth0.10"]
+	is.Equal(vlan.Type, nlops.TypeVLAN)
+	is.Equal(vlan.Parent, "eth0")
+	is.Equal(vlan.VlanID, 10)
+	is.Equal(vlan.OperState, "lowerlayerdown")
+
+	// Without the -d details the kind is unknown.
+	links, err = parseIPLinks(testLinkShow)
+	is.NoErr(err)
+	is.Equal(links["br0"].Type, "")
+}
+
+func TestBridgeOptArgs(t *testing.T) {
+	is := is.New(t)
+	on, pvid := true, 0
+
+	cmds, err := ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "br0", Type: nlops.TypeBridge, VlanFiltering: &on, DefaultPVID: &pvid})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "br0", "type", "bridge", "vlan_filtering", "1", "vlan_default_pvid", "0"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkSet, Name: "br0", VlanFiltering: &on, State: "up"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{
+		{"link", "set", "dev", "br0", "type", "bridge", "vlan_filtering", "1"},
+		{"link", "set", "dev", "br0", "up"},
+	})
+}
+
+func TestBridgeVlanArgs(t *testing.T) {
+	is := is.New(t)
+
+	cmds := bridgeVlanArgs(nlops.Op{Kind: nlops.OpBridgeVlanAdd, Name: "tap0", Vlans: []nlops.BridgeVlan{
+		{VID: 10, PVID: true, Untagged: true},
+		{VID: 20},
+	}})
+	is.Equal(cmds, [][]string{
+		{"vlan", "add", "dev", "tap0", "vid", "10", "pvid", "untagged"},
+		{"vlan", "add", "dev", "tap0", "vid", "20"},
+	})
+
+	cmds = bridgeVlanArgs(nlops.Op{Kind: nlops.OpBridgeVlanDel, Name: "br0", Self: true, Vlans: []nlops.BridgeVlan{{VID: 1, PVID: true}}})
+	is.Equal(cmds, [][]string{{"vlan", "del", "dev", "br0", "vid", "1", "self"}})
+
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpBridgeVlanDel, Name: "tap0"}, &nlops.Error{Errno: "ENOENT"}))
+}
+
+func TestParseBridgeVlans(t *testing.T) {
+	is := is.New(t)
+
+	vlans, err := parseBridgeVlans(`[{"ifname":"tap0","vlans":[{"vlan":20},{"vlan":1,"flags":["PVID","Egress Untagged"]},{"vlan":30,"vlanEnd":32}]}]`)
+	is.NoErr(err)
+	is.Equal(vlans, []nlops.BridgeVlan{
+		{VID: 1, PVID: true, Untagged: true},
+		{VID: 20},
+		{VID: 30}, {VID: 31}, {VID: 32},
+	})
+
+	vlans, err = parseBridgeVlans("[]")
+	is.NoErr(err)
+	is.Equal(len(vlans), 0)
+
+	_, err = parseBridgeVlans("tap0 1 PVID Egress Untagged")
+	is.True(err != nil)
+}
+
+func TestIPOpArgsVeth(t *testing.T) {
+	is := is.New(t)
+
+	// Both ends are placed by name, the command runs in the default namespace.
+	cmds, err := ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "v-isp", NetNS: "isp", Type: nlops.TypeVeth, Peer: "v-lan", PeerNetNS: "lan"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "v-isp", "netns", "isp", "type", "veth", "peer", "name", "v-lan", "netns", "lan"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "h0", Type: nlops.TypeVeth, Peer: "h1"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "h0", "type", "veth", "peer", "name", "h1"}})
+}
+
+func TestIPOpArgsMacvlan(t *testing.T) {
+	is := is.New(t)
+
+	// The parent is in the default namespace, the link goes into lan.
+	cmds, err := ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "mv0", NetNS: "lan", Type: nlops.TypeMacvlan, Parent: "eth0", Mode: "bridge"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "link", "eth0", "name", "mv0", "netns", "lan", "type", "macvlan", "mode", "bridge"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "mvt0", Type: nlops.TypeMacvtap, Parent: "eth0", Mode: "passthru"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "link", "eth0", "name", "mvt0", "type", "macvtap", "mode", "passthru"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "ipv0", NetNS: "lan", Type: nlops.TypeIPVlan, Parent: "eth1", ParentNetNS: "lan", Mode: "l3s"})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "link", "eth1", "name", "ipv0", "type", "ipvlan", "mode", "l3s"}})
+
+	_, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "ipv0", Type: nlops.TypeIPVlan, Parent: "eth1", ParentNetNS: "lan"})
+	is.True(err != nil) // `ip` has no name for the default namespace
+}
+
+func TestIPOpArgsTunnel(t *testing.T) {
+	is := is.New(t)
+
+	cmds, err := ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "vx0", Type: nlops.TypeVXLAN, Parent: "eth0",
+		Tunnel: &nlops.Tunnel{ID: 42, Remote: "192.0.2.2", Local: "192.0.2.1", DstPort: 4789}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "vx0", "type", "vxlan", "id", "42", "remote", "192.0.2.2",
+		"local", "192.0.2.1", "dev", "eth0", "dstport", "4789"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "vx1", Type: nlops.TypeVXLAN, Parent: "eth0",
+		Tunnel: &nlops.Tunnel{ID: 0, Group: "239.1.1.1", TTL: 16}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "vx1", "type", "vxlan", "id", "0", "group", "239.1.1.1", "dev", "eth0", "ttl", "16"}})
+
+	// An IPv6 remote needs the ip6gretap type.
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "gt0", Type: nlops.TypeGretap,
+		Tunnel: &nlops.Tunnel{ID: 7, Remote: "2001:db8::2"}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "gt0", "type", "ip6gretap", "key", "7", "remote", "2001:db8::2"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpLinkAdd, Name: "wg0", Type: nlops.TypeWireguard})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"link", "add", "wg0", "type", "wireguard"}})
+}
+
+func TestWgCommand(t *testing.T) {
+	is := is.New(t)
+
+	l := &ipLinks{conf: &ZedAmigoProviderConfig{IP: "/sbin/ip", Wg: "/usr/bin/wg"}}
+	cmd, args := l.wgCommand("")
+	is.Equal(cmd, "/usr/bin/wg")
+	is.Equal(args, []string{})
+
+	l.conf.UseSudo, l.conf.Sudo = true, "/usr/bin/sudo"
+	cmd, args = l.wgCommand("lab")
+	is.Equal(cmd, "/usr/bin/sudo")
+	is.Equal(args, []string{"-n", "/sbin/ip", "netns", "exec", "lab", "/usr/bin/wg"})
+}
+
+func TestIPOpArgsRouteRule(t *testing.T) {
+	is := is.New(t)
+
+	cmds, err := ipOpArgs(nlops.Op{Kind: nlops.OpRouteAdd, Name: "0.0.0.0/0",
+		Route: &nlops.Route{Dst: "0.0.0.0/0", Gateway: "10.9.0.254", Dev: "eth0", Table: 100}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"route", "replace", "0.0.0.0/0", "via", "10.9.0.254", "dev", "eth0", "table", "100"}})
+
+	// Only the destination, metric and table identify the route to delete.
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpRouteDel, Name: "::/0",
+		Route: &nlops.Route{Dst: "::/0", Gateway: "fd00::fe", Metric: 1024, Table: 254}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"route", "del", "::/0", "metric", "1024", "table", "254"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpRuleAdd, Name: "lookup 100",
+		Rule: &nlops.Rule{Priority: 200, To: "10.30.0.0/16", OIF: "d0", FwMark: 16, FwMask: 255, Table: 100}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"-4", "rule", "add", "priority", "200", "to", "10.30.0.0/16", "oif", "d0",
+		"fwmark", "0x10/0xff", "table", "100"}})
+
+	cmds, err = ipOpArgs(nlops.Op{Kind: nlops.OpRuleDel, Name: "lookup 100", Rule: &nlops.Rule{Family: 6, Priority: -1, Table: 100}})
+	is.NoErr(err)
+	is.Equal(cmds, [][]string{{"-6", "rule", "del", "table", "100"}})
+
+	_, err = ipOpArgs(nlops.Op{Kind: nlops.OpRouteAdd, Name: "x"})
+	is.True(err != nil)
+
+	// A missing route or rule is already deleted, an existing rule added.
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpRouteDel}, ipError(0, nil, result.Result{}, errors.New("RTNETLINK answers: No such process"))))
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpRuleDel}, ipError(0, nil, result.Result{}, errors.New("RTNETLINK answers: No such file or directory"))))
+	is.True(ipOpDone(nlops.Op{Kind: nlops.OpRuleAdd}, ipError(0, nil, result.Result{}, errors.New("RTNETLINK answers: File exists"))))
+	is.True(!ipOpDone(nlops.Op{Kind: nlops.OpRouteAdd}, ipError(0, nil, result.Result{}, errors.New("RTNETLINK answers: File exists"))))
+}
+
+func TestParseIPRoutes(t *testing.T) {
+	is := is.New(t)
+
+	routes, err := parseIPRoutes(`[{"dst":"default","gateway":"10.9.0.254","dev":"d0","table":"100","flags":[]},`+
+		`{"dst":"10.9.0.0/24","dev":"d0","protocol":"kernel","scope":"link","prefsrc":"10.9.0.1","flags":[]},`+
+		`{"dst":"10.20.0.5","dev":"d0","scope":"link","metric":5,"flags":[]},`+
+		`{"type":"local","dst":"10.9.0.1","dev":"d0","table":"local","protocol":"kernel","scope":"host","prefsrc":"10.9.0.1","flags":[]},`+
+		`{"dst":"10.50.0.0/16","dev":"d0","table":"isp","flags":[]}]`, false)
+	is.NoErr(err)
+	is.Equal(routes, []nlops.Route{
+		{Dst: "0.0.0.0/0", Gateway: "10.9.0.254", Dev: "d0", Table: 100},
+		{Dst: "10.9.0.0/24", Dev: "d0", Src: "10.9.0.1", Table: 254},
+		{Dst: "10.20.0.5/32", Dev: "d0", Metric: 5, Table: 254},
+	})
+
+	routes, err = parseIPRoutes(`[{"dst":"default","gateway":"fd00::fe","dev":"d0","metric":1024,"flags":[],"pref":"medium"}]`, true)
+	is.NoErr(err)
+	is.Equal(routes, []nlops.Route{{Dst: "::/0", Gateway: "fd00::fe", Dev: "d0", Metric: 1024, Table: 254}})
+
+	_, err = parseIPRoutes("Error: ...", false)
+	is.True(err != nil)
+}
+
+func TestParseIPRules(t *testing.T) {
+	is := is.New(t)
+
+	rules, err := parseIPRules(`[{"priority":0,"src":"all","table":"local"},`+
+		`{"priority":100,"src":"10.9.0.0","srclen":24,"fwmark":"0x10","iif":"d0","table":"100"},`+
+		`{"priority":200,"src":"all","dst":"10.30.0.0","dstlen":16,"fwmark":"0x10","fwmask":"0xff","oif":"d0","table":"100"},`+
+		`{"priority":300,"src":"10.9.0.7","action":"unreachable"},`+
+		`{"priority":32766,"src":"all","table":"main"}]`, false)
+	is.NoErr(err)
+	is.Equal(rules, []nlops.Rule{
+		{Family: 4, Priority: 0, Table: 255},
+		{Family: 4, Priority: 100, From: "10.9.0.0/24", IIF: "d0", FwMark: 16, Table: 100},
+		{Family: 4, Priority: 200, To: "10.30.0.0/16", OIF: "d0", FwMark: 16, FwMask: 255, Table: 100},
+		{Family: 4, Priority: 32766, Table: 254},
+	})
+
+	rules, err = parseIPRules(`[{"priority":32765,"src":"fd00::1","table":"100"}]`, true)
+	is.NoErr(err)
+	is.Equal(rules, []nlops.Rule{{Family: 6, Priority: 32765, From: "fd00::1/128", Table: 100}})
+}
+
+func TestSplitIPAddrs(t *testing.T) {
+	is := is.New(t)
+
+	addrs := splitIPAddrs(`1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+1: lo    inet6 ::1/128 scope host \       valid_lft forever preferred_lft forever
+3: v0    inet 10.0.0.1/24 scope global v0\       valid_lft forever preferred_lft forever
+3: v0    inet6 fd00::1/64 scope global nodad \       valid_lft forever preferred_lft forever
+4: eth1.10@eth1    inet 10.1.0.1/24 brd 10.1.0.255 scope global eth1.10\       valid_lft forever preferred_lft forever
+`)
+	is.Equal(len(addrs), 3)
+	v4, v6 := parseIntfAddrs(addrs["v0"])
+	is.Equal(v4, []string{"10.0.0.1/24"})
+	is.Equal(v6, []string{"fd00::1/64"})
+	v4, _ = parseIntfAddrs(addrs["eth1.10"])
+	is.Equal(v4, []string{"10.1.0.1/24"})
+}
@@ -77,3 +77,17 @@ func buildIPCommand(conf *ZedAmigoProviderConfig, netns string) (string, []strin
 	}
 	return ipCmd, ipArgs
 }
+
+// buildNetNSCommand returns the command and base arguments for running
+// command, optionally inside a network namespace (through `ip netns exec`)
+// and/or with sudo, like buildIPCommand does for `ip` itself.
+func buildNetNSCommand(conf *ZedAmigoProviderConfig, netns string, command string) (string, []string) {
+	cmd, args := command, []string{}
+	if netns != "" {
+		cmd, args = conf.IP, []string{"netns", "exec", netns, command}
+	}
+	if conf.UseSudo {
+		cmd, args = conf.Sudo, append([]string{"-n", cmd}, args...)
+	}
+	return cmd, args
+}
@@ -4,24 +4,51 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/mapvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 const (
 	netnsDir = "netns"
+
+	// netnsEtcDir is where `ip netns exec` finds the files it bind-mounts
+	// over the ones of /etc, in a directory named after the namespace, see
+	// ip-netns(8).
+	netnsEtcDir = "/etc/netns"
 )
 
+// netnsEtcFiles are the files of netnsEtcDir managed by the resource, by
+// attribute.
+var netnsEtcFiles = map[string]string{
+	"resolv_conf": "resolv.conf",
+	"hosts":       "hosts",
+}
+
+// sysctlNetRegex matches the names of the sysctls of a network namespace,
+// the `net.` ones, with either separator, e.g. "net.ipv4.ip_forward" or
+// "net/ipv4/conf/eth0.10/rp_filter".
+var sysctlNetRegex = regexp.MustCompile(`^net[./][a-zA-Z0-9_./-]+$`)
+
 // Ensure provider defined types fully satisfy framework interfaces.
 var (
 	_ resource.Resource                = &NetNS{}
@@ -39,8 +66,19 @@ type NetNS struct {
 
 // NetNSModel describes the resource data model.
 type NetNSModel struct {
-	ID   types.String `tfsdk:"id"`
-	Name types.String `tfsdk:"name"`
+	ID         types.String `tfsdk:"id"`
+	Name       types.String `tfsdk:"name"`
+	LoopbackUp types.Bool   `tfsdk:"loopback_up"`
+	Sysctls    types.Map    `tfsdk:"sysctls"`
+	ResolvConf types.String `tfsdk:"resolv_conf"`
+	Hosts      types.String `tfsdk:"hosts"`
+	Interfaces types.List   `tfsdk:"interfaces"`
+}
+
+// etcFiles returns the contents of the files of the namespace in
+// netnsEtcDir by attribute, null when not managed.
+func (m *NetNSModel) etcFiles() map[string]types.String {
+	return map[string]types.String{"resolv_conf": m.ResolvConf, "hosts": m.Hosts}
 }
 
 func (r *NetNS) getResourceDir(id string) string {
@@ -53,8 +91,15 @@ func (r *NetNS) Metadata(ctx context.Context, req resource.MetadataRequest, resp
 
 func (r *NetNS) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
 	resp.Schema = schema.Schema{
-		Description:         "Network namespace",
-		MarkdownDescription: "Create and manage a Linux network namespace using iproute2 commands.",
+		Description: "Network namespace",
+		MarkdownDescription: undent.Md(`
+		Create and manage a Linux network namespace through netlink or iproute2 commands (see the
+		provider |network_backend|), with its loopback interface up, its |sysctls| set and its own
+		|/etc/resolv.conf| and |/etc/hosts| for the commands run with |ip netns exec|: the usual
+		setup of a namespace used as a router or an ISP simulation.
+
+		The settings are changed in place, and restored on refresh when changed outside of
+		Terraform. A sysctl removed from |sysctls| keeps its current value.`),
 
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
@@ -72,6 +117,39 @@ func (r *NetNS) Schema(ctx context.Context, req resource.SchemaRequest, resp *re
 					stringplanmodifier.RequiresReplace(),
 				},
 			},
+			"loopback_up": schema.BoolAttribute{
+				Description: "Bring the loopback interface `lo` of the namespace up. Default: `true`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(true),
+			},
+			"sysctls": schema.MapAttribute{
+				Description: "Network sysctls of the namespace, e.g. `\"net.ipv4.ip_forward\" = \"1\"`, " +
+					"`\"net.ipv6.conf.all.accept_ra\" = \"0\"` or `\"net.ipv4.conf.all.rp_filter\" = \"2\"`. " +
+					"The ones of an interface (`net.ipv4.conf.<intf>.*`) need the interface to be in the " +
+					"namespace already, prefer the `all` and `default` ones.",
+				ElementType: types.StringType,
+				Optional:    true,
+				Validators: []validator.Map{
+					mapvalidator.KeysAre(stringvalidator.RegexMatches(sysctlNetRegex,
+						"must be a network sysctl, starting with `net.`")),
+				},
+			},
+			"resolv_conf": schema.StringAttribute{
+				Description: "Contents of the `/etc/resolv.conf` of the commands run in the namespace with " +
+					"`ip netns exec` (written to `/etc/netns/<name>/resolv.conf`)",
+				Optional: true,
+			},
+			"hosts": schema.StringAttribute{
+				Description: "Contents of the `/etc/hosts` of the commands run in the namespace with " +
+					"`ip netns exec` (written to `/etc/netns/<name>/hosts`)",
+				Optional: true,
+			},
+			"interfaces": schema.ListAttribute{
+				Computed:    true,
+				Description: "Names of the interfaces in the namespace, `lo` included, ordered by index",
+				ElementType: types.StringType,
+			},
 		},
 	}
 }
@@ -127,20 +205,34 @@ func (r *NetNS) Create(ctx context.Context, req resource.CreateRequest, resp *re
 
 	nsName := data.Name.ValueString()
 
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
+	// Create the network namespace.
+	if diags, err := newNetLinks(r.providerConf, "").apply(ctx, d, nlops.Op{Kind: nlops.OpNetNSAdd, Name: nsName}); err != nil {
+		resp.Diagnostics.AddError("NetNS Resource Error",
+			fmt.Sprintf("Unable to create a new network namespace: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
-	// Create the network namespace.
-	moreArgs := []string{"netns", "add", nsName}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
+	// A new namespace has its loopback interface down and nothing else
+	// configured.
+	old := NetNSModel{
+		Name:       data.Name,
+		LoopbackUp: types.BoolValue(false),
+		Sysctls:    types.MapNull(types.StringType),
+		ResolvConf: types.StringNull(),
+		Hosts:      types.StringNull(),
+	}
+	nl := newNetLinks(r.providerConf, nsName)
+	if diags, err := r.applyNetNS(ctx, d, nl, &old, &data); err != nil {
 		resp.Diagnostics.AddError("NetNS Resource Error",
-			"Unable to create a new network namespace.")
-		resp.Diagnostics.Append(res.Diagnostics()...)
+			fmt.Sprintf("Unable to configure the network namespace: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readNetNS(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read NetNS state", err.Error())
+		resp.Diagnostics.Append(diags...)
 		return
 	}
 
@@ -158,46 +250,67 @@ func (r *NetNS) Read(ctx context.Context, req resource.ReadRequest, resp *resour
 	}
 
 	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.Name.ValueString())
 
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
-	}
+	prior := data
+	if diags, err := r.readNetNS(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// Namespace was deleted outside Terraform: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
 
-	// List network namespaces and check if ours exists.
-	moreArgs := []string{"netns", "list"}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
 		resp.Diagnostics.AddError("NetNS Resource Error",
-			fmt.Sprintf("Unable to list network namespaces: %s", err))
-		resp.Diagnostics.Append(res.Diagnostics()...)
+			fmt.Sprintf("Unable to check the network namespace: %s", err))
+		resp.Diagnostics.Append(diags...)
 		return
 	}
 
-	nsName := data.Name.ValueString()
-	found := false
-	for _, line := range strings.Split(res.Stdout, "\n") {
-		// ip netns list output format: "name (id: N)" or just "name"
-		fields := strings.Fields(line)
-		if len(fields) > 0 && fields[0] == nsName {
-			found = true
-			break
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if !data.LoopbackUp.Equal(prior.LoopbackUp) || !data.Sysctls.Equal(prior.Sysctls) ||
+		!data.ResolvConf.Equal(prior.ResolvConf) || !data.Hosts.Equal(prior.Hosts) {
+		tflog.Info(ctx, "NetNS settings drifted, restoring them", map[string]any{"netns": data.Name.ValueString()})
+		if diags, err := r.applyNetNS(ctx, d, nl, &data, &prior); err != nil {
+			resp.Diagnostics.AddWarning("NetNS Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of network namespace '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else {
+			prior.Interfaces = data.Interfaces
+			data = prior
 		}
 	}
 
-	if !found {
-		// Namespace was deleted outside Terraform: remove from state.
-		resp.State.RemoveResource(ctx)
-		return
-	}
-
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
 func (r *NetNS) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	resp.Diagnostics.AddError("NetNS Resource Update Error", "Update is not supported.")
+	var plan NetNSModel
+	var state NetNSModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The name is RequiresReplace, everything else is changed in place.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.Name.ValueString())
+
+	if diags, err := r.applyNetNS(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("NetNS Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readNetNS(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read NetNS state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 }
 
 func (r *NetNS) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
@@ -211,25 +324,21 @@ func (r *NetNS) Delete(ctx context.Context, req resource.DeleteRequest, resp *re
 	nsName := data.Name.ValueString()
 	d := r.getResourceDir(data.ID.ValueString())
 
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
+	// Delete the network namespace. Idempotent: if the namespace doesn't
+	// exist, the delete is successful.
+	if diags, err := newNetLinks(r.providerConf, "").apply(ctx, d, nlops.Op{Kind: nlops.OpNetNSDel, Name: nsName}); err != nil {
+		resp.Diagnostics.AddError("Failed to delete network namespace", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
-	// Delete the network namespace.
-	moreArgs := []string{"netns", "delete", nsName}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		errMsg := err.Error()
-		// Idempotent: if the namespace doesn't exist, the delete is successful.
-		if !strings.Contains(errMsg, "No such file") &&
-			!strings.Contains(errMsg, "no such file") &&
-			!strings.Contains(errMsg, "Cannot find") &&
-			!strings.Contains(errMsg, "Invalid argument") {
+	for attr, v := range data.etcFiles() {
+		if v.IsNull() {
+			continue
+		}
+		if diags, err := netnsRemoveEtcFile(ctx, r.providerConf, d, nsName, netnsEtcFiles[attr]); err != nil {
 			resp.Diagnostics.AddError("Failed to delete network namespace", err.Error())
-			resp.Diagnostics.Append(res.Diagnostics()...)
+			resp.Diagnostics.Append(diags...)
 			return
 		}
 	}
@@ -244,3 +353,204 @@ func (r *NetNS) Delete(ctx context.Context, req resource.DeleteRequest, resp *re
 func (r *NetNS) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
+
+// readNetNS reads the interfaces of the namespace and the current value of
+// the settings of model. A missing namespace is an nlops.ErrNotFound error.
+func (r *NetNS) readNetNS(ctx context.Context, resPath string, nl netLinks, model *NetNSModel) (diag.Diagnostics, error) {
+	// Every network namespace has a loopback interface.
+	links, diags, err := nl.links(ctx, resPath)
+	if err != nil {
+		return diags, err
+	}
+	var names []string
+	for _, l := range links {
+		names = append(names, l.Name)
+		if l.Name == "lo" {
+			model.LoopbackUp = types.BoolValue(l.Up)
+		}
+	}
+	list, d := types.ListValueFrom(ctx, types.StringType, names)
+	if d.HasError() {
+		return d, errors.New("can't convert the interface names")
+	}
+	model.Interfaces = list
+
+	nsName := model.Name.ValueString()
+	if !model.Sysctls.IsNull() && !model.Sysctls.IsUnknown() {
+		want, d := netnsSysctls(ctx, model.Sysctls)
+		if d.HasError() {
+			return d, errors.New("can't read the sysctls configuration")
+		}
+		cur, diags, err := readSysctls(ctx, r.providerConf, resPath, nsName, want)
+		if err != nil {
+			return diags, err
+		}
+		m, d := types.MapValueFrom(ctx, types.StringType, cur)
+		if d.HasError() {
+			return d, errors.New("can't convert the sysctls")
+		}
+		model.Sysctls = m
+	}
+
+	for attr, v := range model.etcFiles() {
+		if v.IsNull() || v.IsUnknown() {
+			continue
+		}
+		f := filepath.Join(netnsEtcDir, nsName, netnsEtcFiles[attr])
+		content, err := r.providerConf.Exec.ReadFile(ctx, f)
+		if err != nil {
+			content = nil
+		}
+		cur := types.StringValue(string(content))
+		if attr == "hosts" {
+			model.Hosts = cur
+		} else {
+			model.ResolvConf = cur
+		}
+	}
+	return nil, nil
+}
+
+// applyNetNS reconciles the settings of the namespace from old to new, for
+// Create, Update and the drift self-heal in Read.
+func (r *NetNS) applyNetNS(ctx context.Context, resPath string, nl netLinks, old, new *NetNSModel) (diag.Diagnostics, error) {
+	nsName := new.Name.ValueString()
+
+	if !new.LoopbackUp.IsUnknown() && !new.LoopbackUp.Equal(old.LoopbackUp) {
+		state := "down"
+		if new.LoopbackUp.ValueBool() {
+			state = "up"
+		}
+		if diags, err := nl.apply(ctx, resPath, nlops.Op{Kind: nlops.OpLinkSet, Name: "lo", State: state}); err != nil {
+			return diags, fmt.Errorf("can't set the loopback interface %s: %w", state, err)
+		}
+	}
+
+	if !new.Sysctls.IsNull() && !new.Sysctls.IsUnknown() && !new.Sysctls.Equal(old.Sysctls) {
+		want, d := netnsSysctls(ctx, new.Sysctls)
+		if d.HasError() {
+			return d, errors.New("can't read the sysctls configuration")
+		}
+		if diags, err := writeSysctls(ctx, r.providerConf, resPath, nsName, want); err != nil {
+			return diags, err
+		}
+	}
+
+	oldFiles := old.etcFiles()
+	for attr, v := range new.etcFiles() {
+		if v.IsUnknown() || v.Equal(oldFiles[attr]) {
+			continue
+		}
+		name := netnsEtcFiles[attr]
+		if v.IsNull() {
+			if diags, err := netnsRemoveEtcFile(ctx, r.providerConf, resPath, nsName, name); err != nil {
+				return diags, err
+			}
+			continue
+		}
+		if diags, err := netnsInstallEtcFile(ctx, r.providerConf, resPath, nsName, name, v.ValueString()); err != nil {
+			return diags, err
+		}
+	}
+	return nil, nil
+}
+
+// netnsSysctls returns the sysctls configuration m.
+func netnsSysctls(ctx context.Context, m types.Map) (map[string]string, diag.Diagnostics) {
+	sysctls := make(map[string]string)
+	diags := m.ElementsAs(ctx, &sysctls, false)
+	return sysctls, diags
+}
+
+// sysctlKeys returns the names of sysctls, sorted.
+func sysctlKeys(sysctls map[string]string) []string {
+	keys := make([]string, 0, len(sysctls))
+	for k := range sysctls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeSysctls sets sysctls in network namespace netns.
+func writeSysctls(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns string, sysctls map[string]string) (diag.Diagnostics, error) {
+	var diags diag.Diagnostics
+	if requireSysctl(conf, "zedamigo_netns", &diags); diags.HasError() {
+		return diags, errors.New("can't set the sysctls without `sysctl`")
+	}
+	cmd, args := buildNetNSCommand(conf, netns, conf.Sysctl)
+	args = append(args, "-w")
+	for _, k := range sysctlKeys(sysctls) {
+		args = append(args, k+"="+sysctls[k])
+	}
+	if res, err := conf.Exec.Run(ctx, resPath, cmd, args...); err != nil {
+		return res.Diagnostics(), fmt.Errorf("can't set the sysctls: %w", err)
+	}
+	return nil, nil
+}
+
+// readSysctls returns the current values of the sysctls of want in network
+// namespace netns. The values of the sysctls that are still set as wanted
+// are reported as configured, e.g. "0 2147483647" for a value reported with
+// a tab.
+func readSysctls(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns string, want map[string]string) (map[string]string, diag.Diagnostics, error) {
+	var diags diag.Diagnostics
+	if requireSysctl(conf, "zedamigo_netns", &diags); diags.HasError() {
+		return nil, diags, errors.New("can't read the sysctls without `sysctl`")
+	}
+	keys := sysctlKeys(want)
+	cmd, args := buildNetNSCommand(conf, netns, conf.Sysctl)
+	res, err := conf.Exec.Run(ctx, resPath, cmd, append(append(args, "-n"), keys...)...)
+	if err != nil {
+		return nil, res.Diagnostics(), fmt.Errorf("can't read the sysctls: %w", err)
+	}
+	return parseSysctls(keys, res.Stdout, want), nil, nil
+}
+
+// parseSysctls parses the output of `sysctl -n` for keys, one value per
+// line, see readSysctls.
+func parseSysctls(keys []string, out string, want map[string]string) map[string]string {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	cur := make(map[string]string, len(keys))
+	for i, k := range keys {
+		v := ""
+		if i < len(lines) {
+			v = strings.Join(strings.Fields(lines[i]), " ")
+		}
+		if v == strings.Join(strings.Fields(want[k]), " ") {
+			v = want[k]
+		}
+		cur[k] = v
+	}
+	return cur
+}
+
+// netnsInstallEtcFile installs content as file name of the /etc of network
+// namespace netns, see netnsEtcDir. The file is written in resPath first,
+// then copied with `install` (and sudo if configured).
+func netnsInstallEtcFile(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns, name, content string) (diag.Diagnostics, error) {
+	src := filepath.Join(resPath, name)
+	if err := conf.Exec.WriteFile(ctx, src, []byte(content), 0o644); err != nil {
+		return nil, fmt.Errorf("can't write '%s': %w", src, err)
+	}
+	dst := filepath.Join(netnsEtcDir, netns, name)
+	cmd, args := buildNetNSCommand(conf, "", "install")
+	if res, err := conf.Exec.Run(ctx, resPath, cmd, append(args, "-D", "-m", "0644", src, dst)...); err != nil {
+		return res.Diagnostics(), fmt.Errorf("can't install '%s': %w", dst, err)
+	}
+	return nil, nil
+}
+
+// netnsRemoveEtcFile removes file name of the /etc of network namespace
+// netns, and its directory in netnsEtcDir once empty. A missing file is not
+// an error.
+func netnsRemoveEtcFile(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns, name string) (diag.Diagnostics, error) {
+	dir := filepath.Join(netnsEtcDir, netns)
+	cmd, args := buildNetNSCommand(conf, "", "rm")
+	if res, err := conf.Exec.Run(ctx, resPath, cmd, append(args, "-f", filepath.Join(dir, name))...); err != nil {
+		return res.Diagnostics(), fmt.Errorf("can't remove '%s': %w", filepath.Join(dir, name), err)
+	}
+	cmd, args = buildNetNSCommand(conf, "", "rmdir")
+	_, _ = conf.Exec.Run(ctx, resPath, cmd, append(args, "--ignore-fail-on-non-empty", dir)...)
+	return nil, nil
+}
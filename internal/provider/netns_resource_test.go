@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseSysctls(t *testing.T) {
+	is := is.New(t)
+
+	want := map[string]string{
+		"net.ipv4.ip_forward":         "1",
+		"net.ipv4.ping_group_range":   "0 2147483647",
+		"net.ipv6.conf.all.accept_ra": "0",
+	}
+	keys := sysctlKeys(want)
+	is.Equal(keys, []string{"net.ipv4.ip_forward", "net.ipv4.ping_group_range", "net.ipv6.conf.all.accept_ra"})
+
+	// Values still set as wanted are reported as configured, whatever the
+	// whitespace; drifted ones as read.
+	cur := parseSysctls(keys, "1\n0\t2147483647\n1\n", want)
+	is.Equal(cur, map[string]string{
+		"net.ipv4.ip_forward":         "1",
+		"net.ipv4.ping_group_range":   "0 2147483647",
+		"net.ipv6.conf.all.accept_ra": "1",
+	})
+
+	is.True(sysctlNetRegex.MatchString("net/ipv4/conf/eth0.10/rp_filter"))
+	is.True(!sysctlNetRegex.MatchString("kernel.hostname"))
+}
@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// networkInterfacesDir is where the data source runs its commands, see the
+// resource directories.
+const networkInterfacesDir = "network_interfaces"
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &NetworkInterfacesDS{}
+
+func NewNetworkInterfacesDataSource() datasource.DataSource {
+	return &NetworkInterfacesDS{}
+}
+
+// NetworkInterfacesDS defines the data source implementation.
+type NetworkInterfacesDS struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// NetworkInterfacesDSModel describes the data source data model.
+type NetworkInterfacesDSModel struct {
+	ID         types.String            `tfsdk:"id"`
+	NetNS      types.String            `tfsdk:"netns"`
+	Interfaces []NetworkInterfaceModel `tfsdk:"interfaces"`
+}
+
+// NetworkInterfaceModel describes an element of `interfaces`.
+type NetworkInterfaceModel struct {
+	Name          types.String   `tfsdk:"name"`
+	Index         types.Int64    `tfsdk:"index"`
+	Kind          types.String   `tfsdk:"kind"`
+	Master        types.String   `tfsdk:"master"`
+	Parent        types.String   `tfsdk:"parent"`
+	MTU           types.Int64    `tfsdk:"mtu"`
+	MACAddress    types.String   `tfsdk:"mac_address"`
+	State         types.String   `tfsdk:"state"`
+	OperState     types.String   `tfsdk:"operstate"`
+	IPv4Addresses []types.String `tfsdk:"ipv4_addresses"`
+	IPv6Addresses []types.String `tfsdk:"ipv6_addresses"`
+	VlanID        types.Int64    `tfsdk:"vlan_id"`
+	Members       []types.String `tfsdk:"members"`
+}
+
+// newNetworkInterfaceModel returns the `interfaces` element of link.
+func newNetworkInterfaceModel(link nlops.Link) NetworkInterfaceModel {
+	optString := func(s string) types.String {
+		if s == "" {
+			return types.StringNull()
+		}
+		return types.StringValue(s)
+	}
+	strs := func(l []string) []types.String {
+		out := make([]types.String, 0, len(l))
+		for _, s := range l {
+			out = append(out, types.StringValue(s))
+		}
+		return out
+	}
+	m := NetworkInterfaceModel{
+		Name:          types.StringValue(link.Name),
+		Index:         types.Int64Value(int64(link.Index)),
+		Kind:          types.StringValue(link.Type),
+		Master:        optString(link.Master),
+		Parent:        optString(link.Parent),
+		MTU:           types.Int64Value(int64(link.MTU)),
+		MACAddress:    optString(link.MAC),
+		State:         linkState(link),
+		OperState:     optString(link.OperState),
+		IPv4Addresses: strs(link.Addrs4),
+		IPv6Addresses: strs(link.Addrs6),
+		VlanID:        types.Int64Null(),
+		Members:       strs(link.Members),
+	}
+	if link.Type == nlops.TypeVLAN {
+		m.VlanID = types.Int64Value(int64(link.VlanID))
+	}
+	return m
+}
+
+func (d *NetworkInterfacesDS) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_network_interfaces"
+}
+
+func (d *NetworkInterfacesDS) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Network interfaces of the target, or of one of its network namespaces",
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: undent.Md(`
+		The network interfaces data source returns every network interface of the target (the
+		local host or the SSH one), or of the network namespace |netns|, with the backend of the
+		provider |network_backend|. E.g. to find the physical uplink of a lab server, to check the
+		|enslaved_interfaces| of a |zedamigo_lag| at plan time, or to document a running lab.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description:         "Network interfaces data source identifier, the name of the network namespace",
+				MarkdownDescription: "Network interfaces data source identifier, the name of the network namespace",
+				Computed:            true,
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace to list the interfaces of, the default one if not specified",
+				Optional:    true,
+			},
+			"interfaces": schema.ListNestedAttribute{
+				Description: "The interfaces, ordered by index",
+				Computed:    true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Description: "Name of the interface",
+							Computed:    true,
+						},
+						"index": schema.Int64Attribute{
+							Description: "Index of the interface",
+							Computed:    true,
+						},
+						"kind": schema.StringAttribute{
+							Description: "Kind of the interface, e.g. `bridge`, `tap`, `vlan`, `bond`, `veth`, " +
+								"`macvlan`, `vxlan`, or `device` for a physical one (and `lo`)",
+							Computed: true,
+						},
+						"master": schema.StringAttribute{
+							Description: "Bridge or bond the interface is attached to",
+							Computed:    true,
+						},
+						"parent": schema.StringAttribute{
+							Description: "Interface this one is on top of (e.g. of a VLAN), or the peer of a veth, " +
+								"when it is in the same network namespace",
+							Computed: true,
+						},
+						"mtu": schema.Int64Attribute{
+							Description: "MTU size of the interface",
+							Computed:    true,
+						},
+						"mac_address": schema.StringAttribute{
+							Description: "MAC address of the interface",
+							Computed:    true,
+						},
+						"state": schema.StringAttribute{
+							Description: "Administrative state of the interface (up/down)",
+							Computed:    true,
+						},
+						"operstate": schema.StringAttribute{
+							Description: "Operational state of the interface, e.g. `up`, `down`, `lowerlayerdown` or `unknown`",
+							Computed:    true,
+						},
+						"ipv4_addresses": schema.ListAttribute{
+							Description: "IPv4 addresses of the interface, in CIDR format",
+							ElementType: types.StringType,
+							Computed:    true,
+						},
+						"ipv6_addresses": schema.ListAttribute{
+							Description: "IPv6 addresses of the interface, in CIDR format, link-local ones left out",
+							ElementType: types.StringType,
+							Computed:    true,
+						},
+						"vlan_id": schema.Int64Attribute{
+							Description: "VLAN ID of a `vlan` interface",
+							Computed:    true,
+						},
+						"members": schema.ListAttribute{
+							Description: "Interfaces attached to a bridge (its ports) or to a bond (its slaves)",
+							ElementType: types.StringType,
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *NetworkInterfacesDS) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	d.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_network_interfaces", &resp.Diagnostics)
+}
+
+func (d *NetworkInterfacesDS) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data NetworkInterfacesDSModel
+
+	// Read Terraform configuration data into the model
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	dir := filepath.Join(d.providerConf.LibPath, networkInterfacesDir)
+	if err := d.providerConf.Exec.MkdirAll(ctx, dir, 0o700); err != nil {
+		resp.Diagnostics.AddError("Network Interfaces Data Source Error",
+			fmt.Sprintf("Unable to create data source specific directory: %s", err))
+		return
+	}
+
+	netns := data.NetNS.ValueString()
+	links, diags, err := newNetLinks(d.providerConf, netns).links(ctx, dir)
+	if err != nil {
+		resp.Diagnostics.AddError("Network Interfaces Data Source Error",
+			fmt.Sprintf("Unable to list the network interfaces: %s", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	data.ID = types.StringValue("default")
+	if netns != "" {
+		data.ID = types.StringValue(netns)
+	}
+	data.Interfaces = make([]NetworkInterfaceModel, 0, len(links))
+	for _, link := range links {
+		data.Interfaces = append(data.Interfaces, newNetworkInterfaceModel(link))
+	}
+
+	tflog.Trace(ctx, "read network interfaces data source", map[string]any{"netns": netns, "interfaces": len(links)})
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/errchecker"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// The nat and firewall resources each own one nftables table of the inet
+// family (IPv4 and IPv6), named after the resource. The whole table is
+// (re)loaded atomically from a ruleset file in the resource directory with
+// `nft -f`, and deleted with the resource.
+
+const (
+	// nftRulesetFile is the nftables ruleset of a resource, in its
+	// directory.
+	nftRulesetFile = "ruleset.nft"
+	// nftListingFile is the `nft list table` output of the table right after
+	// nftRulesetFile was loaded: nft prints rules in its own canonical form,
+	// so drift is detected by comparing listings, not against the ruleset.
+	nftListingFile = "ruleset.list"
+)
+
+// nftNameRegex matches the names that can be used in nftables table names
+// without quoting.
+var nftNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,40}$`)
+
+// nftPortRegex matches a port or a port range, e.g. "443" or "8000-8100".
+var nftPortRegex = regexp.MustCompile(`^[0-9]{1,5}(-[0-9]{1,5})?$`)
+
+// nftTableNotFoundStrs are substrings present in `nft` errors when the
+// table (or the network namespace) doesn't exist.
+var nftTableNotFoundStrs = []string{"No such file or directory"}
+
+// nftRuleset returns the ruleset replacing table with the given body, the
+// chains of the table. Creating and deleting the table first makes `nft -f`
+// replace it in one transaction whether it exists or not.
+func nftRuleset(table, body string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Managed by terraform-provider-zedamigo, changes are overwritten.\n")
+	fmt.Fprintf(&b, "table inet %s {}\n", table)
+	fmt.Fprintf(&b, "delete table inet %s\n", table)
+	fmt.Fprintf(&b, "table inet %s {\n%s}\n", table, body)
+	return b.String()
+}
+
+// nftLoad writes the ruleset of table in resource directory resPath, loads
+// it in network namespace netns and records the resulting listing for
+// nftTableState.
+func nftLoad(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns, table, ruleset string) (diag.Diagnostics, error) {
+	f := filepath.Join(resPath, nftRulesetFile)
+	if err := conf.Exec.WriteFile(ctx, f, []byte(ruleset), 0o600); err != nil {
+		return nil, fmt.Errorf("can't write the nftables ruleset: %w", err)
+	}
+	cmd, args := buildNetNSCommand(conf, netns, conf.Nft)
+	if res, err := conf.Exec.Run(ctx, resPath, cmd, append(args, "-f", f)...); err != nil {
+		return res.Diagnostics(), fmt.Errorf("can't load the nftables ruleset '%s': %w", f, err)
+	}
+
+	listing, found, diags, err := nftListTable(ctx, conf, resPath, netns, table)
+	if err != nil {
+		return diags, err
+	}
+	if !found {
+		return nil, fmt.Errorf("nftables table '%s' is missing after loading '%s'", table, f)
+	}
+	if err := conf.Exec.WriteFile(ctx, filepath.Join(resPath, nftListingFile), []byte(listing), 0o600); err != nil {
+		return nil, fmt.Errorf("can't write the nftables listing: %w", err)
+	}
+	return nil, nil
+}
+
+// nftListTable returns the `nft list table` output of table in network
+// namespace netns; found is false when the table doesn't exist.
+func nftListTable(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns, table string) (string, bool, diag.Diagnostics, error) {
+	cmd, args := buildNetNSCommand(conf, netns, conf.Nft)
+	res, err := conf.Exec.Run(ctx, resPath, cmd, append(args, "list", "table", "inet", table)...)
+	if err != nil {
+		if errchecker.ContainsAny(err, nftTableNotFoundStrs) || errchecker.DiagsAny(res.Diagnostics(), nftTableNotFoundStrs) {
+			return "", false, nil, nil
+		}
+		return "", false, res.Diagnostics(), fmt.Errorf("can't list nftables table '%s': %w", table, err)
+	}
+	return res.Stdout, true, nil, nil
+}
+
+// nftTableState reports whether table exists in network namespace netns and
+// whether its rules drifted from those loaded by nftLoad, e.g. a rule added
+// or deleted with `nft` by hand.
+func nftTableState(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns, table string) (exists, drifted bool, diags diag.Diagnostics, err error) {
+	listing, found, diags, err := nftListTable(ctx, conf, resPath, netns, table)
+	if err != nil || !found {
+		return false, false, diags, err
+	}
+	loaded, err := conf.Exec.ReadFile(ctx, filepath.Join(resPath, nftListingFile))
+	if err != nil {
+		// Loaded without recording the listing (an older provider
+		// version): take the current rules as the loaded ones.
+		if err := conf.Exec.WriteFile(ctx, filepath.Join(resPath, nftListingFile), []byte(listing), 0o600); err != nil {
+			return true, false, nil, fmt.Errorf("can't write the nftables listing: %w", err)
+		}
+		return true, false, nil, nil
+	}
+	return true, string(loaded) != listing, nil, nil
+}
+
+// nftDeleteTable deletes table from network namespace netns. A missing table
+// is not an error.
+func nftDeleteTable(ctx context.Context, conf *ZedAmigoProviderConfig, resPath, netns, table string) (diag.Diagnostics, error) {
+	cmd, args := buildNetNSCommand(conf, netns, conf.Nft)
+	res, err := conf.Exec.Run(ctx, resPath, cmd, append(args, "delete", "table", "inet", table)...)
+	if err != nil {
+		if errchecker.ContainsAny(err, nftTableNotFoundStrs) || errchecker.DiagsAny(res.Diagnostics(), nftTableNotFoundStrs) {
+			return nil, nil
+		}
+		return res.Diagnostics(), fmt.Errorf("can't delete nftables table '%s': %w", table, err)
+	}
+	return nil, nil
+}
+
+// nftString quotes s as an nftables string, e.g. an interface name or a
+// comment. nftables strings can't contain double quotes, they are dropped.
+func nftString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
+
+// nftSet returns the nftables anonymous set of the quoted strs, or the only
+// one.
+func nftSet(strs []string) string {
+	var q []string
+	for _, s := range strs {
+		q = append(q, nftString(s))
+	}
+	if len(q) == 1 {
+		return q[0]
+	}
+	return "{ " + strings.Join(q, ", ") + " }"
+}
+
+// nftAddrSets splits the addresses or CIDR prefixes addrs by family and
+// returns the nftables anonymous set of each ("" when there are none).
+func nftAddrSets(addrs []string) (v4, v6 string) {
+	var a4, a6 []string
+	for _, a := range addrs {
+		ip, _, err := net.ParseCIDR(a)
+		if err != nil {
+			ip = net.ParseIP(a)
+		}
+		if ip != nil && ip.To4() == nil {
+			a6 = append(a6, a)
+		} else {
+			a4 = append(a4, a)
+		}
+	}
+	set := func(a []string) string {
+		switch len(a) {
+		case 0:
+			return ""
+		case 1:
+			return a[0]
+		}
+		return "{ " + strings.Join(a, ", ") + " }"
+	}
+	return set(a4), set(a6)
+}
+
+// stringValues returns the values of the known elements of l.
+func stringValues(l []types.String) []string {
+	var strs []string
+	for _, s := range l {
+		if !s.IsNull() && !s.IsUnknown() {
+			strs = append(strs, s.ValueString())
+		}
+	}
+	return strs
+}
@@ -0,0 +1,607 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	ntpServersDir            = "ntp_servers"
+	ntpServerStopPoll        = 100 * time.Millisecond
+	ntpServerStopTimeout     = 5 * time.Second
+	ntpServerConfigTemplText = `# NTP server configuration (auto-generated)
+listen: {{ printf "%q" .Listen }}
+interface: {{ printf "%q" .Interface }}
+offset: {{ printf "%q" .Offset }}
+stratum: {{ .Stratum }}
+mode: {{ printf "%q" .Mode }}
+kiss_code: {{ printf "%q" .KissCode }}
+`
+)
+
+// ntpKissCodeRegex matches a Kiss-o'-Death code, the reference ID of the
+// packet.
+var ntpKissCodeRegex = regexp.MustCompile(`^[A-Z]{4}$`)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &NTPServer{}
+	_ resource.ResourceWithImportState    = &NTPServer{}
+	_ resource.ResourceWithValidateConfig = &NTPServer{}
+)
+
+func NewNTPServer() resource.Resource {
+	return &NTPServer{}
+}
+
+// NTPServer defines the resource implementation.
+type NTPServer struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// NTPServerModel describes the resource data model.
+type NTPServerModel struct {
+	ID            types.String `tfsdk:"id"`
+	Interface     types.String `tfsdk:"interface"`
+	NetNS         types.String `tfsdk:"netns"`
+	ListenAddress types.String `tfsdk:"listen_address"`
+	Port          types.Int64  `tfsdk:"port"`
+	Offset        types.String `tfsdk:"offset"`
+	Stratum       types.Int64  `tfsdk:"stratum"`
+	Mode          types.String `tfsdk:"mode"`
+	KissCode      types.String `tfsdk:"kiss_code"`
+	ConfigFile    types.String `tfsdk:"config_file"`
+	PIDFile       types.String `tfsdk:"pid_file"`
+	State         types.String `tfsdk:"state"`
+	Restarts      types.Int64  `tfsdk:"restarts"`
+	LastExit      types.String `tfsdk:"last_exit"`
+}
+
+func (r *NTPServer) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, ntpServersDir, id)
+}
+
+func (r *NTPServer) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_ntp_server"
+}
+
+func (r *NTPServer) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Embedded SNTP/NTPv4 server with a configurable clock offset",
+		MarkdownDescription: undent.Md(`
+		Run a small SNTP/NTPv4 server (UDP), the provider binary in |-ntp-server| mode, optionally
+		bound to an |interface| and/or inside a |netns|. It serves the time of the target shifted by
+		|offset|, e.g. to reproduce the certificate validation and onboarding failures of EVE-OS edge
+		nodes with a wrong clock. Advertise it with the |ntp_servers| of a |zedamigo_dhcp_server|
+		and skew the RTC of the VM with the |rtc_base| of a |zedamigo_edge_node|.
+
+		The |mode| selects how the server answers:
+		  * |synchronized|: a normal reply of a server at |stratum|.
+		  * |unsynchronized|: the "clock not synchronized" leap indicator and stratum 16, which the
+		    clients must not synchronize to.
+		  * |kiss_of_death|: a Kiss-o'-Death packet (stratum 0) with the |kiss_code|, e.g. |DENY| or
+		    |RATE|, which tells the clients to stop querying (or to slow down).
+
+		Changing the |offset|, |stratum|, |mode| or |kiss_code| restarts the daemon in place.
+		NOTE: This resource DOES NOT manage the host firewall configuration (UDP port 123).`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "NTP server resource identifier",
+				MarkdownDescription: "NTP server resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Only answer requests received on this interface (SO_BINDTODEVICE). Default: all interfaces.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace in which to run the NTP server",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"listen_address": schema.StringAttribute{
+				Description: "IP address to listen on. Default: all addresses (IPv4 and IPv6).",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"port": schema.Int64Attribute{
+				Description: "UDP port to listen on. Default: 123.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(123),
+				Validators: []validator.Int64{
+					int64validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"offset": schema.StringAttribute{
+				Description: "Offset added to the time of the target, a Go duration string optionally signed and " +
+					"starting with years (`y`, 365 days) and days (`d`), e.g. `+3y`, `-90d` or `1d12h`. Default: `0s`.",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("0s"),
+				Validators: []validator.String{
+					clockOffsetValidator{},
+				},
+			},
+			"stratum": schema.Int64Attribute{
+				Description: "Stratum of the server in the `synchronized` mode. Default: 1.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(1),
+				Validators: []validator.Int64{
+					int64validator.Between(1, 15),
+				},
+			},
+			"mode": schema.StringAttribute{
+				Description: "How the server answers: `synchronized`, `unsynchronized` or `kiss_of_death`. " +
+					"Default: `synchronized`.",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("synchronized"),
+				Validators: []validator.String{
+					stringvalidator.OneOf("synchronized", "unsynchronized", "kiss_of_death"),
+				},
+			},
+			"kiss_code": schema.StringAttribute{
+				Description: "Kiss code of the `kiss_of_death` mode, 4 uppercase ASCII letters, e.g. `DENY`, " +
+					"`RSTR` or `RATE`. Default: `DENY`.",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("DENY"),
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(ntpKissCodeRegex, "must be 4 uppercase ASCII letters"),
+				},
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated NTP server configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the NTP server daemon",
+				MarkdownDescription: undent.Md(`Desired state of the NTP server daemon. Can be "running" or "stopped".
+				Defaults to "running". The provider will automatically start or stop the daemon to match this state.
+				Stopping it is an easy way of simulating an unreachable NTP server.`),
+				Validators: []validator.String{
+					stringvalidator.OneOf("running", "stopped"),
+				},
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+		},
+	}
+}
+
+func (r *NTPServer) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data NTPServerModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.ListenAddress.IsNull() && !data.ListenAddress.IsUnknown() &&
+		net.ParseIP(data.ListenAddress.ValueString()) == nil {
+		resp.Diagnostics.AddAttributeError(path.Root("listen_address"), "Invalid listen address",
+			fmt.Sprintf("%q is not an IP address.", data.ListenAddress.ValueString()))
+	}
+}
+
+func (r *NTPServer) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_ntp_server", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "NTP server resource configure debugging", traceData)
+}
+
+func (r *NTPServer) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data NTPServerModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("NTPServer Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("NTPServer Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("NTPServer Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+	if diags := writeNTPServerConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if data.State.IsNull() || data.State.IsUnknown() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startNTPServer(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("NTPServer Resource Error",
+				fmt.Sprintf("Failed to start NTP server: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readNTPServer(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read NTPServer state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "NTPServer Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NTPServer) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data NTPServerModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readNTPServer(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read NTPServer state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *NTPServer) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan NTPServerModel
+	var state NTPServerModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file, the
+	// daemon reads it only on start.
+	configChanged := !plan.Offset.Equal(state.Offset) ||
+		!plan.Stratum.Equal(state.Stratum) ||
+		!plan.Mode.Equal(state.Mode) ||
+		!plan.KissCode.Equal(state.KissCode)
+	if configChanged {
+		if diags := writeNTPServerConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopNTPServer(ctx, d); err != nil {
+			resp.Diagnostics.AddError("NTPServer Resource Update Error",
+				fmt.Sprintf("Failed to stop NTP server: %v", err))
+			return
+		}
+		tflog.Info(ctx, "NTP server configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
+
+	if configChanged || !plan.State.Equal(state.State) {
+		tflog.Info(ctx, "NTP server state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startNTPServer(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("NTPServer Resource Update Error",
+					fmt.Sprintf("Failed to start NTP server: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopNTPServer(ctx, d); err != nil {
+				resp.Diagnostics.AddError("NTPServer Resource Update Error",
+					fmt.Sprintf("Failed to stop NTP server: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readNTPServer(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read NTPServer state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *NTPServer) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data NTPServerModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopNTPServer(ctx, d); err != nil {
+		tflog.Warn(ctx, "Failed to stop NTP server during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("NTPServer Resource Delete Error",
+			fmt.Sprintf("Can't delete NTPServer resource directory: %v", err))
+		return
+	}
+}
+
+func (r *NTPServer) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// startNTPServer starts the NTP server daemon for the given resource, inside
+// its network namespace if any.
+func (r *NTPServer) startNTPServer(ctx context.Context, d string, data *NTPServerModel) error {
+	netns := ""
+	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
+		netns = data.NetNS.ValueString()
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-ntp-server", "-ntp.config", data.ConfigFile.ValueString())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
+		return fmt.Errorf("failed to start NTP server: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+	return nil
+}
+
+// stopNTPServer stops the NTP server daemon for the given resource and waits
+// for it to exit, so that a new one can bind the same port right away.
+func (r *NTPServer) stopNTPServer(ctx context.Context, d string) error {
+	running, pid, err := readNTPServerPID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find NTP server process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill NTP server process: %w", err)
+	}
+	for deadline := time.Now().Add(ntpServerStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(ntpServerStopPoll)
+	}
+	return fmt.Errorf("NTP server process %d did not exit within %s", pid, ntpServerStopTimeout)
+}
+
+func (r *NTPServer) readNTPServer(ctx context.Context, resPath string, model *NTPServerModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	running, _, _ := readNTPServerPID(ctx, r.providerConf.Exec, resPath)
+	actualState := "stopped"
+	if running {
+		actualState = "running"
+	}
+
+	// Self-healing: reconcile actual state with desired state.
+	if desiredState == "running" && actualState == "stopped" {
+		tflog.Info(ctx, "NTP server daemon is stopped but should be running, restarting...")
+		if err := r.startNTPServer(ctx, resPath, model); err != nil {
+			return nil, fmt.Errorf("failed to restart NTP server: %w", err)
+		}
+		actualState = "running"
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "NTP server daemon is running but should be stopped, stopping...")
+		if err := r.stopNTPServer(ctx, resPath); err != nil {
+			return nil, fmt.Errorf("failed to stop NTP server: %w", err)
+		}
+		actualState = "stopped"
+	}
+
+	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+
+	return nil, nil
+}
+
+func readNTPServerPID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
+
+// ntpServerConfig is the data of the NTP server config file template.
+type ntpServerConfig struct {
+	Listen    string
+	Interface string
+	Offset    string
+	Stratum   int64
+	Mode      string
+	KissCode  string
+}
+
+// newNTPServerConfig returns the config file data of a resource model, the
+// offset as a plain Go duration string.
+func newNTPServerConfig(data *NTPServerModel) (ntpServerConfig, error) {
+	port := data.Port.ValueInt64()
+	if port == 0 {
+		port = 123
+	}
+	offset := time.Duration(0)
+	if s := data.Offset.ValueString(); s != "" {
+		var err error
+		if offset, err = parseClockOffset(s); err != nil {
+			return ntpServerConfig{}, err
+		}
+	}
+	return ntpServerConfig{
+		Listen:    net.JoinHostPort(data.ListenAddress.ValueString(), strconv.FormatInt(port, 10)),
+		Interface: data.Interface.ValueString(),
+		Offset:    offset.String(),
+		Stratum:   data.Stratum.ValueInt64(),
+		Mode:      data.Mode.ValueString(),
+		KissCode:  data.KissCode.ValueString(),
+	}, nil
+}
+
+// renderNTPServerConfig writes the NTP server config file of cfg to w.
+func renderNTPServerConfig(w io.Writer, cfg ntpServerConfig) error {
+	tmpl, err := template.New("ntp-config").Parse(ntpServerConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// writeNTPServerConfig writes the `config_file` of data.
+func writeNTPServerConfig(ctx context.Context, ex exec.Executor, data *NTPServerModel) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	cfg, err := newNTPServerConfig(data)
+	if err != nil {
+		diags.AddAttributeError(path.Root("offset"), "Invalid offset", err.Error())
+		return diags
+	}
+
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		diags.AddError("NTPServer Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderNTPServerConfig(confFile, cfg); err != nil {
+		diags.AddError("NTPServer Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
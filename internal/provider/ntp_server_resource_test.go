@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderNTPServerConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := NTPServerModel{
+		Interface:     types.StringValue("br0"),
+		ListenAddress: types.StringValue("10.1.0.1"),
+		Port:          types.Int64Value(123),
+		Offset:        types.StringValue("-1d"),
+		Stratum:       types.Int64Value(2),
+		Mode:          types.StringValue("kiss_of_death"),
+		KissCode:      types.StringValue("RATE"),
+	}
+	cfg, err := newNTPServerConfig(&data)
+	is.NoErr(err)
+
+	var buf bytes.Buffer
+	is.NoErr(renderNTPServerConfig(&buf, cfg))
+
+	var got struct {
+		Listen    string `yaml:"listen"`
+		Interface string `yaml:"interface"`
+		Offset    string `yaml:"offset"`
+		Stratum   int    `yaml:"stratum"`
+		Mode      string `yaml:"mode"`
+		KissCode  string `yaml:"kiss_code"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Listen, "10.1.0.1:123")
+	is.Equal(got.Interface, "br0")
+	is.Equal(got.Offset, "-24h0m0s") // the daemon only knows Go durations
+	is.Equal(got.Stratum, 2)
+	is.Equal(got.Mode, "kiss_of_death")
+	is.Equal(got.KissCode, "RATE")
+
+	data.Offset = types.StringValue("3w")
+	_, err = newNTPServerConfig(&data)
+	is.True(err != nil)
+}
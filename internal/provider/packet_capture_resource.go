@@ -0,0 +1,762 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/qmp"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	packetCapturesDir            = "packet_captures"
+	packetCaptureDefaultSnaplen  = 262144
+	packetCaptureConfigTemplText = `# Packet capture configuration (auto-generated)
+interface: {{ printf "%q" .Interface }}
+output_file: {{ printf "%q" .OutputFile }}
+bpf:
+{{- range .BPF }}
+  - [{{ .Op }}, {{ .Jt }}, {{ .Jf }}, {{ .K }}]
+{{- end }}
+snaplen: {{ .Snaplen }}
+promiscuous: {{ .Promiscuous }}
+rotate_size: {{ .RotateSize }}
+rotate_files: {{ .RotateFiles }}
+`
+
+	// Capture sources, see packetCaptureSource.
+	packetCaptureSourceInterface = "interface"
+	packetCaptureSourceQMP       = "qmp"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                = &PacketCapture{}
+	_ resource.ResourceWithImportState = &PacketCapture{}
+)
+
+func NewPacketCapture() resource.Resource {
+	return &PacketCapture{}
+}
+
+// PacketCapture defines the resource implementation.
+type PacketCapture struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// PacketCaptureModel describes the resource data model.
+type PacketCaptureModel struct {
+	ID           types.String `tfsdk:"id"`
+	Interface    types.String `tfsdk:"interface"`
+	NetNS        types.String `tfsdk:"netns"`
+	QMPSocket    types.String `tfsdk:"qmp_socket"`
+	Netdev       types.String `tfsdk:"netdev"`
+	BPF          types.String `tfsdk:"bpf"`
+	Snaplen      types.Int64  `tfsdk:"snaplen"`
+	Promiscuous  types.Bool   `tfsdk:"promiscuous"`
+	RotateSizeMB types.Int64  `tfsdk:"rotate_size_mb"`
+	RotateFiles  types.Int64  `tfsdk:"rotate_files"`
+	OutputFile   types.String `tfsdk:"output_file"`
+	ConfigFile   types.String `tfsdk:"config_file"`
+	PIDFile      types.String `tfsdk:"pid_file"`
+	State        types.String `tfsdk:"state"`
+	Restarts     types.Int64  `tfsdk:"restarts"`
+	LastExit     types.String `tfsdk:"last_exit"`
+}
+
+func (r *PacketCapture) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, packetCapturesDir, id)
+}
+
+func (r *PacketCapture) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_packet_capture"
+}
+
+func (r *PacketCapture) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Packet capture of a host interface or of a QEMU VM NIC",
+		MarkdownDescription: undent.Md(`
+		Record the traffic of a host interface (TAP, bridge, VLAN, ...) or of a QEMU
+		VM NIC to a file, for example to debug EVE-OS onboarding by capturing the controller traffic.
+
+		Two capture sources are supported, set exactly one of them:
+		  * |interface|: a pcapng capture through an AF_PACKET socket, run by a daemon (the provider binary
+		    in |-packet-capture| mode, with sudo if configured). Supports |bpf|, |promiscuous| and file
+		    rotation (|rotate_size_mb|, |rotate_files|).
+		  * |qmp_socket| + |netdev|: a QEMU |filter-dump| object added to the NIC backend through QMP. QEMU
+		    itself writes the file, in the classic pcap format; |bpf| and rotation are not supported. The
+		    filter is lost when the VM restarts and is added back on the next refresh.
+
+		Changing |state| starts or stops the capture in place.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Packet capture resource identifier",
+				MarkdownDescription: "Packet capture resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Host interface to capture on (AF_PACKET), e.g. a `zedamigo_tap` or `zedamigo_bridge` name.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace of `interface`.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"qmp_socket": schema.StringAttribute{
+				Description: "QMP socket of a running QEMU VM, e.g. the `qmp_socket` of a `zedamigo_edge_node`.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netdev": schema.StringAttribute{
+				Description: "ID of the QEMU network backend to capture with `qmp_socket`, e.g. `usernet0` for a gvproxy " +
+					"nic0 or the `id=` of a `-netdev`/`-nic` in `extra_qemu_args`.",
+				Optional: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"bpf": schema.StringAttribute{
+				Description: "Capture filter as a classic BPF program in the `tcpdump -ddd` format, e.g. the output of " +
+					"`tcpdump -y EN10MB -ddd tcp port 443`. Only with `interface`.",
+				MarkdownDescription: undent.Md(`
+				Capture filter as a classic BPF program for an Ethernet capture, in the format printed by
+				|tcpdump -ddd|: the number of instructions followed by one |code jt jf k| line per
+				instruction. Only with |interface|. For example |bpf = file("controller.bpf")| with the file
+				written by |tcpdump -y EN10MB -ddd 'tcp port 443' >controller.bpf|.
+
+				There is no pure Go compiler for tcpdump (pcap-filter) expressions, and compiling them on the
+				target would make tcpdump or libpcap a dependency of every capture. So the filter is compiled
+				ahead of time, on any machine with tcpdump, and only the program is passed to the capture.`),
+				Optional: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					bpfProgramValidator{},
+				},
+			},
+			"snaplen": schema.Int64Attribute{
+				Description: "Maximum number of bytes captured per packet. Default: 262144.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(packetCaptureDefaultSnaplen),
+				Validators: []validator.Int64{
+					int64validator.Between(64, packetCaptureDefaultSnaplen),
+				},
+			},
+			"promiscuous": schema.BoolAttribute{
+				Description: "Put `interface` in promiscuous mode. Default: `true`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(true),
+			},
+			"rotate_size_mb": schema.Int64Attribute{
+				Description: "Rotate the output file when it reaches this size in MiB. Default: 0, never rotate. Only with `interface`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(0),
+				Validators: []validator.Int64{
+					int64validator.AtLeast(0),
+				},
+			},
+			"rotate_files": schema.Int64Attribute{
+				Description: "Number of rotated files kept as a ring buffer (`output_file.1` is the most recent). Default: 5.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(5),
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"output_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The capture file currently written (pcapng for `interface`, pcap for `qmp_socket`)",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated capture daemon configuration file. Null with `qmp_socket`",
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file of the capture daemon. Null with `qmp_socket`",
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the capture",
+				MarkdownDescription: undent.Md(`Desired state of the capture. Can be "running" or "stopped".
+				Defaults to "running". The provider will automatically start or stop the capture to match this state.
+				Starting an |interface| capture again truncates |output_file|.`),
+				Validators: []validator.String{
+					stringvalidator.OneOf("running", "stopped"),
+				},
+			},
+		},
+	}
+}
+
+func (r *PacketCapture) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	if conf.TargetOS != "linux" {
+		resp.Diagnostics.AddError("zedamigo_packet_capture requires a Linux target.",
+			fmt.Sprintf("Packet capture uses AF_PACKET sockets or QEMU filter-dump objects and is not supported on %s/%s targets.",
+				conf.TargetOS, conf.TargetArch))
+	}
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Packet capture resource configure debugging", traceData)
+}
+
+func (r *PacketCapture) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data PacketCaptureModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	source, diags := packetCaptureSource(&data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("PacketCapture Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("PacketCapture Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("PacketCapture Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	if source == packetCaptureSourceInterface {
+		data.OutputFile = types.StringValue(filepath.Join(d, "capture.pcapng"))
+		data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+		var prog []bpf.RawInstruction
+		if program := data.BPF.ValueString(); program != "" {
+			prog, err = parseTcpdumpBPF(program)
+			if err != nil {
+				resp.Diagnostics.AddAttributeError(path.Root("bpf"), "Invalid packet capture BPF program", err.Error())
+				return
+			}
+		}
+		confPath := filepath.Join(d, "config.yaml")
+		if err := writePacketCaptureConfig(ctx, r.providerConf.Exec, confPath, &data, prog); err != nil {
+			resp.Diagnostics.AddError("PacketCapture Resource Error",
+				fmt.Sprintf("Unable to write config file: %s", err))
+			return
+		}
+		data.ConfigFile = types.StringValue(confPath)
+	} else {
+		data.OutputFile = types.StringValue(filepath.Join(d, "capture.pcap"))
+		data.PIDFile = types.StringNull()
+		data.ConfigFile = types.StringNull()
+	}
+
+	if data.State.IsNull() || data.State.IsUnknown() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startCapture(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("PacketCapture Resource Error",
+				fmt.Sprintf("Failed to start packet capture: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readCapture(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read PacketCapture state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "PacketCapture Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *PacketCapture) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data PacketCaptureModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readCapture(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read PacketCapture state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *PacketCapture) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan PacketCaptureModel
+	var state PacketCaptureModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	configChanged := !plan.Snaplen.Equal(state.Snaplen) ||
+		!plan.Promiscuous.Equal(state.Promiscuous) ||
+		!plan.RotateSizeMB.Equal(state.RotateSizeMB) ||
+		!plan.RotateFiles.Equal(state.RotateFiles)
+	if configChanged {
+		resp.Diagnostics.AddError("PacketCapture Resource Update Error",
+			"Configuration changes require resource recreation. Only the 'state' field can be updated in-place.")
+		return
+	}
+
+	// Preserve computed fields.
+	plan.OutputFile = state.OutputFile
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+
+	if !plan.State.Equal(state.State) {
+		desiredState := plan.State.ValueString()
+		if desiredState == "" {
+			desiredState = "running"
+		}
+
+		tflog.Info(ctx, "Packet capture state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startCapture(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("PacketCapture Resource Update Error",
+					fmt.Sprintf("Failed to start packet capture: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopCapture(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("PacketCapture Resource Update Error",
+					fmt.Sprintf("Failed to stop packet capture: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readCapture(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read PacketCapture state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *PacketCapture) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data PacketCaptureModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopCapture(ctx, d, &data); err != nil {
+		tflog.Warn(ctx, "Failed to stop packet capture during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("PacketCapture Resource Delete Error",
+			fmt.Sprintf("Can't delete PacketCapture resource directory: %v", err))
+		return
+	}
+}
+
+func (r *PacketCapture) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// packetCaptureSource validates the capture source attributes and returns
+// packetCaptureSourceInterface or packetCaptureSourceQMP.
+func packetCaptureSource(data *PacketCaptureModel) (string, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	set := func(v types.String) bool { return !v.IsNull() && !v.IsUnknown() && v.ValueString() != "" }
+
+	hasIface, hasQMP, hasNetdev := set(data.Interface), set(data.QMPSocket), set(data.Netdev)
+	switch {
+	case hasIface && (hasQMP || hasNetdev):
+		diags.AddError("Invalid packet capture configuration",
+			"Set either interface (AF_PACKET capture) or qmp_socket and netdev (QEMU filter-dump), not both.")
+	case hasIface:
+		return packetCaptureSourceInterface, diags
+	case hasQMP != hasNetdev:
+		diags.AddError("Invalid packet capture configuration", "qmp_socket and netdev must be set together.")
+	case !hasQMP:
+		diags.AddError("Invalid packet capture configuration",
+			"One of interface or qmp_socket and netdev must be set.")
+	default:
+		if set(data.NetNS) {
+			diags.AddError("Invalid packet capture configuration", "netns only applies to an interface capture.")
+		}
+		if set(data.BPF) {
+			diags.AddError("Invalid packet capture configuration",
+				"bpf is not supported by the QEMU filter-dump capture, use an interface capture instead.")
+		}
+		if data.RotateSizeMB.ValueInt64() > 0 {
+			diags.AddError("Invalid packet capture configuration",
+				"rotate_size_mb is not supported by the QEMU filter-dump capture, use an interface capture instead.")
+		}
+		return packetCaptureSourceQMP, diags
+	}
+	return "", diags
+}
+
+// filterDumpID returns the QOM id of the filter-dump object of a capture.
+func filterDumpID(id string) string {
+	return "zedamigo-pcap-" + id
+}
+
+func (r *PacketCapture) startCapture(ctx context.Context, d string, data *PacketCaptureModel) error {
+	if source, _ := packetCaptureSource(data); source == packetCaptureSourceQMP {
+		_, err := hypervisor.QMPExecute(ctx, r.providerConf.Exec, data.QMPSocket.ValueString(), qmp.Command{
+			Execute: "object-add",
+			Args: map[string]any{
+				"qom-type": "filter-dump",
+				"id":       filterDumpID(data.ID.ValueString()),
+				"netdev":   data.Netdev.ValueString(),
+				"file":     data.OutputFile.ValueString(),
+				"maxlen":   data.Snaplen.ValueInt64(),
+			},
+		})
+		return err
+	}
+
+	netns := ""
+	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
+		netns = data.NetNS.ValueString()
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	pcCmd, pcArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-packet-capture", "-pc.config", data.ConfigFile.ValueString())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, pcCmd, append(pcArgs, moreArgs...)...); err != nil {
+		return fmt.Errorf("failed to start packet capture daemon: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+	return nil
+}
+
+func (r *PacketCapture) stopCapture(ctx context.Context, d string, data *PacketCaptureModel) error {
+	if source, _ := packetCaptureSource(data); source == packetCaptureSourceQMP {
+		running, err := r.filterDumpPresent(ctx, data)
+		if err != nil || !running {
+			// VM not running, nothing to remove.
+			return nil
+		}
+		_, err = hypervisor.QMPExecute(ctx, r.providerConf.Exec, data.QMPSocket.ValueString(), qmp.Command{
+			Execute: "object-del",
+			Args:    map[string]any{"id": filterDumpID(data.ID.ValueString())},
+		})
+		return err
+	}
+
+	running, pid, err := readPacketCapturePID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find packet capture daemon process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	// SIGTERM so that the daemon flushes the capture file.
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill packet capture daemon process: %w", err)
+	}
+	return nil
+}
+
+// filterDumpPresent reports whether the capture's filter-dump object exists
+// in the QEMU process.
+func (r *PacketCapture) filterDumpPresent(ctx context.Context, data *PacketCaptureModel) (bool, error) {
+	raw, err := hypervisor.QMPExecute(ctx, r.providerConf.Exec, data.QMPSocket.ValueString(), qmp.Command{
+		Execute: "qom-list",
+		Args:    map[string]any{"path": "/objects"},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var res struct {
+		Return []struct {
+			Name string `json:"name"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return false, fmt.Errorf("%w", err)
+	}
+	id := filterDumpID(data.ID.ValueString())
+	for _, o := range res.Return {
+		if o.Name == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *PacketCapture) readCapture(ctx context.Context, resPath string, model *PacketCaptureModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	var diags diag.Diagnostics
+	actualState := "stopped"
+	source, _ := packetCaptureSource(model)
+	if source == packetCaptureSourceQMP {
+		present, err := r.filterDumpPresent(ctx, model)
+		if err != nil {
+			// The VM is not running; the filter comes back with the next refresh.
+			diags.AddWarning("Packet capture VM not reachable",
+				fmt.Sprintf("Can't query the QEMU filter-dump object: %v", err))
+			model.State = types.StringValue(actualState)
+			model.Restarts = types.Int64Null()
+			model.LastExit = types.StringNull()
+			return diags, nil
+		}
+		if present {
+			actualState = "running"
+		}
+	} else {
+		if running, _, _ := readPacketCapturePID(ctx, r.providerConf.Exec, resPath); running {
+			actualState = "running"
+		}
+	}
+
+	if desiredState == "running" && actualState == "stopped" {
+		tflog.Info(ctx, "Packet capture is stopped but should be running, restarting...")
+		if err := r.startCapture(ctx, resPath, model); err != nil {
+			return diags, fmt.Errorf("failed to restart packet capture: %w", err)
+		}
+		actualState = "running"
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "Packet capture is running but should be stopped, stopping...")
+		if err := r.stopCapture(ctx, resPath, model); err != nil {
+			return diags, fmt.Errorf("failed to stop packet capture: %w", err)
+		}
+		actualState = "stopped"
+	}
+
+	model.State = types.StringValue(actualState)
+	if source == packetCaptureSourceQMP {
+		// The qmp source has no daemon, so no supervisor status either.
+		model.Restarts = types.Int64Null()
+		model.LastExit = types.StringNull()
+	} else {
+		readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+	}
+
+	return diags, nil
+}
+
+// bpfProgramValidator validates that a string attribute holds a classic BPF
+// program in the `tcpdump -ddd` format, so that a broken program fails the
+// plan and not the start of the capture daemon.
+type bpfProgramValidator struct{}
+
+var _ validator.String = bpfProgramValidator{}
+
+func (v bpfProgramValidator) Description(_ context.Context) string {
+	return "must be a classic BPF program in the `tcpdump -ddd` format"
+}
+
+func (v bpfProgramValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v bpfProgramValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() || req.ConfigValue.ValueString() == "" {
+		return
+	}
+
+	if _, err := parseTcpdumpBPF(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path,
+			"Invalid BPF Program",
+			fmt.Sprintf("%v. Expected the output of `tcpdump -y EN10MB -ddd <filter>`.", err))
+	}
+}
+
+// parseTcpdumpBPF parses the output of `tcpdump -ddd`: the instruction count
+// followed by one "code jt jf k" line per instruction.
+func parseTcpdumpBPF(out string) ([]bpf.RawInstruction, error) {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty program")
+	}
+	n, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse instruction count %q: %w", lines[0], err)
+	}
+	if n == 0 || n != len(lines)-1 {
+		return nil, fmt.Errorf("expected %d instructions, got %d", n, len(lines)-1)
+	}
+
+	prog := make([]bpf.RawInstruction, 0, n)
+	for _, line := range lines[1:] {
+		var op, jt, jf, k uint32
+		if _, err := fmt.Sscanf(line, "%d %d %d %d", &op, &jt, &jf, &k); err != nil {
+			return nil, fmt.Errorf("parse instruction line %q: %w", line, err)
+		}
+		if op > 0xffff || jt > 0xff || jf > 0xff {
+			return nil, fmt.Errorf("invalid instruction line %q", line)
+		}
+		prog = append(prog, bpf.RawInstruction{Op: uint16(op), Jt: uint8(jt), Jf: uint8(jf), K: k})
+	}
+	if _, ok := bpf.Disassemble(prog); !ok {
+		return nil, fmt.Errorf("unknown instruction in program")
+	}
+	return prog, nil
+}
+
+func writePacketCaptureConfig(ctx context.Context, ex exec.Executor, confPath string, data *PacketCaptureModel, prog []bpf.RawInstruction) error {
+	tmpl, err := template.New("pc-config").Parse(packetCaptureConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", confPath, err)
+	}
+	defer confFile.Close()
+
+	td := struct {
+		Interface   string
+		OutputFile  string
+		BPF         []bpf.RawInstruction
+		Snaplen     int64
+		Promiscuous bool
+		RotateSize  int64
+		RotateFiles int64
+	}{
+		Interface:   data.Interface.ValueString(),
+		OutputFile:  data.OutputFile.ValueString(),
+		BPF:         prog,
+		Snaplen:     data.Snaplen.ValueInt64(),
+		Promiscuous: data.Promiscuous.ValueBool(),
+		RotateSize:  data.RotateSizeMB.ValueInt64() * 1024 * 1024,
+		RotateFiles: data.RotateFiles.ValueInt64(),
+	}
+	if err := tmpl.Execute(confFile, td); err != nil {
+		return fmt.Errorf("write %s: %w", confPath, err)
+	}
+	return nil
+}
+
+func readPacketCapturePID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
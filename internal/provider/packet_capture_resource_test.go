@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"golang.org/x/net/bpf"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPacketCaptureSource(t *testing.T) {
+	is := is.New(t)
+
+	base := func() PacketCaptureModel {
+		return PacketCaptureModel{
+			Interface:    types.StringNull(),
+			NetNS:        types.StringNull(),
+			QMPSocket:    types.StringNull(),
+			Netdev:       types.StringNull(),
+			BPF:          types.StringNull(),
+			RotateSizeMB: types.Int64Value(0),
+		}
+	}
+
+	m := base()
+	m.Interface = types.StringValue("br0")
+	m.BPF = types.StringValue("1\n6 0 0 262144\n")
+	m.RotateSizeMB = types.Int64Value(10)
+	src, diags := packetCaptureSource(&m)
+	is.True(!diags.HasError())
+	is.Equal(src, packetCaptureSourceInterface)
+
+	m = base()
+	m.QMPSocket = types.StringValue("/tmp/qmp.socket")
+	m.Netdev = types.StringValue("usernet0")
+	src, diags = packetCaptureSource(&m)
+	is.True(!diags.HasError())
+	is.Equal(src, packetCaptureSourceQMP)
+
+	// filter-dump has no BPF filter.
+	m.BPF = types.StringValue("1\n6 0 0 262144\n")
+	_, diags = packetCaptureSource(&m)
+	is.True(diags.HasError())
+
+	// Both sources.
+	m = base()
+	m.Interface = types.StringValue("br0")
+	m.QMPSocket = types.StringValue("/tmp/qmp.socket")
+	m.Netdev = types.StringValue("usernet0")
+	_, diags = packetCaptureSource(&m)
+	is.True(diags.HasError())
+
+	// Neither source, and qmp_socket without netdev.
+	m = base()
+	_, diags = packetCaptureSource(&m)
+	is.True(diags.HasError())
+	m.QMPSocket = types.StringValue("/tmp/qmp.socket")
+	_, diags = packetCaptureSource(&m)
+	is.True(diags.HasError())
+}
+
+func TestParseTcpdumpBPF(t *testing.T) {
+	is := is.New(t)
+
+	// tcpdump -y EN10MB -s 262144 -ddd ip
+	prog, err := parseTcpdumpBPF("4\n40 0 0 12\n21 0 1 2048\n6 0 0 262144\n6 0 0 0\n")
+	is.NoErr(err)
+	is.Equal(prog, []bpf.RawInstruction{
+		{Op: 40, K: 12},
+		{Op: 21, Jt: 0, Jf: 1, K: 2048},
+		{Op: 6, K: 262144},
+		{Op: 6, K: 0},
+	})
+
+	for _, out := range []string{
+		"",
+		"2\n6 0 0 0\n",    // Truncated.
+		"x\n6 0 0 0\n",    // No instruction count.
+		"1\n6 0 zero 0\n", // Not a number.
+		"1\n6 256 0 0\n",  // jt out of range.
+		"1\n255 0 0 0\n",  // Unknown opcode.
+	} {
+		_, err := parseTcpdumpBPF(out)
+		is.True(err != nil) // Invalid program.
+	}
+}
+
+func TestBPFProgramValidator(t *testing.T) {
+	is := is.New(t)
+
+	for s, ok := range map[string]bool{
+		"":                      true, // No filter.
+		"1\n6 0 0 262144\n":     true,
+		"  1\n  6 0 0 262144\n": true, // Indented heredoc.
+		"tcp port 443":          false,
+		"1\n255 0 0 0\n":        false,
+	} {
+		resp := &validator.StringResponse{}
+		bpfProgramValidator{}.ValidateString(context.Background(), validator.StringRequest{
+			Path:        path.Root("bpf"),
+			ConfigValue: types.StringValue(s),
+		}, resp)
+		is.Equal(!resp.Diagnostics.HasError(), ok) // bpf validation
+	}
+}
+
+func TestWritePacketCaptureConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := PacketCaptureModel{
+		Interface:    types.StringValue("br0"),
+		OutputFile:   types.StringValue("/lib/packet_captures/x/capture.pcapng"),
+		BPF:          types.StringValue("4\n40 0 0 12\n21 0 1 2048\n6 0 0 262144\n6 0 0 0\n"),
+		Snaplen:      types.Int64Value(262144),
+		Promiscuous:  types.BoolValue(true),
+		RotateSizeMB: types.Int64Value(1),
+		RotateFiles:  types.Int64Value(3),
+	}
+	prog := []bpf.RawInstruction{{Op: 40, K: 12}, {Op: 21, Jt: 0, Jf: 1, K: 2048}, {Op: 6, K: 262144}, {Op: 6}}
+
+	confPath := filepath.Join(t.TempDir(), "config.yaml")
+	is.NoErr(writePacketCaptureConfig(context.Background(), exec.NewLocal(false), confPath, &data, prog))
+	x, err := os.ReadFile(confPath)
+	is.NoErr(err)
+
+	var got struct {
+		BPF        [][4]uint32 `yaml:"bpf"`
+		RotateSize int64       `yaml:"rotate_size"`
+	}
+	is.NoErr(yaml.Unmarshal(x, &got))
+	is.Equal(got.BPF, [][4]uint32{{40, 0, 0, 12}, {21, 0, 1, 2048}, {6, 0, 0, 262144}, {6, 0, 0, 0}})
+	is.Equal(got.RotateSize, int64(1024*1024))
+
+	// Without a filter there is no program.
+	data.BPF = types.StringNull()
+	is.NoErr(writePacketCaptureConfig(context.Background(), exec.NewLocal(false), confPath, &data, nil))
+	x, err = os.ReadFile(confPath)
+	is.NoErr(err)
+	got.BPF = nil
+	is.NoErr(yaml.Unmarshal(x, &got))
+	is.Equal(len(got.BPF), 0)
+}
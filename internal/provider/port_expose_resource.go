@@ -0,0 +1,315 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	gvclient "github.com/containers/gvisor-tap-vsock/pkg/client"
+	gvtypes "github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int32validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int32planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// gvproxyControlTimeout bounds every request to a gvproxy control socket.
+const gvproxyControlTimeout = 5 * time.Second
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ resource.Resource = &PortExpose{}
+
+func NewPortExpose() resource.Resource {
+	return &PortExpose{}
+}
+
+// PortExpose defines the resource implementation.
+type PortExpose struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// PortExposeModel describes the resource data model.
+type PortExposeModel struct {
+	ID            types.String `tfsdk:"id"`
+	ControlSocket types.String `tfsdk:"control_socket"`
+	Protocol      types.String `tfsdk:"protocol"`
+	HostAddr      types.String `tfsdk:"host_addr"`
+	HostPort      types.Int32  `tfsdk:"host_port"`
+	GuestIP       types.String `tfsdk:"guest_ip"`
+	GuestPort     types.Int32  `tfsdk:"guest_port"`
+	Exposed       types.Bool   `tfsdk:"exposed"`
+}
+
+func (r *PortExpose) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_port_expose"
+}
+
+func (r *PortExpose) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Port forward added at runtime to a running gvproxy network",
+		MarkdownDescription: undent.Md(`
+		Add a host→guest port forward to a running gvproxy network through its HTTP
+		control API, without restarting the VM. The |control_socket| is either the |gvproxy_control_socket| of an
+		edge node that uses gvproxy (|use_gvproxy = true|, always on macOS) or the |control_socket| of a
+		|zedamigo_user_network|. The forward is removed again on destroy.
+
+		Runtime forwards are not persisted by gvproxy: if the gvproxy process is restarted (e.g. together with its
+		VM) the forward is added back on the next refresh. A forward which meanwhile took the same host port to
+		another guest address is left alone: the refresh warns and sets |exposed| to false, and destroy doesn't
+		remove it. Every attribute forces a new resource.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Identifier: `<protocol>/<host_addr>:<host_port>`",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"control_socket": schema.StringAttribute{
+				Description: "UNIX socket of the gvproxy control API.",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"protocol": schema.StringAttribute{
+				Description: `Transport protocol: "tcp" (default) or "udp".`,
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("tcp"),
+				Validators: []validator.String{
+					stringvalidator.OneOf("tcp", "udp"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"host_addr": schema.StringAttribute{
+				Description: "Host address to bind the forward on. Default: `0.0.0.0`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("0.0.0.0"),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"host_port": schema.Int32Attribute{
+				Description: "Host port of the forward.",
+				Required:    true,
+				Validators: []validator.Int32{
+					int32validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int32{
+					int32planmodifier.RequiresReplace(),
+				},
+			},
+			"guest_ip": schema.StringAttribute{
+				Description: "IPv4 address of the VM inside the gvproxy network. Default: `" + hypervisor.GvproxyGuestIP +
+					"`, the address of the VM behind a per-VM gvproxy. Set it for VMs on a `zedamigo_user_network`.",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString(hypervisor.GvproxyGuestIP),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"guest_port": schema.Int32Attribute{
+				Description: "Port of the VM that the forward targets.",
+				Required:    true,
+				Validators: []validator.Int32{
+					int32validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int32{
+					int32planmodifier.RequiresReplace(),
+				},
+			},
+			"exposed": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether gvproxy currently has the forward.",
+			},
+		},
+	}
+}
+
+func (r *PortExpose) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+}
+
+func (r *PortExpose) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data PortExposeModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	expose := portExposeRequest(&data)
+	data.ID = types.StringValue(fmt.Sprintf("%s/%s", expose.Protocol, expose.Local))
+
+	c := gvproxyControlClient(r.providerConf.Exec, data.ControlSocket.ValueString())
+	if err := c.Expose(&expose); err != nil {
+		resp.Diagnostics.AddError("Port Expose Resource Error",
+			fmt.Sprintf("Failed to expose %s -> %s: %v", expose.Local, expose.Remote, err))
+		return
+	}
+	data.Exposed = types.BoolValue(true)
+
+	tflog.Trace(ctx, "Port Expose Resource created successfully", map[string]any{"id": data.ID.ValueString()})
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *PortExpose) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data PortExposeModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Without the control socket the gvproxy (and its VM) are gone.
+	if _, err := r.providerConf.Exec.Stat(ctx, data.ControlSocket.ValueString()); exec.IsNotExist(err) {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	expose := portExposeRequest(&data)
+	c := gvproxyControlClient(r.providerConf.Exec, data.ControlSocket.ValueString())
+	ports, err := c.List()
+	if err != nil {
+		resp.Diagnostics.AddWarning("Port Expose Resource Read Warning",
+			fmt.Sprintf("Can't list the gvproxy forwards: %v", err))
+		data.Exposed = types.BoolValue(false)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		return
+	}
+
+	found := false
+	switch existing := findPortExpose(ports, expose); {
+	case existing == nil:
+		// gvproxy was restarted, or the forward was removed behind our back.
+		tflog.Info(ctx, "gvproxy forward is missing, exposing it again", map[string]any{"id": data.ID.ValueString()})
+		if err := c.Expose(&expose); err != nil {
+			resp.Diagnostics.AddWarning("Port Expose Resource Read Warning",
+				fmt.Sprintf("Failed to expose %s -> %s again: %v", expose.Local, expose.Remote, err))
+		} else {
+			found = true
+		}
+	case existing.Remote != expose.Remote:
+		// Someone else exposed the same host port since, leave it alone.
+		resp.Diagnostics.AddWarning("Port Expose Resource Read Warning",
+			fmt.Sprintf("The host port %s/%s is taken: it is forwarded to %s instead of %s. Remove that forward "+
+				"and refresh to restore this one.", expose.Protocol, expose.Local, existing.Remote, expose.Remote))
+	default:
+		found = true
+	}
+	data.Exposed = types.BoolValue(found)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *PortExpose) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	resp.Diagnostics.AddError("Port Expose Resource Update Error",
+		"Update is not supported; every input attribute forces replacement.")
+}
+
+func (r *PortExpose) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data PortExposeModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if _, err := r.providerConf.Exec.Stat(ctx, data.ControlSocket.ValueString()); exec.IsNotExist(err) {
+		return
+	}
+
+	expose := portExposeRequest(&data)
+	c := gvproxyControlClient(r.providerConf.Exec, data.ControlSocket.ValueString())
+	if ports, err := c.List(); err == nil {
+		if existing := findPortExpose(ports, expose); existing == nil || existing.Remote != expose.Remote {
+			return // Gone already, or taken by another forward.
+		}
+	}
+	if err := c.Unexpose(&gvtypes.UnexposeRequest{Local: expose.Local, Protocol: expose.Protocol}); err != nil {
+		resp.Diagnostics.AddWarning("Port Expose Resource Delete Warning",
+			fmt.Sprintf("Failed to unexpose %s: %v", expose.Local, err))
+	}
+}
+
+// portExposeRequest returns the gvproxy expose request for the model.
+func portExposeRequest(data *PortExposeModel) gvtypes.ExposeRequest {
+	protocol := gvtypes.TCP
+	if data.Protocol.ValueString() == "udp" {
+		protocol = gvtypes.UDP
+	}
+	hostAddr := data.HostAddr.ValueString()
+	if hostAddr == "" {
+		hostAddr = "0.0.0.0"
+	}
+	guestIP := data.GuestIP.ValueString()
+	if guestIP == "" {
+		guestIP = hypervisor.GvproxyGuestIP
+	}
+
+	return gvtypes.ExposeRequest{
+		Local:    net.JoinHostPort(hostAddr, strconv.Itoa(int(data.HostPort.ValueInt32()))),
+		Remote:   net.JoinHostPort(guestIP, strconv.Itoa(int(data.GuestPort.ValueInt32()))),
+		Protocol: protocol,
+	}
+}
+
+// findPortExpose returns the gvproxy forward listening on the same host
+// address, port and protocol as expose, or nil if there is none.
+func findPortExpose(ports []gvtypes.ExposeRequest, expose gvtypes.ExposeRequest) *gvtypes.ExposeRequest {
+	for i := range ports {
+		if ports[i].Local == expose.Local && ports[i].Protocol == expose.Protocol {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+// gvproxyControlClient returns a gvproxy API client that talks HTTP over the
+// control UNIX socket, dialed through the executor (locally or over SSH).
+func gvproxyControlClient(ex exec.Executor, socketPath string) *gvclient.Client {
+	hc := &http.Client{
+		Timeout: gvproxyControlTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return ex.Dial(ctx, "unix", socketPath, gvproxyControlTimeout)
+			},
+		},
+	}
+	return gvclient.New(hc, "http://gvproxy")
+}
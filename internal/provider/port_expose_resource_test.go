@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
+	gvtypes "github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+func TestPortExposeRequest(t *testing.T) {
+	is := is.New(t)
+
+	req := portExposeRequest(&PortExposeModel{
+		Protocol:  types.StringValue("tcp"),
+		HostAddr:  types.StringValue("127.0.0.1"),
+		HostPort:  types.Int32Value(18080),
+		GuestIP:   types.StringNull(),
+		GuestPort: types.Int32Value(8080),
+	})
+	is.Equal(req.Protocol, gvtypes.TCP)
+	is.Equal(req.Local, "127.0.0.1:18080")
+	is.Equal(req.Remote, hypervisor.GvproxyGuestIP+":8080")
+
+	req = portExposeRequest(&PortExposeModel{
+		Protocol:  types.StringValue("udp"),
+		HostAddr:  types.StringValue("::"),
+		HostPort:  types.Int32Value(5353),
+		GuestIP:   types.StringValue("192.168.127.11"),
+		GuestPort: types.Int32Value(53),
+	})
+	is.Equal(req.Protocol, gvtypes.UDP)
+	is.Equal(req.Local, "[::]:5353")
+	is.Equal(req.Remote, "192.168.127.11:53")
+}
+
+func TestFindPortExpose(t *testing.T) {
+	is := is.New(t)
+
+	expose := gvtypes.ExposeRequest{Local: "0.0.0.0:18080", Remote: "192.168.127.2:8080", Protocol: gvtypes.TCP}
+	ports := []gvtypes.ExposeRequest{
+		{Local: "0.0.0.0:18080", Remote: "192.168.127.2:8080", Protocol: gvtypes.UDP},
+		{Local: "0.0.0.0:18080", Remote: "192.168.127.3:80", Protocol: gvtypes.TCP},
+	}
+	is.Equal(findPortExpose(ports, expose), &ports[1]) // Taken by another forward.
+	is.Equal(findPortExpose(ports[:1], expose), nil)   // Missing.
+}
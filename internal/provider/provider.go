@@ -9,11 +9,13 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 
@@ -61,8 +63,17 @@ type ZedAmigoProviderConfig struct {
 	Flock       string // Used by host_reservation_resource (util-linux flock)
 	GenISOImage string
 	IP          string
+	Bridge      string // Used by bridge_vlan_resource with the iproute2 backend
+	Wg          string // Used by wireguard_resource with the iproute2 backend
+	Nft         string // Used by nat_resource and firewall_resource
+	Sysctl      string // Used by nat_resource and netns_resource
 	Hypervisor  hypervisor.Hypervisor
 
+	// NetworkBackend selects how the networking resources (bridge, bridge
+	// VLAN, TAP, veth, VLAN, LAG, netns) configure the target: "netlink" (default) or
+	// "iproute2", see newNetLinks.
+	NetworkBackend string
+
 	// Exec is the executor used for ALL operations on `Target`: running
 	// commands, filesystem access, process management and socket dialing.
 	// It is a LocalExecutor when Target is localhost and an SSHExecutor
@@ -74,8 +85,9 @@ type ZedAmigoProviderConfig struct {
 // default values.
 func NewDefaultZedAmigoProviderConfig() ZedAmigoProviderConfig {
 	return ZedAmigoProviderConfig{
-		Target:  DefaultZedAmigoTarget,
-		LibPath: filepath.Join(xdg.StateHome, DefaultZedAmigoLibPath),
+		Target:         DefaultZedAmigoTarget,
+		LibPath:        filepath.Join(xdg.StateHome, DefaultZedAmigoLibPath),
+		NetworkBackend: networkBackendNetlink,
 	}
 }
 
@@ -89,10 +101,11 @@ type ZedAmigoProvider struct {
 
 // ZedAmigoProviderModel describes the provider data model.
 type ZedAmigoProviderModel struct {
-	Target  types.String `tfsdk:"target"`
-	LibPath types.String `tfsdk:"lib_path"`
-	UseSudo types.Bool   `tfsdk:"use_sudo"`
-	SSH     *SSHModel    `tfsdk:"ssh"`
+	Target         types.String `tfsdk:"target"`
+	LibPath        types.String `tfsdk:"lib_path"`
+	UseSudo        types.Bool   `tfsdk:"use_sudo"`
+	NetworkBackend types.String `tfsdk:"network_backend"`
+	SSH            *SSHModel    `tfsdk:"ssh"`
 }
 
 func (p *ZedAmigoProvider) Metadata(ctx context.Context, req provider.MetadataRequest, resp *provider.MetadataResponse) {
@@ -130,6 +143,27 @@ func (p *ZedAmigoProvider) Schema(ctx context.Context, req provider.SchemaReques
 				to |false|.`),
 				Optional: true,
 			},
+			"network_backend": schema.StringAttribute{
+				Description: "How the networking resources configure links and addresses on `target`: `netlink` (default) or `iproute2`.",
+				MarkdownDescription: undent.Md(`
+				How the networking resources (|zedamigo_bridge|, |zedamigo_bridge_vlan|,
+				|zedamigo_tap|, |zedamigo_veth|, |zedamigo_vlan|, |zedamigo_macvlan|,
+				|zedamigo_ipvlan|, |zedamigo_vxlan|, |zedamigo_gretap|, |zedamigo_wireguard|,
+				|zedamigo_lag| and |zedamigo_netns|) configure links and addresses on |target|.
+				Optional and if not specified it defaults to |netlink|:
+				  * |netlink|: talk to the kernel directly. Locally (without |use_sudo|)
+				    this happens in the provider process, otherwise the provider binary
+				    on |target| is run once per batch of changes (with |sudo| if
+				    configured). Each batch is applied all-or-nothing and the |ip|
+				    command is not needed, except for running daemons inside a network
+				    namespace.
+				  * |iproute2|: run |ip| commands and parse their output, one command
+				    per change.`),
+				Optional: true,
+				Validators: []validator.String{
+					stringvalidator.OneOf(networkBackendNetlink, networkBackendIPRoute2),
+				},
+			},
 		},
 		Blocks: map[string]schema.Block{
 			"ssh": sshSchemaBlock(),
@@ -214,6 +248,10 @@ func (p *ZedAmigoProvider) Configure(ctx context.Context, req provider.Configure
 		zaConf.UseSudo = true
 	}
 
+	if !conf.NetworkBackend.IsNull() {
+		zaConf.NetworkBackend = conf.NetworkBackend.ValueString()
+	}
+
 	// Build the executor used for ALL operations on `Target`. For localhost a
 	// LocalExecutor runs everything on the machine running the provider; for any
 	// other target a SSHExecutor runs everything on the remote host. From here
@@ -334,6 +372,7 @@ func (p *ZedAmigoProvider) Resources(ctx context.Context) []func() resource.Reso
 	return []func() resource.Resource{
 		NewDiskImage,
 		NewEveInstaller,
+		NewIPXEBoot,
 		NewInstalledNode,
 		NewEdgeNode,
 		NewVM,
@@ -344,12 +383,31 @@ func (p *ZedAmigoProvider) Resources(ctx context.Context) []func() resource.Reso
 		NewTAP,
 		NewLAG,
 		NewVLAN,
+		NewBridgeVlan,
+		NewVeth,
+		NewMacvlan,
+		NewIPVlan,
+		NewVXLAN,
+		NewGretap,
+		NewWireguard,
+		NewNAT,
+		NewFirewall,
+		NewRoute,
+		NewRule,
 		NewDHCPServer,
 		NewDHCP6Server,
 		NewRADV,
+		NewDNSServer,
+		NewNTPServer,
+		NewTFTPServer,
+		NewHTTPProxy,
 		NewLocalDatastore,
 		NewNetNS,
 		NewInternetMonitor,
+		NewTrafficFlow,
+		NewUserNetwork,
+		NewPortExpose,
+		NewPacketCapture,
 		NewMonitorSystemUsage,
 		NewHostReservation,
 		NewWaitUntil,
@@ -360,6 +418,8 @@ func (p *ZedAmigoProvider) DataSources(ctx context.Context) []func() datasource.
 	return []func() datasource.DataSource{
 		NewSystemInfoDataSource,
 		NewEveInstallerDataSource,
+		NewNetworkInterfacesDataSource,
+		NewDHCPLeasesDataSource,
 	}
 }
 
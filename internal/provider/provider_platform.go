@@ -75,15 +75,55 @@ func configureQEMUTools(ctx context.Context, zaConf *ZedAmigoProviderConfig, res
 		return
 	}
 
-	// ip command.
+	// ip command. The netlink backend only needs it to run daemons inside a
+	// network namespace and for the TAP mover.
 	ip, err := zaConf.Exec.LookPath(ctx, "ip")
 	if err != nil {
-		resp.Diagnostics.AddError("Can't find `ip`.",
-			fmt.Sprintf("Can't find `ip`, got error: %v", err))
-		return
+		if zaConf.NetworkBackend == networkBackendIPRoute2 {
+			resp.Diagnostics.AddError("Can't find `ip`.",
+				fmt.Sprintf("Can't find `ip`, got error: %v", err))
+			return
+		}
+		resp.Diagnostics.AddWarning("Can't find `ip`.",
+			fmt.Sprintf("This warning can be ignored if you DO NOT run daemons (DHCP server, RADV, ...) inside a network namespace nor use `zedamigo_tap` with `netns`. Can't find `ip`, got error: %v", err))
 	}
 	zaConf.IP = ip
 
+	// bridge and wg commands (optional; only the iproute2 backend of the
+	// bridge_vlan and wireguard resources needs them).
+	if zaConf.NetworkBackend == networkBackendIPRoute2 {
+		brCmd, err := zaConf.Exec.LookPath(ctx, "bridge")
+		if err != nil {
+			resp.Diagnostics.AddWarning("Can't find the `bridge` executable.",
+				fmt.Sprintf("This warning can be ignored if you DO NOT use the bridge_vlan resource. Can't find `bridge`, got error: %v", err))
+		}
+		zaConf.Bridge = brCmd
+
+		wgCmd, err := zaConf.Exec.LookPath(ctx, "wg")
+		if err != nil {
+			resp.Diagnostics.AddWarning("Can't find the `wg` executable.",
+				fmt.Sprintf("This warning can be ignored if you DO NOT use the wireguard resource. Can't find `wg`, got error: %v", err))
+		}
+		zaConf.Wg = wgCmd
+	}
+
+	// nft command (optional; only the nat and firewall resources need it).
+	nft, err := zaConf.Exec.LookPath(ctx, "nft")
+	if err != nil {
+		resp.Diagnostics.AddWarning("Can't find the `nft` executable.",
+			fmt.Sprintf("This warning can be ignored if you DO NOT use the nat or firewall resources. Can't find `nft`, got error: %v", err))
+	}
+	zaConf.Nft = nft
+
+	// sysctl command (optional; only the IP forwarding of the nat resource
+	// and the sysctls of the netns resource need it).
+	sysctl, err := zaConf.Exec.LookPath(ctx, "sysctl")
+	if err != nil {
+		resp.Diagnostics.AddWarning("Can't find the `sysctl` executable.",
+			fmt.Sprintf("This warning can be ignored if you DO NOT use the nat resource with enable_forwarding or the netns resource with sysctls. Can't find `sysctl`, got error: %v", err))
+	}
+	zaConf.Sysctl = sysctl
+
 	zaConf.QemuImg = qi
 
 	// taskset (optional).
@@ -6,7 +6,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net/netip"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -15,14 +18,17 @@ import (
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
 	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
-	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
@@ -33,13 +39,26 @@ const (
 	radvDir            = "radv"
 	radvConfigTemplate = `# Router Advertisement configuration
 interface: {{ .Interface }}
-prefix: {{ .Prefix }}
-prefix_on_link: {{ .PrefixOnLink }}
-prefix_autonomous: {{ .PrefixAutonomous }}
-prefix_valid_lifetime: {{ .PrefixValidLifetime }}
-prefix_preferred_lifetime: {{ .PrefixPreferredLifetime }}
-routes: [{{ range $i, $e := .Routes }}{{if $i}},{{end}}"{{ .Prefix.ValueString }}"{{end}}]
-dns_servers: {{ .DNSServers }}
+prefixes:{{ if not .Prefixes }} []{{ end }}
+{{- range .Prefixes }}
+  - prefix: "{{ .Prefix }}"
+    on_link: {{ .OnLink }}
+    autonomous: {{ .Autonomous }}
+    valid_lifetime: {{ .ValidLifetime }}
+    preferred_lifetime: {{ .PreferredLifetime }}
+{{- end }}
+routes: [{{ range $i, $e := .Routes }}{{if $i}}, {{end}}"{{ . }}"{{end}}]
+rdnss: [{{ range $i, $e := .DNSServers }}{{if $i}}, {{end}}"{{ . }}"{{end}}]
+rdnss_lifetime: {{ .RDNSSLifetime }}
+dnssl: [{{ range $i, $e := .DNSSearch }}{{if $i}}, {{end}}"{{ . }}"{{end}}]
+dnssl_lifetime: {{ .DNSSLLifetime }}
+mtu: {{ .MTU }}
+{{- if .PREF64 }}
+pref64:
+  prefix: "{{ .PREF64 }}"
+  lifetime: {{ .PREF64Lifetime }}
+{{- end }}
+router_preference: {{ .RouterPreference }}
 managed_config: {{ .ManagedConfig }}
 other_config: {{ .OtherConfig }}
 router_lifetime: {{ .RouterLifetime }}
@@ -51,8 +70,9 @@ hop_limit: {{ .HopLimit }}
 
 // Ensure provider defined types fully satisfy framework interfaces.
 var (
-	_ resource.Resource                = &RADV{}
-	_ resource.ResourceWithImportState = &RADV{}
+	_ resource.Resource                   = &RADV{}
+	_ resource.ResourceWithImportState    = &RADV{}
+	_ resource.ResourceWithValidateConfig = &RADV{}
 )
 
 func NewRADV() resource.Resource {
@@ -69,26 +89,45 @@ type RadvRouteModel struct {
 	Prefix types.String `tfsdk:"prefix"`
 }
 
+// RadvPrefixModel describes an additional advertised prefix.
+type RadvPrefixModel struct {
+	Prefix            types.String `tfsdk:"prefix"`
+	OnLink            types.Bool   `tfsdk:"on_link"`
+	Autonomous        types.Bool   `tfsdk:"autonomous"`
+	ValidLifetime     types.Int64  `tfsdk:"valid_lifetime"`
+	PreferredLifetime types.Int64  `tfsdk:"preferred_lifetime"`
+}
+
 // RADVModel describes the resource data model.
 type RADVModel struct {
-	ID                      types.String     `tfsdk:"id"`
-	Interface               types.String     `tfsdk:"interface"`
-	Prefix                  types.String     `tfsdk:"prefix"`
-	Routes                  []RadvRouteModel `tfsdk:"route"`
-	PrefixOnLink            types.Bool       `tfsdk:"prefix_on_link"`
-	PrefixAutonomous        types.Bool       `tfsdk:"prefix_autonomous"`
-	PrefixValidLifetime     types.Int64      `tfsdk:"prefix_valid_lifetime"`
-	PrefixPreferredLifetime types.Int64      `tfsdk:"prefix_preferred_lifetime"`
-	DNSServers              types.String     `tfsdk:"dns_servers"`
-	ManagedConfig           types.Bool       `tfsdk:"managed_config"`
-	OtherConfig             types.Bool       `tfsdk:"other_config"`
-	RouterLifetime          types.Int64      `tfsdk:"router_lifetime"`
-	MaxInterval             types.Int64      `tfsdk:"max_interval"`
-	MinInterval             types.Int64      `tfsdk:"min_interval"`
-	HopLimit                types.Int64      `tfsdk:"hop_limit"`
-	ConfigFile              types.String     `tfsdk:"config_file"`
-	PIDFile                 types.String     `tfsdk:"pid_file"`
-	State                   types.String     `tfsdk:"state"`
+	ID                      types.String      `tfsdk:"id"`
+	Interface               types.String      `tfsdk:"interface"`
+	Prefix                  types.String      `tfsdk:"prefix"`
+	ExtraPrefixes           []RadvPrefixModel `tfsdk:"extra_prefix"`
+	Routes                  []RadvRouteModel  `tfsdk:"route"`
+	PrefixOnLink            types.Bool        `tfsdk:"prefix_on_link"`
+	PrefixAutonomous        types.Bool        `tfsdk:"prefix_autonomous"`
+	PrefixValidLifetime     types.Int64       `tfsdk:"prefix_valid_lifetime"`
+	PrefixPreferredLifetime types.Int64       `tfsdk:"prefix_preferred_lifetime"`
+	DNSServers              types.String      `tfsdk:"dns_servers"`
+	RDNSSLifetime           types.Int64       `tfsdk:"rdnss_lifetime"`
+	DNSSearch               types.List        `tfsdk:"dns_search"`
+	DNSSLLifetime           types.Int64       `tfsdk:"dnssl_lifetime"`
+	MTU                     types.Int64       `tfsdk:"mtu"`
+	PREF64                  types.String      `tfsdk:"pref64"`
+	PREF64Lifetime          types.Int64       `tfsdk:"pref64_lifetime"`
+	RouterPreference        types.String      `tfsdk:"router_preference"`
+	ManagedConfig           types.Bool        `tfsdk:"managed_config"`
+	OtherConfig             types.Bool        `tfsdk:"other_config"`
+	RouterLifetime          types.Int64       `tfsdk:"router_lifetime"`
+	MaxInterval             types.Int64       `tfsdk:"max_interval"`
+	MinInterval             types.Int64       `tfsdk:"min_interval"`
+	HopLimit                types.Int64       `tfsdk:"hop_limit"`
+	ConfigFile              types.String      `tfsdk:"config_file"`
+	PIDFile                 types.String      `tfsdk:"pid_file"`
+	State                   types.String      `tfsdk:"state"`
+	Restarts                types.Int64       `tfsdk:"restarts"`
+	LastExit                types.String      `tfsdk:"last_exit"`
 }
 
 func (r *RADV) getResourceDir(id string) string {
@@ -105,6 +144,9 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 		MarkdownDescription: undent.Md(`Create and manage an IPv6 Router Advertisement daemon for a specific interface.
 		This resource sends periodic Router Advertisements (RAs) according to RFC 4861, enabling IPv6 autoconfiguration
 		for clients on the network. Uses the github.com/mdlayher/ndp library.
+		Changes are applied in place: the daemon reloads its configuration and sends an unsolicited RA right away,
+		removed prefixes and routes are advertised once more with a zero lifetime so that the clients deprecate them.
+		Only changing the interface replaces the daemon, the SLAAC addresses of the clients don't drop otherwise.
 		NOTE: This resource DOES NOT configure IP forwarding or firewall rules.`),
 
 		Attributes: map[string]schema.Attribute{
@@ -127,11 +169,9 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 				Description: "IPv6 prefix in CIDR notation (e.g., 'fd00:abcd:1234::/64')",
 				MarkdownDescription: undent.Md(`IPv6 prefix to advertise in Router Advertisements.
 				This prefix will be used by clients for SLAAC (if prefix_autonomous is true).
-				Example: 'fd00:abcd:1234::/64'`),
-				Required: true,
-				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
-				},
+				Example: 'fd00:abcd:1234::/64'. More prefixes can be advertised with |extra_prefix| blocks.
+				Can be omitted to only advertise the default router, e.g. when DHCPv6 assigns the addresses.`),
+				Optional: true,
 			},
 			"prefix_on_link": schema.BoolAttribute{
 				Description: "Prefix on-link flag (L-bit)",
@@ -139,6 +179,7 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 				Typically set to true. Default: true`),
 				Optional: true,
 				Computed: true,
+				Default:  booldefault.StaticBool(true),
 			},
 			"prefix_autonomous": schema.BoolAttribute{
 				Description: "Prefix autonomous flag (A-bit) for SLAAC",
@@ -146,6 +187,7 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 				autoconfiguration (SLAAC). Set to false if you want to use DHCPv6 only for addressing. Default: true`),
 				Optional: true,
 				Computed: true,
+				Default:  booldefault.StaticBool(true),
 			},
 			"prefix_valid_lifetime": schema.Int64Attribute{
 				Description:         "Prefix valid lifetime in seconds",
@@ -167,12 +209,71 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 				Multiple servers can be separated by commas. Example: '2606:4700:4700::1111,2606:4700:4700::1001'`),
 				Optional: true,
 			},
+			"rdnss_lifetime": schema.Int64Attribute{
+				Description:         "Lifetime of the RDNSS option in seconds",
+				MarkdownDescription: "Lifetime in seconds of the advertised DNS servers. RFC 8106 recommends at least 3 * max_interval. Default: router_lifetime",
+				Optional:            true,
+				Validators: []validator.Int64{
+					int64validator.Between(1, 4294967295),
+				},
+			},
+			"dns_search": schema.ListAttribute{
+				Description: "DNS search list to advertise via the DNSSL option (RFC 8106)",
+				ElementType: types.StringType,
+				Optional:    true,
+				Validators: []validator.List{
+					listvalidator.ValueStringsAre(
+						stringvalidator.RegexMatches(dhcpHostnameRegex, "must be a valid domain name"),
+					),
+				},
+			},
+			"dnssl_lifetime": schema.Int64Attribute{
+				Description:         "Lifetime of the DNSSL option in seconds",
+				MarkdownDescription: "Lifetime in seconds of the advertised DNS search list. Default: router_lifetime",
+				Optional:            true,
+				Validators: []validator.Int64{
+					int64validator.Between(1, 4294967295),
+				},
+			},
+			"mtu": schema.Int64Attribute{
+				Description:         "Link MTU to advertise via the MTU option",
+				MarkdownDescription: "Link MTU to advertise via the MTU option, e.g. to test the EVE nodes behind a tunnel. Not sent by default.",
+				Optional:            true,
+				Validators: []validator.Int64{
+					int64validator.Between(1280, 65535),
+				},
+			},
+			"pref64": schema.StringAttribute{
+				Description: "NAT64 prefix to advertise via the PREF64 option (RFC 8781)",
+				MarkdownDescription: undent.Md(`NAT64 prefix to advertise via the PREF64 option (RFC 8781), e.g. |64:ff9b::/96|.
+				The prefix length must be one of 96, 64, 56, 48, 40 or 32. Not sent by default.`),
+				Optional: true,
+			},
+			"pref64_lifetime": schema.Int64Attribute{
+				Description:         "Lifetime of the PREF64 option in seconds",
+				MarkdownDescription: "Lifetime in seconds of the advertised NAT64 prefix, sent in units of 8 seconds. Default: 3 * max_interval",
+				Optional:            true,
+				Validators: []validator.Int64{
+					int64validator.Between(8, 65528),
+				},
+			},
+			"router_preference": schema.StringAttribute{
+				Description:         "Default router preference (RFC 4191)",
+				MarkdownDescription: `Default router preference (RFC 4191), one of "low", "medium" or "high". Default: "medium"`,
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString("medium"),
+				Validators: []validator.String{
+					stringvalidator.OneOf("low", "medium", "high"),
+				},
+			},
 			"managed_config": schema.BoolAttribute{
 				Description: "Managed address configuration flag (M-bit)",
 				MarkdownDescription: undent.Md(`When true, tells clients to use DHCPv6 for address assignment.
 				Set to true when using DHCPv6 for addresses instead of SLAAC. Default: false`),
 				Optional: true,
 				Computed: true,
+				Default:  booldefault.StaticBool(false),
 			},
 			"other_config": schema.BoolAttribute{
 				Description: "Other configuration flag (O-bit)",
@@ -180,6 +281,7 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 				(e.g., DNS, NTP) beyond addresses. Default: false`),
 				Optional: true,
 				Computed: true,
+				Default:  booldefault.StaticBool(false),
 			},
 			"router_lifetime": schema.Int64Attribute{
 				Description:         "Router lifetime in seconds",
@@ -212,11 +314,19 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 			"config_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "The auto-generated RADV configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"pid_file": schema.StringAttribute{
 				Computed:    true,
 				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 			"state": schema.StringAttribute{
 				Optional:    true,
 				Computed:    true,
@@ -226,14 +336,38 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 			},
 		},
 		Blocks: map[string]schema.Block{
+			"extra_prefix": schema.ListNestedBlock{
+				Description: "More prefixes to advertise in addition to `prefix`, each with its own flags and lifetimes.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"prefix": schema.StringAttribute{
+							Description: "IPv6 prefix in CIDR notation (e.g. 'fd00:abcd:5678::/64').",
+							Required:    true,
+						},
+						"on_link": schema.BoolAttribute{
+							Description: "Prefix on-link flag (L-bit). Defaults to `prefix_on_link`.",
+							Optional:    true,
+						},
+						"autonomous": schema.BoolAttribute{
+							Description: "Prefix autonomous flag (A-bit) for SLAAC. Defaults to `prefix_autonomous`.",
+							Optional:    true,
+						},
+						"valid_lifetime": schema.Int64Attribute{
+							Description: "Prefix valid lifetime in seconds. Defaults to `prefix_valid_lifetime`.",
+							Optional:    true,
+						},
+						"preferred_lifetime": schema.Int64Attribute{
+							Description: "Prefix preferred lifetime in seconds. Defaults to `prefix_preferred_lifetime`.",
+							Optional:    true,
+						},
+					},
+				},
+			},
 			"route": schema.ListNestedBlock{
 				Description: "List of more-specific routes to be advertised to clients (RFC 4191).",
 				Validators: []validator.List{
 					listvalidator.SizeAtLeast(0),
 				},
-				PlanModifiers: []planmodifier.List{
-					listplanmodifier.RequiresReplace(),
-				},
 				NestedObject: schema.NestedBlockObject{
 					Attributes: map[string]schema.Attribute{
 						"prefix": schema.StringAttribute{
@@ -247,6 +381,56 @@ func (r *RADV) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 	}
 }
 
+func (r *RADV) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data RADVModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	seen := make(map[netip.Prefix]bool)
+	checkPrefix := func(p path.Path, prefix types.String) {
+		if prefix.IsNull() || prefix.IsUnknown() {
+			return
+		}
+		pfx, err := radvPrefix(prefix.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(p, "Invalid prefix", err.Error())
+			return
+		}
+		if seen[pfx] {
+			resp.Diagnostics.AddAttributeError(p, "Duplicate prefix",
+				fmt.Sprintf("The prefix %s is advertised more than once.", pfx))
+		}
+		seen[pfx] = true
+	}
+	checkPrefix(path.Root("prefix"), data.Prefix)
+	for i, p := range data.ExtraPrefixes {
+		checkPrefix(path.Root("extra_prefix").AtListIndex(i).AtName("prefix"), p.Prefix)
+	}
+	for i, rt := range data.Routes {
+		if rt.Prefix.IsUnknown() {
+			continue
+		}
+		if _, err := radvPrefix(rt.Prefix.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("route").AtListIndex(i).AtName("prefix"), "Invalid route", err.Error())
+		}
+	}
+
+	if !data.DNSServers.IsNull() && !data.DNSServers.IsUnknown() {
+		if _, err := radvDNSServers(data.DNSServers.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("dns_servers"), "Invalid DNS server", err.Error())
+		}
+	}
+
+	if !data.PREF64.IsNull() && !data.PREF64.IsUnknown() {
+		if _, err := radvPREF64(data.PREF64.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("pref64"), "Invalid PREF64 prefix", err.Error())
+		}
+	}
+}
+
 func (r *RADV) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
 	if req.ProviderData == nil {
 		return
@@ -296,71 +480,9 @@ func (r *RADV) Create(ctx context.Context, req resource.CreateRequest, resp *res
 		return
 	}
 
-	// Set default values for boolean fields if not specified.
-	if data.PrefixOnLink.IsNull() || data.PrefixOnLink.IsUnknown() {
-		data.PrefixOnLink = types.BoolValue(true)
-	}
-	if data.PrefixAutonomous.IsNull() || data.PrefixAutonomous.IsUnknown() {
-		data.PrefixAutonomous = types.BoolValue(true)
-	}
-	if data.ManagedConfig.IsNull() || data.ManagedConfig.IsUnknown() {
-		data.ManagedConfig = types.BoolValue(false)
-	}
-	if data.OtherConfig.IsNull() || data.OtherConfig.IsUnknown() {
-		data.OtherConfig = types.BoolValue(false)
-	}
-
-	tmpl, err := template.New("config").Parse(radvConfigTemplate)
-	if err != nil {
-		resp.Diagnostics.AddError("RADV Resource Error",
-			fmt.Sprintf("Unable to parse config template: %s", err))
-		return
-	}
-
-	confPath := filepath.Join(d, "config.yaml")
-	confFile, err := r.providerConf.Exec.OpenWrite(ctx, confPath, 0o644)
-	if err != nil {
-		resp.Diagnostics.AddError("RADV Resource Error",
-			fmt.Sprintf("Can't create file '%s': %s", confPath, err))
-		return
-	}
-	defer confFile.Close()
-	data.ConfigFile = types.StringValue(confPath)
-
-	td := struct {
-		Interface               string
-		Prefix                  string
-		Routes                  []RadvRouteModel
-		PrefixOnLink            bool
-		PrefixAutonomous        bool
-		PrefixValidLifetime     int64
-		PrefixPreferredLifetime int64
-		DNSServers              string
-		ManagedConfig           bool
-		OtherConfig             bool
-		RouterLifetime          int64
-		MaxInterval             int64
-		MinInterval             int64
-		HopLimit                int64
-	}{
-		Interface:               data.Interface.ValueString(),
-		Prefix:                  data.Prefix.ValueString(),
-		Routes:                  data.Routes,
-		PrefixOnLink:            data.PrefixOnLink.ValueBool(),
-		PrefixAutonomous:        data.PrefixAutonomous.ValueBool(),
-		PrefixValidLifetime:     data.PrefixValidLifetime.ValueInt64(),
-		PrefixPreferredLifetime: data.PrefixPreferredLifetime.ValueInt64(),
-		DNSServers:              data.DNSServers.ValueString(),
-		ManagedConfig:           data.ManagedConfig.ValueBool(),
-		OtherConfig:             data.OtherConfig.ValueBool(),
-		RouterLifetime:          data.RouterLifetime.ValueInt64(),
-		MaxInterval:             data.MaxInterval.ValueInt64(),
-		MinInterval:             data.MinInterval.ValueInt64(),
-		HopLimit:                data.HopLimit.ValueInt64(),
-	}
-	if err := tmpl.Execute(confFile, td); err != nil {
-		resp.Diagnostics.AddError("RADV Resource Error",
-			fmt.Sprintf("Can't write templated config file '%s': %s", confPath, err))
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	if diags := writeRADVConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
 		return
 	}
 
@@ -429,18 +551,57 @@ func (r *RADV) Update(ctx context.Context, req resource.UpdateRequest, resp *res
 
 	d := r.getResourceDir(state.ID.ValueString())
 
-	// Check if only the state field changed
-	stateChanged := !plan.State.Equal(state.State)
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
 
-	// Most config changes require recreation (marked with RequiresReplace)
-	// Only state changes are allowed in-place
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
 
-	if stateChanged {
-		desiredState := plan.State.ValueString()
-		if desiredState == "" {
-			desiredState = "running"
+	stateChanged := !plan.State.Equal(state.State)
+
+	// Everything but the interface lives in the config file, a running
+	// daemon reloads it and advertises the changes right away. Restarting it
+	// instead could make the clients drop their SLAAC addresses.
+	configChanged := !plan.Prefix.Equal(state.Prefix) ||
+		!equalRadvPrefixes(plan.ExtraPrefixes, state.ExtraPrefixes) ||
+		!slices.Equal(plan.Routes, state.Routes) ||
+		!plan.PrefixOnLink.Equal(state.PrefixOnLink) ||
+		!plan.PrefixAutonomous.Equal(state.PrefixAutonomous) ||
+		!plan.PrefixValidLifetime.Equal(state.PrefixValidLifetime) ||
+		!plan.PrefixPreferredLifetime.Equal(state.PrefixPreferredLifetime) ||
+		!plan.DNSServers.Equal(state.DNSServers) ||
+		!plan.RDNSSLifetime.Equal(state.RDNSSLifetime) ||
+		!plan.DNSSearch.Equal(state.DNSSearch) ||
+		!plan.DNSSLLifetime.Equal(state.DNSSLLifetime) ||
+		!plan.MTU.Equal(state.MTU) ||
+		!plan.PREF64.Equal(state.PREF64) ||
+		!plan.PREF64Lifetime.Equal(state.PREF64Lifetime) ||
+		!plan.RouterPreference.Equal(state.RouterPreference) ||
+		!plan.ManagedConfig.Equal(state.ManagedConfig) ||
+		!plan.OtherConfig.Equal(state.OtherConfig) ||
+		!plan.RouterLifetime.Equal(state.RouterLifetime) ||
+		!plan.MaxInterval.Equal(state.MaxInterval) ||
+		!plan.MinInterval.Equal(state.MinInterval) ||
+		!plan.HopLimit.Equal(state.HopLimit)
+	if configChanged {
+		if diags := writeRADVConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
 		}
+		if desiredState == "running" {
+			if err := r.reloadRADV(ctx, d); err != nil {
+				resp.Diagnostics.AddError("RADV Resource Update Error",
+					fmt.Sprintf("Failed to reload RADV daemon: %v", err))
+				return
+			}
+		}
+		tflog.Info(ctx, "RADV configuration changed", map[string]any{"reload": desiredState == "running"})
+	}
 
+	if stateChanged {
 		tflog.Info(ctx, "RADV state change requested", map[string]any{
 			"from": state.State.ValueString(),
 			"to":   desiredState,
@@ -499,13 +660,9 @@ func (r *RADV) ImportState(ctx context.Context, req resource.ImportStateRequest,
 
 func (r *RADV) startRADV(ctx context.Context, d string, data *RADVModel) error {
 	self := r.providerConf.Exec.SelfPath()
-	srvCmd := self
-	srvArgs := []string{}
-	if r.providerConf.UseSudo {
-		srvCmd = r.providerConf.Sudo
-		srvArgs = []string{"-n", self}
-	}
-	moreArgs := []string{"-pid-file", data.PIDFile.ValueString(), "-radv", "-radv.wait", "-radv.config", data.ConfigFile.ValueString()}
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, "", self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-radv", "-radv.wait", "-radv.config", data.ConfigFile.ValueString())
 	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
 		return fmt.Errorf("failed to start RADV daemon: %w, diagnostics: %v", err, res.Diagnostics())
 	}
@@ -527,6 +684,20 @@ func (r *RADV) stopRADV(ctx context.Context, d string) error {
 	return nil
 }
 
+// reloadRADV makes a running RADV daemon reload its config file and send an
+// unsolicited RA. A stopped daemon reads the config file when started.
+func (r *RADV) reloadRADV(ctx context.Context, d string) error {
+	running, pid, err := readRADVPID(ctx, r.providerConf.Exec, d)
+	if err != nil || !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGHUP); err != nil {
+		return fmt.Errorf("can't signal RADV daemon process: %w", err)
+	}
+	return nil
+}
+
 func (r *RADV) readRADV(ctx context.Context, resPath string, model *RADVModel) (diag.Diagnostics, error) {
 	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
 		return nil, fmt.Errorf("resource directory does not exist")
@@ -559,6 +730,7 @@ func (r *RADV) readRADV(ctx context.Context, resPath string, model *RADVModel) (
 	}
 
 	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
 
 	return nil, nil
 }
@@ -582,3 +754,198 @@ func readRADVPID(ctx context.Context, ex exec.Executor, path string) (bool, int,
 
 	return running, int(pid), nil
 }
+
+func equalRadvPrefixes(a, b []RadvPrefixModel) bool {
+	return slices.EqualFunc(a, b, func(x, y RadvPrefixModel) bool {
+		return x.Prefix.Equal(y.Prefix) && x.OnLink.Equal(y.OnLink) && x.Autonomous.Equal(y.Autonomous) &&
+			x.ValidLifetime.Equal(y.ValidLifetime) && x.PreferredLifetime.Equal(y.PreferredLifetime)
+	})
+}
+
+// radvPrefix parses an IPv6 prefix of an advertised prefix or route.
+func radvPrefix(s string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is not a prefix in CIDR notation", s)
+	}
+	if !p.Addr().Is6() || p.Addr().Is4In6() {
+		return netip.Prefix{}, fmt.Errorf("%q is not an IPv6 prefix", s)
+	}
+	return p.Masked(), nil
+}
+
+// radvPREF64 parses a NAT64 prefix, RFC 8781 only allows some lengths.
+func radvPREF64(s string) (netip.Prefix, error) {
+	p, err := radvPrefix(s)
+	if err != nil {
+		return p, err
+	}
+	if !slices.Contains([]int{96, 64, 56, 48, 40, 32}, p.Bits()) {
+		return netip.Prefix{}, fmt.Errorf("the length of %q must be one of 96, 64, 56, 48, 40 or 32", s)
+	}
+	return p, nil
+}
+
+// radvDNSServers parses the comma separated `dns_servers`.
+func radvDNSServers(s string) ([]string, error) {
+	var servers []string
+	for _, srv := range strings.Split(s, ",") {
+		srv = strings.TrimSpace(srv)
+		if srv == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(srv)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return nil, fmt.Errorf("%q is not an IPv6 address", srv)
+		}
+		servers = append(servers, addr.String())
+	}
+	return servers, nil
+}
+
+type radvPrefixConfig struct {
+	Prefix            string
+	OnLink            bool
+	Autonomous        bool
+	ValidLifetime     int64
+	PreferredLifetime int64
+}
+
+type radvConfig struct {
+	Interface     string
+	Prefixes      []radvPrefixConfig
+	Routes        []string
+	DNSServers    []string
+	RDNSSLifetime int64
+	DNSSearch     []string
+	DNSSLLifetime int64
+	MTU           int64
+	// PREF64 is the NAT64 prefix, a zero PREF64Lifetime lets the daemon pick
+	// one based on max_interval.
+	PREF64           string
+	PREF64Lifetime   int64
+	RouterPreference string
+	ManagedConfig    bool
+	OtherConfig      bool
+	RouterLifetime   int64
+	MaxInterval      int64
+	MinInterval      int64
+	HopLimit         int64
+}
+
+func newRADVConfig(ctx context.Context, data *RADVModel) (radvConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	cfg := radvConfig{
+		Interface:        data.Interface.ValueString(),
+		RDNSSLifetime:    data.RDNSSLifetime.ValueInt64(),
+		DNSSLLifetime:    data.DNSSLLifetime.ValueInt64(),
+		MTU:              data.MTU.ValueInt64(),
+		PREF64Lifetime:   data.PREF64Lifetime.ValueInt64(),
+		RouterPreference: data.RouterPreference.ValueString(),
+		ManagedConfig:    data.ManagedConfig.ValueBool(),
+		OtherConfig:      data.OtherConfig.ValueBool(),
+		RouterLifetime:   data.RouterLifetime.ValueInt64(),
+		MaxInterval:      data.MaxInterval.ValueInt64(),
+		MinInterval:      data.MinInterval.ValueInt64(),
+		HopLimit:         data.HopLimit.ValueInt64(),
+	}
+	if cfg.RouterPreference == "" {
+		cfg.RouterPreference = "medium"
+	}
+
+	// The extra prefixes inherit what they don't set from the prefix_*
+	// attributes.
+	prefixes := data.ExtraPrefixes
+	if !data.Prefix.IsNull() && data.Prefix.ValueString() != "" {
+		prefixes = append([]RadvPrefixModel{{Prefix: data.Prefix}}, prefixes...)
+	}
+	for _, p := range prefixes {
+		prefix, err := radvPrefix(p.Prefix.ValueString())
+		if err != nil {
+			diags.AddError("RADV Resource Error", fmt.Sprintf("Invalid prefix: %s", err))
+			continue
+		}
+		pc := radvPrefixConfig{
+			Prefix:            prefix.String(),
+			OnLink:            data.PrefixOnLink.ValueBool(),
+			Autonomous:        data.PrefixAutonomous.ValueBool(),
+			ValidLifetime:     data.PrefixValidLifetime.ValueInt64(),
+			PreferredLifetime: data.PrefixPreferredLifetime.ValueInt64(),
+		}
+		if !p.OnLink.IsNull() {
+			pc.OnLink = p.OnLink.ValueBool()
+		}
+		if !p.Autonomous.IsNull() {
+			pc.Autonomous = p.Autonomous.ValueBool()
+		}
+		if !p.ValidLifetime.IsNull() {
+			pc.ValidLifetime = p.ValidLifetime.ValueInt64()
+		}
+		if !p.PreferredLifetime.IsNull() {
+			pc.PreferredLifetime = p.PreferredLifetime.ValueInt64()
+		}
+		if pc.PreferredLifetime > pc.ValidLifetime {
+			diags.AddError("RADV Resource Error",
+				fmt.Sprintf("The preferred lifetime of the prefix %s is longer than its valid lifetime", pc.Prefix))
+		}
+		cfg.Prefixes = append(cfg.Prefixes, pc)
+	}
+
+	for _, rt := range data.Routes {
+		prefix, err := radvPrefix(rt.Prefix.ValueString())
+		if err != nil {
+			diags.AddError("RADV Resource Error", fmt.Sprintf("Invalid route: %s", err))
+			continue
+		}
+		cfg.Routes = append(cfg.Routes, prefix.String())
+	}
+
+	servers, err := radvDNSServers(data.DNSServers.ValueString())
+	if err != nil {
+		diags.AddError("RADV Resource Error", fmt.Sprintf("Invalid DNS server: %s", err))
+	}
+	cfg.DNSServers = servers
+
+	if !data.DNSSearch.IsNull() && !data.DNSSearch.IsUnknown() {
+		diags.Append(data.DNSSearch.ElementsAs(ctx, &cfg.DNSSearch, false)...)
+	}
+
+	if !data.PREF64.IsNull() && data.PREF64.ValueString() != "" {
+		prefix, err := radvPREF64(data.PREF64.ValueString())
+		if err != nil {
+			diags.AddError("RADV Resource Error", fmt.Sprintf("Invalid PREF64 prefix: %s", err))
+		}
+		cfg.PREF64 = prefix.String()
+	}
+
+	return cfg, diags
+}
+
+func renderRADVConfig(w io.Writer, cfg radvConfig) error {
+	tmpl, err := template.New("config").Parse(radvConfigTemplate)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+func writeRADVConfig(ctx context.Context, ex exec.Executor, data *RADVModel) diag.Diagnostics {
+	cfg, diags := newRADVConfig(ctx, data)
+	if diags.HasError() {
+		return diags
+	}
+
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		diags.AddError("RADV Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderRADVConfig(confFile, cfg); err != nil {
+		diags.AddError("RADV Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRADVPREF64(t *testing.T) {
+	is := is.New(t)
+
+	got, err := radvPREF64("64:ff9b::1/96")
+	is.NoErr(err)
+	is.Equal(got.String(), "64:ff9b::/96") // masked
+
+	for _, s := range []string{"64:ff9b::/80", "10.0.0.0/8", "::ffff:10.0.0.0/104", "64:ff9b::"} {
+		_, err := radvPREF64(s)
+		is.True(err != nil)
+	}
+}
+
+func TestRADVDNSServers(t *testing.T) {
+	is := is.New(t)
+
+	got, err := radvDNSServers(" 2001:db8::53, 2001:DB8::54,")
+	is.NoErr(err)
+	is.Equal(got, []string{"2001:db8::53", "2001:db8::54"})
+
+	got, err = radvDNSServers("")
+	is.NoErr(err)
+	is.Equal(len(got), 0)
+
+	_, err = radvDNSServers("2001:db8::53,10.0.0.53")
+	is.True(err != nil)
+}
+
+func TestRenderRADVConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := RADVModel{
+		Interface:               types.StringValue("br0"),
+		Prefix:                  types.StringValue("fd00:1::/64"),
+		PrefixOnLink:            types.BoolValue(true),
+		PrefixAutonomous:        types.BoolValue(true),
+		PrefixValidLifetime:     types.Int64Value(86400),
+		PrefixPreferredLifetime: types.Int64Value(14400),
+		ExtraPrefixes: []RadvPrefixModel{{
+			Prefix:            types.StringValue("fd00:2::1/64"),
+			OnLink:            types.BoolNull(),
+			Autonomous:        types.BoolValue(false),
+			ValidLifetime:     types.Int64Null(),
+			PreferredLifetime: types.Int64Value(0),
+		}},
+		Routes:           []RadvRouteModel{{Prefix: types.StringValue("2001:db8:1::/48")}},
+		DNSServers:       types.StringValue("fd00:1::53"),
+		RDNSSLifetime:    types.Int64Value(1800),
+		DNSSearch:        types.ListValueMust(types.StringType, []attr.Value{types.StringValue("lab.local")}),
+		DNSSLLifetime:    types.Int64Null(),
+		MTU:              types.Int64Value(1400),
+		PREF64:           types.StringValue("64:ff9b::/96"),
+		PREF64Lifetime:   types.Int64Null(),
+		RouterPreference: types.StringValue("high"),
+		RouterLifetime:   types.Int64Value(1800),
+		MaxInterval:      types.Int64Value(600),
+		MinInterval:      types.Int64Value(200),
+		HopLimit:         types.Int64Value(64),
+	}
+	cfg, diags := newRADVConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+
+	var buf bytes.Buffer
+	is.NoErr(renderRADVConfig(&buf, cfg))
+
+	// Same fields as the daemon config.
+	var got struct {
+		Interface string `yaml:"interface"`
+		Prefixes  []struct {
+			Prefix            string `yaml:"prefix"`
+			OnLink            bool   `yaml:"on_link"`
+			Autonomous        bool   `yaml:"autonomous"`
+			ValidLifetime     int64  `yaml:"valid_lifetime"`
+			PreferredLifetime int64  `yaml:"preferred_lifetime"`
+		} `yaml:"prefixes"`
+		Routes        []string `yaml:"routes"`
+		RDNSS         []string `yaml:"rdnss"`
+		RDNSSLifetime int64    `yaml:"rdnss_lifetime"`
+		DNSSL         []string `yaml:"dnssl"`
+		DNSSLLifetime int64    `yaml:"dnssl_lifetime"`
+		MTU           int64    `yaml:"mtu"`
+		PREF64        *struct {
+			Prefix   string `yaml:"prefix"`
+			Lifetime int64  `yaml:"lifetime"`
+		} `yaml:"pref64"`
+		RouterPreference string `yaml:"router_preference"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Interface, "br0")
+	is.Equal(len(got.Prefixes), 2)
+	is.Equal(got.Prefixes[0].Prefix, "fd00:1::/64")
+	is.Equal(got.Prefixes[1].Prefix, "fd00:2::/64")
+	is.True(got.Prefixes[1].OnLink)                       // inherited
+	is.True(!got.Prefixes[1].Autonomous)                  // set
+	is.Equal(got.Prefixes[1].ValidLifetime, int64(86400)) // inherited
+	is.Equal(got.Prefixes[1].PreferredLifetime, int64(0)) // set, deprecated
+	is.Equal(got.Routes, []string{"2001:db8:1::/48"})
+	is.Equal(got.RDNSS, []string{"fd00:1::53"})
+	is.Equal(got.RDNSSLifetime, int64(1800))
+	is.Equal(got.DNSSL, []string{"lab.local"})
+	is.Equal(got.DNSSLLifetime, int64(0)) // the daemon uses router_lifetime
+	is.Equal(got.MTU, int64(1400))
+	is.Equal(got.PREF64.Prefix, "64:ff9b::/96")
+	is.Equal(got.RouterPreference, "high")
+
+	// Without a prefix only the default router is advertised.
+	data.Prefix = types.StringNull()
+	data.ExtraPrefixes = nil
+	data.PREF64 = types.StringNull()
+	cfg, diags = newRADVConfig(context.Background(), &data)
+	is.True(!diags.HasError())
+	buf.Reset()
+	is.NoErr(renderRADVConfig(&buf, cfg))
+	got.Prefixes, got.PREF64 = nil, nil
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(len(got.Prefixes), 0)
+	is.True(got.PREF64 == nil)
+
+	// The preferred lifetime can't be longer than the valid one.
+	data.Prefix = types.StringValue("fd00:1::/64")
+	data.PrefixPreferredLifetime = types.Int64Value(90000)
+	_, diags = newRADVConfig(context.Background(), &data)
+	is.True(diags.HasError())
+}
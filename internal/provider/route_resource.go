@@ -0,0 +1,431 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	routesDir = "routes"
+
+	// routeTableMain is the main routing table, the one used without
+	// policy routing.
+	routeTableMain = 254
+
+	// routeMetricIPv6 is the metric the kernel gives to IPv6 routes added
+	// without one.
+	routeMetricIPv6 = 1024
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &Route{}
+	_ resource.ResourceWithImportState    = &Route{}
+	_ resource.ResourceWithValidateConfig = &Route{}
+)
+
+func NewRoute() resource.Resource {
+	return &Route{}
+}
+
+// Route defines the resource implementation.
+type Route struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// RouteModel describes the resource data model.
+type RouteModel struct {
+	ID          types.String `tfsdk:"id"`
+	NetNS       types.String `tfsdk:"netns"`
+	Destination types.String `tfsdk:"destination"`
+	Gateway     types.String `tfsdk:"gateway"`
+	Device      types.String `tfsdk:"device"`
+	Source      types.String `tfsdk:"source"`
+	Metric      types.Int64  `tfsdk:"metric"`
+	Table       types.Int64  `tfsdk:"table"`
+}
+
+// route returns the route of the model. A "default" destination is the
+// default route of the family of the gateway or of the source address.
+func (m *RouteModel) route() nlops.Route {
+	r := nlops.Route{
+		Dst:     m.Destination.ValueString(),
+		Gateway: m.Gateway.ValueString(),
+		Dev:     m.Device.ValueString(),
+		Src:     m.Source.ValueString(),
+		Metric:  int(m.Metric.ValueInt64()),
+		Table:   int(m.Table.ValueInt64()),
+	}
+	v6 := false
+	for _, a := range []string{r.Gateway, r.Src} {
+		if ip := net.ParseIP(a); ip != nil {
+			v6 = ip.To4() == nil
+		}
+	}
+	if r.Dst == "default" {
+		r.Dst = "0.0.0.0/0"
+		if v6 {
+			r.Dst = "::/0"
+		}
+	}
+	if _, n, err := net.ParseCIDR(r.Dst); err == nil {
+		r.Dst = n.String()
+	}
+	return r
+}
+
+func (r *Route) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, routesDir, id)
+}
+
+func (r *Route) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_route"
+}
+
+func (r *Route) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Static route",
+		MarkdownDescription: undent.Md(`
+		Add a static route, in the default network namespace or in |netns|, through netlink or
+		iproute2 commands (see the provider |network_backend|). Together with |zedamigo_netns|,
+		|zedamigo_veth| and |zedamigo_nat| it builds multi-hop networks, e.g. an ISP router
+		namespace in front of the uplink of the edge nodes, or makes the |static_route| of a
+		|zedamigo_dhcp_server| actually route on the host.
+
+		The route is identified by its |destination|, |table| and |metric|, changing any of them
+		replaces it; |gateway|, |device| and |source| are changed in place, and restored on
+		refresh when changed outside of Terraform. The kernel deletes the routes through an
+		interface that goes down or loses the address of the gateway's subnet, such a route is
+		added again on the next apply. Use a |zedamigo_rule| to look up another |table|.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Route resource identifier",
+				MarkdownDescription: "Route resource identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace to add the route to, the default one if not specified",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"destination": schema.StringAttribute{
+				Description: "Destination prefix in CIDR format, e.g. `10.1.0.0/16`, or `default` for the default " +
+					"route (of the family of `gateway`)",
+				Required: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"gateway": schema.StringAttribute{
+				Description: "IP address of the next hop. Without it the destination is directly on `device`.",
+				Optional:    true,
+			},
+			"device": schema.StringAttribute{
+				Description: "Interface to send the traffic through. Required without `gateway`.",
+				Optional:    true,
+			},
+			"source": schema.StringAttribute{
+				Description: "Preferred source address of the traffic originating on the host, one of its addresses",
+				Optional:    true,
+			},
+			"metric": schema.Int64Attribute{
+				Description: fmt.Sprintf("Metric (priority) of the route, lower is preferred. Default: `0`, `%d` for IPv6.",
+					routeMetricIPv6),
+				Optional: true,
+				Computed: true,
+				Validators: []validator.Int64{
+					int64validator.Between(0, 1<<32-1),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"table": schema.Int64Attribute{
+				Description: fmt.Sprintf("Routing table (ID) to add the route to. Default: `%d`, the main one.", routeTableMain),
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(routeTableMain),
+				Validators: []validator.Int64{
+					int64validator.Between(1, 1<<32-1),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks the addresses, so that a typo doesn't surface as an
+// EINVAL from the kernel.
+func (r *Route) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data RouteModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ipAttrErrors(&resp.Diagnostics, path.Empty(), map[string]types.String{
+		"gateway": data.Gateway, "source": data.Source,
+	})
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if data.Gateway.IsNull() && data.Device.IsNull() {
+		resp.Diagnostics.AddError("Invalid route configuration", "A route needs a `gateway`, a `device` or both.")
+	}
+	if data.Destination.IsUnknown() || data.Destination.ValueString() == "default" {
+		return
+	}
+	ip, _, err := net.ParseCIDR(data.Destination.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("destination"), "Invalid route configuration",
+			fmt.Sprintf("'%s' is neither a prefix in CIDR format nor `default`.", data.Destination.ValueString()))
+		return
+	}
+	for name, v := range map[string]types.String{"gateway": data.Gateway, "source": data.Source} {
+		if a := net.ParseIP(v.ValueString()); a != nil && (a.To4() == nil) != (ip.To4() == nil) {
+			resp.Diagnostics.AddAttributeError(path.Root(name), "Mixed IP address families",
+				"The destination and the addresses of the route must all be IPv4 or all be IPv6.")
+		}
+	}
+}
+
+func (r *Route) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_route", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Route resource configure debugging", traceData)
+}
+
+func (r *Route) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data RouteModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Route Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	// Pin the metric the kernel would pick, it identifies the route.
+	if data.Metric.IsNull() || data.Metric.IsUnknown() {
+		data.Metric = types.Int64Value(0)
+		if ip, _, err := net.ParseCIDR(data.route().Dst); err == nil && ip.To4() == nil {
+			data.Metric = types.Int64Value(routeMetricIPv6)
+		}
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Route Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Route Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	if diags, err := r.applyRoute(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Route Resource Error",
+			fmt.Sprintf("Unable to add the route: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "Route Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Route) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data RouteModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	routes, diags, err := nl.routes(ctx, d)
+	if err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to read route state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	want := data.route()
+	found, ok := findRoute(routes, want)
+	if err != nil || !ok {
+		// The route (or its namespace) was deleted outside Terraform:
+		// remove from state.
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if routeDrifted(want, found) {
+		tflog.Info(ctx, "Route settings drifted, restoring them", map[string]any{"route": want.Dst})
+		if diags, err := r.applyRoute(ctx, d, nl, &data); err != nil {
+			resp.Diagnostics.AddWarning("Route Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of route '%s': %v", want.Dst, err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Route) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan RouteModel
+	var state RouteModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The destination, table and metric are RequiresReplace, so the route
+	// is replaced with the new gateway, device and source.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.NetNS.ValueString())
+	plan.Metric = state.Metric
+
+	if diags, err := r.applyRoute(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Route Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Route) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data RouteModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the route. If it (or its namespace) doesn't exist the delete
+	// is successful (idempotent).
+	route := data.route()
+	op := nlops.Op{Kind: nlops.OpRouteDel, Name: route.Dst, Route: &route}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete route", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Route Resource Delete Error",
+			fmt.Sprintf("Can't delete route resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Route) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// applyRoute adds the route of model, or replaces the one with the same
+// destination, table and metric.
+func (r *Route) applyRoute(ctx context.Context, resPath string, nl netLinks, model *RouteModel) (diag.Diagnostics, error) {
+	route := model.route()
+	op := nlops.Op{Kind: nlops.OpRouteAdd, Name: route.Dst, Route: &route}
+	if diags, err := nl.apply(ctx, resPath, op); err != nil {
+		return diags, fmt.Errorf("can't apply route '%s': %w", route.Dst, err)
+	}
+	return nil, nil
+}
+
+// findRoute returns the route of routes with the destination, table and
+// metric of want.
+func findRoute(routes []nlops.Route, want nlops.Route) (nlops.Route, bool) {
+	table := want.Table
+	if table == 0 {
+		table = routeTableMain
+	}
+	for _, r := range routes {
+		if r.Dst == want.Dst && r.Table == table && r.Metric == want.Metric {
+			return r, true
+		}
+	}
+	return nlops.Route{}, false
+}
+
+// routeDrifted reports whether the gateway, device or source of the route
+// found differ from the ones of want. The device and source the kernel picks
+// when they are not configured are not a drift.
+func routeDrifted(want, found nlops.Route) bool {
+	sameIP := func(a, b string) bool {
+		return a == b || net.ParseIP(a).Equal(net.ParseIP(b))
+	}
+	return !sameIP(want.Gateway, found.Gateway) ||
+		(want.Dev != "" && want.Dev != found.Dev) ||
+		(want.Src != "" && !sameIP(want.Src, found.Src))
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+func TestRouteModelRoute(t *testing.T) {
+	is := is.New(t)
+
+	m := RouteModel{
+		Destination: types.StringValue("default"),
+		Gateway:     types.StringValue("fd00::fe"),
+		Metric:      types.Int64Value(1024),
+		Table:       types.Int64Value(254),
+	}
+	is.Equal(m.route(), nlops.Route{Dst: "::/0", Gateway: "fd00::fe", Metric: 1024, Table: 254})
+
+	// The destination is normalized as the kernel reports it.
+	m = RouteModel{
+		Destination: types.StringValue("10.20.1.1/16"),
+		Device:      types.StringValue("eth1"),
+		Table:       types.Int64Value(100),
+	}
+	is.Equal(m.route(), nlops.Route{Dst: "10.20.0.0/16", Dev: "eth1", Table: 100})
+}
+
+func TestFindRoute(t *testing.T) {
+	is := is.New(t)
+
+	routes := []nlops.Route{
+		{Dst: "0.0.0.0/0", Gateway: "10.9.0.254", Dev: "d0", Table: 100},
+		{Dst: "0.0.0.0/0", Gateway: "192.0.2.1", Dev: "eth0", Metric: 100, Table: 254},
+		{Dst: "10.9.0.0/24", Dev: "d0", Src: "10.9.0.1", Table: 254},
+	}
+	r, ok := findRoute(routes, nlops.Route{Dst: "0.0.0.0/0", Metric: 100, Table: 254})
+	is.True(ok)
+	is.Equal(r.Gateway, "192.0.2.1")
+	_, ok = findRoute(routes, nlops.Route{Dst: "0.0.0.0/0", Table: 254})
+	is.True(!ok)
+
+	// The device and source picked by the kernel are not a drift.
+	is.True(!routeDrifted(nlops.Route{Dst: "10.9.0.0/24", Dev: "d0"}, routes[2]))
+	is.True(routeDrifted(nlops.Route{Dst: "10.9.0.0/24", Dev: "d1"}, routes[2]))
+	is.True(routeDrifted(nlops.Route{Dst: "0.0.0.0/0", Gateway: "10.9.0.253", Table: 100}, routes[0]))
+	is.True(!routeDrifted(nlops.Route{Dst: "::/0", Gateway: "fd00:0::fe"}, nlops.Route{Dst: "::/0", Gateway: "fd00::fe", Dev: "d0"}))
+}
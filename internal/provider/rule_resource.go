@@ -0,0 +1,444 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const rulesDir = "rules"
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &Rule{}
+	_ resource.ResourceWithImportState    = &Rule{}
+	_ resource.ResourceWithValidateConfig = &Rule{}
+)
+
+func NewRule() resource.Resource {
+	return &Rule{}
+}
+
+// Rule defines the resource implementation.
+type Rule struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// RuleModel describes the resource data model.
+type RuleModel struct {
+	ID       types.String `tfsdk:"id"`
+	NetNS    types.String `tfsdk:"netns"`
+	Family   types.String `tfsdk:"family"`
+	Priority types.Int64  `tfsdk:"priority"`
+	From     types.String `tfsdk:"from"`
+	To       types.String `tfsdk:"to"`
+	IIF      types.String `tfsdk:"iif"`
+	OIF      types.String `tfsdk:"oif"`
+	FwMark   types.Int64  `tfsdk:"fwmark"`
+	FwMask   types.Int64  `tfsdk:"fwmask"`
+	Table    types.Int64  `tfsdk:"table"`
+}
+
+// rule returns the rule of the model, with a negative priority when the
+// kernel is to pick one.
+func (m *RuleModel) rule() nlops.Rule {
+	r := nlops.Rule{
+		Family:   4,
+		Priority: -1,
+		From:     rulePrefix(m.From.ValueString()),
+		To:       rulePrefix(m.To.ValueString()),
+		IIF:      m.IIF.ValueString(),
+		OIF:      m.OIF.ValueString(),
+		FwMark:   uint32(m.FwMark.ValueInt64()),
+		FwMask:   uint32(m.FwMask.ValueInt64()),
+		Table:    int(m.Table.ValueInt64()),
+	}
+	if m.Family.ValueString() == "ipv6" {
+		r.Family = 6
+	}
+	if r.FwMask == 0xffffffff {
+		r.FwMask = 0
+	}
+	if !m.Priority.IsNull() && !m.Priority.IsUnknown() {
+		r.Priority = int(m.Priority.ValueInt64())
+	}
+	return r
+}
+
+// rulePrefix returns the selector prefix s in CIDR format, as the kernel
+// reports it: an address is a host prefix, host bits are cleared.
+func rulePrefix(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32"
+		}
+		return ip.String() + "/128"
+	}
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n.String()
+	}
+	return s
+}
+
+// ruleFamily returns the family ("ipv4" or "ipv6") of the from and to
+// selectors, "" when there are none.
+func ruleFamily(from, to types.String) string {
+	for _, v := range []types.String{from, to} {
+		ip, _, err := net.ParseCIDR(rulePrefix(v.ValueString()))
+		if err != nil {
+			continue
+		}
+		if ip.To4() == nil {
+			return "ipv6"
+		}
+		return "ipv4"
+	}
+	return ""
+}
+
+func (r *Rule) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, rulesDir, id)
+}
+
+func (r *Rule) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_rule"
+}
+
+func (r *Rule) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	rr := []planmodifier.String{stringplanmodifier.RequiresReplace()}
+
+	resp.Schema = schema.Schema{
+		Description: "Routing policy rule",
+		MarkdownDescription: undent.Md(`
+		Add a routing policy rule, like |ip rule add|, in the default network namespace or in
+		|netns|, through netlink or iproute2 commands (see the provider |network_backend|). The
+		packets matching all the selectors (|from|, |to|, |iif|, |oif|, |fwmark|) are routed with
+		the routes of |table|, e.g. ones added by a |zedamigo_route|; a rule without selectors
+		matches all the packets of its |family|.
+
+		All the settings require replacing the rule. A rule deleted outside of Terraform is added
+		again on the next apply.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Rule resource identifier",
+				MarkdownDescription: "Rule resource identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description:   "Network namespace to add the rule to, the default one if not specified",
+				Optional:      true,
+				PlanModifiers: rr,
+			},
+			"family": schema.StringAttribute{
+				Description: `Address family of the rule: "ipv4" or "ipv6". Default: the family of ` +
+					"`from` and `to`, IPv4 without them.",
+				Optional: true,
+				Computed: true,
+				Validators: []validator.String{
+					stringvalidator.OneOf("ipv4", "ipv6"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"priority": schema.Int64Attribute{
+				Description: "Priority of the rule, the rules are evaluated by increasing priority. " +
+					"Default: picked by the kernel, just before the first rule with a priority.",
+				Optional: true,
+				Computed: true,
+				Validators: []validator.Int64{
+					int64validator.Between(0, 1<<32-1),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"from": schema.StringAttribute{
+				Description:   "Source prefix (CIDR) or address to match",
+				Optional:      true,
+				PlanModifiers: rr,
+			},
+			"to": schema.StringAttribute{
+				Description:   "Destination prefix (CIDR) or address to match",
+				Optional:      true,
+				PlanModifiers: rr,
+			},
+			"iif": schema.StringAttribute{
+				Description:   "Incoming interface to match, e.g. a `zedamigo_bridge`. `lo` matches the traffic originating on the host.",
+				Optional:      true,
+				PlanModifiers: rr,
+			},
+			"oif": schema.StringAttribute{
+				Description:   "Outgoing interface to match, for the sockets bound to an interface",
+				Optional:      true,
+				PlanModifiers: rr,
+			},
+			"fwmark": schema.Int64Attribute{
+				Description: "Firewall mark to match, e.g. set by an nftables rule",
+				Optional:    true,
+				Validators: []validator.Int64{
+					int64validator.Between(0, 1<<32-1),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"fwmask": schema.Int64Attribute{
+				Description: "Mask of `fwmark`. Default: all the bits.",
+				Optional:    true,
+				Validators: []validator.Int64{
+					int64validator.Between(1, 1<<32-1),
+					int64validator.AlsoRequires(path.MatchRoot("fwmark")),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"table": schema.Int64Attribute{
+				Description: fmt.Sprintf("Routing table (ID) to look up, e.g. the `table` of a `zedamigo_route`; `%d` is the main one.",
+					routeTableMain),
+				Required: true,
+				Validators: []validator.Int64{
+					int64validator.Between(1, 1<<32-1),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks the prefixes and their family, so that a typo doesn't
+// surface as an EINVAL from the kernel.
+func (r *Rule) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data RuleModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	families := map[string]bool{}
+	for name, v := range map[string]types.String{"from": data.From, "to": data.To} {
+		if v.IsNull() || v.IsUnknown() {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(rulePrefix(v.ValueString())); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root(name), "Invalid rule configuration",
+				fmt.Sprintf("'%s' is neither a prefix in CIDR format nor an IP address.", v.ValueString()))
+			continue
+		}
+		families[ruleFamily(v, types.StringNull())] = true
+	}
+	if !data.Family.IsNull() && !data.Family.IsUnknown() {
+		families[data.Family.ValueString()] = true
+	}
+	if len(families) > 1 {
+		resp.Diagnostics.AddError("Mixed IP address families",
+			"The `from` and `to` prefixes and the `family` of the rule must all be IPv4 or all be IPv6.")
+	}
+}
+
+func (r *Rule) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_rule", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Rule resource configure debugging", traceData)
+}
+
+func (r *Rule) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data RuleModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Rule Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+	if data.Family.IsNull() || data.Family.IsUnknown() {
+		data.Family = types.StringValue("ipv4")
+		if f := ruleFamily(data.From, data.To); f != "" {
+			data.Family = types.StringValue(f)
+		}
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Rule Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Rule Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	rule := data.rule()
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	op := nlops.Op{Kind: nlops.OpRuleAdd, Name: fmt.Sprintf("lookup %d", rule.Table), Rule: &rule}
+	if diags, err := nl.apply(ctx, d, op); err != nil {
+		resp.Diagnostics.AddError("Rule Resource Error",
+			fmt.Sprintf("Unable to add the rule: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the priority the kernel picked.
+	rules, diags, err := nl.rules(ctx, d)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read rule state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	found, ok := findRule(rules, rule)
+	if !ok {
+		resp.Diagnostics.AddError("Failed to read rule state", "The rule was added but isn't reported by the kernel.")
+		return
+	}
+	data.Priority = types.Int64Value(int64(found.Priority))
+
+	tflog.Trace(ctx, "Rule Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Rule) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data RuleModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	rules, diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).rules(ctx, d)
+	if err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to read rule state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	if _, ok := findRule(rules, data.rule()); err != nil || !ok {
+		// The rule (or its namespace) was deleted outside Terraform:
+		// remove from state.
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Rule) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan RuleModel
+	var state RuleModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// All the settings are RequiresReplace, there is nothing to change.
+	plan.Family = state.Family
+	plan.Priority = state.Priority
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Rule) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data RuleModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the rule. If it (or its namespace) doesn't exist the delete is
+	// successful (idempotent).
+	rule := data.rule()
+	op := nlops.Op{Kind: nlops.OpRuleDel, Name: fmt.Sprintf("lookup %d", rule.Table), Rule: &rule}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete rule", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Rule Resource Delete Error",
+			fmt.Sprintf("Can't delete rule resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Rule) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// findRule returns the first rule of rules with the selectors and table of
+// want, and its priority unless negative.
+func findRule(rules []nlops.Rule, want nlops.Rule) (nlops.Rule, bool) {
+	for _, r := range rules {
+		if r.Family != want.Family || (want.Priority >= 0 && r.Priority != want.Priority) {
+			continue
+		}
+		if r.From == want.From && r.To == want.To && r.IIF == want.IIF && r.OIF == want.OIF &&
+			r.FwMark == want.FwMark && r.FwMask == want.FwMask && r.Table == want.Table {
+			return r, true
+		}
+	}
+	return nlops.Rule{}, false
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+func TestRuleModelRule(t *testing.T) {
+	is := is.New(t)
+
+	m := RuleModel{
+		Family: types.StringValue("ipv4"),
+		From:   types.StringValue("10.9.0.7/24"),
+		To:     types.StringValue("192.0.2.1"),
+		FwMark: types.Int64Value(16),
+		FwMask: types.Int64Value(0xffffffff),
+		Table:  types.Int64Value(100),
+	}
+	is.Equal(m.rule(), nlops.Rule{Family: 4, Priority: -1, From: "10.9.0.0/24", To: "192.0.2.1/32", FwMark: 16, Table: 100})
+
+	is.Equal(ruleFamily(types.StringNull(), types.StringValue("fd00::/64")), "ipv6")
+	is.Equal(ruleFamily(types.StringNull(), types.StringNull()), "")
+}
+
+func TestFindRule(t *testing.T) {
+	is := is.New(t)
+
+	rules := []nlops.Rule{
+		{Family: 4, Priority: 0, Table: 255},
+		{Family: 4, Priority: 100, From: "10.9.0.0/24", IIF: "d0", Table: 100},
+		{Family: 6, Priority: 32765, Table: 100},
+		{Family: 4, Priority: 32766, Table: 254},
+	}
+	r, ok := findRule(rules, nlops.Rule{Family: 4, Priority: -1, From: "10.9.0.0/24", IIF: "d0", Table: 100})
+	is.True(ok)
+	is.Equal(r.Priority, 100)
+	_, ok = findRule(rules, nlops.Rule{Family: 4, Priority: 101, From: "10.9.0.0/24", IIF: "d0", Table: 100})
+	is.True(!ok)
+	r, ok = findRule(rules, nlops.Rule{Family: 6, Priority: -1, Table: 100})
+	is.True(ok)
+	is.Equal(r.Priority, 32765)
+	_, ok = findRule(rules, nlops.Rule{Family: 4, Priority: -1, Table: 100})
+	is.True(!ok)
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+const (
+	// supervisorStatusFile and supervisorLogFile are written, in the resource
+	// directory, by the self-invoked `-supervise` mode which runs the daemon
+	// of a resource: its JSON status and the (rotated) output of the daemon.
+	supervisorStatusFile = "supervisor.json"
+	supervisorLogFile    = "supervised.log"
+)
+
+// supervisorOptions is the restart policy of a daemon run under the
+// `-supervise` mode.
+type supervisorOptions struct {
+	// Restart is "always", "on-failure" or "never".
+	Restart string
+	// MaxRestarts is the number of failed runs in a row after which the
+	// supervisor gives up (and exits), 0 means never.
+	MaxRestarts int
+}
+
+// daemonSupervisor restarts a daemon which crashed or failed, e.g. because its
+// interface isn't there yet, with an exponential backoff (1s up to 1m). If it
+// keeps failing the supervisor exits and the next Read of the resource starts
+// it again.
+var daemonSupervisor = supervisorOptions{Restart: "on-failure", MaxRestarts: 10}
+
+// supervisedArgs returns the arguments of the provider binary which run
+// command under the `-supervise` mode, with the supervisor PID written to
+// pidFile and its status and log files in the resource directory d. As the
+// daemon is the supervisor's child, stopping the PID of pidFile stops both.
+func supervisedArgs(d, pidFile string, opts supervisorOptions, command ...string) []string {
+	args := []string{
+		"-pid-file", pidFile,
+		"-supervise",
+		"-sv.status", filepath.Join(d, supervisorStatusFile),
+		"-sv.log", filepath.Join(d, supervisorLogFile),
+		"-sv.restart", opts.Restart,
+		"-sv.max-restarts", strconv.Itoa(opts.MaxRestarts),
+		"--",
+	}
+	return append(args, command...)
+}
+
+// supervisorExit is the `last_exit` of the supervisor status file.
+type supervisorExit struct {
+	Code   int    `json:"code"`
+	Signal string `json:"signal"`
+	Error  string `json:"error"`
+}
+
+// String returns the `last_exit` attribute value, e.g. "exit status 1" or
+// "signal SIGKILL".
+func (e *supervisorExit) String() string {
+	switch {
+	case e.Error != "":
+		return "start error: " + e.Error
+	case e.Signal != "":
+		return "signal " + e.Signal
+	default:
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+}
+
+// supervisorStatus is the part of the supervisor status file the provider
+// reports.
+type supervisorStatus struct {
+	State    string          `json:"state"`
+	PID      int             `json:"pid"`
+	Restarts int64           `json:"restarts"`
+	UptimeS  float64         `json:"uptime_s"`
+	LastExit *supervisorExit `json:"last_exit"`
+}
+
+func parseSupervisorStatus(x []byte) (*supervisorStatus, error) {
+	var st supervisorStatus
+	if err := json.Unmarshal(x, &st); err != nil {
+		return nil, fmt.Errorf("can't parse the supervisor status: %w", err)
+	}
+	return &st, nil
+}
+
+// readSupervisorStatus reads the supervisor status file of the resource
+// directory d.
+func readSupervisorStatus(ctx context.Context, ex exec.Executor, d string) (*supervisorStatus, error) {
+	x, err := ex.ReadFile(ctx, filepath.Join(d, supervisorStatusFile))
+	if err != nil {
+		return nil, err
+	}
+	return parseSupervisorStatus(x)
+}
+
+// setSupervisorStatus sets the `restarts` and `last_exit` attributes of a
+// daemon resource from its supervisor status. A daemon which wasn't started
+// under a supervisor yet (e.g. by an older provider) has no restarts and no
+// last exit.
+func setSupervisorStatus(st *supervisorStatus, restarts *types.Int64, lastExit *types.String) {
+	*restarts, *lastExit = types.Int64Value(0), types.StringNull()
+	if st == nil {
+		return
+	}
+	*restarts = types.Int64Value(st.Restarts)
+	if st.LastExit != nil {
+		*lastExit = types.StringValue(st.LastExit.String())
+	}
+}
+
+// readSupervisorAttributes refreshes the `restarts` and `last_exit`
+// attributes of the daemon resource with directory d.
+func readSupervisorAttributes(ctx context.Context, ex exec.Executor, d string, restarts *types.Int64, lastExit *types.String) {
+	st, _ := readSupervisorStatus(ctx, ex, d)
+	setSupervisorStatus(st, restarts, lastExit)
+}
+
+// supervisorRestartsAttribute returns the computed `restarts` attribute of a
+// daemon resource.
+func supervisorRestartsAttribute() schema.Int64Attribute {
+	return schema.Int64Attribute{
+		Computed: true,
+		Description: "Number of times the daemon was restarted by its supervisor after it exited, since the " +
+			"provider last started it.",
+	}
+}
+
+// supervisorLastExitAttribute returns the computed `last_exit` attribute of a
+// daemon resource.
+func supervisorLastExitAttribute() schema.StringAttribute {
+	return schema.StringAttribute{
+		Computed: true,
+		Description: "How the last run of the daemon ended, e.g. `exit status 1` or `signal SIGKILL`, " +
+			"null if it never exited. The daemon output is in `" + supervisorLogFile + "` in the resource directory.",
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+func TestSupervisedArgs(t *testing.T) {
+	is := is.New(t)
+
+	args := supervisedArgs("/lib/ntp_servers/x", "/lib/ntp_servers/x/pid", daemonSupervisor,
+		"/bin/zedamigo", "-ntp-server", "-ntp.config", "/lib/ntp_servers/x/config.yaml")
+	is.Equal(args, []string{
+		"-pid-file", "/lib/ntp_servers/x/pid",
+		"-supervise",
+		"-sv.status", "/lib/ntp_servers/x/supervisor.json",
+		"-sv.log", "/lib/ntp_servers/x/supervised.log",
+		"-sv.restart", "on-failure",
+		"-sv.max-restarts", "10",
+		"--",
+		"/bin/zedamigo", "-ntp-server", "-ntp.config", "/lib/ntp_servers/x/config.yaml",
+	})
+
+	args = supervisedArgs("/d", "/d/process_monitor.pid", swtpmSupervisor, "swtpm", "socket")
+	is.Equal(args[8:11], []string{"always", "-sv.max-restarts", "0"}) // swtpm is always restarted
+}
+
+func TestSupervisorStatus(t *testing.T) {
+	is := is.New(t)
+
+	st, err := parseSupervisorStatus([]byte(`{
+  "supervisor_pid": 4242,
+  "command": ["/bin/zedamigo", "-dns-server"],
+  "state": "running",
+  "pid": 4250,
+  "restarts": 2,
+  "started_at": "2026-10-18T10:00:00Z",
+  "uptime_s": 12.5,
+  "last_exit": {"code": -1, "signal": "SIGKILL", "at": "2026-10-18T09:59:59Z", "uptime_s": 3.2},
+  "updated_at": "2026-10-18T10:00:12Z"
+}`))
+	is.NoErr(err)
+	is.Equal(st.PID, 4250)
+	is.Equal(st.State, "running")
+
+	var restarts types.Int64
+	var lastExit types.String
+	setSupervisorStatus(st, &restarts, &lastExit)
+	is.Equal(restarts, types.Int64Value(2))
+	is.Equal(lastExit, types.StringValue("signal SIGKILL"))
+
+	is.Equal((&supervisorExit{Code: 3}).String(), "exit status 3")
+	is.Equal((&supervisorExit{Code: -1, Error: "exec: not found"}).String(), "start error: exec: not found")
+
+	// Never exited.
+	st.LastExit = nil
+	setSupervisorStatus(st, &restarts, &lastExit)
+	is.True(lastExit.IsNull())
+
+	// Not (yet) started under a supervisor.
+	setSupervisorStatus(nil, &restarts, &lastExit)
+	is.Equal(restarts, types.Int64Value(0))
+	is.True(lastExit.IsNull())
+
+	_, err = parseSupervisorStatus([]byte(`{"restarts": "x"`))
+	is.True(err != nil)
+}
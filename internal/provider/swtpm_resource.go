@@ -12,8 +12,6 @@ import (
 	"syscall"
 	"time"
 
-	_ "embed"
-
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
 	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
@@ -33,7 +31,9 @@ const (
 	// older builds of the provider.
 	swtpmsDir = "swtmps"
 
-	swtpmMonitorScript  = "process_monitor.bash"
+	// swtpmMonitorPIDFile is the PID file of the supervisor of swtpm, it
+	// keeps the name it had with the process_monitor.bash script of older
+	// builds so that their monitors are still found (and stopped).
 	swtpmMonitorPIDFile = "process_monitor.pid"
 	swtpmPIDFile        = "swtpm.pid"
 	swtpmSocketFile     = "swtpm.socket"
@@ -44,7 +44,7 @@ const (
 	// waits for the swtpm process and its control socket to come up.
 	swtpmStartTimeout = 10 * time.Second
 	// swtpmStopTimeout caps how long the graceful stop path (SIGTERM to the
-	// process monitor) is given before escalating to SIGKILL.
+	// supervisor) is given before escalating to SIGKILL.
 	swtpmStopTimeout = 5 * time.Second
 	// swtpmLogTailBytes caps the swtpm log excerpt included in diagnostics.
 	swtpmLogTailBytes = 1024
@@ -58,8 +58,9 @@ var (
 	_ resource.ResourceWithImportState = &SwTPM{}
 )
 
-//go:embed process_monitor.bash
-var processMonitor []byte
+// swtpmSupervisor restarts swtpm whenever it exits, also when it exits
+// successfully because the VM it served shut down.
+var swtpmSupervisor = supervisorOptions{Restart: "always"}
 
 func NewSwTPM() resource.Resource {
 	return &SwTPM{}
@@ -72,10 +73,12 @@ type SwTPM struct {
 
 // SwTPMModel describes the resource data model.
 type SwTPMModel struct {
-	ID     types.String `tfsdk:"id"`
-	Name   types.String `tfsdk:"name"`
-	Socket types.String `tfsdk:"socket"`
-	State  types.String `tfsdk:"state"`
+	ID       types.String `tfsdk:"id"`
+	Name     types.String `tfsdk:"name"`
+	Socket   types.String `tfsdk:"socket"`
+	State    types.String `tfsdk:"state"`
+	Restarts types.Int64  `tfsdk:"restarts"`
+	LastExit types.String `tfsdk:"last_exit"`
 }
 
 func (r *SwTPM) getResourceDir(id string) string {
@@ -101,9 +104,10 @@ func (r *SwTPM) Schema(ctx context.Context, req resource.SchemaRequest, resp *re
 
 		QEMU terminates the attached swtpm process every time the VM shuts down (on a
 		graceful exit it sends a shutdown command over the control channel, which swtpm
-		always honors). Because of that the swtpm process runs under a small process
-		monitor which restarts it automatically, so the same TPM (with the same state)
-		can serve, for example, first the VM that runs the EVE-OS installer and then
+		always honors). Because of that the swtpm process runs under the process
+		supervisor of the provider (its self-invoked |-supervise| mode) which
+		restarts it automatically (see the |restarts| and |last_exit| attributes),
+		so the same TPM (with the same state) can serve, for example, first the VM that runs the EVE-OS installer and then
 		the VM that boots the installed system.`),
 
 		Attributes: map[string]schema.Attribute{
@@ -147,6 +151,8 @@ func (r *SwTPM) Schema(ctx context.Context, req resource.SchemaRequest, resp *re
 					stringvalidator.OneOf("running", "stopped"),
 				},
 			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
 		},
 	}
 }
@@ -309,7 +315,7 @@ func (r *SwTPM) ImportState(ctx context.Context, req resource.ImportStateRequest
 }
 
 // setupResourceDir creates the per-resource directory layout: the TPM state
-// sub-directory, the TF config back-pointer and the process monitor script.
+// sub-directory and the TF config back-pointer.
 func (r *SwTPM) setupResourceDir(ctx context.Context, d string) error {
 	if err := r.providerConf.Exec.MkdirAll(ctx, filepath.Join(d, swtpmStateDir), 0o700); err != nil {
 		return fmt.Errorf("unable to create resource specific directory: %w", err)
@@ -317,19 +323,15 @@ func (r *SwTPM) setupResourceDir(ctx context.Context, d string) error {
 	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
 		return fmt.Errorf("unable to create resource specific file: %w", err)
 	}
-	if err := r.providerConf.Exec.WriteFile(ctx, filepath.Join(d, swtpmMonitorScript), processMonitor, 0o755); err != nil {
-		return fmt.Errorf("unable to write the process monitor script: %w", err)
-	}
 
 	return nil
 }
 
-// startSwTPM starts the process monitor which in turn starts (and restarts,
-// see the resource description) the swtpm process.
+// startSwTPM starts the supervisor which in turn starts (and restarts, see
+// the resource description) the swtpm process.
 func (r *SwTPM) startSwTPM(ctx context.Context, d string) error {
-	cmdArgs := []string{
-		filepath.Join(d, swtpmMonitorScript),
-		"-p", filepath.Join(d, swtpmMonitorPIDFile),
+	self := r.providerConf.Exec.SelfPath()
+	cmdArgs := supervisedArgs(d, filepath.Join(d, swtpmMonitorPIDFile), swtpmSupervisor,
 		r.providerConf.Swtpm,
 		"socket",
 		"--pid", fmt.Sprintf("file=%s", filepath.Join(d, swtpmPIDFile)),
@@ -337,10 +339,10 @@ func (r *SwTPM) startSwTPM(ctx context.Context, d string) error {
 		"--ctrl", fmt.Sprintf("type=unixio,path=%s", filepath.Join(d, swtpmSocketFile)),
 		"--tpmstate", fmt.Sprintf("dir=%s", filepath.Join(d, swtpmStateDir)),
 		"--tpm2",
-	}
+	)
 
-	if res, err := r.providerConf.Exec.RunDetached(ctx, d, r.providerConf.Bash, cmdArgs...); err != nil {
-		return fmt.Errorf("failed to start the swtpm process monitor: %w, diagnostics: %v", err, res.Diagnostics())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, self, cmdArgs...); err != nil {
+		return fmt.Errorf("failed to start the swtpm supervisor: %w, diagnostics: %v", err, res.Diagnostics())
 	}
 
 	return nil
@@ -371,14 +373,14 @@ func (r *SwTPM) waitSwTPMReady(ctx context.Context, d string) error {
 	return fmt.Errorf("swtpm did not become ready within %s, log: %s", swtpmStartTimeout, logTail)
 }
 
-// stopSwTPM stops the process monitor and the swtpm process it supervises,
-// making sure that neither survives.
+// stopSwTPM stops the supervisor and the swtpm process it supervises, making
+// sure that neither survives.
 func (r *SwTPM) stopSwTPM(ctx context.Context, d string) error {
 	ex := r.providerConf.Exec
 
-	// Graceful path: SIGTERM the monitor, whose signal handler forwards the
-	// signal to swtpm, waits for it to exit and removes its own PID file. If
-	// only an orphaned swtpm survives, SIGTERM it directly.
+	// Graceful path: SIGTERM the supervisor, which forwards the signal to
+	// swtpm and waits for it to exit. If only an orphaned swtpm survives,
+	// SIGTERM it directly.
 	pmRunning, pmPID, _ := readMonitorPID(ctx, r.providerConf, d)
 	swRunning, swPID, _ := readSwTPMPID(ctx, r.providerConf, d)
 	switch {
@@ -394,12 +396,13 @@ func (r *SwTPM) stopSwTPM(ctx context.Context, d string) error {
 		return nil
 	}
 
-	// Escalate. SIGKILL cannot be trapped, so the monitor will never forward
-	// it to its child: the monitor must die first (so that it cannot restart
+	// Escalate. SIGKILL cannot be trapped, so the supervisor will never
+	// forward it to its child (and only Linux kills the child of a dead
+	// parent): the supervisor must die first (so that it cannot restart
 	// swtpm) and then swtpm must be killed explicitly.
 	if pmRunning, pmPID, _ = readMonitorPID(ctx, r.providerConf, d); pmRunning {
 		if err := ex.Kill(ctx, pmPID, syscall.SIGKILL); err != nil {
-			return fmt.Errorf("can't kill the swtpm process monitor (PID %d): %w", pmPID, err)
+			return fmt.Errorf("can't kill the swtpm supervisor (PID %d): %w", pmPID, err)
 		}
 	}
 	if swRunning, swPID, _ = readSwTPMPID(ctx, r.providerConf, d); swRunning {
@@ -409,14 +412,14 @@ func (r *SwTPM) stopSwTPM(ctx context.Context, d string) error {
 	}
 
 	if !r.waitSwTPMGone(ctx, d, 2*time.Second) {
-		return fmt.Errorf("the swtpm process and/or its process monitor are still running after SIGKILL")
+		return fmt.Errorf("the swtpm process and/or its supervisor are still running after SIGKILL")
 	}
 
 	return nil
 }
 
-// waitSwTPMGone polls until neither the process monitor nor the swtpm process
-// is running anymore, giving up after timeout.
+// waitSwTPMGone polls until neither the supervisor nor the swtpm process is
+// running anymore, giving up after timeout.
 func (r *SwTPM) waitSwTPMGone(ctx context.Context, d string, timeout time.Duration) bool {
 	deadline := time.Now().Add(timeout)
 	for {
@@ -446,9 +449,9 @@ func (r *SwTPM) readSwTPM(ctx context.Context, d string, data *SwTPMModel) error
 		desiredState = data.State.ValueString()
 	}
 
-	// The monitor being alive is what guarantees that swtpm itself is (or
+	// The supervisor being alive is what guarantees that swtpm itself is (or
 	// shortly will be) running: swtpm exits every time an attached VM shuts
-	// down and the monitor is what restarts it.
+	// down and the supervisor is what restarts it.
 	pmRunning, _, _ := readMonitorPID(ctx, r.providerConf, d)
 	actualState := "stopped"
 	if pmRunning {
@@ -474,16 +477,16 @@ func (r *SwTPM) readSwTPM(ctx context.Context, d string, data *SwTPMModel) error
 
 	data.State = types.StringValue(actualState)
 	data.Socket = types.StringValue(filepath.Join(d, swtpmSocketFile))
+	readSupervisorAttributes(ctx, r.providerConf.Exec, d, &data.Restarts, &data.LastExit)
 
 	return nil
 }
 
-// readMonitorPID reports whether the process monitor of this resource is
-// running. The PID file is written by the monitor script itself and removed
-// on its clean exit. NOTE: the monitor is a bash process, so an executable
-// check (IsRunning matches expectedExe against /proc/<pid>/exe) can never
-// match the script path; like the other daemon resources this is a PID
-// liveness check only.
+// readMonitorPID reports whether the supervisor of this resource is running.
+// NOTE: the supervisor of a resource created by an older build is a bash
+// process (process_monitor.bash), so an executable check (IsRunning matches
+// expectedExe against /proc/<pid>/exe) would miss it; like the other daemon
+// resources this is a PID liveness check only.
 func readMonitorPID(ctx context.Context, pConf *ZedAmigoProviderConfig, path string) (bool, int, error) {
 	pidPath := filepath.Join(path, swtpmMonitorPIDFile)
 	x, err := pConf.Exec.ReadFile(ctx, pidPath)
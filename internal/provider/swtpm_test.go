@@ -7,6 +7,8 @@ package provider
 import (
 	"context"
 	"io"
+	"os"
+	stdexec "os/exec"
 	"path/filepath"
 	"syscall"
 	"testing"
@@ -21,8 +23,8 @@ import (
 
 // swtpmHarness drives the SwTPM resource helpers through a real LocalExecutor
 // and a real swtpm process, exactly the way the resource uses them in
-// production: a fresh resource dir under a temp lib_path, the embedded
-// process monitor script and the swtpm binary found on PATH.
+// production: a fresh resource dir under a temp lib_path, the supervise mode
+// of a provider binary built for the test and the swtpm binary found on PATH.
 type swtpmHarness struct {
 	t   *testing.T
 	ctx context.Context
@@ -36,10 +38,6 @@ func newSwTPMHarness(t *testing.T) *swtpmHarness {
 	ctx := context.Background()
 	ex := exec.NewLocal(false)
 
-	bash, err := ex.LookPath(ctx, "bash")
-	if err != nil {
-		t.Skip("bash not available on this host; skipping swtpm tests")
-	}
 	swtpm, err := ex.LookPath(ctx, "swtpm")
 	if err != nil {
 		t.Skip("swtpm not available on this host; skipping swtpm tests")
@@ -52,9 +50,8 @@ func newSwTPMHarness(t *testing.T) *swtpmHarness {
 
 	r := &SwTPM{providerConf: &ZedAmigoProviderConfig{
 		LibPath: t.TempDir(),
-		Bash:    bash,
 		Swtpm:   swtpm,
-		Exec:    ex,
+		Exec:    selfExecutor{Executor: ex, self: buildProviderBinary(t)},
 	}}
 
 	id, err := newResourceID()
@@ -70,6 +67,27 @@ func newSwTPMHarness(t *testing.T) *swtpmHarness {
 	return h
 }
 
+// selfExecutor is an Executor whose provider binary is self: the supervise
+// mode is part of the provider binary, not of the test binary.
+type selfExecutor struct {
+	exec.Executor
+	self string
+}
+
+func (e selfExecutor) SelfPath() string { return e.self }
+
+// buildProviderBinary builds the provider binary into a temp dir.
+func buildProviderBinary(t *testing.T) string {
+	t.Helper()
+	self := filepath.Join(t.TempDir(), "terraform-provider-zedamigo")
+	cmd := stdexec.Command("go", "build", "-o", self, "../..")
+	cmd.Env = os.Environ()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("can't build the provider binary: %v: %s", err, out)
+	}
+	return self
+}
+
 // start brings the monitor + swtpm stack up and waits for it to be ready.
 func (h *swtpmHarness) start() {
 	h.t.Helper()
@@ -193,6 +211,12 @@ func TestSwTPMRestartAfterVMShutdown(t *testing.T) {
 	})
 	is.NoErr(h.r.waitSwTPMReady(h.ctx, h.dir))
 
+	// The restart is reported by the resource.
+	data := &SwTPMModel{State: types.StringValue("running")}
+	is.NoErr(h.r.readSwTPM(h.ctx, h.dir, data))
+	is.Equal(data.Restarts, types.Int64Value(1))
+	is.Equal(data.LastExit, types.StringValue("exit status 0"))
+
 	// The restarted swtpm must accept control channel connections again.
 	conn, err := h.r.providerConf.Exec.Dial(h.ctx, "unix", socketPath, 5*time.Second)
 	is.NoErr(err)
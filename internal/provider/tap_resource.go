@@ -4,15 +4,14 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/errchecker"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
@@ -80,7 +79,9 @@ func (r *TAP) Schema(ctx context.Context, req resource.SchemaRequest, resp *reso
 	resp.Schema = schema.Schema{
 		Description: "TAP interface",
 		// This description is used by the documentation generator and the language server.
-		MarkdownDescription: "Create and manage a Linux network TAP interface using iproute2 commands.",
+		MarkdownDescription: "Create and manage a Linux network TAP interface through netlink or iproute2 commands (see the provider `network_backend`). " +
+			"`mtu`, `state`, `master` and `ipv4_address` are changed in place, " +
+			"and settings changed outside of Terraform are restored on refresh.",
 
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
@@ -111,10 +112,16 @@ func (r *TAP) Schema(ctx context.Context, req resource.SchemaRequest, resp *reso
 			"owner": schema.StringAttribute{
 				Description: "Owner of the TAP interface",
 				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 			"group": schema.StringAttribute{
 				Description: "Group of the TAP interface",
 				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 			"master": schema.StringAttribute{
 				Description: "Bridge interface to attach this TAP interface to",
@@ -196,57 +203,55 @@ func (r *TAP) Create(ctx context.Context, req resource.CreateRequest, resp *reso
 
 	tapIf := data.Name.ValueString()
 
-	// TAP is always created in the default namespace so QEMU can open it.
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
+	// Validate the address here rather than at the point of use: when netns is
+	// set the address is applied asynchronously by the mover daemon, where a
+	// malformed value would only ever surface in its status file.
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, types.StringNull())
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	// Create the TAP.
-	moreArgs := []string{"tuntap", "add", "dev", tapIf, "mode", "tap"}
-	// moreArgs := []string{"tuntap", "add", "dev", tapIf, "mode", "tap", "multi_queue"}
+	// TAP is always created in the default namespace so QEMU can open it.
+	nl := newNetLinks(r.providerConf, "")
+
+	// Create the TAP and set the MTU if specified.
+	add := nlops.Op{Kind: nlops.OpLinkAdd, Name: tapIf, Type: nlops.TypeTAP}
 	if !data.Owner.IsNull() && !data.Owner.IsUnknown() {
-		moreArgs = append(moreArgs, "user", data.Owner.ValueString())
+		add.Owner = data.Owner.ValueString()
 	}
-
 	if !data.Group.IsNull() && !data.Group.IsUnknown() {
-		moreArgs = append(moreArgs, "group", data.Group.ValueString())
+		add.Group = data.Group.ValueString()
 	}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		resp.Diagnostics.AddError("TAP Resource Error",
-			"Unable to create a new TAP.")
-		resp.Diagnostics.Append(res.Diagnostics()...)
-		return
-	}
-
-	// Set the MTU if specified.
+	ops := []nlops.Op{add}
 	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
-		mtu := fmt.Sprintf("%d", data.MTU.ValueInt64())
-		moreArgs := []string{"link", "set", "dev", tapIf, "mtu", mtu}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("TAP Resource Error",
-				"Unable to create a new TAP.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: tapIf, MTU: int(data.MTU.ValueInt64())})
 	}
 
-	// Validate the address here rather than at the point of use: when netns is
-	// set the address is applied asynchronously by the mover daemon, where a
-	// malformed value would only ever surface in its status file.
-	if !data.IPv4Address.IsNull() && !data.IPv4Address.IsUnknown() {
-		if _, _, err := net.ParseCIDR(data.IPv4Address.ValueString()); err != nil {
-			resp.Diagnostics.AddError("Invalid IPv4 address format",
-				fmt.Sprintf("IPv4 address must be in CIDR format (e.g., '192.168.1.1/24'): %s", err.Error()))
-			return
+	hasNetNS := !data.NetNS.IsNull() && !data.NetNS.IsUnknown()
+
+	if !hasNetNS {
+		// No netns — configure master, state, and ipv4 in the default
+		// namespace, in the same batch. NOTE: the state MUST be set after
+		// the master, which is the order of an OpLinkSet.
+		set := nlops.Op{Kind: nlops.OpLinkSet, Name: tapIf}
+		if !data.Master.IsNull() && !data.Master.IsUnknown() {
+			set.Master = data.Master.ValueString()
+		}
+		if !data.State.IsNull() && !data.State.IsUnknown() {
+			set.State = data.State.ValueString()
+		}
+		ops = append(ops, set)
+		if !data.IPv4Address.IsNull() && !data.IPv4Address.IsUnknown() {
+			ops = append(ops, nlops.Op{Kind: nlops.OpAddrAdd, Name: tapIf, Addr: data.IPv4Address.ValueString()})
 		}
 	}
 
-	hasNetNS := !data.NetNS.IsNull() && !data.NetNS.IsUnknown()
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("TAP Resource Error",
+			fmt.Sprintf("Unable to create a new TAP: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
 
 	if hasNetNS {
 		// When netns is set, skip master/state/ipv4 — the mover daemon
@@ -259,53 +264,10 @@ func (r *TAP) Create(ctx context.Context, req resource.CreateRequest, resp *reso
 		}
 		data.MoverStatus = types.StringValue("pending")
 	} else {
-		// No netns — configure master, state, and ipv4 in the default namespace.
 		data.MoverStatus = types.StringValue("")
 
-		// Set the master (bridge) if specified.
-		if !data.Master.IsNull() && !data.Master.IsUnknown() {
-			master := data.Master.ValueString()
-			moreArgs := []string{"link", "set", "dev", tapIf, "master", master}
-			res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-			if err != nil {
-				resp.Diagnostics.AddError("TAP Resource Error",
-					"Unable to create a new TAP.")
-				resp.Diagnostics.Append(res.Diagnostics()...)
-				return
-			}
-		}
-
-		// Set the state if specified. NOTE: this MUST be done after setting
-		// the master, if master is specified.
-		if !data.State.IsNull() && !data.State.IsUnknown() {
-			state := data.State.ValueString()
-			moreArgs := []string{"link", "set", "dev", tapIf, state}
-			res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-			if err != nil {
-				resp.Diagnostics.AddError("TAP Resource Error",
-					"Unable to create a new TAP.")
-				resp.Diagnostics.Append(res.Diagnostics()...)
-				return
-			}
-		}
-
-		// Configure an IPv4 address if specified.
-		if !data.IPv4Address.IsNull() && !data.IPv4Address.IsUnknown() {
-			addr := data.IPv4Address.ValueString()
-
-			moreArgs := []string{"addr", "add", addr, "dev", tapIf}
-			res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-			if err != nil {
-				resp.Diagnostics.AddError("TAP Resource Error",
-					"Unable to create a new TAP.")
-				resp.Diagnostics.Append(res.Diagnostics()...)
-				return
-			}
-
-		}
-
 		// Read the TAP current state.
-		if diags, err := r.readTAP(ctx, d, ipCmd, ipArgs, &data); err != nil {
+		if diags, err := r.readTAP(ctx, d, nl, &data); err != nil {
 			resp.Diagnostics.AddError("Failed to read TAP state", err.Error())
 			resp.Diagnostics.Append(diags...)
 			return
@@ -339,9 +301,10 @@ func (r *TAP) Read(ctx context.Context, req resource.ReadRequest, resp *resource
 		netns := data.NetNS.ValueString()
 		if moverStatus == "moved" {
 			// TAP has been moved into the netns — query it there.
-			ipCmd, ipArgs := buildIPCommand(r.providerConf, netns)
-			if diags, err := r.readTAP(ctx, d, ipCmd, ipArgs, &data); err != nil {
-				if errchecker.ContainsAny(err, intfNotFoundStrs) || errchecker.DiagsAny(diags, intfNotFoundStrs) {
+			nl := newNetLinks(r.providerConf, netns)
+			prior := data
+			if diags, err := r.readTAP(ctx, d, nl, &data); err != nil {
+				if errors.Is(err, nlops.ErrNotFound) {
 					resp.State.RemoveResource(ctx)
 					return
 				}
@@ -349,18 +312,18 @@ func (r *TAP) Read(ctx context.Context, req resource.ReadRequest, resp *resource
 				resp.Diagnostics.Append(diags...)
 				return
 			}
+			r.healTAP(ctx, d, nl, prior, &data, &resp.Diagnostics)
 		} else {
 			// TAP is still in the default namespace (pending or error). The
 			// mover only applies master/state/ipv4_address once the TAP is
 			// inside the namespace, so reading them back from the default
 			// namespace would report values which simply have not been applied
-			// yet as drift — and this resource has no Update, so that diff is
-			// unrecoverable. Keep what we were asked for and let mover_status
-			// carry the progress; only MTU is genuinely set here at create.
+			// yet as drift, which Update can't apply before the move either.
+			// Keep what we were asked for and let mover_status carry the
+			// progress; only MTU is genuinely set here at create.
 			master, state, addr := data.Master, data.State, data.IPv4Address
-			ipCmd, ipArgs := buildIPCommand(r.providerConf, "")
-			if diags, err := r.readTAP(ctx, d, ipCmd, ipArgs, &data); err != nil {
-				if errchecker.ContainsAny(err, intfNotFoundStrs) || errchecker.DiagsAny(diags, intfNotFoundStrs) {
+			if diags, err := r.readTAP(ctx, d, newNetLinks(r.providerConf, ""), &data); err != nil {
+				if errors.Is(err, nlops.ErrNotFound) {
 					resp.State.RemoveResource(ctx)
 					return
 				}
@@ -373,17 +336,12 @@ func (r *TAP) Read(ctx context.Context, req resource.ReadRequest, resp *resource
 	} else {
 		data.MoverStatus = types.StringValue("")
 
-		ipCmd := r.providerConf.IP
-		ipArgs := []string{}
-		if r.providerConf.UseSudo {
-			ipCmd = r.providerConf.Sudo
-			ipArgs = []string{"-n", r.providerConf.IP}
-		}
+		nl := newNetLinks(r.providerConf, "")
 
 		// Read the TAP current state.
-		if diags, err := r.readTAP(ctx, d, ipCmd, ipArgs, &data); err != nil {
-			// Check for various error messages that indicate the device doesn't exist.
-			if errchecker.ContainsAny(err, intfNotFoundStrs) || errchecker.DiagsAny(diags, intfNotFoundStrs) {
+		prior := data
+		if diags, err := r.readTAP(ctx, d, nl, &data); err != nil {
+			if errors.Is(err, nlops.ErrNotFound) {
 				// Resource was deleted outside Terraform: remove from state.
 				resp.State.RemoveResource(ctx)
 				return
@@ -393,6 +351,7 @@ func (r *TAP) Read(ctx context.Context, req resource.ReadRequest, resp *resource
 			resp.Diagnostics.Append(diags...)
 			return
 		}
+		r.healTAP(ctx, d, nl, prior, &data, &resp.Diagnostics)
 	}
 
 	// Save updated data into Terraform state
@@ -400,17 +359,67 @@ func (r *TAP) Read(ctx context.Context, req resource.ReadRequest, resp *resource
 }
 
 func (r *TAP) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var data TAPModel
+	var plan TAPModel
+	var state TAPModel
 
-	// Read Terraform plan data into the model
-	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	cidrAttrErrors(&resp.Diagnostics, plan.IPv4Address, types.StringNull())
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// TODO: What to do here ?
+	// name/owner/group/netns are RequiresReplace, so they cannot reach Update
+	// changed. With a netns the TAP lives there once the mover is done; until
+	// then master/state/ipv4_address are still queued in the mover config and
+	// only the MTU can be changed.
+	netns := ""
+	plan.MoverStatus = types.StringValue("")
+	if !plan.NetNS.IsNull() && !plan.NetNS.IsUnknown() {
+		moverStatus := r.readMoverStatus(ctx, d)
+		plan.MoverStatus = types.StringValue(moverStatus)
+		if moverStatus == "moved" {
+			netns = plan.NetNS.ValueString()
+		} else {
+			if !plan.Master.Equal(state.Master) ||
+				(!plan.State.IsUnknown() && !plan.State.Equal(state.State)) ||
+				!plan.IPv4Address.Equal(state.IPv4Address) {
+				resp.Diagnostics.AddError("TAP Resource Update Error",
+					fmt.Sprintf("Can't change master, state or ipv4_address before the TAP is moved into netns '%s' (mover status: %q).",
+						plan.NetNS.ValueString(), moverStatus))
+				return
+			}
+			plan.Master, plan.State, plan.IPv4Address = state.Master, state.State, state.IPv4Address
+		}
+	}
+	nl := newNetLinks(r.providerConf, netns)
+
+	if diags, err := r.applyTAP(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("TAP Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save. Before the move only the MTU is read back, see Read.
+	master, st, addr := plan.Master, plan.State, plan.IPv4Address
+	if diags, err := r.readTAP(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read TAP state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	if !plan.NetNS.IsNull() && netns == "" {
+		plan.Master, plan.State, plan.IPv4Address = master, st, addr
+	}
 
-	resp.Diagnostics.AddError("TAP Resource Update Error", "Update is not supported.")
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 }
 
 func (r *TAP) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
@@ -432,49 +441,24 @@ func (r *TAP) Delete(ctx context.Context, req resource.DeleteRequest, resp *reso
 		r.stopTAPMover(ctx, d)
 	}
 
-	// Default namespace ip command.
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
-	}
-
 	if hasNetNS {
-		netns := data.NetNS.ValueString()
-
-		// Try to move the TAP back to the default namespace.
-		nsIpCmd, nsIpArgs := buildIPCommand(r.providerConf, netns)
-		moveBackArgs := []string{"link", "set", tapIf, "netns", "1"}
-		r.providerConf.Exec.Run(ctx, d, nsIpCmd, append(nsIpArgs, moveBackArgs...)...)
-		// Ignore errors — TAP or netns may already be gone.
+		// Delete the TAP where the mover put it. Ignore errors — the netns
+		// may already be gone, or the TAP never moved.
+		nsNL := newNetLinks(r.providerConf, data.NetNS.ValueString())
+		_, _ = nsNL.apply(ctx, d, nlops.Op{Kind: nlops.OpLinkDel, Name: tapIf, Type: nlops.TypeTAP})
 	}
 
-	// Remove from bridge first if attached (in default namespace).
+	// Remove from bridge first if attached, then delete the TAP (in the
+	// default namespace). Both are no-ops for a TAP that is already gone.
+	ops := []nlops.Op{}
 	if !data.Master.IsNull() {
-		moreArgs := []string{"link", "set", "dev", tapIf, "nomaster"}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			if errchecker.ContainsNone(err, intfNotFoundStrs) &&
-				errchecker.DiagsNone(res.Diagnostics(), intfNotFoundStrs) {
-				resp.Diagnostics.AddError("Failed to delete TAP", err.Error())
-				resp.Diagnostics.Append(res.Diagnostics()...)
-				return
-			}
-		}
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: tapIf, NoMaster: true})
 	}
-
-	// Delete an existing TAP.
-	moreArgs := []string{"tuntap", "delete", "dev", tapIf, "mode", "tap"}
-	// moreArgs := []string{"tuntap", "delete", "dev", tapIf, "mode", "tap", "multi_queue"}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		if errchecker.ContainsNone(err, intfNotFoundStrs) &&
-			errchecker.DiagsNone(res.Diagnostics(), intfNotFoundStrs) {
-			resp.Diagnostics.AddError("Failed to delete TAP", err.Error())
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	ops = append(ops, nlops.Op{Kind: nlops.OpLinkDel, Name: tapIf, Type: nlops.TypeTAP})
+	if diags, err := newNetLinks(r.providerConf, "").apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("Failed to delete TAP", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
 	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
@@ -488,79 +472,119 @@ func (r *TAP) ImportState(ctx context.Context, req resource.ImportStateRequest,
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *TAP) readTAP(ctx context.Context, resPath string, ipCmd string, ipArgs []string, model *TAPModel) (diag.Diagnostics, error) {
+func (r *TAP) readTAP(ctx context.Context, resPath string, nl netLinks, model *TAPModel) (diag.Diagnostics, error) {
 	tapIf := model.Name.ValueString()
 
-	// Check if TAP exists and get info.
-	moreArgs := []string{"link", "show", tapIf}
-	res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
+	link, diags, err := nl.show(ctx, resPath, tapIf)
 	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve TAP '%s' details: %w", tapIf, err)
-	}
-
-	// Parse output for MTU and state.
-	lines := strings.Split(res.Stdout, "\n")
-	// A real `ip link show` line always contains the flags section "<...>".
-	// If it doesn't, the output is empty or unparseable: fail loudly with the
-	// raw output instead of fabricating null/down values (which would surface
-	// as a spurious "inconsistent result after apply" error).
-	if len(lines) == 0 || !strings.Contains(lines[0], "<") {
-		return res.Diagnostics(),
-			fmt.Errorf("can't parse TAP '%s' link details, unexpected output: %q", tapIf, res.Stdout)
-	}
-	// Parse first line: "2: br0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 ..."
-	mtuRegex := regexp.MustCompile(`mtu (\d+)`)
-	if matches := mtuRegex.FindStringSubmatch(lines[0]); len(matches) > 1 {
-		x, err := strconv.ParseInt(matches[1], 10, 64)
-		if err != nil {
-			e := fmt.Errorf("invalid TAP '%s' MTU value '%s': %w", tapIf, matches[1], err)
-			d := diag.Diagnostics{}
-			d.AddError("Can't find TAP interface MTU value", e.Error())
-			return d, e
-		}
-		model.MTU = types.Int64Value(x)
+		return diags, fmt.Errorf("can't retrieve TAP '%s' details: %w", tapIf, err)
 	}
 
-	// Check for master (bridge).
-	masterRegex := regexp.MustCompile(`master (\S+)`)
-	if matches := masterRegex.FindStringSubmatch(lines[0]); len(matches) > 1 {
-		model.Master = types.StringValue(matches[1])
+	model.MTU = types.Int64Value(int64(link.MTU))
+	if link.Master != "" {
+		model.Master = types.StringValue(link.Master)
 	} else {
 		model.Master = types.StringNull()
 	}
 
-	// Determine state from the administrative UP flag inside "<...>" rather
-	// than a substring match on the whole line. This reflects the state we
-	// actually set, independent of the operational "state DOWN"/NO-CARRIER
-	// condition that persists until QEMU opens the TAP.
-	if linkFlagUp(lines[0]) {
-		model.State = types.StringValue("up")
-	} else {
-		model.State = types.StringValue("down")
-	}
+	// The administrative UP flag reflects the state we actually set,
+	// independent of the operational "state DOWN"/NO-CARRIER condition that
+	// persists until QEMU opens the TAP.
+	model.State = linkState(link)
 
-	// Get IP address(es) of TAP.
-	moreArgs = []string{"addr", "show", tapIf}
-	res, err = r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve TAP '%s' addreses: %w", tapIf, err)
-	}
-	// Look for IPv4 address in CIDR format: inet 192.168.1.1/24 brd ...
 	// Null out when the interface carries no address, the same way master is
 	// handled above: leaving the previous value in place would keep a stale
 	// address in the state forever and hide the drift instead of reporting it.
-	model.IPv4Address = types.StringNull()
-	addrRegex := regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+/\d+)`)
-	if matches := addrRegex.FindStringSubmatch(res.Stdout); len(matches) > 1 {
-		// Validate using net.ParseCIDR to ensure it's properly formatted
-		if _, _, err := net.ParseCIDR(matches[1]); err == nil {
-			model.IPv4Address = types.StringValue(matches[1])
+	model.IPv4Address = pickIntfAddr(model.IPv4Address, link.Addrs4)
+
+	return nil, nil
+}
+
+// applyTAP reconciles the in-place settings of the TAP from old to new, for
+// Update and for the drift self-heal in Read. Unknown values in new are left
+// alone. All changes are applied as one batch.
+func (r *TAP) applyTAP(ctx context.Context, resPath string, nl netLinks, old, new *TAPModel) (diag.Diagnostics, error) {
+	tapIf := new.Name.ValueString()
+
+	// MTU and master (bridge).
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: tapIf}
+	if !new.MTU.Equal(old.MTU) && !new.MTU.IsNull() && !new.MTU.IsUnknown() {
+		set.MTU = int(new.MTU.ValueInt64())
+	}
+	if !new.Master.Equal(old.Master) && !new.Master.IsUnknown() {
+		if new.Master.IsNull() {
+			set.NoMaster = true
+		} else {
+			set.Master = new.Master.ValueString()
+		}
+	}
+	ops := []nlops.Op{set}
+
+	// IPv4 address (del old, add new).
+	if !new.IPv4Address.Equal(old.IPv4Address) {
+		addrOps, err := intfAddrOps(tapIf, old.IPv4Address, new.IPv4Address)
+		if err != nil {
+			return nil, err
 		}
+		ops = append(ops, addrOps...)
+	}
+
+	// State last. NOTE: this MUST be done after setting the master.
+	if !new.State.Equal(old.State) && !new.State.IsNull() && !new.State.IsUnknown() {
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: tapIf, State: new.State.ValueString()})
 	}
 
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply TAP '%s' settings: %w", tapIf, err)
+	}
 	return nil, nil
 }
 
+// healTAP restores the last applied settings when the TAP drifted from the
+// prior state, e.g. it lost its master when the bridge was re-created. On
+// failure the actual values are kept and a warning is added, so the drift
+// shows up in the next plan instead.
+func (r *TAP) healTAP(ctx context.Context, resPath string, nl netLinks, prior TAPModel, data *TAPModel, diags *diag.Diagnostics) {
+	want, drift := tapHealTarget(prior, *data)
+	if !drift {
+		return
+	}
+
+	tflog.Info(ctx, "TAP settings drifted, restoring them", map[string]any{"tap": data.Name.ValueString()})
+	if d, err := r.applyTAP(ctx, resPath, nl, data, &want); err != nil {
+		diags.AddWarning("TAP Resource Read Warning",
+			fmt.Sprintf("Can't restore the drifted settings of TAP '%s': %v", data.Name.ValueString(), err))
+		diags.Append(diagsAsWarnings(d)...)
+		return
+	}
+	if d, err := r.readTAP(ctx, resPath, nl, &want); err != nil {
+		diags.AddWarning("TAP Resource Read Warning",
+			fmt.Sprintf("Can't read TAP '%s' after restoring its settings: %v", data.Name.ValueString(), err))
+		diags.Append(diagsAsWarnings(d)...)
+		return
+	}
+	*data = want
+}
+
+// tapHealTarget returns the settings Read restores when the actual TAP
+// drifted from the prior state, and whether it did. A master or address that
+// was never configured is not a drift: whatever else set one is left alone.
+func tapHealTarget(prior, actual TAPModel) (TAPModel, bool) {
+	want := prior
+	if want.Master.IsNull() {
+		want.Master = actual.Master
+	}
+	if want.IPv4Address.IsNull() {
+		want.IPv4Address = actual.IPv4Address
+	}
+
+	drift := !want.MTU.Equal(actual.MTU) ||
+		!want.State.Equal(actual.State) ||
+		!want.Master.Equal(actual.Master) ||
+		!want.IPv4Address.Equal(actual.IPv4Address)
+	return want, drift
+}
+
 // startTAPMover writes the mover config YAML and starts the mover daemon.
 func (r *TAP) startTAPMover(ctx context.Context, d string, data *TAPModel, netns string) error {
 	tapIf := data.Name.ValueString()
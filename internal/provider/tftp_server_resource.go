@@ -0,0 +1,560 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	tftpServersDir            = "tftp_servers"
+	tftpServerStopPoll        = 100 * time.Millisecond
+	tftpServerStopTimeout     = 5 * time.Second
+	tftpServerConfigTemplText = `# TFTP server configuration (auto-generated)
+listen: {{ printf "%q" .Listen }}
+interface: {{ printf "%q" .Interface }}
+root: {{ printf "%q" .Root }}
+block_size: {{ .BlockSize }}
+`
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &TFTPServer{}
+	_ resource.ResourceWithImportState    = &TFTPServer{}
+	_ resource.ResourceWithValidateConfig = &TFTPServer{}
+)
+
+func NewTFTPServer() resource.Resource {
+	return &TFTPServer{}
+}
+
+// TFTPServer defines the resource implementation.
+type TFTPServer struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// TFTPServerModel describes the resource data model.
+type TFTPServerModel struct {
+	ID            types.String `tfsdk:"id"`
+	Interface     types.String `tfsdk:"interface"`
+	NetNS         types.String `tfsdk:"netns"`
+	ListenAddress types.String `tfsdk:"listen_address"`
+	Port          types.Int64  `tfsdk:"port"`
+	RootDir       types.String `tfsdk:"root_dir"`
+	BlockSize     types.Int64  `tfsdk:"block_size"`
+	ConfigFile    types.String `tfsdk:"config_file"`
+	PIDFile       types.String `tfsdk:"pid_file"`
+	State         types.String `tfsdk:"state"`
+	Restarts      types.Int64  `tfsdk:"restarts"`
+	LastExit      types.String `tfsdk:"last_exit"`
+}
+
+func (r *TFTPServer) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, tftpServersDir, id)
+}
+
+func (r *TFTPServer) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_tftp_server"
+}
+
+func (r *TFTPServer) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Embedded read-only TFTP server",
+		MarkdownDescription: undent.Md(`
+		Run a small read-only TFTP server (UDP), the provider binary in |-tftp-server| mode, optionally
+		bound to an |interface| and/or inside a |netns|. It serves the files of |root_dir|, e.g. the iPXE
+		binary that the PXE ROM of an edge node downloads before it boots the iPXE script of a
+		|zedamigo_ipxe_boot|. Advertise it with the |netboot| block of a |zedamigo_dhcp_server|.
+
+		Requests can't escape |root_dir|, neither with |..| nor with a symlink. Backslashes in the requested
+		file names are taken as path separators, as sent by some PXE ROMs.
+
+		Changing the |root_dir| or |block_size| restarts the daemon in place.
+		NOTE: This resource DOES NOT manage the host firewall configuration (UDP port 69 and the
+		ephemeral ports of the transfers).`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "TFTP server resource identifier",
+				MarkdownDescription: "TFTP server resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Only answer requests received on this interface (SO_BINDTODEVICE). Default: all interfaces.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace in which to run the TFTP server",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"listen_address": schema.StringAttribute{
+				Description: "IP address to listen on. Default: all addresses (IPv4 and IPv6).",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"port": schema.Int64Attribute{
+				Description: "UDP port to listen on. Default: 69.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(69),
+				Validators: []validator.Int64{
+					int64validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"root_dir": schema.StringAttribute{
+				Description: "Directory from which the files are served. Default: a `root` directory in the " +
+					"resource directory, created empty.",
+				Optional: true,
+				Computed: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"block_size": schema.Int64Attribute{
+				Description: "Maximum block size (blksize option) granted to the clients, clamped to the MTU " +
+					"of the interface. Default: 512, as long as the client doesn't ask for more.",
+				Optional: true,
+				Validators: []validator.Int64{
+					int64validator.Between(512, 65464),
+				},
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated TFTP server configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the TFTP server daemon",
+				MarkdownDescription: undent.Md(`Desired state of the TFTP server daemon. Can be "running" or "stopped".
+				Defaults to "running". The provider will automatically start or stop the daemon to match this state.
+				Stopping it is an easy way of simulating an unreachable TFTP server.`),
+				Validators: []validator.String{
+					stringvalidator.OneOf("running", "stopped"),
+				},
+			},
+		},
+	}
+}
+
+func (r *TFTPServer) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data TFTPServerModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.ListenAddress.IsNull() && !data.ListenAddress.IsUnknown() &&
+		net.ParseIP(data.ListenAddress.ValueString()) == nil {
+		resp.Diagnostics.AddAttributeError(path.Root("listen_address"), "Invalid listen address",
+			fmt.Sprintf("%q is not an IP address.", data.ListenAddress.ValueString()))
+	}
+}
+
+func (r *TFTPServer) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_tftp_server", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "TFTP server resource configure debugging", traceData)
+}
+
+func (r *TFTPServer) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data TFTPServerModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("TFTPServer Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("TFTPServer Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("TFTPServer Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+	if data.RootDir.IsNull() || data.RootDir.IsUnknown() || data.RootDir.ValueString() == "" {
+		data.RootDir = types.StringValue(filepath.Join(d, "root"))
+		if err := r.providerConf.Exec.MkdirAll(ctx, data.RootDir.ValueString(), 0o755); err != nil {
+			resp.Diagnostics.AddError("TFTPServer Resource Error",
+				fmt.Sprintf("Unable to create root directory: %s", err))
+			return
+		}
+	}
+	if diags := writeTFTPServerConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if data.State.IsNull() || data.State.IsUnknown() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startTFTPServer(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("TFTPServer Resource Error",
+				fmt.Sprintf("Failed to start TFTP server: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readTFTPServer(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read TFTPServer state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "TFTPServer Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *TFTPServer) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data TFTPServerModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readTFTPServer(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read TFTPServer state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *TFTPServer) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan TFTPServerModel
+	var state TFTPServerModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	// Preserve computed fields.
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file, the
+	// daemon reads it only on start.
+	configChanged := !plan.RootDir.Equal(state.RootDir) ||
+		!plan.BlockSize.Equal(state.BlockSize)
+	if configChanged {
+		if diags := writeTFTPServerConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopTFTPServer(ctx, d); err != nil {
+			resp.Diagnostics.AddError("TFTPServer Resource Update Error",
+				fmt.Sprintf("Failed to stop TFTP server: %v", err))
+			return
+		}
+		tflog.Info(ctx, "TFTP server configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
+
+	if configChanged || !plan.State.Equal(state.State) {
+		tflog.Info(ctx, "TFTP server state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startTFTPServer(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("TFTPServer Resource Update Error",
+					fmt.Sprintf("Failed to start TFTP server: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopTFTPServer(ctx, d); err != nil {
+				resp.Diagnostics.AddError("TFTPServer Resource Update Error",
+					fmt.Sprintf("Failed to stop TFTP server: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readTFTPServer(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read TFTPServer state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *TFTPServer) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data TFTPServerModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopTFTPServer(ctx, d); err != nil {
+		tflog.Warn(ctx, "Failed to stop TFTP server during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("TFTPServer Resource Delete Error",
+			fmt.Sprintf("Can't delete TFTPServer resource directory: %v", err))
+		return
+	}
+}
+
+func (r *TFTPServer) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// startTFTPServer starts the TFTP server daemon for the given resource, inside
+// its network namespace if any.
+func (r *TFTPServer) startTFTPServer(ctx context.Context, d string, data *TFTPServerModel) error {
+	netns := ""
+	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
+		netns = data.NetNS.ValueString()
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-tftp-server", "-tftp.config", data.ConfigFile.ValueString())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
+		return fmt.Errorf("failed to start TFTP server: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+	return nil
+}
+
+// stopTFTPServer stops the TFTP server daemon for the given resource and waits
+// for it to exit, so that a new one can bind the same port right away.
+func (r *TFTPServer) stopTFTPServer(ctx context.Context, d string) error {
+	running, pid, err := readTFTPServerPID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find TFTP server process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill TFTP server process: %w", err)
+	}
+	for deadline := time.Now().Add(tftpServerStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(tftpServerStopPoll)
+	}
+	return fmt.Errorf("TFTP server process %d did not exit within %s", pid, tftpServerStopTimeout)
+}
+
+func (r *TFTPServer) readTFTPServer(ctx context.Context, resPath string, model *TFTPServerModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	running, _, _ := readTFTPServerPID(ctx, r.providerConf.Exec, resPath)
+	actualState := "stopped"
+	if running {
+		actualState = "running"
+	}
+
+	// Self-healing: reconcile actual state with desired state.
+	if desiredState == "running" && actualState == "stopped" {
+		tflog.Info(ctx, "TFTP server daemon is stopped but should be running, restarting...")
+		if err := r.startTFTPServer(ctx, resPath, model); err != nil {
+			return nil, fmt.Errorf("failed to restart TFTP server: %w", err)
+		}
+		actualState = "running"
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "TFTP server daemon is running but should be stopped, stopping...")
+		if err := r.stopTFTPServer(ctx, resPath); err != nil {
+			return nil, fmt.Errorf("failed to stop TFTP server: %w", err)
+		}
+		actualState = "stopped"
+	}
+
+	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+
+	return nil, nil
+}
+
+func readTFTPServerPID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
+
+// tftpServerConfig is the data of the TFTP server config file template.
+type tftpServerConfig struct {
+	Listen    string
+	Interface string
+	Root      string
+	BlockSize int64
+}
+
+// newTFTPServerConfig returns the config file data of a resource model.
+func newTFTPServerConfig(data *TFTPServerModel) tftpServerConfig {
+	port := data.Port.ValueInt64()
+	if port == 0 {
+		port = 69
+	}
+	return tftpServerConfig{
+		Listen:    net.JoinHostPort(data.ListenAddress.ValueString(), strconv.FormatInt(port, 10)),
+		Interface: data.Interface.ValueString(),
+		Root:      data.RootDir.ValueString(),
+		BlockSize: data.BlockSize.ValueInt64(),
+	}
+}
+
+// renderTFTPServerConfig writes the TFTP server config file of cfg to w.
+func renderTFTPServerConfig(w io.Writer, cfg tftpServerConfig) error {
+	tmpl, err := template.New("tftp-config").Parse(tftpServerConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// writeTFTPServerConfig writes the `config_file` of data.
+func writeTFTPServerConfig(ctx context.Context, ex exec.Executor, data *TFTPServerModel) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	cfg := newTFTPServerConfig(data)
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		diags.AddError("TFTPServer Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderTFTPServerConfig(confFile, cfg); err != nil {
+		diags.AddError("TFTPServer Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderTFTPServerConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := TFTPServerModel{
+		Interface:     types.StringValue("br0"),
+		ListenAddress: types.StringNull(),
+		Port:          types.Int64Value(69),
+		RootDir:       types.StringValue("/lib/tftp_servers/x/root"),
+		BlockSize:     types.Int64Value(1468),
+	}
+
+	var buf bytes.Buffer
+	is.NoErr(renderTFTPServerConfig(&buf, newTFTPServerConfig(&data)))
+
+	var got struct {
+		Listen    string `yaml:"listen"`
+		Interface string `yaml:"interface"`
+		Root      string `yaml:"root"`
+		BlockSize int    `yaml:"block_size"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Listen, ":69") // all addresses
+	is.Equal(got.Interface, "br0")
+	is.Equal(got.Root, "/lib/tftp_servers/x/root")
+	is.Equal(got.BlockSize, 1468)
+
+	data.ListenAddress = types.StringValue("fd00::1")
+	data.BlockSize = types.Int64Null()
+	buf.Reset()
+	is.NoErr(renderTFTPServerConfig(&buf, newTFTPServerConfig(&data)))
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Listen, "[fd00::1]:69")
+	is.Equal(got.BlockSize, 0) // the daemon default
+}
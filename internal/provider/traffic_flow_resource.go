@@ -0,0 +1,870 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	trafficFlowsDir            = "traffic_flows"
+	trafficFlowStopPoll        = 100 * time.Millisecond
+	trafficFlowStopTimeout     = 5 * time.Second
+	trafficFlowConfigTemplText = `# Traffic flow configuration (auto-generated)
+mode: {{ printf "%q" .Mode }}
+protocol: {{ printf "%q" .Protocol }}
+target: {{ printf "%q" .Target }}
+listen: {{ printf "%q" .Listen }}
+interface: {{ printf "%q" .Interface }}
+rate: {{ .Rate }}
+packet_size: {{ .PacketSize }}
+duration: {{ printf "%q" .Duration }}
+dscp: {{ .DSCP }}
+echo: {{ .Echo }}
+interval: {{ printf "%q" .Interval }}
+output_file: {{ printf "%q" .OutputFile }}
+summary_file: {{ printf "%q" .SummaryFile }}
+`
+)
+
+// bitRateRegex matches a bit rate, a number with an optional SI suffix.
+var bitRateRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)([kKmMgG]?)$`)
+
+// parseBitRate parses a bit rate in bits per second with an optional k, M or
+// G (SI, powers of 1000) suffix, e.g. "500k", "2.5M" or "1G".
+func parseBitRate(s string) (int64, error) {
+	m := bitRateRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("%q is not a valid bit rate", s)
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid bit rate", s)
+	}
+	switch strings.ToLower(m[2]) {
+	case "k":
+		v *= 1e3
+	case "m":
+		v *= 1e6
+	case "g":
+		v *= 1e9
+	}
+	if v > 1e12 {
+		return 0, fmt.Errorf("%q is too large a bit rate", s)
+	}
+	return int64(math.Round(v)), nil
+}
+
+// bitRateValidator validates that a string attribute holds a bit rate, see
+// parseBitRate.
+type bitRateValidator struct{}
+
+var _ validator.String = bitRateValidator{}
+
+func (v bitRateValidator) Description(_ context.Context) string {
+	return "must be a bit rate in bits per second with an optional k, M or G suffix, e.g. \"500k\", \"2.5M\", \"1G\""
+}
+
+func (v bitRateValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v bitRateValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, err := parseBitRate(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "Invalid Bit Rate",
+			fmt.Sprintf("%s; %s.", err, v.Description(ctx)))
+	}
+}
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &TrafficFlow{}
+	_ resource.ResourceWithImportState    = &TrafficFlow{}
+	_ resource.ResourceWithValidateConfig = &TrafficFlow{}
+)
+
+func NewTrafficFlow() resource.Resource {
+	return &TrafficFlow{}
+}
+
+// TrafficFlow defines the resource implementation.
+type TrafficFlow struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// TrafficFlowModel describes the resource data model.
+type TrafficFlowModel struct {
+	ID            types.String  `tfsdk:"id"`
+	Mode          types.String  `tfsdk:"mode"`
+	Protocol      types.String  `tfsdk:"protocol"`
+	TargetAddress types.String  `tfsdk:"target_address"`
+	ListenAddress types.String  `tfsdk:"listen_address"`
+	Port          types.Int64   `tfsdk:"port"`
+	Interface     types.String  `tfsdk:"interface"`
+	NetNS         types.String  `tfsdk:"netns"`
+	Rate          types.String  `tfsdk:"rate"`
+	PacketSize    types.Int64   `tfsdk:"packet_size"`
+	Duration      types.String  `tfsdk:"duration"`
+	DSCP          types.Int64   `tfsdk:"dscp"`
+	Echo          types.Bool    `tfsdk:"echo"`
+	Interval      types.String  `tfsdk:"interval"`
+	OutputFile    types.String  `tfsdk:"output_file"`
+	SummaryFile   types.String  `tfsdk:"summary_file"`
+	ConfigFile    types.String  `tfsdk:"config_file"`
+	PIDFile       types.String  `tfsdk:"pid_file"`
+	State         types.String  `tfsdk:"state"`
+	Restarts      types.Int64   `tfsdk:"restarts"`
+	LastExit      types.String  `tfsdk:"last_exit"`
+	Finished      types.Bool    `tfsdk:"finished"`
+	ThroughputBPS types.Int64   `tfsdk:"throughput_bps"`
+	LossPercent   types.Float64 `tfsdk:"loss_percent"`
+	JitterMS      types.Float64 `tfsdk:"jitter_ms"`
+	RTTMS         types.Float64 `tfsdk:"rtt_ms"`
+}
+
+func (r *TrafficFlow) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, trafficFlowsDir, id)
+}
+
+func (r *TrafficFlow) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_traffic_flow"
+}
+
+func (r *TrafficFlow) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "TCP/UDP traffic generator or sink writing MSU CBOR v2 samples",
+		MarkdownDescription: undent.Md(`
+		Run a TCP or UDP traffic flow, the provider binary in |-traffic| mode, from the host or
+		inside a |netns|, e.g. toward the forwarded port of an app instance, to measure the EVE-OS
+		data-plane performance without any tool inside the guests. A |send| flow sends |packet_size|
+		bytes at |rate| for |duration|, with the |dscp| of the packets; a |receive| flow is the sink.
+
+		Every |interval| the throughput is written as a sample of an |.msu.cbor| file (MSU CBOR
+		format version 2, like the one of a |zedamigo_internet_monitor|), which can be read with
+		the |msu-analyst| tool or dumped with |-monitor-system-usage -msu.dump|. The UDP packets
+		carry a sequence number and a timestamp, so a UDP receiver also records the loss and the
+		jitter (RFC 3550). With |echo| a UDP sender expects every packet back from an echo server,
+		e.g. |socat| in the app instance, and records the round-trip loss, jitter and time instead.
+		A TCP sender records the RTT and the retransmissions of its connection.
+
+		When the flow ends, after |duration| or when it is stopped, its summary is written to
+		|summary_file| and exposed as |throughput_bps|, |loss_percent|, |jitter_ms| and |rtt_ms|.
+		A flow which ran for its whole |duration| is |finished| and isn't started again, set
+		|state| to |stopped| and back to |running| to run it again. Changing the |rate|,
+		|packet_size|, |duration|, |dscp|, |echo| or |interval| runs the flow again in place.
+		NOTE: This resource DOES NOT manage the host firewall configuration.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "Traffic flow resource identifier",
+				MarkdownDescription: "Traffic flow resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"mode": schema.StringAttribute{
+				Description: "`send` to generate the flow or `receive` to be its sink.",
+				Required:    true,
+				Validators: []validator.String{
+					stringvalidator.OneOf("send", "receive"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"protocol": schema.StringAttribute{
+				Description: "`udp` or `tcp`. Default: `udp`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("udp"),
+				Validators: []validator.String{
+					stringvalidator.OneOf("udp", "tcp"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"target_address": schema.StringAttribute{
+				Description: "Host name or IP address to send to, required with the `send` mode.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"listen_address": schema.StringAttribute{
+				Description: "IP address to listen on with the `receive` mode. Default: all addresses (IPv4 and IPv6).",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"port": schema.Int64Attribute{
+				Description: "Port to send to with the `send` mode, or to listen on with the `receive` mode.",
+				Required:    true,
+				Validators: []validator.Int64{
+					int64validator.Between(1, 65535),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"interface": schema.StringAttribute{
+				Description: "Bind the socket(s) to this interface (SO_BINDTODEVICE). Default: none.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"netns": schema.StringAttribute{
+				Description: "Network namespace in which to run the traffic flow",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"rate": schema.StringAttribute{
+				Description: "Payload rate of the `send` mode in bits per second, with an optional `k`, `M` or `G` " +
+					"(SI) suffix, e.g. `500k` or `2.5M`. `0` sends as fast as possible. Default: `10M`.",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("10M"),
+				Validators: []validator.String{
+					bitRateValidator{},
+				},
+			},
+			"packet_size": schema.Int64Attribute{
+				Description: "UDP payload size, or size of each TCP write, in bytes. Default: 1200.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(1200),
+				Validators: []validator.Int64{
+					int64validator.Between(24, 65507),
+				},
+			},
+			"duration": schema.StringAttribute{
+				Description: "Duration of the flow as a Go duration string, e.g. `30s`. `0s` runs it until it is " +
+					"stopped. Default: `0s`.",
+				Optional: true,
+				Computed: true,
+				Default:  stringdefault.StaticString("0s"),
+			},
+			"dscp": schema.Int64Attribute{
+				Description: "DSCP of the sent packets (0-63), e.g. 46 for EF. Default: 0.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(0),
+				Validators: []validator.Int64{
+					int64validator.Between(0, 63),
+				},
+			},
+			"echo": schema.BoolAttribute{
+				Description: "With the `send` mode and `udp`, expect every packet back from an echo server and " +
+					"record the round-trip loss, jitter and time. Default: false.",
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(false),
+			},
+			"interval": schema.StringAttribute{
+				Description: "Interval of the samples as a Go duration string. Default: `1s`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("1s"),
+				Validators: []validator.String{
+					positiveDurationValidator{},
+				},
+			},
+			"output_file": schema.StringAttribute{
+				Description: "Path to the MSU CBOR output file",
+				MarkdownDescription: undent.Md(`Path to the MSU CBOR output file, rewritten by every run of the flow.
+				If omitted, defaults to |<resource_dir>/output.msu.cbor|.`),
+				Optional: true,
+				Computed: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"summary_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "YAML summary of the flow, written when it ends",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated traffic flow configuration file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the traffic flow daemon",
+				MarkdownDescription: undent.Md(`Desired state of the traffic flow daemon. Can be "running" or "stopped".
+				Defaults to "running". The provider will automatically start or stop the daemon to match this state,
+				except for a |finished| flow.`),
+				Validators: []validator.String{
+					stringvalidator.OneOf("running", "stopped"),
+				},
+			},
+			"finished": schema.BoolAttribute{
+				Computed:    true,
+				Description: "True once the flow ran for its whole `duration`.",
+			},
+			"throughput_bps": schema.Int64Attribute{
+				Computed: true,
+				Description: "Payload throughput of the last run of the flow in bits per second, measured from the " +
+					"first to the last received bytes with the `receive` mode.",
+			},
+			"loss_percent": schema.Float64Attribute{
+				Computed:    true,
+				Description: "Packet loss of the last run of a UDP `receive` flow, or the round-trip one of an `echo` flow.",
+			},
+			"jitter_ms": schema.Float64Attribute{
+				Computed:    true,
+				Description: "Jitter of the last run of a UDP `receive` flow, or the round-trip one of an `echo` flow.",
+			},
+			"rtt_ms": schema.Float64Attribute{
+				Computed:    true,
+				Description: "Average round-trip time of the last run of an `echo` flow.",
+			},
+		},
+	}
+}
+
+func (r *TrafficFlow) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data TrafficFlowModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.Mode.IsUnknown() {
+		return
+	}
+	send := data.Mode.ValueString() == "send"
+	if send && data.TargetAddress.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("target_address"), "Missing target address",
+			"The `send` mode requires a target_address.")
+	}
+	if !send && !data.TargetAddress.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("target_address"), "Invalid target address",
+			"The target_address is only used with the `send` mode.")
+	}
+	if send && !data.ListenAddress.IsNull() {
+		resp.Diagnostics.AddAttributeError(path.Root("listen_address"), "Invalid listen address",
+			"The listen_address is only used with the `receive` mode.")
+	}
+	if !data.ListenAddress.IsNull() && !data.ListenAddress.IsUnknown() &&
+		net.ParseIP(data.ListenAddress.ValueString()) == nil {
+		resp.Diagnostics.AddAttributeError(path.Root("listen_address"), "Invalid listen address",
+			fmt.Sprintf("%q is not an IP address.", data.ListenAddress.ValueString()))
+	}
+	if data.Echo.ValueBool() && (!send || data.Protocol.ValueString() == "tcp") {
+		resp.Diagnostics.AddAttributeError(path.Root("echo"), "Invalid echo",
+			"The echo is only supported by the `send` mode with `udp`.")
+	}
+	if !data.Duration.IsNull() && !data.Duration.IsUnknown() {
+		if d, err := time.ParseDuration(data.Duration.ValueString()); err != nil || d < 0 {
+			resp.Diagnostics.AddAttributeError(path.Root("duration"), "Invalid duration",
+				fmt.Sprintf("%q is not a Go duration string of 0s or more.", data.Duration.ValueString()))
+		}
+	}
+}
+
+func (r *TrafficFlow) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_traffic_flow", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Traffic flow resource configure debugging", traceData)
+}
+
+func (r *TrafficFlow) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data TrafficFlowModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("TrafficFlow Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("TrafficFlow Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("TrafficFlow Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	// Default output_file to <resource_dir>/output.msu.cbor.
+	if data.OutputFile.IsNull() || data.OutputFile.IsUnknown() || data.OutputFile.ValueString() == "" {
+		data.OutputFile = types.StringValue(filepath.Join(d, "output.msu.cbor"))
+	}
+	data.SummaryFile = types.StringValue(filepath.Join(d, "summary.yaml"))
+	data.ConfigFile = types.StringValue(filepath.Join(d, "config.yaml"))
+	data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+	if diags := writeTrafficFlowConfig(ctx, r.providerConf.Exec, &data); diags.HasError() {
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if data.State.IsNull() || data.State.IsUnknown() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startTrafficFlow(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("TrafficFlow Resource Error",
+				fmt.Sprintf("Failed to start traffic flow: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readTrafficFlow(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read TrafficFlow state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "TrafficFlow Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *TrafficFlow) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data TrafficFlowModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readTrafficFlow(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read TrafficFlow state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *TrafficFlow) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan TrafficFlowModel
+	var state TrafficFlowModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	// Preserve computed fields.
+	plan.OutputFile = state.OutputFile
+	plan.SummaryFile = state.SummaryFile
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+
+	desiredState := plan.State.ValueString()
+	if desiredState == "" {
+		desiredState = "running"
+	}
+
+	// Everything that is not RequiresReplace lives in the config file, the
+	// daemon reads it only on start.
+	configChanged := !plan.Rate.Equal(state.Rate) ||
+		!plan.PacketSize.Equal(state.PacketSize) ||
+		!plan.Duration.Equal(state.Duration) ||
+		!plan.DSCP.Equal(state.DSCP) ||
+		!plan.Echo.Equal(state.Echo) ||
+		!plan.Interval.Equal(state.Interval)
+	if configChanged {
+		if diags := writeTrafficFlowConfig(ctx, r.providerConf.Exec, &plan); diags.HasError() {
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+		if err := r.stopTrafficFlow(ctx, d); err != nil {
+			resp.Diagnostics.AddError("TrafficFlow Resource Update Error",
+				fmt.Sprintf("Failed to stop traffic flow: %v", err))
+			return
+		}
+		tflog.Info(ctx, "Traffic flow configuration changed", map[string]any{"restart": desiredState == "running"})
+	}
+
+	if configChanged || !plan.State.Equal(state.State) {
+		tflog.Info(ctx, "Traffic flow state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startTrafficFlow(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("TrafficFlow Resource Update Error",
+					fmt.Sprintf("Failed to start traffic flow: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopTrafficFlow(ctx, d); err != nil {
+				resp.Diagnostics.AddError("TrafficFlow Resource Update Error",
+					fmt.Sprintf("Failed to stop traffic flow: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readTrafficFlow(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read TrafficFlow state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *TrafficFlow) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data TrafficFlowModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopTrafficFlow(ctx, d); err != nil {
+		tflog.Warn(ctx, "Failed to stop traffic flow during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("TrafficFlow Resource Delete Error",
+			fmt.Sprintf("Can't delete TrafficFlow resource directory: %v", err))
+		return
+	}
+}
+
+func (r *TrafficFlow) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// startTrafficFlow starts the traffic flow daemon for the given resource,
+// inside its network namespace if any.
+func (r *TrafficFlow) startTrafficFlow(ctx context.Context, d string, data *TrafficFlowModel) error {
+	netns := ""
+	if !data.NetNS.IsNull() && !data.NetNS.IsUnknown() {
+		netns = data.NetNS.ValueString()
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	srvCmd, srvArgs := buildNetNSCommand(r.providerConf, netns, self)
+	moreArgs := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self, "-traffic", "-tr.config", data.ConfigFile.ValueString())
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, srvCmd, append(srvArgs, moreArgs...)...); err != nil {
+		return fmt.Errorf("failed to start traffic flow: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+	return nil
+}
+
+// stopTrafficFlow stops the traffic flow daemon for the given resource and
+// waits for it to exit, after it wrote the summary of the flow.
+func (r *TrafficFlow) stopTrafficFlow(ctx context.Context, d string) error {
+	running, pid, err := readTrafficFlowPID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find traffic flow process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill traffic flow process: %w", err)
+	}
+	for deadline := time.Now().Add(trafficFlowStopTimeout); time.Now().Before(deadline); {
+		if running, _ := r.providerConf.Exec.IsRunning(ctx, pid, ""); !running {
+			return nil
+		}
+		time.Sleep(trafficFlowStopPoll)
+	}
+	return fmt.Errorf("traffic flow process %d did not exit within %s", pid, trafficFlowStopTimeout)
+}
+
+func (r *TrafficFlow) readTrafficFlow(ctx context.Context, resPath string, model *TrafficFlowModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	running, _, _ := readTrafficFlowPID(ctx, r.providerConf.Exec, resPath)
+	actualState := "stopped"
+	if running {
+		actualState = "running"
+	}
+	sum := r.readTrafficFlowSummary(ctx, model)
+
+	// Self-healing: reconcile actual state with desired state. A finished
+	// flow is done, it isn't started again.
+	if desiredState == "running" && actualState == "stopped" {
+		if sum != nil && sum.Finished {
+			actualState = "running"
+		} else {
+			tflog.Info(ctx, "Traffic flow daemon is stopped but should be running, restarting...")
+			if err := r.startTrafficFlow(ctx, resPath, model); err != nil {
+				return nil, fmt.Errorf("failed to restart traffic flow: %w", err)
+			}
+			actualState = "running"
+			sum = nil
+		}
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "Traffic flow daemon is running but should be stopped, stopping...")
+		if err := r.stopTrafficFlow(ctx, resPath); err != nil {
+			return nil, fmt.Errorf("failed to stop traffic flow: %w", err)
+		}
+		actualState = "stopped"
+		sum = r.readTrafficFlowSummary(ctx, model)
+	} else if running {
+		// A running flow has no results yet, the summary is of a previous run.
+		sum = nil
+	}
+
+	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+	setTrafficFlowResults(model, sum)
+
+	return nil, nil
+}
+
+// readTrafficFlowSummary returns the summary of the last run of the flow, nil
+// if there is none.
+func (r *TrafficFlow) readTrafficFlowSummary(ctx context.Context, model *TrafficFlowModel) *trafficFlowSummary {
+	x, err := r.providerConf.Exec.ReadFile(ctx, model.SummaryFile.ValueString())
+	if err != nil {
+		return nil
+	}
+	sum, err := parseTrafficFlowSummary(x)
+	if err != nil {
+		tflog.Warn(ctx, "Can't parse the traffic flow summary", map[string]any{"error": err.Error()})
+		return nil
+	}
+	return sum
+}
+
+func readTrafficFlowPID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
+
+// trafficFlowSummary is the summary file written by the daemon when the flow
+// ends.
+type trafficFlowSummary struct {
+	Finished      bool     `yaml:"finished"`
+	ThroughputBPS int64    `yaml:"throughput_bps"`
+	LossPercent   *float64 `yaml:"loss_percent"`
+	JitterMS      *float64 `yaml:"jitter_ms"`
+	RTTMS         *float64 `yaml:"rtt_ms"`
+}
+
+func parseTrafficFlowSummary(data []byte) (*trafficFlowSummary, error) {
+	var sum trafficFlowSummary
+	if err := yaml.Unmarshal(data, &sum); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return &sum, nil
+}
+
+// setTrafficFlowResults sets the computed results of model from the summary,
+// null without one.
+func setTrafficFlowResults(model *TrafficFlowModel, sum *trafficFlowSummary) {
+	if sum == nil {
+		model.Finished = types.BoolValue(false)
+		model.ThroughputBPS = types.Int64Null()
+		model.LossPercent = types.Float64Null()
+		model.JitterMS = types.Float64Null()
+		model.RTTMS = types.Float64Null()
+		return
+	}
+	model.Finished = types.BoolValue(sum.Finished)
+	model.ThroughputBPS = types.Int64Value(sum.ThroughputBPS)
+	model.LossPercent = types.Float64PointerValue(sum.LossPercent)
+	model.JitterMS = types.Float64PointerValue(sum.JitterMS)
+	model.RTTMS = types.Float64PointerValue(sum.RTTMS)
+}
+
+// trafficFlowConfig is the data of the traffic flow config file template.
+type trafficFlowConfig struct {
+	Mode        string
+	Protocol    string
+	Target      string
+	Listen      string
+	Interface   string
+	Rate        int64
+	PacketSize  int64
+	Duration    string
+	DSCP        int64
+	Echo        bool
+	Interval    string
+	OutputFile  string
+	SummaryFile string
+}
+
+// newTrafficFlowConfig returns the config file data of a resource model, the
+// rate in bits per second.
+func newTrafficFlowConfig(data *TrafficFlowModel) (trafficFlowConfig, error) {
+	rate, err := parseBitRate(data.Rate.ValueString())
+	if err != nil {
+		return trafficFlowConfig{}, err
+	}
+	port := strconv.FormatInt(data.Port.ValueInt64(), 10)
+	cfg := trafficFlowConfig{
+		Mode:        data.Mode.ValueString(),
+		Protocol:    data.Protocol.ValueString(),
+		Interface:   data.Interface.ValueString(),
+		Rate:        rate,
+		PacketSize:  data.PacketSize.ValueInt64(),
+		Duration:    data.Duration.ValueString(),
+		DSCP:        data.DSCP.ValueInt64(),
+		Echo:        data.Echo.ValueBool(),
+		Interval:    data.Interval.ValueString(),
+		OutputFile:  data.OutputFile.ValueString(),
+		SummaryFile: data.SummaryFile.ValueString(),
+	}
+	if cfg.Mode == "send" {
+		cfg.Target = net.JoinHostPort(data.TargetAddress.ValueString(), port)
+	} else {
+		cfg.Listen = net.JoinHostPort(data.ListenAddress.ValueString(), port)
+	}
+	return cfg, nil
+}
+
+// renderTrafficFlowConfig writes the traffic flow config file of cfg to w.
+func renderTrafficFlowConfig(w io.Writer, cfg trafficFlowConfig) error {
+	tmpl, err := template.New("traffic-config").Parse(trafficFlowConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl.Execute(w, cfg)
+}
+
+// writeTrafficFlowConfig writes the `config_file` of data.
+func writeTrafficFlowConfig(ctx context.Context, ex exec.Executor, data *TrafficFlowModel) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	cfg, err := newTrafficFlowConfig(data)
+	if err != nil {
+		diags.AddAttributeError(path.Root("rate"), "Invalid rate", err.Error())
+		return diags
+	}
+
+	confPath := data.ConfigFile.ValueString()
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		diags.AddError("TrafficFlow Resource Error", fmt.Sprintf("Can't create file '%s': %s", confPath, err))
+		return diags
+	}
+	defer confFile.Close()
+
+	if err := renderTrafficFlowConfig(confFile, cfg); err != nil {
+		diags.AddError("TrafficFlow Resource Error", fmt.Sprintf("Can't write config file '%s': %s", confPath, err))
+	}
+	return diags
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseBitRate(t *testing.T) {
+	is := is.New(t)
+
+	for s, want := range map[string]int64{
+		"0":    0,
+		"1500": 1500,
+		"500k": 500_000,
+		"2.5M": 2_500_000,
+		"10m":  10_000_000,
+		"1G":   1_000_000_000,
+	} {
+		got, err := parseBitRate(s)
+		is.NoErr(err)
+		is.Equal(got, want) // bit rate
+	}
+
+	for _, s := range []string{"", "M", "-1M", "10Mbps", "1.M", "2000G"} {
+		_, err := parseBitRate(s)
+		is.True(err != nil) // invalid bit rate
+	}
+}
+
+func TestRenderTrafficFlowConfig(t *testing.T) {
+	is := is.New(t)
+
+	data := TrafficFlowModel{
+		Mode:          types.StringValue("send"),
+		Protocol:      types.StringValue("udp"),
+		TargetAddress: types.StringValue("fd00::10"),
+		Port:          types.Int64Value(5201),
+		Interface:     types.StringValue("br0"),
+		Rate:          types.StringValue("2.5M"),
+		PacketSize:    types.Int64Value(1400),
+		Duration:      types.StringValue("30s"),
+		DSCP:          types.Int64Value(46),
+		Echo:          types.BoolValue(true),
+		Interval:      types.StringValue("1s"),
+		OutputFile:    types.StringValue("/tmp/f/output.msu.cbor"),
+		SummaryFile:   types.StringValue("/tmp/f/summary.yaml"),
+	}
+	cfg, err := newTrafficFlowConfig(&data)
+	is.NoErr(err)
+
+	var buf bytes.Buffer
+	is.NoErr(renderTrafficFlowConfig(&buf, cfg))
+
+	// The same fields the daemon reads.
+	var got struct {
+		Mode        string        `yaml:"mode"`
+		Protocol    string        `yaml:"protocol"`
+		Target      string        `yaml:"target"`
+		Listen      string        `yaml:"listen"`
+		Interface   string        `yaml:"interface"`
+		Rate        int64         `yaml:"rate"`
+		PacketSize  int           `yaml:"packet_size"`
+		Duration    time.Duration `yaml:"duration"`
+		DSCP        int           `yaml:"dscp"`
+		Echo        bool          `yaml:"echo"`
+		Interval    time.Duration `yaml:"interval"`
+		OutputFile  string        `yaml:"output_file"`
+		SummaryFile string        `yaml:"summary_file"`
+	}
+	is.NoErr(yaml.Unmarshal(buf.Bytes(), &got))
+	is.Equal(got.Mode, "send")
+	is.Equal(got.Protocol, "udp")
+	is.Equal(got.Target, "[fd00::10]:5201")
+	is.Equal(got.Listen, "")
+	is.Equal(got.Interface, "br0")
+	is.Equal(got.Rate, int64(2_500_000))
+	is.Equal(got.PacketSize, 1400)
+	is.Equal(got.Duration, 30*time.Second)
+	is.Equal(got.DSCP, 46)
+	is.True(got.Echo)
+	is.Equal(got.Interval, time.Second)
+	is.Equal(got.OutputFile, "/tmp/f/output.msu.cbor")
+	is.Equal(got.SummaryFile, "/tmp/f/summary.yaml")
+
+	data.Mode = types.StringValue("receive")
+	data.TargetAddress = types.StringNull()
+	data.ListenAddress = types.StringNull()
+	cfg, err = newTrafficFlowConfig(&data)
+	is.NoErr(err)
+	is.Equal(cfg.Target, "")
+	is.Equal(cfg.Listen, ":5201") // all addresses
+
+	data.Rate = types.StringValue("fast")
+	_, err = newTrafficFlowConfig(&data)
+	is.True(err != nil)
+}
+
+func TestTrafficFlowSummary(t *testing.T) {
+	is := is.New(t)
+
+	sum, err := parseTrafficFlowSummary([]byte(`mode: receive
+protocol: udp
+finished: true
+elapsed_s: 29.998
+bytes: 37500000
+packets: 31250
+throughput_bps: 10000667
+loss_percent: 0.125
+jitter_ms: 0.031
+`))
+	is.NoErr(err)
+
+	var data TrafficFlowModel
+	setTrafficFlowResults(&data, sum)
+	is.Equal(data.Finished, types.BoolValue(true))
+	is.Equal(data.ThroughputBPS, types.Int64Value(10000667))
+	is.Equal(data.LossPercent, types.Float64Value(0.125))
+	is.Equal(data.JitterMS, types.Float64Value(0.031))
+	is.True(data.RTTMS.IsNull()) // only measured with echo
+
+	setTrafficFlowResults(&data, nil)
+	is.Equal(data.Finished, types.BoolValue(false))
+	is.True(data.ThroughputBPS.IsNull())
+	is.True(data.LossPercent.IsNull())
+
+	_, err = parseTrafficFlowSummary([]byte("finished: [1"))
+	is.True(err != nil)
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// tunnelIntfAttributes returns the schema attributes of the tunnel interface
+// itself (what, e.g. "the VXLAN interface"), the ones of a vethEnd but the
+// name. A layer 3 (l2 false) interface has no master and no MAC address.
+func tunnelIntfAttributes(what string, l2 bool) map[string]schema.Attribute {
+	attrs := map[string]schema.Attribute{
+		"netns": schema.StringAttribute{
+			Description: fmt.Sprintf("Network namespace to create %s in, the default one if not specified", what),
+			Optional:    true,
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.RequiresReplace(),
+			},
+		},
+		"mtu": schema.Int64Attribute{
+			Description: fmt.Sprintf("MTU size for %s", what),
+			Optional:    true,
+			Computed:    true,
+		},
+		"state": schema.StringAttribute{
+			Description: fmt.Sprintf("State of %s (up/down)", what),
+			Optional:    true,
+			Computed:    true,
+		},
+		"ipv4_address": schema.StringAttribute{
+			Description: fmt.Sprintf("IPv4 address to configure on %s", what),
+			Optional:    true,
+		},
+		"ipv6_address": schema.StringAttribute{
+			Description: fmt.Sprintf("IPv6 address for %s", what),
+			Optional:    true,
+		},
+	}
+	if l2 {
+		attrs["master"] = schema.StringAttribute{
+			Description: fmt.Sprintf("Bridge (e.g. a `zedamigo_bridge`) or bond to attach %s to, in the same network namespace", what),
+			Optional:    true,
+		}
+		attrs["mac_address"] = schema.StringAttribute{
+			Description: fmt.Sprintf("MAC address for %s", what),
+			Optional:    true,
+			Computed:    true,
+		}
+	}
+	return attrs
+}
+
+// readTunnelEnd reads the in-place settings of the interface e, created by
+// a tunnel resource, like readVeth does for an end of a veth pair.
+func readTunnelEnd(ctx context.Context, resPath string, nl netLinks, e *vethEnd) (diag.Diagnostics, error) {
+	name := e.Name.ValueString()
+
+	link, diags, err := nl.show(ctx, resPath, name)
+	if err != nil {
+		return diags, fmt.Errorf("can't retrieve interface '%s' details: %w", name, err)
+	}
+
+	e.MTU = types.Int64Value(int64(link.MTU))
+	e.State = linkState(link)
+	if link.MAC != "" && !e.MACAddress.IsNull() {
+		e.MACAddress = types.StringValue(link.MAC)
+	}
+	// Report the master only when one is configured or attached.
+	if link.Master != "" {
+		e.Master = types.StringValue(link.Master)
+	} else {
+		e.Master = types.StringNull()
+	}
+
+	// Report the configured IPv4/IPv6 address while it is still present,
+	// link-local addresses are not reported.
+	e.IPv4Address = pickIntfAddr(e.IPv4Address, link.Addrs4)
+	e.IPv6Address = pickIntfAddr(e.IPv6Address, link.Addrs6)
+
+	return nil, nil
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+)
+
+func TestIPAttrErrors(t *testing.T) {
+	is := is.New(t)
+
+	var diags diag.Diagnostics
+	ipAttrErrors(&diags, path.Empty(), map[string]types.String{
+		"remote": types.StringValue("192.0.2.2"), "local": types.StringNull(), "group": types.StringUnknown(),
+	})
+	is.True(!diags.HasError())
+
+	ipAttrErrors(&diags, path.Empty(), map[string]types.String{"remote": types.StringValue("192.0.2.2/24")})
+	is.Equal(diags.ErrorsCount(), 1) // a prefix length
+
+	diags = nil
+	ipAttrErrors(&diags, path.Empty(), map[string]types.String{
+		"remote": types.StringValue("192.0.2.2"), "local": types.StringValue("2001:db8::1"),
+	})
+	is.Equal(diags.ErrorsCount(), 1) // mixed families
+}
@@ -0,0 +1,822 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/hypervisor"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int32validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	userNetworksDir            = "user_networks"
+	userNetworkDefaultSubnet   = "192.168.127.0/24"
+	userNetworkDefaultGWMAC    = "5a:94:ef:e4:0c:dd"
+	userNetworkSocketPoll      = 100 * time.Millisecond
+	userNetworkSocketTimeout   = 3 * time.Second
+	userNetworkConfigTemplText = `# gvproxy shared user network configuration (auto-generated)
+mtu: {{ .MTU }}
+subnet: {{ printf "%q" .Subnet }}
+gatewayIP: {{ printf "%q" .GatewayIP }}
+gatewayMacAddress: {{ printf "%q" .GatewayMAC }}
+nat:
+  {{ printf "%q" .HostIP }}: "127.0.0.1"
+gatewayVirtualIPs:
+  - {{ printf "%q" .HostIP }}
+dhcpStaticLeases:
+{{- range $ip, $mac := .StaticLeases }}
+  {{ printf "%q" $ip }}: {{ printf "%q" $mac }}
+{{- end }}
+dnsSearchDomains:
+{{- range .DNSSearchDomains }}
+  - {{ printf "%q" . }}
+{{- end }}
+dns:
+  - name: "containers.internal."
+    records:
+      - name: "gateway"
+        ip: {{ printf "%q" .GatewayIP }}
+      - name: "host"
+        ip: {{ printf "%q" .HostIP }}
+{{- range .DNSZones }}
+  - name: {{ printf "%q" .Name }}
+    records:
+{{- range $name, $ip := .Records }}
+      - name: {{ printf "%q" $name }}
+        ip: {{ printf "%q" $ip }}
+{{- end }}
+{{- end }}
+forwards:
+{{- range .Forwards }}
+  {{ printf "%q" .Local }}: {{ printf "%q" .Remote }}
+{{- end }}
+`
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                = &UserNetwork{}
+	_ resource.ResourceWithImportState = &UserNetwork{}
+)
+
+func NewUserNetwork() resource.Resource {
+	return &UserNetwork{}
+}
+
+// UserNetwork defines the resource implementation.
+type UserNetwork struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// UserNetworkLeaseModel describes a static DHCP lease.
+type UserNetworkLeaseModel struct {
+	MAC types.String `tfsdk:"mac"`
+	IP  types.String `tfsdk:"ip"`
+}
+
+// UserNetworkDNSZoneModel describes a DNS zone served by the network gateway.
+type UserNetworkDNSZoneModel struct {
+	Name    types.String `tfsdk:"name"`
+	Records types.Map    `tfsdk:"records"`
+}
+
+// UserNetworkForwardModel describes a host->guest port forward.
+type UserNetworkForwardModel struct {
+	Protocol  types.String `tfsdk:"protocol"`
+	HostAddr  types.String `tfsdk:"host_addr"`
+	HostPort  types.Int32  `tfsdk:"host_port"`
+	GuestIP   types.String `tfsdk:"guest_ip"`
+	GuestPort types.Int32  `tfsdk:"guest_port"`
+}
+
+// UserNetworkModel describes the resource data model.
+type UserNetworkModel struct {
+	ID               types.String              `tfsdk:"id"`
+	Subnet           types.String              `tfsdk:"subnet"`
+	GatewayIP        types.String              `tfsdk:"gateway_ip"`
+	GatewayMAC       types.String              `tfsdk:"gateway_mac"`
+	HostIP           types.String              `tfsdk:"host_ip"`
+	MTU              types.Int64               `tfsdk:"mtu"`
+	DNSSearchDomains types.List                `tfsdk:"dns_search_domains"`
+	StaticLeases     []UserNetworkLeaseModel   `tfsdk:"static_lease"`
+	DNSZones         []UserNetworkDNSZoneModel `tfsdk:"dns_zone"`
+	Forwards         []UserNetworkForwardModel `tfsdk:"forward"`
+	Socket           types.String              `tfsdk:"socket"`
+	ControlSocket    types.String              `tfsdk:"control_socket"`
+	ConfigFile       types.String              `tfsdk:"config_file"`
+	PIDFile          types.String              `tfsdk:"pid_file"`
+	State            types.String              `tfsdk:"state"`
+	Restarts         types.Int64               `tfsdk:"restarts"`
+	LastExit         types.String              `tfsdk:"last_exit"`
+}
+
+func (r *UserNetwork) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, userNetworksDir, id)
+}
+
+func (r *UserNetwork) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_user_network"
+}
+
+func (r *UserNetwork) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Shared user-mode (gvproxy) virtual network for several edge node VMs",
+		MarkdownDescription: undent.Md(`
+		Create and manage a user-mode virtual network backed by one embedded gvproxy
+		(https://github.com/containers/gvisor-tap-vsock) instance. Several edge nodes can join the network by setting
+		their |user_network_socket| to the |socket| of this resource. All VMs on the network share one L2 segment, get
+		their addresses from the built-in DHCP server (optionally pinned per MAC with |static_lease| blocks), can resolve
+		the names of the |dns_zone| blocks and reach the outside world through the gvproxy NAT. No root privileges,
+		bridges or TAP interfaces are needed.
+
+		The host is reachable from the VMs at |host_ip|. Host ports are forwarded into the network with |forward| blocks.
+
+		Only supported for QEMU (Linux) targets.`),
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				Description:         "User network resource identifier",
+				MarkdownDescription: "User network resource identifier.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"subnet": schema.StringAttribute{
+				Description: "IPv4 subnet of the virtual network. Default: `" + userNetworkDefaultSubnet + "`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString(userNetworkDefaultSubnet),
+			},
+			"gateway_ip": schema.StringAttribute{
+				Description: "IPv4 address of the virtual gateway (router, DHCP and DNS server). Default: the first address of `subnet`.",
+				Optional:    true,
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"gateway_mac": schema.StringAttribute{
+				Description: "MAC address of the virtual gateway. Default: `" + userNetworkDefaultGWMAC + "`.",
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString(userNetworkDefaultGWMAC),
+			},
+			"host_ip": schema.StringAttribute{
+				Description: "IPv4 address inside the virtual network that is translated to the host's 127.0.0.1. " +
+					"Default: the last usable address of `subnet` (e.g. 192.168.127.254).",
+				Optional: true,
+				Computed: true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"mtu": schema.Int64Attribute{
+				Description: "MTU of the virtual network. Default: 1500.",
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(1500),
+			},
+			"dns_search_domains": schema.ListAttribute{
+				Description: "DNS search domains added to all DHCP replies.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"socket": schema.StringAttribute{
+				Computed:    true,
+				Description: "UNIX socket of the gvproxy instance; use it as the `user_network_socket` of the edge nodes joining this network",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"control_socket": schema.StringAttribute{
+				Computed:    true,
+				Description: "UNIX socket of the gvproxy HTTP control API; use it as the `control_socket` of `zedamigo_port_expose` to add forwards at runtime",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"config_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "The auto-generated gvproxy configuration file",
+			},
+			"pid_file": schema.StringAttribute{
+				Computed:    true,
+				Description: "Process ID file",
+			},
+			"restarts":  supervisorRestartsAttribute(),
+			"last_exit": supervisorLastExitAttribute(),
+			"state": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Description: "Desired state of the gvproxy daemon",
+				MarkdownDescription: undent.Md(`Desired state of the gvproxy daemon. Can be |running| or |stopped|.
+				Defaults to |running|. The provider will automatically start or stop the daemon to match this state.
+				NOTE: VMs connected to the network lose connectivity when the daemon stops and are not reconnected
+				when it starts again.`),
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"static_lease": schema.ListNestedBlock{
+				Description: "Static DHCP lease: the VM NIC with this MAC address always gets this IPv4 address.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"mac": schema.StringAttribute{
+							Description: "MAC address of the VM NIC, e.g. the `nic0_mac` of an edge node.",
+							Required:    true,
+						},
+						"ip": schema.StringAttribute{
+							Description: "IPv4 address (inside `subnet`) to hand out to this MAC address.",
+							Required:    true,
+						},
+					},
+				},
+			},
+			"dns_zone": schema.ListNestedBlock{
+				Description: "DNS zone served by the gateway's built-in DNS server, in addition to `containers.internal.` " +
+					"(which has the `gateway` and `host` records).",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Description: "Zone name, e.g. `lab.internal.` (a trailing dot is added if missing).",
+							Required:    true,
+						},
+						"records": schema.MapAttribute{
+							Description: "A records of the zone: map of record name (relative to the zone) to IPv4 address.",
+							ElementType: types.StringType,
+							Required:    true,
+						},
+					},
+				},
+			},
+			"forward": schema.ListNestedBlock{
+				Description: "Port forward from the host into the virtual network.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"protocol": schema.StringAttribute{
+							Description: `Transport protocol: "tcp" (default) or "udp".`,
+							Optional:    true,
+							Validators: []validator.String{
+								stringvalidator.OneOf("tcp", "udp"),
+							},
+						},
+						"host_addr": schema.StringAttribute{
+							Description: "Host address to bind the forward on. Default: `0.0.0.0`.",
+							Optional:    true,
+							Validators: []validator.String{
+								ipAddressValidator{},
+							},
+						},
+						"host_port": schema.Int32Attribute{
+							Description: "Host port of the forward.",
+							Required:    true,
+							Validators: []validator.Int32{
+								int32validator.Between(1, 65535),
+							},
+						},
+						"guest_ip": schema.StringAttribute{
+							Description: "IPv4 address of the VM inside the virtual network, usually from a `static_lease`.",
+							Required:    true,
+						},
+						"guest_port": schema.Int32Attribute{
+							Description: "Port of the VM that the forward targets.",
+							Required:    true,
+							Validators: []validator.Int32{
+								int32validator.Between(1, 65535),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *UserNetwork) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *ZedAmigoProviderConfig, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.providerConf = conf
+	if conf.TargetOS != "linux" {
+		resp.Diagnostics.AddError("zedamigo_user_network requires a Linux target.",
+			fmt.Sprintf("The shared gvproxy network is only supported with the QEMU hypervisor and not on %s/%s targets.",
+				conf.TargetOS, conf.TargetArch))
+	}
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "User network resource configure debugging", traceData)
+}
+
+func (r *UserNetwork) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data UserNetworkModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("UserNetwork Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("UserNetwork Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("UserNetwork Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	td, diags := userNetworkTemplateData(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	confPath := filepath.Join(d, "config.yaml")
+	if err := writeUserNetworkConfig(ctx, r.providerConf.Exec, confPath, td); err != nil {
+		resp.Diagnostics.AddError("UserNetwork Resource Error",
+			fmt.Sprintf("Unable to write config file: %s", err))
+		return
+	}
+	data.ConfigFile = types.StringValue(confPath)
+	data.PIDFile = types.StringValue(filepath.Join(d, "pid"))
+	data.Socket = types.StringValue(filepath.Join(d, "gvproxy-qemu.sock"))
+	data.ControlSocket = types.StringValue(filepath.Join(d, hypervisor.GvproxyControlSocket))
+
+	if data.State.IsNull() || data.State.ValueString() == "" {
+		data.State = types.StringValue("running")
+	}
+
+	if data.State.ValueString() == "running" {
+		if err := r.startUserNetwork(ctx, d, &data); err != nil {
+			resp.Diagnostics.AddError("UserNetwork Resource Error",
+				fmt.Sprintf("Failed to start gvproxy daemon: %v", err))
+			return
+		}
+	}
+
+	if diags, err := r.readUserNetwork(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read UserNetwork state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "UserNetwork Resource created successfully")
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *UserNetwork) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data UserNetworkModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if diags, err := r.readUserNetwork(ctx, d, &data); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Failed to read UserNetwork state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *UserNetwork) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan UserNetworkModel
+	var state UserNetworkModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(state.ID.ValueString())
+
+	stateChanged := !plan.State.Equal(state.State)
+	configChanged := !plan.Subnet.Equal(state.Subnet) ||
+		!plan.GatewayIP.Equal(state.GatewayIP) ||
+		!plan.GatewayMAC.Equal(state.GatewayMAC) ||
+		!plan.HostIP.Equal(state.HostIP) ||
+		!plan.MTU.Equal(state.MTU) ||
+		!plan.DNSSearchDomains.Equal(state.DNSSearchDomains) ||
+		!equalUserNetworkLeases(plan.StaticLeases, state.StaticLeases) ||
+		!equalUserNetworkDNSZones(plan.DNSZones, state.DNSZones) ||
+		!equalUserNetworkForwards(plan.Forwards, state.Forwards)
+
+	if configChanged {
+		resp.Diagnostics.AddError("UserNetwork Resource Update Error",
+			"Configuration changes require resource recreation. Only the 'state' field can be updated in-place.")
+		return
+	}
+
+	// Preserve computed fields.
+	plan.Socket = state.Socket
+	plan.ControlSocket = state.ControlSocket
+	plan.ConfigFile = state.ConfigFile
+	plan.PIDFile = state.PIDFile
+
+	if stateChanged {
+		desiredState := plan.State.ValueString()
+		if desiredState == "" {
+			desiredState = "running"
+		}
+
+		tflog.Info(ctx, "User network state change requested", map[string]any{
+			"from": state.State.ValueString(),
+			"to":   desiredState,
+		})
+
+		if desiredState == "running" {
+			if err := r.startUserNetwork(ctx, d, &plan); err != nil {
+				resp.Diagnostics.AddError("UserNetwork Resource Update Error",
+					fmt.Sprintf("Failed to start gvproxy daemon: %v", err))
+				return
+			}
+		} else if desiredState == "stopped" {
+			if err := r.stopUserNetwork(ctx, d); err != nil {
+				resp.Diagnostics.AddError("UserNetwork Resource Update Error",
+					fmt.Sprintf("Failed to stop gvproxy daemon: %v", err))
+				return
+			}
+		}
+
+		plan.State = types.StringValue(desiredState)
+	}
+
+	if diags, err := r.readUserNetwork(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read UserNetwork state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *UserNetwork) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data UserNetworkModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	if err := r.stopUserNetwork(ctx, d); err != nil {
+		tflog.Warn(ctx, "Failed to stop gvproxy daemon during delete", map[string]any{"error": err.Error()})
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("UserNetwork Resource Delete Error",
+			fmt.Sprintf("Can't delete UserNetwork resource directory: %v", err))
+		return
+	}
+}
+
+func (r *UserNetwork) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// startUserNetwork starts the gvproxy daemon (self-invoked `-gvproxy` mode
+// with a `-gp.config` file, under the `-supervise` mode) and waits for its
+// QEMU socket to appear. gvproxy
+// runs without sudo: it only needs a UNIX socket and unprivileged host ports.
+func (r *UserNetwork) startUserNetwork(ctx context.Context, d string, data *UserNetworkModel) error {
+	socketPath := data.Socket.ValueString()
+
+	// A stale socket left by a killed daemon would make the listen fail.
+	if err := r.providerConf.Exec.Remove(ctx, socketPath); err != nil && !exec.IsNotExist(err) {
+		tflog.Debug(ctx, "Failed to remove stale gvproxy socket", map[string]any{"error": err})
+	}
+
+	self := r.providerConf.Exec.SelfPath()
+	args := supervisedArgs(d, data.PIDFile.ValueString(), daemonSupervisor,
+		self,
+		"-gvproxy",
+		"-gp.listen-qemu", fmt.Sprintf("unix://%s", socketPath),
+		"-gp.config", data.ConfigFile.ValueString(),
+		"-gp.control", data.ControlSocket.ValueString(),
+	)
+	if res, err := r.providerConf.Exec.RunDetached(ctx, d, self, args...); err != nil {
+		return fmt.Errorf("failed to start gvproxy daemon: %w, diagnostics: %v", err, res.Diagnostics())
+	}
+
+	deadline := time.Now().Add(userNetworkSocketTimeout)
+	for time.Now().Before(deadline) {
+		if _, err := r.providerConf.Exec.Stat(ctx, socketPath); err == nil {
+			return nil
+		}
+		time.Sleep(userNetworkSocketPoll)
+	}
+	return fmt.Errorf("gvproxy socket %s did not appear within %s", socketPath, userNetworkSocketTimeout)
+}
+
+// stopUserNetwork stops the gvproxy daemon. SIGTERM lets gvproxy close and
+// remove its socket.
+func (r *UserNetwork) stopUserNetwork(ctx context.Context, d string) error {
+	running, pid, err := readUserNetworkPID(ctx, r.providerConf.Exec, d)
+	if err != nil {
+		return fmt.Errorf("can't find gvproxy daemon process: %w", err)
+	}
+	if !running {
+		return nil
+	}
+
+	if err := r.providerConf.Exec.Kill(ctx, pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("can't kill gvproxy daemon process: %w", err)
+	}
+	return nil
+}
+
+func (r *UserNetwork) readUserNetwork(ctx context.Context, resPath string, model *UserNetworkModel) (diag.Diagnostics, error) {
+	if _, err := r.providerConf.Exec.Stat(ctx, resPath); exec.IsNotExist(err) {
+		return nil, fmt.Errorf("resource directory does not exist")
+	}
+
+	desiredState := "running"
+	if !model.State.IsNull() && model.State.ValueString() != "" {
+		desiredState = model.State.ValueString()
+	}
+
+	running, _, _ := readUserNetworkPID(ctx, r.providerConf.Exec, resPath)
+	actualState := "stopped"
+	if running {
+		actualState = "running"
+	}
+
+	if desiredState == "running" && actualState == "stopped" {
+		tflog.Info(ctx, "User network gvproxy daemon is stopped but should be running, restarting...")
+		if err := r.startUserNetwork(ctx, resPath, model); err != nil {
+			return nil, fmt.Errorf("failed to restart gvproxy daemon: %w", err)
+		}
+		actualState = "running"
+	} else if desiredState == "stopped" && actualState == "running" {
+		tflog.Info(ctx, "User network gvproxy daemon is running but should be stopped, stopping...")
+		if err := r.stopUserNetwork(ctx, resPath); err != nil {
+			return nil, fmt.Errorf("failed to stop gvproxy daemon: %w", err)
+		}
+		actualState = "stopped"
+	}
+
+	model.State = types.StringValue(actualState)
+	readSupervisorAttributes(ctx, r.providerConf.Exec, resPath, &model.Restarts, &model.LastExit)
+
+	return nil, nil
+}
+
+func readUserNetworkPID(ctx context.Context, ex exec.Executor, path string) (bool, int, error) {
+	pidPath := filepath.Join(path, "pid")
+	x, err := ex.ReadFile(ctx, pidPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	pid, err := strconv.ParseInt(string(bytes.TrimSpace(x)), 10, 32)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w", err)
+	}
+
+	running, err := ex.IsRunning(ctx, int(pid), "")
+	if err != nil {
+		return false, int(pid), err
+	}
+
+	return running, int(pid), nil
+}
+
+// userNetworkForward is one rendered entry of the gvproxy `forwards` map.
+type userNetworkForward struct {
+	Local  string
+	Remote string
+}
+
+// userNetworkDNSZone is one rendered gvproxy DNS zone.
+type userNetworkDNSZone struct {
+	Name    string
+	Records map[string]string
+}
+
+// userNetworkConfig holds the values rendered into the gvproxy config file.
+type userNetworkConfig struct {
+	MTU              int64
+	Subnet           string
+	GatewayIP        string
+	GatewayMAC       string
+	HostIP           string
+	StaticLeases     map[string]string
+	DNSSearchDomains []string
+	DNSZones         []userNetworkDNSZone
+	Forwards         []userNetworkForward
+}
+
+// userNetworkTemplateData validates the model, fills in the computed
+// gateway_ip / host_ip defaults and returns the values for the config file.
+func userNetworkTemplateData(ctx context.Context, data *UserNetworkModel) (userNetworkConfig, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	td := userNetworkConfig{
+		MTU:          data.MTU.ValueInt64(),
+		Subnet:       data.Subnet.ValueString(),
+		GatewayMAC:   data.GatewayMAC.ValueString(),
+		StaticLeases: make(map[string]string),
+	}
+
+	prefix, err := netip.ParsePrefix(td.Subnet)
+	if err != nil || !prefix.Addr().Is4() || prefix.Bits() > 29 {
+		diags.AddError("Invalid user network configuration",
+			fmt.Sprintf("subnet %q must be an IPv4 CIDR of at most /29.", td.Subnet))
+		return td, diags
+	}
+	prefix = prefix.Masked()
+	if _, err := net.ParseMAC(td.GatewayMAC); err != nil {
+		diags.AddError("Invalid user network configuration",
+			fmt.Sprintf("gateway_mac %q: %v", td.GatewayMAC, err))
+	}
+
+	inSubnet := func(attr, s string) {
+		a, err := netip.ParseAddr(s)
+		if err != nil || !prefix.Contains(a) {
+			diags.AddError("Invalid user network configuration",
+				fmt.Sprintf("%s %q must be an IPv4 address inside subnet %s.", attr, s, prefix))
+		}
+	}
+
+	if data.GatewayIP.IsNull() || data.GatewayIP.IsUnknown() || data.GatewayIP.ValueString() == "" {
+		data.GatewayIP = types.StringValue(prefix.Addr().Next().String())
+	}
+	td.GatewayIP = data.GatewayIP.ValueString()
+	inSubnet("gateway_ip", td.GatewayIP)
+
+	if data.HostIP.IsNull() || data.HostIP.IsUnknown() || data.HostIP.ValueString() == "" {
+		b := prefix.Addr().As4()
+		last := binary.BigEndian.Uint32(b[:]) | (^uint32(0) >> prefix.Bits())
+		binary.BigEndian.PutUint32(b[:], last-1)
+		data.HostIP = types.StringValue(netip.AddrFrom4(b).String())
+	}
+	td.HostIP = data.HostIP.ValueString()
+	inSubnet("host_ip", td.HostIP)
+
+	for i, l := range data.StaticLeases {
+		mac, err := net.ParseMAC(l.MAC.ValueString())
+		if err != nil {
+			diags.AddError("Invalid user network configuration",
+				fmt.Sprintf("static_lease %d: invalid mac %q: %v", i, l.MAC.ValueString(), err))
+			continue
+		}
+		inSubnet(fmt.Sprintf("static_lease %d: ip", i), l.IP.ValueString())
+		if _, dup := td.StaticLeases[l.IP.ValueString()]; dup {
+			diags.AddError("Invalid user network configuration",
+				fmt.Sprintf("static_lease %d: ip %s is leased more than once.", i, l.IP.ValueString()))
+		}
+		td.StaticLeases[l.IP.ValueString()] = mac.String()
+	}
+
+	if !data.DNSSearchDomains.IsNull() && !data.DNSSearchDomains.IsUnknown() {
+		domains, d := extractStringList(ctx, data.DNSSearchDomains)
+		diags.Append(d...)
+		td.DNSSearchDomains = domains
+	}
+
+	for i, z := range data.DNSZones {
+		zone := userNetworkDNSZone{Name: z.Name.ValueString(), Records: make(map[string]string)}
+		if !strings.HasSuffix(zone.Name, ".") {
+			zone.Name += "."
+		}
+		diags.Append(z.Records.ElementsAs(ctx, &zone.Records, false)...)
+		for name, ip := range zone.Records {
+			if a, err := netip.ParseAddr(ip); err != nil || !a.Is4() {
+				diags.AddError("Invalid user network configuration",
+					fmt.Sprintf("dns_zone %d: record %q: %q is not an IPv4 address.", i, name, ip))
+			}
+		}
+		td.DNSZones = append(td.DNSZones, zone)
+	}
+
+	for i, f := range data.Forwards {
+		inSubnet(fmt.Sprintf("forward %d: guest_ip", i), f.GuestIP.ValueString())
+		hostAddr := "0.0.0.0"
+		if !f.HostAddr.IsNull() && f.HostAddr.ValueString() != "" {
+			hostAddr = f.HostAddr.ValueString()
+		}
+		local := net.JoinHostPort(hostAddr, strconv.Itoa(int(f.HostPort.ValueInt32())))
+		if f.Protocol.ValueString() == "udp" {
+			local = "udp:" + local
+		}
+		td.Forwards = append(td.Forwards, userNetworkForward{
+			Local:  local,
+			Remote: net.JoinHostPort(f.GuestIP.ValueString(), strconv.Itoa(int(f.GuestPort.ValueInt32()))),
+		})
+	}
+
+	return td, diags
+}
+
+func writeUserNetworkConfig(ctx context.Context, ex exec.Executor, confPath string, td userNetworkConfig) error {
+	tmpl, err := template.New("user-network-config").Parse(userNetworkConfigTemplText)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+
+	confFile, err := ex.OpenWrite(ctx, confPath, 0o644)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", confPath, err)
+	}
+	defer confFile.Close()
+
+	if err := tmpl.Execute(confFile, td); err != nil {
+		return fmt.Errorf("write %s: %w", confPath, err)
+	}
+	return nil
+}
+
+func equalUserNetworkLeases(a, b []UserNetworkLeaseModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].MAC.Equal(b[i].MAC) || !a[i].IP.Equal(b[i].IP) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalUserNetworkDNSZones(a, b []UserNetworkDNSZoneModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Name.Equal(b[i].Name) || !a[i].Records.Equal(b[i].Records) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalUserNetworkForwards(a, b []UserNetworkForwardModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Protocol.Equal(b[i].Protocol) || !a[i].HostAddr.Equal(b[i].HostAddr) ||
+			!a[i].HostPort.Equal(b[i].HostPort) || !a[i].GuestIP.Equal(b[i].GuestIP) ||
+			!a[i].GuestPort.Equal(b[i].GuestPort) {
+			return false
+		}
+	}
+	return true
+}
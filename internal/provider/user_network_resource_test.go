@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/exec"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v3"
+)
+
+func TestUserNetworkTemplateData_Defaults(t *testing.T) {
+	is := is.New(t)
+	data := UserNetworkModel{
+		Subnet:           types.StringValue("10.20.0.0/16"),
+		GatewayIP:        types.StringUnknown(),
+		GatewayMAC:       types.StringValue(userNetworkDefaultGWMAC),
+		HostIP:           types.StringNull(),
+		MTU:              types.Int64Value(1500),
+		DNSSearchDomains: types.ListNull(types.StringType),
+		StaticLeases: []UserNetworkLeaseModel{
+			{MAC: types.StringValue("52:54:00:AA:BB:CC"), IP: types.StringValue("10.20.0.11")},
+		},
+		Forwards: []UserNetworkForwardModel{
+			{Protocol: types.StringValue("udp"), HostAddr: types.StringNull(), HostPort: types.Int32Value(5000),
+				GuestIP: types.StringValue("10.20.0.11"), GuestPort: types.Int32Value(53)},
+		},
+	}
+
+	td, diags := userNetworkTemplateData(context.Background(), &data)
+	is.True(!diags.HasError())
+	is.Equal(data.GatewayIP.ValueString(), "10.20.0.1")
+	is.Equal(data.HostIP.ValueString(), "10.20.255.254")
+	is.Equal(td.StaticLeases["10.20.0.11"], "52:54:00:aa:bb:cc")
+	is.Equal(len(td.Forwards), 1)
+	is.Equal(td.Forwards[0].Local, "udp:0.0.0.0:5000")
+	is.Equal(td.Forwards[0].Remote, "10.20.0.11:53")
+}
+
+func TestUserNetworkTemplateData_Invalid(t *testing.T) {
+	is := is.New(t)
+	data := UserNetworkModel{
+		Subnet:     types.StringValue("192.168.127.0/24"),
+		GatewayIP:  types.StringValue("10.0.0.1"), // Outside of the subnet.
+		GatewayMAC: types.StringValue(userNetworkDefaultGWMAC),
+		StaticLeases: []UserNetworkLeaseModel{
+			{MAC: types.StringValue("not-a-mac"), IP: types.StringValue("192.168.127.11")},
+		},
+	}
+
+	_, diags := userNetworkTemplateData(context.Background(), &data)
+	is.Equal(diags.ErrorsCount(), 2)
+}
+
+func TestUserNetworkForwardHostAddrValidated(t *testing.T) {
+	is := is.New(t)
+
+	var resp resource.SchemaResponse
+	(&UserNetwork{}).Schema(context.Background(), resource.SchemaRequest{}, &resp)
+	is.True(!resp.Diagnostics.HasError())
+
+	b, ok := resp.Schema.Blocks["forward"].(schema.ListNestedBlock)
+	is.True(ok) // A list block.
+	a, ok := b.NestedObject.Attributes["host_addr"].(schema.StringAttribute)
+	is.True(ok) // A string attribute.
+	is.Equal(len(a.Validators), 1)
+	_, ok = a.Validators[0].(ipAddressValidator)
+	is.True(ok) // host_addr must be an IP address.
+}
+
+func TestWriteUserNetworkConfig_Quoting(t *testing.T) {
+	is := is.New(t)
+	td := userNetworkConfig{
+		MTU:              1500,
+		Subnet:           "192.168.127.0/24",
+		GatewayIP:        "192.168.127.1",
+		GatewayMAC:       userNetworkDefaultGWMAC,
+		HostIP:           "192.168.127.254",
+		StaticLeases:     map[string]string{"192.168.127.11": "52:54:00:aa:bb:cc"},
+		DNSSearchDomains: []string{`lab: "x"`, `back\slash`},
+		DNSZones: []userNetworkDNSZone{
+			{Name: "zone.\n\"", Records: map[string]string{"a: b": "192.168.127.11"}},
+		},
+		Forwards: []userNetworkForward{{Local: "udp:[::1]:5000", Remote: "192.168.127.11:53"}},
+	}
+
+	confPath := filepath.Join(t.TempDir(), "config.yaml")
+	is.NoErr(writeUserNetworkConfig(context.Background(), exec.NewLocal(false), confPath, td))
+	x, err := os.ReadFile(confPath)
+	is.NoErr(err)
+
+	var got struct {
+		DHCPStaticLeases map[string]string `yaml:"dhcpStaticLeases"`
+		DNSSearchDomains []string          `yaml:"dnsSearchDomains"`
+		DNS              []struct {
+			Name    string `yaml:"name"`
+			Records []struct {
+				Name string `yaml:"name"`
+				IP   string `yaml:"ip"`
+			} `yaml:"records"`
+		} `yaml:"dns"`
+		Forwards map[string]string `yaml:"forwards"`
+	}
+	is.NoErr(yaml.Unmarshal(x, &got))
+	is.Equal(got.DHCPStaticLeases["192.168.127.11"], "52:54:00:aa:bb:cc")
+	is.Equal(got.DNSSearchDomains, td.DNSSearchDomains) // values are quoted, not interpreted
+	is.Equal(len(got.DNS), 2)
+	is.Equal(got.DNS[1].Name, "zone.\n\"")
+	is.Equal(got.DNS[1].Records[0].Name, "a: b")
+	is.Equal(got.Forwards["udp:[::1]:5000"], "192.168.127.11:53")
+}
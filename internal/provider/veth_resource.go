@@ -0,0 +1,587 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	vethsDir = "veths"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                = &Veth{}
+	_ resource.ResourceWithImportState = &Veth{}
+)
+
+func NewVeth() resource.Resource {
+	return &Veth{}
+}
+
+// Veth defines the resource implementation.
+type Veth struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// VethModel describes the resource data model. Each end of the pair has the
+// same attributes, the ones of the peer with a `peer_` prefix.
+type VethModel struct {
+	ID          types.String `tfsdk:"id"`
+	Name        types.String `tfsdk:"name"`
+	NetNS       types.String `tfsdk:"netns"`
+	Master      types.String `tfsdk:"master"`
+	MTU         types.Int64  `tfsdk:"mtu"`
+	State       types.String `tfsdk:"state"`
+	MACAddress  types.String `tfsdk:"mac_address"`
+	IPv4Address types.String `tfsdk:"ipv4_address"`
+	IPv6Address types.String `tfsdk:"ipv6_address"`
+
+	PeerName        types.String `tfsdk:"peer_name"`
+	PeerNetNS       types.String `tfsdk:"peer_netns"`
+	PeerMaster      types.String `tfsdk:"peer_master"`
+	PeerMTU         types.Int64  `tfsdk:"peer_mtu"`
+	PeerState       types.String `tfsdk:"peer_state"`
+	PeerMACAddress  types.String `tfsdk:"peer_mac_address"`
+	PeerIPv4Address types.String `tfsdk:"peer_ipv4_address"`
+	PeerIPv6Address types.String `tfsdk:"peer_ipv6_address"`
+}
+
+// vethEnd is one end of a veth pair, so that both are handled the same way.
+type vethEnd struct {
+	Name        types.String
+	NetNS       types.String
+	Master      types.String
+	MTU         types.Int64
+	State       types.String
+	MACAddress  types.String
+	IPv4Address types.String
+	IPv6Address types.String
+}
+
+// ends returns both ends of the pair, the `name` one first.
+func (m *VethModel) ends() [2]vethEnd {
+	return [2]vethEnd{
+		{m.Name, m.NetNS, m.Master, m.MTU, m.State, m.MACAddress, m.IPv4Address, m.IPv6Address},
+		{m.PeerName, m.PeerNetNS, m.PeerMaster, m.PeerMTU, m.PeerState, m.PeerMACAddress, m.PeerIPv4Address, m.PeerIPv6Address},
+	}
+}
+
+// setEnds stores both ends back into the model.
+func (m *VethModel) setEnds(e [2]vethEnd) {
+	m.Name, m.NetNS, m.Master, m.MTU, m.State, m.MACAddress, m.IPv4Address, m.IPv6Address =
+		e[0].Name, e[0].NetNS, e[0].Master, e[0].MTU, e[0].State, e[0].MACAddress, e[0].IPv4Address, e[0].IPv6Address
+	m.PeerName, m.PeerNetNS, m.PeerMaster, m.PeerMTU, m.PeerState, m.PeerMACAddress, m.PeerIPv4Address, m.PeerIPv6Address =
+		e[1].Name, e[1].NetNS, e[1].Master, e[1].MTU, e[1].State, e[1].MACAddress, e[1].IPv4Address, e[1].IPv6Address
+}
+
+func (r *Veth) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, vethsDir, id)
+}
+
+func (r *Veth) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_veth"
+}
+
+func (r *Veth) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	attrs := map[string]schema.Attribute{
+		"id": schema.StringAttribute{
+			Computed:            true,
+			Description:         "Veth pair identifier",
+			MarkdownDescription: "Veth pair identifier",
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.UseStateForUnknown(),
+			},
+		},
+	}
+	for _, end := range []struct{ prefix, what string }{{"", "this end"}, {"peer_", "the peer end"}} {
+		attrs[end.prefix+"name"] = schema.StringAttribute{
+			Description: fmt.Sprintf("Name of the interface of %s", end.what),
+			Required:    true,
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.RequiresReplace(),
+			},
+		}
+		attrs[end.prefix+"netns"] = schema.StringAttribute{
+			Description: fmt.Sprintf("Network namespace of %s, the default one if not specified", end.what),
+			Optional:    true,
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.RequiresReplace(),
+			},
+		}
+		attrs[end.prefix+"master"] = schema.StringAttribute{
+			Description: fmt.Sprintf("Bridge (or bond) to attach %s to, in the same network namespace", end.what),
+			Optional:    true,
+		}
+		attrs[end.prefix+"mtu"] = schema.Int64Attribute{
+			Description: fmt.Sprintf("MTU size for %s", end.what),
+			Optional:    true,
+			Computed:    true,
+		}
+		attrs[end.prefix+"state"] = schema.StringAttribute{
+			Description: fmt.Sprintf("State of %s (up/down)", end.what),
+			Optional:    true,
+			Computed:    true,
+		}
+		attrs[end.prefix+"mac_address"] = schema.StringAttribute{
+			Description: fmt.Sprintf("MAC address for %s", end.what),
+			Optional:    true,
+			Computed:    true,
+		}
+		attrs[end.prefix+"ipv4_address"] = schema.StringAttribute{
+			Description: fmt.Sprintf("IPv4 address for %s", end.what),
+			Optional:    true,
+		}
+		attrs[end.prefix+"ipv6_address"] = schema.StringAttribute{
+			Description: fmt.Sprintf("IPv6 address for %s", end.what),
+			Optional:    true,
+		}
+	}
+
+	resp.Schema = schema.Schema{
+		Description: "Veth pair",
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "Create and manage a Linux veth pair through netlink or iproute2 commands (see the provider " +
+			"`network_backend`), e.g. to connect two `zedamigo_netns` namespaces, or a namespace to a bridge. " +
+			"Each end has its own network namespace, `master`, `mtu`, `state`, `mac_address` and addresses, the " +
+			"ones of the peer end prefixed with `peer_`. Everything but the names and the namespaces is changed " +
+			"in place, and settings changed outside of Terraform are restored on refresh. Deleting either end, " +
+			"or its network namespace, deletes the pair.",
+		Attributes: attrs,
+	}
+}
+
+func (r *Veth) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_veth", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Veth resource configure debugging", traceData)
+}
+
+func (r *Veth) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data VethModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Veth Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Veth Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Veth Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	ends := data.ends()
+	for _, e := range ends {
+		cidrAttrErrors(&resp.Diagnostics, e.IPv4Address, e.IPv6Address)
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Create the pair and configure both ends in one batch, each op runs in
+	// the namespace of its end.
+	ops := []nlops.Op{{
+		Kind:      nlops.OpLinkAdd,
+		Name:      ends[0].Name.ValueString(),
+		NetNS:     ends[0].NetNS.ValueString(),
+		Type:      nlops.TypeVeth,
+		Peer:      ends[1].Name.ValueString(),
+		PeerNetNS: ends[1].NetNS.ValueString(),
+	}}
+	for _, e := range ends {
+		ops = append(ops, vethEndCreateOps(e)...)
+	}
+
+	nl := newNetLinks(r.providerConf, "")
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("Veth Resource Error",
+			fmt.Sprintf("Unable to create a new veth pair: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read the current state of both ends.
+	if diags, err := r.readVeth(ctx, d, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read veth state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// With an IPv6 address the end also gets the link-local address derived
+	// from its MAC right away, see the bridge Create.
+	var llOps []nlops.Op
+	for _, e := range data.ends() {
+		if e.IPv6Address.IsNull() || e.IPv6Address.IsUnknown() {
+			continue
+		}
+		ops, err := linkLocalOps(e.Name.ValueString(), "", e.MACAddress.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("Veth Resource Error",
+				fmt.Sprintf("Can't configure link-local address on veth interface: %v", err))
+			return
+		}
+		llOps = append(llOps, withNetNS(e.NetNS.ValueString(), ops)...)
+	}
+	if len(llOps) > 0 {
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
+			resp.Diagnostics.AddError("Veth Resource Error",
+				fmt.Sprintf("Unable to configure veth link-local addresses: %v", err))
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	}
+
+	tflog.Trace(ctx, "Veth Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Veth) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data VethModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	prior := data
+	if diags, err := r.readVeth(ctx, d, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// An end (or its namespace) was deleted outside Terraform,
+			// and the pair with it: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read veth state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if want, drift := vethHealTarget(prior, data); drift {
+		tflog.Info(ctx, "Veth settings drifted, restoring them", map[string]any{"veth": data.Name.ValueString()})
+		if diags, err := r.applyVeth(ctx, d, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("Veth Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of veth '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readVeth(ctx, d, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read veth state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Veth) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan VethModel
+	var state VethModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The names and namespaces are RequiresReplace, so they cannot reach
+	// Update changed.
+	d := r.getResourceDir(state.ID.ValueString())
+
+	if diags, err := r.applyVeth(ctx, d, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("Veth Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readVeth(ctx, d, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read veth state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Veth) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data VethModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, "")
+
+	// Deleting one end deletes the pair. Both are tried, in case an end was
+	// moved away, and a missing end or namespace is already deleted
+	// (idempotent).
+	for _, e := range data.ends() {
+		op := nlops.Op{Kind: nlops.OpLinkDel, Name: e.Name.ValueString(), NetNS: e.NetNS.ValueString()}
+		if diags, err := nl.apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+			resp.Diagnostics.AddError("Failed to delete veth", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Veth Resource Delete Error",
+			fmt.Sprintf("Can't delete veth resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Veth) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+func (r *Veth) readVeth(ctx context.Context, resPath string, model *VethModel) (diag.Diagnostics, error) {
+	ends := model.ends()
+	for i := range ends {
+		e := &ends[i]
+		name := e.Name.ValueString()
+
+		link, diags, err := newNetLinks(r.providerConf, e.NetNS.ValueString()).show(ctx, resPath, name)
+		if err != nil {
+			return diags, fmt.Errorf("can't retrieve veth '%s' details: %w", name, err)
+		}
+
+		e.MTU = types.Int64Value(int64(link.MTU))
+		e.State = linkState(link)
+		if link.MAC != "" {
+			e.MACAddress = types.StringValue(link.MAC)
+		}
+		// Report the master only when one is configured or attached.
+		if link.Master != "" {
+			e.Master = types.StringValue(link.Master)
+		} else {
+			e.Master = types.StringNull()
+		}
+
+		// Report the configured IPv4/IPv6 address while it is still present,
+		// link-local addresses are not reported.
+		e.IPv4Address = pickIntfAddr(e.IPv4Address, link.Addrs4)
+		e.IPv6Address = pickIntfAddr(e.IPv6Address, link.Addrs6)
+	}
+	model.setEnds(ends)
+
+	return nil, nil
+}
+
+// applyVeth reconciles the in-place settings of both ends from old to new,
+// for Update and for the drift self-heal in Read. Unknown values in new are
+// left alone. All changes are applied as one batch.
+func (r *Veth) applyVeth(ctx context.Context, resPath string, old, new *VethModel) (diag.Diagnostics, error) {
+	var ops []nlops.Op
+	oldEnds, newEnds := old.ends(), new.ends()
+	for i := range newEnds {
+		endOps, err := vethEndApplyOps(oldEnds[i], newEnds[i])
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, endOps...)
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := newNetLinks(r.providerConf, "").apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply veth '%s' settings: %w", new.Name.ValueString(), err)
+	}
+	return nil, nil
+}
+
+// vethEndCreateOps returns the ops configuring a new end e: MTU, MAC, master
+// and state in one OpLinkSet (the master before the state), then addresses.
+func vethEndCreateOps(e vethEnd) []nlops.Op {
+	name := e.Name.ValueString()
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: name}
+	if !e.MTU.IsNull() && !e.MTU.IsUnknown() {
+		set.MTU = int(e.MTU.ValueInt64())
+	}
+	if !e.MACAddress.IsNull() && !e.MACAddress.IsUnknown() {
+		set.MAC = e.MACAddress.ValueString()
+	}
+	if !e.Master.IsNull() && !e.Master.IsUnknown() {
+		set.Master = e.Master.ValueString()
+	}
+	if !e.State.IsNull() && !e.State.IsUnknown() {
+		set.State = e.State.ValueString()
+	}
+	ops := []nlops.Op{set}
+	for _, addr := range []types.String{e.IPv4Address, e.IPv6Address} {
+		if !addr.IsNull() && !addr.IsUnknown() {
+			ops = append(ops, nlops.Op{Kind: nlops.OpAddrAdd, Name: name, Addr: addr.ValueString()})
+		}
+	}
+	return withNetNS(e.NetNS.ValueString(), ops)
+}
+
+// vethEndApplyOps returns the ops changing the in-place settings of an end
+// from old to new.
+func vethEndApplyOps(old, new vethEnd) ([]nlops.Op, error) {
+	name := new.Name.ValueString()
+	var ops []nlops.Op
+
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: name}
+	if !new.MTU.Equal(old.MTU) && !new.MTU.IsNull() && !new.MTU.IsUnknown() {
+		set.MTU = int(new.MTU.ValueInt64())
+	}
+	mac := old.MACAddress
+	if !new.MACAddress.Equal(old.MACAddress) && !new.MACAddress.IsNull() && !new.MACAddress.IsUnknown() {
+		set.MAC = new.MACAddress.ValueString()
+		mac = new.MACAddress
+	}
+	if !new.Master.Equal(old.Master) && !new.Master.IsUnknown() {
+		if new.Master.IsNull() {
+			set.NoMaster = true
+		} else {
+			set.Master = new.Master.ValueString()
+		}
+	}
+	if set.MTU > 0 || set.MAC != "" || set.Master != "" || set.NoMaster {
+		ops = append(ops, set)
+	}
+
+	// IPv4 / IPv6 addresses (del old, add new).
+	for _, a := range [][2]types.String{{old.IPv4Address, new.IPv4Address}, {old.IPv6Address, new.IPv6Address}} {
+		if !a[1].Equal(a[0]) {
+			addrOps, err := intfAddrOps(name, a[0], a[1])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, addrOps...)
+		}
+	}
+
+	// Keep the link-local address derived from the MAC in place, see Create.
+	if !new.IPv6Address.IsNull() && !mac.IsNull() && !mac.IsUnknown() {
+		oldMAC := ""
+		if !old.IPv6Address.IsNull() && !old.MACAddress.IsUnknown() {
+			oldMAC = old.MACAddress.ValueString()
+		}
+		if oldMAC != mac.ValueString() {
+			llOps, err := linkLocalOps(name, oldMAC, mac.ValueString())
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, llOps...)
+		}
+	}
+
+	// State last, after the master is attached.
+	if !new.State.Equal(old.State) && !new.State.IsNull() && !new.State.IsUnknown() {
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: name, State: new.State.ValueString()})
+	}
+
+	return withNetNS(new.NetNS.ValueString(), ops), nil
+}
+
+// vethHealTarget returns the settings Read restores when an end of the pair
+// drifted from the prior state, and whether it did.
+func vethHealTarget(prior, actual VethModel) (VethModel, bool) {
+	want := prior
+	wantEnds, actualEnds := want.ends(), actual.ends()
+	drift := false
+	for i := range wantEnds {
+		var d bool
+		wantEnds[i], d = vethEndHealTarget(wantEnds[i], actualEnds[i])
+		drift = drift || d
+	}
+	want.setEnds(wantEnds)
+	return want, drift
+}
+
+// vethEndHealTarget returns the settings Read restores when an end drifted
+// from the prior state, and whether it did. An address or a master that was
+// never configured is not a drift.
+func vethEndHealTarget(prior, actual vethEnd) (vethEnd, bool) {
+	want := prior
+	if want.IPv4Address.IsNull() {
+		want.IPv4Address = actual.IPv4Address
+	}
+	if want.IPv6Address.IsNull() {
+		want.IPv6Address = actual.IPv6Address
+	}
+	if want.Master.IsNull() {
+		want.Master = actual.Master
+	}
+
+	drift := !want.MTU.Equal(actual.MTU) ||
+		!want.State.Equal(actual.State) ||
+		!want.MACAddress.Equal(actual.MACAddress) ||
+		!want.Master.Equal(actual.Master) ||
+		!want.IPv4Address.Equal(actual.IPv4Address) ||
+		!want.IPv6Address.Equal(actual.IPv6Address)
+	return want, drift
+}
+
+// withNetNS runs ops in network namespace netns.
+func withNetNS(netns string, ops []nlops.Op) []nlops.Op {
+	for i := range ops {
+		ops[i].NetNS = netns
+	}
+	return ops
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/matryer/is"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+func testVethEnd(name, netns string) vethEnd {
+	return vethEnd{
+		Name:        types.StringValue(name),
+		NetNS:       types.StringValue(netns),
+		Master:      types.StringNull(),
+		MTU:         types.Int64Value(1500),
+		State:       types.StringValue("up"),
+		MACAddress:  types.StringValue("02:00:00:00:00:01"),
+		IPv4Address: types.StringNull(),
+		IPv6Address: types.StringNull(),
+	}
+}
+
+func TestVethEndCreateOps(t *testing.T) {
+	is := is.New(t)
+	e := testVethEnd("v-isp", "isp")
+	e.Master = types.StringValue("br-up")
+	e.MACAddress = types.StringUnknown()
+	e.IPv4Address = types.StringValue("192.0.2.1/24")
+
+	// Everything runs in the namespace of the end.
+	is.Equal(vethEndCreateOps(e), []nlops.Op{
+		{Kind: nlops.OpLinkSet, Name: "v-isp", NetNS: "isp", MTU: 1500, Master: "br-up", State: "up"},
+		{Kind: nlops.OpAddrAdd, Name: "v-isp", NetNS: "isp", Addr: "192.0.2.1/24"},
+	})
+}
+
+func TestVethEndApplyOps(t *testing.T) {
+	is := is.New(t)
+	old := testVethEnd("v-lan", "lan")
+	old.Master = types.StringValue("br0")
+	old.IPv4Address = types.StringValue("192.0.2.2/24")
+
+	ops, err := vethEndApplyOps(old, old)
+	is.NoErr(err)
+	is.Equal(len(ops), 0)
+
+	// Released from its master, new address and MTU.
+	new := old
+	new.Master = types.StringNull()
+	new.MTU = types.Int64Value(1400)
+	new.IPv4Address = types.StringValue("192.0.2.3/24")
+	ops, err = vethEndApplyOps(old, new)
+	is.NoErr(err)
+	is.Equal(ops, []nlops.Op{
+		{Kind: nlops.OpLinkSet, Name: "v-lan", NetNS: "lan", MTU: 1400, NoMaster: true},
+		{Kind: nlops.OpAddrDel, Name: "v-lan", NetNS: "lan", Addr: "192.0.2.2/24"},
+		{Kind: nlops.OpAddrAdd, Name: "v-lan", NetNS: "lan", Addr: "192.0.2.3/24"},
+	})
+}
+
+func TestVethHealTarget(t *testing.T) {
+	is := is.New(t)
+	var prior VethModel
+	prior.setEnds([2]vethEnd{testVethEnd("v-isp", "isp"), testVethEnd("v-lan", "lan")})
+
+	_, drift := vethHealTarget(prior, prior)
+	is.True(!drift)
+
+	// A master attached by someone else (e.g. a bridge enslaving the end) is
+	// not a drift.
+	actual := prior
+	actual.PeerMaster = types.StringValue("br0")
+	want, drift := vethHealTarget(prior, actual)
+	is.True(!drift)
+	is.Equal(want.PeerMaster, types.StringValue("br0"))
+
+	// The peer brought down is.
+	actual.PeerState = types.StringValue("down")
+	want, drift = vethHealTarget(prior, actual)
+	is.True(drift)
+	is.Equal(want.PeerState, types.StringValue("up"))
+	is.Equal(want.Name, prior.Name)
+}
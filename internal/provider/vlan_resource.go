@@ -4,20 +4,17 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
 
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/errchecker"
-	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/lladdr"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/types"
@@ -66,8 +63,10 @@ func (r *VLAN) Metadata(ctx context.Context, req resource.MetadataRequest, resp
 
 func (r *VLAN) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
 	resp.Schema = schema.Schema{
-		Description:         "VLAN sub-interface",
-		MarkdownDescription: "Create and manage a Linux network VLAN sub-interface on a specific parent interface. This is done using iproute2 commands.",
+		Description: "VLAN sub-interface",
+		MarkdownDescription: "Create and manage a Linux network VLAN sub-interface on a specific parent interface. This is done through netlink or iproute2 commands (see the provider `network_backend`). " +
+			"`mtu`, `state`, `mac_address` and the addresses are changed in place, " +
+			"and settings changed outside of Terraform are restored on refresh.",
 
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
@@ -81,10 +80,16 @@ func (r *VLAN) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 			"vlan_id": schema.Int64Attribute{
 				Description: "VLAN ID for this sub-interface",
 				Required:    true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
 			},
 			"name": schema.StringAttribute{
 				Computed:    true,
 				Description: "Full name of the resuling interface (e.g. `${parent}.${vlanid}`).",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 			"mtu": schema.Int64Attribute{
 				Description: "MTU size for the VLAN sub-interface",
@@ -100,6 +105,9 @@ func (r *VLAN) Schema(ctx context.Context, req resource.SchemaRequest, resp *res
 				Description: "Parent interface on which to create this VLAN sub-interface",
 				Optional:    false,
 				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 			"mac_address": schema.StringAttribute{
 				Description: "MAC address for the VLAN sub-interface",
@@ -176,100 +184,45 @@ func (r *VLAN) Create(ctx context.Context, req resource.CreateRequest, resp *res
 	subIf := fmt.Sprintf("%s.%d", data.Parent.ValueString(), data.VlanID.ValueInt64())
 	data.Name = types.StringValue(subIf)
 
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
-	}
+	nl := newNetLinks(r.providerConf, "")
 
-	// Create the VLAN sub-interface, e.g. sudo ip link add link eth100 name eth100.64 type vlan id 64
-	moreArgs := []string{
-		"link", "add", "link", data.Parent.ValueString(), "name", subIf,
-		"type", "vlan", "id", fmt.Sprintf("%d", data.VlanID.ValueInt64()),
-	}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		resp.Diagnostics.AddError("VLAN Resource Error",
-			"Unable to create a new VLAN.")
-		resp.Diagnostics.Append(res.Diagnostics()...)
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// Set the MTU if specified.
+	// Create and configure the VLAN sub-interface in one batch, e.g. the
+	// equivalent of `ip link add link eth100 name eth100.64 type vlan id 64`.
+	ops := []nlops.Op{{
+		Kind:   nlops.OpLinkAdd,
+		Name:   subIf,
+		Type:   nlops.TypeVLAN,
+		Parent: data.Parent.ValueString(),
+		VlanID: int(data.VlanID.ValueInt64()),
+	}}
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: subIf}
 	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
-		mtu := fmt.Sprintf("%d", data.MTU.ValueInt64())
-		moreArgs := []string{"link", "set", "dev", subIf, "mtu", mtu}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("VLAN Resource Error",
-				"Unable to create a new VLAN.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		set.MTU = int(data.MTU.ValueInt64())
 	}
-
-	// Set the state if specified.
 	if !data.State.IsNull() && !data.State.IsUnknown() {
-		state := data.State.ValueString()
-		moreArgs := []string{"link", "set", "dev", subIf, state}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("VLAN Resource Error",
-				"Unable to create a new VLAN.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+		set.State = data.State.ValueString()
 	}
-
-	// Configure an IPv4 address if specified.
-	if !data.IPv4Address.IsNull() && !data.IPv4Address.IsUnknown() {
-		addr := data.IPv4Address.ValueString()
-
-		// Validate the CIDR format
-		_, _, err := net.ParseCIDR(addr)
-		if err != nil {
-			resp.Diagnostics.AddError("Invalid IPv4 address format",
-				fmt.Sprintf("IPv4 address must be in CIDR format (e.g., '192.168.1.1/24'): %s", err.Error()))
-			return
+	ops = append(ops, set)
+	for _, addr := range []types.String{data.IPv4Address, data.IPv6Address} {
+		if !addr.IsNull() && !addr.IsUnknown() {
+			ops = append(ops, nlops.Op{Kind: nlops.OpAddrAdd, Name: subIf, Addr: addr.ValueString()})
 		}
-
-		moreArgs := []string{"addr", "add", addr, "dev", subIf}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("VLAN Resource Error",
-				"Unable to create a new VLAN.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
-
 	}
 
-	// Configure an IPv6 address if specified.
-	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
-		addr := data.IPv6Address.ValueString()
-
-		// Validate the CIDR format
-		_, _, err := net.ParseCIDR(addr)
-		if err != nil {
-			resp.Diagnostics.AddError("Invalid IPv6 address format",
-				fmt.Sprintf("IPv6 address must be in CIDR format (e.g., 'fd00::1/64'): %s", err.Error()))
-			return
-		}
-
-		moreArgs := []string{"addr", "add", addr, "dev", subIf}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
-			resp.Diagnostics.AddError("VLAN Resource Error",
-				"Unable to create a new VLAN.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
-
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("VLAN Resource Error",
+			fmt.Sprintf("Unable to create a new VLAN: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
 	// Read the VLAN current state.
-	if diags, err := r.readVLAN(ctx, d, ipCmd, ipArgs, &data); err != nil {
+	if diags, err := r.readVLAN(ctx, d, nl, &data); err != nil {
 		resp.Diagnostics.AddError("Failed to read VLAN state", err.Error())
 		resp.Diagnostics.Append(diags...)
 		return
@@ -288,18 +241,16 @@ func (r *VLAN) Create(ctx context.Context, req resource.CreateRequest, resp *res
 		// on other resources (like VMs starting) might only happen much
 		// later. At the same time other resources like RADV depend only
 		// the interface having a link-local address sooner.
-		ll, err := lladdr.LinkLocalIPv6FromMACString(data.MACAddress.ValueString())
+		llOps, err := linkLocalOps(subIf, "", data.MACAddress.ValueString())
 		if err != nil {
 			resp.Diagnostics.AddError("VLAN Resource Error",
-				fmt.Sprintf("Can't configure link-local address '%s' on VLAN interface: %v", ll.String(), err))
+				fmt.Sprintf("Can't configure link-local address on VLAN interface: %v", err))
 			return
 		}
-		moreArgs := []string{"addr", "add", fmt.Sprintf("%s/64", ll.String()), "scope", "link", "dev", subIf}
-		res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-		if err != nil {
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
 			resp.Diagnostics.AddError("VLAN Resource Error",
-				"Unable to create a new VLAN.")
-			resp.Diagnostics.Append(res.Diagnostics()...)
+				fmt.Sprintf("Unable to configure VLAN link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
 			return
 		}
 	}
@@ -321,17 +272,12 @@ func (r *VLAN) Read(ctx context.Context, req resource.ReadRequest, resp *resourc
 
 	d := r.getResourceDir(data.ID.ValueString())
 
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
-	}
+	nl := newNetLinks(r.providerConf, "")
 
 	// Read the VLAN current state.
-	if diags, err := r.readVLAN(ctx, d, ipCmd, ipArgs, &data); err != nil {
-		// Check for various error messages that indicate the device doesn't exist.
-		if errchecker.ContainsAny(err, intfNotFoundStrs) || errchecker.DiagsAny(diags, intfNotFoundStrs) {
+	prior := data
+	if diags, err := r.readVLAN(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
 			// Resource was deleted outside Terraform: remove from state.
 			resp.State.RemoveResource(ctx)
 			return
@@ -342,22 +288,58 @@ func (r *VLAN) Read(ctx context.Context, req resource.ReadRequest, resp *resourc
 		return
 	}
 
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if want, drift := vlanHealTarget(prior, data); drift {
+		tflog.Info(ctx, "VLAN settings drifted, restoring them", map[string]any{"vlan": data.Name.ValueString()})
+		if diags, err := r.applyVLAN(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("VLAN Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of VLAN '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readVLAN(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read VLAN state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
 	// Save updated data into Terraform state
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
 func (r *VLAN) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var data VLANModel
+	var plan VLANModel
+	var state VLANModel
 
-	// Read Terraform plan data into the model
-	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// TODO: What to do here ?
+	// vlan_id/parent are RequiresReplace, so the name can't change here.
+	plan.Name = state.Name
+	d := r.getResourceDir(state.ID.ValueString())
+
+	nl := newNetLinks(r.providerConf, "")
+
+	if diags, err := r.applyVLAN(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("VLAN Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readVLAN(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read VLAN state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
 
-	resp.Diagnostics.AddError("VLAN Resource Update Error", "Update is not supported.")
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 }
 
 func (r *VLAN) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
@@ -372,26 +354,12 @@ func (r *VLAN) Delete(ctx context.Context, req resource.DeleteRequest, resp *res
 	subIf := data.Name.ValueString()
 	d := r.getResourceDir(data.ID.ValueString())
 
-	ipCmd := r.providerConf.IP
-	ipArgs := []string{}
-	if r.providerConf.UseSudo {
-		ipCmd = r.providerConf.Sudo
-		ipArgs = []string{"-n", r.providerConf.IP}
-	}
-
-	// Delete an existing VLAN.
-	moreArgs := []string{"link", "del", subIf}
-	res, err := r.providerConf.Exec.Run(ctx, d, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		// Check for various error messages that indicate the device doesn't exist.
-		// If the device doesn't exist, the delete is successful (idempotent),
-		// otherwise we need to treat it like an error.
-		if errchecker.ContainsNone(err, intfNotFoundStrs) &&
-			errchecker.DiagsNone(res.Diagnostics(), intfNotFoundStrs) {
-			resp.Diagnostics.AddError("Failed to delete VLAN", err.Error())
-			resp.Diagnostics.Append(res.Diagnostics()...)
-			return
-		}
+	// Delete an existing VLAN. If it doesn't exist the delete is successful
+	// (idempotent).
+	if diags, err := newNetLinks(r.providerConf, "").apply(ctx, d, nlops.Op{Kind: nlops.OpLinkDel, Name: subIf}); err != nil {
+		resp.Diagnostics.AddError("Failed to delete VLAN", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
 	}
 
 	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
@@ -405,86 +373,109 @@ func (r *VLAN) ImportState(ctx context.Context, req resource.ImportStateRequest,
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *VLAN) readVLAN(ctx context.Context, resPath string, ipCmd string, ipArgs []string, model *VLANModel) (diag.Diagnostics, error) {
+func (r *VLAN) readVLAN(ctx context.Context, resPath string, nl netLinks, model *VLANModel) (diag.Diagnostics, error) {
 	subIf := model.Name.ValueString()
 
-	// Check if VLAN exists and get info.
-	moreArgs := []string{"link", "show", subIf}
-	res, err := r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
+	link, diags, err := nl.show(ctx, resPath, subIf)
 	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve VLAN '%s' details: %w", subIf, err)
-	}
-
-	// Parse output for MTU and state.
-	lines := strings.Split(res.Stdout, "\n")
-	// A real `ip link show` line always contains the flags section "<...>".
-	// If it doesn't, the output is empty or unparseable: fail loudly with the
-	// raw output instead of fabricating a "down" state.
-	if len(lines) == 0 || !strings.Contains(lines[0], "<") {
-		return res.Diagnostics(),
-			fmt.Errorf("can't parse VLAN '%s' link details, unexpected output: %q", subIf, res.Stdout)
-	}
-	// Parse first line: "2: br0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 ..."
-	mtuRegex := regexp.MustCompile(`mtu (\d+)`)
-	if matches := mtuRegex.FindStringSubmatch(lines[0]); len(matches) > 1 {
-		x, err := strconv.ParseInt(matches[1], 10, 64)
-		if err != nil {
-			e := fmt.Errorf("invalid VLAN '%s' MTU value '%s': %w", subIf, matches[1], err)
-			d := diag.Diagnostics{}
-			d.AddError("Can't find VLAN interface MTU value", e.Error())
-			return d, e
-		}
-		model.MTU = types.Int64Value(x)
+		return diags, fmt.Errorf("can't retrieve VLAN '%s' details: %w", subIf, err)
 	}
 
-	// Determine state from the administrative UP flag inside "<...>".
-	if linkFlagUp(lines[0]) {
-		model.State = types.StringValue("up")
-	} else {
-		model.State = types.StringValue("down")
+	model.MTU = types.Int64Value(int64(link.MTU))
+	model.State = linkState(link)
+	if link.MAC != "" {
+		model.MACAddress = types.StringValue(link.MAC)
 	}
 
-	// Parse MAC address from second line: "    link/ether 00:11:22:33:44:55 brd ff:ff:ff:ff:ff:ff"
-	if len(lines) > 1 {
-		macRegex := regexp.MustCompile(`link/ether\s+([0-9a-fA-F:]+)`)
-		if matches := macRegex.FindStringSubmatch(lines[1]); len(matches) > 1 {
-			model.MACAddress = types.StringValue(matches[1])
-		}
+	// Report the configured IPv4/IPv6 address while it is still present,
+	// link-local addresses are not reported.
+	model.IPv4Address = pickIntfAddr(model.IPv4Address, link.Addrs4)
+	model.IPv6Address = pickIntfAddr(model.IPv6Address, link.Addrs6)
+
+	return nil, nil
+}
+
+// applyVLAN reconciles the in-place settings of the VLAN sub-interface from
+// old to new, for Update and for the drift self-heal in Read. Unknown values
+// in new are left alone. All changes are applied as one batch.
+func (r *VLAN) applyVLAN(ctx context.Context, resPath string, nl netLinks, old, new *VLANModel) (diag.Diagnostics, error) {
+	subIf := new.Name.ValueString()
+	var ops []nlops.Op
+
+	// MTU and MAC address.
+	set := nlops.Op{Kind: nlops.OpLinkSet, Name: subIf}
+	if !new.MTU.Equal(old.MTU) && !new.MTU.IsNull() && !new.MTU.IsUnknown() {
+		set.MTU = int(new.MTU.ValueInt64())
+	}
+	mac := old.MACAddress
+	if !new.MACAddress.Equal(old.MACAddress) && !new.MACAddress.IsNull() && !new.MACAddress.IsUnknown() {
+		set.MAC = new.MACAddress.ValueString()
+		mac = new.MACAddress
+	}
+	if set.MTU > 0 || set.MAC != "" {
+		ops = append(ops, set)
 	}
 
-	// Get IP address(es) of VLAN.
-	moreArgs = []string{"addr", "show", subIf}
-	res, err = r.providerConf.Exec.Run(ctx, resPath, ipCmd, append(ipArgs, moreArgs...)...)
-	if err != nil {
-		return res.Diagnostics(), fmt.Errorf("can't retrieve VLAN '%s' addreses: %w", subIf, err)
-	}
-	// Look for IPv4 address in CIDR format: inet 192.168.1.1/24 brd ...
-	addrRegex := regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+/\d+)`)
-	if matches := addrRegex.FindStringSubmatch(res.Stdout); len(matches) > 1 {
-		// Validate using net.ParseCIDR to ensure it's properly formatted
-		if _, _, err := net.ParseCIDR(matches[1]); err == nil {
-			model.IPv4Address = types.StringValue(matches[1])
+	// IPv4 / IPv6 addresses (del old, add new).
+	if !new.IPv4Address.Equal(old.IPv4Address) {
+		addrOps, err := intfAddrOps(subIf, old.IPv4Address, new.IPv4Address)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, addrOps...)
+	}
+	if !new.IPv6Address.Equal(old.IPv6Address) {
+		addrOps, err := intfAddrOps(subIf, old.IPv6Address, new.IPv6Address)
+		if err != nil {
+			return nil, err
 		}
+		ops = append(ops, addrOps...)
 	}
 
-	// Look for IPv6 address in CIDR format: inet6 fd00::1/64 scope ...
-	// Skip link-local addresses (fe80::/10) as these are auto-configured
-	addr6Regex := regexp.MustCompile(`inet6 ([0-9a-fA-F:]+/\d+)`)
-	matches := addr6Regex.FindAllStringSubmatch(res.Stdout, -1)
-	for _, match := range matches {
-		if len(match) > 1 {
-			// Parse and validate the address
-			ip, _, err := net.ParseCIDR(match[1])
+	// Keep the link-local address derived from the MAC in place, see Create.
+	if !new.IPv6Address.IsNull() && !mac.IsNull() && !mac.IsUnknown() {
+		oldMAC := ""
+		if !old.IPv6Address.IsNull() && !old.MACAddress.IsUnknown() {
+			oldMAC = old.MACAddress.ValueString()
+		}
+		if oldMAC != mac.ValueString() {
+			llOps, err := linkLocalOps(subIf, oldMAC, mac.ValueString())
 			if err != nil {
-				continue
-			}
-			// Skip link-local addresses (fe80::/10)
-			if !ip.IsLinkLocalUnicast() {
-				model.IPv6Address = types.StringValue(match[1])
-				break
+				return nil, err
 			}
+			ops = append(ops, llOps...)
 		}
 	}
 
+	// State last.
+	if !new.State.Equal(old.State) && !new.State.IsNull() && !new.State.IsUnknown() {
+		ops = append(ops, nlops.Op{Kind: nlops.OpLinkSet, Name: subIf, State: new.State.ValueString()})
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply VLAN '%s' settings: %w", subIf, err)
+	}
 	return nil, nil
 }
+
+// vlanHealTarget returns the settings Read restores when the actual VLAN
+// sub-interface drifted from the prior state, and whether it did.
+func vlanHealTarget(prior, actual VLANModel) (VLANModel, bool) {
+	want := prior
+	if want.IPv4Address.IsNull() {
+		want.IPv4Address = actual.IPv4Address
+	}
+	if want.IPv6Address.IsNull() {
+		want.IPv6Address = actual.IPv6Address
+	}
+
+	drift := !want.MTU.Equal(actual.MTU) ||
+		!want.State.Equal(actual.State) ||
+		!want.MACAddress.Equal(actual.MACAddress) ||
+		!want.IPv4Address.Equal(actual.IPv4Address) ||
+		!want.IPv6Address.Equal(actual.IPv6Address)
+	return want, drift
+}
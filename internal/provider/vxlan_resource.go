@@ -0,0 +1,470 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	vxlansDir = "vxlans"
+
+	// vxlanDefaultDstPort is the IANA assigned VXLAN port, used instead
+	// of the Linux default (8472) to interoperate with other VTEPs.
+	vxlanDefaultDstPort = 4789
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &VXLAN{}
+	_ resource.ResourceWithImportState    = &VXLAN{}
+	_ resource.ResourceWithValidateConfig = &VXLAN{}
+)
+
+func NewVXLAN() resource.Resource {
+	return &VXLAN{}
+}
+
+// VXLAN defines the resource implementation.
+type VXLAN struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// VXLANModel describes the resource data model.
+type VXLANModel struct {
+	ID          types.String `tfsdk:"id"`
+	Name        types.String `tfsdk:"name"`
+	VNI         types.Int64  `tfsdk:"vni"`
+	Remote      types.String `tfsdk:"remote"`
+	Group       types.String `tfsdk:"group"`
+	Local       types.String `tfsdk:"local"`
+	Parent      types.String `tfsdk:"parent"`
+	DstPort     types.Int64  `tfsdk:"dstport"`
+	TTL         types.Int64  `tfsdk:"ttl"`
+	NetNS       types.String `tfsdk:"netns"`
+	Master      types.String `tfsdk:"master"`
+	MTU         types.Int64  `tfsdk:"mtu"`
+	State       types.String `tfsdk:"state"`
+	MACAddress  types.String `tfsdk:"mac_address"`
+	IPv4Address types.String `tfsdk:"ipv4_address"`
+	IPv6Address types.String `tfsdk:"ipv6_address"`
+}
+
+// end returns the in-place settings of the interface, which are handled like
+// the ones of a veth end.
+func (m *VXLANModel) end() vethEnd {
+	return vethEnd{m.Name, m.NetNS, m.Master, m.MTU, m.State, m.MACAddress, m.IPv4Address, m.IPv6Address}
+}
+
+func (m *VXLANModel) setEnd(e vethEnd) {
+	m.Master, m.MTU, m.State, m.MACAddress, m.IPv4Address, m.IPv6Address =
+		e.Master, e.MTU, e.State, e.MACAddress, e.IPv4Address, e.IPv6Address
+}
+
+// tunnel returns the VXLAN options of the link.
+func (m *VXLANModel) tunnel() *nlops.Tunnel {
+	return &nlops.Tunnel{
+		ID:      int(m.VNI.ValueInt64()),
+		Remote:  m.Remote.ValueString(),
+		Group:   m.Group.ValueString(),
+		Local:   m.Local.ValueString(),
+		DstPort: int(m.DstPort.ValueInt64()),
+		TTL:     int(m.TTL.ValueInt64()),
+	}
+}
+
+func (r *VXLAN) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, vxlansDir, id)
+}
+
+func (r *VXLAN) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vxlan"
+}
+
+func (r *VXLAN) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	attrs := tunnelIntfAttributes("the VXLAN interface", true)
+	attrs["id"] = schema.StringAttribute{
+		Computed:            true,
+		Description:         "VXLAN resource identifier",
+		MarkdownDescription: "VXLAN resource identifier",
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+		},
+	}
+	attrs["name"] = schema.StringAttribute{
+		Description: "Name of the VXLAN interface",
+		Required:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["vni"] = schema.Int64Attribute{
+		Description: "VXLAN Network Identifier (0-16777215)",
+		Required:    true,
+		Validators: []validator.Int64{
+			int64validator.Between(0, 1<<24-1),
+		},
+		PlanModifiers: []planmodifier.Int64{
+			int64planmodifier.RequiresReplace(),
+		},
+	}
+	attrs["remote"] = schema.StringAttribute{
+		Description: "Unicast IP address of the remote VTEP. Conflicts with `group`.",
+		Optional:    true,
+		Validators: []validator.String{
+			stringvalidator.ConflictsWith(path.MatchRoot("group")),
+		},
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["group"] = schema.StringAttribute{
+		Description: "Multicast group IP address joined on `parent` to reach the other VTEPs. Conflicts with `remote`.",
+		Optional:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["local"] = schema.StringAttribute{
+		Description: "Source IP address of the encapsulated packets",
+		Optional:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["parent"] = schema.StringAttribute{
+		Description: "Underlay interface, in the same network namespace, to send the encapsulated packets through",
+		Optional:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["dstport"] = schema.Int64Attribute{
+		Description: fmt.Sprintf("UDP destination port of the remote VTEPs. Default: `%d`, the IANA assigned one.", vxlanDefaultDstPort),
+		Optional:    true,
+		Computed:    true,
+		Default:     int64default.StaticInt64(vxlanDefaultDstPort),
+		Validators: []validator.Int64{
+			int64validator.Between(1, 65535),
+		},
+		PlanModifiers: []planmodifier.Int64{
+			int64planmodifier.RequiresReplace(),
+		},
+	}
+	attrs["ttl"] = schema.Int64Attribute{
+		Description: "TTL of the encapsulated packets, inherited from the inner packet if not specified",
+		Optional:    true,
+		Validators: []validator.Int64{
+			int64validator.Between(1, 255),
+		},
+		PlanModifiers: []planmodifier.Int64{
+			int64planmodifier.RequiresReplace(),
+		},
+	}
+
+	resp.Schema = schema.Schema{
+		Description: "VXLAN interface",
+		MarkdownDescription: undent.Md(`
+		Create and manage a Linux VXLAN interface through netlink or iproute2 commands (see the
+		provider |network_backend|). It carries Ethernet frames over UDP to a |remote| VTEP, or to
+		all the VTEPs of a multicast |group|, and can be enslaved to a |zedamigo_bridge| with
+		|master| to stretch the bridge over an IP network (e.g. between two hosts running edge nodes).
+
+		The tunnel settings require replacing the interface, while |master|, |mtu|, |state|,
+		|mac_address| and the addresses are changed in place, and settings changed outside of
+		Terraform are restored on refresh. Note that the encapsulation takes 50 bytes (70 over
+		IPv6), leave room for it in the MTU of the underlay or lower the |mtu| of the bridge.`),
+		Attributes: attrs,
+	}
+}
+
+// ValidateConfig checks the tunnel addresses, so that a typo doesn't surface
+// as an EINVAL from the kernel.
+func (r *VXLAN) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data VXLANModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	ipAttrErrors(&resp.Diagnostics, path.Empty(), map[string]types.String{
+		"remote": data.Remote, "group": data.Group, "local": data.Local,
+	})
+	if !data.Remote.IsNull() && !data.Remote.IsUnknown() {
+		if ip := net.ParseIP(data.Remote.ValueString()); ip != nil && ip.IsMulticast() {
+			resp.Diagnostics.AddAttributeError(path.Root("remote"), "Invalid VXLAN configuration",
+				"The remote VTEP address is a multicast one, use `group` instead.")
+		}
+	}
+	if !data.Group.IsNull() && !data.Group.IsUnknown() {
+		if ip := net.ParseIP(data.Group.ValueString()); ip != nil && !ip.IsMulticast() {
+			resp.Diagnostics.AddAttributeError(path.Root("group"), "Invalid VXLAN configuration",
+				"The group address isn't a multicast one, use `remote` instead.")
+		}
+	}
+}
+
+func (r *VXLAN) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_vxlan", &resp.Diagnostics)
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "VXLAN resource configure debugging", traceData)
+}
+
+func (r *VXLAN) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data VXLANModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("VXLAN Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("VXLAN Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("VXLAN Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Create and configure the interface in one batch, e.g. the equivalent
+	// of `ip link add vx0 type vxlan id 42 remote 192.0.2.2 dstport 4789`.
+	ops := []nlops.Op{{
+		Kind:   nlops.OpLinkAdd,
+		Name:   data.Name.ValueString(),
+		Type:   nlops.TypeVXLAN,
+		Parent: data.Parent.ValueString(),
+		Tunnel: data.tunnel(),
+	}}
+	ops = append(ops, vethEndCreateOps(data.end())...)
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("VXLAN Resource Error",
+			fmt.Sprintf("Unable to create a new VXLAN interface: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readVXLAN(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read VXLAN state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// With an IPv6 address the interface also gets the link-local address
+	// derived from its MAC right away, see the bridge Create.
+	if !data.IPv6Address.IsNull() && !data.IPv6Address.IsUnknown() {
+		llOps, err := linkLocalOps(data.Name.ValueString(), "", data.MACAddress.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("VXLAN Resource Error",
+				fmt.Sprintf("Can't configure link-local address on VXLAN interface: %v", err))
+			return
+		}
+		if diags, err := nl.apply(ctx, d, llOps...); err != nil {
+			resp.Diagnostics.AddError("VXLAN Resource Error",
+				fmt.Sprintf("Unable to configure VXLAN link-local address: %v", err))
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+	}
+
+	tflog.Trace(ctx, "VXLAN Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VXLAN) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data VXLANModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	prior := data
+	if diags, err := r.readVXLAN(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// The interface (or its namespace) was deleted outside
+			// Terraform: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read VXLAN state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if e, drift := vethEndHealTarget(prior.end(), data.end()); drift {
+		tflog.Info(ctx, "VXLAN settings drifted, restoring them", map[string]any{"vxlan": data.Name.ValueString()})
+		want := data
+		want.setEnd(e)
+		if diags, err := r.applyVXLAN(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("VXLAN Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of VXLAN '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readVXLAN(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read VXLAN state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VXLAN) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan VXLANModel
+	var state VXLANModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The name, the namespace and the tunnel settings are RequiresReplace,
+	// so they cannot reach Update changed.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.NetNS.ValueString())
+
+	if diags, err := r.applyVXLAN(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("VXLAN Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readVXLAN(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read VXLAN state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VXLAN) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data VXLANModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the interface. If it (or its namespace) doesn't exist the delete
+	// is successful (idempotent).
+	op := nlops.Op{Kind: nlops.OpLinkDel, Name: data.Name.ValueString()}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete VXLAN", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("VXLAN Resource Delete Error",
+			fmt.Sprintf("Can't delete VXLAN resource directory: %v", err))
+		return
+	}
+}
+
+func (r *VXLAN) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+func (r *VXLAN) readVXLAN(ctx context.Context, resPath string, nl netLinks, model *VXLANModel) (diag.Diagnostics, error) {
+	e := model.end()
+	if diags, err := readTunnelEnd(ctx, resPath, nl, &e); err != nil {
+		return diags, err
+	}
+	model.setEnd(e)
+	return nil, nil
+}
+
+// applyVXLAN reconciles the in-place settings of the interface from old to
+// new, for Update and for the drift self-heal in Read. Unknown values in new
+// are left alone. All changes are applied as one batch.
+func (r *VXLAN) applyVXLAN(ctx context.Context, resPath string, nl netLinks, old, new *VXLANModel) (diag.Diagnostics, error) {
+	ops, err := vethEndApplyOps(old.end(), new.end())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply VXLAN '%s' settings: %w", new.Name.ValueString(), err)
+	}
+	return nil, nil
+}
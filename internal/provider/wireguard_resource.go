@@ -0,0 +1,532 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/undent"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	wireguardsDir = "wireguards"
+
+	// wireguardConfFile is the wg(8) configuration of the interface, in
+	// the resource directory.
+	wireguardConfFile = "wg.conf"
+
+	wireguardDefaultListenPort = 51820
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                   = &Wireguard{}
+	_ resource.ResourceWithImportState    = &Wireguard{}
+	_ resource.ResourceWithValidateConfig = &Wireguard{}
+)
+
+func NewWireguard() resource.Resource {
+	return &Wireguard{}
+}
+
+// Wireguard defines the resource implementation.
+type Wireguard struct {
+	providerConf *ZedAmigoProviderConfig
+}
+
+// WireguardModel describes the resource data model.
+type WireguardModel struct {
+	ID          types.String         `tfsdk:"id"`
+	Name        types.String         `tfsdk:"name"`
+	PrivateKey  types.String         `tfsdk:"private_key"`
+	PublicKey   types.String         `tfsdk:"public_key"`
+	ListenPort  types.Int64          `tfsdk:"listen_port"`
+	NetNS       types.String         `tfsdk:"netns"`
+	MTU         types.Int64          `tfsdk:"mtu"`
+	State       types.String         `tfsdk:"state"`
+	IPv4Address types.String         `tfsdk:"ipv4_address"`
+	IPv6Address types.String         `tfsdk:"ipv6_address"`
+	Peers       []WireguardPeerModel `tfsdk:"peer"`
+}
+
+// WireguardPeerModel describes a `peer` block.
+type WireguardPeerModel struct {
+	PublicKey           types.String   `tfsdk:"public_key"`
+	PresharedKey        types.String   `tfsdk:"preshared_key"`
+	Endpoint            types.String   `tfsdk:"endpoint"`
+	AllowedIPs          []types.String `tfsdk:"allowed_ips"`
+	PersistentKeepalive types.Int64    `tfsdk:"persistent_keepalive"`
+}
+
+// end returns the in-place settings of the interface, which are handled like
+// the ones of a veth end. A WireGuard interface has no master and no MAC
+// address.
+func (m *WireguardModel) end() vethEnd {
+	return vethEnd{
+		Name: m.Name, NetNS: m.NetNS, Master: types.StringNull(), MTU: m.MTU, State: m.State,
+		MACAddress: types.StringNull(), IPv4Address: m.IPv4Address, IPv6Address: m.IPv6Address,
+	}
+}
+
+func (m *WireguardModel) setEnd(e vethEnd) {
+	m.MTU, m.State, m.IPv4Address, m.IPv6Address = e.MTU, e.State, e.IPv4Address, e.IPv6Address
+}
+
+// config returns the wg(8) configuration of the interface.
+func (m *WireguardModel) config() nlops.WireguardConfig {
+	c := nlops.WireguardConfig{
+		PrivateKey: m.PrivateKey.ValueString(),
+		ListenPort: int(m.ListenPort.ValueInt64()),
+	}
+	for _, p := range m.Peers {
+		peer := nlops.WireguardPeer{
+			PublicKey:           p.PublicKey.ValueString(),
+			PresharedKey:        p.PresharedKey.ValueString(),
+			Endpoint:            p.Endpoint.ValueString(),
+			PersistentKeepalive: int(p.PersistentKeepalive.ValueInt64()),
+		}
+		for _, a := range p.AllowedIPs {
+			peer.AllowedIPs = append(peer.AllowedIPs, a.ValueString())
+		}
+		c.Peers = append(c.Peers, peer)
+	}
+	return c
+}
+
+func (r *Wireguard) getResourceDir(id string) string {
+	return filepath.Join(r.providerConf.LibPath, wireguardsDir, id)
+}
+
+func (r *Wireguard) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_wireguard"
+}
+
+func (r *Wireguard) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	attrs := tunnelIntfAttributes("the WireGuard interface", false)
+	attrs["id"] = schema.StringAttribute{
+		Computed:            true,
+		Description:         "WireGuard resource identifier",
+		MarkdownDescription: "WireGuard resource identifier",
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+		},
+	}
+	attrs["name"] = schema.StringAttribute{
+		Description: "Name of the WireGuard interface",
+		Required:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["private_key"] = schema.StringAttribute{
+		Description: "Private key of the interface, in base64 (`wg genkey`). Generated if not specified. " +
+			"Changing it replaces the interface.",
+		Optional:  true,
+		Computed:  true,
+		Sensitive: true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+			stringplanmodifier.RequiresReplace(),
+		},
+	}
+	attrs["public_key"] = schema.StringAttribute{
+		Description: "Public key of the interface, in base64, for the `peer` blocks of the other end",
+		Computed:    true,
+		PlanModifiers: []planmodifier.String{
+			stringplanmodifier.UseStateForUnknown(),
+		},
+	}
+	attrs["listen_port"] = schema.Int64Attribute{
+		Description: fmt.Sprintf("UDP port to listen on. Default: `%d`.", wireguardDefaultListenPort),
+		Optional:    true,
+		Computed:    true,
+		Default:     int64default.StaticInt64(wireguardDefaultListenPort),
+		Validators: []validator.Int64{
+			int64validator.Between(1, 65535),
+		},
+	}
+
+	resp.Schema = schema.Schema{
+		Description: "WireGuard interface",
+		MarkdownDescription: undent.Md(`
+		Create and manage a Linux WireGuard interface through netlink or iproute2 commands (see the
+		provider |network_backend|; iproute2 also needs the |wg| command). The |private_key| is
+		generated unless given, the |public_key| goes in the |peer| blocks of the other end.
+
+		WireGuard is a layer 3 tunnel, so the interface can't be enslaved to a |zedamigo_bridge|
+		directly: to stretch a bridge over it run a |zedamigo_vxlan| or a |zedamigo_gretap| between
+		the addresses of the two WireGuard interfaces, and enslave that one instead.
+
+		|listen_port|, the peers, |mtu|, |state| and the addresses are changed in place. The peers
+		are replaced as a whole on every change and aren't read back, so only the interface
+		settings changed outside of Terraform are restored on refresh.`),
+		Attributes: attrs,
+		Blocks: map[string]schema.Block{
+			"peer": schema.ListNestedBlock{
+				Description: "Peer of the interface, repeat the block for more peers",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"public_key": schema.StringAttribute{
+							Description: "Public key of the peer, in base64",
+							Required:    true,
+						},
+						"preshared_key": schema.StringAttribute{
+							Description: "Additional symmetric key shared with the peer, in base64 (`wg genpsk`)",
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"endpoint": schema.StringAttribute{
+							Description: "Address of the peer, `host:port` (IPv6 as `[addr]:port`). Without it the " +
+								"peer must connect first.",
+							Optional: true,
+						},
+						"allowed_ips": schema.ListAttribute{
+							Description: "Prefixes (CIDR) routed to the peer and accepted from it, e.g. " +
+								"`[\"10.99.0.2/32\"]`",
+							ElementType: types.StringType,
+							Required:    true,
+						},
+						"persistent_keepalive": schema.Int64Attribute{
+							Description: "Interval in seconds of the keepalive packets, e.g. `25` to keep a NAT " +
+								"mapping open. Disabled if not specified.",
+							Optional: true,
+							Validators: []validator.Int64{
+								int64validator.Between(1, 65535),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// ValidateConfig checks the keys and the addresses of the configuration, the
+// same way they are checked when it is applied.
+func (r *Wireguard) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var data WireguardModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if !data.PrivateKey.IsNull() && !data.PrivateKey.IsUnknown() {
+		if err := nlops.CheckWireguardKey(data.PrivateKey.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("private_key"), "Invalid WireGuard configuration", err.Error())
+		}
+	}
+	for i, p := range data.Peers {
+		peerPath := path.Root("peer").AtListIndex(i)
+		for _, k := range []struct {
+			name string
+			v    types.String
+		}{{"public_key", p.PublicKey}, {"preshared_key", p.PresharedKey}} {
+			if k.v.IsNull() || k.v.IsUnknown() {
+				continue
+			}
+			if err := nlops.CheckWireguardKey(k.v.ValueString()); err != nil {
+				resp.Diagnostics.AddAttributeError(peerPath.AtName(k.name), "Invalid WireGuard configuration", err.Error())
+			}
+		}
+		if !p.Endpoint.IsNull() && !p.Endpoint.IsUnknown() {
+			if _, _, err := net.SplitHostPort(p.Endpoint.ValueString()); err != nil {
+				resp.Diagnostics.AddAttributeError(peerPath.AtName("endpoint"), "Invalid WireGuard configuration", err.Error())
+			}
+		}
+		for j, a := range p.AllowedIPs {
+			if a.IsNull() || a.IsUnknown() {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(a.ValueString()); err != nil {
+				resp.Diagnostics.AddAttributeError(peerPath.AtName("allowed_ips").AtListIndex(j), "Invalid WireGuard configuration", err.Error())
+			}
+		}
+	}
+}
+
+func (r *Wireguard) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	conf, ok := req.ProviderData.(*ZedAmigoProviderConfig)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected string, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.providerConf = conf
+	requireLinuxTarget(conf, "zedamigo_wireguard", &resp.Diagnostics)
+	if conf.NetworkBackend == networkBackendIPRoute2 && conf.Wg == "" {
+		resp.Diagnostics.AddError("zedamigo_wireguard requires the `wg` command.",
+			"With the `iproute2` network backend the zedamigo_wireguard resource runs the `wg` command "+
+				"of wireguard-tools, which was not found on the target.")
+	}
+
+	traceData := map[string]any{"providerConf": spew.Sprint(r.providerConf)}
+	tflog.Trace(ctx, "Wireguard resource configure debugging", traceData)
+}
+
+func (r *Wireguard) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data WireguardModel
+
+	// Read Terraform plan data into the model
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Error",
+			fmt.Sprintf("Unable to generate a new resource ID: %s", err))
+		return
+	}
+	data.ID = types.StringValue(id)
+
+	d := r.getResourceDir(data.ID.ValueString())
+	if err := r.providerConf.Exec.MkdirAll(ctx, d, 0o700); err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Error",
+			fmt.Sprintf("Unable to create resource specific directory: %s", err))
+		return
+	}
+	if err := createTFBackPointer(ctx, r.providerConf.Exec, d); err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Error",
+			fmt.Sprintf("Unable to create resource specific file: %s", err))
+		return
+	}
+
+	cidrAttrErrors(&resp.Diagnostics, data.IPv4Address, data.IPv6Address)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.PrivateKey.IsNull() || data.PrivateKey.IsUnknown() {
+		key, err := nlops.GenerateWireguardKey()
+		if err != nil {
+			resp.Diagnostics.AddError("Wireguard Resource Error",
+				fmt.Sprintf("Unable to generate a private key: %s", err))
+			return
+		}
+		data.PrivateKey = types.StringValue(key)
+	}
+	pub, err := nlops.WireguardPublicKey(data.PrivateKey.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Error",
+			fmt.Sprintf("Invalid private key: %s", err))
+		return
+	}
+	data.PublicKey = types.StringValue(pub)
+
+	set, err := r.writeConfig(ctx, d, &data)
+	if err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Error",
+			fmt.Sprintf("Unable to write the WireGuard configuration: %s", err))
+		return
+	}
+
+	// Create and configure the interface in one batch, e.g. the equivalent
+	// of `ip link add wg0 type wireguard && wg setconf wg0 wg.conf`.
+	ops := []nlops.Op{{Kind: nlops.OpLinkAdd, Name: data.Name.ValueString(), Type: nlops.TypeWireguard}, set}
+	ops = append(ops, vethEndCreateOps(data.end())...)
+
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+	if diags, err := nl.apply(ctx, d, ops...); err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Error",
+			fmt.Sprintf("Unable to create a new WireGuard interface: %v", err))
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if diags, err := r.readWireguard(ctx, d, nl, &data); err != nil {
+		resp.Diagnostics.AddError("Failed to read WireGuard state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	tflog.Trace(ctx, "Wireguard Resource created successfully")
+
+	// Save data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Wireguard) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data WireguardModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+	nl := newNetLinks(r.providerConf, data.NetNS.ValueString())
+
+	prior := data
+	if diags, err := r.readWireguard(ctx, d, nl, &data); err != nil {
+		if errors.Is(err, nlops.ErrNotFound) {
+			// The interface (or its namespace) was deleted outside
+			// Terraform: remove from state.
+			resp.State.RemoveResource(ctx)
+			return
+		}
+
+		resp.Diagnostics.AddError("Failed to read WireGuard state", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Self-heal drift back to the last applied settings, see the bridge Read.
+	if e, drift := vethEndHealTarget(prior.end(), data.end()); drift {
+		tflog.Info(ctx, "WireGuard settings drifted, restoring them", map[string]any{"wireguard": data.Name.ValueString()})
+		want := data
+		want.setEnd(e)
+		if diags, err := r.applyWireguard(ctx, d, nl, &data, &want); err != nil {
+			resp.Diagnostics.AddWarning("Wireguard Resource Read Warning",
+				fmt.Sprintf("Can't restore the drifted settings of WireGuard '%s': %v", data.Name.ValueString(), err))
+			resp.Diagnostics.Append(diagsAsWarnings(diags)...)
+		} else if diags, err := r.readWireguard(ctx, d, nl, &want); err != nil {
+			resp.Diagnostics.AddError("Failed to read WireGuard state", err.Error())
+			resp.Diagnostics.Append(diags...)
+			return
+		} else {
+			data = want
+		}
+	}
+
+	// Save updated data into Terraform state
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *Wireguard) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan WireguardModel
+	var state WireguardModel
+
+	// Read Terraform plan and current state.
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// name, private_key and netns are RequiresReplace, so they cannot reach
+	// Update changed.
+	d := r.getResourceDir(state.ID.ValueString())
+	nl := newNetLinks(r.providerConf, state.NetNS.ValueString())
+	plan.PublicKey = state.PublicKey
+
+	if diags, err := r.applyWireguard(ctx, d, nl, &state, &plan); err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Update Error", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Read back the current state so all Computed attributes are concrete
+	// before we save.
+	if diags, err := r.readWireguard(ctx, d, nl, &plan); err != nil {
+		resp.Diagnostics.AddError("Failed to read WireGuard state after update", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *Wireguard) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data WireguardModel
+
+	// Read Terraform prior state data into the model
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d := r.getResourceDir(data.ID.ValueString())
+
+	// Delete the interface. If it (or its namespace) doesn't exist the delete
+	// is successful (idempotent).
+	op := nlops.Op{Kind: nlops.OpLinkDel, Name: data.Name.ValueString()}
+	if diags, err := newNetLinks(r.providerConf, data.NetNS.ValueString()).apply(ctx, d, op); err != nil && !errors.Is(err, nlops.ErrNotFound) {
+		resp.Diagnostics.AddError("Failed to delete WireGuard interface", err.Error())
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	if err := r.providerConf.Exec.Remove(ctx, d); err != nil {
+		resp.Diagnostics.AddError("Wireguard Resource Delete Error",
+			fmt.Sprintf("Can't delete WireGuard resource directory: %v", err))
+		return
+	}
+}
+
+func (r *Wireguard) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// writeConfig writes the wg(8) configuration of model in resource directory
+// resPath (it holds the private key, so only root can read it) and returns
+// the op applying it.
+func (r *Wireguard) writeConfig(ctx context.Context, resPath string, model *WireguardModel) (nlops.Op, error) {
+	f := filepath.Join(resPath, wireguardConfFile)
+	if err := r.providerConf.Exec.WriteFile(ctx, f, []byte(model.config().Marshal()), 0o600); err != nil {
+		return nlops.Op{}, err
+	}
+	return nlops.Op{Kind: nlops.OpWireguardSet, Name: model.Name.ValueString(), Config: f}, nil
+}
+
+func (r *Wireguard) readWireguard(ctx context.Context, resPath string, nl netLinks, model *WireguardModel) (diag.Diagnostics, error) {
+	e := model.end()
+	if diags, err := readTunnelEnd(ctx, resPath, nl, &e); err != nil {
+		return diags, err
+	}
+	model.setEnd(e)
+	return nil, nil
+}
+
+// applyWireguard reconciles the in-place settings of the interface from old
+// to new, for Update and for the drift self-heal in Read. Unknown values in
+// new are left alone. The configuration is applied when it changed, then the
+// interface settings, as one batch.
+func (r *Wireguard) applyWireguard(ctx context.Context, resPath string, nl netLinks, old, new *WireguardModel) (diag.Diagnostics, error) {
+	ops, err := vethEndApplyOps(old.end(), new.end())
+	if err != nil {
+		return nil, err
+	}
+	if conf := new.config().Marshal(); conf != old.config().Marshal() {
+		set, err := r.writeConfig(ctx, resPath, new)
+		if err != nil {
+			return nil, fmt.Errorf("can't write WireGuard '%s' configuration: %w", new.Name.ValueString(), err)
+		}
+		ops = append([]nlops.Op{set}, ops...)
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	if diags, err := nl.apply(ctx, resPath, ops...); err != nil {
+		return diags, fmt.Errorf("can't apply WireGuard '%s' settings: %w", new.Name.ValueString(), err)
+	}
+	return nil, nil
+}
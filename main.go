@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/andrei-zededa/monitor-system-usage/pkg/msucollect"
 	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/provider"
@@ -72,7 +73,10 @@ var (
 	gvproxyMode       = flag.Bool("gvproxy", false, "Run the binary in 'gvproxy' mode (embedded user-space networking)")
 	gvproxyListenVfkit = flag.String("gp.listen-vfkit", "", "gvproxy: vfkit unixgram socket URI (e.g. unixgram:///path/to/sock)")
 	gvproxyListenQemu  = flag.String("gp.listen-qemu", "", "gvproxy: QEMU unix socket URI (e.g. unix:///path/to/sock)")
-	gvproxyForwards    = flag.String("gp.forwards", "", "gvproxy: comma-separated forwards (hostAddr:port/guestAddr:port,...)")
+	gvproxyForwards    = flag.String("gp.forwards", "", "gvproxy: comma-separated forwards ([udp:]hostAddr:port/guestAddr:port,...)")
+	gvproxyConfig      = flag.String("gp.config", "", "gvproxy: virtual network config file (shared network for several QEMU VMs)")
+	gvproxyControl     = flag.String("gp.control", "", "gvproxy: UNIX socket path for the HTTP control API (runtime expose/unexpose of forwards)")
+	gvproxyIPv6        = flag.Bool("gp.ipv6", false, "gvproxy: also serve the fd00:7a65:6461::/64 IPv6 subnet (router advertisements, forwarding to the host)")
 
 	tapMover       = flag.Bool("tap-mover", false, "Run the binary in 'TAP mover' mode")
 	tapMoverConfig = flag.String("tm.config", "", "TAP mover: config file path")
@@ -85,6 +89,46 @@ var (
 	// Monitor system usage mode CLI flags.
 	msuConfig = flag.String("msu.config", "", "Monitor system usage: config file path")
 	msuDump   = flag.String("msu.dump", "", "Monitor system usage: dump CBOR file to text on stdout, then exit")
+
+	packetCapture = flag.Bool("packet-capture", false, "Run the binary in 'packet capture' mode")
+	// Packet capture mode CLI flags.
+	pcConfig = flag.String("pc.config", "", "Packet capture: config file path")
+
+	netlinkMode = flag.Bool("netlink", false, "Run the binary in 'netlink' mode (apply one batch of link/address operations and exit)")
+	// Netlink mode CLI flags.
+	nlRequest = flag.String("nl.request", "", "Netlink: JSON encoded request")
+
+	dnsServer = flag.Bool("dns-server", false, "Run the binary in 'DNS server' mode")
+	// DNS server mode CLI flags.
+	dnsConfig = flag.String("dns.config", "", "DNS server: config file path")
+
+	ntpServer = flag.Bool("ntp-server", false, "Run the binary in 'NTP server' mode")
+	// NTP server mode CLI flags.
+	ntpConfig = flag.String("ntp.config", "", "NTP server: config file path")
+
+	httpProxy = flag.Bool("http-proxy", false, "Run the binary in 'HTTP proxy' mode")
+	// HTTP proxy mode CLI flags.
+	hpConfig = flag.String("hp.config", "", "HTTP proxy: config file path")
+
+	tftpServer = flag.Bool("tftp-server", false, "Run the binary in 'TFTP server' mode")
+	// TFTP server mode CLI flags.
+	tftpConfig = flag.String("tftp.config", "", "TFTP server: config file path")
+
+	traffic = flag.Bool("traffic", false, "Run the binary in 'traffic' mode (traffic generator or sink)")
+	// Traffic mode CLI flags.
+	trafficConfig = flag.String("tr.config", "", "Traffic: config file path")
+
+	supervise = flag.Bool("supervise", false, "Run the binary in 'supervise' mode (run and restart the command given after `--`)")
+	// Supervise mode CLI flags.
+	svStatus      = flag.String("sv.status", "", "Supervise: JSON status file (pid, restarts, last exit, uptime)")
+	svLog         = flag.String("sv.log", "", "Supervise: log file for the output of the command (default: the supervisor's stdout and stderr)")
+	svLogMaxSize  = flag.Int64("sv.log-max-size", 10<<20, "Supervise: rotate the log file once it reaches this size in bytes (0 disables the rotation)")
+	svLogKeep     = flag.Int("sv.log-keep", 3, "Supervise: number of rotated log files to keep")
+	svRestart     = flag.String("sv.restart", "on-failure", "Supervise: restart policy, one of always, on-failure or never")
+	svMaxRestarts = flag.Int("sv.max-restarts", 0, "Supervise: give up after this many failed runs in a row (0 means never)")
+	svBackoff     = flag.Duration("sv.backoff", time.Second, "Supervise: delay before restarting the command, doubled after each failed run in a row")
+	svMaxBackoff  = flag.Duration("sv.max-backoff", time.Minute, "Supervise: maximum restart delay; a run lasting this long resets the failure count")
+	svStopTimeout = flag.Duration("sv.stop-timeout", 10*time.Second, "Supervise: time the command is given to exit after a forwarded SIGTERM before it's killed")
 )
 
 func main() {
@@ -232,6 +276,116 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *packetCapture {
+		// Run in "packet capture" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *pcConfig == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'packet capture' mode MUST specify `-pc.config`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		packetCaptureMain()
+		os.Exit(0)
+	}
+
+	if *netlinkMode {
+		// Run in "netlink" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *nlRequest == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'netlink' mode MUST specify `-nl.request`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		os.Exit(int(netlinkMain()))
+	}
+
+	if *dnsServer {
+		// Run in "DNS server" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *dnsConfig == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'DNS server' mode MUST specify `-dns.config`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		dnsServerMain()
+		os.Exit(0)
+	}
+
+	if *ntpServer {
+		// Run in "NTP server" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *ntpConfig == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'NTP server' mode MUST specify `-ntp.config`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		ntpServerMain()
+		os.Exit(0)
+	}
+
+	if *httpProxy {
+		// Run in "HTTP proxy" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *hpConfig == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'HTTP proxy' mode MUST specify `-hp.config`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		httpProxyMain()
+		os.Exit(0)
+	}
+
+	if *tftpServer {
+		// Run in "TFTP server" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *tftpConfig == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'TFTP server' mode MUST specify `-tftp.config`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		tftpServerMain()
+		os.Exit(0)
+	}
+
+	if *traffic {
+		// Run in "traffic" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if *trafficConfig == "" {
+			fmt.Fprintf(os.Stderr, "Error: In 'traffic' mode MUST specify `-tr.config`.\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		trafficMain()
+		os.Exit(0)
+	}
+
+	if *supervise {
+		// Run in "supervise" mode and NOT the normal terraform provider mode.
+
+		// Validate CLI flags.
+		if err := validateSuperviseFlags(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: In 'supervise' mode %v.\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		os.Exit(int(superviseMain(flag.Args())))
+	}
+
 	opts := providerserver.ServeOpts{
 		// TODO: Update this string with the published name of your provider.
 		// Also update the tfplugindocs generate command to either remove the
@@ -4,7 +4,11 @@
 package main
 
 import (
+	"errors"
+	"net"
+
 	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
 	"github.com/coredhcp/coredhcp/logger"
 	"github.com/coredhcp/coredhcp/server"
 
@@ -12,16 +16,54 @@ import (
 	pl_dns "github.com/coredhcp/coredhcp/plugins/dns"
 	pl_prefix "github.com/coredhcp/coredhcp/plugins/prefix"
 	pl_range "github.com/coredhcp/coredhcp/plugins/range"
+	pl_searchdomains "github.com/coredhcp/coredhcp/plugins/searchdomains"
 	pl_serverid "github.com/coredhcp/coredhcp/plugins/serverid"
 
+	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/sirupsen/logrus"
 )
 
+// sntpPlugin sets the SNTP servers option (31) in the replies to the clients
+// that request it. Configured as `- sntp: <ipv6> ...`.
+var sntpPlugin = plugins.Plugin{
+	Name:   "sntp",
+	Setup6: sntpSetup6,
+}
+
+var sntpServers6 []net.IP
+
+func sntpSetup6(args ...string) (handler.Handler6, error) {
+	if len(args) == 0 {
+		return nil, errors.New("need at least one SNTP server")
+	}
+	for _, arg := range args {
+		ip := net.ParseIP(arg)
+		if ip == nil || ip.To4() != nil {
+			return nil, errors.New("expected an IPv6 address, got: " + arg)
+		}
+		sntpServers6 = append(sntpServers6, ip)
+	}
+	return sntpHandler6, nil
+}
+
+func sntpHandler6(req, resp dhcpv6.DHCPv6) (dhcpv6.DHCPv6, bool) {
+	msg, err := req.GetInnerMessage()
+	if err != nil {
+		return nil, true
+	}
+	if msg.IsOptionRequested(dhcpv6.OptionSNTPServerList) {
+		resp.UpdateOption(dhcpv6.OptSNTP(sntpServers6...))
+	}
+	return resp, false
+}
+
 var desiredPlugins6 = []*plugins.Plugin{
 	&pl_serverid.Plugin,
 	&pl_dns.Plugin,
 	&pl_range.Plugin,
 	&pl_prefix.Plugin,
+	&pl_searchdomains.Plugin,
+	&sntpPlugin,
 }
 
 func dhcp6ServerMain() {
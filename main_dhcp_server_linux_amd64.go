@@ -4,21 +4,188 @@
 package main
 
 import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
 	"github.com/coredhcp/coredhcp/logger"
 	"github.com/coredhcp/coredhcp/server"
 
 	"github.com/coredhcp/coredhcp/plugins"
 	pl_dns "github.com/coredhcp/coredhcp/plugins/dns"
+	pl_file "github.com/coredhcp/coredhcp/plugins/file"
+	pl_leasetime "github.com/coredhcp/coredhcp/plugins/leasetime"
+	pl_mtu "github.com/coredhcp/coredhcp/plugins/mtu"
 	pl_netmask "github.com/coredhcp/coredhcp/plugins/netmask"
 	pl_range "github.com/coredhcp/coredhcp/plugins/range"
 	pl_router "github.com/coredhcp/coredhcp/plugins/router"
+	pl_searchdomains "github.com/coredhcp/coredhcp/plugins/searchdomains"
 	pl_serverid "github.com/coredhcp/coredhcp/plugins/serverid"
 	pl_staticroute "github.com/coredhcp/coredhcp/plugins/staticroute"
 
+	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/sirupsen/logrus"
 )
 
+// ntpPlugin advertises NTP servers (option 42), CoreDHCP has no plugin for
+// it. Configured like the dns plugin: `- ntp: <ip> [<ip> ...]`.
+var ntpPlugin = plugins.Plugin{
+	Name:   "ntp",
+	Setup4: ntpSetup4,
+}
+
+var ntpServers4 []net.IP
+
+func ntpSetup4(args ...string) (handler.Handler4, error) {
+	if len(args) < 1 {
+		return nil, errors.New("need at least one NTP server")
+	}
+	for _, arg := range args {
+		srv := net.ParseIP(arg)
+		if srv.To4() == nil {
+			return nil, errors.New("expected an NTP server IPv4 address, got: " + arg)
+		}
+		ntpServers4 = append(ntpServers4, srv)
+	}
+	return ntpHandler4, nil
+}
+
+func ntpHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if req.IsOptionRequested(dhcpv4.OptionNTPServers) {
+		resp.Options.Update(dhcpv4.OptNTPServers(ntpServers4...))
+	}
+	return resp, false
+}
+
+// optionsPlugin sets arbitrary options in every reply, overriding the ones
+// set by the plugins before it. Configured as `- options: <code>:<hex> ...`,
+// e.g. `15:6c6162` for the domain name "lab".
+var optionsPlugin = plugins.Plugin{
+	Name:   "options",
+	Setup4: optionsSetup4,
+}
+
+var options4 []dhcpv4.Option
+
+func optionsSetup4(args ...string) (handler.Handler4, error) {
+	for _, arg := range args {
+		c, v, ok := strings.Cut(arg, ":")
+		if !ok {
+			return nil, errors.New("expected <code>:<hex>, got: " + arg)
+		}
+		code, err := strconv.ParseUint(c, 10, 8)
+		if err != nil || code == 0 || code == 255 {
+			return nil, errors.New("invalid option code: " + c)
+		}
+		data, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, errors.New("invalid option value: " + v)
+		}
+		options4 = append(options4, dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(code), data))
+	}
+	return optionsHandler4, nil
+}
+
+func optionsHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	for _, o := range options4 {
+		resp.Options.Update(o)
+	}
+	return resp, false
+}
+
+// hostnamePlugin sets the host name (option 12) of the clients with a static
+// lease. Configured as `- hostname: <mac>=<name> ...`, it must come before
+// the file plugin which ends the handler chain for those clients.
+var hostnamePlugin = plugins.Plugin{
+	Name:   "hostname",
+	Setup4: hostnameSetup4,
+}
+
+var hostnames4 = map[string]string{}
+
+func hostnameSetup4(args ...string) (handler.Handler4, error) {
+	for _, arg := range args {
+		m, name, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, errors.New("expected <mac>=<hostname>, got: " + arg)
+		}
+		mac, err := net.ParseMAC(m)
+		if err != nil {
+			return nil, errors.New("invalid MAC address: " + m)
+		}
+		hostnames4[mac.String()] = name
+	}
+	return hostnameHandler4, nil
+}
+
+func hostnameHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	if name, ok := hostnames4[req.ClientHWAddr.String()]; ok {
+		resp.Options.Update(dhcpv4.OptHostName(name))
+	}
+	return resp, false
+}
+
+// netbootPlugin sets the next server and boot file of PXE clients. iPXE
+// clients, detected by their user class (option 77), get the URL of an iPXE
+// script as boot file instead, so that a PXE ROM can chainload iPXE over
+// TFTP and iPXE then boots the script. Configured as
+// `- netboot: next_server=<ip> boot_file=<path> ipxe_url=<url>`, every key is
+// optional. Unlike the nbp plugin it doesn't end the handler chain.
+var netbootPlugin = plugins.Plugin{
+	Name:   "netboot",
+	Setup4: netbootSetup4,
+}
+
+var netboot4 struct {
+	nextServer net.IP
+	bootFile   string
+	ipxeURL    string
+}
+
+func netbootSetup4(args ...string) (handler.Handler4, error) {
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok || v == "" {
+			return nil, errors.New("expected <key>=<value>, got: " + arg)
+		}
+		switch k {
+		case "next_server":
+			netboot4.nextServer = net.ParseIP(v).To4()
+			if netboot4.nextServer == nil {
+				return nil, errors.New("expected a next server IPv4 address, got: " + v)
+			}
+		case "boot_file":
+			netboot4.bootFile = v
+		case "ipxe_url":
+			netboot4.ipxeURL = v
+		default:
+			return nil, errors.New("unknown netboot key: " + k)
+		}
+	}
+	return netbootHandler4, nil
+}
+
+func netbootHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	bootFile := netboot4.bootFile
+	if netboot4.ipxeURL != "" && slices.Contains(req.UserClass(), "iPXE") {
+		bootFile = netboot4.ipxeURL
+	}
+	if netboot4.nextServer != nil {
+		resp.ServerIPAddr = netboot4.nextServer
+		resp.Options.Update(dhcpv4.OptTFTPServerName(netboot4.nextServer.String()))
+	}
+	if bootFile != "" {
+		resp.BootFileName = bootFile
+		resp.Options.Update(dhcpv4.OptBootFileName(bootFile))
+	}
+	return resp, false
+}
+
 var desiredPlugins = []*plugins.Plugin{
 	&pl_serverid.Plugin,
 	&pl_dns.Plugin,
@@ -26,6 +193,14 @@ var desiredPlugins = []*plugins.Plugin{
 	&pl_netmask.Plugin,
 	&pl_range.Plugin,
 	&pl_staticroute.Plugin,
+	&pl_searchdomains.Plugin,
+	&pl_mtu.Plugin,
+	&pl_leasetime.Plugin,
+	&pl_file.Plugin,
+	&ntpPlugin,
+	&optionsPlugin,
+	&hostnamePlugin,
+	&netbootPlugin,
 }
 
 func dhcpServerMain() {
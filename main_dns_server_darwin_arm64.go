@@ -0,0 +1,14 @@
+//go:build darwin && arm64
+// +build darwin,arm64
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func dnsServerMain() {
+	fmt.Fprintf(os.Stderr, "DNS server is not supported on macOS (darwin / arm64)\n")
+	os.Exit(2)
+}
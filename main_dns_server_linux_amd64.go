@@ -0,0 +1,297 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// dnsCfg is the YAML configuration for the dns-server mode.
+type dnsCfg struct {
+	Listen    string `yaml:"listen"`
+	Interface string `yaml:"interface"`
+	Records   []struct {
+		Name  string `yaml:"name"`
+		Type  string `yaml:"type"`
+		TTL   int    `yaml:"ttl"`
+		Value string `yaml:"value"`
+	} `yaml:"records"`
+	Upstreams       []string      `yaml:"upstreams"`
+	UpstreamTimeout time.Duration `yaml:"upstream_timeout"`
+	NXDomain        []string      `yaml:"nxdomain"`
+	Delays          []struct {
+		Name  string        `yaml:"name"`
+		Delay time.Duration `yaml:"delay"`
+	} `yaml:"delays"`
+}
+
+// dnsDelay is a delay injected for the queries of a name.
+type dnsDelay struct {
+	name  string
+	delay time.Duration
+}
+
+// dnsHandler answers from the static records, injects the configured faults
+// and forwards everything else upstream (or refuses it).
+type dnsHandler struct {
+	records   []dns.RR
+	upstreams []string
+	timeout   time.Duration
+	nxdomain  []string
+	delays    []dnsDelay
+	logger    *slog.Logger
+}
+
+// dnsNameMatch reports whether the query name qname matches pattern, both
+// lowercase FQDNs. A pattern starting with "*." matches any name below it.
+func dnsNameMatch(pattern, qname string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(qname, "."+suffix)
+	}
+	return pattern == qname
+}
+
+// lookup returns the records of qname, an owner name like "*.example.com."
+// is replaced by qname in the returned copies.
+func (h *dnsHandler) lookup(qname string) []dns.RR {
+	var out []dns.RR
+	for _, rr := range h.records {
+		if dnsNameMatch(rr.Header().Name, qname) {
+			c := dns.Copy(rr)
+			c.Header().Name = qname
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// answer resolves qname/qtype from the static records, following CNAMEs. The
+// returned name is the last CNAME target that has no local records (to be
+// resolved upstream), or "" when the answer is complete. found is false when
+// qname has no local records at all.
+func (h *dnsHandler) answer(qname string, qtype uint16) (ans []dns.RR, next string, found bool) {
+	for range 8 {
+		rrs := h.lookup(qname)
+		if len(rrs) == 0 {
+			if !found {
+				return nil, "", false
+			}
+			return ans, qname, true
+		}
+		found = true
+		var cname string
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == qtype || qtype == dns.TypeANY {
+				ans = append(ans, rr)
+			} else if c, ok := rr.(*dns.CNAME); ok {
+				ans = append(ans, rr)
+				cname = strings.ToLower(c.Target)
+			}
+		}
+		if cname == "" || qtype == dns.TypeCNAME {
+			return ans, "", true
+		}
+		qname = cname
+	}
+	return ans, "", true
+}
+
+// forward sends m to the upstreams in order and returns the first reply.
+func (h *dnsHandler) forward(m *dns.Msg, network string) (*dns.Msg, error) {
+	c := &dns.Client{Net: network, Timeout: h.timeout}
+	var lastErr error
+	for _, u := range h.upstreams {
+		r, _, err := c.Exchange(m, u)
+		if err == nil {
+			return r, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (h *dnsHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	if len(req.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		_ = w.WriteMsg(resp)
+		return
+	}
+	q := req.Question[0]
+	qname := strings.ToLower(q.Name)
+	network := "udp"
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		network = "tcp"
+	}
+
+	for _, d := range h.delays {
+		if dnsNameMatch(d.name, qname) {
+			time.Sleep(d.delay)
+			break
+		}
+	}
+
+	for _, n := range h.nxdomain {
+		if dnsNameMatch(n, qname) {
+			h.logger.Info("Injected NXDOMAIN", "name", qname, "type", dns.TypeToString[q.Qtype])
+			resp.Authoritative = true
+			resp.Rcode = dns.RcodeNameError
+			_ = w.WriteMsg(resp)
+			return
+		}
+	}
+
+	ans, next, found := h.answer(qname, q.Qtype)
+	if found {
+		resp.Authoritative = true
+		resp.RecursionAvailable = len(h.upstreams) > 0
+		resp.Answer = ans
+		if next != "" && len(h.upstreams) > 0 {
+			// A local CNAME pointing outside of the local records.
+			fm := new(dns.Msg)
+			fm.SetQuestion(dns.Fqdn(next), q.Qtype)
+			fm.RecursionDesired = true
+			if r, err := h.forward(fm, network); err == nil {
+				resp.Answer = append(resp.Answer, r.Answer...)
+			} else {
+				h.logger.Warn("Upstream query failed", "name", next, "error", err)
+			}
+		}
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	if len(h.upstreams) == 0 {
+		resp.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(resp)
+		return
+	}
+	r, err := h.forward(req, network)
+	if err != nil {
+		h.logger.Warn("Upstream query failed", "name", qname, "error", err)
+		resp.Rcode = dns.RcodeServerFailure
+		_ = w.WriteMsg(resp)
+		return
+	}
+	r.Id = req.Id
+	_ = w.WriteMsg(r)
+}
+
+// bindToDeviceListenConfig binds the sockets to iface when set, so that a server
+// only answers on that interface whatever the listen address.
+func bindToDeviceListenConfig(iface string) *net.ListenConfig {
+	lc := &net.ListenConfig{}
+	if iface == "" {
+		return lc
+	}
+	lc.Control = func(network, address string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			serr = syscall.BindToDevice(int(fd), iface)
+		}); err != nil {
+			return err
+		}
+		return serr
+	}
+	return lc
+}
+
+func dnsServerMain() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	cfgData, err := os.ReadFile(*dnsConfig)
+	if err != nil {
+		logger.Error("Failed to read config file", "path", *dnsConfig, "error", err)
+		os.Exit(1)
+	}
+
+	var cfg dnsCfg
+	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
+		logger.Error("Failed to parse config file", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":53"
+	}
+	if cfg.UpstreamTimeout <= 0 {
+		cfg.UpstreamTimeout = 2 * time.Second
+	}
+
+	h := &dnsHandler{timeout: cfg.UpstreamTimeout, logger: logger}
+	for _, rec := range cfg.Records {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(rec.Name), rec.TTL, rec.Type, rec.Value))
+		if err != nil || rr == nil {
+			logger.Error("Invalid record", "name", rec.Name, "type", rec.Type, "value", rec.Value, "error", err)
+			os.Exit(1)
+		}
+		rr.Header().Name = strings.ToLower(rr.Header().Name)
+		h.records = append(h.records, rr)
+	}
+	for _, u := range cfg.Upstreams {
+		if _, _, err := net.SplitHostPort(u); err != nil {
+			u = net.JoinHostPort(u, "53")
+		}
+		h.upstreams = append(h.upstreams, u)
+	}
+	for _, n := range cfg.NXDomain {
+		h.nxdomain = append(h.nxdomain, strings.ToLower(dns.Fqdn(n)))
+	}
+	for _, d := range cfg.Delays {
+		h.delays = append(h.delays, dnsDelay{name: strings.ToLower(dns.Fqdn(d.Name)), delay: d.Delay})
+	}
+
+	lc := bindToDeviceListenConfig(cfg.Interface)
+	pc, err := lc.ListenPacket(context.Background(), "udp", cfg.Listen)
+	if err != nil {
+		logger.Error("Failed to listen on UDP", "listen", cfg.Listen, "interface", cfg.Interface, "error", err)
+		os.Exit(1)
+	}
+	l, err := lc.Listen(context.Background(), "tcp", cfg.Listen)
+	if err != nil {
+		logger.Error("Failed to listen on TCP", "listen", cfg.Listen, "interface", cfg.Interface, "error", err)
+		os.Exit(1)
+	}
+
+	servers := []*dns.Server{
+		{PacketConn: pc, Handler: h},
+		{Listener: l, Handler: h},
+	}
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			errCh <- srv.ActivateAndServe()
+		}()
+	}
+
+	logger.Info("DNS server started", "listen", cfg.Listen, "interface", cfg.Interface,
+		"records", len(h.records), "upstreams", h.upstreams)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-sigChan:
+		logger.Info("Received signal, shutting down", "signal", sig)
+	case err := <-errCh:
+		logger.Error("DNS server failed", "error", err)
+		os.Exit(1)
+	}
+	for _, srv := range servers {
+		_ = srv.Shutdown()
+	}
+}
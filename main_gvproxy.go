@@ -20,6 +20,7 @@ import (
 	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -34,6 +35,8 @@ const (
 // parseForwards converts a comma-separated forwards string into a map.
 // Format: "hostAddr:hostPort/guestAddr:guestPort,..."
 // Example: "0.0.0.0:2222/192.168.127.2:22,0.0.0.0:2223/192.168.127.2:10022"
+// A "udp:" prefix on the host side (kept as-is in the map key) makes gvproxy
+// set up a UDP instead of a TCP forward, e.g. "udp:0.0.0.0:5000/192.168.127.2:5000".
 func parseForwards(raw string) (map[string]string, error) {
 	if raw == "" {
 		return nil, nil
@@ -62,6 +65,103 @@ func parseForwards(raw string) (map[string]string, error) {
 	return result, nil
 }
 
+// gvproxyNetConfig is the virtual network configuration: gvproxy's own
+// types.Configuration plus the IPv6 subnet served by gvproxyIPv6Router, which
+// gvisor-tap-vsock has no settings for.
+type gvproxyNetConfig struct {
+	types.Configuration `yaml:",inline"`
+
+	// IPv6Subnet is the IPv6 /64 advertised to the VMs, empty for an
+	// IPv4-only network.
+	IPv6Subnet string `yaml:"ipv6Subnet,omitempty"`
+	// IPv6GatewayIP is the router's address inside IPv6Subnet. Connections
+	// to it are forwarded to the host's 127.0.0.1.
+	IPv6GatewayIP string `yaml:"ipv6GatewayIP,omitempty"`
+}
+
+// defaultGvproxyConfig returns the virtual network configuration used for a
+// single edge node VM: the fixed 192.168.127.0/24 subnet with one static DHCP
+// lease for the VM's fixed MAC address and, if ipv6 is set, the fixed
+// fd00:7a65:6461::/64 IPv6 subnet.
+func defaultGvproxyConfig(ipv6 bool) gvproxyNetConfig {
+	config := types.Configuration{
+		MTU:               1500,
+		Subnet:            gvproxyDefaultSubnet,
+		GatewayIP:         gvproxyDefaultGatewayIP,
+		GatewayMacAddress: gvproxyDefaultGatewayMAC,
+		NAT: map[string]string{
+			gvproxyDefaultHostIP: "127.0.0.1",
+		},
+		GatewayVirtualIPs: []string{gvproxyDefaultHostIP},
+		DHCPStaticLeases: map[string]string{
+			gvproxyDefaultGuestIP: gvproxyDefaultGuestMAC,
+		},
+		DNS: []types.Zone{
+			{
+				Name: "containers.internal.",
+				Records: []types.Record{
+					{Name: "gateway", IP: net.ParseIP(gvproxyDefaultGatewayIP)},
+					{Name: "host", IP: net.ParseIP(gvproxyDefaultHostIP)},
+				},
+			},
+		},
+	}
+	if !ipv6 {
+		return gvproxyNetConfig{Configuration: config}
+	}
+	return gvproxyNetConfig{
+		Configuration: config,
+		IPv6Subnet:    gvproxyDefaultIPv6Subnet,
+		IPv6GatewayIP: gvproxyDefaultIPv6GatewayIP,
+	}
+}
+
+// loadGvproxyConfig reads a virtual network configuration file, as written by
+// the zedamigo_user_network resource. The file uses gvproxy's own YAML schema
+// (types.Configuration) plus the ipv6Subnet and ipv6GatewayIP keys; fields
+// that are not set keep the defaults of a single-VM network, except for the
+// static DHCP leases and the IPv6 subnet which are taken from the file only.
+func loadGvproxyConfig(path string) (gvproxyNetConfig, error) {
+	config := defaultGvproxyConfig(false)
+	config.DHCPStaticLeases = nil
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse config file: %w", err)
+	}
+	if config.MTU == 0 {
+		config.MTU = 1500
+	}
+	if config.IPv6Subnet != "" && config.IPv6GatewayIP == "" {
+		return config, fmt.Errorf("parse config file: ipv6GatewayIP is required together with ipv6Subnet")
+	}
+	return config, nil
+}
+
+// serveGvproxyControl serves the gvproxy HTTP control API on ln until ctx is
+// done.
+func serveGvproxyControl(ctx context.Context, groupErrs *errgroup.Group, ln net.Listener, mux http.Handler) {
+	groupErrs.Go(func() error {
+		<-ctx.Done()
+		return ln.Close()
+	})
+	groupErrs.Go(func() error {
+		s := &http.Server{
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		err := s.Serve(ln)
+		if err != nil && err != http.ErrServerClosed && ctx.Err() == nil {
+			return err
+		}
+		return nil
+	})
+}
+
 func gvproxyMain() {
 	log.SetLevel(log.InfoLevel)
 	log.SetOutput(os.Stderr)
@@ -69,6 +169,9 @@ func gvproxyMain() {
 	listenVfkit := *gvproxyListenVfkit
 	listenQemu := *gvproxyListenQemu
 	forwardsRaw := *gvproxyForwards
+	configFile := *gvproxyConfig
+	controlSocket := *gvproxyControl
+	ipv6 := *gvproxyIPv6
 
 	if listenVfkit == "" && listenQemu == "" {
 		fmt.Fprintf(os.Stderr, "Error: In 'gvproxy' mode MUST specify either `-gp.listen-vfkit` or `-gp.listen-qemu`.\n")
@@ -79,45 +182,43 @@ func gvproxyMain() {
 		os.Exit(1)
 	}
 
+	if configFile != "" && listenVfkit != "" {
+		fmt.Fprintf(os.Stderr, "Error: In 'gvproxy' mode `-gp.config` (shared network) is only supported with `-gp.listen-qemu`.\n")
+		os.Exit(1)
+	}
+
+	if configFile != "" && ipv6 {
+		fmt.Fprintf(os.Stderr, "Error: In 'gvproxy' mode `-gp.ipv6` can't be used with `-gp.config`, set `ipv6Subnet` in the config file instead.\n")
+		os.Exit(1)
+	}
+
 	forwards, err := parseForwards(forwardsRaw)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to parse forwards: %v\n", err)
 		os.Exit(1)
 	}
 
-	var protocol types.Protocol
+	config := defaultGvproxyConfig(ipv6)
+	if configFile != "" {
+		config, err = loadGvproxyConfig(configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	if listenVfkit != "" {
-		protocol = types.VfkitProtocol
+		config.Protocol = types.VfkitProtocol
 	} else {
-		protocol = types.QemuProtocol
+		config.Protocol = types.QemuProtocol
 	}
-
-	config := types.Configuration{
-		MTU:               1500,
-		Subnet:            gvproxyDefaultSubnet,
-		GatewayIP:         gvproxyDefaultGatewayIP,
-		GatewayMacAddress: gvproxyDefaultGatewayMAC,
-		Protocol:          protocol,
-		NAT: map[string]string{
-			gvproxyDefaultHostIP: "127.0.0.1",
-		},
-		GatewayVirtualIPs: []string{gvproxyDefaultHostIP},
-		DHCPStaticLeases: map[string]string{
-			gvproxyDefaultGuestIP: gvproxyDefaultGuestMAC,
-		},
-		DNS: []types.Zone{
-			{
-				Name: "containers.internal.",
-				Records: []types.Record{
-					{Name: "gateway", IP: net.ParseIP(gvproxyDefaultGatewayIP)},
-					{Name: "host", IP: net.ParseIP(gvproxyDefaultHostIP)},
-				},
-			},
-		},
-		Forwards: forwards,
+	if len(forwards) > 0 && config.Forwards == nil {
+		config.Forwards = make(map[string]string, len(forwards))
+	}
+	for host, guest := range forwards {
+		config.Forwards[host] = guest
 	}
 
-	vn, err := virtualnetwork.New(&config)
+	vn, err := virtualnetwork.New(&config.Configuration)
 	if err != nil {
 		log.Fatalf("Failed to create virtual network: %v", err)
 	}
@@ -138,8 +239,14 @@ func gvproxyMain() {
 		}
 	})
 
+	if config.IPv6Subnet != "" {
+		if err := startGvproxyIPv6Router(ctx, groupErrs, vn, config); err != nil {
+			log.Fatalf("Failed to start the IPv6 router: %v", err)
+		}
+	}
+
 	// Start the HTTP control endpoint inside the virtual network.
-	ln, err := vn.Listen("tcp", fmt.Sprintf("%s:80", gvproxyDefaultGatewayIP))
+	ln, err := vn.Listen("tcp", fmt.Sprintf("%s:80", config.GatewayIP))
 	if err != nil {
 		log.Fatalf("Failed to listen on gateway: %v", err)
 	}
@@ -147,22 +254,22 @@ func gvproxyMain() {
 	mux.Handle("/services/forwarder/all", vn.Mux())
 	mux.Handle("/services/forwarder/expose", vn.Mux())
 	mux.Handle("/services/forwarder/unexpose", vn.Mux())
-	groupErrs.Go(func() error {
-		<-ctx.Done()
-		return ln.Close()
-	})
-	groupErrs.Go(func() error {
-		s := &http.Server{
-			Handler:      mux,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
+	serveGvproxyControl(ctx, groupErrs, ln, mux)
+
+	// The same endpoint on the host, so that the provider can expose and
+	// unexpose forwards of a running VM.
+	if controlSocket != "" {
+		_ = os.Remove(controlSocket)
+		cln, err := net.Listen("unix", controlSocket)
+		if err != nil {
+			log.Fatalf("Failed to listen on control socket: %v", err)
 		}
-		err := s.Serve(ln)
-		if err != nil && err != http.ErrServerClosed {
-			return err
+		if err := os.Chmod(controlSocket, 0o600); err != nil {
+			log.Fatalf("Failed to chmod control socket: %v", err)
 		}
-		return nil
-	})
+		serveGvproxyControl(ctx, groupErrs, cln, mux)
+		log.Infof("gvproxy: control API on %s", controlSocket)
+	}
 
 	if listenVfkit != "" {
 		conn, err := transport.ListenUnixgram(listenVfkit)
@@ -191,6 +298,11 @@ func gvproxyMain() {
 	}
 
 	if listenQemu != "" {
+		// A socket left by a killed gvproxy, e.g. the previous run under the
+		// supervise mode, would make the listen fail.
+		if parsed, err := url.Parse(listenQemu); err == nil && parsed.Scheme == "unix" {
+			_ = os.Remove(parsed.Path)
+		}
 		qemuListener, err := transport.Listen(listenQemu)
 		if err != nil {
 			log.Fatalf("qemu listen error: %v", err)
@@ -205,12 +317,25 @@ func gvproxyMain() {
 			return os.Remove(parsed.Path)
 		})
 
+		// Every QEMU process that connects becomes a port of the virtual
+		// switch, so several VMs can share one network (zedamigo_user_network).
 		groupErrs.Go(func() error {
-			conn, err := qemuListener.Accept()
-			if err != nil {
-				return fmt.Errorf("qemu accept error: %w", err)
+			for {
+				conn, err := qemuListener.Accept()
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return fmt.Errorf("qemu accept error: %w", err)
+				}
+				log.Infof("gvproxy: qemu connected from %s", conn.RemoteAddr())
+				groupErrs.Go(func() error {
+					if err := vn.AcceptQemu(ctx, conn); err != nil {
+						log.Errorf("gvproxy: qemu connection error: %v", err)
+					}
+					return nil
+				})
 			}
-			return vn.AcceptQemu(ctx, conn)
 		})
 
 		log.Infof("gvproxy: listening qemu %s", listenQemu)
@@ -0,0 +1,378 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/services/forwarder"
+	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
+	"github.com/mdlayher/ndp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+// gvisor-tap-vsock only registers IPv4 with the netstack of its virtual
+// network. IPv6 is served by gvproxyIPv6Router instead: a second netstack
+// plugged into the virtual switch as one more QEMU port, which advertises an
+// IPv6 /64 to the guests (SLAAC) and forwards their TCP and UDP connections
+// to the host, the same way gvproxy does for IPv4. The prefix and the gateway
+// address match those of QEMU SLIRP with nic0_ipv6, so a guest sees the same
+// IPv6 network with and without gvproxy.
+const (
+	gvproxyDefaultIPv6Subnet    = "fd00:7a65:6461::/64"
+	gvproxyDefaultIPv6GatewayIP = "fd00:7a65:6461::2"
+	// gvproxyIPv6RouterMAC is the MAC address of the IPv6 router's switch
+	// port, it must differ from the IPv4 gateway's.
+	gvproxyIPv6RouterMAC = "5a:94:ef:e4:0c:df"
+	// gvproxyIPv6RAInterval is how often router advertisements are sent. The
+	// switch drops multicast frames, so a guest's router solicitations never
+	// arrive and it has to wait for the next periodic advertisement.
+	gvproxyIPv6RAInterval = 10 * time.Second
+	gvproxyIPv6RALifetime = 30 * time.Minute
+)
+
+// gvproxyIPv6Router is the IPv6 router of a gvproxy virtual network.
+type gvproxyIPv6Router struct {
+	conn      net.Conn
+	ep        *channel.Endpoint
+	prefix    netip.Prefix
+	mac       tcpip.LinkAddress
+	linkLocal tcpip.Address
+	mtu       int
+
+	// The tap.Switch only floods broadcast frames, so multicast frames of
+	// the router (router advertisements, neighbor solicitations) are sent as
+	// unicast copies to every guest MAC address seen on the network.
+	mu         sync.Mutex
+	guests     map[tcpip.LinkAddress]bool
+	ignored    map[tcpip.LinkAddress]bool
+	newGuestCh chan struct{}
+}
+
+// startGvproxyIPv6Router connects an IPv6 router for config.IPv6Subnet to the
+// switch of vn and runs it in groupErrs until ctx is done.
+func startGvproxyIPv6Router(ctx context.Context, groupErrs *errgroup.Group, vn *virtualnetwork.VirtualNetwork, config gvproxyNetConfig) error {
+	prefix, err := netip.ParsePrefix(config.IPv6Subnet)
+	if err != nil || !prefix.Addr().Is6() || prefix.Bits() != 64 {
+		return fmt.Errorf("invalid IPv6 subnet %q: expected an IPv6 /64 prefix", config.IPv6Subnet)
+	}
+	prefix = prefix.Masked()
+	gatewayIP, err := netip.ParseAddr(config.IPv6GatewayIP)
+	if err != nil || !prefix.Contains(gatewayIP) {
+		return fmt.Errorf("invalid IPv6 gateway %q: expected an address in %s", config.IPv6GatewayIP, prefix)
+	}
+	hwAddr, err := net.ParseMAC(gvproxyIPv6RouterMAC)
+	if err != nil {
+		return err
+	}
+	mac := tcpip.LinkAddress(hwAddr)
+
+	r := &gvproxyIPv6Router{
+		// The ethernet endpoint adds and strips the Ethernet header, so the
+		// channel carries whole frames.
+		ep:         channel.New(256, uint32(config.MTU+header.EthernetMinimumSize), mac),
+		prefix:     prefix,
+		mac:        mac,
+		linkLocal:  header.LinkLocalAddr(mac),
+		mtu:        config.MTU,
+		guests:     make(map[tcpip.LinkAddress]bool),
+		ignored:    make(map[tcpip.LinkAddress]bool),
+		newGuestCh: make(chan struct{}, 1),
+	}
+	for _, m := range config.DHCPStaticLeases {
+		if hw, err := net.ParseMAC(m); err == nil {
+			r.guests[tcpip.LinkAddress(hw)] = true
+		}
+	}
+	if hw, err := net.ParseMAC(config.GatewayMacAddress); err == nil {
+		r.ignored[tcpip.LinkAddress(hw)] = true
+	}
+	r.ignored[mac] = true
+
+	s, err := r.createStack(gatewayIP)
+	if err != nil {
+		return err
+	}
+
+	conn, switchConn := net.Pipe()
+	r.conn = conn
+	groupErrs.Go(func() error {
+		if err := vn.AcceptQemu(ctx, switchConn); err != nil && ctx.Err() == nil {
+			return fmt.Errorf("ipv6 router: %w", err)
+		}
+		return nil
+	})
+	groupErrs.Go(func() error {
+		<-ctx.Done()
+		r.ep.Close()
+		s.Close()
+		return r.conn.Close()
+	})
+	groupErrs.Go(func() error { return r.receive(ctx) })
+	groupErrs.Go(func() error { return r.transmit(ctx) })
+	groupErrs.Go(func() error { return r.advertise(ctx) })
+
+	log.Infof("gvproxy: IPv6 subnet %s, gateway %s", prefix, gatewayIP)
+	return nil
+}
+
+// createStack creates the router's netstack. Like the IPv4 one of gvproxy it
+// accepts any destination address and forwards TCP and UDP to the host; the
+// gateway address itself is translated to the host's 127.0.0.1.
+func (r *gvproxyIPv6Router) createStack(gatewayIP netip.Addr) (*stack.Stack, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{
+			ipv6.NewProtocol,
+		},
+		TransportProtocols: []stack.TransportProtocolFactory{
+			tcp.NewProtocol,
+			udp.NewProtocol,
+			icmp.NewProtocol6,
+		},
+	})
+
+	if err := s.CreateNIC(1, ethernet.New(r.ep)); err != nil {
+		return nil, errors.New(err.String())
+	}
+	gateway := tcpip.AddrFrom16(gatewayIP.As16())
+	for _, addr := range []tcpip.AddressWithPrefix{
+		r.linkLocal.WithPrefix(),
+		{Address: gateway, PrefixLen: r.prefix.Bits()},
+	} {
+		if err := s.AddProtocolAddress(1, tcpip.ProtocolAddress{
+			Protocol:          ipv6.ProtocolNumber,
+			AddressWithPrefix: addr,
+		}, stack.AddressProperties{}); err != nil {
+			return nil, errors.New(err.String())
+		}
+	}
+
+	s.SetSpoofing(1, true)
+	s.SetPromiscuousMode(1, true)
+
+	subnet, err := tcpip.NewSubnet(tcpip.AddrFrom16(r.prefix.Addr().As16()), tcpip.MaskFromBytes(net.CIDRMask(r.prefix.Bits(), 128)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse subnet: %w", err)
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: subnet,
+			NIC:         1,
+		},
+	})
+
+	var natLock sync.Mutex
+	nat := map[tcpip.Address]tcpip.Address{
+		gateway: tcpip.AddrFrom4([4]byte{127, 0, 0, 1}),
+	}
+	s.SetTransportProtocolHandler(tcp.ProtocolNumber, forwarder.TCP(s, nat, &natLock, false).HandlePacket)
+	s.SetTransportProtocolHandler(udp.ProtocolNumber, forwarder.UDP(s, nat, &natLock).HandlePacket)
+	return s, nil
+}
+
+// receive reads the frames the switch sends to the router and hands them to
+// the netstack.
+func (r *gvproxyIPv6Router) receive(ctx context.Context) error {
+	reader := bufio.NewReader(r.conn)
+	sizeBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, sizeBuf); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ipv6 router: read frame size: %w", err)
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(sizeBuf))
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("ipv6 router: read frame: %w", err)
+		}
+		if len(frame) < header.EthernetMinimumSize {
+			continue
+		}
+		r.learn(header.Ethernet(frame).SourceAddress())
+
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(frame),
+		})
+		r.ep.InjectInbound(header.IPv6ProtocolNumber, pkt)
+		pkt.DecRef()
+	}
+}
+
+// transmit sends the frames of the netstack to the switch.
+func (r *gvproxyIPv6Router) transmit(ctx context.Context) error {
+	for {
+		pkt := r.ep.ReadContext(ctx)
+		if pkt == nil {
+			return nil
+		}
+		view := pkt.ToView()
+		pkt.DecRef()
+		err := r.send(view.AsSlice())
+		view.Release()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// advertise sends a router advertisement every gvproxyIPv6RAInterval, and
+// right away when a new guest shows up on the network.
+func (r *gvproxyIPv6Router) advertise(ctx context.Context) error {
+	frame, err := r.routerAdvertisement()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(gvproxyIPv6RAInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.send(frame); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-r.newGuestCh:
+		}
+	}
+}
+
+// routerAdvertisement returns the Ethernet frame of the router advertisement
+// for the subnet, sent to all nodes.
+func (r *gvproxyIPv6Router) routerAdvertisement() ([]byte, error) {
+	ra := &ndp.RouterAdvertisement{
+		CurrentHopLimit: 64,
+		RouterLifetime:  gvproxyIPv6RALifetime,
+		Options: []ndp.Option{
+			&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      net.HardwareAddr(r.mac),
+			},
+			&ndp.PrefixInformation{
+				PrefixLength:                   uint8(r.prefix.Bits()),
+				OnLink:                         true,
+				AutonomousAddressConfiguration: true,
+				ValidLifetime:                  gvproxyIPv6RALifetime,
+				PreferredLifetime:              gvproxyIPv6RALifetime,
+				Prefix:                         r.prefix.Addr(),
+			},
+			ndp.NewMTU(uint32(r.mtu)),
+		},
+	}
+	msg, err := ndp.MarshalMessage(ra)
+	if err != nil {
+		return nil, fmt.Errorf("ipv6 router: marshal router advertisement: %w", err)
+	}
+
+	dst := header.IPv6AllNodesMulticastAddress
+	frame := make([]byte, header.EthernetMinimumSize+header.IPv6MinimumSize+len(msg))
+	header.Ethernet(frame).Encode(&header.EthernetFields{
+		SrcAddr: r.mac,
+		DstAddr: header.EthernetAddressFromMulticastIPv6Address(dst),
+		Type:    header.IPv6ProtocolNumber,
+	})
+	ip := header.IPv6(frame[header.EthernetMinimumSize:])
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength:     uint16(len(msg)),
+		TransportProtocol: header.ICMPv6ProtocolNumber,
+		HopLimit:          header.NDPHopLimit,
+		SrcAddr:           r.linkLocal,
+		DstAddr:           dst,
+	})
+	icmpMsg := header.ICMPv6(ip.Payload())
+	copy(icmpMsg, msg)
+	icmpMsg.SetChecksum(header.ICMPv6Checksum(header.ICMPv6ChecksumParams{
+		Header: icmpMsg,
+		Src:    r.linkLocal,
+		Dst:    dst,
+	}))
+	return frame, nil
+}
+
+// learn records src as a guest MAC address.
+func (r *gvproxyIPv6Router) learn(src tcpip.LinkAddress) {
+	if header.IsMulticastEthernetAddress(src) {
+		return
+	}
+	r.mu.Lock()
+	known := r.guests[src] || r.ignored[src]
+	if !known {
+		r.guests[src] = true
+	}
+	r.mu.Unlock()
+	if !known {
+		log.Infof("gvproxy: IPv6 guest %s", src)
+		select {
+		case r.newGuestCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// send writes frame to the switch, a multicast frame as one unicast copy per
+// guest.
+func (r *gvproxyIPv6Router) send(frame []byte) error {
+	dst := header.Ethernet(frame).DestinationAddress()
+	if !header.IsMulticastEthernetAddress(dst) {
+		return r.write(frame)
+	}
+
+	r.mu.Lock()
+	guests := make([]tcpip.LinkAddress, 0, len(r.guests))
+	for mac := range r.guests {
+		guests = append(guests, mac)
+	}
+	r.mu.Unlock()
+
+	unicast := make([]byte, len(frame))
+	copy(unicast, frame)
+	for _, mac := range guests {
+		copy(unicast[:header.EthernetAddressSize], mac)
+		if err := r.write(unicast); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes frame to the switch in the QEMU stream format, prefixed with
+// its big-endian 32-bit length.
+func (r *gvproxyIPv6Router) write(frame []byte) error {
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	if _, err := r.conn.Write(buf); err != nil {
+		return fmt.Errorf("ipv6 router: write frame: %w", err)
+	}
+	return nil
+}
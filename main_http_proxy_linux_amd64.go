@@ -0,0 +1,492 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// proxyDialTimeout bounds the connection to the target of a CONNECT.
+const proxyDialTimeout = 10 * time.Second
+
+// proxyCfg is the YAML configuration for the http-proxy mode.
+type proxyCfg struct {
+	Listen                 string   `yaml:"listen"`
+	Interface              string   `yaml:"interface"`
+	Username               string   `yaml:"username"`
+	Password               string   `yaml:"password"`
+	Allow                  []string `yaml:"allow"`
+	Deny                   []string `yaml:"deny"`
+	AccessLog              string   `yaml:"access_log"`
+	TLSIntercept           bool     `yaml:"tls_intercept"`
+	TLSInterceptBypass     []string `yaml:"tls_intercept_bypass"`
+	TLSInterceptSkipVerify bool     `yaml:"tls_intercept_skip_verify"`
+	CACert                 string   `yaml:"ca_cert"`
+	CAKey                  string   `yaml:"ca_key"`
+}
+
+// proxyHopHeaders are the hop-by-hop headers that a proxy must not forward.
+var proxyHopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// proxy is a forward HTTP(S) proxy.
+type proxy struct {
+	cfg       proxyCfg
+	transport *http.Transport
+	logger    *slog.Logger
+
+	logMu     sync.Mutex
+	accessLog io.Writer
+
+	// TLS interception only.
+	ca      *x509.Certificate
+	caKey   crypto.Signer
+	leafKey *ecdsa.PrivateKey
+	certsMu sync.Mutex
+	certs   map[string]*tls.Certificate
+}
+
+// proxyHostMatch reports whether host matches one of the patterns. A pattern
+// starting with "*." matches any name below it, anything else only itself.
+func proxyHostMatch(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if p == host {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the requests to host may go through, the deny list
+// taking precedence over the allow one.
+func (p *proxy) allowed(host string) bool {
+	if proxyHostMatch(p.cfg.Deny, host) {
+		return false
+	}
+	return len(p.cfg.Allow) == 0 || proxyHostMatch(p.cfg.Allow, host)
+}
+
+// authorize checks the basic auth credentials of r, it returns the user name
+// for the access log.
+func (p *proxy) authorize(r *http.Request) (string, bool) {
+	if p.cfg.Username == "" {
+		return "-", true
+	}
+	auth, ok := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "Basic ")
+	if !ok {
+		return "-", false
+	}
+	b, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return "-", false
+	}
+	user, pass, _ := strings.Cut(string(b), ":")
+	if subtle.ConstantTimeCompare([]byte(user), []byte(p.cfg.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(pass), []byte(p.cfg.Password)) != 1 {
+		return user, false
+	}
+	return user, true
+}
+
+// access writes a line to the access log.
+func (p *proxy) access(r *http.Request, user, target string, status int, n int64, start time.Time, note string) {
+	if p.accessLog == nil {
+		return
+	}
+	if note == "" {
+		note = "-"
+	}
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	fmt.Fprintf(p.accessLog, "%s %s %s %s %s %d %d %.3fs %s\n", start.UTC().Format(time.RFC3339),
+		r.RemoteAddr, user, r.Method, target, status, n, time.Since(start).Seconds(), note)
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	target := r.Host
+	if r.Method != http.MethodConnect {
+		target = r.URL.String()
+	}
+
+	user, ok := p.authorize(r)
+	if !ok {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="zedamigo"`)
+		http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
+		p.access(r, user, target, http.StatusProxyAuthRequired, 0, start, "")
+		return
+	}
+	if r.Method != http.MethodConnect && !r.URL.IsAbs() {
+		http.Error(w, "Not a proxy request", http.StatusBadRequest)
+		p.access(r, user, target, http.StatusBadRequest, 0, start, "")
+		return
+	}
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	if !p.allowed(host) {
+		http.Error(w, "Forbidden by the proxy", http.StatusForbidden)
+		p.access(r, user, target, http.StatusForbidden, 0, start, "denied")
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.connect(w, r, user, host, start)
+		return
+	}
+	status, n := p.forward(w, r)
+	p.access(r, user, target, status, n, start, "")
+}
+
+// removeHopHeaders removes the hop-by-hop headers of h, including the ones
+// listed in its Connection header.
+func removeHopHeaders(h http.Header) {
+	for _, f := range h.Values("Connection") {
+		for _, k := range strings.Split(f, ",") {
+			h.Del(strings.TrimSpace(k))
+		}
+	}
+	for _, k := range proxyHopHeaders {
+		h.Del(k)
+	}
+}
+
+// forward sends the proxy request r upstream and copies back the response, it
+// returns the response status and the number of body bytes.
+func (p *proxy) forward(w http.ResponseWriter, r *http.Request) (int, int64) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		p.logger.Warn("Upstream request failed", "url", r.URL.String(), "error", err)
+		http.Error(w, "Upstream request failed", http.StatusBadGateway)
+		return http.StatusBadGateway, 0
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	n, _ := io.Copy(w, resp.Body)
+	return resp.StatusCode, n
+}
+
+// bufConn is a hijacked connection that first returns the data already
+// buffered by the HTTP server.
+type bufConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// connect handles a CONNECT request, tunnelling or intercepting it.
+func (p *proxy) connect(w http.ResponseWriter, r *http.Request, user, host string, start time.Time) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	intercept := p.cfg.TLSIntercept && !proxyHostMatch(p.cfg.TLSInterceptBypass, host)
+	var upstream net.Conn
+	if !intercept {
+		var err error
+		if upstream, err = net.DialTimeout("tcp", r.Host, proxyDialTimeout); err != nil {
+			p.logger.Warn("Failed to connect to the target", "target", r.Host, "error", err)
+			http.Error(w, "Failed to connect to the target", http.StatusBadGateway)
+			p.access(r, user, r.Host, http.StatusBadGateway, 0, start, "")
+			return
+		}
+		defer upstream.Close()
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		p.logger.Warn("Failed to hijack the connection", "error", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+	client := &bufConn{Conn: conn, r: brw.Reader}
+
+	if intercept {
+		p.access(r, user, r.Host, http.StatusOK, 0, start, "intercepted")
+		p.intercept(client, r, user, host)
+		return
+	}
+
+	var wg sync.WaitGroup
+	var up int64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		up, _ = io.Copy(upstream, client)
+		if tc, ok := upstream.(*net.TCPConn); ok {
+			_ = tc.CloseWrite()
+		}
+	}()
+	down, _ := io.Copy(conn, upstream)
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.CloseWrite()
+	}
+	wg.Wait()
+	p.access(r, user, r.Host, http.StatusOK, up+down, start, "tunnel")
+}
+
+// oneConnListener is a listener that accepts a single, already established,
+// connection.
+type oneConnListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *oneConnListener) Accept() (net.Conn, error) {
+	var c net.Conn
+	l.once.Do(func() { c = l.conn })
+	if c == nil {
+		return nil, io.EOF
+	}
+	return c, nil
+}
+
+func (l *oneConnListener) Close() error   { return nil }
+func (l *oneConnListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// closeNotifyConn signals done when the connection is closed.
+type closeNotifyConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *closeNotifyConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// intercept terminates the TLS connection of a CONNECT with a certificate of
+// host signed by the CA, and forwards the HTTP requests inside it.
+func (p *proxy) intercept(client net.Conn, connect *http.Request, user, host string) {
+	tlsConn := tls.Server(client, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return p.leafCert(name)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+	if err := tlsConn.HandshakeContext(connect.Context()); err != nil {
+		p.logger.Warn("TLS interception handshake failed", "target", connect.Host, "error", err)
+		return
+	}
+
+	cn := &closeNotifyConn{Conn: tlsConn, done: make(chan struct{})}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r.URL.Scheme = "https"
+			r.URL.Host = connect.Host
+			if strings.HasSuffix(connect.Host, ":443") {
+				r.URL.Host = host
+			}
+			r.RemoteAddr = connect.RemoteAddr
+			status, n := p.forward(w, r)
+			p.access(r, user, r.URL.String(), status, n, start, "intercepted")
+		}),
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	_ = srv.Serve(&oneConnListener{conn: cn})
+	<-cn.done
+}
+
+// leafCert returns the certificate of name, signed by the CA.
+func (p *proxy) leafCert(name string) (*tls.Certificate, error) {
+	name = strings.ToLower(name)
+	p.certsMu.Lock()
+	defer p.certsMu.Unlock()
+	if c, ok := p.certs[name]; ok {
+		return c, nil
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.AddDate(1, 0, 0)
+	if notAfter.After(p.ca.NotAfter) {
+		notAfter = p.ca.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, &p.leafKey.PublicKey, p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign certificate of %q: %w", name, err)
+	}
+	c := &tls.Certificate{Certificate: [][]byte{der, p.ca.Raw}, PrivateKey: p.leafKey}
+	p.certs[name] = c
+	return c, nil
+}
+
+// loadCA loads the CA used to sign the certificates of intercepted hosts.
+func (p *proxy) loadCA() error {
+	pair, err := tls.LoadX509KeyPair(p.cfg.CACert, p.cfg.CAKey)
+	if err != nil {
+		return err
+	}
+	if p.ca, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+		return err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("the CA key can't sign")
+	}
+	p.caKey = signer
+	if p.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return err
+	}
+	p.certs = map[string]*tls.Certificate{}
+	return nil
+}
+
+func httpProxyMain() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	cfgData, err := os.ReadFile(*hpConfig)
+	if err != nil {
+		logger.Error("Failed to read config file", "path", *hpConfig, "error", err)
+		os.Exit(1)
+	}
+
+	var cfg proxyCfg
+	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
+		logger.Error("Failed to parse config file", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":3128"
+	}
+
+	p := &proxy{cfg: cfg, logger: logger}
+	p.transport = &http.Transport{
+		Proxy:                 nil,
+		DialContext:           (&net.Dialer{Timeout: proxyDialTimeout}).DialContext,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: cfg.TLSInterceptSkipVerify},
+		TLSHandshakeTimeout:   proxyDialTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	}
+	if cfg.TLSIntercept {
+		if err := p.loadCA(); err != nil {
+			logger.Error("Failed to load the CA", "cert", cfg.CACert, "key", cfg.CAKey, "error", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.AccessLog != "" {
+		f, err := os.OpenFile(cfg.AccessLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			logger.Error("Failed to open the access log", "path", cfg.AccessLog, "error", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		p.accessLog = f
+	}
+
+	l, err := bindToDeviceListenConfig(cfg.Interface).Listen(context.Background(), "tcp", cfg.Listen)
+	if err != nil {
+		logger.Error("Failed to listen on TCP", "listen", cfg.Listen, "interface", cfg.Interface, "error", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: time.Minute,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+
+	logger.Info("HTTP proxy started", "listen", cfg.Listen, "interface", cfg.Interface,
+		"auth", cfg.Username != "", "tls_intercept", cfg.TLSIntercept)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-sigChan:
+		logger.Info("Received signal, shutting down", "signal", sig)
+	case err := <-errCh:
+		logger.Error("HTTP proxy failed", "error", err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+}
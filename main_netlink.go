@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/andrei-zededa/terraform-provider-zedamigo/internal/nlops"
+)
+
+// netlinkMain applies the request given with `-nl.request` and writes the
+// JSON response to stdout. A failed request is reported in the response and
+// still exits with success, so that the provider can match the typed error;
+// only a request that can't be decoded is an error exit.
+func netlinkMain() ExitCode {
+	var req nlops.Request
+	if err := json.Unmarshal([]byte(*nlRequest), &req); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Can't decode netlink request: %v\n", err)
+		return ExitError
+	}
+
+	out, err := json.Marshal(nlops.Do(req))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Can't encode netlink response: %v\n", err)
+		return ExitError
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", out)
+
+	return ExitSuccess
+}
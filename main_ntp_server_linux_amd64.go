@@ -0,0 +1,151 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ntpEpochOffset is the number of seconds between the NTP epoch
+	// (1900-01-01) and the Unix one.
+	ntpEpochOffset = 2208988800
+
+	ntpPacketLen  = 48
+	ntpModeClient = 3
+	ntpModeServer = 4
+	// ntpLINotSync is the "alarm condition" leap indicator of an
+	// unsynchronized server.
+	ntpLINotSync = 3
+)
+
+// ntpCfg is the YAML configuration for the ntp-server mode.
+type ntpCfg struct {
+	Listen    string        `yaml:"listen"`
+	Interface string        `yaml:"interface"`
+	Offset    time.Duration `yaml:"offset"`
+	Stratum   int           `yaml:"stratum"`
+	// Mode is "synchronized", "unsynchronized" or "kiss_of_death".
+	Mode     string `yaml:"mode"`
+	KissCode string `yaml:"kiss_code"`
+}
+
+// ntpTime returns t as a 64 bit NTP timestamp.
+func ntpTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// ntpReply returns the server reply to the client request req received at
+// recv, both already shifted by the configured offset.
+func ntpReply(cfg *ntpCfg, req []byte, recv, now time.Time) []byte {
+	resp := make([]byte, ntpPacketLen)
+	vn := req[0] >> 3 & 0x7
+	li := byte(0)
+	stratum := byte(cfg.Stratum)
+	refID := []byte("LOCL")
+	switch cfg.Mode {
+	case "unsynchronized":
+		li, stratum = ntpLINotSync, 16
+	case "kiss_of_death":
+		li, stratum, refID = ntpLINotSync, 0, []byte(cfg.KissCode)
+	}
+
+	resp[0] = li<<6 | vn<<3 | ntpModeServer
+	resp[1] = stratum
+	resp[2] = req[2] // Poll, as asked by the client.
+	resp[3] = 0xec   // Precision, -20 that is 2^-20s (~1us).
+	// Root dispersion, 16/65536s (~0.25ms).
+	binary.BigEndian.PutUint32(resp[8:], 0x10)
+	copy(resp[12:16], refID)
+	if cfg.Mode == "synchronized" {
+		binary.BigEndian.PutUint64(resp[16:], ntpTime(recv.Add(-time.Minute)))
+	}
+	copy(resp[24:32], req[40:48]) // Originate is the client transmit timestamp.
+	binary.BigEndian.PutUint64(resp[32:], ntpTime(recv))
+	binary.BigEndian.PutUint64(resp[40:], ntpTime(now))
+	return resp
+}
+
+func ntpServerMain() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	cfgData, err := os.ReadFile(*ntpConfig)
+	if err != nil {
+		logger.Error("Failed to read config file", "path", *ntpConfig, "error", err)
+		os.Exit(1)
+	}
+
+	var cfg ntpCfg
+	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
+		logger.Error("Failed to parse config file", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":123"
+	}
+	if cfg.Stratum <= 0 {
+		cfg.Stratum = 1
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = "synchronized"
+	}
+	if cfg.KissCode == "" {
+		cfg.KissCode = "DENY"
+	}
+
+	pc, err := bindToDeviceListenConfig(cfg.Interface).ListenPacket(context.Background(), "udp", cfg.Listen)
+	if err != nil {
+		logger.Error("Failed to listen on UDP", "listen", cfg.Listen, "interface", cfg.Interface, "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("NTP server started", "listen", cfg.Listen, "interface", cfg.Interface,
+		"offset", cfg.Offset, "stratum", cfg.Stratum, "mode", cfg.Mode)
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				logger.Error("NTP server failed", "error", err)
+				os.Exit(1)
+			}
+			recv := time.Now().Add(cfg.Offset)
+			if n < ntpPacketLen || buf[0]&0x7 != ntpModeClient {
+				continue
+			}
+			if cfg.Mode != "synchronized" {
+				logger.Info("Sending a faulty reply", "client", addr, "mode", cfg.Mode)
+			}
+			resp := ntpReply(&cfg, buf[:n], recv, time.Now().Add(cfg.Offset))
+			if _, err := pc.WriteTo(resp, addr); err != nil {
+				logger.Warn("Failed to send reply", "client", addr, "error", err)
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	logger.Info("Received signal, shutting down", "signal", sig)
+	_ = pc.Close()
+}
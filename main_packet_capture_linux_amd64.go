@@ -0,0 +1,263 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
+)
+
+// pcCfg is the YAML configuration for the packet-capture mode.
+type pcCfg struct {
+	Interface  string `yaml:"interface"`
+	OutputFile string `yaml:"output_file"`
+	// BPF is the capture filter, a classic BPF program with one
+	// [code, jt, jf, k] instruction per entry as printed by `tcpdump -ddd`.
+	BPF         [][4]uint32 `yaml:"bpf"`
+	Snaplen     int         `yaml:"snaplen"`
+	Promiscuous bool        `yaml:"promiscuous"`
+	// RotateSize is the size in bytes after which the output file is
+	// rotated, 0 means never.
+	RotateSize int64 `yaml:"rotate_size"`
+	// RotateFiles is the number of rotated files kept next to the current
+	// one (output_file.1 is the most recent).
+	RotateFiles int `yaml:"rotate_files"`
+}
+
+// pcWriter writes pcapng files and rotates them as a ring buffer.
+type pcWriter struct {
+	cfg     pcCfg
+	mu      sync.Mutex
+	f       *os.File
+	w       *pcapgo.NgWriter
+	written int64
+	dirty   bool // Packets written since the last flush.
+}
+
+func (pw *pcWriter) open() error {
+	f, err := os.OpenFile(pw.cfg.OutputFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create output file: %w", err)
+	}
+	w, err := pcapgo.NewNgWriterInterface(f, pcapgo.NgInterface{
+		Name:       pw.cfg.Interface,
+		OS:         "linux",
+		LinkType:   layers.LinkTypeEthernet,
+		SnapLength: uint32(pw.cfg.Snaplen),
+	}, pcapgo.NgWriterOptions{
+		SectionInfo: pcapgo.NgSectionInfo{
+			OS:          "linux",
+			Application: "terraform-provider-zedamigo packet capture",
+		},
+	})
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("write pcapng header: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write pcapng header: %w", err)
+	}
+	pw.f, pw.w, pw.written, pw.dirty = f, w, 0, false
+	return nil
+}
+
+// flush writes the buffered packets to the current file.
+func (pw *pcWriter) flush() error {
+	if pw.w == nil || !pw.dirty {
+		return nil
+	}
+	pw.dirty = false
+	return pw.w.Flush()
+}
+
+// close flushes and closes the current file.
+func (pw *pcWriter) close() error {
+	if pw.f == nil {
+		return nil
+	}
+	err := pw.w.Flush()
+	if cerr := pw.f.Close(); err == nil {
+		err = cerr
+	}
+	pw.f, pw.w = nil, nil
+	return err
+}
+
+// rotate shifts output_file.N-1 to output_file.N (dropping the oldest),
+// moves the current file to output_file.1 and starts a new one.
+func (pw *pcWriter) rotate() error {
+	if err := pw.close(); err != nil {
+		return err
+	}
+	base := pw.cfg.OutputFile
+	if pw.cfg.RotateFiles > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", base, pw.cfg.RotateFiles))
+		for i := pw.cfg.RotateFiles - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", base, i), fmt.Sprintf("%s.%d", base, i+1))
+		}
+		if err := os.Rename(base, base+".1"); err != nil {
+			return fmt.Errorf("rotate output file: %w", err)
+		}
+	}
+	return pw.open()
+}
+
+// pcFlushInterval is how often buffered packets are flushed to the output.
+const pcFlushInterval = time.Second
+
+// pcTemporary reports whether a read error is worth retrying. pcapgo only
+// keeps the errno text in its errors.
+func pcTemporary(err error) bool {
+	msg := err.Error()
+	return strings.HasSuffix(msg, unix.EINTR.Error()) || strings.HasSuffix(msg, unix.EAGAIN.Error())
+}
+
+func packetCaptureMain() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	cfgData, err := os.ReadFile(*pcConfig)
+	if err != nil {
+		logger.Error("Failed to read config file", "path", *pcConfig, "error", err)
+		os.Exit(1)
+	}
+
+	var cfg pcCfg
+	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
+		logger.Error("Failed to parse config file", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.Interface == "" || cfg.OutputFile == "" {
+		logger.Error("interface and output_file are required in config")
+		os.Exit(1)
+	}
+	if cfg.Snaplen <= 0 {
+		cfg.Snaplen = 262144
+	}
+
+	h, err := pcapgo.NewEthernetHandle(cfg.Interface)
+	if err != nil {
+		logger.Error("Failed to open AF_PACKET socket", "interface", cfg.Interface, "error", err)
+		os.Exit(1)
+	}
+	if err := h.SetCaptureLength(cfg.Snaplen); err != nil {
+		logger.Error("Failed to set snaplen", "error", err)
+		os.Exit(1)
+	}
+	if err := h.SetPromiscuous(cfg.Promiscuous); err != nil {
+		logger.Error("Failed to set promiscuous mode", "error", err)
+		os.Exit(1)
+	}
+	// The socket already receives packets, drop those queued before the
+	// filter was attached, see the read loop.
+	var filterSince time.Time
+	if len(cfg.BPF) > 0 {
+		prog := make([]bpf.RawInstruction, len(cfg.BPF))
+		for i, ins := range cfg.BPF {
+			prog[i] = bpf.RawInstruction{Op: uint16(ins[0]), Jt: uint8(ins[1]), Jf: uint8(ins[2]), K: ins[3]}
+		}
+		if err := h.SetBPF(prog); err != nil {
+			logger.Error("Failed to attach filter", "error", err)
+			os.Exit(1)
+		}
+		filterSince = time.Now()
+	}
+
+	pw := &pcWriter{cfg: cfg}
+	if err := pw.open(); err != nil {
+		logger.Error("Failed to open output", "error", err)
+		os.Exit(1)
+	}
+
+	// The read loop blocks in recvmsg, so flush and exit from the signal
+	// handler instead of waiting for the loop to notice.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		pw.mu.Lock()
+		defer pw.mu.Unlock()
+		if err := pw.close(); err != nil {
+			logger.Error("Failed to close output", "error", err)
+		}
+		logger.Info("Packet capture stopped", "signal", sig)
+		os.Exit(0)
+	}()
+
+	go func() {
+		for range time.Tick(pcFlushInterval) {
+			pw.mu.Lock()
+			if err := pw.flush(); err != nil {
+				logger.Error("Failed to flush output", "error", err)
+				pw.mu.Unlock()
+				os.Exit(1)
+			}
+			pw.mu.Unlock()
+		}
+	}()
+
+	logger.Info("Packet capture started", "interface", cfg.Interface, "output_file", cfg.OutputFile,
+		"bpf_instructions", len(cfg.BPF), "snaplen", cfg.Snaplen)
+
+	for {
+		data, ci, err := h.ReadPacketData()
+		if err != nil {
+			if pcTemporary(err) {
+				continue
+			}
+			// Retrying would only spin, let the supervisor restart the capture.
+			logger.Error("Failed to read packet", "error", err)
+			pw.mu.Lock()
+			if err := pw.close(); err != nil {
+				logger.Error("Failed to close output", "error", err)
+			}
+			os.Exit(1)
+		}
+		if !filterSince.IsZero() {
+			if ci.Timestamp.Before(filterSince) {
+				continue // Received before the filter was attached.
+			}
+			filterSince = time.Time{}
+		}
+
+		pw.mu.Lock()
+		if pw.w == nil {
+			pw.mu.Unlock()
+			continue
+		}
+		ci.InterfaceIndex = 0 // The only interface in the pcapng section.
+		if err := pw.w.WritePacket(ci, data); err != nil {
+			logger.Error("Failed to write packet", "error", err)
+			pw.mu.Unlock()
+			os.Exit(1)
+		}
+		pw.dirty = true
+		// Enhanced packet block: 32 bytes of framing plus the padded data.
+		pw.written += 32 + int64((len(data)+3)&^3)
+		if cfg.RotateSize > 0 && pw.written >= cfg.RotateSize {
+			if err := pw.rotate(); err != nil {
+				logger.Error("Failed to rotate output", "error", err)
+				pw.mu.Unlock()
+				os.Exit(1)
+			}
+		}
+		pw.mu.Unlock()
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,20 +21,48 @@ import (
 )
 
 type radvDaemonConfig struct {
-	Interface               string   `yaml:"interface"`
-	Prefix                  string   `yaml:"prefix"`
-	Routes                  []string `yaml:"routes"`
-	PrefixOnLink            bool     `yaml:"prefix_on_link"`
-	PrefixAutonomous        bool     `yaml:"prefix_autonomous"`
-	PrefixValidLifetime     int64    `yaml:"prefix_valid_lifetime"`
-	PrefixPreferredLifetime int64    `yaml:"prefix_preferred_lifetime"`
-	DNSServers              string   `yaml:"dns_servers"`
-	ManagedConfig           bool     `yaml:"managed_config"`
-	OtherConfig             bool     `yaml:"other_config"`
-	RouterLifetime          int64    `yaml:"router_lifetime"`
-	MaxInterval             int64    `yaml:"max_interval"`
-	MinInterval             int64    `yaml:"min_interval"`
-	HopLimit                int64    `yaml:"hop_limit"`
+	Interface string             `yaml:"interface"`
+	Prefixes  []radvDaemonPrefix `yaml:"prefixes"`
+	Routes    []string           `yaml:"routes"`
+
+	// Single prefix, as written by older versions of the provider. Used
+	// in addition to `prefixes`.
+	Prefix                  string `yaml:"prefix"`
+	PrefixOnLink            bool   `yaml:"prefix_on_link"`
+	PrefixAutonomous        bool   `yaml:"prefix_autonomous"`
+	PrefixValidLifetime     int64  `yaml:"prefix_valid_lifetime"`
+	PrefixPreferredLifetime int64  `yaml:"prefix_preferred_lifetime"`
+
+	// Comma separated list of DNS servers, as written by older versions of
+	// the provider. Used in addition to `rdnss`.
+	DNSServers string `yaml:"dns_servers"`
+
+	RDNSS            []string          `yaml:"rdnss"`
+	RDNSSLifetime    int64             `yaml:"rdnss_lifetime"`
+	DNSSL            []string          `yaml:"dnssl"`
+	DNSSLLifetime    int64             `yaml:"dnssl_lifetime"`
+	MTU              int64             `yaml:"mtu"`
+	PREF64           *radvDaemonPREF64 `yaml:"pref64"`
+	RouterPreference string            `yaml:"router_preference"`
+	ManagedConfig    bool              `yaml:"managed_config"`
+	OtherConfig      bool              `yaml:"other_config"`
+	RouterLifetime   int64             `yaml:"router_lifetime"`
+	MaxInterval      int64             `yaml:"max_interval"`
+	MinInterval      int64             `yaml:"min_interval"`
+	HopLimit         int64             `yaml:"hop_limit"`
+}
+
+type radvDaemonPrefix struct {
+	Prefix            string `yaml:"prefix"`
+	OnLink            bool   `yaml:"on_link"`
+	Autonomous        bool   `yaml:"autonomous"`
+	ValidLifetime     int64  `yaml:"valid_lifetime"`
+	PreferredLifetime int64  `yaml:"preferred_lifetime"`
+}
+
+type radvDaemonPREF64 struct {
+	Prefix   string `yaml:"prefix"`
+	Lifetime int64  `yaml:"lifetime"`
 }
 
 func radvMain() {
@@ -42,33 +71,26 @@ func radvMain() {
 		os.Exit(1)
 	}
 
-	// Load configuration.
-	configData, err := os.ReadFile(*radvConfig)
+	config, err := loadRADVConfig(*radvConfig)
 	if err != nil {
-		log.Fatalf("Failed to read config file: %v", err)
+		log.Fatal(err)
 	}
 
-	config := radvDaemonConfig{}
-	if err := yaml.Unmarshal(configData, &config); err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
-	}
-
-	// Parse prefix.
-	prefix, err := netip.ParsePrefix(config.Prefix)
+	// Build Router Advertisement message.
+	ra, err := buildRouterAdvertisement(config)
 	if err != nil {
-		log.Fatalf("Invalid prefix %s: %v", config.Prefix, err)
+		log.Fatalf("Invalid config file: %v", err)
 	}
 
-	// Build Router Advertisement message.
-	ra := buildRouterAdvertisement(&config, prefix)
-
 	// Create context for graceful shutdown.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle signals.
+	// Handle signals, SIGHUP reloads the config file.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
 	go func() {
 		<-sigChan
@@ -106,85 +128,219 @@ func radvMain() {
 	log.Printf("Listening on %s (%s)", config.Interface, ip)
 
 	// Run the RA daemon.
-	if err := runRADaemon(ctx, conn, ra, &config, iface); err != nil {
+	if err := runRADaemon(ctx, conn, ra, config, hupChan); err != nil {
 		log.Fatalf("RADV daemon error: %v", err)
 	}
 
 	log.Println("RADV daemon stopped")
 }
 
-func buildRouterAdvertisement(config *radvDaemonConfig, prefix netip.Prefix) *ndp.RouterAdvertisement {
-	// Build prefix information option
-	prefixInfo := &ndp.PrefixInformation{
-		PrefixLength:                   uint8(prefix.Bits()),
-		OnLink:                         config.PrefixOnLink,
-		AutonomousAddressConfiguration: config.PrefixAutonomous,
-		ValidLifetime:                  time.Duration(config.PrefixValidLifetime) * time.Second,
-		PreferredLifetime:              time.Duration(config.PrefixPreferredLifetime) * time.Second,
-		Prefix:                         prefix.Addr(),
+func loadRADVConfig(path string) (*radvDaemonConfig, error) {
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	options := []ndp.Option{prefixInfo}
+	config := radvDaemonConfig{}
+	if err := yaml.Unmarshal(configData, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return &config, nil
+}
+
+// prefixes returns all the prefixes to advertise, including the single one
+// from older config files.
+func (config *radvDaemonConfig) prefixes() []radvDaemonPrefix {
+	var prefixes []radvDaemonPrefix
+	if config.Prefix != "" {
+		prefixes = append(prefixes, radvDaemonPrefix{
+			Prefix:            config.Prefix,
+			OnLink:            config.PrefixOnLink,
+			Autonomous:        config.PrefixAutonomous,
+			ValidLifetime:     config.PrefixValidLifetime,
+			PreferredLifetime: config.PrefixPreferredLifetime,
+		})
+	}
+	return append(prefixes, config.Prefixes...)
+}
+
+func buildRouterAdvertisement(config *radvDaemonConfig) (*ndp.RouterAdvertisement, error) {
+	routerLifetime := time.Duration(config.RouterLifetime) * time.Second
+
+	var options []ndp.Option
+
+	// Add a Prefix Information Option for each prefix.
+	for _, p := range config.prefixes() {
+		prefix, err := netip.ParsePrefix(p.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %s: %w", p.Prefix, err)
+		}
+		prefixInfo := &ndp.PrefixInformation{
+			PrefixLength:                   uint8(prefix.Bits()),
+			OnLink:                         p.OnLink,
+			AutonomousAddressConfiguration: p.Autonomous,
+			ValidLifetime:                  time.Duration(p.ValidLifetime) * time.Second,
+			PreferredLifetime:              time.Duration(p.PreferredLifetime) * time.Second,
+			Prefix:                         prefix.Masked().Addr(),
+		}
+		options = append(options, prefixInfo)
+	}
 
 	// Add Route Information Options if specified
 	for _, route := range config.Routes {
 		rPrefix, err := netip.ParsePrefix(route)
 		if err != nil {
-			log.Printf("Warning: invalid route prefix %s: %v", route, err)
-			continue
+			return nil, fmt.Errorf("invalid route prefix %s: %w", route, err)
 		}
 		routeInfo := &ndp.RouteInformation{
 			PrefixLength: uint8(rPrefix.Bits()),
-			Prefix:       rPrefix.Addr(),
+			Prefix:       rPrefix.Masked().Addr(),
 			// By default, the preference is Medium (0) and lifetime is RouterLifetime.
 			// This matches radvd's default behavior for route information options.
 			Preference:    ndp.Medium,
-			RouteLifetime: time.Duration(config.RouterLifetime) * time.Second,
+			RouteLifetime: routerLifetime,
 		}
 		options = append(options, routeInfo)
 	}
 
-	// Add DNS servers if specified
+	// Add DNS servers (RFC 8106) if specified.
+	servers := config.RDNSS
 	if config.DNSServers != "" {
-		servers := strings.Split(config.DNSServers, ",")
-		var dnsAddrs []netip.Addr
-		for _, server := range servers {
-			server = strings.TrimSpace(server)
-			if addr, err := netip.ParseAddr(server); err == nil {
-				dnsAddrs = append(dnsAddrs, addr)
-			} else {
-				log.Printf("Warning: invalid DNS server address %s: %v", server, err)
-			}
+		servers = append(strings.Split(config.DNSServers, ","), servers...)
+	}
+	var dnsAddrs []netip.Addr
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		addr, err := netip.ParseAddr(server)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return nil, fmt.Errorf("invalid DNS server address %q", server)
 		}
-		if len(dnsAddrs) > 0 {
-			rdnss := &ndp.RecursiveDNSServer{
-				Lifetime: time.Duration(config.RouterLifetime) * time.Second,
-				Servers:  dnsAddrs,
-			}
-			options = append(options, rdnss)
+		dnsAddrs = append(dnsAddrs, addr)
+	}
+	if len(dnsAddrs) > 0 {
+		lifetime := routerLifetime
+		if config.RDNSSLifetime > 0 {
+			lifetime = time.Duration(config.RDNSSLifetime) * time.Second
+		}
+		options = append(options, &ndp.RecursiveDNSServer{
+			Lifetime: lifetime,
+			Servers:  dnsAddrs,
+		})
+	}
+	if len(config.DNSSL) > 0 {
+		lifetime := routerLifetime
+		if config.DNSSLLifetime > 0 {
+			lifetime = time.Duration(config.DNSSLLifetime) * time.Second
 		}
+		options = append(options, &ndp.DNSSearchList{
+			Lifetime:    lifetime,
+			DomainNames: config.DNSSL,
+		})
+	}
+
+	if config.MTU > 0 {
+		options = append(options, ndp.NewMTU(uint32(config.MTU)))
+	}
+
+	// Add the NAT64 prefix (RFC 8781) if specified.
+	if config.PREF64 != nil {
+		prefix, err := netip.ParsePrefix(config.PREF64.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PREF64 prefix %s: %w", config.PREF64.Prefix, err)
+		}
+		lifetime := config.PREF64.Lifetime
+		if lifetime <= 0 {
+			// RFC 8781 recommends 3 times the maximum RA interval.
+			lifetime = 3 * config.MaxInterval
+		}
+		// The lifetime is sent in units of 8 seconds in 13 bits.
+		lifetime = min(lifetime, 8191*8)
+		options = append(options, &ndp.PREF64{
+			Lifetime: time.Duration(lifetime) * time.Second,
+			Prefix:   prefix.Masked(),
+		})
+	}
+
+	var preference ndp.Preference
+	switch config.RouterPreference {
+	case "", "medium":
+		preference = ndp.Medium
+	case "low":
+		preference = ndp.Low
+	case "high":
+		preference = ndp.High
+	default:
+		return nil, fmt.Errorf("invalid router preference %q", config.RouterPreference)
 	}
 
 	ra := &ndp.RouterAdvertisement{
-		CurrentHopLimit:      uint8(config.HopLimit),
-		ManagedConfiguration: config.ManagedConfig,
-		OtherConfiguration:   config.OtherConfig,
-		RouterLifetime:       time.Duration(config.RouterLifetime) * time.Second,
-		ReachableTime:        0, // Unspecified
-		RetransmitTimer:      0, // Unspecified
-		Options:              options,
+		CurrentHopLimit:           uint8(config.HopLimit),
+		ManagedConfiguration:      config.ManagedConfig,
+		OtherConfiguration:        config.OtherConfig,
+		RouterSelectionPreference: preference,
+		RouterLifetime:            routerLifetime,
+		ReachableTime:             0, // Unspecified
+		RetransmitTimer:           0, // Unspecified
+		Options:                   options,
+	}
+
+	// Make sure the options can be marshaled, e.g. PREF64 only supports some
+	// prefix lengths.
+	if _, err := ndp.MarshalMessage(ra); err != nil {
+		return nil, err
 	}
 
-	return ra
+	return ra, nil
 }
 
-func runRADaemon(ctx context.Context, conn *ndp.Conn, ra *ndp.RouterAdvertisement, config *radvDaemonConfig, iface *net.Interface) error {
+// withdrawnOptions returns the prefixes and routes advertised by old but not
+// by ra anymore, with zero lifetimes so that the hosts deprecate them right
+// away instead of waiting for them to expire.
+func withdrawnOptions(old, ra *ndp.RouterAdvertisement) []ndp.Option {
+	current := make(map[netip.Prefix]bool)
+	for _, o := range ra.Options {
+		switch o := o.(type) {
+		case *ndp.PrefixInformation:
+			current[netip.PrefixFrom(o.Prefix, int(o.PrefixLength))] = true
+		case *ndp.RouteInformation:
+			current[netip.PrefixFrom(o.Prefix, int(o.PrefixLength))] = true
+		}
+	}
+
+	var withdrawn []ndp.Option
+	for _, o := range old.Options {
+		switch o := o.(type) {
+		case *ndp.PrefixInformation:
+			if !current[netip.PrefixFrom(o.Prefix, int(o.PrefixLength))] {
+				p := *o
+				p.ValidLifetime, p.PreferredLifetime = 0, 0
+				withdrawn = append(withdrawn, &p)
+			}
+		case *ndp.RouteInformation:
+			if !current[netip.PrefixFrom(o.Prefix, int(o.PrefixLength))] {
+				r := *o
+				r.RouteLifetime = 0
+				withdrawn = append(withdrawn, &r)
+			}
+		}
+	}
+	return withdrawn
+}
+
+func runRADaemon(ctx context.Context, conn *ndp.Conn, initial *ndp.RouterAdvertisement,
+	config *radvDaemonConfig, hupChan <-chan os.Signal,
+) error {
+	// The RA is replaced when the config file is reloaded.
+	var ra atomic.Pointer[ndp.RouterAdvertisement]
+	ra.Store(initial)
+
 	// Set up periodic RA sending.
 	ticker := time.NewTicker(time.Duration(config.MaxInterval) * time.Second)
 	defer ticker.Stop()
 
 	// Send initial RA.
-	if err := sendRA(conn, ra, iface); err != nil {
+	if err := sendRA(conn, initial); err != nil {
 		return fmt.Errorf("failed to send initial RA: %w", err)
 	}
 
@@ -206,7 +362,7 @@ func runRADaemon(ctx context.Context, conn *ndp.Conn, ra *ndp.RouterAdvertisemen
 			if _, ok := msg.(*ndp.RouterSolicitation); ok {
 				log.Println("Received Router Solicitation")
 				// Send RA in response to Router Solicitation.
-				if err := sendRA(conn, ra, iface); err != nil {
+				if err := sendRA(conn, ra.Load()); err != nil {
 					log.Printf("Error sending RA in response to RS: %v", err)
 				}
 			}
@@ -219,14 +375,41 @@ func runRADaemon(ctx context.Context, conn *ndp.Conn, ra *ndp.RouterAdvertisemen
 			return nil
 		case <-ticker.C:
 			// Send periodic RA.
-			if err := sendRA(conn, ra, iface); err != nil {
+			if err := sendRA(conn, ra.Load()); err != nil {
 				log.Printf("Error sending periodic RA: %v", err)
 			}
+		case <-hupChan:
+			log.Println("Reloading config file")
+			newConfig, err := loadRADVConfig(*radvConfig)
+			if err != nil {
+				log.Printf("Error reloading, keeping the current config: %v", err)
+				continue
+			}
+			newRA, err := buildRouterAdvertisement(newConfig)
+			if err != nil {
+				log.Printf("Invalid config file, keeping the current config: %v", err)
+				continue
+			}
+			if newConfig.Interface != config.Interface {
+				log.Printf("Warning: the interface can't be changed on reload, still using %s", config.Interface)
+				newConfig.Interface = config.Interface
+			}
+
+			// Send an unsolicited RA right away so that the hosts pick up the
+			// changes, including the prefixes and routes that were removed.
+			unsolicited := *newRA
+			unsolicited.Options = append(withdrawnOptions(ra.Load(), newRA), newRA.Options...)
+			ra.Store(newRA)
+			config = newConfig
+			ticker.Reset(time.Duration(config.MaxInterval) * time.Second)
+			if err := sendRA(conn, &unsolicited); err != nil {
+				log.Printf("Error sending RA after reload: %v", err)
+			}
 		}
 	}
 }
 
-func sendRA(conn *ndp.Conn, ra *ndp.RouterAdvertisement, iface *net.Interface) error {
+func sendRA(conn *ndp.Conn, ra *ndp.RouterAdvertisement) error {
 	// Send to all-nodes multicast address (ff02::1).
 	dst := netip.MustParseAddr("ff02::1")
 
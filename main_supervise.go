@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// supervisorStatusInterval is how often the status file is refreshed while
+// nothing happens, to keep its uptime current.
+const supervisorStatusInterval = 10 * time.Second
+
+// superviseExit describes how the supervised child ended its last run.
+type superviseExit struct {
+	Code   int       `json:"code"`             // -1 when killed by a signal or not started.
+	Signal string    `json:"signal,omitempty"` // e.g. "SIGKILL".
+	Error  string    `json:"error,omitempty"`  // Set when the child couldn't be started.
+	At     time.Time `json:"at"`
+	// UptimeS is how long that run of the child lasted.
+	UptimeS float64 `json:"uptime_s"`
+}
+
+// superviseStatus is the JSON status file of the supervise mode.
+type superviseStatus struct {
+	SupervisorPID int      `json:"supervisor_pid"`
+	Command       []string `json:"command"`
+	// State is "running", "backoff" (waiting to restart the child),
+	// "stopped" (by a signal to the supervisor), "exited" (the restart
+	// policy says not to restart the child) or "failed" (max restarts).
+	State     string         `json:"state"`
+	PID       int            `json:"pid"` // Of the child, 0 while not running.
+	Restarts  int            `json:"restarts"`
+	StartedAt time.Time      `json:"started_at"` // Of the current (or last) run of the child.
+	UptimeS   float64        `json:"uptime_s"`
+	LastExit  *superviseExit `json:"last_exit,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// rotatingLog is an io.Writer appending to a file which is rotated once it
+// reaches maxSize: path.1 is the most recent old log and at most keep old
+// logs are kept.
+type rotatingLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+func newRotatingLog(path string, maxSize int64, keep int) (*rotatingLog, error) {
+	l := &rotatingLog{path: path, maxSize: maxSize, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *rotatingLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+func (l *rotatingLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	for i := l.keep - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if l.keep > 0 {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *rotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// superviseBackoff returns the delay before the restart which follows the
+// given number of failed runs in a row: initial, doubled for each failure,
+// capped at maxDelay. A child which exited successfully (failures 0) is
+// restarted after initial.
+func superviseBackoff(failures int, initial, maxDelay time.Duration) time.Duration {
+	d := initial
+	for i := 1; i < failures && d < maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxDelay)
+}
+
+// failed reports whether the run didn't end with a successful exit.
+func (e *superviseExit) failed() bool {
+	return e.Code != 0 || e.Signal != "" || e.Error != ""
+}
+
+// superviseShouldRestart applies the restart policy to the last exit.
+func superviseShouldRestart(policy string, e *superviseExit) bool {
+	switch policy {
+	case "always":
+		return true
+	case "on-failure":
+		return e.failed()
+	default:
+		return false
+	}
+}
+
+// superviseExitOf builds the exit description of a run of the child which
+// started at started and whose Start or Wait returned err.
+func superviseExitOf(ps *os.ProcessState, err error, started time.Time) *superviseExit {
+	now := time.Now()
+	e := &superviseExit{Code: -1, At: now, UptimeS: superviseSeconds(now.Sub(started))}
+	if ps == nil {
+		if err != nil {
+			e.Error = err.Error()
+		}
+		return e
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		e.Signal = unix.SignalName(ws.Signal())
+		if e.Signal == "" {
+			e.Signal = strconv.Itoa(int(ws.Signal()))
+		}
+		return e
+	}
+	e.Code = ps.ExitCode()
+	return e
+}
+
+// superviseSeconds returns d in seconds, rounded to milliseconds.
+func superviseSeconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
+
+// writeSuperviseStatus atomically replaces the status file at path.
+func writeSuperviseStatus(path string, st *superviseStatus) error {
+	st.UpdatedAt = time.Now()
+	st.UptimeS = 0
+	if st.PID != 0 {
+		st.UptimeS = superviseSeconds(st.UpdatedAt.Sub(st.StartedAt))
+	}
+	x, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, append(x, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func superviseMain(args []string) ExitCode {
+	// The child is started with a parent death signal where supported, which
+	// is delivered when the thread which started it exits, so all children
+	// are started from this (locked) thread.
+	runtime.LockOSThread()
+
+	var logW io.Writer = os.Stderr
+	childOut, childErr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if *svLog != "" {
+		l, err := newRotatingLog(*svLog, *svLogMaxSize, *svLogKeep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't open log file '%s': %v\n", *svLog, err)
+			return ExitError
+		}
+		defer l.Close()
+		logW, childOut, childErr = l, l, l
+	}
+	logger := slog.New(slog.NewTextHandler(logW, &slog.HandlerOptions{Level: slog.LevelInfo})).With("supervisor", os.Getpid())
+
+	st := &superviseStatus{SupervisorPID: os.Getpid(), Command: args}
+	writeStatus := func() {
+		if *svStatus == "" {
+			return
+		}
+		if err := writeSuperviseStatus(*svStatus, st); err != nil {
+			logger.Error("Can't write the status file", "file", *svStatus, "error", err)
+		}
+	}
+
+	// SIGTERM, SIGINT and SIGQUIT stop the child and the supervisor, the
+	// other signals are only forwarded (e.g. SIGHUP for a config reload).
+	sigCh := make(chan os.Signal, 4)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	isStop := func(sig os.Signal) bool {
+		return sig == syscall.SIGTERM || sig == syscall.SIGINT || sig == syscall.SIGQUIT
+	}
+
+	ticker := time.NewTicker(supervisorStatusInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout, cmd.Stderr = childOut, childErr
+		cmd.SysProcAttr = superviseSysProcAttr()
+
+		started := time.Now()
+		var last *superviseExit
+		stopping := false
+		if err := cmd.Start(); err != nil {
+			last = superviseExitOf(nil, err, started)
+			logger.Error("Can't start the child", "command", args[0], "error", err)
+		} else {
+			st.State, st.PID, st.StartedAt = "running", cmd.Process.Pid, started
+			writeStatus()
+			logger.Info("Started the child", "pid", cmd.Process.Pid, "command", args, "restarts", st.Restarts)
+
+			waitErr := make(chan error, 1)
+			go func() { waitErr <- cmd.Wait() }()
+
+			var killTimer <-chan time.Time
+		wait:
+			for {
+				select {
+				case err := <-waitErr:
+					last = superviseExitOf(cmd.ProcessState, err, started)
+					break wait
+				case sig := <-sigCh:
+					logger.Info("Forwarding signal to the child", "signal", sig, "pid", cmd.Process.Pid)
+					_ = cmd.Process.Signal(sig)
+					if isStop(sig) && !stopping {
+						stopping = true
+						killTimer = time.After(*svStopTimeout)
+					}
+				case <-killTimer:
+					logger.Warn("The child didn't stop in time, killing it", "pid", cmd.Process.Pid, "timeout", *svStopTimeout)
+					_ = cmd.Process.Kill()
+				case <-ticker.C:
+					writeStatus()
+				}
+			}
+		}
+
+		st.PID, st.LastExit = 0, last
+		logger.Info("The child exited", "code", last.Code, "signal", last.Signal, "error", last.Error, "uptime_s", last.UptimeS)
+		if stopping {
+			st.State = "stopped"
+			writeStatus()
+			return ExitSuccess
+		}
+		if !superviseShouldRestart(*svRestart, last) {
+			st.State = "exited"
+			writeStatus()
+			return superviseExitCode(last)
+		}
+
+		// A successful run, or one which lasted at least the maximum
+		// backoff, resets the failure count, otherwise the delays keep
+		// growing.
+		if !last.failed() || time.Duration(last.UptimeS*float64(time.Second)) >= *svMaxBackoff {
+			failures = 0
+		}
+		if last.failed() {
+			failures++
+		}
+		if *svMaxRestarts > 0 && failures > *svMaxRestarts {
+			logger.Error("Giving up, the child failed too many times in a row", "failures", failures, "max_restarts", *svMaxRestarts)
+			st.State = "failed"
+			writeStatus()
+			return superviseExitCode(last)
+		}
+
+		delay := superviseBackoff(failures, *svBackoff, *svMaxBackoff)
+		st.State = "backoff"
+		writeStatus()
+		logger.Info("Restarting the child", "delay", delay, "failures", failures)
+
+		timer := time.NewTimer(delay)
+	backoff:
+		for {
+			select {
+			case <-timer.C:
+				break backoff
+			case sig := <-sigCh:
+				if isStop(sig) {
+					timer.Stop()
+					logger.Info("Stopped while waiting to restart the child", "signal", sig)
+					st.State = "stopped"
+					writeStatus()
+					return ExitSuccess
+				}
+			case <-ticker.C:
+				writeStatus()
+			}
+		}
+		st.Restarts++
+	}
+}
+
+// superviseExitCode returns the exit code of the supervisor which gives up
+// on a child which ended as described by e.
+func superviseExitCode(e *superviseExit) ExitCode {
+	if e.Code > 0 {
+		return ExitCode(e.Code)
+	}
+	if e.Code < 0 {
+		return ExitError
+	}
+	return ExitSuccess
+}
+
+// validateSuperviseFlags checks the supervise mode CLI flags.
+func validateSuperviseFlags(args []string) error {
+	if len(args) == 0 {
+		return errors.New("MUST specify the command to supervise after `--`")
+	}
+	switch *svRestart {
+	case "always", "on-failure", "never":
+	default:
+		return fmt.Errorf("`-sv.restart` MUST be one of always, on-failure or never, not %q", *svRestart)
+	}
+	if *svBackoff <= 0 || *svMaxBackoff < *svBackoff {
+		return errors.New("`-sv.backoff` MUST be positive and not greater than `-sv.max-backoff`")
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build darwin && arm64
+// +build darwin,arm64
+
+package main
+
+import "syscall"
+
+// superviseSysProcAttr returns no attributes: macOS has no parent death
+// signal, so a child survives a SIGKILL of its supervisor.
+func superviseSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import "syscall"
+
+// superviseSysProcAttr makes the kernel kill the supervised child when the
+// supervisor dies, even of a SIGKILL which it can't forward.
+func superviseSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,121 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/pin/tftp/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// tftpCfg is the YAML configuration for the tftp-server mode.
+type tftpCfg struct {
+	Listen    string `yaml:"listen"`
+	Interface string `yaml:"interface"`
+	// Root is the directory from which the files are served, read-only.
+	Root      string `yaml:"root"`
+	BlockSize int    `yaml:"block_size"`
+}
+
+// tftpHook logs the result of every transfer.
+type tftpHook struct {
+	logger *slog.Logger
+}
+
+func (h tftpHook) OnSuccess(stats tftp.TransferStats) {
+	h.logger.Info("Transfer done", "client", stats.RemoteAddr, "file", stats.Filename,
+		"duration", stats.Duration, "datagrams", stats.DatagramsSent)
+}
+
+func (h tftpHook) OnFailure(stats tftp.TransferStats, err error) {
+	h.logger.Warn("Transfer failed", "client", stats.RemoteAddr, "file", stats.Filename, "error", err)
+}
+
+// tftpFileName returns the name of the requested file relative to the root.
+// Some PXE ROMs use backslashes as path separator or ask for an absolute path.
+func tftpFileName(filename string) string {
+	name := strings.TrimLeft(path.Clean("/"+strings.ReplaceAll(filename, `\`, "/")), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func tftpServerMain() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	cfgData, err := os.ReadFile(*tftpConfig)
+	if err != nil {
+		logger.Error("Failed to read config file", "path", *tftpConfig, "error", err)
+		os.Exit(1)
+	}
+
+	var cfg tftpCfg
+	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
+		logger.Error("Failed to parse config file", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":69"
+	}
+
+	// os.Root doesn't let a request escape the root directory, neither with
+	// `..` nor with a symlink.
+	root, err := os.OpenRoot(cfg.Root)
+	if err != nil {
+		logger.Error("Failed to open root directory", "root", cfg.Root, "error", err)
+		os.Exit(1)
+	}
+
+	readHandler := func(filename string, rf io.ReaderFrom) error {
+		f, err := root.Open(tftpFileName(filename))
+		if err != nil {
+			logger.Warn("Failed to open file", "file", filename, "error", err)
+			return err
+		}
+		defer f.Close()
+		// The transfer size (tsize option) is taken from the file with Seek.
+		_, err = rf.ReadFrom(f)
+		return err
+	}
+	// No write handler, the server is read-only.
+	srv := tftp.NewServer(readHandler, nil)
+	srv.SetHook(tftpHook{logger: logger})
+	if cfg.BlockSize > 0 {
+		srv.SetBlockSize(cfg.BlockSize)
+	}
+
+	pc, err := bindToDeviceListenConfig(cfg.Interface).ListenPacket(context.Background(), "udp", cfg.Listen)
+	if err != nil {
+		logger.Error("Failed to listen on UDP", "listen", cfg.Listen, "interface", cfg.Interface, "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("TFTP server started", "listen", cfg.Listen, "interface", cfg.Interface, "root", cfg.Root)
+
+	go func() {
+		if err := srv.Serve(pc); err != nil {
+			logger.Error("TFTP server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	logger.Info("Received signal, shutting down", "signal", sig)
+	srv.Shutdown()
+	_ = pc.Close()
+}
@@ -0,0 +1,733 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/andrei-zededa/monitor-system-usage/pkg/msuformat"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// trafficMagic starts the payload of every UDP packet of a flow.
+	trafficMagic = "ZATF"
+	// trafficHeaderLen is the length of the UDP payload header: the magic,
+	// the flow ID, the sequence number and the send time (unix nanoseconds).
+	trafficHeaderLen = 24
+	// trafficEchoGrace is how long the sender waits for the last echoed
+	// packets once it stopped sending.
+	trafficEchoGrace = time.Second
+	// trafficReconnectDelay is the delay between TCP connection attempts.
+	trafficReconnectDelay = time.Second
+)
+
+// trafficCfg is the YAML configuration for the traffic mode.
+type trafficCfg struct {
+	// Mode is `send` or `receive`.
+	Mode     string `yaml:"mode"`
+	Protocol string `yaml:"protocol"`
+	// Target is the host:port to which a sender sends.
+	Target string `yaml:"target"`
+	// Listen is the [address]:port on which a receiver listens.
+	Listen    string `yaml:"listen"`
+	Interface string `yaml:"interface"`
+	// Rate is the payload rate of a sender in bits per second, 0 means as
+	// fast as possible.
+	Rate       int64 `yaml:"rate"`
+	PacketSize int   `yaml:"packet_size"`
+	// Duration of the flow, 0 means until stopped.
+	Duration time.Duration `yaml:"duration"`
+	DSCP     int           `yaml:"dscp"`
+	// Echo makes a UDP sender expect every packet back, from an echo server.
+	Echo        bool          `yaml:"echo"`
+	Interval    time.Duration `yaml:"interval"`
+	OutputFile  string        `yaml:"output_file"`
+	SummaryFile string        `yaml:"summary_file"`
+}
+
+// trafficSummary is written to the summary file when the flow ends.
+type trafficSummary struct {
+	Mode     string `yaml:"mode"`
+	Protocol string `yaml:"protocol"`
+	// Finished is true when the flow ran for its whole duration.
+	Finished      bool     `yaml:"finished"`
+	Elapsed       float64  `yaml:"elapsed_s"`
+	Bytes         int64    `yaml:"bytes"`
+	Packets       int64    `yaml:"packets,omitempty"`
+	ThroughputBPS int64    `yaml:"throughput_bps"`
+	LossPercent   *float64 `yaml:"loss_percent,omitempty"`
+	JitterMS      *float64 `yaml:"jitter_ms,omitempty"`
+	RTTMS         *float64 `yaml:"rtt_ms,omitempty"`
+}
+
+// trafficTotals are the cumulative counters of a flow.
+type trafficTotals struct {
+	Bytes   int64
+	Packets int64
+	// Expected is the number of UDP packets that should have been received:
+	// from the sequence numbers for a receiver, the sent packets for an
+	// echo sender.
+	Expected   int64
+	Received   int64
+	OutOfOrder int64
+	Errors     int64
+}
+
+// rttStats accumulates round-trip times.
+type rttStats struct {
+	n             int64
+	sum, min, max time.Duration
+}
+
+func (s *rttStats) add(d time.Duration) {
+	if s.n == 0 || d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+	s.n++
+	s.sum += d
+}
+
+func (s rttStats) avg() time.Duration {
+	if s.n == 0 {
+		return 0
+	}
+	return s.sum / time.Duration(s.n)
+}
+
+// trafficMeter measures a flow, it is shared by the sending or receiving
+// goroutines and the reporter.
+type trafficMeter struct {
+	mu      sync.Mutex
+	t       trafficTotals
+	lastErr string
+	// The flow (sender run) and sequence numbers seen by a receiver.
+	haveFlow bool
+	flow     uint32
+	first    int64
+	maxSeq   int64
+	// expBase is the expected packets of the previous flows.
+	expBase int64
+	// jitter is the RFC 3550 interarrival jitter (in nanoseconds) of the
+	// one-way transit time, or of the round-trip time for an echo sender.
+	jitter      float64
+	havePrev    bool
+	prev        int64
+	rtt         rttStats
+	rttTotal    rttStats
+	firstRecvAt time.Time
+	lastRecvAt  time.Time
+}
+
+func (m *trafficMeter) sent(n int, echo bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.t.Bytes += int64(n)
+	m.t.Packets++
+	if echo {
+		m.t.Expected++
+	}
+}
+
+func (m *trafficMeter) received(n int, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.t.Bytes += int64(n)
+	m.t.Packets++
+	if m.firstRecvAt.IsZero() {
+		m.firstRecvAt = now
+	}
+	m.lastRecvAt = now
+}
+
+func (m *trafficMeter) addJitter(v int64) {
+	if m.havePrev {
+		d := math.Abs(float64(v - m.prev))
+		m.jitter += (d - m.jitter) / 16
+	}
+	m.prev = v
+	m.havePrev = true
+}
+
+// receivedUDP accounts a UDP packet, echoed back to a sender or received by a
+// receiver. The bytes of a sender are the sent ones, the packets of a receiver
+// without a valid header only count as bytes.
+func (m *trafficMeter) receivedUDP(b []byte, now time.Time, echo bool) {
+	if !echo {
+		m.received(len(b), now)
+	}
+	if len(b) < trafficHeaderLen || string(b[:4]) != trafficMagic {
+		return
+	}
+	flow := binary.BigEndian.Uint32(b[4:8])
+	seq := int64(binary.BigEndian.Uint64(b[8:16]))
+	ts := int64(binary.BigEndian.Uint64(b[16:24]))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.t.Received++
+	if echo {
+		rtt := time.Duration(now.UnixNano() - ts)
+		m.rtt.add(rtt)
+		m.rttTotal.add(rtt)
+		m.addJitter(int64(rtt))
+		return
+	}
+	if !m.haveFlow || flow != m.flow {
+		if m.haveFlow {
+			m.expBase += m.maxSeq - m.first + 1
+		}
+		m.haveFlow, m.flow, m.first, m.maxSeq = true, flow, seq, seq
+		m.havePrev = false
+	}
+	if seq > m.maxSeq {
+		m.maxSeq = seq
+	} else if seq < m.maxSeq {
+		m.t.OutOfOrder++
+	}
+	m.t.Expected = m.expBase + m.maxSeq - m.first + 1
+	// The clocks of the sender and of the receiver don't need to be in sync,
+	// a constant offset cancels out.
+	m.addJitter(now.UnixNano() - ts)
+}
+
+func (m *trafficMeter) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.t.Errors++
+	m.lastErr = err.Error()
+}
+
+// trafficSnapshot is the state of a meter at the end of an interval.
+type trafficSnapshot struct {
+	t       trafficTotals
+	lastErr string
+	jitter  time.Duration
+	rtt     rttStats
+}
+
+// snapshot returns the current state and resets the interval statistics.
+func (m *trafficMeter) snapshot() trafficSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := trafficSnapshot{t: m.t, lastErr: m.lastErr, jitter: time.Duration(m.jitter), rtt: m.rtt}
+	m.rtt = rttStats{}
+	m.lastErr = ""
+	return s
+}
+
+// trafficLoss returns the lost packets and the loss percentage.
+func trafficLoss(expected, received int64) (int64, float64) {
+	lost := max(expected-received, 0)
+	if expected <= 0 {
+		return 0, 0
+	}
+	return lost, float64(lost) * 100 / float64(expected)
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000.0
+}
+
+// trafficReport formats the statistics of one interval, the difference
+// between two snapshots.
+func trafficReport(cfg *trafficCfg, cur, prev trafficSnapshot, elapsed time.Duration, tcpInfo *unix.TCPInfo) string {
+	var b strings.Builder
+	bytes := cur.t.Bytes - prev.t.Bytes
+	fmt.Fprintf(&b, "elapsed_s: %.3f\n", elapsed.Seconds())
+	fmt.Fprintf(&b, "bytes: %d\n", bytes)
+	if cfg.Protocol == "udp" {
+		fmt.Fprintf(&b, "packets: %d\n", cur.t.Packets-prev.t.Packets)
+	}
+	if elapsed > 0 {
+		fmt.Fprintf(&b, "throughput_bps: %.0f\n", float64(bytes)*8/elapsed.Seconds())
+	}
+	if cfg.Protocol == "udp" && (cfg.Mode == "receive" || cfg.Echo) {
+		expected := cur.t.Expected - prev.t.Expected
+		received := cur.t.Received - prev.t.Received
+		lost, loss := trafficLoss(expected, received)
+		fmt.Fprintf(&b, "expected: %d\n", expected)
+		fmt.Fprintf(&b, "received: %d\n", received)
+		fmt.Fprintf(&b, "lost: %d\n", lost)
+		fmt.Fprintf(&b, "loss_percent: %.2f\n", loss)
+		fmt.Fprintf(&b, "jitter_ms: %.3f\n", durationMS(cur.jitter))
+		if cfg.Mode == "receive" {
+			fmt.Fprintf(&b, "out_of_order: %d\n", cur.t.OutOfOrder-prev.t.OutOfOrder)
+		}
+		if cur.rtt.n > 0 {
+			fmt.Fprintf(&b, "rtt min/avg/max: %.2f/%.2f/%.2f ms\n",
+				durationMS(cur.rtt.min), durationMS(cur.rtt.avg()), durationMS(cur.rtt.max))
+		}
+	}
+	if tcpInfo != nil {
+		fmt.Fprintf(&b, "tcp_rtt_ms: %.3f\n", float64(tcpInfo.Rtt)/1000.0)
+		fmt.Fprintf(&b, "tcp_total_retrans: %d\n", tcpInfo.Total_retrans)
+	}
+	if errs := cur.t.Errors - prev.t.Errors; errs > 0 {
+		fmt.Fprintf(&b, "errors: %d\n", errs)
+	}
+	return b.String()
+}
+
+// trafficControl returns a socket Control function which binds the socket to
+// the interface, if any, and sets the DSCP of the packets it sends.
+func trafficControl(iface string, dscp int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			if iface != "" {
+				if serr = syscall.BindToDevice(int(fd), iface); serr != nil {
+					return
+				}
+			}
+			if dscp == 0 {
+				return
+			}
+			if strings.HasSuffix(network, "6") {
+				serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, dscp<<2)
+			} else {
+				serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, dscp<<2)
+			}
+		}); err != nil {
+			return err
+		}
+		return serr
+	}
+}
+
+// sleepCtx sleeps for d, it returns false if ctx is done first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// trafficPace calls send every time the rate (bits per second) allows size
+// more bytes, until ctx is done. A rate of 0 doesn't limit send.
+func trafficPace(ctx context.Context, rate int64, size int, send func()) {
+	start := time.Now()
+	var sent int64
+	for ctx.Err() == nil {
+		if rate > 0 {
+			allowed := int64(float64(rate) / 8 * time.Since(start).Seconds())
+			if ahead := sent + int64(size) - allowed; ahead > 0 {
+				sleepCtx(ctx, time.Duration(float64(ahead)*8/float64(rate)*float64(time.Second)))
+				continue
+			}
+		}
+		send()
+		sent += int64(size)
+	}
+}
+
+// trafficSendUDP sends the UDP flow over conn, and receives the echoed packets
+// if enabled, until conn is closed.
+func trafficSendUDP(ctx context.Context, cfg *trafficCfg, conn net.Conn, m *trafficMeter, logger *slog.Logger) {
+	if cfg.Echo {
+		go func() {
+			buf := make([]byte, 65535)
+			for {
+				n, err := conn.Read(buf)
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					// E.g. ECONNREFUSED from an ICMP port unreachable.
+					m.fail(err)
+					continue
+				}
+				m.receivedUDP(buf[:n], time.Now(), true)
+			}
+		}()
+	}
+
+	buf := make([]byte, cfg.PacketSize)
+	copy(buf, trafficMagic)
+	binary.BigEndian.PutUint32(buf[4:8], rand.Uint32())
+	var seq uint64
+	trafficPace(ctx, cfg.Rate, cfg.PacketSize, func() {
+		binary.BigEndian.PutUint64(buf[8:16], seq)
+		binary.BigEndian.PutUint64(buf[16:24], uint64(time.Now().UnixNano()))
+		seq++
+		if _, err := conn.Write(buf); err != nil {
+			m.fail(err)
+			return
+		}
+		m.sent(len(buf), cfg.Echo)
+	})
+	logger.Info("Sending done", "packets", seq)
+}
+
+// trafficSendTCP sends the TCP flow, reconnecting after any error. The current
+// connection is kept in cur for its TCP_INFO.
+func trafficSendTCP(ctx context.Context, cfg *trafficCfg, m *trafficMeter, cur *atomic.Pointer[net.TCPConn], logger *slog.Logger) {
+	d := net.Dialer{Control: trafficControl(cfg.Interface, cfg.DSCP)}
+	buf := make([]byte, cfg.PacketSize)
+	for ctx.Err() == nil {
+		c, err := d.DialContext(ctx, "tcp", cfg.Target)
+		if err != nil {
+			if ctx.Err() == nil {
+				m.fail(err)
+				sleepCtx(ctx, trafficReconnectDelay)
+			}
+			continue
+		}
+		conn := c.(*net.TCPConn)
+		cur.Store(conn)
+		logger.Info("Connected", "local", conn.LocalAddr(), "remote", conn.RemoteAddr())
+
+		// A write blocks while the receiver doesn't read.
+		connCtx, cancel := context.WithCancel(ctx)
+		context.AfterFunc(connCtx, func() { _ = conn.Close() })
+		trafficPace(connCtx, cfg.Rate, cfg.PacketSize, func() {
+			if _, err := conn.Write(buf); err != nil {
+				if connCtx.Err() == nil {
+					m.fail(err)
+				}
+				cancel()
+				return
+			}
+			m.sent(len(buf), false)
+		})
+		cancel()
+		cur.Store(nil)
+		if ctx.Err() == nil {
+			sleepCtx(ctx, trafficReconnectDelay)
+		}
+	}
+}
+
+// trafficReceive starts receiving the flow in the background.
+func trafficReceive(ctx context.Context, cfg *trafficCfg, m *trafficMeter, logger *slog.Logger) (io.Closer, error) {
+	lc := net.ListenConfig{Control: trafficControl(cfg.Interface, cfg.DSCP)}
+
+	if cfg.Protocol == "udp" {
+		pc, err := lc.ListenPacket(ctx, "udp", cfg.Listen)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			buf := make([]byte, 65535)
+			for {
+				n, _, err := pc.ReadFrom(buf)
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					m.fail(err)
+					continue
+				}
+				m.receivedUDP(buf[:n], time.Now(), false)
+			}
+		}()
+		return pc, nil
+	}
+
+	ln, err := lc.Listen(ctx, "tcp", cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				m.fail(err)
+				continue
+			}
+			logger.Info("Accepted connection", "remote", conn.RemoteAddr())
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 128*1024)
+				for {
+					n, err := conn.Read(buf)
+					if n > 0 {
+						m.received(n, time.Now())
+					}
+					if err != nil {
+						if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+							m.fail(err)
+						}
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln, nil
+}
+
+// newTrafficSummary returns the summary of a flow from its last snapshot.
+func newTrafficSummary(cfg *trafficCfg, s trafficSnapshot, total rttStats, elapsed time.Duration, finished bool) trafficSummary {
+	sum := trafficSummary{
+		Mode:     cfg.Mode,
+		Protocol: cfg.Protocol,
+		Finished: finished,
+		Elapsed:  math.Round(elapsed.Seconds()*1000) / 1000,
+		Bytes:    s.t.Bytes,
+	}
+	if cfg.Protocol == "udp" {
+		sum.Packets = s.t.Packets
+	}
+	if elapsed > 0 {
+		sum.ThroughputBPS = int64(float64(s.t.Bytes) * 8 / elapsed.Seconds())
+	}
+	if cfg.Protocol == "udp" && (cfg.Mode == "receive" || cfg.Echo) {
+		_, loss := trafficLoss(s.t.Expected, s.t.Received)
+		loss = math.Round(loss*1000) / 1000
+		jitter := durationMS(s.jitter)
+		sum.LossPercent, sum.JitterMS = &loss, &jitter
+	}
+	if total.n > 0 {
+		rtt := durationMS(total.avg())
+		sum.RTTMS = &rtt
+	}
+	return sum
+}
+
+// writeTrafficSummary atomically writes the summary file.
+func writeTrafficSummary(path string, sum trafficSummary) error {
+	data, err := yaml.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func trafficMain() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	cfgData, err := os.ReadFile(*trafficConfig)
+	if err != nil {
+		logger.Error("Failed to read config file", "path", *trafficConfig, "error", err)
+		os.Exit(1)
+	}
+
+	var cfg trafficCfg
+	if err := yaml.Unmarshal(cfgData, &cfg); err != nil {
+		logger.Error("Failed to parse config file", "error", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case cfg.Mode != "send" && cfg.Mode != "receive":
+		logger.Error("mode must be send or receive", "mode", cfg.Mode)
+		os.Exit(1)
+	case cfg.Protocol != "udp" && cfg.Protocol != "tcp":
+		logger.Error("protocol must be udp or tcp", "protocol", cfg.Protocol)
+		os.Exit(1)
+	case cfg.Mode == "send" && cfg.Target == "":
+		logger.Error("target is required in config to send")
+		os.Exit(1)
+	case cfg.OutputFile == "":
+		logger.Error("output_file is required in config")
+		os.Exit(1)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.PacketSize <= 0 {
+		cfg.PacketSize = 1200
+	}
+	if cfg.Protocol == "udp" && cfg.PacketSize < trafficHeaderLen {
+		cfg.PacketSize = trafficHeaderLen
+	}
+
+	// Every run starts new output and summary files.
+	for _, f := range []string{cfg.OutputFile, cfg.SummaryFile} {
+		if f == "" {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			logger.Error("Failed to remove previous file", "path", f, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	w, err := msuformat.NewFileWriter(cfg.OutputFile)
+	if err != nil {
+		logger.Error("Failed to open MSU output file", "path", cfg.OutputFile, "error", err)
+		os.Exit(1)
+	}
+
+	hostname, _ := os.Hostname()
+	if err := w.WriteHeader(&msuformat.Header{
+		TS:            msuformat.NowNanos(),
+		MsuVer:        "traffic-" + version,
+		Hostname:      hostname,
+		KernelOSType:  readKernelFile("ostype"),
+		KernelRelease: readKernelFile("osrelease"),
+		KernelVersion: readKernelFile("version"),
+		IntervalNS:    cfg.Interval.Nanoseconds(),
+		FlushEveryN:   1,
+		CmdLine:       os.Args,
+		EnvMode:       msuformat.EnvModeNone,
+	}); err != nil {
+		logger.Error("Failed to write MSU header", "error", err)
+		os.Exit(1)
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	runCtx, cancel := sigCtx, context.CancelFunc(func() {})
+	if cfg.Duration > 0 {
+		runCtx, cancel = context.WithTimeout(sigCtx, cfg.Duration)
+	}
+	defer cancel()
+
+	addr := cfg.Target
+	if cfg.Mode == "receive" {
+		addr = cfg.Listen
+	}
+	cmd := fmt.Sprintf("traffic %s %s %s", cfg.Mode, cfg.Protocol, addr)
+
+	m := &trafficMeter{}
+	var tcpConn atomic.Pointer[net.TCPConn]
+	var closer io.Closer
+	start := time.Now()
+	sendDone := make(chan struct{})
+	switch {
+	case cfg.Mode == "receive":
+		if closer, err = trafficReceive(runCtx, &cfg, m, logger); err != nil {
+			logger.Error("Failed to listen", "listen", cfg.Listen, "interface", cfg.Interface, "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			<-runCtx.Done()
+			close(sendDone)
+		}()
+	case cfg.Protocol == "udp":
+		d := net.Dialer{Control: trafficControl(cfg.Interface, cfg.DSCP)}
+		conn, err := d.DialContext(runCtx, "udp", cfg.Target)
+		if err != nil {
+			logger.Error("Failed to create UDP socket", "target", cfg.Target, "interface", cfg.Interface, "error", err)
+			os.Exit(1)
+		}
+		closer = conn
+		go func() {
+			defer close(sendDone)
+			trafficSendUDP(runCtx, &cfg, conn, m, logger)
+		}()
+	default:
+		go func() {
+			defer close(sendDone)
+			trafficSendTCP(runCtx, &cfg, m, &tcpConn, logger)
+		}()
+	}
+
+	logger.Info("Traffic flow started", "mode", cfg.Mode, "protocol", cfg.Protocol, "address", addr,
+		"rate", cfg.Rate, "packet_size", cfg.PacketSize, "duration", cfg.Duration, "output", cfg.OutputFile)
+
+	var seq int64
+	prev, prevAt := trafficSnapshot{}, start
+	report := func(now time.Time) trafficSnapshot {
+		cur := m.snapshot()
+		var info *unix.TCPInfo
+		if c := tcpConn.Load(); c != nil {
+			info = tcpConnInfo(c)
+		}
+		if err := w.WriteSample("B", cmd, "", seq, now.UnixNano(), trafficReport(&cfg, cur, prev, now.Sub(prevAt), info), cur.lastErr); err != nil {
+			logger.Warn("WriteSample failed", "error", err)
+		}
+		if err := w.Flush(); err != nil {
+			logger.Warn("MSU flush failed", "error", err)
+		}
+		seq++
+		prev, prevAt = cur, now
+		return cur
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case now := <-ticker.C:
+			report(now)
+		case <-sendDone:
+			done = true
+		}
+	}
+	end := time.Now()
+	finished := sigCtx.Err() == nil
+	if cfg.Echo && finished {
+		sleepCtx(sigCtx, trafficEchoGrace)
+	}
+	if closer != nil {
+		_ = closer.Close()
+	}
+	last := report(time.Now())
+
+	// The throughput of a receiver is measured from the first to the last
+	// received bytes.
+	elapsed := end.Sub(start)
+	m.mu.Lock()
+	if cfg.Mode == "receive" {
+		elapsed = m.lastRecvAt.Sub(m.firstRecvAt)
+	}
+	total := m.rttTotal
+	m.mu.Unlock()
+	sum := newTrafficSummary(&cfg, last, total, elapsed, finished)
+	if out, err := yaml.Marshal(sum); err == nil {
+		if err := w.WriteSample("B", cmd+" summary", "", seq, msuformat.NowNanos(), string(out), ""); err != nil {
+			logger.Warn("WriteSample failed", "error", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		logger.Warn("MSU close failed", "error", err)
+	}
+	if cfg.SummaryFile != "" {
+		if err := writeTrafficSummary(cfg.SummaryFile, sum); err != nil {
+			logger.Error("Failed to write summary file", "path", cfg.SummaryFile, "error", err)
+			os.Exit(1)
+		}
+	}
+	logger.Info("Traffic flow done", "finished", finished, "bytes", sum.Bytes, "throughput_bps", sum.ThroughputBPS)
+}
+
+// tcpConnInfo returns the TCP_INFO of the connection, nil on error.
+func tcpConnInfo(c *net.TCPConn) *unix.TCPInfo {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var info *unix.TCPInfo
+	_ = rc.Control(func(fd uintptr) {
+		info, _ = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	return info
+}